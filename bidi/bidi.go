@@ -0,0 +1,767 @@
+// Package bidi implements the Unicode Bidirectional Algorithm, which
+// resolves the embedding level of each character of a paragraph and the
+// visual order of characters on a line.
+//
+// Spec references:
+// - UAX #9: Unicode Bidirectional Algorithm (https://www.unicode.org/reports/tr9/)
+//
+// Implemented:
+// - Paragraph level (§3.3.1 P2, P3)
+// - Explicit embeddings, overrides and isolates (§3.3.2 X1-X10)
+// - Weak types (§3.3.4 W1-W7), bracket pairs (§3.3.5 N0), neutrals (N1, N2)
+// - Implicit levels (§3.3.6 I1, I2)
+// - Trailing whitespace levels and reordering (§3.4 L1, L2)
+//
+// Character classes and bracket properties come from
+// golang.org/x/text/unicode/bidi, whose own resolver only reports the
+// direction of runs, not their levels.
+//
+// Not implemented:
+// - Mirroring (§3.4 L4), which is left to the shaper's mirrored glyphs
+// - Line breaking: the whole paragraph is treated as one line
+package bidi
+
+import (
+	"sort"
+
+	ubidi "golang.org/x/text/unicode/bidi"
+)
+
+// Level is an embedding level. Even levels are left-to-right and odd levels
+// are right-to-left.
+type Level uint8
+
+// MaxDepth is the deepest explicit embedding level.
+// UAX #9 §3.3.2 BD2
+const MaxDepth = 125
+
+// RTL reports whether the level is right-to-left.
+func (l Level) RTL() bool {
+	return l%2 == 1
+}
+
+// Directional formatting characters.
+// UAX #9 §2 Directional Formatting Characters
+const (
+	LRE = '\u202A' // Left-to-right embedding
+	RLE = '\u202B' // Right-to-left embedding
+	PDF = '\u202C' // Pop directional formatting
+	LRO = '\u202D' // Left-to-right override
+	RLO = '\u202E' // Right-to-left override
+	LRI = '\u2066' // Left-to-right isolate
+	RLI = '\u2067' // Right-to-left isolate
+	FSI = '\u2068' // First strong isolate
+	PDI = '\u2069' // Pop directional isolate
+)
+
+// maxBracketPairs is the depth of the bracket stack.
+// UAX #9 §3.1.3 BD16
+const maxBracketPairs = 63
+
+// class returns the bidirectional class of r.
+func class(r rune) ubidi.Class {
+	p, _ := ubidi.LookupRune(r)
+	return p.Class()
+}
+
+// isIsolateInitiator reports whether c starts an isolate.
+func isIsolateInitiator(c ubidi.Class) bool {
+	return c == ubidi.LRI || c == ubidi.RLI || c == ubidi.FSI
+}
+
+// isRemoved reports whether c is removed by rule X9.
+func isRemoved(c ubidi.Class) bool {
+	switch c {
+	case ubidi.LRE, ubidi.RLE, ubidi.LRO, ubidi.RLO, ubidi.PDF, ubidi.BN:
+		return true
+	}
+	return false
+}
+
+// isNeutralOrIsolate reports whether c is a neutral or isolate formatting
+// character (NI) for rules N1 and N2.
+func isNeutralOrIsolate(c ubidi.Class) bool {
+	switch c {
+	case ubidi.B, ubidi.S, ubidi.WS, ubidi.ON, ubidi.LRI, ubidi.RLI, ubidi.FSI, ubidi.PDI:
+		return true
+	}
+	return false
+}
+
+// ParagraphLevel returns the level of the first strong character of text,
+// skipping isolates, and whether there is one. Callers use their default
+// direction when there is none.
+// UAX #9 §3.3.1 P2, P3
+func ParagraphLevel(text []rune) (Level, bool) {
+	classes := make([]ubidi.Class, len(text))
+	for i, r := range text {
+		classes[i] = class(r)
+	}
+	return firstStrong(classes, 0, len(classes))
+}
+
+// StrongLevel returns the level of the first strong character of text and
+// whether there is one. Unlike ParagraphLevel, it neither skips isolates
+// nor stops at paragraph separators, as HTML's dir=auto does not.
+// HTML §3.2.6.4 The dir attribute
+func StrongLevel(text string) (Level, bool) {
+	for _, r := range text {
+		switch class(r) {
+		case ubidi.L:
+			return 0, true
+		case ubidi.R, ubidi.AL:
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// firstStrong finds the first strong class in classes[start:end], skipping
+// isolates and stopping at a paragraph separator or at a PDI closing an
+// isolate that contains start.
+func firstStrong(classes []ubidi.Class, start, end int) (Level, bool) {
+	depth := 0
+	for i := start; i < end; i++ {
+		switch c := classes[i]; {
+		case isIsolateInitiator(c):
+			depth++
+		case c == ubidi.PDI:
+			if depth == 0 {
+				return 0, false
+			}
+			depth--
+		case c == ubidi.B:
+			return 0, false
+		case depth > 0:
+		case c == ubidi.L:
+			return 0, true
+		case c == ubidi.R || c == ubidi.AL:
+			return 1, true
+		}
+	}
+	return 0, false
+}
+
+// paragraph holds the state of resolving one paragraph.
+type paragraph struct {
+	text     []rune
+	initial  []ubidi.Class // classes of the characters
+	classes  []ubidi.Class // classes as resolved so far
+	levels   []Level
+	matching []int // index of the PDI matching each isolate initiator, or -1
+	level    Level
+}
+
+// Levels resolves the embedding level of each character of a paragraph
+// with the given paragraph level. Characters removed by rule X9 take the
+// level of the character before them, so that every index has a level.
+func Levels(text []rune, level Level) []Level {
+	p := &paragraph{
+		text:     text,
+		initial:  make([]ubidi.Class, len(text)),
+		classes:  make([]ubidi.Class, len(text)),
+		levels:   make([]Level, len(text)),
+		matching: make([]int, len(text)),
+		level:    level,
+	}
+	for i, r := range text {
+		p.initial[i] = class(r)
+	}
+	copy(p.classes, p.initial)
+	p.matchIsolates()
+	p.explicitLevels()
+	for _, sequence := range p.isolatingRunSequences() {
+		sequence.resolveWeakTypes()
+		sequence.resolveBracketPairs()
+		sequence.resolveNeutralTypes()
+		sequence.resolveImplicitLevels()
+	}
+	p.resetWhitespaceLevels()
+	return p.levels
+}
+
+// matchIsolates finds the PDI matching each isolate initiator.
+// UAX #9 §3.1.3 BD9
+func (p *paragraph) matchIsolates() {
+	var open []int
+	for i, c := range p.initial {
+		p.matching[i] = -1
+		switch {
+		case isIsolateInitiator(c):
+			open = append(open, i)
+		case c == ubidi.PDI && len(open) > 0:
+			p.matching[open[len(open)-1]] = i
+			open = open[:len(open)-1]
+		case c == ubidi.B:
+			open = open[:0]
+		}
+	}
+}
+
+// status is an entry of the directional status stack.
+type status struct {
+	level    Level
+	override ubidi.Class // L, R, or ON for no override
+	isolate  bool
+}
+
+// explicitLevels applies the explicit embeddings, overrides and isolates.
+// UAX #9 §3.3.2 X1-X8
+func (p *paragraph) explicitLevels() {
+	stack := []status{{level: p.level, override: ubidi.ON}}
+	overflowIsolates, overflowEmbeddings, validIsolates := 0, 0, 0
+
+	// next returns the least odd or even level greater than the current one
+	next := func(rtl bool) Level {
+		level := stack[len(stack)-1].level + 1
+		if level.RTL() != rtl {
+			level++
+		}
+		return level
+	}
+	// apply sets the level of character i and applies any override (X6)
+	apply := func(i int) {
+		top := stack[len(stack)-1]
+		p.levels[i] = top.level
+		if top.override != ubidi.ON {
+			p.classes[i] = top.override
+		}
+	}
+
+	for i, c := range p.initial {
+		switch c {
+		case ubidi.RLE, ubidi.LRE, ubidi.RLO, ubidi.LRO:
+			// X2-X5
+			p.levels[i] = stack[len(stack)-1].level
+			level := next(c == ubidi.RLE || c == ubidi.RLO)
+			if level <= MaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				override := ubidi.ON
+				if c == ubidi.LRO {
+					override = ubidi.L
+				} else if c == ubidi.RLO {
+					override = ubidi.R
+				}
+				stack = append(stack, status{level: level, override: override})
+			} else if overflowIsolates == 0 {
+				overflowEmbeddings++
+			}
+
+		case ubidi.RLI, ubidi.LRI, ubidi.FSI:
+			// X5a-X5c
+			apply(i)
+			rtl := c == ubidi.RLI
+			if c == ubidi.FSI {
+				end := p.matching[i]
+				if end < 0 {
+					end = len(p.initial)
+				}
+				level, _ := firstStrong(p.initial, i+1, end)
+				rtl = level.RTL()
+			}
+			level := next(rtl)
+			if level <= MaxDepth && overflowIsolates == 0 && overflowEmbeddings == 0 {
+				validIsolates++
+				stack = append(stack, status{level: level, override: ubidi.ON, isolate: true})
+			} else {
+				overflowIsolates++
+			}
+
+		case ubidi.PDI:
+			// X6a
+			if overflowIsolates > 0 {
+				overflowIsolates--
+			} else if validIsolates > 0 {
+				overflowEmbeddings = 0
+				for !stack[len(stack)-1].isolate {
+					stack = stack[:len(stack)-1]
+				}
+				stack = stack[:len(stack)-1]
+				validIsolates--
+			}
+			apply(i)
+
+		case ubidi.PDF:
+			// X7
+			p.levels[i] = stack[len(stack)-1].level
+			if overflowIsolates > 0 {
+			} else if overflowEmbeddings > 0 {
+				overflowEmbeddings--
+			} else if !stack[len(stack)-1].isolate && len(stack) >= 2 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case ubidi.B:
+			// X8: a paragraph separator ends all embeddings
+			p.levels[i] = p.level
+
+		case ubidi.BN:
+			p.levels[i] = stack[len(stack)-1].level
+
+		default:
+			apply(i)
+		}
+	}
+}
+
+// sequence is an isolating run sequence: level runs joined across
+// isolates, resolved as a unit.
+// UAX #9 §3.1.3 BD13
+type sequence struct {
+	p        *paragraph
+	indices  []int // the characters of the sequence, in order
+	types    []ubidi.Class
+	level    Level
+	sos, eos ubidi.Class
+}
+
+// isolatingRunSequences splits the paragraph into level runs, ignoring
+// characters removed by rule X9, and joins the runs across isolates.
+// UAX #9 §3.3.3 X9, X10
+func (p *paragraph) isolatingRunSequences() []*sequence {
+	var runs [][]int
+	var run []int
+	for i, c := range p.initial {
+		if isRemoved(c) {
+			continue
+		}
+		if len(run) > 0 && p.levels[i] != p.levels[run[len(run)-1]] {
+			runs = append(runs, run)
+			run = nil
+		}
+		run = append(run, i)
+	}
+	if len(run) > 0 {
+		runs = append(runs, run)
+	}
+
+	// Index the runs by their first character to chain them
+	runStarting := make(map[int]int, len(runs))
+	for r, run := range runs {
+		runStarting[run[0]] = r
+	}
+	matched := make(map[int]bool)
+	for _, pdi := range p.matching {
+		if pdi >= 0 {
+			matched[pdi] = true
+		}
+	}
+
+	var sequences []*sequence
+	for _, run := range runs {
+		first := run[0]
+		if matched[first] {
+			continue // continues the sequence of its isolate initiator
+		}
+		indices := append([]int(nil), run...)
+		for {
+			last := indices[len(indices)-1]
+			if !isIsolateInitiator(p.initial[last]) || p.matching[last] < 0 {
+				break
+			}
+			r, ok := runStarting[p.matching[last]]
+			if !ok {
+				break
+			}
+			indices = append(indices, runs[r]...)
+		}
+		sequences = append(sequences, p.newSequence(indices))
+	}
+	return sequences
+}
+
+// newSequence creates the sequence of the given characters and finds its
+// start and end of sequence types.
+// UAX #9 §3.3.3 X10
+func (p *paragraph) newSequence(indices []int) *sequence {
+	s := &sequence{p: p, indices: indices, level: p.levels[indices[0]]}
+	s.types = make([]ubidi.Class, len(indices))
+	for i, index := range indices {
+		s.types[i] = p.classes[index]
+	}
+
+	before := p.level
+	for i := indices[0] - 1; i >= 0; i-- {
+		if !isRemoved(p.initial[i]) {
+			before = p.levels[i]
+			break
+		}
+	}
+	after := p.level
+	last := indices[len(indices)-1]
+	if !isIsolateInitiator(p.initial[last]) {
+		for i := last + 1; i < len(p.initial); i++ {
+			if !isRemoved(p.initial[i]) {
+				after = p.levels[i]
+				break
+			}
+		}
+	}
+	s.sos = directionOf(max(before, s.level))
+	s.eos = directionOf(max(after, s.level))
+	return s
+}
+
+// directionOf returns the strong type of a level.
+func directionOf(level Level) ubidi.Class {
+	if level.RTL() {
+		return ubidi.R
+	}
+	return ubidi.L
+}
+
+// resolveWeakTypes resolves numbers, separators and nonspacing marks.
+// UAX #9 §3.3.4 W1-W7
+func (s *sequence) resolveWeakTypes() {
+	types := s.types
+
+	// W1: nonspacing marks take the type of the previous character
+	for i, t := range types {
+		if t != ubidi.NSM {
+			continue
+		}
+		switch {
+		case i == 0:
+			types[i] = s.sos
+		case isIsolateInitiator(types[i-1]) || types[i-1] == ubidi.PDI:
+			types[i] = ubidi.ON
+		default:
+			types[i] = types[i-1]
+		}
+	}
+
+	// W2: European numbers after Arabic letters are Arabic numbers
+	// W3: Arabic letters are right-to-left
+	strong := s.sos
+	for i, t := range types {
+		switch t {
+		case ubidi.L, ubidi.R, ubidi.AL:
+			strong = t
+		case ubidi.EN:
+			if strong == ubidi.AL {
+				types[i] = ubidi.AN
+			}
+		}
+	}
+	for i, t := range types {
+		if t == ubidi.AL {
+			types[i] = ubidi.R
+		}
+	}
+
+	// W4: a single separator between two numbers of the same type joins them
+	for i := 1; i < len(types)-1; i++ {
+		before, after := types[i-1], types[i+1]
+		switch types[i] {
+		case ubidi.ES:
+			if before == ubidi.EN && after == ubidi.EN {
+				types[i] = ubidi.EN
+			}
+		case ubidi.CS:
+			if before == after && (before == ubidi.EN || before == ubidi.AN) {
+				types[i] = before
+			}
+		}
+	}
+
+	// W5: terminators next to European numbers are European numbers
+	for i := 0; i < len(types); {
+		if types[i] != ubidi.ET {
+			i++
+			continue
+		}
+		end := i
+		for end < len(types) && types[end] == ubidi.ET {
+			end++
+		}
+		if (i > 0 && types[i-1] == ubidi.EN) || (end < len(types) && types[end] == ubidi.EN) {
+			for j := i; j < end; j++ {
+				types[j] = ubidi.EN
+			}
+		}
+		i = end
+	}
+
+	// W6: remaining separators and terminators are neutral
+	for i, t := range types {
+		if t == ubidi.ES || t == ubidi.ET || t == ubidi.CS {
+			types[i] = ubidi.ON
+		}
+	}
+
+	// W7: European numbers in left-to-right context are left-to-right
+	strong = s.sos
+	for i, t := range types {
+		switch t {
+		case ubidi.L, ubidi.R:
+			strong = t
+		case ubidi.EN:
+			if strong == ubidi.L {
+				types[i] = ubidi.L
+			}
+		}
+	}
+}
+
+// strongType returns the direction a resolved type counts as for rules N0
+// to N2, where numbers count as right-to-left, or ON for neutrals.
+func strongType(t ubidi.Class) ubidi.Class {
+	switch t {
+	case ubidi.L:
+		return ubidi.L
+	case ubidi.R, ubidi.AN, ubidi.EN:
+		return ubidi.R
+	}
+	return ubidi.ON
+}
+
+// bracketPair is a pair of matching brackets, by position in the sequence.
+type bracketPair struct {
+	open, close int
+}
+
+// resolveBracketPairs gives paired brackets the direction of their
+// content or context.
+// UAX #9 §3.3.5 N0
+func (s *sequence) resolveBracketPairs() {
+	pairs := s.bracketPairs()
+	direction := directionOf(s.level)
+	for _, pair := range pairs {
+		inside := ubidi.ON
+		for i := pair.open + 1; i < pair.close; i++ {
+			t := strongType(s.types[i])
+			if t == ubidi.ON {
+				continue
+			}
+			inside = t
+			if t == direction {
+				break
+			}
+		}
+
+		switch {
+		case inside == ubidi.ON:
+			// N0 d: no strong type inside, leave the brackets neutral
+			continue
+		case inside == direction:
+			// N0 b
+		default:
+			// N0 c: use the context before the opening bracket
+			context := s.sos
+			for i := pair.open - 1; i >= 0; i-- {
+				if t := strongType(s.types[i]); t != ubidi.ON {
+					context = t
+					break
+				}
+			}
+			if context != direction {
+				s.setBracket(pair, inside)
+				continue
+			}
+		}
+		s.setBracket(pair, direction)
+	}
+}
+
+// setBracket sets the type of both brackets of a pair, and of nonspacing
+// marks following them.
+func (s *sequence) setBracket(pair bracketPair, t ubidi.Class) {
+	for _, i := range []int{pair.open, pair.close} {
+		s.types[i] = t
+		for j := i + 1; j < len(s.types) && s.p.initial[s.indices[j]] == ubidi.NSM; j++ {
+			s.types[j] = t
+		}
+	}
+}
+
+// bracketPairs finds the paired brackets of the sequence, ordered by
+// opening bracket.
+// UAX #9 §3.1.3 BD16
+func (s *sequence) bracketPairs() []bracketPair {
+	type opener struct {
+		close rune // the closing bracket that matches
+		index int
+	}
+	var stack []opener
+	var pairs []bracketPair
+	for i, index := range s.indices {
+		if s.types[i] != ubidi.ON {
+			continue
+		}
+		r := s.p.text[index]
+		props, _ := ubidi.LookupRune(r)
+		if !props.IsBracket() {
+			continue
+		}
+		if props.IsOpeningBracket() {
+			if len(stack) == maxBracketPairs {
+				break
+			}
+			stack = append(stack, opener{close: canonicalBracket(closingBracket(r)), index: i})
+			continue
+		}
+		r = canonicalBracket(r)
+		for j := len(stack) - 1; j >= 0; j-- {
+			if stack[j].close == r {
+				pairs = append(pairs, bracketPair{open: stack[j].index, close: i})
+				stack = stack[:j]
+				break
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].open < pairs[j].open })
+	return pairs
+}
+
+// closingBracket returns the bracket paired with an opening bracket. All
+// pairs but two close with the next closing bracket in code point order.
+// Unicode BidiBrackets.txt
+func closingBracket(r rune) rune {
+	switch r {
+	case '⦍':
+		return '⦐'
+	case '⦏':
+		return '⦎'
+	}
+	for c := r + 1; c <= r+2; c++ {
+		if props, _ := ubidi.LookupRune(c); props.IsBracket() && !props.IsOpeningBracket() {
+			return c
+		}
+	}
+	return r
+}
+
+// canonicalBracket maps the angle brackets with canonical decompositions
+// to their decompositions, so that either form matches the other.
+// UAX #9 §3.1.3 BD16
+func canonicalBracket(r rune) rune {
+	switch r {
+	case '〈':
+		return '〈'
+	case '〉':
+		return '〉'
+	}
+	return r
+}
+
+// resolveNeutralTypes gives neutrals the direction of the text around
+// them, or the embedding direction.
+// UAX #9 §3.3.5 N1, N2
+func (s *sequence) resolveNeutralTypes() {
+	types := s.types
+	for i := 0; i < len(types); {
+		if !isNeutralOrIsolate(types[i]) {
+			i++
+			continue
+		}
+		end := i
+		for end < len(types) && isNeutralOrIsolate(types[end]) {
+			end++
+		}
+		before, after := s.sos, s.eos
+		if i > 0 {
+			before = strongType(types[i-1])
+		}
+		if end < len(types) {
+			after = strongType(types[end])
+		}
+		resolved := directionOf(s.level)
+		if before == after {
+			resolved = before
+		}
+		for j := i; j < end; j++ {
+			types[j] = resolved
+		}
+		i = end
+	}
+}
+
+// resolveImplicitLevels raises levels by the resolved types.
+// UAX #9 §3.3.6 I1, I2
+func (s *sequence) resolveImplicitLevels() {
+	for i, index := range s.indices {
+		level := s.p.levels[index]
+		switch t := s.types[i]; {
+		case !level.RTL() && t == ubidi.R:
+			level++
+		case !level.RTL() && (t == ubidi.AN || t == ubidi.EN):
+			level += 2
+		case level.RTL() && (t == ubidi.L || t == ubidi.AN || t == ubidi.EN):
+			level++
+		}
+		s.p.levels[index] = level
+	}
+}
+
+// resetWhitespaceLevels resets separators and trailing whitespace to the
+// paragraph level, then gives removed characters the level of the
+// character before them.
+// UAX #9 §3.4 L1
+func (p *paragraph) resetWhitespaceLevels() {
+	trailing := true
+	for i := len(p.initial) - 1; i >= 0; i-- {
+		switch c := p.initial[i]; {
+		case c == ubidi.S || c == ubidi.B:
+			p.levels[i] = p.level
+			trailing = true
+		case c == ubidi.WS || isIsolateInitiator(c) || c == ubidi.PDI || isRemoved(c):
+			if trailing {
+				p.levels[i] = p.level
+			}
+		default:
+			trailing = false
+		}
+	}
+	for i, c := range p.initial {
+		if isRemoved(c) {
+			if i == 0 {
+				p.levels[i] = p.level
+			} else {
+				p.levels[i] = p.levels[i-1]
+			}
+		}
+	}
+}
+
+// Reorder returns the visual order of characters with the given levels:
+// the index of the character displayed at each position, left to right.
+// UAX #9 §3.4 L2
+func Reorder(levels []Level) []int {
+	order := make([]int, len(levels))
+	for i := range order {
+		order[i] = i
+	}
+	if len(levels) == 0 {
+		return order
+	}
+
+	highest, lowest := levels[0], levels[0]
+	for _, level := range levels {
+		highest = max(highest, level)
+		lowest = min(lowest, level)
+	}
+	lowestOdd := lowest | 1
+
+	// From the highest level to the lowest odd level, reverse every
+	// sequence at that level or higher
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(levels); {
+			if levels[order[i]] < level {
+				i++
+				continue
+			}
+			end := i
+			for end < len(levels) && levels[order[end]] >= level {
+				end++
+			}
+			reverse(order[i:end])
+			i = end
+		}
+	}
+	return order
+}
+
+func reverse(s []int) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
@@ -0,0 +1,215 @@
+package bidi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// hebrew maps the uppercase letters of a test string to Hebrew letters, so
+// that, as in the examples of UAX #9, uppercase text is right-to-left.
+func hebrew(s string) []rune {
+	text := []rune(s)
+	for i, r := range text {
+		if r >= 'A' && r <= 'Z' {
+			text[i] = 'א' + (r - 'A')
+		}
+	}
+	return text
+}
+
+// visual returns the characters of a test string in visual order, with the
+// Hebrew letters mapped back to uppercase and formatting characters dropped.
+func visual(text []rune, order []int) string {
+	var b strings.Builder
+	for _, i := range order {
+		r := text[i]
+		switch {
+		case r >= 'א' && r <= 'א'+25:
+			b.WriteRune('A' + (r - 'א'))
+		case strings.ContainsRune("\u202A\u202B\u202C\u202D\u202E\u2066\u2067\u2068\u2069", r):
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func TestParagraphLevel(t *testing.T) {
+	tests := []struct {
+		text   string
+		level  Level
+		strong bool
+	}{
+		{"", 0, false},
+		{"123 ...", 0, false},
+		{"abc DEF", 0, true},
+		{"  DEF abc", 1, true},
+		{"12 بت", 1, true},
+		{"\u2066abc\u2069 DEF", 1, true}, // isolates are skipped
+		{"\u2067ABC\u2069", 0, false},
+		{"\u202Babc", 0, true},   // embeddings are not
+		{"1\u2029ABC", 0, false}, // the paragraph ends at a separator
+	}
+	for _, tt := range tests {
+		level, strong := ParagraphLevel(hebrew(tt.text))
+		if level != tt.level || strong != tt.strong {
+			t.Errorf("ParagraphLevel(%q): expected %d, %v, got %d, %v", tt.text, tt.level, tt.strong, level, strong)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		level    Level
+		expected []Level
+	}{
+		{"left-to-right", "ab c", 0, []Level{0, 0, 0, 0}},
+		{"right-to-left in left-to-right", "ab CD", 0, []Level{0, 0, 0, 1, 1}},
+		{"left-to-right in right-to-left", "AB cd", 1, []Level{1, 1, 1, 2, 2}},
+		{"numbers after right-to-left text", "A 12", 0, []Level{1, 1, 2, 2}},
+		{"numbers in left-to-right text", "a 12", 1, []Level{2, 2, 2, 2}},
+		{"Arabic numbers after Arabic letters", "ب 12", 0, []Level{1, 1, 2, 2}},
+		{"separators join numbers", "A 1,5-2", 0, []Level{1, 1, 2, 2, 2, 2, 2}},
+		{"terminators join numbers", "A $12%", 0, []Level{1, 1, 2, 2, 2, 2}},
+		{"trailing whitespace", "AB  ", 0, []Level{1, 1, 0, 0}},
+		{"segment separator", "AB\tCD", 0, []Level{1, 1, 0, 1, 1}},
+		{"nonspacing mark", "Áb", 0, []Level{1, 1, 0}},
+		{"override", "a\u202Ebc\u202C", 0, []Level{0, 0, 1, 1, 1}},
+		{"embedding", "A\u202Abc\u202C", 1, []Level{1, 1, 2, 2, 2}},
+		{"isolate", "a \u2067B c\u2069 d", 0, []Level{0, 0, 0, 1, 1, 2, 0, 0, 0}},
+		{"first strong isolate", "A\u2068bc\u2069", 1, []Level{1, 1, 2, 2, 1}},
+		// UAX #9 §3.3.5 N0, examples 1 and 3
+		{"bracket pairs", "AB(CD[&ef]!)gh", 1, []Level{1, 1, 1, 1, 1, 1, 1, 2, 2, 1, 1, 1, 2, 2}},
+		{"brackets in context", "AB book(s)", 1, []Level{1, 1, 1, 2, 2, 2, 2, 2, 2, 2}},
+		{"unmatched brackets", "a(B", 0, []Level{0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Levels(hebrew(tt.text), tt.level); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Levels(%q, %d): expected %v, got %v", tt.text, tt.level, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestReorder tests the display order of examples from UAX #9. Brackets
+// are not mirrored here; the shaper mirrors their glyphs (L4).
+// UAX #9 §3.4 Reordering Resolved Levels, §3.3.5 N0
+func TestReorder(t *testing.T) {
+	tests := []struct {
+		text     string
+		level    Level
+		expected string
+	}{
+		{"car means CAR.", 0, "car means RAC."},
+		{"car MEANS CAR.", 1, ".RAC SNAEM car"},
+		{"he said “CAR MEANS CAR.”", 0, "he said “RAC SNAEM RAC.”"},
+		{"DID YOU SAY ’he said “car MEANS CAR”’?", 1, "?’”RAC SNAEM he said “car’ YAS UOY DID"},
+		{"AB(CD[&ef]!)gh", 1, "gh)!]ef&[DC(BA"},
+		{"smith (fabrikam ARABIC) HEBREW", 1, "WERBEH )CIBARA fabrikam( smith"},
+		{"ARABIC book(s)", 1, "book(s) CIBARA"},
+		{"a \u2066B C\u2069 d", 0, "a C B d"},
+		{"a\u202Ebc d\u202C", 0, "ad cb"},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		text := hebrew(tt.text)
+		if got := visual(text, Reorder(Levels(text, tt.level))); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.text, tt.expected, got)
+		}
+	}
+}
+
+// TestLevelsDepth tests that embeddings deeper than MaxDepth are ignored.
+// UAX #9 §3.3.2 X5, X5a
+func TestLevelsDepth(t *testing.T) {
+	text := []rune(strings.Repeat("\u202B\u2066", 100) + "a")
+	levels := Levels(text, 0)
+	if last := levels[len(levels)-1]; last != MaxDepth+1 {
+		t.Errorf("Expected the deepest text at level %d, got %d", MaxDepth+1, last)
+	}
+}
+
+// TestCharacterLevels tests resolved levels in the form of the lines of
+// BidiCharacterTest.txt: the text, the paragraph direction (0 for
+// left-to-right, 1 for right-to-left, 2 for auto) and the level of each
+// character, with x for characters removed by rule X9.
+// UAX #9 §3.3 Resolving Embedding Levels, §3.4 Reordering Resolved Levels
+func TestCharacterLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		direction int
+		levels    string
+	}{
+		// W1: nonspacing marks take the type of the character before them,
+		// or of sos at the start of a sequence
+		{"W1 mark after R", "א\u0300", 0, "1 1"},
+		{"W1 mark at sos", "\u0300a", 1, "1 2"},
+		// W2: European numbers after Arabic letters are Arabic numbers,
+		// which W5 terminators do not join
+		{"W2", "ب1%", 0, "1 2 0"},
+		// W3: Arabic letters are R
+		{"W3", "aب", 0, "0 1"},
+		// W4: a single separator between numbers of the same type
+		{"W4 ES between EN", "1+2", 1, "2 2 2"},
+		{"W4 CS between AN", "٣,٤", 0, "2 2 2"},
+		{"W4 ES between AN", "٣+٤", 0, "2 1 2"},
+		// W5: terminators next to European numbers
+		{"W5", "$1", 1, "2 2"},
+		// W6: other separators and terminators are neutral
+		{"W6", "1+", 1, "2 1"},
+		{"W6 after AN", "ر٣+!", 0, "1 2 0 0"},
+		// W7: European numbers after L or sos L are L
+		{"W7 sos", "12", 0, "0 0"},
+		{"W7 after R", "א 1", 0, "1 1 2"},
+		// N0: bracket pairs take the embedding direction, or the context
+		// before them when they only enclose the opposite direction
+		{"N0 unmatched", "(א2", 0, "0 1 2"},
+		{"N0 context", "א(a)b", 1, "1 1 2 1 2"},
+		{"N0 embedding direction", "אב(גד[&ef]!)gh", 1, "1 1 1 1 1 1 1 2 2 1 1 1 2 2"},
+		// X5a-X5c, X6a: isolates
+		{"RLI", "a\u2067b\u2069c", 0, "0 0 2 0 0"},
+		{"LRI", "א\u2066b\u2069", 1, "1 1 2 1"},
+		{"FSI", "\u2068א a\u2069", 0, "0 1 1 2 0"},
+		{"unmatched PDI", "\u2069א", 0, "0 1"},
+		// X5, X7: embeddings past MaxDepth overflow, and the PDFs
+		// matching them are ignored
+		{"overflow", strings.Repeat("\u202A", 63) + "a\u202Cb\u202Cc", 0,
+			strings.Repeat("x ", 63) + "124 x 124 x 122"},
+		{"deepest level", strings.Repeat("\u202A", 62) + "\u202Ba", 0,
+			strings.Repeat("x ", 63) + "126"},
+		// L1: whitespace before separators and at the end of the line
+		{"L1 end of line", "a  ", 1, "2 1 1"},
+		{"L1 segment separator", "a \tb", 1, "2 1 1 2"},
+		{"L1 paragraph separator", "a \u2029", 1, "2 1 1"},
+		{"L1 in embedding", "\u202Bab \u202C", 0, "x 2 2 0 x"},
+		// P2, P3: auto direction from the first strong character
+		{"auto", "א a", 2, "1 1 2"},
+		{"auto after numbers", "1 a", 2, "0 0 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := []rune(tt.text)
+			level := Level(tt.direction)
+			if tt.direction == 2 {
+				level, _ = ParagraphLevel(text)
+			}
+			got := Levels(text, level)
+			expected := strings.Fields(tt.levels)
+			if len(got) != len(expected) {
+				t.Fatalf("Expected %d levels, got %v", len(expected), got)
+			}
+			for i, want := range expected {
+				if want != "x" && want != strconv.Itoa(int(got[i])) {
+					t.Errorf("Expected levels %s, got %v", tt.levels, got)
+					break
+				}
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/font"
 	"github.com/lukehoban/browser/html"
 	"github.com/lukehoban/browser/layout"
 	"github.com/lukehoban/browser/log"
@@ -37,6 +38,14 @@ func (w *pageLogWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+// styleOptions returns style options for a screen viewport of the given size.
+func styleOptions(width, height int) style.Options {
+	opts := style.DefaultOptions()
+	opts.Media.Width = float64(width)
+	opts.Media.Height = float64(height)
+	return opts
+}
+
 // renderHTML is the main function exposed to JavaScript.
 // It takes HTML content, width, and height, and returns a base64-encoded PNG.
 func renderHTML(this js.Value, args []js.Value) interface{} {
@@ -71,8 +80,13 @@ func renderHTML(this js.Value, args []js.Value) interface{} {
 	// Parse CSS
 	stylesheet := css.Parse(cssContent)
 
+	// Load web fonts; only data: URLs are available here
+	options := styleOptions(width, height)
+	font.DefaultRegistry.Reset()
+	font.LoadFontFaces(stylesheet.FontFaces, options.Media)
+
 	// Compute styles
-	styledTree := style.StyleTree(doc, stylesheet)
+	styledTree := style.StyleTreeWithOptions(doc, stylesheet, options)
 
 	// Build layout tree
 	containingBlock := layout.Dimensions{
@@ -113,7 +127,7 @@ func getLayoutTree(this js.Value, args []js.Value) interface{} {
 
 	htmlContent := args[0].String()
 	width := args[1].Int()
-	_ = args[2].Int() // height - not used for layout tree building
+	height := args[2].Int()
 
 	// Parse HTML
 	doc := html.Parse(htmlContent)
@@ -124,8 +138,13 @@ func getLayoutTree(this js.Value, args []js.Value) interface{} {
 	// Parse CSS
 	stylesheet := css.Parse(cssContent)
 
+	// Load web fonts; only data: URLs are available here
+	options := styleOptions(width, height)
+	font.DefaultRegistry.Reset()
+	font.LoadFontFaces(stylesheet.FontFaces, options.Media)
+
 	// Compute styles
-	styledTree := style.StyleTree(doc, stylesheet)
+	styledTree := style.StyleTreeWithOptions(doc, stylesheet, options)
 
 	// Build layout tree
 	containingBlock := layout.Dimensions{
@@ -4,7 +4,8 @@
 // Network support:
 // - HTTP/HTTPS URL fetching follows standard Go net/http practices
 // - HTML5 §2.5 URLs: Relative URL resolution against base URL
-// - External stylesheet loading via <link rel="stylesheet">
+// - External stylesheet loading via <link rel="stylesheet"> and @import
+// - Web fonts loaded from @font-face rules
 package main
 
 import (
@@ -19,6 +20,7 @@ import (
 
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/font"
 	"github.com/lukehoban/browser/html"
 	"github.com/lukehoban/browser/layout"
 	"github.com/lukehoban/browser/log"
@@ -60,10 +62,17 @@ func main() {
 	outputFile := flag.String("output", "", "Output PNG file path (optional)")
 	width := flag.Int("width", 800, "Viewport width in pixels")
 	height := flag.Int("height", 600, "Viewport height in pixels")
+	mediaType := flag.String("media", "screen", "Media type for @media rules: screen or print")
+	colorScheme := flag.String("color-scheme", "light", "Preferred color scheme for @media (prefers-color-scheme): light or dark")
+	userCSS := flag.String("user-css", "", "User stylesheet file or URL, cascaded between the user-agent and author stylesheets")
+	userAgentCSS := flag.String("ua-css", "", "Stylesheet file or URL replacing the default user-agent stylesheet")
+	systemFonts := flag.Bool("system-fonts", false, "Match font-family names against fonts installed in the platform font directories")
+	fontDirs := flag.String("font-dirs", "", "Additional font directories to index, separated by the OS path list separator")
 	logLevel := flag.String("log-level", "warn", "Log level: debug, info, warn, error")
 	verbose := flag.Bool("verbose", false, "Enable verbose logging (equivalent to -log-level=info)")
 	showLayout := flag.Bool("show-layout", false, "Display layout tree instead of rendering")
 	showRender := flag.Bool("show-render", false, "Display render tree (styled nodes) instead of rendering")
+	explainStyle := flag.String("explain-style", "", "Explain the styles of the elements matching a CSS selector instead of rendering")
 	flag.Parse()
 
 	// Configure logging
@@ -132,24 +141,65 @@ func main() {
 	dom.ResolveURLs(doc, baseURL)
 	fmt.Fprintf(os.Stderr, "URLs resolved\n")
 
-	// Extract CSS from <style> tags and <link> tags
-	fmt.Fprintf(os.Stderr, "Extracting CSS...\n")
-	cssContent := extractCSS(doc)
-
-	// Fetch external stylesheets
+	// Load stylesheets from <style> and <link> elements, in document order,
+	// with @import rules resolved
 	// HTML5 §4.2.4: External stylesheets are fetched via <link rel="stylesheet">
-	fmt.Fprintf(os.Stderr, "Fetching external stylesheets...\n")
-	externalCSS := dom.FetchExternalStylesheets(doc)
-	cssContent = externalCSS + "\n" + cssContent
-	fmt.Fprintf(os.Stderr, "External stylesheets fetched\n")
+	fmt.Fprintf(os.Stderr, "Loading stylesheets...\n")
+	stylesheet := style.LoadStylesheets(doc, baseURL)
+	fmt.Fprintf(os.Stderr, "Stylesheets loaded\n")
+
+	// Compute styles, evaluating @media rules against the viewport
+	// Media Queries Level 4 §2 Media Queries
+	styleOptions := style.DefaultOptions()
+	styleOptions.Media.Type = strings.ToLower(*mediaType)
+	styleOptions.Media.Width = float64(*width)
+	styleOptions.Media.Height = float64(*height)
+	styleOptions.Media.ColorScheme = strings.ToLower(*colorScheme)
+
+	// Load the user and user-agent stylesheets, which cascade before the
+	// document's
+	// CSS Cascading Level 4 §6.3 Cascade Origins
+	if *userCSS != "" {
+		styleOptions.UserStylesheet = loadStylesheetFlag("user", *userCSS)
+		font.LoadFontFaces(styleOptions.UserStylesheet.FontFaces, styleOptions.Media)
+	}
+	if *userAgentCSS != "" {
+		styleOptions.UserAgentStylesheet = loadStylesheetFlag("user-agent", *userAgentCSS)
+		font.LoadFontFaces(styleOptions.UserAgentStylesheet.FontFaces, styleOptions.Media)
+	}
 
-	// Parse CSS
-	fmt.Fprintf(os.Stderr, "Parsing CSS...\n")
-	stylesheet := css.Parse(cssContent)
-	fmt.Fprintf(os.Stderr, "CSS parsed\n")
+	// Load web fonts declared by @font-face rules
+	// CSS Fonts Level 4 §4.1 The @font-face rule
+	font.LoadFontFaces(stylesheet.FontFaces, styleOptions.Media)
+
+	// Index installed fonts so that font-family names can match them
+	// CSS Fonts Level 4 §5 Font Matching Algorithm
+	dirs := filepath.SplitList(*fontDirs)
+	if *systemFonts {
+		dirs = append(font.DefaultFontDirs(), dirs...)
+	}
+	if len(dirs) > 0 {
+		count := font.DefaultRegistry.AddSystemFonts(dirs...)
+		fmt.Fprintf(os.Stderr, "Indexed %d installed fonts\n", count)
+	}
+
+	// Explain where the styles of the selected elements come from if
+	// requested, like the Styles pane of browser developer tools. The
+	// document is styled once for all of them
+	if *explainStyle != "" {
+		elements := style.QuerySelectorAll(doc, *explainStyle)
+		fmt.Printf("=== Styles of %s (%d elements) ===\n", *explainStyle, len(elements))
+		for _, e := range style.ExplainStyles(doc, stylesheet, styleOptions, elements) {
+			printStyleExplanation(e, input)
+		}
+		return
+	}
 
-	// Compute styles
-	styledTree := style.StyleTree(doc, stylesheet)
+	var styleStats style.Stats
+	styleOptions.Stats = &styleStats
+	styledTree := style.StyleTreeWithOptions(doc, stylesheet, styleOptions)
+	fmt.Fprintf(os.Stderr, "Styled %d elements, %d sharing styles (%.0f%% hit rate)\n",
+		styleStats.Elements, styleStats.SharedElements, 100*styleStats.HitRate())
 
 	// Resolve CSS URLs (like background-image) against base URL
 	// HTML5 §2.5.1: URLs should be resolved against the document's base URL
@@ -200,26 +250,92 @@ func main() {
 	}
 }
 
-// extractCSS extracts CSS from <style> tags in the document.
-func extractCSS(doc *dom.Node) string {
-	var cssBuilder strings.Builder
-	extractCSSFromNode(doc, &cssBuilder)
-	return cssBuilder.String()
+// loadStylesheetFlag loads the stylesheet at path given for the named
+// origin, exiting if it cannot be loaded.
+func loadStylesheetFlag(origin, path string) *css.Stylesheet {
+	sheet, err := style.LoadStylesheet(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading %s stylesheet: %v\n", origin, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Loaded %s stylesheet %s (%d rules)\n", origin, path, len(sheet.Rules))
+	return sheet
 }
 
-// extractCSSFromNode recursively extracts CSS from style elements.
-func extractCSSFromNode(node *dom.Node, builder *strings.Builder) {
-	if node.Type == dom.ElementNode && node.Data == "style" {
-		for _, child := range node.Children {
-			if child.Type == dom.TextNode {
-				builder.WriteString(child.Data)
-				builder.WriteString("\n")
+// printStyleExplanation prints the rules matching an element, marking the
+// declarations other declarations override, and the computed values of
+// the properties not at their initial value with where they come from.
+// input names the document for rules from <style> elements.
+func printStyleExplanation(e *style.Explanation, input string) {
+	if e == nil {
+		return
+	}
+	fmt.Printf("\n%s\n", describeElement(e.Node))
+
+	printDeclarations := func(decls []*css.Declaration) {
+		for _, decl := range decls {
+			value := strings.TrimSpace(decl.Value)
+			if decl.Important {
+				value += " !important"
 			}
+			overridden := ""
+			if !e.Applied(decl) {
+				overridden = "  (overridden)"
+			}
+			fmt.Printf("    %s: %s;%s\n", decl.Property, value, overridden)
 		}
 	}
 
-	for _, child := range node.Children {
-		extractCSSFromNode(child, builder)
+	fmt.Println("  Matched rules, by origin and specificity:")
+	for _, rule := range e.Rules {
+		s := rule.Specificity
+		fmt.Printf("  %s  [%s, specificity %d,%d,%d,%d]  %s\n", rule.Selector.Text, rule.Origin,
+			s.A, s.B, s.C, s.D, formatLocation(rule.Rule.Location, input))
+		printDeclarations(rule.Rule.Declarations)
+	}
+	if len(e.InlineStyle) > 0 {
+		fmt.Println("  style attribute")
+		printDeclarations(e.InlineStyle)
+	}
+
+	fmt.Println("  Computed values:")
+	for _, property := range e.Properties {
+		switch property.Source {
+		case style.SourceInitial:
+			continue
+		case style.SourceRule:
+			fmt.Printf("    %s: %s  (%s %s)\n", property.Name, property.Value,
+				property.Rule.Selector.Text, formatLocation(property.Rule.Rule.Location, input))
+		default:
+			fmt.Printf("    %s: %s  (%s)\n", property.Name, property.Value, property.Source)
+		}
+	}
+}
+
+// describeElement returns the start tag of an element with its ID and
+// classes.
+func describeElement(node *dom.Node) string {
+	var b strings.Builder
+	b.WriteString("<" + node.Data)
+	for _, name := range []string{"id", "class"} {
+		if value := node.GetAttribute(name); value != "" {
+			fmt.Fprintf(&b, " %s=%q", name, value)
+		}
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// formatLocation returns where a rule was written: its stylesheet's URL
+// or, for a <style> element, the document, followed by the line.
+func formatLocation(loc css.Location, input string) string {
+	switch {
+	case loc.StyleElement > 0:
+		return fmt.Sprintf("%s <style> #%d:%d", input, loc.StyleElement, loc.Line)
+	case loc.URL == "":
+		return fmt.Sprintf("user agent stylesheet:%d", loc.Line)
+	default:
+		return fmt.Sprintf("%s:%d", loc.URL, loc.Line)
 	}
 }
 
@@ -365,6 +481,9 @@ func printRenderTree(node *style.StyledNode, indent int) {
 		}
 		fmt.Printf("}")
 	}
+	if node.Node != nil && node.Node.Type == dom.TextNode {
+		fmt.Printf(" [font: %s]", textFont(node.Node.Data, node.Style()))
+	}
 	fmt.Println()
 
 	// Recursively print children
@@ -373,6 +492,26 @@ func printRenderTree(node *style.StyledNode, indent int) {
 	}
 }
 
+// textFont describes the font faces that text with the given computed
+// style is drawn with, as chosen by the font matching algorithm. Faces
+// used for fallback runs follow the first face, joined by " + ".
+// CSS Fonts Level 4 §5 Font Matching Algorithm
+func textFont(text string, cs *style.ComputedStyle) string {
+	runs := font.SegmentText(text, cs.Font)
+	if len(runs) == 0 {
+		return "none"
+	}
+	faces := make([]string, 0, len(runs))
+	seen := make(map[*font.Face]bool)
+	for _, run := range runs {
+		if !seen[run.Face] {
+			seen[run.Face] = true
+			faces = append(faces, run.Face.String())
+		}
+	}
+	return strings.Join(faces, " + ")
+}
+
 // isURL checks if the input string is a URL (http:// or https://)
 func isURL(input string) bool {
 	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
@@ -2,6 +2,8 @@ package main
 
 import (
 	"testing"
+
+	"github.com/lukehoban/browser/css"
 )
 
 func TestIsURL(t *testing.T) {
@@ -25,3 +27,21 @@ func TestIsURL(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatLocation(t *testing.T) {
+	tests := []struct {
+		loc      css.Location
+		expected string
+	}{
+		{css.Location{URL: "https://example.com/site.css", Line: 12}, "https://example.com/site.css:12"},
+		{css.Location{URL: "test", Line: 3, StyleElement: 2}, "test/page.html <style> #2:3"},
+		{css.Location{Line: 40}, "user agent stylesheet:40"},
+	}
+
+	for _, tt := range tests {
+		result := formatLocation(tt.loc, "test/page.html")
+		if result != tt.expected {
+			t.Errorf("formatLocation(%+v) = %q, want %q", tt.loc, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package css
+
+// This file contains the math functions calc(), min(), max() and clamp(),
+// which compute lengths from expressions mixing units.
+//
+// Spec references:
+// - CSS Values and Units Level 4 §10 Mathematical Expressions: https://www.w3.org/TR/css-values-4/#math
+//
+// Implemented:
+// - calc(), min(), max() and clamp(), nested, with + - * / and parentheses
+// - Type checking of numbers, lengths and percentages (§10.9)
+// - Simplification of computed values that keep percentages (§10.10.1)
+//
+// Not implemented:
+// - Other math functions (round(), abs(), trigonometric functions, ...)
+// - The constants e, pi, infinity and NaN
+// - Math functions of other types, such as <angle> or <time>
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// mathType is the type of a math expression: a bit set of the kinds of
+// value it holds, where no bits is a <number>.
+// CSS Values and Units Level 4 §10.9 Type Checking
+type mathType uint8
+
+const (
+	mathLength  mathType = 1 << iota // <length>
+	mathPercent                      // <percentage>, resolved against a length
+
+	mathNumber mathType = 0 // <number>
+)
+
+// Calc is a parsed math function. Its leaves are lengths, percentages and
+// numbers; its operators are "+", "-", "*", "/", "min", "max" and "clamp".
+// CSS Values and Units Level 4 §10.1 Basic Arithmetic: calc()
+type Calc struct {
+	op    string   // Operator, or "" for a leaf
+	args  []*Calc  // Operands of an operator
+	value Length   // Value of a leaf
+	typ   mathType // Type of the expression
+}
+
+// parseCalc parses a math function such as "calc(100% - 2em)". It returns
+// false if the function is unknown, malformed or fails type checking.
+func parseCalc(value string) (*Calc, bool) {
+	p := &calcParser{tokens: tokenizeCalc(value)}
+	c, ok := p.parseValue()
+	if !ok || p.pos != len(p.tokens) {
+		return nil, false
+	}
+	return c, true
+}
+
+// isMathFunction reports whether value starts with a math function.
+func isMathFunction(value string) bool {
+	name, _, ok := strings.Cut(value, "(")
+	if !ok {
+		return false
+	}
+	switch name {
+	case "calc", "min", "max", "clamp":
+		return true
+	}
+	return false
+}
+
+// calcToken is a token of a math expression: a number with its unit, a
+// function name with its "(", or a single delimiter.
+type calcToken struct {
+	text   string
+	number bool // whether the token is a number, dimension or percentage
+	space  bool // whether whitespace precedes the token
+}
+
+// tokenizeCalc splits a lowercase math expression into tokens.
+// CSS Values and Units Level 4 §10.1: + and - must be surrounded by
+// whitespace, so "-" before a digit after whitespace, "(" or "," is a sign
+func tokenizeCalc(s string) []calcToken {
+	var tokens []calcToken
+	space := false
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+			continue
+		case isDigitOrPoint(c) || (c == '-' || c == '+') && i+1 < len(s) && isDigitOrPoint(s[i+1]) && !isOperand(tokens, space):
+			start := i
+			i = numberEnd(s, i+1)
+			for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] == '%') {
+				i++
+			}
+			tokens = append(tokens, calcToken{text: s[start:i], number: true, space: space})
+		case c >= 'a' && c <= 'z':
+			start := i
+			for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] == '-') {
+				i++
+			}
+			if i < len(s) && s[i] == '(' {
+				i++
+			}
+			tokens = append(tokens, calcToken{text: s[start:i], space: space})
+		default:
+			tokens = append(tokens, calcToken{text: s[i : i+1], space: space})
+			i++
+		}
+		space = false
+	}
+	return tokens
+}
+
+// numberEnd returns the index after the digits, decimal point and exponent
+// of the number in s continuing at i.
+func numberEnd(s string, i int) int {
+	for i < len(s) && isDigitOrPoint(s[i]) {
+		i++
+	}
+	// An "e" is an exponent if digits follow, and otherwise starts a unit
+	// such as "em"
+	if i+1 < len(s) && s[i] == 'e' {
+		j := i + 1
+		if s[j] == '-' || s[j] == '+' {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			return j
+		}
+	}
+	return i
+}
+
+// isOperand reports whether a "+" or "-" following tokens would be a binary
+// operator rather than a sign: it follows a value and whitespace.
+func isOperand(tokens []calcToken, space bool) bool {
+	if len(tokens) == 0 || !space {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.number || last.text == ")"
+}
+
+// calcParser is a recursive descent parser for math expressions.
+// CSS Values and Units Level 4 §10.1 Syntax:
+//
+//	<calc-sum>     = <calc-product> [ [ '+' | '-' ] <calc-product> ]*
+//	<calc-product> = <calc-value> [ [ '*' | '/' ] <calc-value> ]*
+//	<calc-value>   = <number> | <dimension> | <percentage> | ( <calc-sum> )
+type calcParser struct {
+	tokens []calcToken
+	pos    int
+}
+
+// peek returns the next token, or an empty token at the end.
+func (p *calcParser) peek() calcToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return calcToken{}
+}
+
+// parseSum parses a <calc-sum>. + and - must have whitespace on both sides.
+func (p *calcParser) parseSum() (*Calc, bool) {
+	left, ok := p.parseProduct()
+	for ok {
+		op := p.peek()
+		if op.text != "+" && op.text != "-" {
+			break
+		}
+		if !op.space || p.pos+1 >= len(p.tokens) || !p.tokens[p.pos+1].space {
+			return nil, false
+		}
+		p.pos++
+		var right *Calc
+		if right, ok = p.parseProduct(); !ok {
+			break
+		}
+		left, ok = combine(op.text, left, right)
+	}
+	return left, ok
+}
+
+// parseProduct parses a <calc-product>.
+func (p *calcParser) parseProduct() (*Calc, bool) {
+	left, ok := p.parseValue()
+	for ok {
+		op := p.peek().text
+		if op != "*" && op != "/" {
+			break
+		}
+		p.pos++
+		var right *Calc
+		if right, ok = p.parseValue(); !ok {
+			break
+		}
+		left, ok = combine(op, left, right)
+	}
+	return left, ok
+}
+
+// parseValue parses a <calc-value>, or a nested math function.
+func (p *calcParser) parseValue() (*Calc, bool) {
+	token := p.peek()
+	p.pos++
+	switch {
+	case token.number:
+		length, ok := parseDimension(token.text)
+		if !ok {
+			return nil, false
+		}
+		typ := mathNumber
+		switch {
+		case length.Unit == "%":
+			typ = mathPercent
+		case length.Unit != "":
+			typ = mathLength
+		}
+		return &Calc{value: length, typ: typ}, true
+	case token.text == "(" || token.text == "calc(":
+		c, ok := p.parseSum()
+		if !ok || p.peek().text != ")" {
+			return nil, false
+		}
+		p.pos++
+		return c, true
+	case token.text == "min(" || token.text == "max(" || token.text == "clamp(":
+		return p.parseComparison(strings.TrimSuffix(token.text, "("))
+	}
+	return nil, false
+}
+
+// parseComparison parses the comma-separated arguments of min(), max() or
+// clamp(), whose types must be consistent.
+// CSS Values and Units Level 4 §10.2 Comparison Functions
+func (p *calcParser) parseComparison(op string) (*Calc, bool) {
+	c := &Calc{op: op}
+	for {
+		arg, ok := p.parseSum()
+		if !ok {
+			return nil, false
+		}
+		if len(c.args) == 0 {
+			c.typ = arg.typ
+		} else if c.typ, ok = addTypes(c.typ, arg.typ); !ok {
+			return nil, false
+		}
+		c.args = append(c.args, arg)
+		token := p.peek()
+		p.pos++
+		if token.text == ")" {
+			break
+		}
+		if token.text != "," {
+			return nil, false
+		}
+	}
+	if op == "clamp" && len(c.args) != 3 {
+		return nil, false
+	}
+	return c, true
+}
+
+// combine returns the arithmetic node left op right, checking its type.
+// CSS Values and Units Level 4 §10.9: sums need matching types, products
+// a number on one side, and quotients a number on the right
+func combine(op string, left, right *Calc) (*Calc, bool) {
+	c := &Calc{op: op, args: []*Calc{left, right}}
+	ok := true
+	switch op {
+	case "+", "-":
+		c.typ, ok = addTypes(left.typ, right.typ)
+	case "*":
+		if left.typ != mathNumber && right.typ != mathNumber {
+			return nil, false
+		}
+		c.typ = left.typ | right.typ
+	case "/":
+		if right.typ != mathNumber {
+			return nil, false
+		}
+		c.typ = left.typ
+	}
+	return c, ok
+}
+
+// addTypes returns the type of the sum of values of types a and b. Numbers
+// only add to numbers; percentages resolve against lengths, so they add to
+// them.
+func addTypes(a, b mathType) (mathType, bool) {
+	if (a == mathNumber) != (b == mathNumber) {
+		return 0, false
+	}
+	return a | b, true
+}
+
+// resolve returns the value of the expression in pixels (or as a number),
+// with lengths and percentages resolved against ctx.
+func (c *Calc) resolve(ctx LengthContext) float64 {
+	if c.op == "" {
+		return c.value.Resolve(ctx)
+	}
+	values := make([]float64, len(c.args))
+	for i, arg := range c.args {
+		values[i] = arg.resolve(ctx)
+	}
+	switch c.op {
+	case "+":
+		return values[0] + values[1]
+	case "-":
+		return values[0] - values[1]
+	case "*":
+		return values[0] * values[1]
+	case "/":
+		return values[0] / values[1]
+	case "min":
+		return slices.Min(values)
+	case "max":
+		return slices.Max(values)
+	case "clamp":
+		// §10.2: clamp(MIN, VAL, MAX) is max(MIN, min(VAL, MAX))
+		return math.Max(values[0], math.Min(values[1], values[2]))
+	}
+	return 0
+}
+
+// hasPercentage reports whether the expression holds a percentage.
+func (c *Calc) hasPercentage() bool {
+	return c.typ&mathPercent != 0
+}
+
+// isRelative reports whether the expression holds a font- or
+// viewport-relative length.
+func (c *Calc) isRelative() bool {
+	if c.op == "" {
+		return c.value.IsRelative()
+	}
+	for _, arg := range c.args {
+		if arg.isRelative() {
+			return true
+		}
+	}
+	return false
+}
+
+// compute returns the expression with its lengths in pixels, leaving the
+// percentages. Sums and products of lengths and percentages are simplified
+// to a percentage plus a length.
+// CSS Values and Units Level 4 §10.10.1 Simplification
+func (c *Calc) compute(ctx LengthContext) *Calc {
+	if c.typ == mathNumber {
+		return c
+	}
+	if percent, px, ok := c.linear(ctx); ok {
+		return linearCalc(percent, px, c.typ)
+	}
+	computed := &Calc{op: c.op, args: make([]*Calc, len(c.args)), typ: c.typ}
+	for i, arg := range c.args {
+		computed.args[i] = arg.compute(ctx)
+	}
+	return computed
+}
+
+// linearCalc returns the expression percent% + px, leaving out the
+// percentage if typ has none and the length if it is zero.
+func linearCalc(percent, px float64, typ mathType) *Calc {
+	length := &Calc{value: Length{Value: px, Unit: "px"}, typ: mathLength}
+	if typ&mathPercent == 0 {
+		return length
+	}
+	percentage := &Calc{value: Length{Value: percent, Unit: "%"}, typ: mathPercent}
+	if px == 0 {
+		return percentage
+	}
+	sum := &Calc{op: "+", args: []*Calc{percentage, length}, typ: typ}
+	if px < 0 {
+		sum.op = "-"
+		length.value.Value = -px
+	}
+	return sum
+}
+
+// linear returns the expression as a percentage plus a length in pixels,
+// if it has no comparison functions.
+func (c *Calc) linear(ctx LengthContext) (percent, px float64, ok bool) {
+	switch c.op {
+	case "":
+		switch c.typ {
+		case mathPercent:
+			return c.value.Value, 0, true
+		case mathLength:
+			return 0, c.value.Resolve(ctx), true
+		}
+		return 0, c.value.Value, true // a number, as a factor
+	case "+", "-":
+		p1, l1, ok1 := c.args[0].linear(ctx)
+		p2, l2, ok2 := c.args[1].linear(ctx)
+		if c.op == "-" {
+			p2, l2 = -p2, -l2
+		}
+		return p1 + p2, l1 + l2, ok1 && ok2
+	case "*", "/":
+		value, number := c.args[0], c.args[1]
+		if c.op == "*" && value.typ == mathNumber {
+			value, number = number, value
+		}
+		p, l, ok := value.linear(ctx)
+		factor := number.resolve(ctx)
+		if c.op == "/" {
+			factor = 1 / factor
+		}
+		return p * factor, l * factor, ok && number.typ == mathNumber
+	}
+	return 0, 0, false
+}
+
+// String serializes the expression as a math function.
+// CSS Values and Units Level 4 §10.12 Serialization
+func (c *Calc) String() string {
+	var b strings.Builder
+	switch c.op {
+	case "min", "max", "clamp":
+		c.write(&b)
+	default:
+		b.WriteString("calc(")
+		c.write(&b)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// write writes the expression, parenthesizing nested sums and products.
+func (c *Calc) write(b *strings.Builder) {
+	switch c.op {
+	case "":
+		b.WriteString(formatNumber(c.value.Value) + c.value.Unit)
+	case "min", "max", "clamp":
+		b.WriteString(c.op + "(")
+		for i, arg := range c.args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			arg.write(b)
+		}
+		b.WriteString(")")
+	default:
+		for i, arg := range c.args {
+			if i > 0 {
+				b.WriteString(" " + c.op + " ")
+			}
+			nested := arg.op == "+" || arg.op == "-" || arg.op == "*" || arg.op == "/"
+			if nested {
+				b.WriteString("(")
+			}
+			arg.write(b)
+			if nested {
+				b.WriteString(")")
+			}
+		}
+	}
+}
+
+// formatNumber formats a number for serialization, rounded to a millionth
+// so that floating-point error from unit conversions does not show.
+func formatNumber(n float64) string {
+	return strconv.FormatFloat(math.Round(n*1e6)/1e6, 'f', -1, 64)
+}
@@ -0,0 +1,142 @@
+package css
+
+import (
+	"math"
+	"testing"
+)
+
+// TestCalcResolve tests the parsing and evaluation of math functions.
+// CSS Values and Units Level 4 §10.1, §10.2
+func TestCalcResolve(t *testing.T) {
+	ctx := LengthContext{
+		FontSize:       10,
+		RootFontSize:   16,
+		PercentBase:    200,
+		ViewportWidth:  1000,
+		ViewportHeight: 500,
+	}
+
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"calc(10px)", 10},
+		{"calc(100% - 2rem)", 168},
+		{"calc(1em + 2px * 3)", 16},
+		{"calc((1em + 2px) * 3)", 36},
+		{"calc(3 * (1em + 2px))", 36},
+		{"calc(100%/4)", 50},
+		{"calc(50% - -10px)", 110},
+		{"CALC(1IN + 1PX)", 97},
+		{"calc( 1px  +  1px )", 2},
+		{"calc(1e1px + 2.5e-1px)", 10.25},
+		{"calc(calc(1px + 1px) * 2)", 4},
+		{"min(10px, 5%, 2em)", 10},
+		{"max(10px, 5%, 2em)", 20},
+		{"min(50%, 30px + 1em)", 40},
+		{"clamp(1rem, 2vw, 2rem)", 20},
+		{"clamp(1rem, 1vw, 2rem)", 16},
+		{"clamp(1rem, 5vw, 2rem)", 32},
+		{"calc(min(10px, 1em) + max(5%, 1px))", 20},
+		{"calc(1px / 0 * 0)", 0},
+	}
+
+	for _, tt := range tests {
+		length, ok := ParseLength(tt.input)
+		if !ok {
+			t.Errorf("ParseLength(%q) failed", tt.input)
+			continue
+		}
+		if got := length.Resolve(ctx); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("Resolve(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestCalcInvalid tests that malformed and mistyped math functions are
+// rejected.
+// CSS Values and Units Level 4 §10.1, §10.9 Type Checking
+func TestCalcInvalid(t *testing.T) {
+	tests := []string{
+		"calc()",
+		"calc(1px+2px)",  // + needs whitespace
+		"calc(1px -2px)", // a negative number, not a subtraction
+		"calc(1px + 2)",  // length plus number
+		"calc(1px * 2px)",
+		"calc(2 / 1px)",
+		"calc(1px / 2px)",
+		"calc(5)", // a number, not a length
+		"calc(1px",
+		"calc(1px))",
+		"calc(1px + )",
+		"calc(1furlong)",
+		"clamp(1px, 2px)",
+		"min(1px, 2)",
+		"min(1px 2px)",
+		"calc(var(--x))",
+		"round(1px)",
+	}
+
+	for _, input := range tests {
+		if length, ok := ParseLength(input); ok {
+			t.Errorf("ParseLength(%q) = %v, expected failure", input, length)
+		}
+	}
+}
+
+// TestCalcCompute tests the computed values of math functions: relative
+// lengths become pixels, and percentages are kept in a simplified form.
+// CSS Values and Units Level 4 §10.10 Computed Value
+func TestCalcCompute(t *testing.T) {
+	ctx := LengthContext{FontSize: 10, RootFontSize: 16, ViewportWidth: 1000, ViewportHeight: 500}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"calc(1em + 2px)", "12px"},
+		{"calc(100% - 2rem)", "calc(100% - 32px)"},
+		{"calc(10% + 1em + 20% - 3px)", "calc(30% + 7px)"},
+		{"calc((50% + 1em) / 2)", "calc(25% + 5px)"},
+		{"calc(50% + 1em - 10px)", "50%"},
+		{"min(50%, 2em + 1vw)", "min(50%, 30px)"},
+		{"max(1em, 10vw)", "100px"},
+		{"calc(min(10%, 1em) + 2px)", "calc(min(10%, 10px) + 2px)"},
+		{"clamp(10px, 50% + 1em, 1in)", "clamp(10px, 50% + 10px, 96px)"},
+		{"2em", "20px"},
+		{"50%", "50%"},
+	}
+
+	for _, tt := range tests {
+		length, ok := ParseLength(tt.input)
+		if !ok {
+			t.Errorf("ParseLength(%q) failed", tt.input)
+			continue
+		}
+		if got := length.Compute(ctx).String(); got != tt.expected {
+			t.Errorf("Compute(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestCalcRoundTrip tests that computed values parse to the same length.
+func TestCalcRoundTrip(t *testing.T) {
+	ctx := LengthContext{FontSize: 10, PercentBase: 300}
+	for _, input := range []string{
+		"calc(100% - 2em)",
+		"min(50%, 2em + 3px)",
+		"clamp(10px, 50% + 1em, 1in)",
+		"calc(min(10%, 1em) * 3 + 2px)",
+	} {
+		length, _ := ParseLength(input)
+		computed := length.Compute(ctx)
+		reparsed, ok := ParseLength(computed.String())
+		if !ok {
+			t.Errorf("ParseLength(%q) failed", computed.String())
+			continue
+		}
+		if got, expected := reparsed.Resolve(ctx), length.Resolve(ctx); math.Abs(got-expected) > 1e-9 {
+			t.Errorf("%q: computed %q resolves to %v, expected %v", input, computed, got, expected)
+		}
+	}
+}
@@ -0,0 +1,729 @@
+package css
+
+// This file contains CSS color values: the color keywords and the color
+// functions of CSS Color Level 4, and color-mix() from CSS Color Level 5.
+// Conversion between color spaces is in colorspace.go.
+//
+// Spec references:
+// - CSS Color Level 4: https://www.w3.org/TR/css-color-4/
+// - CSS Color Level 5 §2 Mixing Colors: https://www.w3.org/TR/css-color-5/#color-mix
+//
+// Implemented:
+// - Named colors, transparent, currentcolor and system colors (§6)
+// - Hex colors with 3, 4, 6 or 8 digits (§5.2)
+// - rgb(), rgba(), hsl() and hsla() in the legacy and modern syntaxes, and hwb() (§5.1, §7, §8)
+// - lab(), lch(), oklab() and oklch() (§9)
+// - color() in the srgb, srgb-linear, display-p3, xyz, xyz-d50 and xyz-d65 spaces (§10)
+// - The none keyword for missing components (§4.4)
+// - color-mix() in any of those spaces, hsl and hwb, with hue interpolation methods
+//
+// Not implemented:
+// - The a98-rgb, prophoto-rgb and rec2020 color spaces
+// - Relative color syntax and math functions in color components
+// - System colors for a dark color scheme
+
+import (
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Color is a parsed CSS color: three components in a color space, and an
+// alpha. Missing components, written 'none', are NaN.
+// CSS Color Level 4 §4 Representing Colors
+type Color struct {
+	Space      ColorSpace
+	Components [3]float64
+	Alpha      float64
+
+	// CurrentColor is set for the currentcolor keyword, which stands for
+	// the value of the element's 'color' property (see ResolveCurrentColor).
+	CurrentColor bool
+}
+
+// ParseColor parses a CSS color value and returns it as an sRGB color.RGBA
+// with premultiplied alpha, gamut mapped if it lies outside sRGB.
+// Values that are not colors, and currentcolor, which the caller must
+// resolve, give black.
+// CSS Color Level 4 §13 Gamut Mapping
+func ParseColor(value string) color.RGBA {
+	if c, ok := ParseColorValue(value); ok && !c.CurrentColor {
+		return c.ToRGBA()
+	}
+
+	// Default to black
+	return color.RGBA{0, 0, 0, 255}
+}
+
+// IsColor reports whether value is a valid color.
+func IsColor(value string) bool {
+	_, ok := ParseColorValue(value)
+	return ok
+}
+
+// ParseColorValue parses any CSS color value, reporting whether value is
+// one.
+// CSS Color Level 4 §4.1 The <color> syntax
+func ParseColorValue(value string) (Color, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch value {
+	case "transparent":
+		// CSS Color Level 4 §6.3: transparent is rgb(0 0 0 / 0)
+		return Color{Space: SRGB}, true
+	case "currentcolor":
+		return Color{CurrentColor: true, Alpha: 1}, true
+	}
+	if rgba, ok := namedColors[value]; ok {
+		return rgbaColor(rgba), true
+	}
+	if rgba, ok := systemColors[value]; ok {
+		return rgbaColor(rgba), true
+	}
+	if strings.HasPrefix(value, "#") {
+		return parseHexColor(value[1:])
+	}
+
+	open := strings.IndexByte(value, '(')
+	if open <= 0 || !strings.HasSuffix(value, ")") {
+		return Color{}, false
+	}
+	name, args := value[:open], value[open+1:len(value)-1]
+	switch name {
+	case "rgb", "rgba":
+		return parseRGB(args)
+	case "hsl", "hsla":
+		return parseHSL(args)
+	case "hwb":
+		return parseHWB(args)
+	case "lab", "oklab":
+		return parseLab(name, args)
+	case "lch", "oklch":
+		return parseLCH(name, args)
+	case "color":
+		return parseColorFunction(args)
+	case "color-mix":
+		return parseColorMix(args)
+	}
+	return Color{}, false
+}
+
+// ResolveCurrentColor replaces the currentcolor keywords in value, which
+// may be any property value, by current.
+// CSS Color Level 4 §6.4 The currentcolor keyword
+func ResolveCurrentColor(value, current string) string {
+	const keyword = "currentcolor"
+	var b strings.Builder
+	var quote byte
+	last := 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case i+len(keyword) <= len(value) && strings.EqualFold(value[i:i+len(keyword)], keyword) &&
+			(i == 0 || !isNameChar(rune(value[i-1]))) &&
+			(i+len(keyword) == len(value) || !isNameChar(rune(value[i+len(keyword)]))):
+			b.WriteString(value[last:i])
+			b.WriteString(current)
+			i += len(keyword) - 1
+			last = i + 1
+		}
+	}
+	if last == 0 {
+		return value
+	}
+	b.WriteString(value[last:])
+	return b.String()
+}
+
+// rgbaColor returns the sRGB color of an opaque or non-premultiplied rgba.
+func rgbaColor(rgba color.RGBA) Color {
+	return Color{
+		Space:      SRGB,
+		Components: [3]float64{float64(rgba.R) / 255, float64(rgba.G) / 255, float64(rgba.B) / 255},
+		Alpha:      float64(rgba.A) / 255,
+	}
+}
+
+// parseHexColor parses the digits of a hex color.
+// CSS Color Level 4 §5.2 The RGB hexadecimal notations: #RGB, #RGBA,
+// #RRGGBB and #RRGGBBAA
+func parseHexColor(hex string) (Color, bool) {
+	if !isHexDigits(hex) {
+		return Color{}, false
+	}
+	var digits [4]uint64
+	digits[3] = 255
+	switch len(hex) {
+	case 3, 4:
+		for i := range hex {
+			d, _ := strconv.ParseUint(hex[i:i+1], 16, 8)
+			digits[i] = d * 17
+		}
+	case 6, 8:
+		for i := 0; i < len(hex); i += 2 {
+			digits[i/2], _ = strconv.ParseUint(hex[i:i+2], 16, 8)
+		}
+	default:
+		return Color{}, false
+	}
+	return rgbaColor(color.RGBA{uint8(digits[0]), uint8(digits[1]), uint8(digits[2]), uint8(digits[3])}), true
+}
+
+// isHexDigits reports whether s consists of hexadecimal digits.
+func isHexDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// colorArgs holds the arguments of a color function: its components and
+// its alpha, "" if omitted. legacy is set for the comma-separated syntax,
+// which does not allow 'none'.
+type colorArgs struct {
+	components []string
+	alpha      string
+	legacy     bool
+}
+
+// splitColorArgs splits the arguments of a color function with n
+// components, in the modern space-separated syntax with an optional
+// "/ alpha", or if allowLegacy is set in the legacy comma-separated one.
+// CSS Color Level 4 §5.1, §7.1
+func splitColorArgs(args string, n int, allowLegacy bool) (colorArgs, bool) {
+	if strings.Contains(args, ",") {
+		parts := splitCommas(args)
+		if !allowLegacy || (len(parts) != n && len(parts) != n+1) {
+			return colorArgs{}, false
+		}
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+			if parts[i] == "none" || strings.ContainsAny(parts[i], " \t\n/") {
+				return colorArgs{}, false
+			}
+		}
+		result := colorArgs{components: parts[:n], legacy: true}
+		if len(parts) > n {
+			result.alpha = parts[n]
+		}
+		return result, true
+	}
+
+	components, alpha, hasAlpha := strings.Cut(args, "/")
+	result := colorArgs{components: strings.Fields(components), alpha: strings.TrimSpace(alpha)}
+	if len(result.components) != n || (hasAlpha && len(strings.Fields(alpha)) != 1) {
+		return colorArgs{}, false
+	}
+	return result, true
+}
+
+// parseComponent parses a color component given as a number, or as a
+// percentage of reference. It returns NaN for 'none'.
+// CSS Color Level 4 §4.4 "Missing" Color Components
+func parseComponent(s string, reference float64) (float64, bool) {
+	if s == "none" {
+		return math.NaN(), true
+	}
+	if percent, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(percent, 64)
+		return v / 100 * reference, err == nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// parseHue parses a hue, given as a number of degrees or an angle, and
+// returns it in degrees. It returns NaN for 'none'.
+// CSS Color Level 4 §4.3 Representing Hues, CSS Values and Units Level 4 §7.1 Angle Units
+func parseHue(s string) (float64, bool) {
+	if s == "none" {
+		return math.NaN(), true
+	}
+	units := []struct {
+		unit    string
+		degrees float64
+	}{
+		{"deg", 1},
+		{"grad", 0.9},
+		{"rad", 180 / math.Pi},
+		{"turn", 360},
+	}
+	scale := 1.0
+	for _, u := range units {
+		if number, ok := strings.CutSuffix(s, u.unit); ok {
+			s, scale = number, u.degrees
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v * scale, err == nil
+}
+
+// parseAlpha parses an alpha value, a number or a percentage clamped to
+// [0, 1]. An omitted alpha is 1.
+// CSS Color Level 4 §4.2 Representing Transparency in Colors: the <alpha-value> syntax
+func parseAlpha(s string) (float64, bool) {
+	if s == "" {
+		return 1, true
+	}
+	v, ok := parseComponent(s, 1)
+	if !ok {
+		return 0, false
+	}
+	if math.IsNaN(v) {
+		return v, true
+	}
+	return clamp(v, 0, 1), true
+}
+
+// parseComponents parses the components of args, with the given values
+// for 100%, and its alpha into a color in space. A zero reference marks a
+// hue.
+func parseComponents(space ColorSpace, args colorArgs, references [3]float64) (Color, bool) {
+	c := Color{Space: space}
+	for i, s := range args.components {
+		var ok bool
+		if references[i] == 0 {
+			c.Components[i], ok = parseHue(s)
+		} else {
+			c.Components[i], ok = parseComponent(s, references[i])
+		}
+		if !ok {
+			return Color{}, false
+		}
+	}
+	alpha, ok := parseAlpha(args.alpha)
+	if !ok {
+		return Color{}, false
+	}
+	c.Alpha = alpha
+	return c, true
+}
+
+// parseRGB parses the arguments of rgb() and rgba().
+// CSS Color Level 4 §5.1 The RGB functions: in the legacy syntax the
+// channels are all numbers or all percentages
+func parseRGB(args string) (Color, bool) {
+	parsed, ok := splitColorArgs(args, 3, true)
+	if !ok {
+		return Color{}, false
+	}
+	if parsed.legacy {
+		percents := 0
+		for _, s := range parsed.components {
+			if strings.HasSuffix(s, "%") {
+				percents++
+			}
+		}
+		if percents != 0 && percents != 3 {
+			return Color{}, false
+		}
+	}
+	c, ok := parseComponents(SRGB, parsed, [3]float64{255, 255, 255})
+	if !ok {
+		return Color{}, false
+	}
+	for i := range c.Components {
+		c.Components[i] = clamp(c.Components[i]/255, 0, 1)
+	}
+	return c, true
+}
+
+// parseHSL parses the arguments of hsl() and hsla(), giving an sRGB color.
+// CSS Color Level 4 §7.1 The HSL functions: in the legacy syntax,
+// saturation and lightness are percentages
+func parseHSL(args string) (Color, bool) {
+	parsed, ok := splitColorArgs(args, 3, true)
+	if !ok {
+		return Color{}, false
+	}
+	if parsed.legacy && (!strings.HasSuffix(parsed.components[1], "%") || !strings.HasSuffix(parsed.components[2], "%")) {
+		return Color{}, false
+	}
+	c, ok := parseComponents(HSL, parsed, [3]float64{0, 100, 100})
+	if !ok {
+		return Color{}, false
+	}
+	c.Components[1] = clamp(c.Components[1], 0, 100)
+	c.Components[2] = clamp(c.Components[2], 0, 100)
+	return c.To(SRGB), true
+}
+
+// parseHWB parses the arguments of hwb(), giving an sRGB color.
+// CSS Color Level 4 §8.1 The HWB function
+func parseHWB(args string) (Color, bool) {
+	parsed, ok := splitColorArgs(args, 3, false)
+	if !ok {
+		return Color{}, false
+	}
+	c, ok := parseComponents(HWB, parsed, [3]float64{0, 100, 100})
+	if !ok {
+		return Color{}, false
+	}
+	c.Components[1] = clamp(c.Components[1], 0, 100)
+	c.Components[2] = clamp(c.Components[2], 0, 100)
+	return c.To(SRGB), true
+}
+
+// parseLab parses the arguments of lab() or oklab().
+// CSS Color Level 4 §9.2, §9.4: lightness is clamped to its range, and
+// 100% of a or b is 125 for lab() and 0.4 for oklab()
+func parseLab(name string, args string) (Color, bool) {
+	parsed, ok := splitColorArgs(args, 3, false)
+	if !ok {
+		return Color{}, false
+	}
+	space, references := Lab, [3]float64{100, 125, 125}
+	if name == "oklab" {
+		space, references = OKLab, [3]float64{1, 0.4, 0.4}
+	}
+	c, ok := parseComponents(space, parsed, references)
+	if !ok {
+		return Color{}, false
+	}
+	c.Components[0] = clamp(c.Components[0], 0, references[0])
+	return c, true
+}
+
+// parseLCH parses the arguments of lch() or oklch().
+// CSS Color Level 4 §9.3, §9.5: chroma is at least 0, and 100% of it is
+// 150 for lch() and 0.4 for oklch()
+func parseLCH(name string, args string) (Color, bool) {
+	parsed, ok := splitColorArgs(args, 3, false)
+	if !ok {
+		return Color{}, false
+	}
+	space, references := LCH, [3]float64{100, 150, 0}
+	if name == "oklch" {
+		space, references = OKLCH, [3]float64{1, 0.4, 0}
+	}
+	c, ok := parseComponents(space, parsed, references)
+	if !ok {
+		return Color{}, false
+	}
+	c.Components[0] = clamp(c.Components[0], 0, references[0])
+	c.Components[1] = math.Max(c.Components[1], 0)
+	return c, true
+}
+
+// parseColorFunction parses the arguments of color(): a predefined color
+// space and its components, where 100% is 1.
+// CSS Color Level 4 §10.1 Specifying Predefined Colors: the color() function
+func parseColorFunction(args string) (Color, bool) {
+	name, rest, _ := strings.Cut(strings.TrimSpace(args), " ")
+	space, ok := predefinedColorSpaces[name]
+	if !ok {
+		return Color{}, false
+	}
+	parsed, ok := splitColorArgs(rest, 3, false)
+	if !ok {
+		return Color{}, false
+	}
+	return parseComponents(space, parsed, [3]float64{1, 1, 1})
+}
+
+// parseColorMix parses the arguments of color-mix() and mixes its colors.
+// CSS Color Level 5 §2.1 Percentage Normalization
+func parseColorMix(args string) (Color, bool) {
+	parts := splitCommas(args)
+	space, hueMethod := OKLab, "shorter"
+	if len(parts) == 3 {
+		var ok bool
+		if space, hueMethod, ok = parseInterpolationMethod(parts[0]); !ok {
+			return Color{}, false
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 2 {
+		return Color{}, false
+	}
+
+	var colors [2]Color
+	var percents [2]float64
+	var hasPercent [2]bool
+	for i, part := range parts {
+		var ok bool
+		colors[i], percents[i], hasPercent[i], ok = parseMixComponent(part)
+		if !ok || colors[i].CurrentColor {
+			return Color{}, false
+		}
+	}
+
+	switch {
+	case !hasPercent[0] && !hasPercent[1]:
+		percents = [2]float64{50, 50}
+	case !hasPercent[1]:
+		percents[1] = 100 - percents[0]
+	case !hasPercent[0]:
+		percents[0] = 100 - percents[1]
+	}
+	sum := percents[0] + percents[1]
+	if sum == 0 {
+		return Color{}, false
+	}
+	// Percentages summing to less than 100% make the result translucent
+	alphaMultiplier := math.Min(sum/100, 1)
+
+	mixed := mix(colors[0], colors[1], percents[1]/sum, space, hueMethod)
+	if !math.IsNaN(mixed.Alpha) {
+		mixed.Alpha *= alphaMultiplier
+	}
+	return mixed, true
+}
+
+// parseInterpolationMethod parses a <color-interpolation-method>: "in"
+// followed by a color space and, for polar spaces, a hue interpolation
+// method.
+// CSS Color Level 4 §12.1 Color Space for Interpolation
+func parseInterpolationMethod(s string) (space ColorSpace, hueMethod string, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 2 || fields[0] != "in" {
+		return 0, "", false
+	}
+	space, ok = interpolationColorSpaces[fields[1]]
+	if !ok {
+		return 0, "", false
+	}
+	switch {
+	case len(fields) == 2:
+		return space, "shorter", true
+	case len(fields) == 4 && space.hueIndex() >= 0 && fields[3] == "hue":
+		switch fields[2] {
+		case "shorter", "longer", "increasing", "decreasing":
+			return space, fields[2], true
+		}
+	}
+	return 0, "", false
+}
+
+// parseMixComponent parses a color and its optional percentage, given
+// before or after it, from the arguments of color-mix().
+func parseMixComponent(s string) (c Color, percent float64, hasPercent bool, ok bool) {
+	s = strings.TrimSpace(s)
+	parts := splitComponents(s)
+	if len(parts) == 0 {
+		return Color{}, 0, false, false
+	}
+	colorText := s
+	for _, i := range []int{0, len(parts) - 1} {
+		if number, isPercent := strings.CutSuffix(parts[i], "%"); isPercent && len(parts) > 1 {
+			v, err := strconv.ParseFloat(number, 64)
+			if err != nil || v < 0 || v > 100 {
+				return Color{}, 0, false, false
+			}
+			percent, hasPercent = v, true
+			if i == 0 {
+				colorText = strings.TrimSpace(strings.TrimPrefix(s, parts[0]))
+			} else {
+				colorText = strings.TrimSpace(strings.TrimSuffix(s, parts[i]))
+			}
+			break
+		}
+	}
+	c, ok = ParseColorValue(colorText)
+	return c, percent, hasPercent, ok
+}
+
+// clamp limits v to [lo, hi], leaving NaN unchanged.
+func clamp(v, lo, hi float64) float64 {
+	if math.IsNaN(v) {
+		return v
+	}
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// systemColors are the system color keywords, with the values of a light
+// color scheme.
+// CSS Color Level 4 §6.2 System Colors
+var systemColors = map[string]color.RGBA{
+	"accentcolor":      {0, 117, 255, 255},
+	"accentcolortext":  {255, 255, 255, 255},
+	"activetext":       {255, 0, 0, 255},
+	"buttonborder":     {118, 118, 118, 255},
+	"buttonface":       {239, 239, 239, 255},
+	"buttontext":       {0, 0, 0, 255},
+	"canvas":           {255, 255, 255, 255},
+	"canvastext":       {0, 0, 0, 255},
+	"field":            {255, 255, 255, 255},
+	"fieldtext":        {0, 0, 0, 255},
+	"graytext":         {128, 128, 128, 255},
+	"highlight":        {181, 213, 255, 255},
+	"highlighttext":    {0, 0, 0, 255},
+	"linktext":         {0, 0, 238, 255},
+	"mark":             {255, 255, 0, 255},
+	"marktext":         {0, 0, 0, 255},
+	"selecteditem":     {0, 117, 255, 255},
+	"selecteditemtext": {255, 255, 255, 255},
+	"visitedtext":      {85, 26, 139, 255},
+}
+
+// namedColors are the named color keywords.
+// CSS 2.1 §4.3.6 defines 17 basic color keywords (including orange added in CSS 2.1)
+// CSS Color Level 4 §6.1: Named colors (148 total colors)
+var namedColors = map[string]color.RGBA{
+	// CSS 2.1 Basic 17 colors
+	"black":   {0, 0, 0, 255},
+	"silver":  {192, 192, 192, 255},
+	"gray":    {128, 128, 128, 255},
+	"grey":    {128, 128, 128, 255},
+	"white":   {255, 255, 255, 255},
+	"maroon":  {128, 0, 0, 255},
+	"red":     {255, 0, 0, 255},
+	"purple":  {128, 0, 128, 255},
+	"fuchsia": {255, 0, 255, 255},
+	"magenta": {255, 0, 255, 255},
+	"green":   {0, 128, 0, 255},
+	"lime":    {0, 255, 0, 255},
+	"olive":   {128, 128, 0, 255},
+	"yellow":  {255, 255, 0, 255},
+	"navy":    {0, 0, 128, 255},
+	"blue":    {0, 0, 255, 255},
+	"teal":    {0, 128, 128, 255},
+	"aqua":    {0, 255, 255, 255},
+	"cyan":    {0, 255, 255, 255},
+	"orange":  {255, 165, 0, 255}, // Added in CSS 2.1
+
+	// Extended colors commonly used in web pages
+	"lightgray":      {211, 211, 211, 255},
+	"lightgrey":      {211, 211, 211, 255},
+	"darkgray":       {169, 169, 169, 255},
+	"darkgrey":       {169, 169, 169, 255},
+	"dimgray":        {105, 105, 105, 255},
+	"dimgrey":        {105, 105, 105, 255},
+	"lightslategray": {119, 136, 153, 255},
+	"lightslategrey": {119, 136, 153, 255},
+	"slategray":      {112, 128, 144, 255},
+	"slategrey":      {112, 128, 144, 255},
+	"darkslategray":  {47, 79, 79, 255},
+	"darkslategrey":  {47, 79, 79, 255},
+
+	"aliceblue":            {240, 248, 255, 255},
+	"antiquewhite":         {250, 235, 215, 255},
+	"aquamarine":           {127, 255, 212, 255},
+	"azure":                {240, 255, 255, 255},
+	"beige":                {245, 245, 220, 255},
+	"bisque":               {255, 228, 196, 255},
+	"blanchedalmond":       {255, 235, 205, 255},
+	"blueviolet":           {138, 43, 226, 255},
+	"brown":                {165, 42, 42, 255},
+	"burlywood":            {222, 184, 135, 255},
+	"cadetblue":            {95, 158, 160, 255},
+	"chartreuse":           {127, 255, 0, 255},
+	"chocolate":            {210, 105, 30, 255},
+	"coral":                {255, 127, 80, 255},
+	"cornflowerblue":       {100, 149, 237, 255},
+	"cornsilk":             {255, 248, 220, 255},
+	"crimson":              {220, 20, 60, 255},
+	"darkblue":             {0, 0, 139, 255},
+	"darkcyan":             {0, 139, 139, 255},
+	"darkgoldenrod":        {184, 134, 11, 255},
+	"darkgreen":            {0, 100, 0, 255},
+	"darkkhaki":            {189, 183, 107, 255},
+	"darkmagenta":          {139, 0, 139, 255},
+	"darkolivegreen":       {85, 107, 47, 255},
+	"darkorange":           {255, 140, 0, 255},
+	"darkorchid":           {153, 50, 204, 255},
+	"darkred":              {139, 0, 0, 255},
+	"darksalmon":           {233, 150, 122, 255},
+	"darkseagreen":         {143, 188, 143, 255},
+	"darkslateblue":        {72, 61, 139, 255},
+	"darkturquoise":        {0, 206, 209, 255},
+	"darkviolet":           {148, 0, 211, 255},
+	"deeppink":             {255, 20, 147, 255},
+	"deepskyblue":          {0, 191, 255, 255},
+	"dodgerblue":           {30, 144, 255, 255},
+	"firebrick":            {178, 34, 34, 255},
+	"floralwhite":          {255, 250, 240, 255},
+	"forestgreen":          {34, 139, 34, 255},
+	"gainsboro":            {220, 220, 220, 255},
+	"ghostwhite":           {248, 248, 255, 255},
+	"gold":                 {255, 215, 0, 255},
+	"goldenrod":            {218, 165, 32, 255},
+	"greenyellow":          {173, 255, 47, 255},
+	"honeydew":             {240, 255, 240, 255},
+	"hotpink":              {255, 105, 180, 255},
+	"indianred":            {205, 92, 92, 255},
+	"indigo":               {75, 0, 130, 255},
+	"ivory":                {255, 255, 240, 255},
+	"khaki":                {240, 230, 140, 255},
+	"lavender":             {230, 230, 250, 255},
+	"lavenderblush":        {255, 240, 245, 255},
+	"lawngreen":            {124, 252, 0, 255},
+	"lemonchiffon":         {255, 250, 205, 255},
+	"lightblue":            {173, 216, 230, 255},
+	"lightcoral":           {240, 128, 128, 255},
+	"lightcyan":            {224, 255, 255, 255},
+	"lightgoldenrodyellow": {250, 250, 210, 255},
+	"lightgreen":           {144, 238, 144, 255},
+	"lightpink":            {255, 182, 193, 255},
+	"lightsalmon":          {255, 160, 122, 255},
+	"lightseagreen":        {32, 178, 170, 255},
+	"lightskyblue":         {135, 206, 250, 255},
+	"lightsteelblue":       {176, 196, 222, 255},
+	"lightyellow":          {255, 255, 224, 255},
+	"limegreen":            {50, 205, 50, 255},
+	"linen":                {250, 240, 230, 255},
+	"mediumaquamarine":     {102, 205, 170, 255},
+	"mediumblue":           {0, 0, 205, 255},
+	"mediumorchid":         {186, 85, 211, 255},
+	"mediumpurple":         {147, 112, 219, 255},
+	"mediumseagreen":       {60, 179, 113, 255},
+	"mediumslateblue":      {123, 104, 238, 255},
+	"mediumspringgreen":    {0, 250, 154, 255},
+	"mediumturquoise":      {72, 209, 204, 255},
+	"mediumvioletred":      {199, 21, 133, 255},
+	"midnightblue":         {25, 25, 112, 255},
+	"mintcream":            {245, 255, 250, 255},
+	"mistyrose":            {255, 228, 225, 255},
+	"moccasin":             {255, 228, 181, 255},
+	"navajowhite":          {255, 222, 173, 255},
+	"oldlace":              {253, 245, 230, 255},
+	"olivedrab":            {107, 142, 35, 255},
+	"orangered":            {255, 69, 0, 255},
+	"orchid":               {218, 112, 214, 255},
+	"palegoldenrod":        {238, 232, 170, 255},
+	"palegreen":            {152, 251, 152, 255},
+	"paleturquoise":        {175, 238, 238, 255},
+	"palevioletred":        {219, 112, 147, 255},
+	"papayawhip":           {255, 239, 213, 255},
+	"peachpuff":            {255, 218, 185, 255},
+	"peru":                 {205, 133, 63, 255},
+	"pink":                 {255, 192, 203, 255},
+	"plum":                 {221, 160, 221, 255},
+	"powderblue":           {176, 224, 230, 255},
+	"rosybrown":            {188, 143, 143, 255},
+	"royalblue":            {65, 105, 225, 255},
+	"saddlebrown":          {139, 69, 19, 255},
+	"salmon":               {250, 128, 114, 255},
+	"sandybrown":           {244, 164, 96, 255},
+	"seagreen":             {46, 139, 87, 255},
+	"seashell":             {255, 245, 238, 255},
+	"sienna":               {160, 82, 45, 255},
+	"skyblue":              {135, 206, 235, 255},
+	"slateblue":            {106, 90, 205, 255},
+	"snow":                 {255, 250, 250, 255},
+	"springgreen":          {0, 255, 127, 255},
+	"steelblue":            {70, 130, 180, 255},
+	"tan":                  {210, 180, 140, 255},
+	"thistle":              {216, 191, 216, 255},
+	"tomato":               {255, 99, 71, 255},
+	"turquoise":            {64, 224, 208, 255},
+	"violet":               {238, 130, 238, 255},
+	"wheat":                {245, 222, 179, 255},
+	"whitesmoke":           {245, 245, 245, 255},
+	"yellowgreen":          {154, 205, 50, 255},
+
+	// CSS Color Level 4 §6.1: added in Level 4
+	"rebeccapurple": {102, 51, 153, 255},
+}
@@ -0,0 +1,246 @@
+package css
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+// closeRGBA reports whether two colors differ by at most tolerance in
+// every channel.
+func closeRGBA(a, b color.RGBA, tolerance int) bool {
+	diff := func(x, y uint8) bool {
+		d := int(x) - int(y)
+		return d >= -tolerance && d <= tolerance
+	}
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && diff(a.A, b.A)
+}
+
+// TestParseColorValue tests the color syntaxes of CSS Color Level 4,
+// converted to sRGB.
+func TestParseColorValue(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected color.RGBA
+	}{
+		// §5.2 Hex colors
+		{"#f00", color.RGBA{255, 0, 0, 255}},
+		{"#F008", color.RGBA{136, 0, 0, 136}},
+		{"#00ff00", color.RGBA{0, 255, 0, 255}},
+		{"#0000ff80", color.RGBA{0, 0, 128, 128}},
+
+		// §6 Keywords
+		{"RebeccaPurple", color.RGBA{102, 51, 153, 255}},
+		{"transparent", color.RGBA{0, 0, 0, 0}},
+		{"Canvas", color.RGBA{255, 255, 255, 255}},
+		{"CanvasText", color.RGBA{0, 0, 0, 255}},
+		{"LinkText", color.RGBA{0, 0, 238, 255}},
+
+		// §5.1 The RGB functions
+		{"rgb(255, 0, 0)", color.RGBA{255, 0, 0, 255}},
+		{"rgb(100%, 50%, 0%)", color.RGBA{255, 128, 0, 255}},
+		{"rgba(0,0,0,.5)", color.RGBA{0, 0, 0, 128}},
+		{"rgba(255, 0, 0, 50%)", color.RGBA{128, 0, 0, 128}},
+		{"rgb(0 128 255)", color.RGBA{0, 128, 255, 255}},
+		{"RGB(0 128 255 / 0.25)", color.RGBA{0, 32, 64, 64}},
+		{"rgb(300 -20 50%)", color.RGBA{255, 0, 128, 255}},
+		{"rgb(none 255 0)", color.RGBA{0, 255, 0, 255}},
+		{"rgba(0 0 0)", color.RGBA{0, 0, 0, 255}},
+
+		// §7 HSL and §8 HWB
+		{"hsl(120, 100%, 50%)", color.RGBA{0, 255, 0, 255}},
+		{"hsl(210 50% 40%)", color.RGBA{51, 102, 153, 255}},
+		{"hsla(0 100 50 / 50%)", color.RGBA{128, 0, 0, 128}},
+		{"hsl(0.5turn 100% 25%)", color.RGBA{0, 128, 128, 255}},
+		{"hsl(-120deg 100% 50%)", color.RGBA{0, 0, 255, 255}},
+		{"hwb(0 0% 0%)", color.RGBA{255, 0, 0, 255}},
+		{"hwb(120 50% 50%)", color.RGBA{128, 128, 128, 255}},
+		{"hwb(240 20% 20%)", color.RGBA{51, 51, 204, 255}},
+
+		// §9 Lab, LCH, OKLab and OKLCH
+		{"lab(54.29 80.8 69.89)", color.RGBA{255, 0, 0, 255}},
+		{"lch(54.29 106.84 40.85)", color.RGBA{255, 0, 0, 255}},
+		{"oklab(0.628 0.2249 0.1258)", color.RGBA{255, 0, 0, 255}},
+		{"oklch(62.8% 0.2577 29.23)", color.RGBA{255, 0, 0, 255}},
+		{"oklch(100% 0 0)", color.RGBA{255, 255, 255, 255}},
+		{"lab(0 0 0 / 0.5)", color.RGBA{0, 0, 0, 128}},
+		{"oklch(50% none none)", color.RGBA{99, 99, 99, 255}},
+
+		// §10 color()
+		{"color(srgb 1 0.5 0)", color.RGBA{255, 128, 0, 255}},
+		{"color(srgb 100% 50% 0%)", color.RGBA{255, 128, 0, 255}},
+		{"color(srgb-linear 0.2140 0.2140 0.2140)", color.RGBA{128, 128, 128, 255}},
+		{"color(display-p3 0.9175 0.2003 0.1386)", color.RGBA{255, 0, 0, 255}},
+		{"color(xyz 0.4124 0.2126 0.0193)", color.RGBA{255, 0, 0, 255}},
+		{"color(xyz-d50 0.4360 0.2225 0.0139)", color.RGBA{255, 0, 0, 255}},
+	}
+
+	for _, tt := range tests {
+		c, ok := ParseColorValue(tt.input)
+		if !ok {
+			t.Errorf("ParseColorValue(%q) failed", tt.input)
+			continue
+		}
+		if got := c.ToRGBA(); !closeRGBA(got, tt.expected, 1) {
+			t.Errorf("ParseColorValue(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestParseColorValueInvalid tests that malformed colors are rejected.
+func TestParseColorValueInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"notacolor",
+		"#12345",
+		"#ggg",
+		"rgb(1, 2)",
+		"rgb(1 2 3, 4)",
+		"rgb(10%, 2, 3)",
+		"rgb(none, 2, 3)",
+		"rgb(1 2 3 / 4 5)",
+		"rgb(1px 2 3)",
+		"hsl(120, 100, 50)",
+		"hwb(0, 0%, 0%)",
+		"lab(50, 0, 0)",
+		"oklch(50% 0.1)",
+		"color(foo 1 2 3)",
+		"color(srgb 1 2)",
+		"rgb(255 0 0",
+	} {
+		if c, ok := ParseColorValue(input); ok {
+			t.Errorf("ParseColorValue(%q) = %+v, expected failure", input, c)
+		}
+	}
+}
+
+// TestGamutMapping tests that colors outside sRGB are mapped into it by
+// reducing chroma, rather than clipped channel by channel.
+// CSS Color Level 4 §13.2
+func TestGamutMapping(t *testing.T) {
+	tests := []string{
+		"color(display-p3 1 0 0)",
+		"color(display-p3 0 1 0)",
+		"oklch(70% 0.4 150)",
+		"lab(50 150 -100)",
+	}
+	for _, input := range tests {
+		c, ok := ParseColorValue(input)
+		if !ok {
+			t.Fatalf("ParseColorValue(%q) failed", input)
+		}
+		mapped := gamutMapSRGB(c)
+		if !inSRGBGamut(mapped.Components) {
+			t.Errorf("%q mapped to %v, outside sRGB", input, mapped.Components)
+		}
+		// The hue and lightness are kept close to the original's
+		origin, result := c.To(OKLCH).Components, mapped.To(OKLCH).Components
+		if math.Abs(origin[0]-result[0]) > 0.05 || math.Abs(normalizeHue(origin[2]-result[2]+180)-180) > 5 {
+			t.Errorf("%q: OKLCH %v mapped to %v", input, origin, result)
+		}
+	}
+
+	// Lightness beyond the gamut maps to white or black
+	white, _ := ParseColorValue("oklch(100% 0.3 20)")
+	if got := white.ToRGBA(); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("oklch(100%% 0.3 20) = %v, expected white", got)
+	}
+}
+
+// TestColorConversion tests that converting to each color space and back
+// preserves colors, and that achromatic colors get a missing hue.
+// CSS Color Level 4 §4.4.1, §11
+func TestColorConversion(t *testing.T) {
+	original := Color{Space: SRGB, Components: [3]float64{0.8, 0.3, 0.1}, Alpha: 1}
+	for space := SRGB; space <= HWB; space++ {
+		back := original.To(space).To(SRGB)
+		for i := range back.Components {
+			if math.Abs(back.Components[i]-original.Components[i]) > 1e-6 {
+				t.Errorf("%s round trip: got %v, expected %v", space, back.Components, original.Components)
+				break
+			}
+		}
+	}
+
+	gray := Color{Space: SRGB, Components: [3]float64{0.5, 0.5, 0.5}, Alpha: 1}
+	for _, space := range []ColorSpace{HSL, HWB, LCH, OKLCH} {
+		converted := gray.To(space)
+		if hue := converted.Components[space.hueIndex()]; !math.IsNaN(hue) {
+			t.Errorf("gray in %s has hue %v, expected none", space, hue)
+		}
+	}
+}
+
+// TestColorMix tests color-mix() percentage normalization, premultiplied
+// alpha and hue interpolation.
+// CSS Color Level 5 §2, CSS Color Level 4 §12
+func TestColorMix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected color.RGBA
+	}{
+		{"color-mix(in srgb, red, blue)", color.RGBA{128, 0, 128, 255}},
+		{"color-mix(in srgb, red 25%, blue)", color.RGBA{64, 0, 191, 255}},
+		{"color-mix(in srgb, 25% red, blue)", color.RGBA{64, 0, 191, 255}},
+		{"color-mix(in srgb, red, blue 25%)", color.RGBA{191, 0, 64, 255}},
+		{"color-mix(in srgb, red 60%, blue 60%)", color.RGBA{128, 0, 128, 255}},
+		{"color-mix(in srgb, red 30%, blue 30%)", color.RGBA{77, 0, 77, 153}},
+		{"color-mix(in srgb, rgb(255 0 0 / 0), blue)", color.RGBA{0, 0, 128, 128}},
+		{"color-mix(in srgb, rgb(none 0 0), rgb(255 0 0))", color.RGBA{255, 0, 0, 255}},
+		{"color-mix(in srgb-linear, black, white)", color.RGBA{188, 188, 188, 255}},
+		{"color-mix(in hsl, red, blue)", color.RGBA{255, 0, 255, 255}},
+		{"color-mix(in hsl longer hue, red, blue)", color.RGBA{0, 255, 0, 255}},
+		{"color-mix(in hsl increasing hue, red, blue)", color.RGBA{0, 255, 0, 255}},
+		{"color-mix(in hsl decreasing hue, red, blue)", color.RGBA{255, 0, 255, 255}},
+		{"color-mix(in hsl, white, blue)", color.RGBA{159, 159, 223, 255}},
+		{"color-mix(in oklab, red, red)", color.RGBA{255, 0, 0, 255}},
+		{"color-mix(red, blue 100%)", color.RGBA{0, 0, 255, 255}},
+		{"color-mix(in lch, color-mix(in srgb, red, red), rgb(255 0 0))", color.RGBA{255, 0, 0, 255}},
+	}
+
+	for _, tt := range tests {
+		c, ok := ParseColorValue(tt.input)
+		if !ok {
+			t.Errorf("ParseColorValue(%q) failed", tt.input)
+			continue
+		}
+		if got := c.ToRGBA(); !closeRGBA(got, tt.expected, 1) {
+			t.Errorf("ParseColorValue(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+
+	for _, input := range []string{
+		"color-mix(in srgb, red 0%, blue 0%)",
+		"color-mix(in srgb, red 150%, blue)",
+		"color-mix(in srgb, red)",
+		"color-mix(in srgb, red, blue, green)",
+		"color-mix(in foo, red, blue)",
+		"color-mix(in srgb longer hue, red, blue)",
+		"color-mix(in srgb, currentcolor, blue)",
+	} {
+		if c, ok := ParseColorValue(input); ok {
+			t.Errorf("ParseColorValue(%q) = %+v, expected failure", input, c)
+		}
+	}
+}
+
+// TestResolveCurrentColor tests replacing the currentcolor keyword.
+// CSS Color Level 4 §6.4
+func TestResolveCurrentColor(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"currentColor", "red"},
+		{"1px solid CURRENTCOLOR", "1px solid red"},
+		{"color-mix(in srgb, currentcolor 50%, blue)", "color-mix(in srgb, red 50%, blue)"},
+		{"currentcolors", "currentcolors"},
+		{`"currentcolor"`, `"currentcolor"`},
+		{"blue", "blue"},
+	}
+	for _, tt := range tests {
+		if got := ResolveCurrentColor(tt.value, "red"); got != tt.expected {
+			t.Errorf("ResolveCurrentColor(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,651 @@
+package css
+
+// This file converts colors between color spaces, through CIE XYZ, maps
+// colors outside the sRGB gamut into it, and interpolates colors for
+// color-mix().
+//
+// Spec references:
+// - CSS Color Level 4 §10 Predefined Color Spaces: https://www.w3.org/TR/css-color-4/#predefined
+// - CSS Color Level 4 §12 Interpolation: https://www.w3.org/TR/css-color-4/#interpolation
+// - CSS Color Level 4 §13 Gamut Mapping: https://www.w3.org/TR/css-color-4/#gamut-mapping
+// - CSS Color Level 4 §18 Sample code for Color Conversions: https://www.w3.org/TR/css-color-4/#color-conversion-code
+
+import (
+	"image/color"
+	"math"
+)
+
+// ColorSpace identifies the color space of a Color's components.
+type ColorSpace int
+
+// Color spaces. The components of SRGB, SRGBLinear and DisplayP3 colors
+// range over [0, 1]; HSL and HWB have a hue in degrees and two
+// percentages; Lab and LCH have lightness in [0, 100]; OKLab and OKLCH
+// have lightness in [0, 1]. LCH and OKLCH hues come last.
+const (
+	SRGB ColorSpace = iota
+	SRGBLinear
+	DisplayP3
+	XYZD50
+	XYZD65
+	Lab
+	LCH
+	OKLab
+	OKLCH
+	HSL
+	HWB
+)
+
+var colorSpaceNames = [...]string{
+	SRGB:       "srgb",
+	SRGBLinear: "srgb-linear",
+	DisplayP3:  "display-p3",
+	XYZD50:     "xyz-d50",
+	XYZD65:     "xyz-d65",
+	Lab:        "lab",
+	LCH:        "lch",
+	OKLab:      "oklab",
+	OKLCH:      "oklch",
+	HSL:        "hsl",
+	HWB:        "hwb",
+}
+
+// String returns the CSS name of the color space.
+func (s ColorSpace) String() string {
+	return colorSpaceNames[s]
+}
+
+// predefinedColorSpaces are the color spaces color() accepts.
+// CSS Color Level 4 §10 Predefined Color Spaces
+var predefinedColorSpaces = map[string]ColorSpace{
+	"srgb":        SRGB,
+	"srgb-linear": SRGBLinear,
+	"display-p3":  DisplayP3,
+	"xyz":         XYZD65,
+	"xyz-d50":     XYZD50,
+	"xyz-d65":     XYZD65,
+}
+
+// interpolationColorSpaces are the color spaces colors may be mixed in.
+// CSS Color Level 4 §12.1 Color Space for Interpolation
+var interpolationColorSpaces = map[string]ColorSpace{
+	"srgb":        SRGB,
+	"srgb-linear": SRGBLinear,
+	"display-p3":  DisplayP3,
+	"xyz":         XYZD65,
+	"xyz-d50":     XYZD50,
+	"xyz-d65":     XYZD65,
+	"lab":         Lab,
+	"lch":         LCH,
+	"oklab":       OKLab,
+	"oklch":       OKLCH,
+	"hsl":         HSL,
+	"hwb":         HWB,
+}
+
+// hueIndex returns the index of the hue component of a polar color space,
+// or -1 for rectangular ones.
+func (s ColorSpace) hueIndex() int {
+	switch s {
+	case HSL, HWB:
+		return 0
+	case LCH, OKLCH:
+		return 2
+	}
+	return -1
+}
+
+// matrix3 is a 3x3 matrix converting between linear color spaces.
+type matrix3 [3][3]float64
+
+func (m matrix3) apply(v [3]float64) [3]float64 {
+	var r [3]float64
+	for i := range m {
+		r[i] = m[i][0]*v[0] + m[i][1]*v[1] + m[i][2]*v[2]
+	}
+	return r
+}
+
+// Conversion matrices, from CSS Color Level 4 §18.
+var (
+	linearSRGBToXYZ = matrix3{
+		{506752.0 / 1228815, 87881.0 / 245763, 12673.0 / 70218},
+		{87098.0 / 409605, 175762.0 / 245763, 12673.0 / 175545},
+		{7918.0 / 409605, 87881.0 / 737289, 1001167.0 / 1053270},
+	}
+	xyzToLinearSRGB = matrix3{
+		{12831.0 / 3959, -329.0 / 214, -1974.0 / 3959},
+		{-851781.0 / 878810, 1648619.0 / 878810, 36519.0 / 878810},
+		{705.0 / 12673, -2585.0 / 12673, 705.0 / 667},
+	}
+	linearP3ToXYZ = matrix3{
+		{608311.0 / 1250200, 189793.0 / 714400, 198249.0 / 1000160},
+		{35783.0 / 156275, 247089.0 / 357200, 198249.0 / 2500400},
+		{0, 32229.0 / 714400, 5220557.0 / 5000800},
+	}
+	xyzToLinearP3 = matrix3{
+		{446124.0 / 178915, -333277.0 / 357830, -72051.0 / 178915},
+		{-14852.0 / 17905, 63121.0 / 35810, 423.0 / 17905},
+		{11844.0 / 330415, -50337.0 / 660830, 316169.0 / 330415},
+	}
+
+	// Bradford chromatic adaptation between the D65 and D50 white points
+	d65ToD50 = matrix3{
+		{1.0479297925449969, 0.022946870601609652, -0.05019226628920524},
+		{0.02962780877005599, 0.9904344267538799, -0.017073799063418826},
+		{-0.009243040646204504, 0.015055191490298152, 0.7518742814281371},
+	}
+	d50ToD65 = matrix3{
+		{0.955473421488075, -0.02309845494876471, 0.06325924320057072},
+		{-0.0283697093338637, 1.0099953980813041, 0.021041441191917323},
+		{0.012314014864481998, -0.020507649298898964, 1.330365926242124},
+	}
+
+	xyzToLMS = matrix3{
+		{0.8190224379967030, 0.3619062600528904, -0.1288737815209879},
+		{0.0329836539323885, 0.9292868615863434, 0.0361446663506424},
+		{0.0481771893596242, 0.2642395317527308, 0.6335478284694309},
+	}
+	lmsToOKLab = matrix3{
+		{0.2104542683093140, 0.7936177747023054, -0.0040720430116193},
+		{1.9779985324311684, -2.4285922420485799, 0.4505937096174110},
+		{0.0259040424655478, 0.7827717124575296, -0.8086757549230774},
+	}
+	lmsToXYZ = matrix3{
+		{1.2268798758459243, -0.5578149944602171, 0.2813910456659647},
+		{-0.0405757452148008, 1.1122868032803170, -0.0717110580655164},
+		{-0.0763729366746601, -0.4214933324022432, 1.5869240198367816},
+	}
+	okLabToLMS = matrix3{
+		{1, 0.3963377773761749, 0.2158037573099136},
+		{1, -0.1055613458156586, -0.0638541728258133},
+		{1, -0.0894841775298119, -1.2914855480194092},
+	}
+
+	// The D50 reference white of Lab
+	d50White = [3]float64{0.3457 / 0.3585, 1, (1 - 0.3457 - 0.3585) / 0.3585}
+)
+
+// To converts c to space. Missing components are carried over if space is
+// c's own, and are otherwise taken as zero; a hue that is powerless in
+// the result, that of an achromatic color, is missing.
+// CSS Color Level 4 §4.4 "Missing" Color Components, §11 Converting Colors
+func (c Color) To(space ColorSpace) Color {
+	if c.Space == space {
+		return c
+	}
+	v := c.Components
+	for i := range v {
+		if math.IsNaN(v[i]) {
+			v[i] = 0
+		}
+	}
+	result := Color{Space: space, Alpha: c.Alpha}
+	if rgb, ok := toSRGBDirect(c.Space, v); ok && (space == SRGB || space == HSL || space == HWB) {
+		// HSL and HWB are forms of sRGB, converted without the round trip
+		// through XYZ that would add rounding errors to their hues
+		result.Components = fromSRGBDirect(space, rgb)
+	} else {
+		result.Components = fromXYZD65(space, toXYZD65(c.Space, v))
+	}
+	if hue := space.hueIndex(); hue >= 0 && isAchromatic(space, result.Components) {
+		result.Components[hue] = math.NaN()
+	}
+	return result
+}
+
+// isAchromatic reports whether the polar components v have a powerless hue.
+// CSS Color Level 4 §4.4.1 Powerless components
+func isAchromatic(space ColorSpace, v [3]float64) bool {
+	switch space {
+	case HSL:
+		return math.Abs(v[1]) < 1e-6 || v[2] <= 1e-6 || v[2] >= 100-1e-6
+	case HWB:
+		return v[1]+v[2] >= 100-1e-6
+	case LCH:
+		return v[1] < 1e-4
+	case OKLCH:
+		return v[1] < 1e-6
+	}
+	return false
+}
+
+// toSRGBDirect converts the components v of an sRGB, HSL or HWB color to
+// sRGB, reporting false for other spaces.
+func toSRGBDirect(space ColorSpace, v [3]float64) ([3]float64, bool) {
+	switch space {
+	case SRGB:
+		return v, true
+	case HSL:
+		return hslToSRGB(v), true
+	case HWB:
+		return hwbToSRGB(v), true
+	}
+	return v, false
+}
+
+// fromSRGBDirect converts sRGB components to sRGB, HSL or HWB.
+func fromSRGBDirect(space ColorSpace, rgb [3]float64) [3]float64 {
+	switch space {
+	case HSL:
+		return srgbToHSL(rgb)
+	case HWB:
+		return srgbToHWB(rgb)
+	}
+	return rgb
+}
+
+// toXYZD65 converts the components v of a color in space to CIE XYZ with
+// a D65 white point.
+func toXYZD65(space ColorSpace, v [3]float64) [3]float64 {
+	switch space {
+	case SRGB:
+		return linearSRGBToXYZ.apply(linearize(v))
+	case SRGBLinear:
+		return linearSRGBToXYZ.apply(v)
+	case DisplayP3:
+		return linearP3ToXYZ.apply(linearize(v))
+	case XYZD50:
+		return d50ToD65.apply(v)
+	case XYZD65:
+		return v
+	case Lab:
+		return d50ToD65.apply(labToXYZD50(v))
+	case LCH:
+		return d50ToD65.apply(labToXYZD50(polarToRectangular(v)))
+	case OKLab:
+		return okLabToXYZ(v)
+	case OKLCH:
+		return okLabToXYZ(polarToRectangular(v))
+	case HSL, HWB:
+		rgb, _ := toSRGBDirect(space, v)
+		return linearSRGBToXYZ.apply(linearize(rgb))
+	}
+	return v
+}
+
+// fromXYZD65 converts D65 CIE XYZ components to space.
+func fromXYZD65(space ColorSpace, xyz [3]float64) [3]float64 {
+	switch space {
+	case SRGB:
+		return gammaEncode(xyzToLinearSRGB.apply(xyz))
+	case SRGBLinear:
+		return xyzToLinearSRGB.apply(xyz)
+	case DisplayP3:
+		return gammaEncode(xyzToLinearP3.apply(xyz))
+	case XYZD50:
+		return d65ToD50.apply(xyz)
+	case XYZD65:
+		return xyz
+	case Lab:
+		return xyzD50ToLab(d65ToD50.apply(xyz))
+	case LCH:
+		return rectangularToPolar(xyzD50ToLab(d65ToD50.apply(xyz)))
+	case OKLab:
+		return xyzToOKLab(xyz)
+	case OKLCH:
+		return rectangularToPolar(xyzToOKLab(xyz))
+	case HSL, HWB:
+		return fromSRGBDirect(space, gammaEncode(xyzToLinearSRGB.apply(xyz)))
+	}
+	return xyz
+}
+
+// linearize applies the inverse sRGB transfer function, which Display P3
+// shares, extended to negative values.
+func linearize(v [3]float64) [3]float64 {
+	for i, c := range v {
+		abs := math.Abs(c)
+		if abs <= 0.04045 {
+			v[i] = c / 12.92
+		} else {
+			v[i] = math.Copysign(math.Pow((abs+0.055)/1.055, 2.4), c)
+		}
+	}
+	return v
+}
+
+// gammaEncode applies the sRGB transfer function, extended to negative
+// values.
+func gammaEncode(v [3]float64) [3]float64 {
+	for i, c := range v {
+		abs := math.Abs(c)
+		if abs > 0.0031308 {
+			v[i] = math.Copysign(1.055*math.Pow(abs, 1/2.4)-0.055, c)
+		} else {
+			v[i] = 12.92 * c
+		}
+	}
+	return v
+}
+
+// Lab constants: ε = 216/24389 and κ = 24389/27.
+const (
+	labEpsilon = 216.0 / 24389
+	labKappa   = 24389.0 / 27
+)
+
+func xyzD50ToLab(xyz [3]float64) [3]float64 {
+	var f [3]float64
+	for i := range xyz {
+		v := xyz[i] / d50White[i]
+		if v > labEpsilon {
+			f[i] = math.Cbrt(v)
+		} else {
+			f[i] = (labKappa*v + 16) / 116
+		}
+	}
+	return [3]float64{116*f[1] - 16, 500 * (f[0] - f[1]), 200 * (f[1] - f[2])}
+}
+
+func labToXYZD50(lab [3]float64) [3]float64 {
+	f1 := (lab[0] + 16) / 116
+	f0 := lab[1]/500 + f1
+	f2 := f1 - lab[2]/200
+
+	var xyz [3]float64
+	if cube := f0 * f0 * f0; cube > labEpsilon {
+		xyz[0] = cube
+	} else {
+		xyz[0] = (116*f0 - 16) / labKappa
+	}
+	if lab[0] > labKappa*labEpsilon {
+		xyz[1] = f1 * f1 * f1
+	} else {
+		xyz[1] = lab[0] / labKappa
+	}
+	if cube := f2 * f2 * f2; cube > labEpsilon {
+		xyz[2] = cube
+	} else {
+		xyz[2] = (116*f2 - 16) / labKappa
+	}
+	for i := range xyz {
+		xyz[i] *= d50White[i]
+	}
+	return xyz
+}
+
+func xyzToOKLab(xyz [3]float64) [3]float64 {
+	lms := xyzToLMS.apply(xyz)
+	for i := range lms {
+		lms[i] = math.Cbrt(lms[i])
+	}
+	return lmsToOKLab.apply(lms)
+}
+
+func okLabToXYZ(lab [3]float64) [3]float64 {
+	lms := okLabToLMS.apply(lab)
+	for i := range lms {
+		lms[i] = lms[i] * lms[i] * lms[i]
+	}
+	return lmsToXYZ.apply(lms)
+}
+
+// rectangularToPolar converts Lab-like components to lightness, chroma and
+// a hue in [0, 360).
+func rectangularToPolar(v [3]float64) [3]float64 {
+	hue := math.Atan2(v[2], v[1]) * 180 / math.Pi
+	return [3]float64{v[0], math.Hypot(v[1], v[2]), normalizeHue(hue)}
+}
+
+func polarToRectangular(v [3]float64) [3]float64 {
+	hue := v[2] * math.Pi / 180
+	return [3]float64{v[0], v[1] * math.Cos(hue), v[1] * math.Sin(hue)}
+}
+
+// normalizeHue returns hue in [0, 360).
+func normalizeHue(hue float64) float64 {
+	hue = math.Mod(hue, 360)
+	if hue < 0 {
+		hue += 360
+	}
+	return hue
+}
+
+// hslToSRGB converts hue, saturation and lightness to sRGB.
+// CSS Color Level 4 §7.2 Converting HSL Colors to sRGB
+func hslToSRGB(v [3]float64) [3]float64 {
+	hue := normalizeHue(v[0])
+	saturation, lightness := v[1]/100, v[2]/100
+	channel := func(n float64) float64 {
+		k := math.Mod(n+hue/30, 12)
+		a := saturation * math.Min(lightness, 1-lightness)
+		return lightness - a*math.Max(-1, math.Min(k-3, math.Min(9-k, 1)))
+	}
+	return [3]float64{channel(0), channel(8), channel(4)}
+}
+
+// srgbToHSL converts sRGB to hue, saturation and lightness.
+// CSS Color Level 4 §7.3 Converting sRGB Colors to HSL
+func srgbToHSL(rgb [3]float64) [3]float64 {
+	maxC := math.Max(rgb[0], math.Max(rgb[1], rgb[2]))
+	minC := math.Min(rgb[0], math.Min(rgb[1], rgb[2]))
+	hue, saturation, lightness := 0.0, 0.0, (minC+maxC)/2
+	if d := maxC - minC; d != 0 {
+		if lightness != 0 && lightness != 1 {
+			saturation = (maxC - lightness) / math.Min(lightness, 1-lightness)
+		}
+		switch maxC {
+		case rgb[0]:
+			hue = (rgb[1] - rgb[2]) / d
+		case rgb[1]:
+			hue = (rgb[2]-rgb[0])/d + 2
+		default:
+			hue = (rgb[0]-rgb[1])/d + 4
+		}
+		hue *= 60
+	}
+	return [3]float64{normalizeHue(hue), saturation * 100, lightness * 100}
+}
+
+// hwbToSRGB converts hue, whiteness and blackness to sRGB.
+// CSS Color Level 4 §8.2 Converting HWB Colors to sRGB
+func hwbToSRGB(v [3]float64) [3]float64 {
+	white, black := v[1]/100, v[2]/100
+	if white+black >= 1 {
+		gray := white / (white + black)
+		return [3]float64{gray, gray, gray}
+	}
+	rgb := hslToSRGB([3]float64{v[0], 100, 50})
+	for i := range rgb {
+		rgb[i] = rgb[i]*(1-white-black) + white
+	}
+	return rgb
+}
+
+// srgbToHWB converts sRGB to hue, whiteness and blackness.
+// CSS Color Level 4 §8.3 Converting sRGB Colors to HWB
+func srgbToHWB(rgb [3]float64) [3]float64 {
+	hsl := srgbToHSL(rgb)
+	white := math.Min(rgb[0], math.Min(rgb[1], rgb[2]))
+	black := 1 - math.Max(rgb[0], math.Max(rgb[1], rgb[2]))
+	return [3]float64{hsl[0], white * 100, black * 100}
+}
+
+// ToRGBA returns c as an sRGB color.RGBA with premultiplied alpha. Colors
+// outside the sRGB gamut are gamut mapped, and missing components are
+// zero.
+// CSS Color Level 4 §13 Gamut Mapping
+func (c Color) ToRGBA() color.RGBA {
+	rgb := gamutMapSRGB(c).Components
+	alpha := c.Alpha
+	if math.IsNaN(alpha) {
+		alpha = 0
+	}
+	alpha = clamp(alpha, 0, 1)
+	channel := func(v float64) uint8 {
+		return uint8(math.Round(clamp(v, 0, 1) * alpha * 255))
+	}
+	return color.RGBA{channel(rgb[0]), channel(rgb[1]), channel(rgb[2]), uint8(math.Round(alpha * 255))}
+}
+
+// inSRGBGamut reports whether the sRGB components v are displayable, with
+// a small tolerance for rounding errors in conversion.
+func inSRGBGamut(v [3]float64) bool {
+	const tolerance = 1e-6
+	for _, c := range v {
+		if c < -tolerance || c > 1+tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+// gamutMapSRGB converts c to sRGB, bringing colors outside the gamut
+// within it by reducing their OKLCH chroma until clipping them changes
+// them imperceptibly.
+// CSS Color Level 4 §13.2 CSS Gamut Mapping to an RGB Destination
+func gamutMapSRGB(c Color) Color {
+	const (
+		jnd     = 0.02   // the just-noticeable difference in OKLab
+		epsilon = 0.0001 // the precision of the chroma search
+	)
+
+	rgb := c.To(SRGB)
+	if c.Space == SRGB || c.Space == HSL || c.Space == HWB || inSRGBGamut(rgb.Components) {
+		return clipSRGB(rgb)
+	}
+
+	origin := c.To(OKLCH)
+	for i, v := range origin.Components {
+		if math.IsNaN(v) {
+			origin.Components[i] = 0
+		}
+	}
+	switch lightness := origin.Components[0]; {
+	case lightness >= 1:
+		return Color{Space: SRGB, Components: [3]float64{1, 1, 1}, Alpha: c.Alpha}
+	case lightness <= 0:
+		return Color{Space: SRGB, Alpha: c.Alpha}
+	}
+
+	current := origin
+	clipped := clipSRGB(current.To(SRGB))
+	if deltaEOK(clipped, current) < jnd {
+		return clipped
+	}
+
+	low, high := 0.0, origin.Components[1]
+	lowInGamut := true
+	for high-low > epsilon {
+		chroma := (low + high) / 2
+		current.Components[1] = chroma
+		candidate := current.To(SRGB)
+		if lowInGamut && inSRGBGamut(candidate.Components) {
+			low = chroma
+			continue
+		}
+		clipped = clipSRGB(candidate)
+		e := deltaEOK(clipped, current)
+		if e < jnd {
+			if jnd-e < epsilon {
+				break
+			}
+			lowInGamut = false
+			low = chroma
+		} else {
+			high = chroma
+		}
+	}
+	return clipped
+}
+
+// clipSRGB clamps the components of an sRGB color to [0, 1].
+func clipSRGB(c Color) Color {
+	for i, v := range c.Components {
+		if math.IsNaN(v) {
+			v = 0
+		}
+		c.Components[i] = clamp(v, 0, 1)
+	}
+	return c
+}
+
+// deltaEOK returns the distance between two colors in OKLab.
+// CSS Color Level 4 §13.1.1 The deltaEOK Color Difference
+func deltaEOK(a, b Color) float64 {
+	x, y := a.To(OKLab).Components, b.To(OKLab).Components
+	return math.Sqrt((x[0]-y[0])*(x[0]-y[0]) + (x[1]-y[1])*(x[1]-y[1]) + (x[2]-y[2])*(x[2]-y[2]))
+}
+
+// mix interpolates between a and b in space, at t from a (0) to b (1),
+// with premultiplied alpha. A component missing in one color takes the
+// other's value; hues are interpolated by hueMethod.
+// CSS Color Level 4 §12.3 Interpolating with Missing Components,
+// §12.4 Hue Interpolation, §12.3 Interpolating with Alpha
+func mix(a, b Color, t float64, space ColorSpace, hueMethod string) Color {
+	a, b = a.To(space), b.To(space)
+	for i := range a.Components {
+		switch {
+		case math.IsNaN(a.Components[i]):
+			a.Components[i] = b.Components[i]
+		case math.IsNaN(b.Components[i]):
+			b.Components[i] = a.Components[i]
+		}
+	}
+	switch {
+	case math.IsNaN(a.Alpha):
+		a.Alpha = b.Alpha
+	case math.IsNaN(b.Alpha):
+		b.Alpha = a.Alpha
+	}
+
+	hue := space.hueIndex()
+	if hue >= 0 && !math.IsNaN(a.Components[hue]) {
+		a.Components[hue], b.Components[hue] = fixupHues(a.Components[hue], b.Components[hue], hueMethod)
+	}
+
+	alpha := lerp(a.Alpha, b.Alpha, t)
+	result := Color{Space: space, Alpha: alpha}
+	for i := range result.Components {
+		if i == hue || math.IsNaN(alpha) {
+			result.Components[i] = lerp(a.Components[i], b.Components[i], t)
+			continue
+		}
+		// Interpolate premultiplied components, then divide by the alpha
+		premultiplied := lerp(a.Components[i]*a.Alpha, b.Components[i]*b.Alpha, t)
+		if alpha != 0 {
+			premultiplied /= alpha
+		}
+		result.Components[i] = premultiplied
+	}
+	if hue >= 0 && !math.IsNaN(result.Components[hue]) {
+		result.Components[hue] = normalizeHue(result.Components[hue])
+	}
+	return result
+}
+
+// fixupHues adjusts two hues in degrees so that interpolating linearly
+// between them follows the hue interpolation method.
+// CSS Color Level 4 §12.4 Hue Interpolation
+func fixupHues(h1, h2 float64, method string) (float64, float64) {
+	h1, h2 = normalizeHue(h1), normalizeHue(h2)
+	d := h2 - h1
+	switch method {
+	case "shorter":
+		if d > 180 {
+			h1 += 360
+		} else if d < -180 {
+			h2 += 360
+		}
+	case "longer":
+		if d > 0 && d < 180 {
+			h1 += 360
+		} else if d > -180 && d <= 0 {
+			h2 += 360
+		}
+	case "increasing":
+		if d < 0 {
+			h2 += 360
+		}
+	case "decreasing":
+		if d > 0 {
+			h1 += 360
+		}
+	}
+	return h1, h2
+}
+
+func lerp(a, b, t float64) float64 {
+	return a + (b-a)*t
+}
@@ -0,0 +1,484 @@
+package css
+
+// This file contains parsing for generated content values: the 'content',
+// 'quotes', 'counter-reset', 'counter-increment' and 'counter-set' properties,
+// and the counter styles used by counter() and list markers.
+//
+// Spec references:
+// - CSS 2.1 §12.2 The 'content' property: https://www.w3.org/TR/CSS21/generate.html#content
+// - CSS 2.1 §12.3 Quotation marks: https://www.w3.org/TR/CSS21/generate.html#quotes
+// - CSS 2.1 §12.4 Automatic counters and numbering: https://www.w3.org/TR/CSS21/generate.html#counters
+// - CSS Lists Level 3 §4 Automatic numbering with counters: https://www.w3.org/TR/css-lists-3/#auto-numbering
+// - CSS Counter Styles Level 3 §6 Simple predefined counter styles
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentKind identifies the kind of a single 'content' value component.
+type ContentKind int
+
+const (
+	// ContentString is a string literal: "text"
+	ContentString ContentKind = iota
+	// ContentAttr is attr(name): the value of an attribute of the element
+	ContentAttr
+	// ContentCounter is counter(name) or counter(name, style)
+	ContentCounter
+	// ContentCounters is counters(name, string) or counters(name, string, style)
+	ContentCounters
+	// ContentOpenQuote is the open-quote keyword
+	ContentOpenQuote
+	// ContentCloseQuote is the close-quote keyword
+	ContentCloseQuote
+	// ContentNoOpenQuote is the no-open-quote keyword
+	ContentNoOpenQuote
+	// ContentNoCloseQuote is the no-close-quote keyword
+	ContentNoCloseQuote
+	// ContentURL is url(...): an external resource such as an image
+	ContentURL
+)
+
+// ContentItem is one component of a 'content' value.
+// CSS 2.1 §12.2 The 'content' property
+type ContentItem struct {
+	Kind ContentKind
+
+	// Value is the string literal, attribute name, counter name or URL,
+	// depending on Kind.
+	Value string
+
+	// Separator is the string joining nested counter values for counters().
+	Separator string
+
+	// Style is the counter style for counter()/counters(), "decimal" by default.
+	Style string
+}
+
+// ParseContent parses a 'content' property value into its components.
+// It returns false for 'normal' and 'none', which generate no content, and
+// for values that cannot be parsed.
+// CSS 2.1 §12.2 The 'content' property
+func ParseContent(value string) ([]ContentItem, bool) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "", "normal", "none":
+		return nil, false
+	}
+
+	items := make([]ContentItem, 0)
+	for _, component := range splitComponents(value) {
+		if isQuoted(component) {
+			items = append(items, ContentItem{Kind: ContentString, Value: Unquote(component)})
+			continue
+		}
+
+		name, args, isFunction := splitFunction(component)
+		if !isFunction {
+			switch strings.ToLower(component) {
+			case "open-quote":
+				items = append(items, ContentItem{Kind: ContentOpenQuote})
+			case "close-quote":
+				items = append(items, ContentItem{Kind: ContentCloseQuote})
+			case "no-open-quote":
+				items = append(items, ContentItem{Kind: ContentNoOpenQuote})
+			case "no-close-quote":
+				items = append(items, ContentItem{Kind: ContentNoCloseQuote})
+			default:
+				return nil, false
+			}
+			continue
+		}
+
+		switch name {
+		case "attr":
+			if len(args) != 1 || args[0] == "" {
+				return nil, false
+			}
+			items = append(items, ContentItem{Kind: ContentAttr, Value: strings.ToLower(args[0])})
+		case "counter":
+			if len(args) < 1 || len(args) > 2 || args[0] == "" {
+				return nil, false
+			}
+			item := ContentItem{Kind: ContentCounter, Value: args[0], Style: "decimal"}
+			if len(args) == 2 {
+				item.Style = strings.ToLower(args[1])
+			}
+			items = append(items, item)
+		case "counters":
+			if len(args) < 2 || len(args) > 3 || args[0] == "" || !isQuoted(args[1]) {
+				return nil, false
+			}
+			item := ContentItem{Kind: ContentCounters, Value: args[0], Separator: Unquote(args[1]), Style: "decimal"}
+			if len(args) == 3 {
+				item.Style = strings.ToLower(args[2])
+			}
+			items = append(items, item)
+		case "url":
+			if len(args) != 1 {
+				return nil, false
+			}
+			url := args[0]
+			if isQuoted(url) {
+				url = Unquote(url)
+			}
+			items = append(items, ContentItem{Kind: ContentURL, Value: url})
+		default:
+			return nil, false
+		}
+	}
+
+	return items, len(items) > 0
+}
+
+// DefaultQuotes are the quotation marks used when 'quotes' is not specified:
+// curly double quotes at the outer level and curly single quotes inside.
+var DefaultQuotes = [][2]string{{"“", "”"}, {"‘", "’"}}
+
+// ParseQuotes parses a 'quotes' property value into open/close pairs, outermost
+// first. 'none' yields no pairs; 'auto' and invalid values yield DefaultQuotes.
+// CSS 2.1 §12.3.1 Specifying quotes with the 'quotes' property
+func ParseQuotes(value string) [][2]string {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "none":
+		return nil
+	case "", "auto", "inherit":
+		return DefaultQuotes
+	}
+
+	components := splitComponents(value)
+	if len(components)%2 != 0 {
+		return DefaultQuotes
+	}
+
+	pairs := make([][2]string, 0, len(components)/2)
+	for i := 0; i < len(components); i += 2 {
+		if !isQuoted(components[i]) || !isQuoted(components[i+1]) {
+			return DefaultQuotes
+		}
+		pairs = append(pairs, [2]string{Unquote(components[i]), Unquote(components[i+1])})
+	}
+	return pairs
+}
+
+// CounterChange is a single counter name and integer from a 'counter-reset',
+// 'counter-increment' or 'counter-set' value.
+type CounterChange struct {
+	Name  string
+	Value int
+
+	// Reversed marks a reversed(name) counter in 'counter-reset'; list items
+	// in its scope count down instead of up.
+	// CSS Lists Level 3 §4.4 Creating counters: the counter-reset property
+	Reversed bool
+
+	// Auto is set for a reversed counter without an explicit value, whose
+	// start is computed from the number of items in its scope.
+	Auto bool
+}
+
+// ParseCounterChanges parses a 'counter-reset', 'counter-increment' or
+// 'counter-set' value: a list of counter names, each optionally followed by
+// an integer. Names without an integer get defaultValue (0 for resets and
+// sets, 1 for increments). 'none' and invalid values yield nil.
+// CSS 2.1 §12.4 Automatic counters and numbering
+func ParseCounterChanges(value string, defaultValue int) []CounterChange {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || strings.EqualFold(fields[0], "none") {
+		return nil
+	}
+
+	changes := make([]CounterChange, 0, len(fields))
+	for _, field := range fields {
+		if n, err := strconv.Atoi(field); err == nil {
+			if len(changes) == 0 {
+				return nil
+			}
+			changes[len(changes)-1].Value = n
+			changes[len(changes)-1].Auto = false
+			continue
+		}
+		if name, args, ok := splitFunction(field); ok && name == "reversed" {
+			if len(args) != 1 || args[0] == "" {
+				return nil
+			}
+			changes = append(changes, CounterChange{Name: args[0], Value: defaultValue, Reversed: true, Auto: true})
+			continue
+		}
+		changes = append(changes, CounterChange{Name: field, Value: defaultValue})
+	}
+	return changes
+}
+
+// ListMarkerText returns the marker string for a list item with the given
+// ordinal value and 'list-style-type': the counter representation followed
+// by the style's suffix, ". " for numeric and alphabetic styles and " " for
+// symbols. It returns "" for 'none'.
+// CSS Lists Level 3 §3.1 The ::marker pseudo-element,
+// CSS Counter Styles Level 3 §6 Simple predefined counter styles
+func ListMarkerText(value int, listStyleType string) string {
+	switch listStyleType {
+	case "none":
+		return ""
+	case "disc", "circle", "square":
+		return FormatCounter(value, listStyleType) + " "
+	}
+	return FormatCounter(value, listStyleType) + ". "
+}
+
+// IsBulletStyle reports whether a 'list-style-type' is one of the symbolic
+// styles disc, circle or square, which renderers typically paint as shapes.
+func IsBulletStyle(listStyleType string) bool {
+	return listStyleType == "disc" || listStyleType == "circle" || listStyleType == "square"
+}
+
+// FormatCounter renders a counter value in the given counter style.
+// Unknown styles fall back to decimal, and alphabetic and additive styles
+// fall back to decimal outside their range.
+// CSS 2.1 §12.6.2 Lists: the 'list-style-type' property,
+// CSS Counter Styles Level 3 §6 Simple predefined counter styles
+func FormatCounter(value int, style string) string {
+	switch style {
+	case "none":
+		return ""
+	case "disc":
+		return "•"
+	case "circle":
+		return "◦"
+	case "square":
+		return "▪"
+	case "decimal-leading-zero":
+		if value >= 0 && value < 10 {
+			return "0" + strconv.Itoa(value)
+		}
+		if value < 0 && value > -10 {
+			return "-0" + strconv.Itoa(-value)
+		}
+	case "lower-roman":
+		if roman := formatRoman(value); roman != "" {
+			return strings.ToLower(roman)
+		}
+	case "upper-roman":
+		if roman := formatRoman(value); roman != "" {
+			return roman
+		}
+	case "lower-alpha", "lower-latin":
+		if value >= 1 {
+			return formatAlphabetic(value, "abcdefghijklmnopqrstuvwxyz")
+		}
+	case "upper-alpha", "upper-latin":
+		if value >= 1 {
+			return formatAlphabetic(value, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+		}
+	case "lower-greek":
+		if value >= 1 {
+			return formatAlphabetic(value, "αβγδεζηθικλμνξοπρστυφχψω")
+		}
+	}
+	return strconv.Itoa(value)
+}
+
+// formatRoman formats 1-3999 as upper-case roman numerals.
+// CSS Counter Styles Level 3 §6.1 upper-roman (additive system)
+func formatRoman(value int) string {
+	if value < 1 || value > 3999 {
+		return ""
+	}
+
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"},
+		{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"},
+		{10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+
+	var b strings.Builder
+	for _, numeral := range numerals {
+		for value >= numeral.value {
+			b.WriteString(numeral.symbol)
+			value -= numeral.value
+		}
+	}
+	return b.String()
+}
+
+// formatAlphabetic formats a positive value in the alphabetic system:
+// a, b, ..., z, aa, ab, ...
+// CSS Counter Styles Level 3 §3.1.4 alphabetic
+func formatAlphabetic(value int, alphabet string) string {
+	symbols := []rune(alphabet)
+	n := len(symbols)
+
+	var result []rune
+	for value > 0 {
+		value--
+		result = append([]rune{symbols[value%n]}, result...)
+		value /= n
+	}
+	return string(result)
+}
+
+// Unquote removes the surrounding quotes from a CSS string and resolves its
+// escape sequences. Values that are not quoted are returned unchanged.
+// CSS 2.1 §4.1.3 Characters and case, §4.3.7 Strings
+func Unquote(s string) string {
+	if !isQuoted(s) {
+		return s
+	}
+	s = s[1 : len(s)-1]
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		// A backslash followed by a newline is a line continuation
+		if s[i] == '\n' {
+			continue
+		}
+
+		// Up to six hex digits name a code point, optionally followed by one space
+		j := i
+		for j < len(s) && j-i < 6 && isHexDigit(s[j]) {
+			j++
+		}
+		if j > i {
+			code, _ := strconv.ParseUint(s[i:j], 16, 32)
+			r := rune(code)
+			if r == 0 || !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			b.WriteRune(r)
+			if j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n') {
+				j++
+			}
+			i = j - 1
+			continue
+		}
+
+		// Any other escaped character stands for itself
+		_, size := utf8.DecodeRuneInString(s[i:])
+		b.WriteString(s[i : i+size])
+		i += size - 1
+	}
+	return b.String()
+}
+
+// quoteString wraps the raw contents of a string token in double quotes,
+// escaping any bare double quotes so the value can be re-tokenized.
+func quoteString(raw string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c == '\\' && i+1 < len(raw) {
+			b.WriteByte(c)
+			b.WriteByte(raw[i+1])
+			i++
+			continue
+		}
+		if c == '"' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isQuoted reports whether s is a complete single- or double-quoted string.
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// splitComponents splits a property value on whitespace and commas that are
+// outside of strings and parentheses.
+func splitComponents(value string) []string {
+	components := make([]string, 0)
+	start := -1
+	depth := 0
+	var quote byte
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth == 0 && (isSpaceByte(c) || c == ','):
+			if start >= 0 {
+				components = append(components, value[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		components = append(components, value[start:])
+	}
+	return components
+}
+
+// splitFunction splits a functional notation such as counters(item, ".")
+// into its lower-cased name and trimmed comma-separated arguments.
+func splitFunction(component string) (string, []string, bool) {
+	open := strings.IndexByte(component, '(')
+	if open <= 0 || !strings.HasSuffix(component, ")") {
+		return "", nil, false
+	}
+	name := strings.ToLower(component[:open])
+	inner := component[open+1 : len(component)-1]
+
+	args := make([]string, 0)
+	start := 0
+	var quote byte
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			args = append(args, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	args = append(args, strings.TrimSpace(inner[start:]))
+	if len(args) == 1 && args[0] == "" {
+		args = args[:0]
+	}
+	return name, args, true
+}
@@ -0,0 +1,196 @@
+package css
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseContent tests parsing of 'content' values.
+// CSS 2.1 §12.2 The 'content' property
+func TestParseContent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []ContentItem
+		ok       bool
+	}{
+		{`"→ "`, []ContentItem{{Kind: ContentString, Value: "→ "}}, true},
+		{`"a" attr(title) "b"`, []ContentItem{
+			{Kind: ContentString, Value: "a"},
+			{Kind: ContentAttr, Value: "title"},
+			{Kind: ContentString, Value: "b"},
+		}, true},
+		{`counter(item)`, []ContentItem{{Kind: ContentCounter, Value: "item", Style: "decimal"}}, true},
+		{`counter(item, upper-roman)`, []ContentItem{{Kind: ContentCounter, Value: "item", Style: "upper-roman"}}, true},
+		{`counters(item, ".") " "`, []ContentItem{
+			{Kind: ContentCounters, Value: "item", Separator: ".", Style: "decimal"},
+			{Kind: ContentString, Value: " "},
+		}, true},
+		{`open-quote close-quote no-open-quote no-close-quote`, []ContentItem{
+			{Kind: ContentOpenQuote}, {Kind: ContentCloseQuote},
+			{Kind: ContentNoOpenQuote}, {Kind: ContentNoCloseQuote},
+		}, true},
+		{`url("icon.png")`, []ContentItem{{Kind: ContentURL, Value: "icon.png"}}, true},
+		{`url(icon.png)`, []ContentItem{{Kind: ContentURL, Value: "icon.png"}}, true},
+		{`none`, nil, false},
+		{`normal`, nil, false},
+		{``, nil, false},
+		{`bogus`, nil, false},
+		{`counters(item)`, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			items, ok := ParseContent(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("ParseContent(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(items, tt.expected) {
+				t.Errorf("ParseContent(%q) = %+v, want %+v", tt.input, items, tt.expected)
+			}
+		})
+	}
+}
+
+// TestParseContentFromDeclaration checks that string values survive the
+// declaration parser with their quotes, so keywords and strings stay distinct.
+func TestParseContentFromDeclaration(t *testing.T) {
+	stylesheet := Parse(`p::before { content: 'say "hi"' open-quote "open-quote"; }`)
+	if len(stylesheet.Rules) != 1 || len(stylesheet.Rules[0].Declarations) != 1 {
+		t.Fatalf("Expected 1 rule with 1 declaration")
+	}
+
+	items, ok := ParseContent(stylesheet.Rules[0].Declarations[0].Value)
+	if !ok {
+		t.Fatalf("Failed to parse content %q", stylesheet.Rules[0].Declarations[0].Value)
+	}
+	expected := []ContentItem{
+		{Kind: ContentString, Value: `say "hi"`},
+		{Kind: ContentOpenQuote},
+		{Kind: ContentString, Value: "open-quote"},
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Got %+v, want %+v", items, expected)
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"plain"`, "plain"},
+		{`'single'`, "single"},
+		{`"\201C"`, "“"},
+		{`"\201C x"`, "“x"},
+		{`"a\"b"`, `a"b`},
+		{`"line\A break"`, "line\nbreak"},
+		{`unquoted`, "unquoted"},
+	}
+
+	for _, tt := range tests {
+		if got := Unquote(tt.input); got != tt.expected {
+			t.Errorf("Unquote(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestParseQuotes tests the 'quotes' property.
+// CSS 2.1 §12.3.1 Specifying quotes with the 'quotes' property
+func TestParseQuotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected [][2]string
+	}{
+		{`"«" "»" "<" ">"`, [][2]string{{"«", "»"}, {"<", ">"}}},
+		{`none`, nil},
+		{``, DefaultQuotes},
+		{`auto`, DefaultQuotes},
+		{`"only-one"`, DefaultQuotes},
+	}
+
+	for _, tt := range tests {
+		if got := ParseQuotes(tt.input); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseQuotes(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestParseCounterChanges tests 'counter-reset' and 'counter-increment' values.
+// CSS 2.1 §12.4 Automatic counters and numbering
+func TestParseCounterChanges(t *testing.T) {
+	tests := []struct {
+		input        string
+		defaultValue int
+		expected     []CounterChange
+	}{
+		{"item", 1, []CounterChange{{Name: "item", Value: 1}}},
+		{"item", 0, []CounterChange{{Name: "item", Value: 0}}},
+		{"chapter 2 section", 0, []CounterChange{{Name: "chapter", Value: 2}, {Name: "section", Value: 0}}},
+		{"item -1", 1, []CounterChange{{Name: "item", Value: -1}}},
+		{"none", 1, nil},
+		{"", 1, nil},
+		{"3 item", 1, nil},
+		{"reversed(list-item)", 0, []CounterChange{{Name: "list-item", Reversed: true, Auto: true}}},
+		{"reversed(list-item) 5", 0, []CounterChange{{Name: "list-item", Value: 5, Reversed: true}}},
+	}
+
+	for _, tt := range tests {
+		got := ParseCounterChanges(tt.input, tt.defaultValue)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseCounterChanges(%q, %d) = %+v, want %+v", tt.input, tt.defaultValue, got, tt.expected)
+		}
+	}
+}
+
+// TestFormatCounter tests counter styles.
+// CSS Counter Styles Level 3 §6 Simple predefined counter styles
+func TestFormatCounter(t *testing.T) {
+	tests := []struct {
+		value    int
+		style    string
+		expected string
+	}{
+		{3, "decimal", "3"},
+		{-2, "decimal", "-2"},
+		{7, "decimal-leading-zero", "07"},
+		{12, "decimal-leading-zero", "12"},
+		{4, "lower-roman", "iv"},
+		{1994, "upper-roman", "MCMXCIV"},
+		{0, "upper-roman", "0"},
+		{1, "lower-alpha", "a"},
+		{27, "lower-alpha", "aa"},
+		{26, "upper-latin", "Z"},
+		{2, "lower-greek", "β"},
+		{5, "disc", "•"},
+		{5, "none", ""},
+		{5, "unknown-style", "5"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatCounter(tt.value, tt.style); got != tt.expected {
+			t.Errorf("FormatCounter(%d, %q) = %q, want %q", tt.value, tt.style, got, tt.expected)
+		}
+	}
+}
+
+// TestListMarkerText tests marker strings with their suffixes.
+// CSS Lists Level 3 §3.1 The ::marker pseudo-element
+func TestListMarkerText(t *testing.T) {
+	tests := []struct {
+		value    int
+		style    string
+		expected string
+	}{
+		{1, "decimal", "1. "},
+		{3, "lower-alpha", "c. "},
+		{9, "upper-roman", "IX. "},
+		{1, "square", "▪ "},
+		{1, "none", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ListMarkerText(tt.value, tt.style); got != tt.expected {
+			t.Errorf("ListMarkerText(%d, %q) = %q, want %q", tt.value, tt.style, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package css
+
+// This file contains the model and descriptor parsing for @font-face rules
+// and the font-family property.
+//
+// Spec references:
+// - CSS Fonts Level 4 §4 Font Resources: https://www.w3.org/TR/css-fonts-4/#font-resources
+// - CSS 2.1 §15.3 Font family: https://www.w3.org/TR/CSS21/fonts.html#font-family-prop
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FontFace represents an @font-face rule.
+// CSS Fonts Level 4 §4.1 The @font-face rule
+type FontFace struct {
+	// Declarations holds the rule's descriptors, such as font-family and src.
+	Declarations []*Declaration
+
+	// Media holds the media query lists of enclosing @media rules, as for
+	// Rule.Media.
+	Media []*MediaQueryList
+
+	// BaseURL is the URL relative src URLs are resolved against. The parser
+	// leaves it empty; stylesheet loaders set it to the stylesheet's URL.
+	BaseURL string
+}
+
+// Descriptor returns the value of the last declaration of the named
+// descriptor, or "" if there is none.
+func (f *FontFace) Descriptor(name string) string {
+	value := ""
+	for _, decl := range f.Declarations {
+		if strings.EqualFold(decl.Property, name) {
+			value = strings.TrimSpace(decl.Value)
+		}
+	}
+	return value
+}
+
+// MatchesMedia reports whether every @media rule enclosing f matches env.
+func (f *FontFace) MatchesMedia(env MediaEnvironment) bool {
+	for _, media := range f.Media {
+		if !media.Matches(env) {
+			return false
+		}
+	}
+	return true
+}
+
+// FontSource is one entry of an @font-face src list: either a url() with
+// optional format() hint, or a local() font name.
+// CSS Fonts Level 4 §4.3 Font reference: the src descriptor
+type FontSource struct {
+	URL    string // Unresolved URL, empty for local()
+	Format string // Lower-cased format() hint such as "woff2", or ""
+	Local  string // Full font name from local(), empty for url()
+}
+
+// ParseFontSources parses the value of an @font-face src descriptor.
+// Entries that cannot be parsed are dropped.
+func ParseFontSources(value string) []FontSource {
+	sources := make([]FontSource, 0)
+	for _, entry := range splitCommas(value) {
+		parts := splitComponents(entry)
+		if len(parts) == 0 {
+			continue
+		}
+
+		// url() is not split on commas, which data URLs contain
+		var source FontSource
+		first := parts[0]
+		if len(first) > 5 && strings.EqualFold(first[:4], "url(") && strings.HasSuffix(first, ")") {
+			source.URL = Unquote(strings.TrimSpace(first[4 : len(first)-1]))
+		} else if name, args, ok := splitFunction(first); ok && name == "local" && len(args) == 1 {
+			source.Local = Unquote(args[0])
+		} else {
+			continue
+		}
+
+		for _, part := range parts[1:] {
+			hint, hintArgs, ok := splitFunction(part)
+			if ok && hint == "format" && len(hintArgs) > 0 {
+				source.Format = strings.ToLower(Unquote(hintArgs[0]))
+			}
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// UnicodeRange is an inclusive range of code points.
+// CSS Fonts Level 4 §4.5 Character range: the unicode-range descriptor
+type UnicodeRange struct {
+	Start, End rune
+}
+
+// ParseUnicodeRange parses a unicode-range descriptor such as
+// "U+0000-00FF, U+0131, U+4??". It returns nil, meaning every code point,
+// for an empty or invalid value.
+func ParseUnicodeRange(value string) []UnicodeRange {
+	ranges := make([]UnicodeRange, 0)
+	for _, entry := range splitCommas(value) {
+		entry = strings.ToUpper(strings.TrimSpace(entry))
+		if !strings.HasPrefix(entry, "U+") {
+			return nil
+		}
+		entry = entry[2:]
+
+		var start, end string
+		if dash := strings.IndexByte(entry, '-'); dash >= 0 {
+			start, end = entry[:dash], entry[dash+1:]
+		} else if strings.Contains(entry, "?") {
+			// Wildcards: U+4?? is U+400-4FF
+			start = strings.ReplaceAll(entry, "?", "0")
+			end = strings.ReplaceAll(entry, "?", "F")
+		} else {
+			start, end = entry, entry
+		}
+
+		first, err1 := strconv.ParseUint(start, 16, 32)
+		last, err2 := strconv.ParseUint(end, 16, 32)
+		if err1 != nil || err2 != nil || len(start) > 6 || len(end) > 6 || first > last {
+			return nil
+		}
+		ranges = append(ranges, UnicodeRange{Start: rune(first), End: rune(min(last, 0x10FFFF))})
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	return ranges
+}
+
+// ContainsRune reports whether r is in any of the ranges. A nil list
+// contains every code point.
+func ContainsRune(ranges []UnicodeRange, r rune) bool {
+	if ranges == nil {
+		return true
+	}
+	for _, ur := range ranges {
+		if r >= ur.Start && r <= ur.End {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseFontFamilies splits a font-family value into family names, without
+// quotes. Unquoted names made of several identifiers are joined by single
+// spaces.
+// CSS 2.1 §15.3 Font family: the 'font-family' property
+func ParseFontFamilies(value string) []string {
+	families := make([]string, 0)
+	for _, entry := range splitCommas(value) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if isQuoted(entry) {
+			families = append(families, Unquote(entry))
+			continue
+		}
+		families = append(families, strings.Join(strings.Fields(entry), " "))
+	}
+	return families
+}
+
+// splitCommas splits a value on commas outside strings and parentheses.
+func splitCommas(value string) []string {
+	parts := make([]string, 0)
+	start := 0
+	depth := 0
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case c == ',' && depth == 0:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	if strings.TrimSpace(value[start:]) != "" || len(parts) > 0 {
+		parts = append(parts, value[start:])
+	}
+	return parts
+}
@@ -0,0 +1,91 @@
+package css
+
+import "testing"
+
+// TestParseFontSources tests parsing of the @font-face src descriptor.
+// CSS Fonts Level 4 §4.3 Font reference: the src descriptor
+func TestParseFontSources(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []FontSource
+	}{
+		{`url(a.woff2) format("woff2")`, []FontSource{{URL: "a.woff2", Format: "woff2"}}},
+		{`local("Helvetica Neue"), url("b.ttf") format(TrueType)`, []FontSource{{Local: "Helvetica Neue"}, {URL: "b.ttf", Format: "truetype"}}},
+		{`url(data:font/ttf;base64,AA,BB)`, []FontSource{{URL: "data:font/ttf;base64,AA,BB"}}},
+		{`url( 'c.otf' ), bogus, url(d.woff)`, []FontSource{{URL: "c.otf"}, {URL: "d.woff"}}},
+		{``, []FontSource{}},
+	}
+
+	for _, tt := range tests {
+		got := ParseFontSources(tt.value)
+		if len(got) != len(tt.expected) {
+			t.Errorf("ParseFontSources(%q) = %+v, want %+v", tt.value, got, tt.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("ParseFontSources(%q) = %+v, want %+v", tt.value, got, tt.expected)
+				break
+			}
+		}
+	}
+}
+
+// TestParseUnicodeRange tests parsing of the unicode-range descriptor.
+// CSS Fonts Level 4 §4.5 Character range: the unicode-range descriptor
+func TestParseUnicodeRange(t *testing.T) {
+	tests := []struct {
+		value    string
+		contains []rune
+		excludes []rune
+	}{
+		{"U+0000-00FF", []rune{'A', 0xFF}, []rune{0x100}},
+		{"U+0131, U+4??", []rune{0x131, 0x400, 0x4FF}, []rune{0x130, 0x500}},
+		{"u+30-39", []rune{'0', '9'}, []rune{'A'}},
+		{"", []rune{'A', 0x10FFFF}, nil},
+		{"U+ZZZ", []rune{'A'}, nil},
+		{"U+200-100", []rune{'A'}, nil},
+	}
+
+	for _, tt := range tests {
+		ranges := ParseUnicodeRange(tt.value)
+		for _, r := range tt.contains {
+			if !ContainsRune(ranges, r) {
+				t.Errorf("ParseUnicodeRange(%q) should contain U+%04X", tt.value, r)
+			}
+		}
+		for _, r := range tt.excludes {
+			if ContainsRune(ranges, r) {
+				t.Errorf("ParseUnicodeRange(%q) should not contain U+%04X", tt.value, r)
+			}
+		}
+	}
+}
+
+// TestParseFontFamilies tests splitting of font-family lists.
+// CSS 2.1 §15.3 Font family: the 'font-family' property
+func TestParseFontFamilies(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{"serif", []string{"serif"}},
+		{`"Open Sans", Arial,  sans-serif`, []string{"Open Sans", "Arial", "sans-serif"}},
+		{"Times   New Roman, 'Comma, Inc'", []string{"Times New Roman", "Comma, Inc"}},
+		{"", []string{}},
+	}
+
+	for _, tt := range tests {
+		got := ParseFontFamilies(tt.value)
+		if len(got) != len(tt.expected) {
+			t.Errorf("ParseFontFamilies(%q) = %q, want %q", tt.value, got, tt.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("ParseFontFamilies(%q) = %q, want %q", tt.value, got, tt.expected)
+				break
+			}
+		}
+	}
+}
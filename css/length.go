@@ -0,0 +1,198 @@
+package css
+
+// This file contains the <length> and <percentage> value types shared by
+// style computation and layout.
+//
+// Spec references:
+// - CSS 2.1 §4.3.2 Lengths: https://www.w3.org/TR/CSS21/syndata.html#length-units
+// - CSS Values and Units Level 4 §6 Distance Units: https://www.w3.org/TR/css-values-4/#lengths
+// - CSS Values and Units Level 4 §4.3 Percentages: https://www.w3.org/TR/css-values-4/#percentages
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Length is a CSS <length> or <percentage>, a number with a unit.
+// CSS Values and Units Level 4 §6 Distance Units
+type Length struct {
+	Value float64
+	Unit  string // Lowercase unit, "%" for percentages, "" for unitless numbers
+
+	// Calc is the expression of a math function such as calc(); Value and
+	// Unit are then unused.
+	Calc *Calc
+}
+
+// LengthContext holds the sizes relative lengths are resolved against.
+// CSS Values and Units Level 4 §6.1 Relative Lengths
+type LengthContext struct {
+	FontSize       float64 // Computed font size of the element (em, ex, ch)
+	RootFontSize   float64 // Computed font size of the root element (rem)
+	PercentBase    float64 // Size percentages refer to, such as the containing block width
+	ViewportWidth  float64 // Width of the initial containing block (vw)
+	ViewportHeight float64 // Height of the initial containing block (vh)
+}
+
+// DefaultLengthContext returns a context with the initial font size and the
+// default viewport, for lengths resolved outside of an element.
+func DefaultLengthContext() LengthContext {
+	env := DefaultMediaEnvironment()
+	return LengthContext{
+		FontSize:       BaseFontHeight,
+		RootFontSize:   BaseFontHeight,
+		ViewportWidth:  env.Width,
+		ViewportHeight: env.Height,
+	}
+}
+
+// unitsPerInch maps the absolute length units to how many of them make an
+// inch.
+// CSS Values and Units Level 4 §6.2 Absolute Lengths: 1in = 96px
+var unitsPerInch = map[string]float64{
+	"px": 96,
+	"in": 1,
+	"cm": 2.54,
+	"mm": 25.4,
+	"q":  101.6,
+	"pt": 72,
+	"pc": 6,
+}
+
+// ParseLength parses a length or percentage such as "1.5em", "50%", "0" or
+// "calc(100% - 2em)". Unitless numbers are accepted, as lengths in pixels,
+// as the existing pages this browser renders rely on (quirks mode), but
+// math functions must have a length or percentage type. It returns false
+// for keywords such as "auto" and for unknown units.
+func ParseLength(value string) (Length, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if isMathFunction(value) {
+		c, ok := parseCalc(value)
+		if !ok || c.typ == mathNumber {
+			return Length{}, false
+		}
+		return Length{Calc: c}, true
+	}
+	return parseDimension(value)
+}
+
+// parseDimension parses a lowercase number, dimension or percentage.
+func parseDimension(value string) (Length, bool) {
+	end := len(value)
+	for end > 0 && !isDigitOrPoint(value[end-1]) {
+		end--
+	}
+	number, unit := value[:end], value[end:]
+	if number == "" {
+		return Length{}, false
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return Length{}, false
+	}
+	length := Length{Value: n, Unit: unit}
+	if unit != "" && unit != "%" && !length.IsRelative() && unitsPerInch[unit] == 0 {
+		return Length{}, false
+	}
+	return length, true
+}
+
+// isDigitOrPoint reports whether c ends the number of a dimension.
+func isDigitOrPoint(c byte) bool {
+	return c >= '0' && c <= '9' || c == '.'
+}
+
+// IsRelative reports whether the length depends on a font or the
+// viewport, so that its computed value differs from the specified one.
+// Percentages are not relative lengths.
+// CSS Values and Units Level 4 §6.1 Relative Lengths
+func (l Length) IsRelative() bool {
+	if l.Calc != nil {
+		return l.Calc.isRelative()
+	}
+	switch l.Unit {
+	case "em", "rem", "ex", "ch", "vw", "vh", "vmin", "vmax":
+		return true
+	}
+	return false
+}
+
+// HasPercentage reports whether the length is or holds a percentage, so
+// that it is resolved at used-value time.
+func (l Length) HasPercentage() bool {
+	if l.Calc != nil {
+		return l.Calc.hasPercentage()
+	}
+	return l.Unit == "%"
+}
+
+// Resolve returns the length in pixels.
+// CSS Values and Units Level 4 §6.1.1 Font-relative Lengths, §6.1.2
+// Viewport-percentage Lengths
+func (l Length) Resolve(ctx LengthContext) float64 {
+	if l.Calc != nil {
+		// §10.9: a NaN result is censored to zero
+		if px := l.Calc.resolve(ctx); !math.IsNaN(px) {
+			return px
+		}
+		return 0
+	}
+	switch l.Unit {
+	case "", "px":
+		return l.Value
+	case "%":
+		return l.Value * ctx.PercentBase / 100
+	case "em":
+		return l.Value * ctx.FontSize
+	case "rem":
+		return l.Value * ctx.RootFontSize
+	case "ex", "ch":
+		// §6.1.1: when the x-height or the advance of "0" cannot be
+		// measured, 0.5em is assumed
+		return l.Value * ctx.FontSize / 2
+	case "vw":
+		return l.Value * ctx.ViewportWidth / 100
+	case "vh":
+		return l.Value * ctx.ViewportHeight / 100
+	case "vmin":
+		return l.Value * min(ctx.ViewportWidth, ctx.ViewportHeight) / 100
+	case "vmax":
+		return l.Value * max(ctx.ViewportWidth, ctx.ViewportHeight) / 100
+	}
+	return l.Value * 96 / unitsPerInch[l.Unit]
+}
+
+// Compute returns the computed value of the length: font- and
+// viewport-relative lengths and math functions without percentages become
+// pixels. Math functions with percentages, which need the containing
+// block, are simplified.
+// CSS Values and Units Level 4 §6.1, §10.10 Computed Value
+func (l Length) Compute(ctx LengthContext) Length {
+	if l.Calc == nil && !l.IsRelative() {
+		return l
+	}
+	if !l.HasPercentage() {
+		return Length{Value: l.Resolve(ctx), Unit: "px"}
+	}
+	c := l.Calc.compute(ctx)
+	if c.op == "" {
+		return c.value
+	}
+	return Length{Calc: c}
+}
+
+// String serializes the length, such as "12.5px" or "calc(50% - 2px)".
+func (l Length) String() string {
+	if l.Calc != nil {
+		return l.Calc.String()
+	}
+	return formatNumber(l.Value) + l.Unit
+}
+
+// FormatPixels formats a number of pixels as a length, such as "19.5px",
+// rounded to a millionth of a pixel so that floating-point error from unit
+// conversions does not show.
+func FormatPixels(px float64) string {
+	return formatNumber(px) + "px"
+}
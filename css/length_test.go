@@ -0,0 +1,124 @@
+package css
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Length
+		ok       bool
+	}{
+		{"10px", Length{Value: 10, Unit: "px"}, true},
+		{"1.5em", Length{Value: 1.5, Unit: "em"}, true},
+		{"-2REM", Length{Value: -2, Unit: "rem"}, true},
+		{" 50% ", Length{Value: 50, Unit: "%"}, true},
+		{"0", Length{Value: 0, Unit: ""}, true},
+		{".5in", Length{Value: 0.5, Unit: "in"}, true},
+		{"3Q", Length{Value: 3, Unit: "q"}, true},
+		{"100vmax", Length{Value: 100, Unit: "vmax"}, true},
+		{"auto", Length{}, false},
+		{"", Length{}, false},
+		{"px", Length{}, false},
+		{"10furlongs", Length{}, false},
+		{"1.2.3px", Length{}, false},
+	}
+
+	for _, tt := range tests {
+		length, ok := ParseLength(tt.input)
+		if ok != tt.ok || length != tt.expected {
+			t.Errorf("ParseLength(%q) = %v, %v, expected %v, %v", tt.input, length, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestLengthResolve(t *testing.T) {
+	ctx := LengthContext{
+		FontSize:       20,
+		RootFontSize:   10,
+		PercentBase:    300,
+		ViewportWidth:  800,
+		ViewportHeight: 600,
+	}
+
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"12px", 12},
+		{"12", 12},
+		{"1in", 96},
+		{"2.54cm", 96},
+		{"25.4mm", 96},
+		{"101.6q", 96},
+		{"72pt", 96},
+		{"6pc", 96},
+		{"1.5em", 30},
+		{"1.5rem", 15},
+		{"2ex", 20},
+		{"2ch", 20},
+		{"10%", 30},
+		{"10vw", 80},
+		{"10vh", 60},
+		{"10vmin", 60},
+		{"10vmax", 80},
+	}
+
+	for _, tt := range tests {
+		length, ok := ParseLength(tt.input)
+		if !ok {
+			t.Fatalf("ParseLength(%q) failed", tt.input)
+		}
+		if got := length.Resolve(ctx); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("Resolve(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// TestResolveFontSize tests that relative font sizes refer to the parent's
+// font size, and rem and viewport units to the context.
+// CSS Fonts Level 4 §2.5
+func TestResolveFontSize(t *testing.T) {
+	ctx := LengthContext{RootFontSize: 10, ViewportWidth: 1000, ViewportHeight: 500}
+
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"2em", 40},
+		{"150%", 30},
+		{"1ex", 10},
+		{"2rem", 20},
+		{"2vw", 20},
+		{"12pt", 16},
+		{"larger", 24},
+		{"smaller", 20 / 1.2},
+		{"large", 16},
+		{"0em", 0},
+		{"-1em", 0},
+		{"inherit", 0},
+	}
+
+	for _, tt := range tests {
+		if got := ResolveFontSize(tt.input, 20, ctx); math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("ResolveFontSize(%q, 20) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatPixels(t *testing.T) {
+	tests := map[float64]string{
+		16:               "16px",
+		19.5:             "19.5px",
+		1.17 * 13:        "15.21px",
+		-2.25:            "-2.25px",
+		96 / 2.54 * 2.54: "96px",
+	}
+	for px, expected := range tests {
+		if got := FormatPixels(px); got != expected {
+			t.Errorf("FormatPixels(%v) = %q, expected %q", px, got, expected)
+		}
+	}
+}
@@ -0,0 +1,718 @@
+package css
+
+// This file contains parsing and evaluation of media queries, used by @media
+// rules, @import and the media attribute of <link> and <style>.
+//
+// Spec references:
+// - CSS 2.1 §7 Media types: https://www.w3.org/TR/CSS21/media.html
+// - Media Queries Level 4: https://www.w3.org/TR/mediaqueries-4/
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MediaEnvironment describes the device a stylesheet is applied to.
+// Media Queries Level 4 §2.3 Media Types, §4 Media Features
+type MediaEnvironment struct {
+	Type        string  // Media type: "screen" or "print"
+	Width       float64 // Viewport width in CSS pixels
+	Height      float64 // Viewport height in CSS pixels
+	ColorScheme string  // Preferred color scheme: "light" or "dark"
+	Resolution  float64 // Device pixels per CSS pixel (dppx)
+}
+
+// DefaultMediaEnvironment returns an 800x600 light-mode screen, matching the
+// default viewport of the browser.
+func DefaultMediaEnvironment() MediaEnvironment {
+	return MediaEnvironment{
+		Type:        "screen",
+		Width:       800,
+		Height:      600,
+		ColorScheme: "light",
+		Resolution:  1,
+	}
+}
+
+// MediaQueryList is a comma-separated list of media queries. It matches if
+// any of its queries match; an empty list matches every environment.
+// Media Queries Level 4 §2 Media Queries
+type MediaQueryList struct {
+	Queries []*MediaQuery
+}
+
+// MediaQuery is a single media query such as "screen and (min-width: 600px)".
+// Media Queries Level 4 §2.1 Combining Media Queries
+type MediaQuery struct {
+	Not  bool   // Query is negated with 'not'
+	Type string // Media type, "all" if omitted
+
+	// condition is nil when the query only tests the media type.
+	condition mediaCondition
+
+	// text is the query as written, for diagnostics.
+	text string
+}
+
+// String returns the media query list as written, queries joined by ", ".
+func (l *MediaQueryList) String() string {
+	if l == nil {
+		return ""
+	}
+	texts := make([]string, len(l.Queries))
+	for i, query := range l.Queries {
+		texts[i] = query.text
+	}
+	return strings.Join(texts, ", ")
+}
+
+// Matches reports whether any query in the list matches env. A nil or empty
+// list matches everything.
+// Media Queries Level 4 §2.1: A media query list is true if any of its
+// component media queries are true
+func (l *MediaQueryList) Matches(env MediaEnvironment) bool {
+	if l == nil || len(l.Queries) == 0 {
+		return true
+	}
+	for _, query := range l.Queries {
+		if query.Matches(env) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the query matches env.
+func (q *MediaQuery) Matches(env MediaEnvironment) bool {
+	result := q.Type == "all" || strings.EqualFold(q.Type, env.Type)
+	if result && q.condition != nil {
+		result = q.condition.matches(env)
+	}
+	if q.Not {
+		return !result
+	}
+	return result
+}
+
+// ParseMediaQueryList parses a media query list such as the prelude of an
+// @media rule or the media attribute of a <link>. Queries that cannot be
+// parsed become "not all" and never match, without affecting the rest of
+// the list.
+// Media Queries Level 4 §3.1 Error Handling
+func ParseMediaQueryList(input string) *MediaQueryList {
+	list := &MediaQueryList{Queries: make([]*MediaQuery, 0)}
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return list
+	}
+
+	for _, text := range splitMediaQueries(input) {
+		text = strings.TrimSpace(text)
+		query := parseMediaQuery(text)
+		if query == nil {
+			query = &MediaQuery{Not: true, Type: "all"}
+		}
+		query.text = text
+		list.Queries = append(list.Queries, query)
+	}
+	return list
+}
+
+// splitMediaQueries splits a media query list on commas outside parentheses.
+func splitMediaQueries(input string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	start := 0
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, input[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, input[start:])
+}
+
+// mediaCondition is a node of a parsed <media-condition>.
+type mediaCondition interface {
+	matches(env MediaEnvironment) bool
+}
+
+// mediaNot is "not <media-in-parens>".
+type mediaNot struct {
+	operand mediaCondition
+}
+
+func (c mediaNot) matches(env MediaEnvironment) bool {
+	return !c.operand.matches(env)
+}
+
+// mediaAnd is "<media-in-parens> and <media-in-parens> ...".
+type mediaAnd []mediaCondition
+
+func (c mediaAnd) matches(env MediaEnvironment) bool {
+	for _, operand := range c {
+		if !operand.matches(env) {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaOr is "<media-in-parens> or <media-in-parens> ...".
+type mediaOr []mediaCondition
+
+func (c mediaOr) matches(env MediaEnvironment) bool {
+	for _, operand := range c {
+		if operand.matches(env) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaUnknown is a <general-enclosed> or unsupported feature; it is false.
+// Media Queries Level 4 §3.2 Evaluating Media Queries
+type mediaUnknown struct{}
+
+func (mediaUnknown) matches(MediaEnvironment) bool {
+	return false
+}
+
+// mediaTokenKind identifies a token of the media query lexer.
+type mediaTokenKind int
+
+const (
+	mediaEOF mediaTokenKind = iota
+	mediaIdent
+	mediaNumber // number with an optional unit
+	mediaLeftParen
+	mediaRightParen
+	mediaColon
+	mediaDelim // <, >, =, <=, >=, /
+)
+
+type mediaToken struct {
+	kind  mediaTokenKind
+	text  string  // identifier (lower-cased), delimiter or unit
+	value float64 // numeric value of a mediaNumber
+}
+
+// tokenizeMedia splits a single media query into tokens. Identifiers and
+// units are lower-cased since media queries are ASCII case-insensitive.
+func tokenizeMedia(input string) []mediaToken {
+	tokens := make([]mediaToken, 0)
+	for i := 0; i < len(input); {
+		c := input[i]
+		switch {
+		case isSpaceByte(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, mediaToken{kind: mediaLeftParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, mediaToken{kind: mediaRightParen, text: ")"})
+			i++
+		case c == ':':
+			tokens = append(tokens, mediaToken{kind: mediaColon, text: ":"})
+			i++
+		case (c == '<' || c == '>') && i+1 < len(input) && input[i+1] == '=':
+			tokens = append(tokens, mediaToken{kind: mediaDelim, text: input[i : i+2]})
+			i += 2
+		case c == '<' || c == '>' || c == '=' || c == '/':
+			tokens = append(tokens, mediaToken{kind: mediaDelim, text: string(c)})
+			i++
+		case c >= '0' && c <= '9' || c == '.' || ((c == '-' || c == '+') && i+1 < len(input) && (input[i+1] >= '0' && input[i+1] <= '9' || input[i+1] == '.')):
+			start := i
+			i++
+			for i < len(input) && (input[i] >= '0' && input[i] <= '9' || input[i] == '.') {
+				i++
+			}
+			value, _ := strconv.ParseFloat(input[start:i], 64)
+			unitStart := i
+			for i < len(input) && (isNameChar(rune(input[i])) || input[i] == '%') {
+				i++
+			}
+			tokens = append(tokens, mediaToken{kind: mediaNumber, value: value, text: strings.ToLower(input[unitStart:i])})
+		case isNameStart(rune(c)) || c == '-':
+			start := i
+			for i < len(input) && isNameChar(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, mediaToken{kind: mediaIdent, text: strings.ToLower(input[start:i])})
+		default:
+			// Anything else can only appear inside <general-enclosed>
+			tokens = append(tokens, mediaToken{kind: mediaDelim, text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// mediaParser is a recursive-descent parser over the tokens of one query.
+type mediaParser struct {
+	tokens []mediaToken
+	pos    int
+}
+
+func (p *mediaParser) peek() mediaToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return mediaToken{kind: mediaEOF}
+}
+
+func (p *mediaParser) next() mediaToken {
+	token := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return token
+}
+
+func (p *mediaParser) peekIdent(name string) bool {
+	token := p.peek()
+	return token.kind == mediaIdent && token.text == name
+}
+
+// parseMediaQuery parses a single <media-query>, returning nil if it is
+// invalid.
+// Media Queries Level 4 §3 Syntax:
+//
+//	<media-query> = <media-condition>
+//	              | [ not | only ]? <media-type> [ and <media-condition-without-or> ]?
+func parseMediaQuery(text string) *MediaQuery {
+	p := &mediaParser{tokens: tokenizeMedia(text)}
+	query := &MediaQuery{Type: "all"}
+
+	if p.peek().kind == mediaLeftParen || (p.peekIdent("not") && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].kind == mediaLeftParen) {
+		condition := p.parseCondition(true)
+		if condition == nil || p.peek().kind != mediaEOF {
+			return nil
+		}
+		query.condition = condition
+		return query
+	}
+
+	if p.peekIdent("not") {
+		query.Not = true
+		p.next()
+	} else if p.peekIdent("only") {
+		p.next()
+	}
+
+	typeToken := p.next()
+	if typeToken.kind != mediaIdent {
+		return nil
+	}
+	switch typeToken.text {
+	case "and", "or", "not", "only", "layer":
+		return nil
+	}
+	query.Type = typeToken.text
+
+	if p.peekIdent("and") {
+		p.next()
+		query.condition = p.parseCondition(false)
+		if query.condition == nil {
+			return nil
+		}
+	}
+	if p.peek().kind != mediaEOF {
+		return nil
+	}
+	return query
+}
+
+// parseCondition parses a <media-condition>, or a
+// <media-condition-without-or> if allowOr is false. 'and' and 'or' cannot be
+// mixed at the same level without parentheses.
+func (p *mediaParser) parseCondition(allowOr bool) mediaCondition {
+	if p.peekIdent("not") {
+		p.next()
+		operand := p.parseInParens()
+		if operand == nil {
+			return nil
+		}
+		return mediaNot{operand: operand}
+	}
+
+	first := p.parseInParens()
+	if first == nil {
+		return nil
+	}
+
+	switch {
+	case p.peekIdent("and"):
+		and := mediaAnd{first}
+		for p.peekIdent("and") {
+			p.next()
+			operand := p.parseInParens()
+			if operand == nil {
+				return nil
+			}
+			and = append(and, operand)
+		}
+		return and
+	case allowOr && p.peekIdent("or"):
+		or := mediaOr{first}
+		for p.peekIdent("or") {
+			p.next()
+			operand := p.parseInParens()
+			if operand == nil {
+				return nil
+			}
+			or = append(or, operand)
+		}
+		return or
+	}
+	return first
+}
+
+// parseInParens parses a <media-in-parens>: a parenthesized condition, a
+// media feature, or a <general-enclosed> that evaluates to false.
+func (p *mediaParser) parseInParens() mediaCondition {
+	if p.peek().kind != mediaLeftParen {
+		return nil
+	}
+	p.next()
+
+	// Nested condition: "((min-width: 1px) or (orientation: portrait))"
+	if p.peek().kind == mediaLeftParen || p.peekIdent("not") {
+		start := p.pos
+		if condition := p.parseCondition(true); condition != nil && p.peek().kind == mediaRightParen {
+			p.next()
+			return condition
+		}
+		p.pos = start
+	}
+
+	// Collect the tokens up to the matching ')'
+	depth := 0
+	start := p.pos
+	for {
+		token := p.next()
+		switch token.kind {
+		case mediaEOF:
+			return nil
+		case mediaLeftParen:
+			depth++
+			continue
+		case mediaRightParen:
+			if depth > 0 {
+				depth--
+				continue
+			}
+		default:
+			continue
+		}
+		break
+	}
+
+	feature := parseMediaFeature(p.tokens[start : p.pos-1])
+	if feature == nil {
+		return mediaUnknown{}
+	}
+	return feature
+}
+
+// mediaValue is the value of a media feature: a length, number, ratio,
+// resolution or keyword.
+type mediaValue struct {
+	number  float64 // Numeric value, converted to px, dppx or a ratio
+	keyword string  // Keyword value such as "landscape"; empty for numbers
+	kind    string  // "length", "resolution", "ratio", "number" or "keyword"
+}
+
+// mediaFeature is a media feature test such as (min-width: 600px) or
+// (400px <= width < 800px).
+// Media Queries Level 4 §2.4 Media Features, §2.4.3 Range context
+type mediaFeature struct {
+	name string
+
+	// comparisons are the range tests, each "feature op value". A plain
+	// (name: value) test is a single "=" comparison. Empty for a boolean
+	// context test such as (color).
+	comparisons []mediaComparison
+}
+
+type mediaComparison struct {
+	op    string // "<", "<=", ">", ">=" or "="
+	value mediaValue
+}
+
+// parseMediaFeature parses the tokens between the parentheses of a media
+// feature, returning nil for anything that is not a valid feature.
+func parseMediaFeature(tokens []mediaToken) *mediaFeature {
+	switch {
+	case len(tokens) == 1 && tokens[0].kind == mediaIdent:
+		// Boolean context: (color)
+		return &mediaFeature{name: tokens[0].text}
+
+	case len(tokens) >= 3 && tokens[0].kind == mediaIdent && tokens[1].kind == mediaColon:
+		// Plain context: (min-width: 600px)
+		value, rest := parseMediaValue(tokens[2:])
+		if rest != 0 {
+			return nil
+		}
+		name := tokens[0].text
+		op := "="
+		if strings.HasPrefix(name, "min-") {
+			name, op = name[4:], ">="
+		} else if strings.HasPrefix(name, "max-") {
+			name, op = name[4:], "<="
+		}
+		if op != "=" && !isRangeFeature(name) {
+			return nil
+		}
+		return &mediaFeature{name: name, comparisons: []mediaComparison{{op: op, value: value}}}
+	}
+
+	// Range context: (width >= 600px), (600px < width), (400px <= width <= 700px)
+	return parseMediaRange(tokens)
+}
+
+// parseMediaRange parses a range-context media feature.
+// Media Queries Level 4 §2.4.3 Range context
+func parseMediaRange(tokens []mediaToken) *mediaFeature {
+	nameIndex := -1
+	for i, token := range tokens {
+		if token.kind == mediaIdent && isRangeFeature(token.text) {
+			nameIndex = i
+			break
+		}
+	}
+	if nameIndex < 0 {
+		return nil
+	}
+	feature := &mediaFeature{name: tokens[nameIndex].text}
+
+	// Left side: "value op name"
+	if nameIndex > 0 {
+		if tokens[nameIndex-1].kind != mediaDelim {
+			return nil
+		}
+		op := tokens[nameIndex-1].text
+		value, rest := parseMediaValue(tokens[:nameIndex-1])
+		if rest != 0 || !isComparison(op) {
+			return nil
+		}
+		feature.comparisons = append(feature.comparisons, mediaComparison{op: flipComparison(op), value: value})
+	}
+
+	// Right side: "name op value"
+	if after := tokens[nameIndex+1:]; len(after) > 0 {
+		if after[0].kind != mediaDelim || !isComparison(after[0].text) {
+			return nil
+		}
+		value, rest := parseMediaValue(after[1:])
+		if rest != 0 {
+			return nil
+		}
+		feature.comparisons = append(feature.comparisons, mediaComparison{op: after[0].text, value: value})
+	}
+
+	// Two comparisons must point the same way: "a < width < b"
+	if len(feature.comparisons) == 2 {
+		left, right := feature.comparisons[0].op, feature.comparisons[1].op
+		if left == "=" || right == "=" || (strings.HasPrefix(left, "<") == strings.HasPrefix(right, "<")) {
+			return nil
+		}
+	}
+	if len(feature.comparisons) == 0 {
+		return nil
+	}
+	return feature
+}
+
+// parseMediaValue parses a value from the start of tokens and returns it
+// with the number of unconsumed tokens.
+func parseMediaValue(tokens []mediaToken) (mediaValue, int) {
+	if len(tokens) == 0 {
+		return mediaValue{}, -1
+	}
+
+	first := tokens[0]
+	if first.kind == mediaIdent {
+		return mediaValue{keyword: first.text, kind: "keyword"}, len(tokens) - 1
+	}
+	if first.kind != mediaNumber {
+		return mediaValue{}, -1
+	}
+
+	// <ratio> = <number> / <number>
+	if first.text == "" && len(tokens) >= 3 && tokens[1].kind == mediaDelim && tokens[1].text == "/" &&
+		tokens[2].kind == mediaNumber && tokens[2].text == "" && tokens[2].value != 0 {
+		return mediaValue{number: first.value / tokens[2].value, kind: "ratio"}, len(tokens) - 3
+	}
+
+	value := mediaValue{number: first.value}
+	switch first.text {
+	case "":
+		value.kind = "number"
+	case "em", "rem":
+		// Media Queries Level 4 §1.3: Relative units are based on the
+		// initial value of font-size
+		value.number *= BaseFontHeight
+		value.kind = "length"
+	case "dppx", "x":
+		value.kind = "resolution"
+	case "dpi":
+		value.number /= 96
+		value.kind = "resolution"
+	case "dpcm":
+		value.number *= 2.54 / 96
+		value.kind = "resolution"
+	default:
+		perInch, ok := unitsPerInch[first.text]
+		if !ok {
+			return mediaValue{}, -1
+		}
+		value.number *= 96 / perInch
+		value.kind = "length"
+	}
+	return value, len(tokens) - 1
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "<", "<=", ">", ">=", "=":
+		return true
+	}
+	return false
+}
+
+// flipComparison turns "value op feature" into "feature op' value".
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// isRangeFeature reports whether a feature accepts min-/max- prefixes and
+// range syntax.
+// Media Queries Level 4 §2.4.3 Range context
+func isRangeFeature(name string) bool {
+	switch name {
+	case "width", "height", "device-width", "device-height",
+		"aspect-ratio", "device-aspect-ratio", "resolution",
+		"color", "color-index", "monochrome":
+		return true
+	}
+	return false
+}
+
+// matches evaluates the feature against env. Unknown features and values of
+// the wrong type are false.
+// Media Queries Level 4 §4 Viewport/Page Characteristics, §5 Display
+// Quality, §6 Color, §11 User Preferences
+func (f *mediaFeature) matches(env MediaEnvironment) bool {
+	var actual mediaValue
+	switch f.name {
+	case "width", "device-width":
+		actual = mediaValue{number: env.Width, kind: "length"}
+	case "height", "device-height":
+		actual = mediaValue{number: env.Height, kind: "length"}
+	case "aspect-ratio", "device-aspect-ratio":
+		if env.Height == 0 {
+			return false
+		}
+		actual = mediaValue{number: env.Width / env.Height, kind: "ratio"}
+	case "resolution":
+		actual = mediaValue{number: env.Resolution, kind: "resolution"}
+	case "orientation":
+		orientation := "landscape"
+		if env.Height >= env.Width {
+			orientation = "portrait"
+		}
+		actual = mediaValue{keyword: orientation, kind: "keyword"}
+	case "prefers-color-scheme":
+		scheme := env.ColorScheme
+		if scheme == "" {
+			scheme = "light"
+		}
+		actual = mediaValue{keyword: scheme, kind: "keyword"}
+	case "prefers-reduced-motion", "prefers-reduced-transparency", "prefers-contrast":
+		actual = mediaValue{keyword: "no-preference", kind: "keyword"}
+	case "color":
+		// 8 bits per color component
+		actual = mediaValue{number: 8, kind: "number"}
+	case "color-index", "monochrome":
+		actual = mediaValue{number: 0, kind: "number"}
+	case "hover", "any-hover":
+		actual = mediaValue{keyword: "hover", kind: "keyword"}
+	case "pointer", "any-pointer":
+		actual = mediaValue{keyword: "fine", kind: "keyword"}
+	case "scan":
+		actual = mediaValue{keyword: "progressive", kind: "keyword"}
+	case "grid":
+		actual = mediaValue{number: 0, kind: "number"}
+	default:
+		return false
+	}
+
+	// Boolean context: true unless the value is zero or 'none'
+	// Media Queries Level 4 §2.4.2 Evaluating Media Features in a Boolean Context
+	if len(f.comparisons) == 0 {
+		if actual.kind == "keyword" {
+			return actual.keyword != "none" && actual.keyword != "no-preference"
+		}
+		return actual.number != 0
+	}
+
+	for _, comparison := range f.comparisons {
+		if !compareMediaValues(actual, comparison.op, comparison.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareMediaValues evaluates "actual op expected".
+func compareMediaValues(actual mediaValue, op string, expected mediaValue) bool {
+	if actual.kind == "keyword" || expected.kind == "keyword" {
+		return op == "=" && actual.kind == expected.kind && actual.keyword == expected.keyword
+	}
+
+	// A bare 0 is a valid length; ratios may be written as a single number
+	if actual.kind != expected.kind {
+		compatible := expected.kind == "number" &&
+			(actual.kind == "ratio" || (actual.kind == "length" && expected.number == 0))
+		if !compatible {
+			return false
+		}
+	}
+
+	// Compare with a small tolerance so that 16/9 equals 1.7777...
+	const epsilon = 1e-6
+	diff := actual.number - expected.number
+	switch op {
+	case "=":
+		return diff > -epsilon && diff < epsilon
+	case "<":
+		return diff < -epsilon
+	case "<=":
+		return diff < epsilon
+	case ">":
+		return diff > epsilon
+	case ">=":
+		return diff > -epsilon
+	}
+	return false
+}
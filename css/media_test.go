@@ -0,0 +1,127 @@
+package css
+
+import "testing"
+
+// TestMediaQueryMatches tests parsing and evaluating media query lists
+// against the default 800x600 light screen.
+// Media Queries Level 4 §2 Media Queries
+func TestMediaQueryMatches(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected bool
+	}{
+		// Media types
+		{"", true},
+		{"all", true},
+		{"screen", true},
+		{"SCREEN", true},
+		{"print", false},
+		{"only screen", true},
+		{"not print", true},
+		{"not screen", false},
+		{"print, screen", true},
+		{"tv", false},
+
+		// min-/max- prefixes
+		{"(min-width: 600px)", true},
+		{"(min-width: 800px)", true},
+		{"(min-width: 801px)", false},
+		{"(max-width: 600px)", false},
+		{"screen and (min-width: 50em)", true},
+		{"screen and (max-width: 50em)", false},
+		{"(min-height: 600px) and (max-height: 600px)", true},
+		{"(width: 800px)", true},
+		{"(min-width: 0)", true},
+
+		// Range syntax
+		{"(width >= 600px)", true},
+		{"(width < 800px)", false},
+		{"(600px < width)", true},
+		{"(400px <= width <= 800px)", true},
+		{"(400px < width < 800px)", false},
+		{"(800px > width)", false},
+		{"(height > 599.5px)", true},
+		{"(400px < width > 600px)", false},
+
+		// Boolean logic
+		{"(min-width: 600px) and (orientation: portrait)", false},
+		{"(min-width: 600px) or (orientation: portrait)", true},
+		{"not (orientation: portrait)", true},
+		{"((width > 1000px) or (height = 600px)) and (color)", true},
+		{"screen and (min-width: 1px) or (color)", false},
+		{"not all and (monochrome)", true},
+
+		// Discrete features
+		{"(orientation: landscape)", true},
+		{"(prefers-color-scheme: dark)", false},
+		{"(prefers-color-scheme: light)", true},
+		{"(prefers-color-scheme)", true},
+		{"(color)", true},
+		{"(monochrome)", false},
+		{"(hover: hover)", true},
+		{"(aspect-ratio: 4/3)", true},
+		{"(min-aspect-ratio: 16/9)", false},
+
+		// Resolution
+		{"(resolution: 1dppx)", true},
+		{"(min-resolution: 2x)", false},
+		{"(resolution: 96dpi)", true},
+		{"(max-resolution: 1.5dppx)", true},
+
+		// Invalid queries are "not all" without affecting the rest of the list
+		{"(min-orientation: landscape)", false},
+		{"(width: red)", false},
+		{"(unknown-feature)", false},
+		{"screen and", false},
+		{"and screen", false},
+		{"(min-width: 600px) and or (color)", false},
+		{"(bogus: 1), screen", true},
+	}
+
+	env := DefaultMediaEnvironment()
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := ParseMediaQueryList(tt.query).Matches(env); got != tt.expected {
+				t.Errorf("ParseMediaQueryList(%q).Matches = %v, want %v", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestMediaQueryEnvironment tests that features are evaluated against the
+// environment rather than fixed defaults.
+func TestMediaQueryEnvironment(t *testing.T) {
+	phone := MediaEnvironment{Type: "screen", Width: 375, Height: 667, ColorScheme: "dark", Resolution: 2}
+	printer := MediaEnvironment{Type: "print", Width: 800, Height: 1100, ColorScheme: "light", Resolution: 3}
+
+	tests := []struct {
+		query    string
+		env      MediaEnvironment
+		expected bool
+	}{
+		{"(max-width: 600px)", phone, true},
+		{"(orientation: portrait)", phone, true},
+		{"(prefers-color-scheme: dark)", phone, true},
+		{"(min-resolution: 2dppx)", phone, true},
+		{"(min-resolution: 192dpi)", phone, true},
+		{"print", printer, true},
+		{"screen", printer, false},
+		{"not screen and (min-width: 600px)", printer, true},
+	}
+
+	for _, tt := range tests {
+		if got := ParseMediaQueryList(tt.query).Matches(tt.env); got != tt.expected {
+			t.Errorf("ParseMediaQueryList(%q).Matches(%+v) = %v, want %v", tt.query, tt.env, got, tt.expected)
+		}
+	}
+}
+
+func TestMediaQueryListString(t *testing.T) {
+	list := ParseMediaQueryList("screen and (min-width: 600px) ,  print")
+	if got := list.String(); got != "screen and (min-width: 600px), print" {
+		t.Errorf("String() = %q", got)
+	}
+	if len(list.Queries) != 2 || list.Queries[0].Type != "screen" || list.Queries[1].Type != "print" {
+		t.Errorf("Unexpected queries %+v", list.Queries)
+	}
+}
@@ -0,0 +1,259 @@
+package css
+
+// This file parses style rules nested in other style rules and desugars
+// them into the flat list of rules the cascade works on, so that nesting
+// costs nothing once a stylesheet is parsed.
+//
+// Spec references:
+// - CSS Nesting Level 1: https://www.w3.org/TR/css-nesting-1/
+// - CSS Syntax Level 3 §5.4.4 Consume a block's contents: https://www.w3.org/TR/css-syntax-3/#consume-block-contents
+//
+// Implemented:
+// - Style rules nested in style rules, to any depth (§2)
+// - The nesting selector '&', anywhere in a compound selector and inside
+//   functional pseudo-classes such as :not(&) (§4)
+// - Relative nested selectors: "> .a" and ".a" mean "& > .a" and "& .a" (§2.1)
+// - @media rules nested in style rules, whose declarations apply to the
+//   enclosing rule's selectors (§3.1)
+// - Declarations after a nested rule cascading after it, as nested
+//   declarations rules (§3.2)
+// - Specificity of '&' as :is() of the parent selectors (§4.1)
+//
+// Not implemented:
+// - '&' in top-level rules, where it means :scope
+// - Nested @supports, @layer, @container and @scope rules, which are skipped
+// - Nested rules in style attributes
+
+import (
+	"strings"
+
+	"github.com/lukehoban/browser/log"
+)
+
+// parseStyleBlock parses the contents of the block of a style rule, or of
+// an @media rule nested in one, whose '{' has been consumed, up to and
+// including its '}'. selectors are those of the style rule.
+//
+// The declarations before the first nested rule go to rule, which is nil
+// for an @media block. Each later run of declarations becomes a rule of
+// its own with the same selectors, so that it cascades after the nested
+// rules before it. The returned rules are rule followed by the nested
+// rules in source order.
+// CSS Nesting Level 1 §2 Nesting style rules, §3.2 Nested declarations rules
+func (p *Parser) parseStyleBlock(rule *Rule, selectors []*Selector, media []*MediaQueryList) []*Rule {
+	var rules []*Rule
+	if rule != nil {
+		rules = append(rules, rule)
+	}
+	declarations := rule
+	for {
+		line := p.tokenizer.Line()
+		token := p.tokenizer.Peek()
+		var nested []*Rule
+		switch {
+		case token.Type == EOFToken:
+			return rules
+		case token.Type == RightBraceToken:
+			p.tokenizer.Next()
+			return rules
+		case token.Type == SemicolonToken:
+			p.tokenizer.Next()
+			continue
+		case token.Type == AtKeywordToken && strings.EqualFold(token.Value, "media"):
+			nested = p.parseNestedMediaRule(selectors, media)
+		case token.Type == AtKeywordToken:
+			log.Debugf("Skipping unsupported @-rule nested in a style rule: %s", token.Value)
+			p.skipAtRule()
+			continue
+		case p.atNestedRule():
+			nested = p.parseNestedRule(selectors, media, line)
+		default:
+			if decl := p.parseDeclaration(); decl != nil {
+				if declarations == nil {
+					declarations = &Rule{Selectors: selectors, Media: media, Location: Location{Line: line}}
+					rules = append(rules, declarations)
+				}
+				declarations.Declarations = append(declarations.Declarations, decl)
+			}
+			p.tokenizer.SkipWhitespace()
+			if p.tokenizer.Peek().Type == SemicolonToken {
+				p.tokenizer.Next()
+			}
+			continue
+		}
+
+		// A nested rule ends a run of declarations, unless it was invalid
+		if len(nested) > 0 {
+			rules = append(rules, nested...)
+			declarations = nil
+		}
+	}
+}
+
+// atNestedRule reports whether the input at the tokenizer's position is a
+// nested style rule rather than a declaration: whether a '{' comes before
+// the ';' or '}' that would end a declaration. Custom properties are
+// always declarations, since their values may hold {}-blocks.
+// CSS Syntax Level 3 §5.4.4 Consume a block's contents
+func (p *Parser) atNestedRule() bool {
+	input := p.tokenizer.input
+	i := p.tokenizer.pos
+	if strings.HasPrefix(input[i:], "--") {
+		return false
+	}
+	depth := 0
+	for ; i < len(input); i++ {
+		switch c := input[i]; {
+		case c == '"' || c == '\'':
+			for i++; i < len(input) && input[i] != c; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+		case c == '\\':
+			i++
+		case c == '/' && strings.HasPrefix(input[i:], "/*"):
+			end := strings.Index(input[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case depth == 0 && (c == ';' || c == '}'):
+			return false
+		case depth == 0 && c == '{':
+			return true
+		}
+	}
+	return false
+}
+
+// parseNestedRule parses a style rule nested in a rule with the selectors
+// parent, returning it and the rules nested in it.
+// CSS Nesting Level 1 §2 Nesting style rules
+func (p *Parser) parseNestedRule(parent []*Selector, media []*MediaQueryList, line int) []*Rule {
+	prelude, terminator := p.readPrelude()
+	if terminator != '{' {
+		return nil
+	}
+	selectors := nestSelectors(prelude, parent)
+	if selectors == nil {
+		// CSS 2.1 §4.2: an invalid selector invalidates the whole rule
+		log.Debugf("CSS parse error: invalid nested selector %q", strings.TrimSpace(prelude))
+		p.skipBlock()
+		return nil
+	}
+	rule := &Rule{
+		Selectors:    selectors,
+		Declarations: make([]*Declaration, 0),
+		Media:        media,
+		Location:     Location{Line: line},
+	}
+	return p.parseStyleBlock(rule, selectors, media)
+}
+
+// parseNestedMediaRule parses an @media rule nested in a style rule with
+// the given selectors. Its declarations and nested rules carry its media
+// query list after the enclosing ones.
+// CSS Nesting Level 1 §3.1 Nested group rules
+func (p *Parser) parseNestedMediaRule(selectors []*Selector, enclosing []*MediaQueryList) []*Rule {
+	// Consume the @media keyword
+	p.tokenizer.Next()
+
+	prelude, terminator := p.readPrelude()
+	if terminator != '{' {
+		return nil
+	}
+	return p.parseStyleBlock(nil, selectors, appendMedia(enclosing, prelude))
+}
+
+// nestSelectors desugars the selector list of a nested style rule against
+// the selectors of its parent. A selector that does not contain '&', or
+// starts with a combinator, is relative to the parent and gets "& "
+// prepended. Every '&' then becomes :is() of the parent selectors, which
+// matches what they match with the specificity of the most specific one;
+// a leading '&' with a single parent becomes the parent selector itself,
+// which is equivalent and keeps the subject indexable. Parent selectors
+// with pseudo-elements are left out, as '&' cannot represent them. It
+// returns nil if any selector is invalid.
+// CSS Nesting Level 1 §2.1 Syntax, §4 Nesting selector
+func nestSelectors(prelude string, parent []*Selector) []*Selector {
+	var texts []string
+	for _, selector := range parent {
+		if !hasPseudoElement(selector) {
+			texts = append(texts, selector.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil
+	}
+	is := ":is(" + strings.Join(texts, ", ") + ")"
+
+	entries := splitCommas(prelude)
+	selectors := make([]*Selector, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			return nil
+		}
+		if strings.IndexByte(">+~", entry[0]) >= 0 || nestingSelectorIndex(entry, 0) < 0 {
+			entry = "& " + entry
+		}
+
+		var desugared strings.Builder
+		for i := 0; ; {
+			j := nestingSelectorIndex(entry, i)
+			if j < 0 {
+				desugared.WriteString(entry[i:])
+				break
+			}
+			desugared.WriteString(entry[i:j])
+			if j == 0 && len(texts) == 1 && (j+1 == len(entry) || !isNameChar(rune(entry[j+1]))) {
+				desugared.WriteString(texts[0])
+			} else {
+				desugared.WriteString(is)
+			}
+			i = j + 1
+		}
+
+		parsed := parseSelectorList(desugared.String(), false)
+		if len(parsed) != 1 {
+			return nil
+		}
+		selectors = append(selectors, parsed[0])
+	}
+	return selectors
+}
+
+// nestingSelectorIndex returns the index of the first '&' in selector at or
+// after from, outside strings and escapes, or -1.
+func nestingSelectorIndex(selector string, from int) int {
+	for i := from; i < len(selector); i++ {
+		switch c := selector[i]; c {
+		case '&':
+			return i
+		case '\\':
+			i++
+		case '"', '\'':
+			for i++; i < len(selector) && selector[i] != c; i++ {
+				if selector[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// hasPseudoElement reports whether selector targets a pseudo-element.
+func hasPseudoElement(selector *Selector) bool {
+	for _, simple := range selector.Simple {
+		if len(simple.PseudoElements) > 0 {
+			return true
+		}
+	}
+	return false
+}
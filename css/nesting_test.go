@@ -0,0 +1,108 @@
+package css
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestParseNestedRules tests that nested rules are desugared into the
+// rules that follow their parent, with '&' replaced by the parent
+// selectors.
+// CSS Nesting Level 1 §2 Nesting style rules, §4 Nesting selector
+func TestParseNestedRules(t *testing.T) {
+	stylesheet := Parse(`.card {
+	color: red;
+	& .title { color: blue; }
+	&:hover, &.active { color: green; }
+	> p { margin: 0; }
+	+ .card { margin-top: 4px; }
+	.dark & { color: white; }
+	@media (max-width: 600px) {
+		padding: 0;
+		.icon { display: none; }
+	}
+	border: none;
+	--slot: { a: b };
+	ul { li { & + & { color: gray; } } }
+}
+h1, #title { :not(&) > em { color: red; } }`)
+
+	expected := []struct {
+		selectors    []string
+		media        int
+		declarations []string
+		line         int
+	}{
+		{[]string{".card"}, 0, []string{"color"}, 1},
+		{[]string{".card .title"}, 0, []string{"color"}, 3},
+		{[]string{".card:hover", ".card.active"}, 0, []string{"color"}, 4},
+		{[]string{".card > p"}, 0, []string{"margin"}, 5},
+		{[]string{".card + .card"}, 0, []string{"margin-top"}, 6},
+		{[]string{".dark :is(.card)"}, 0, []string{"color"}, 7},
+		{[]string{".card"}, 1, []string{"padding"}, 9},
+		{[]string{".card .icon"}, 1, []string{"display"}, 10},
+		{[]string{".card"}, 0, []string{"border", "--slot"}, 12},
+		{[]string{".card ul"}, 0, nil, 14},
+		{[]string{".card ul li"}, 0, nil, 14},
+		{[]string{".card ul li + :is(.card ul li)"}, 0, []string{"color"}, 14},
+		{[]string{"h1", "#title"}, 0, nil, 16},
+		{[]string{":not(:is(h1, #title)) > em"}, 0, []string{"color"}, 16},
+	}
+	if len(stylesheet.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(stylesheet.Rules))
+	}
+	for i, want := range expected {
+		rule := stylesheet.Rules[i]
+		var selectors []string
+		for _, selector := range rule.Selectors {
+			selectors = append(selectors, selector.Text)
+		}
+		if strings.Join(selectors, ", ") != strings.Join(want.selectors, ", ") {
+			t.Errorf("Rule %d: expected selectors %q, got %q", i, want.selectors, selectors)
+		}
+		if len(rule.Media) != want.media {
+			t.Errorf("Rule %d: expected %d media lists, got %d", i, want.media, len(rule.Media))
+		}
+		var properties []string
+		for _, decl := range rule.Declarations {
+			properties = append(properties, decl.Property)
+		}
+		if strings.Join(properties, " ") != strings.Join(want.declarations, " ") {
+			t.Errorf("Rule %d: expected declarations %q, got %q", i, want.declarations, properties)
+		}
+		if rule.Location.Line != want.line {
+			t.Errorf("Rule %d: expected line %d, got %d", i, want.line, rule.Location.Line)
+		}
+	}
+
+	// A desugared selector is parsed like one written out
+	rule := stylesheet.Rules[1].Selectors[0]
+	if len(rule.Simple) != 2 || rule.Simple[0].Classes[0] != "card" || rule.Simple[1].Classes[0] != "title" {
+		t.Errorf("Expected .card .title to be parsed, got %+v", rule.Simple)
+	}
+}
+
+// TestParseInvalidNestedRules tests that a nested rule with an invalid
+// selector is dropped with its block, leaving the rest of its parent.
+// CSS 2.1 §4.2 Rules for handling parsing errors
+func TestParseInvalidNestedRules(t *testing.T) {
+	stylesheet := Parse(`p {
+	&div { color: red; }
+	.a, $b { color: red; }
+	@supports (display: grid) { .grid { color: red; } }
+	color: blue;
+}
+p::before { &:hover { color: red; } }
+.after { color: green; }`)
+
+	var texts []string
+	for _, rule := range stylesheet.Rules {
+		texts = append(texts, rule.Selectors[0].Text)
+	}
+	if got := strings.Join(texts, ", "); got != "p, p::before, .after" {
+		t.Fatalf("Expected rules p, p::before and .after, got %s", got)
+	}
+	if decls := stylesheet.Rules[0].Declarations; len(decls) != 1 || decls[0].Value != "blue" {
+		t.Errorf("Expected p to keep color: blue, got %v", decls)
+	}
+}
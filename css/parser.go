@@ -1,6 +1,9 @@
 package css
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/lukehoban/browser/log"
 )
 
@@ -8,19 +11,113 @@ import (
 // CSS 2.1 §4 Syntax and basic data types
 type Stylesheet struct {
 	Rules []*Rule
+
+	// Imports lists the stylesheet's @import rules in order. Loading them
+	// is left to the caller, since it requires fetching resources.
+	Imports []*Import
+
+	// FontFaces lists the stylesheet's @font-face rules in order, including
+	// those nested in @media blocks.
+	FontFaces []*FontFace
+
+	// Properties lists the stylesheet's valid @property rules in order,
+	// including those nested in @media blocks.
+	Properties []*PropertyRule
 }
 
-// Rule represents a CSS rule.
+// Import represents an @import rule.
+// CSS 2.1 §6.3 The @import rule
+type Import struct {
+	URL   string          // URL as written, unresolved
+	Media *MediaQueryList // Media the import is restricted to; empty for all
+}
+
+// Rule represents a CSS rule. Rules nested in a rule follow it in the
+// stylesheet as rules of their own, with selectors that include the
+// parent's.
 // CSS 2.1 §4.1.7 Rule sets, declaration blocks, and selectors
 type Rule struct {
 	Selectors    []*Selector
 	Declarations []*Declaration
+
+	// Media holds the media query lists of the @media rules enclosing this
+	// rule, outermost first. The rule applies only when all of them match.
+	// CSS 2.1 §7.2.1 The @media rule
+	Media []*MediaQueryList
+
+	// Location is where the rule appears in its stylesheet.
+	Location Location
+}
+
+// Location is the position of a rule in the source of its stylesheet.
+type Location struct {
+	// URL is the stylesheet's URL. The parser leaves it empty; loaders
+	// set it once they know where the stylesheet came from.
+	URL string
+
+	// Line is the 1-based line of the rule's first selector.
+	Line int
+
+	// StyleElement is the 1-based position of the <style> element the
+	// rule comes from among the document's <style> elements, or 0 for a
+	// stylesheet of its own. Line then counts from the start of the
+	// element's text, and URL is the document's.
+	StyleElement int
+}
+
+// MatchesMedia reports whether every @media rule enclosing r matches env.
+func (r *Rule) MatchesMedia(env MediaEnvironment) bool {
+	for _, media := range r.Media {
+		if !media.Matches(env) {
+			return false
+		}
+	}
+	return true
 }
 
 // Selector represents a CSS selector.
 // CSS 2.1 §5 Selectors
 type Selector struct {
-	Simple []*SimpleSelector // List of simple selectors (for descendant combinator)
+	Simple []*SimpleSelector // List of compound selectors, left to right
+
+	// Combinators[i] joins Simple[i] and Simple[i+1]. A nil or short slice
+	// means descendant combinators, matching selectors built before
+	// combinators were parsed.
+	// CSS 2.1 §5.5-§5.7, Selectors Level 3 §8
+	Combinators []Combinator
+
+	// Leading is the implicit combinator of a relative selector such as the
+	// argument of :has(> img). It is only meaningful for relative selectors.
+	// Selectors Level 4 §3.3 Relative selectors
+	Leading Combinator
+
+	// Text is the selector as written, without surrounding whitespace. For
+	// a nested rule it is the selector after desugaring, with '&' replaced
+	// by the parent selectors (see nesting.go).
+	Text string
+}
+
+// Combinator represents the relationship between two compound selectors.
+// CSS 2.1 §5.5-§5.7, Selectors Level 3 §8 Combinators
+type Combinator int
+
+const (
+	// DescendantCombinator is whitespace: "div p"
+	DescendantCombinator Combinator = iota
+	// ChildCombinator is '>': "div > p"
+	ChildCombinator
+	// AdjacentSiblingCombinator is '+': "h1 + p"
+	AdjacentSiblingCombinator
+	// GeneralSiblingCombinator is '~': "h1 ~ p"
+	GeneralSiblingCombinator
+)
+
+// CombinatorAt returns the combinator between Simple[i] and Simple[i+1].
+func (s *Selector) CombinatorAt(i int) Combinator {
+	if i < len(s.Combinators) {
+		return s.Combinators[i]
+	}
+	return DescendantCombinator
 }
 
 // SimpleSelector represents a simple selector.
@@ -29,8 +126,43 @@ type SimpleSelector struct {
 	TagName        string   // Element type selector (e.g., "div", "*" for universal)
 	ID             string   // ID selector (e.g., "header")
 	Classes        []string // Class selectors (e.g., ["container", "main"])
-	PseudoClasses  []string // Pseudo-classes (e.g., ["link", "hover"]) - tracked for specificity but not used for matching
+	PseudoClasses  []string // Non-functional pseudo-classes (e.g., ["first-child", "link"])
 	PseudoElements []string // Pseudo-elements (e.g., ["before", "after"]) - tracked for specificity but not used for matching
+
+	// PseudoFunctions holds functional pseudo-classes such as :nth-child(2n+1)
+	// and :not(.a). They are kept apart from PseudoClasses because their
+	// specificity depends on their arguments.
+	// Selectors Level 4 §4 Logical Combinations, §14 Tree-Structural pseudo-classes
+	PseudoFunctions []*PseudoFunction
+}
+
+// PseudoFunction represents a functional pseudo-class and its parsed argument.
+type PseudoFunction struct {
+	Name string // e.g., "nth-child", "not", "is", "where", "has"
+
+	// Nth is the An+B argument of :nth-child() and friends.
+	// Selectors Level 4 §14.4 An+B microsyntax
+	Nth NthExpr
+
+	// Selectors is the selector list argument of :not(), :is(), :where(),
+	// :has(), and the optional "of S" clause of :nth-child()/:nth-last-child().
+	Selectors []*Selector
+}
+
+// NthExpr represents an An+B expression.
+// Selectors Level 4 §14.4 / CSS Syntax Level 3 §6 The An+B microsyntax
+type NthExpr struct {
+	A int
+	B int
+}
+
+// Matches reports whether the 1-based index is A*n+B for some n >= 0.
+func (e NthExpr) Matches(index int) bool {
+	if e.A == 0 {
+		return index == e.B
+	}
+	diff := index - e.B
+	return diff%e.A == 0 && diff/e.A >= 0
 }
 
 // Declaration represents a CSS declaration.
@@ -38,11 +170,28 @@ type SimpleSelector struct {
 type Declaration struct {
 	Property string
 	Value    string
+
+	// Important is set for declarations marked !important, which the
+	// cascade sorts above normal declarations.
+	// CSS 2.1 §6.4.2 !important rules
+	Important bool
 }
 
 // Parser parses CSS stylesheets.
 type Parser struct {
 	tokenizer *Tokenizer
+
+	// imports collects @import rules. importsClosed is set once any rule
+	// other than @charset or @import has been seen, after which @import is
+	// invalid.
+	imports       []*Import
+	importsClosed bool
+
+	// fontFaces collects @font-face rules at any nesting level.
+	fontFaces []*FontFace
+
+	// properties collects valid @property rules at any nesting level.
+	properties []*PropertyRule
 }
 
 // NewParser creates a new CSS parser.
@@ -54,9 +203,20 @@ func NewParser(input string) *Parser {
 
 // Parse parses the CSS input and returns a stylesheet.
 func (p *Parser) Parse() *Stylesheet {
-	stylesheet := &Stylesheet{
-		Rules: make([]*Rule, 0),
+	rules := p.parseRuleList(nil, false)
+	return &Stylesheet{
+		Rules:      rules,
+		Imports:    p.imports,
+		FontFaces:  p.fontFaces,
+		Properties: p.properties,
 	}
+}
+
+// parseRuleList parses rules until the end of input, or until the '}' that
+// closes an enclosing @media block if nested is set. media is the list of
+// enclosing @media query lists, recorded on every rule parsed.
+func (p *Parser) parseRuleList(media []*MediaQueryList, nested bool) []*Rule {
+	rules := make([]*Rule, 0)
 
 	for {
 		p.tokenizer.SkipWhitespace()
@@ -64,25 +224,213 @@ func (p *Parser) Parse() *Stylesheet {
 		if token.Type == EOFToken {
 			break
 		}
+		if nested && token.Type == RightBraceToken {
+			p.tokenizer.Next()
+			break
+		}
+
+		// CSS 2.1 §6.3: @import rules must precede all other rules,
+		// except @charset, and are ignored inside @media blocks
+		if token.Type == AtKeywordToken && strings.EqualFold(token.Value, "import") {
+			if nested || p.importsClosed {
+				log.Debugf("Ignoring @import after other rules")
+				p.skipAtRule()
+			} else {
+				p.parseImportRule()
+			}
+			continue
+		}
+		if token.Type != AtKeywordToken || !strings.EqualFold(token.Value, "charset") {
+			p.importsClosed = true
+		}
 
-		// Skip @-rules (media queries, imports, etc.)
-		// CSS 2.1 §4.1.5 At-rules - not implementing for simplicity
+		// CSS 2.1 §7.2.1 The @media rule
+		if token.Type == AtKeywordToken && strings.EqualFold(token.Value, "media") {
+			rules = append(rules, p.parseMediaRule(media)...)
+			continue
+		}
+
+		// CSS Fonts Level 4 §4.1 The @font-face rule
+		if token.Type == AtKeywordToken && strings.EqualFold(token.Value, "font-face") {
+			p.parseFontFaceRule(media)
+			continue
+		}
+
+		// CSS Properties and Values API Level 1 §3 The @property rule
+		if token.Type == AtKeywordToken && strings.EqualFold(token.Value, "property") {
+			p.parsePropertyRule(media)
+			continue
+		}
+
+		// Skip other @-rules (keyframes, etc.)
+		// CSS 2.1 §4.1.5 At-rules
 		if token.Type == AtKeywordToken {
 			log.Debugf("Skipping unsupported @-rule: %s", token.Value)
 			p.skipAtRule()
 			continue
 		}
 
-		rule := p.parseRule()
-		if rule != nil {
-			stylesheet.Rules = append(stylesheet.Rules, rule)
+		line := p.tokenizer.Line()
+		rules = append(rules, p.parseRule(media, line)...)
+	}
+
+	return rules
+}
+
+// parseMediaRule parses an @media rule and returns the rules inside its
+// block, each carrying the rule's media query list after those of any
+// enclosing @media rules.
+// CSS 2.1 §7.2.1 The @media rule, Media Queries Level 4 §3 Syntax
+func (p *Parser) parseMediaRule(enclosing []*MediaQueryList) []*Rule {
+	// Consume the @media keyword
+	p.tokenizer.Next()
+
+	prelude, terminator := p.readPrelude()
+	if terminator != '{' {
+		// "@media screen;" has no block and is ignored
+		return nil
+	}
+
+	return p.parseRuleList(appendMedia(enclosing, prelude), true)
+}
+
+// appendMedia returns the enclosing media query lists followed by the one
+// of an @media rule's prelude, leaving enclosing unchanged.
+func appendMedia(enclosing []*MediaQueryList, prelude string) []*MediaQueryList {
+	media := make([]*MediaQueryList, len(enclosing), len(enclosing)+1)
+	copy(media, enclosing)
+	return append(media, ParseMediaQueryList(prelude))
+}
+
+// parseFontFaceRule parses an @font-face rule's descriptor block.
+// CSS Fonts Level 4 §4.1 The @font-face rule
+func (p *Parser) parseFontFaceRule(media []*MediaQueryList) {
+	// Consume the @font-face keyword
+	p.tokenizer.Next()
+
+	if _, terminator := p.readPrelude(); terminator != '{' {
+		return
+	}
+	declarations := p.parseDeclarations()
+	p.skipBlock()
+
+	p.fontFaces = append(p.fontFaces, &FontFace{
+		Declarations: declarations,
+		Media:        media,
+	})
+}
+
+// parseImportRule parses an @import rule: a string or url() followed by an
+// optional media query list.
+// CSS 2.1 §6.3 The @import rule
+func (p *Parser) parseImportRule() {
+	// Consume the @import keyword
+	p.tokenizer.Next()
+
+	prelude, terminator := p.readPrelude()
+	if terminator == '{' {
+		// Not a valid @import; skip the block as an unknown at-rule would
+		p.skipBlock()
+		return
+	}
+
+	url, rest, ok := parseImportURL(strings.TrimSpace(prelude))
+	if !ok {
+		log.Debugf("Ignoring @import with invalid URL: %s", prelude)
+		return
+	}
+	p.imports = append(p.imports, &Import{
+		URL:   url,
+		Media: ParseMediaQueryList(rest),
+	})
+}
+
+// parseImportURL splits an @import prelude into the URL, given as a string
+// or url(), and the text that follows it.
+func parseImportURL(prelude string) (url, rest string, ok bool) {
+	if prelude == "" {
+		return "", "", false
+	}
+	if quote := prelude[0]; quote == '"' || quote == '\'' {
+		end := strings.IndexByte(prelude[1:], quote)
+		if end < 0 {
+			return "", "", false
+		}
+		return prelude[1 : end+1], prelude[end+2:], true
+	}
+	if len(prelude) >= 4 && strings.EqualFold(prelude[:4], "url(") {
+		end := strings.IndexByte(prelude, ')')
+		if end < 0 {
+			return "", "", false
+		}
+		return Unquote(strings.TrimSpace(prelude[4:end])), prelude[end+1:], true
+	}
+	return "", "", false
+}
+
+// readPrelude consumes the prelude of an at-rule, up to and including the
+// ';' or '{' that ends it, and returns its text without comments along with
+// the terminator (0 at end of input). Quoted strings and parentheses are
+// skipped over, so "url(data:...;base64,...)" is read whole.
+// CSS 2.1 §4.1.5 At-rules
+func (p *Parser) readPrelude() (string, byte) {
+	input := p.tokenizer.input
+	var prelude strings.Builder
+	depth := 0
+	for p.tokenizer.pos < len(input) {
+		c := input[p.tokenizer.pos]
+		switch {
+		case c == '/' && strings.HasPrefix(input[p.tokenizer.pos:], "/*"):
+			end := strings.Index(input[p.tokenizer.pos+2:], "*/")
+			if end < 0 {
+				p.tokenizer.pos = len(input)
+				return prelude.String(), 0
+			}
+			p.tokenizer.pos += end + 4
+			prelude.WriteByte(' ')
+			continue
+		case c == '"' || c == '\'':
+			end := p.tokenizer.pos + 1
+			for end < len(input) && input[end] != c {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(input))
+			prelude.WriteString(input[p.tokenizer.pos:end])
+			p.tokenizer.pos = end
+			continue
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case (c == ';' || c == '{') && depth == 0:
+			p.tokenizer.pos++
+			return prelude.String(), c
 		}
+		prelude.WriteByte(c)
+		p.tokenizer.pos++
 	}
+	return prelude.String(), 0
+}
 
-	return stylesheet
+// skipBlock skips the contents of a {}-block whose '{' has been consumed.
+func (p *Parser) skipBlock() {
+	braceDepth := 1
+	for braceDepth > 0 {
+		switch p.tokenizer.Next().Type {
+		case EOFToken:
+			return
+		case LeftBraceToken:
+			braceDepth++
+		case RightBraceToken:
+			braceDepth--
+		}
+	}
 }
 
-// skipAtRule skips an @-rule (like @media, @import, @keyframes).
+// skipAtRule skips an @-rule (like @keyframes, @page).
 // CSS 2.1 §4.1.5 At-rules
 // We skip these because we don't implement them, but we need to properly
 // parse past them to avoid infinite loops.
@@ -113,39 +461,51 @@ func (p *Parser) skipAtRule() {
 	}
 }
 
-// parseRule parses a CSS rule.
-// CSS 2.1 §4.1.7 Rule sets
-func (p *Parser) parseRule() *Rule {
+// parseRule parses a CSS rule starting on the given line, returning it
+// followed by the rules nested in it, each carrying the enclosing @media
+// query lists.
+// CSS 2.1 §4.1.7 Rule sets, CSS Nesting Level 1 §2 Nesting style rules
+func (p *Parser) parseRule(media []*MediaQueryList, line int) []*Rule {
 	selectors := p.parseSelectors()
-	if len(selectors) == 0 {
-		return nil
-	}
 
 	p.tokenizer.SkipWhitespace()
 
 	// Expect '{'
-	token := p.tokenizer.Next()
-	if token.Type != LeftBraceToken {
+	// CSS 2.1 §4.2: If the selector can't be parsed, the whole rule set,
+	// including its declaration block, is ignored.
+	if len(selectors) == 0 || p.tokenizer.Peek().Type != LeftBraceToken {
+		p.skipInvalidRule()
 		return nil
 	}
+	p.tokenizer.Next()
 
-	declarations := p.parseDeclarations()
-
-	p.tokenizer.SkipWhitespace()
-
-	// Expect '}'
-	token = p.tokenizer.Next()
-	if token.Type != RightBraceToken {
-		// Error recovery: skip to next '}'
-		log.Debugf("CSS parse error: expected '}', got %v, recovering...", token.Type)
-		for token.Type != RightBraceToken && token.Type != EOFToken {
-			token = p.tokenizer.Next()
-		}
+	rule := &Rule{
+		Selectors:    selectors,
+		Declarations: make([]*Declaration, 0),
+		Media:        media,
+		Location:     Location{Line: line},
 	}
+	return p.parseStyleBlock(rule, selectors, media)
+}
 
-	return &Rule{
-		Selectors:    selectors,
-		Declarations: declarations,
+// skipInvalidRule skips the remainder of a rule set whose selector could not
+// be parsed: everything up to and including its {}-block.
+// CSS 2.1 §4.2 Rules for handling parsing errors
+func (p *Parser) skipInvalidRule() {
+	braceDepth := 0
+	for {
+		token := p.tokenizer.Next()
+		switch token.Type {
+		case EOFToken:
+			return
+		case LeftBraceToken:
+			braceDepth++
+		case RightBraceToken:
+			braceDepth--
+			if braceDepth <= 0 {
+				return
+			}
+		}
 	}
 }
 
@@ -155,10 +515,11 @@ func (p *Parser) parseSelectors() []*Selector {
 	selectors := make([]*Selector, 0)
 
 	for {
-		p.tokenizer.SkipWhitespace()
-
+		p.tokenizer.skipTrivia()
+		start := p.tokenizer.pos
 		selector := p.parseSelector()
 		if selector != nil {
+			selector.Text = p.sourceSince(start)
 			selectors = append(selectors, selector)
 		}
 
@@ -176,61 +537,130 @@ func (p *Parser) parseSelectors() []*Selector {
 	return selectors
 }
 
-// parseSelector parses a single selector.
-// This handles descendant combinators (space-separated).
-// CSS 2.1 §5.5 Descendant selectors
+// parseSelector parses a single complex selector.
+// This handles descendant (whitespace), child (>), adjacent sibling (+),
+// and general sibling (~) combinators.
+// CSS 2.1 §5.5-§5.7, Selectors Level 3 §8 Combinators
 func (p *Parser) parseSelector() *Selector {
+	return p.parseComplexSelector(false)
+}
+
+// parseRelativeSelector parses a selector that may start with a combinator,
+// as used by the argument of :has().
+// Selectors Level 4 §3.3 Relative selectors
+func (p *Parser) parseRelativeSelector() *Selector {
+	return p.parseComplexSelector(true)
+}
+
+// parseComplexSelector parses compound selectors joined by combinators.
+// When relative is true, a leading combinator is accepted and stored in
+// Selector.Leading.
+func (p *Parser) parseComplexSelector(relative bool) *Selector {
 	selector := &Selector{
 		Simple: make([]*SimpleSelector, 0),
 	}
 
-	for {
-		p.tokenizer.SkipWhitespace()
+	p.tokenizer.SkipWhitespace()
+	if relative {
+		if combinator, ok := combinatorFor(p.tokenizer.Peek()); ok {
+			p.tokenizer.Next()
+			p.tokenizer.SkipWhitespace()
+			selector.Leading = combinator
+		}
+	}
 
+	for {
 		simple := p.parseSimpleSelector()
 		if simple == nil {
+			if len(selector.Simple) > 0 {
+				// A combinator with nothing after it: the selector is invalid.
+				// Selectors Level 3 §4: an invalid selector invalidates the rule.
+				log.Debug("CSS parse error: combinator not followed by a compound selector")
+				return nil
+			}
 			break
 		}
 
 		selector.Simple = append(selector.Simple, simple)
 
-		// Check for descendant combinator (whitespace followed by another selector)
+		// Look past whitespace for an explicit combinator or another compound
+		// selector (which means a descendant combinator).
 		savedPos := p.tokenizer.pos
 		p.tokenizer.SkipWhitespace()
+		sawWhitespace := p.tokenizer.pos != savedPos
 		next := p.tokenizer.Peek()
 
-		// Check for child combinator (>), adjacent sibling (+), or general sibling (~)
-		// CSS 2.1 §5.6: Child combinator
-		// CSS 2.1 §5.7: Adjacent sibling combinator
-		// CSS3 Selectors: General sibling combinator (~)
-		if next.Type == IdentToken {
-			if next.Value == ">" {
-				log.Warnf("CSS 2.1 §5.6: Child combinator (>) not yet implemented, skipping selector")
-				return nil
-			} else if next.Value == "+" {
-				log.Warnf("CSS 2.1 §5.7: Adjacent sibling combinator (+) not yet implemented, skipping selector")
-				return nil
-			} else if next.Value == "~" {
-				log.Warnf("CSS3 Selectors: General sibling combinator (~) not yet implemented, skipping selector")
-				return nil
-			}
+		if combinator, ok := combinatorFor(next); ok {
+			p.tokenizer.Next()
+			p.tokenizer.SkipWhitespace()
+			selector.Combinators = append(selector.Combinators, combinator)
+			continue
 		}
 
-		// If next is not a selector start, restore position
-		if next.Type != IdentToken && next.Type != HashToken && next.Type != DotToken {
-			p.tokenizer.pos = savedPos
-			break
+		if sawWhitespace && startsCompoundSelector(next) {
+			selector.Combinators = append(selector.Combinators, DescendantCombinator)
+			continue
 		}
+
+		// Not part of this selector: restore position
+		p.tokenizer.pos = savedPos
+		break
 	}
 
 	if len(selector.Simple) == 0 {
 		return nil
 	}
 
+	// Selectors built from only descendant combinators keep a nil slice so
+	// they compare equal to hand-built selectors.
+	allDescendant := true
+	for _, c := range selector.Combinators {
+		if c != DescendantCombinator {
+			allDescendant = false
+			break
+		}
+	}
+	if allDescendant {
+		selector.Combinators = nil
+	}
+
 	return selector
 }
 
-// parseSimpleSelector parses a simple selector.
+// combinatorFor returns the combinator represented by a token, if any.
+// The tokenizer reports '>', '+' and '~' as single-character identifiers.
+func combinatorFor(token Token) (Combinator, bool) {
+	if token.Type != IdentToken {
+		return DescendantCombinator, false
+	}
+	switch token.Value {
+	case ">":
+		return ChildCombinator, true
+	case "+":
+		return AdjacentSiblingCombinator, true
+	case "~":
+		return GeneralSiblingCombinator, true
+	}
+	return DescendantCombinator, false
+}
+
+// startsCompoundSelector reports whether a token can begin a compound selector.
+func startsCompoundSelector(token Token) bool {
+	switch token.Type {
+	case IdentToken:
+		_, isCombinator := combinatorFor(token)
+		return !isCombinator
+	case HashToken, DotToken, ColonToken, LeftBracketToken:
+		return true
+	case ErrorToken:
+		return token.Value == "*"
+	}
+	return false
+}
+
+// parseSimpleSelector parses a compound selector: an optional type or
+// universal selector followed by IDs, classes, attribute selectors and
+// pseudo-classes/elements.
 // CSS 2.1 §5.2 Selector syntax
 func (p *Parser) parseSimpleSelector() *SimpleSelector {
 	simple := &SimpleSelector{
@@ -238,13 +668,23 @@ func (p *Parser) parseSimpleSelector() *SimpleSelector {
 		PseudoClasses:  make([]string, 0),
 		PseudoElements: make([]string, 0),
 	}
+	parsed := false
 
 	token := p.tokenizer.Peek()
 
 	// Type selector
 	if token.Type == IdentToken {
+		if _, isCombinator := combinatorFor(token); isCombinator {
+			return nil
+		}
 		p.tokenizer.Next()
 		simple.TagName = token.Value
+		parsed = true
+	} else if token.Type == ErrorToken && token.Value == "*" {
+		// CSS 2.1 §5.3 Universal selector
+		p.tokenizer.Next()
+		simple.TagName = "*"
+		parsed = true
 	}
 
 	// ID and class selectors
@@ -254,12 +694,14 @@ func (p *Parser) parseSimpleSelector() *SimpleSelector {
 		if token.Type == HashToken {
 			p.tokenizer.Next()
 			simple.ID = token.Value
+			parsed = true
 		} else if token.Type == DotToken {
 			p.tokenizer.Next()
 			// Next token should be class name
 			token = p.tokenizer.Next()
 			if token.Type == IdentToken {
 				simple.Classes = append(simple.Classes, token.Value)
+				parsed = true
 			}
 		} else if token.Type == LeftBracketToken {
 			// Skip attribute selectors [attr=value]
@@ -275,14 +717,11 @@ func (p *Parser) parseSimpleSelector() *SimpleSelector {
 				}
 			}
 		} else if token.Type == ColonToken {
-			// Handle pseudo-classes and pseudo-elements (:hover, ::before, etc.)
+			// Handle pseudo-classes and pseudo-elements (:first-child, ::before, etc.)
 			// CSS 2.1 §5.11 Pseudo-classes, §5.12 Pseudo-elements
-			// Note: We store pseudo-classes and pseudo-elements for specificity calculation but don't use them for matching
-			// (e.g., "a:link" is matched as "a", but specificity includes the pseudo-class)
-			// This provides partial support for styling links but not interactive states
-			log.Debug("CSS 2.1 §5.11-5.12: Pseudo-classes/pseudo-elements have partial support (storing for specificity, stripping from matching)")
+			// Selectors Level 4 §4 (logical) and §14 (tree-structural) pseudo-classes
 			p.tokenizer.Next() // consume ':'
-			
+
 			// Check for double colon (pseudo-element ::before)
 			isPseudoElement := false
 			token = p.tokenizer.Peek()
@@ -290,40 +729,39 @@ func (p *Parser) parseSimpleSelector() *SimpleSelector {
 				p.tokenizer.Next() // consume second ':'
 				isPseudoElement = true
 			}
-			
+
 			// Consume the pseudo-class/pseudo-element name
 			token = p.tokenizer.Peek()
-			if token.Type == IdentToken {
-				pseudoName := token.Value
-				p.tokenizer.Next() // consume identifier (e.g., "link", "hover", "before")
-				
-				// Store for specificity calculation
-				// CSS 2.1 §6.4.3: Pseudo-classes count as class selectors (specificity C)
-				// CSS 2.1 §6.4.3: Pseudo-elements count as element selectors (specificity D)
+			if token.Type != IdentToken {
+				return nil
+			}
+			pseudoName := strings.ToLower(token.Value)
+			p.tokenizer.Next() // consume identifier (e.g., "link", "nth-child", "before")
+			parsed = true
+
+			// Functional pseudo-classes like :nth-child(2n+1) or :not(.a)
+			if p.tokenizer.Peek().Type == LeftParenToken {
+				p.tokenizer.Next() // consume '('
+				arg := p.consumeUntilCloseParen()
 				if isPseudoElement {
+					// e.g. ::slotted(), ::part() - not supported; keep for specificity
 					simple.PseudoElements = append(simple.PseudoElements, pseudoName)
-				} else {
-					simple.PseudoClasses = append(simple.PseudoClasses, pseudoName)
+					continue
 				}
-			}
-			
-			// Handle functional pseudo-classes like :nth-child(2n+1)
-			token = p.tokenizer.Peek()
-			if token.Type == LeftParenToken {
-				p.tokenizer.Next() // consume '('
-				// Skip everything until ')'
-				parenDepth := 1
-				for parenDepth > 0 {
-					token = p.tokenizer.Next()
-					if token.Type == EOFToken {
-						break
-					}
-					if token.Type == LeftParenToken {
-						parenDepth++
-					} else if token.Type == RightParenToken {
-						parenDepth--
-					}
+				fn := parsePseudoFunction(pseudoName, arg)
+				if fn == nil {
+					log.Debugf("CSS parse error: invalid argument for :%s(%s)", pseudoName, arg)
+					return nil
 				}
+				simple.PseudoFunctions = append(simple.PseudoFunctions, fn)
+				continue
+			}
+
+			// CSS 2.1 §5.12.3: :before and :after may use the single-colon syntax
+			if isPseudoElement || isLegacyPseudoElement(pseudoName) {
+				simple.PseudoElements = append(simple.PseudoElements, pseudoName)
+			} else {
+				simple.PseudoClasses = append(simple.PseudoClasses, pseudoName)
 			}
 		} else {
 			break
@@ -331,13 +769,224 @@ func (p *Parser) parseSimpleSelector() *SimpleSelector {
 	}
 
 	// Check if we actually parsed anything
-	if simple.TagName == "" && simple.ID == "" && len(simple.Classes) == 0 {
+	if !parsed {
 		return nil
 	}
 
 	return simple
 }
 
+// isLegacyPseudoElement reports whether a single-colon name is one of the
+// CSS 2.1 pseudo-elements that predate the '::' syntax.
+// Selectors Level 3 §7: ":first-line, :first-letter, :before and :after"
+func isLegacyPseudoElement(name string) bool {
+	switch name {
+	case "before", "after", "first-line", "first-letter":
+		return true
+	}
+	return false
+}
+
+// consumeUntilCloseParen consumes tokens up to and including the ')' matching
+// an already-consumed '(' and returns the raw source text between them.
+func (p *Parser) consumeUntilCloseParen() string {
+	start := p.tokenizer.pos
+	end := start
+	depth := 1
+	for depth > 0 {
+		end = p.tokenizer.pos
+		token := p.tokenizer.Next()
+		switch token.Type {
+		case EOFToken:
+			return strings.TrimSpace(p.tokenizer.input[start:])
+		case LeftParenToken:
+			depth++
+		case RightParenToken:
+			depth--
+		}
+	}
+	return strings.TrimSpace(p.tokenizer.input[start:end])
+}
+
+// parsePseudoFunction parses the argument of a functional pseudo-class.
+// Returns nil if the pseudo-class is unknown or its argument is invalid.
+func parsePseudoFunction(name, arg string) *PseudoFunction {
+	fn := &PseudoFunction{Name: name}
+
+	switch name {
+	case "nth-child", "nth-last-child", "nth-of-type", "nth-last-of-type":
+		// Selectors Level 4 §14.4.1: :nth-child(An+B [of S]?)
+		nthPart := arg
+		if name == "nth-child" || name == "nth-last-child" {
+			if idx := indexOfKeyword(arg, "of"); idx >= 0 {
+				nthPart = arg[:idx]
+				fn.Selectors = parseSelectorList(arg[idx+2:], false)
+				if len(fn.Selectors) == 0 {
+					return nil
+				}
+			}
+		}
+		nth, ok := ParseNth(nthPart)
+		if !ok {
+			return nil
+		}
+		fn.Nth = nth
+	case "not", "is", "where", "matches", "any", "-webkit-any":
+		// Selectors Level 4 §4.2-§4.4: selector list arguments
+		// :matches() and :-webkit-any() are legacy names for :is()
+		if name != "not" && name != "where" {
+			fn.Name = "is"
+		}
+		fn.Selectors = parseSelectorList(arg, false)
+		if len(fn.Selectors) == 0 && name == "not" {
+			return nil
+		}
+	case "has":
+		// Selectors Level 4 §4.5: :has(<relative-selector-list>)
+		fn.Selectors = parseSelectorList(arg, true)
+		if len(fn.Selectors) == 0 {
+			return nil
+		}
+	default:
+		// Unknown functional pseudo-classes (e.g. :lang(), :dir()) never match
+		log.Debugf("Unsupported functional pseudo-class :%s()", name)
+	}
+
+	return fn
+}
+
+// indexOfKeyword returns the byte offset of a whitespace-delimited keyword in
+// s (case-insensitive), or -1 if it is not present.
+func indexOfKeyword(s, keyword string) int {
+	lower := strings.ToLower(s)
+	for i := 0; i+len(keyword) <= len(lower); i++ {
+		if lower[i:i+len(keyword)] != keyword {
+			continue
+		}
+		before := i == 0 || isSpaceByte(lower[i-1])
+		after := i+len(keyword) == len(lower) || isSpaceByte(lower[i+len(keyword)])
+		if before && after {
+			return i
+		}
+	}
+	return -1
+}
+
+// isSpaceByte reports whether b is CSS whitespace.
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// sourceSince returns the input from start to the tokenizer's position,
+// without surrounding whitespace.
+func (p *Parser) sourceSince(start int) string {
+	return strings.TrimSpace(p.tokenizer.input[start:p.tokenizer.pos])
+}
+
+// parseSelectorList parses a comma-separated selector list from raw text.
+// Invalid entries are dropped, giving the "forgiving" behavior of :is() and
+// :where() (Selectors Level 4 §3.4).
+func parseSelectorList(input string, relative bool) []*Selector {
+	parser := NewParser(input)
+	selectors := make([]*Selector, 0)
+	for {
+		var selector *Selector
+		parser.tokenizer.skipTrivia()
+		start := parser.tokenizer.pos
+		if relative {
+			selector = parser.parseRelativeSelector()
+		} else {
+			selector = parser.parseSelector()
+		}
+		if selector != nil {
+			selector.Text = parser.sourceSince(start)
+		}
+		parser.tokenizer.SkipWhitespace()
+		token := parser.tokenizer.Next()
+		if selector != nil && (token.Type == CommaToken || token.Type == EOFToken) {
+			selectors = append(selectors, selector)
+		}
+		// Skip the remainder of an invalid entry
+		for token.Type != CommaToken && token.Type != EOFToken {
+			token = parser.tokenizer.Next()
+		}
+		if token.Type == EOFToken {
+			break
+		}
+	}
+	return selectors
+}
+
+// ParseSelectors parses a comma-separated selector list such as
+// "ul > li:first-child, .nav a". Invalid selectors are omitted.
+// CSS 2.1 §5.2 Selector syntax
+func ParseSelectors(input string) []*Selector {
+	return parseSelectorList(input, false)
+}
+
+// ParseNth parses the An+B microsyntax, including the 'odd' and 'even'
+// keywords, e.g. "2n+1", "-n + 3", "odd", "5". Whitespace may surround the
+// expression and the sign of B, but not split An or a signed B.
+// CSS Syntax Level 3 §6 The An+B microsyntax
+func ParseNth(input string) (NthExpr, bool) {
+	s := strings.ToLower(strings.TrimSpace(input))
+	switch s {
+	case "":
+		return NthExpr{}, false
+	case "odd":
+		return NthExpr{A: 2, B: 1}, true
+	case "even":
+		return NthExpr{A: 2, B: 0}, true
+	}
+
+	nIdx := strings.IndexByte(s, 'n')
+	if nIdx < 0 {
+		b, ok := parseNthInteger(s)
+		return NthExpr{A: 0, B: b}, ok
+	}
+
+	var expr NthExpr
+	switch aPart := s[:nIdx]; aPart {
+	case "", "+":
+		expr.A = 1
+	case "-":
+		expr.A = -1
+	default:
+		a, ok := parseNthInteger(aPart)
+		if !ok {
+			return NthExpr{}, false
+		}
+		expr.A = a
+	}
+
+	if bPart := strings.TrimSpace(s[nIdx+1:]); bPart != "" {
+		if bPart[0] != '+' && bPart[0] != '-' {
+			return NthExpr{}, false
+		}
+		// The sign may be a token of its own, followed by whitespace
+		b, ok := parseNthInteger(strings.TrimLeft(bPart[1:], " \t\n\r\f"))
+		if !ok || strings.ContainsAny(bPart[1:], "+-") {
+			return NthExpr{}, false
+		}
+		if bPart[0] == '-' {
+			b = -b
+		}
+		expr.B = b
+	}
+
+	return expr, true
+}
+
+// parseNthInteger parses an optionally signed integer of An+B, which may
+// not contain whitespace.
+func parseNthInteger(s string) (int, bool) {
+	if strings.ContainsAny(s, " \t\n\r\f") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
 // parseDeclarations parses declarations within a rule.
 // CSS 2.1 §4.1.8 Declarations and properties
 func (p *Parser) parseDeclarations() []*Declaration {
@@ -392,6 +1041,16 @@ func (p *Parser) parseDeclaration() *Declaration {
 
 	p.tokenizer.SkipWhitespace()
 
+	// CSS Variables Level 1 §2: custom property values are kept as written
+	if IsCustomProperty(property) {
+		value, important := splitImportant(p.readCustomPropertyValue())
+		return &Declaration{
+			Property:  property,
+			Value:     value,
+			Important: important,
+		}
+	}
+
 	// Parse value (simplified - just concatenate tokens until ';' or '}')
 	value := ""
 	for {
@@ -400,22 +1059,6 @@ func (p *Parser) parseDeclaration() *Declaration {
 			break
 		}
 		
-		// CSS 2.1 §6.4.2: Check for !important - not yet implemented
-		// Look ahead for '!' followed by 'important'
-		if token.Type == IdentToken && token.Value == "!" {
-			savedPos := p.tokenizer.pos
-			p.tokenizer.Next() // consume '!'
-			p.tokenizer.SkipWhitespace()
-			nextToken := p.tokenizer.Peek()
-			if nextToken.Type == IdentToken && nextToken.Value == "important" {
-				log.Warnf("CSS 2.1 §6.4.2: !important declarations not yet implemented (property: %s)", property)
-				p.tokenizer.Next() // consume "important"
-				break
-			}
-			// Not !important, restore and continue
-			p.tokenizer.pos = savedPos
-		}
-
 		p.tokenizer.Next()
 
 		if token.Type == WhitespaceToken {
@@ -425,15 +1068,62 @@ func (p *Parser) parseDeclaration() *Declaration {
 		} else if token.Type == HashToken {
 			// CSS 2.1 §4.3.6: Preserve # prefix for color values
 			value += "#" + token.Value
+		} else if token.Type == StringToken {
+			// CSS 2.1 §4.3.7: Keep strings quoted so 'content' and 'quotes'
+			// can tell them apart from keywords such as open-quote
+			value += quoteString(token.Value)
+		} else if token.Type == IdentToken && strings.EqualFold(token.Value, "url") && p.tokenizer.pos < len(p.tokenizer.input) && p.tokenizer.input[p.tokenizer.pos] == '(' {
+			// CSS 2.1 §4.3.4: The contents of url() are taken verbatim, so
+			// data URLs may contain ';' and other delimiters
+			value += token.Value + p.readURLArgument()
 		} else {
 			value += token.Value
 		}
 	}
 
+	value, important := splitImportant(value)
 	return &Declaration{
-		Property: property,
-		Value:    value,
+		Property:  property,
+		Value:     value,
+		Important: important,
+	}
+}
+
+// splitImportant removes a trailing !important from value, reporting
+// whether there was one. Whitespace may separate '!' and 'important', whose
+// case does not matter.
+// CSS 2.1 §6.4.2 !important rules
+func splitImportant(value string) (string, bool) {
+	bang := strings.LastIndexByte(value, '!')
+	if bang < 0 || !strings.EqualFold(strings.TrimSpace(value[bang+1:]), "important") {
+		return value, false
+	}
+	return strings.TrimSpace(value[:bang]), true
+}
+
+// readURLArgument consumes the parenthesized argument of url(), starting at
+// the '(', and returns it verbatim including the parentheses. Quoted
+// strings are skipped over so that a ')' inside them does not end the URL.
+func (p *Parser) readURLArgument() string {
+	input := p.tokenizer.input
+	start := p.tokenizer.pos
+	i := start + 1
+	for i < len(input) && input[i] != ')' {
+		if c := input[i]; c == '"' || c == '\'' {
+			i++
+			for i < len(input) && input[i] != c {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		} else if c == '\\' {
+			i++
+		}
+		i++
 	}
+	p.tokenizer.pos = min(i+1, len(input))
+	return input[start:p.tokenizer.pos]
 }
 
 // Parse is a convenience function to parse CSS.
@@ -1,6 +1,9 @@
 package css
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestParseSimpleRule(t *testing.T) {
 	input := "div { color: red; }"
@@ -288,43 +291,162 @@ input[type='submit'] { font-family: Verdana; }
 	}
 }
 
-// TestParseAtRule tests that @-rules are skipped gracefully.
+// TestParseAtRule tests that unsupported @-rules are skipped gracefully.
 // CSS 2.1 §4.1.5 At-rules
 func TestParseAtRule(t *testing.T) {
 	input := `
 body { color: black; }
-@media screen and (max-width: 600px) {
-body { color: blue; }
-}
+@import url("other.css");
+@keyframes spin { from { color: red; } to { color: blue; } }
 .test { color: red; }
 `
 	stylesheet := Parse(input)
 
-	// Should parse successfully and have the body and .test rules
-	if len(stylesheet.Rules) < 2 {
-		t.Errorf("Expected at least 2 rules, got %d", len(stylesheet.Rules))
+	if len(stylesheet.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(stylesheet.Rules))
+	}
+	if stylesheet.Rules[0].Selectors[0].Simple[0].TagName != "body" {
+		t.Error("Expected body rule to be parsed")
+	}
+	if classes := stylesheet.Rules[1].Selectors[0].Simple[0].Classes; len(classes) != 1 || classes[0] != "test" {
+		t.Error("Expected .test rule to be parsed")
 	}
+}
 
-	// Check that we have body and .test rules
-	foundBody := false
-	foundTest := false
-	for _, rule := range stylesheet.Rules {
-		if len(rule.Selectors) > 0 && len(rule.Selectors[0].Simple) > 0 {
-			simple := rule.Selectors[0].Simple[0]
-			if simple.TagName == "body" {
-				foundBody = true
-			}
-			if len(simple.Classes) > 0 && simple.Classes[0] == "test" {
-				foundTest = true
+// TestParseImportRule tests parsing of @import rules and that they are
+// ignored after other rules.
+// CSS 2.1 §6.3 The @import rule
+func TestParseImportRule(t *testing.T) {
+	input := `
+@charset "utf-8";
+@import "base.css";
+@import url(theme.css) screen and (min-width: 600px);
+@import url('data:text/css;base64,cCB7fQ==') print;
+@import bogus.css;
+p { color: red; }
+@import "late.css";
+@media print { @import "nested.css"; }
+`
+	stylesheet := Parse(input)
+
+	expected := []struct {
+		url   string
+		media string
+	}{
+		{"base.css", ""},
+		{"theme.css", "screen and (min-width: 600px)"},
+		{"data:text/css;base64,cCB7fQ==", "print"},
+	}
+	if len(stylesheet.Imports) != len(expected) {
+		t.Fatalf("Expected %d imports, got %d", len(expected), len(stylesheet.Imports))
+	}
+	for i, want := range expected {
+		imp := stylesheet.Imports[i]
+		if imp.URL != want.url || imp.Media.String() != want.media {
+			t.Errorf("Import %d: expected %q %q, got %q %q", i, want.url, want.media, imp.URL, imp.Media.String())
+		}
+	}
+	if len(stylesheet.Rules) != 1 {
+		t.Errorf("Expected 1 rule, got %d", len(stylesheet.Rules))
+	}
+}
+
+// TestParseMediaRule tests that rules inside @media blocks, including nested
+// ones, are parsed and carry their media query lists.
+// CSS 2.1 §7.2.1 The @media rule
+func TestParseMediaRule(t *testing.T) {
+	input := `
+body { color: black; }
+@media screen and (max-width: 600px) {
+	body { color: blue; }
+	@media /* nested */ (orientation: portrait) {
+		p { color: green; }
+	}
+	@font-face { font-family: x; }
+	h1 { color: red; }
+}
+@media print;
+.test { color: red; }
+`
+	stylesheet := Parse(input)
+
+	expected := []struct {
+		tag   string
+		media []string
+	}{
+		{"body", nil},
+		{"body", []string{"screen and (max-width: 600px)"}},
+		{"p", []string{"screen and (max-width: 600px)", "(orientation: portrait)"}},
+		{"h1", []string{"screen and (max-width: 600px)"}},
+		{"", nil},
+	}
+	if len(stylesheet.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(stylesheet.Rules))
+	}
+	for i, want := range expected {
+		rule := stylesheet.Rules[i]
+		if tag := rule.Selectors[0].Simple[0].TagName; tag != want.tag {
+			t.Errorf("Rule %d: expected selector %q, got %q", i, want.tag, tag)
+		}
+		if len(rule.Media) != len(want.media) {
+			t.Errorf("Rule %d: expected %d media lists, got %d", i, len(want.media), len(rule.Media))
+			continue
+		}
+		for j, media := range rule.Media {
+			if media.String() != want.media[j] {
+				t.Errorf("Rule %d: expected media %q, got %q", i, want.media[j], media.String())
 			}
 		}
 	}
 
-	if !foundBody {
-		t.Error("Expected body rule to be parsed")
+	narrow := MediaEnvironment{Type: "screen", Width: 400, Height: 300}
+	if !stylesheet.Rules[1].MatchesMedia(narrow) || stylesheet.Rules[2].MatchesMedia(narrow) {
+		t.Errorf("Expected only the outer @media to match a landscape 400px screen")
 	}
-	if !foundTest {
-		t.Error("Expected .test rule to be parsed")
+	if stylesheet.Rules[1].MatchesMedia(DefaultMediaEnvironment()) {
+		t.Errorf("Expected max-width: 600px not to match the default 800px screen")
+	}
+}
+
+// TestParseFontFaceRule tests that @font-face rules are collected with
+// their descriptors and enclosing media, and that data URLs survive
+// declaration parsing.
+// CSS Fonts Level 4 §4.1 The @font-face rule
+func TestParseFontFaceRule(t *testing.T) {
+	input := `
+@font-face {
+	font-family: "Open Sans";
+	src: url(data:font/woff2;base64,d09GMg==) format("woff2"), url('fonts/open.ttf');
+	font-weight: 300 700;
+}
+p { font-family: "Open Sans", sans-serif; }
+@media print {
+	@font-face { font-family: Print; src: local(Print) }
+}
+`
+	stylesheet := Parse(input)
+	if len(stylesheet.FontFaces) != 2 {
+		t.Fatalf("Expected 2 font faces, got %d", len(stylesheet.FontFaces))
+	}
+	if len(stylesheet.Rules) != 1 {
+		t.Errorf("Expected 1 rule, got %d", len(stylesheet.Rules))
+	}
+
+	face := stylesheet.FontFaces[0]
+	if got := face.Descriptor("font-family"); got != `"Open Sans"` {
+		t.Errorf("Expected font-family %q, got %q", `"Open Sans"`, got)
+	}
+	if got := face.Descriptor("font-weight"); got != "300 700" {
+		t.Errorf("Expected font-weight %q, got %q", "300 700", got)
+	}
+	sources := ParseFontSources(face.Descriptor("src"))
+	if len(sources) != 2 || sources[0].URL != "data:font/woff2;base64,d09GMg==" || sources[0].Format != "woff2" || sources[1].URL != "fonts/open.ttf" {
+		t.Errorf("Unexpected sources %+v", sources)
+	}
+
+	printFace := stylesheet.FontFaces[1]
+	if printFace.MatchesMedia(DefaultMediaEnvironment()) {
+		t.Error("Expected the @media print font face not to match a screen")
 	}
 }
 
@@ -332,67 +454,244 @@ body { color: blue; }
 // These tests document known limitations that need to be implemented.
 // See MILESTONES.md for more details.
 
-func TestParsePseudoClasses_Skipped(t *testing.T) {
-	t.Skip("Pseudo-classes not implemented - CSS 2.1 §5.11")
-	// CSS 2.1 §5.11 Pseudo-classes
-	// Common pseudo-classes include :hover, :active, :focus, :first-child, :last-child, :nth-child
-	
-	input := "a:hover { color: red; } p:first-child { margin-top: 0; }"
-	_ = Parse(input)
-	
-	// When implemented, parser should recognize pseudo-classes
-	// Expected structure would include PseudoClass field in SimpleSelector
-	// For now, this gracefully fails/skips the selector
+// TestParsePseudoClasses tests parsing of simple and functional pseudo-classes.
+// CSS 2.1 §5.11, Selectors Level 4 §4 and §14
+func TestParsePseudoClasses(t *testing.T) {
+	stylesheet := Parse("a:hover { color: red; } li:nth-child(2n+1):not(.skip, #x) { margin-top: 0; }")
+	if len(stylesheet.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(stylesheet.Rules))
+	}
+
+	hover := stylesheet.Rules[0].Selectors[0].Simple[0]
+	if hover.TagName != "a" || len(hover.PseudoClasses) != 1 || hover.PseudoClasses[0] != "hover" {
+		t.Errorf("Expected a:hover, got %+v", hover)
+	}
+
+	li := stylesheet.Rules[1].Selectors[0].Simple[0]
+	if li.TagName != "li" || len(li.PseudoFunctions) != 2 {
+		t.Fatalf("Expected li with 2 functional pseudo-classes, got %+v", li)
+	}
+	nth := li.PseudoFunctions[0]
+	if nth.Name != "nth-child" || nth.Nth != (NthExpr{A: 2, B: 1}) {
+		t.Errorf("Expected nth-child(2n+1), got %s %+v", nth.Name, nth.Nth)
+	}
+	not := li.PseudoFunctions[1]
+	if not.Name != "not" || len(not.Selectors) != 2 {
+		t.Fatalf("Expected :not with 2 selectors, got %s with %d", not.Name, len(not.Selectors))
+	}
+	if not.Selectors[0].Simple[0].Classes[0] != "skip" || not.Selectors[1].Simple[0].ID != "x" {
+		t.Errorf("Unexpected :not arguments: %+v %+v", not.Selectors[0].Simple[0], not.Selectors[1].Simple[0])
+	}
 }
 
-func TestParsePseudoElements_Skipped(t *testing.T) {
-	t.Skip("Pseudo-elements not implemented - CSS 2.1 §5.12")
-	// CSS 2.1 §5.12 Pseudo-elements
-	// Common pseudo-elements include ::before, ::after, ::first-line, ::first-letter
-	
-	input := "p::before { content: '→ '; } p::after { content: ' ←'; }"
-	_ = Parse(input)
-	
-	// When implemented, parser should recognize pseudo-elements
-	// Expected structure would include PseudoElement field in SimpleSelector
-	// For now, this gracefully fails/skips the selector
+// TestParseBarePseudoClass tests selectors made only of pseudo-classes or
+// the universal selector.
+func TestParseBarePseudoClass(t *testing.T) {
+	stylesheet := Parse(":root { color: red; } *:first-child { color: blue; } :where(p) { color: green; }")
+	if len(stylesheet.Rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(stylesheet.Rules))
+	}
+	if got := stylesheet.Rules[0].Selectors[0].Simple[0].PseudoClasses; len(got) != 1 || got[0] != "root" {
+		t.Errorf("Expected :root, got %v", got)
+	}
+	if got := stylesheet.Rules[1].Selectors[0].Simple[0].TagName; got != "*" {
+		t.Errorf("Expected universal selector, got %q", got)
+	}
+	if got := stylesheet.Rules[2].Selectors[0].Simple[0].PseudoFunctions[0].Name; got != "where" {
+		t.Errorf("Expected :where, got %q", got)
+	}
 }
 
-func TestParseChildCombinator_Skipped(t *testing.T) {
-	t.Skip("Child combinator not implemented - CSS 2.1 §5.5")
-	// CSS 2.1 §5.5 Child selectors
-	// The child combinator (>) selects direct children only
-	
-	input := "div > p { color: blue; }"
-	_ = Parse(input)
-	
-	// When implemented, the Selector structure would include a Combinator field
-	// to distinguish between descendant (space) and child (>) combinators
-	// For now, this might parse but treat '>' as a descendant combinator
+// TestParseNthChildOf tests the "An+B of S" form of :nth-child().
+// Selectors Level 4 §14.4.1
+func TestParseNthChildOf(t *testing.T) {
+	selectors := ParseSelectors("tr:nth-child(even of .visible)")
+	if len(selectors) != 1 {
+		t.Fatalf("Expected 1 selector, got %d", len(selectors))
+	}
+	fn := selectors[0].Simple[0].PseudoFunctions[0]
+	if fn.Nth != (NthExpr{A: 2, B: 0}) {
+		t.Errorf("Expected even (2n), got %+v", fn.Nth)
+	}
+	if len(fn.Selectors) != 1 || fn.Selectors[0].Simple[0].Classes[0] != "visible" {
+		t.Errorf("Expected 'of .visible', got %+v", fn.Selectors)
+	}
 }
 
-func TestParseAdjacentSiblingCombinator_Skipped(t *testing.T) {
-	t.Skip("Adjacent sibling combinator not implemented - CSS 2.1 §5.7")
-	// CSS 2.1 §5.7 Adjacent sibling selectors
-	// The adjacent sibling combinator (+) selects the immediately following sibling
-	
-	input := "h1 + p { margin-top: 0; }"
-	_ = Parse(input)
-	
-	// When implemented, would need Combinator field to distinguish sibling selectors
-	// For now, this might not parse correctly
+// TestParseHasRelativeSelectors tests :has() with leading combinators.
+// Selectors Level 4 §4.5
+func TestParseHasRelativeSelectors(t *testing.T) {
+	selectors := ParseSelectors("li:has(> a.active, + li)")
+	if len(selectors) != 1 {
+		t.Fatalf("Expected 1 selector, got %d", len(selectors))
+	}
+	fn := selectors[0].Simple[0].PseudoFunctions[0]
+	if fn.Name != "has" || len(fn.Selectors) != 2 {
+		t.Fatalf("Expected :has with 2 relative selectors, got %s with %d", fn.Name, len(fn.Selectors))
+	}
+	if fn.Selectors[0].Leading != ChildCombinator {
+		t.Errorf("Expected leading '>', got %v", fn.Selectors[0].Leading)
+	}
+	if fn.Selectors[1].Leading != AdjacentSiblingCombinator {
+		t.Errorf("Expected leading '+', got %v", fn.Selectors[1].Leading)
+	}
 }
 
-func TestParseGeneralSiblingCombinator_Skipped(t *testing.T) {
-	t.Skip("General sibling combinator not implemented - CSS 3 Selectors")
-	// CSS 3 Selectors §8.3.2 General sibling combinator
-	// The general sibling combinator (~) selects all following siblings
-	
-	input := "h1 ~ p { color: gray; }"
-	_ = Parse(input)
-	
-	// When implemented, would need Combinator field for general sibling matching
-	// For now, this might not parse correctly
+// TestParseInvalidPseudoFunction tests that invalid arguments drop the rule.
+func TestParseInvalidPseudoFunction(t *testing.T) {
+	stylesheet := Parse("li:nth-child(foo) { color: red; } p { color: blue; }")
+	if len(stylesheet.Rules) != 1 {
+		t.Fatalf("Expected only the valid rule, got %d rules", len(stylesheet.Rules))
+	}
+	if stylesheet.Rules[0].Selectors[0].Simple[0].TagName != "p" {
+		t.Errorf("Expected p rule to survive")
+	}
+}
+
+// TestParseNth tests the An+B microsyntax.
+// CSS Syntax Level 3 §6
+func TestParseNth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected NthExpr
+		ok       bool
+	}{
+		{"odd", NthExpr{A: 2, B: 1}, true},
+		{"even", NthExpr{A: 2, B: 0}, true},
+		{"3", NthExpr{A: 0, B: 3}, true},
+		{"2n+1", NthExpr{A: 2, B: 1}, true},
+		{"2n + 1", NthExpr{A: 2, B: 1}, true},
+		{"-n+3", NthExpr{A: -1, B: 3}, true},
+		{"n", NthExpr{A: 1, B: 0}, true},
+		{"+n-2", NthExpr{A: 1, B: -2}, true},
+		{"3n-1", NthExpr{A: 3, B: -1}, true},
+		{"-2n", NthExpr{A: -2, B: 0}, true},
+		{"", NthExpr{}, false},
+		{"foo", NthExpr{}, false},
+		{"2n1", NthExpr{}, false},
+
+		// Whitespace around the expression and the sign of B
+		{"  2n+1 ", NthExpr{A: 2, B: 1}, true},
+		{"2n- 1", NthExpr{A: 2, B: -1}, true},
+		{"2n +1", NthExpr{A: 2, B: 1}, true},
+		{" - n + 3", NthExpr{}, false},
+		{"2 n+1", NthExpr{}, false},
+		{"+ n", NthExpr{}, false},
+		{"2n+1 0", NthExpr{}, false},
+		{"2n+ -1", NthExpr{}, false},
+		{"1 0", NthExpr{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := ParseNth(tt.input)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("ParseNth(%q) = %+v, %v; want %+v, %v", tt.input, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+// TestNthExprMatches tests index matching for An+B expressions.
+func TestNthExprMatches(t *testing.T) {
+	tests := []struct {
+		expr    NthExpr
+		matches []int
+	}{
+		{NthExpr{A: 2, B: 1}, []int{1, 3, 5}},
+		{NthExpr{A: 2, B: 0}, []int{2, 4, 6}},
+		{NthExpr{A: -1, B: 3}, []int{1, 2, 3}},
+		{NthExpr{A: 0, B: 4}, []int{4}},
+		{NthExpr{A: 3, B: -1}, []int{2, 5}},
+	}
+
+	for _, tt := range tests {
+		want := make(map[int]bool)
+		for _, i := range tt.matches {
+			want[i] = true
+		}
+		for i := 1; i <= 6; i++ {
+			if got := tt.expr.Matches(i); got != want[i] {
+				t.Errorf("%+v.Matches(%d) = %v, want %v", tt.expr, i, got, want[i])
+			}
+		}
+	}
+}
+
+// TestParsePseudoElements tests ::before/::after selectors and their content strings.
+// CSS 2.1 §5.12 Pseudo-elements, §12.2 The 'content' property
+func TestParsePseudoElements(t *testing.T) {
+	input := "p::before { content: '→ '; } p:after { content: \" ←\"; }"
+	stylesheet := Parse(input)
+
+	if len(stylesheet.Rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(stylesheet.Rules))
+	}
+
+	expected := []struct {
+		pseudo  string
+		content string
+	}{
+		{"before", `"→ "`},
+		{"after", `" ←"`},
+	}
+	for i, rule := range stylesheet.Rules {
+		simple := rule.Selectors[0].Simple[0]
+		if len(simple.PseudoElements) != 1 || simple.PseudoElements[0] != expected[i].pseudo {
+			t.Errorf("Rule %d: expected pseudo-element %q, got %v", i, expected[i].pseudo, simple.PseudoElements)
+		}
+		if got := rule.Declarations[0].Value; got != expected[i].content {
+			t.Errorf("Rule %d: expected content %s, got %s", i, expected[i].content, got)
+		}
+	}
+}
+
+// TestParseCombinators tests child, adjacent sibling and general sibling combinators.
+// CSS 2.1 §5.6, §5.7, Selectors Level 3 §8.3.2
+func TestParseCombinators(t *testing.T) {
+	tests := []struct {
+		input       string
+		combinators []Combinator
+	}{
+		{"div > p", []Combinator{ChildCombinator}},
+		{"div>p", []Combinator{ChildCombinator}},
+		{"h1 + p", []Combinator{AdjacentSiblingCombinator}},
+		{"h1 ~ p", []Combinator{GeneralSiblingCombinator}},
+		{"ul li > a", []Combinator{DescendantCombinator, ChildCombinator}},
+		{"div p", []Combinator{DescendantCombinator}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			stylesheet := Parse(tt.input + " { color: blue; }")
+			if len(stylesheet.Rules) != 1 {
+				t.Fatalf("Expected 1 rule, got %d", len(stylesheet.Rules))
+			}
+			selector := stylesheet.Rules[0].Selectors[0]
+			if len(selector.Simple) != len(tt.combinators)+1 {
+				t.Fatalf("Expected %d compound selectors, got %d", len(tt.combinators)+1, len(selector.Simple))
+			}
+			for i, want := range tt.combinators {
+				if got := selector.CombinatorAt(i); got != want {
+					t.Errorf("Combinator %d: expected %v, got %v", i, want, got)
+				}
+			}
+			if tt.input == "div p" && selector.Combinators != nil {
+				t.Errorf("Expected nil Combinators for descendant-only selector, got %v", selector.Combinators)
+			}
+		})
+	}
+}
+
+// TestParseDanglingCombinator tests that a combinator without a right-hand
+// side invalidates the selector.
+func TestParseDanglingCombinator(t *testing.T) {
+	stylesheet := Parse("div > { color: blue; } p { color: red; }")
+	for _, rule := range stylesheet.Rules {
+		if rule.Selectors[0].Simple[0].TagName == "div" {
+			t.Errorf("Expected 'div >' selector to be rejected")
+		}
+	}
 }
 
 func TestParseAttributeSelectorMatching_Skipped(t *testing.T) {
@@ -506,3 +805,73 @@ func TestParseInlineStyle(t *testing.T) {
 		})
 	}
 }
+
+// TestParseRuleLocations tests that rules record the line of their first
+// selector, past comments, and selectors the text they were written as.
+func TestParseRuleLocations(t *testing.T) {
+	stylesheet := Parse("p { color: red; }\n" +
+		"/* a comment\n   on two lines */\n" +
+		"h1 ,  h2>em , li:has(> a.x, + li) {\n  color: blue;\n}\n" +
+		"@media screen {\n  .a { color: green; }\n}\n" +
+		"bad( { color: black; }\n" +
+		"#b { color: white; }")
+
+	expected := []struct {
+		line      int
+		selectors []string
+	}{
+		{1, []string{"p"}},
+		{4, []string{"h1", "h2>em", "li:has(> a.x, + li)"}},
+		{8, []string{".a"}},
+		{11, []string{"#b"}},
+	}
+	if len(stylesheet.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(stylesheet.Rules))
+	}
+	for i, rule := range stylesheet.Rules {
+		if rule.Location.Line != expected[i].line {
+			t.Errorf("Rule %d: expected line %d, got %d", i, expected[i].line, rule.Location.Line)
+		}
+		var texts []string
+		for _, selector := range rule.Selectors {
+			texts = append(texts, selector.Text)
+		}
+		if strings.Join(texts, "|") != strings.Join(expected[i].selectors, "|") {
+			t.Errorf("Rule %d: expected selectors %q, got %q", i, expected[i].selectors, texts)
+		}
+	}
+
+	has := stylesheet.Rules[1].Selectors[2].Simple[0].PseudoFunctions[0]
+	if has.Selectors[0].Text != "> a.x" || has.Selectors[1].Text != "+ li" {
+		t.Errorf("Expected the text of :has() arguments, got %q and %q", has.Selectors[0].Text, has.Selectors[1].Text)
+	}
+}
+
+// TestParseImportant tests that a trailing !important marks a declaration
+// important and is removed from its value.
+// CSS 2.1 §6.4.2 !important rules
+func TestParseImportant(t *testing.T) {
+	tests := []struct {
+		input     string
+		value     string
+		important bool
+	}{
+		{"color: red !important", "red", true},
+		{"margin: 1px 2px!IMPORTANT", "1px 2px", true},
+		{"width: 3px ! important", "3px", true},
+		{"--accent: blue !important", "blue", true},
+		{"color: red", "red", false},
+		{"content: \"!important\"", "\"!important\"", false},
+		{"color: red !importantly", "red !importantly", false},
+	}
+	for _, tt := range tests {
+		decls := ParseInlineStyle(tt.input)
+		if len(decls) != 1 {
+			t.Errorf("%q: expected 1 declaration, got %d", tt.input, len(decls))
+			continue
+		}
+		if strings.TrimSpace(decls[0].Value) != tt.value || decls[0].Important != tt.important {
+			t.Errorf("%q: expected %q important=%v, got %q important=%v", tt.input, tt.value, tt.important, decls[0].Value, decls[0].Important)
+		}
+	}
+}
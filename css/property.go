@@ -0,0 +1,291 @@
+package css
+
+// This file contains the model and syntax matching for @property rules,
+// which register custom properties with a type, an initial value and
+// whether they inherit.
+//
+// Spec references:
+// - CSS Properties and Values API Level 1 §3 The @property rule: https://www.w3.org/TR/css-properties-values-api-1/#at-property-rule
+// - CSS Properties and Values API Level 1 §5 Syntax strings: https://www.w3.org/TR/css-properties-values-api-1/#syntax-strings
+//
+// Implemented:
+// - The syntax, inherits and initial-value descriptors
+// - Syntax strings of data type names, keywords, | alternatives and the + and # multipliers
+// - The <length>, <percentage>, <length-percentage>, <number>, <integer>, <color> and <custom-ident> types
+//
+// Not implemented:
+// - Other data types, such as <angle>, <time>, <image> and <url>, which make the rule invalid
+// - registerProperty() and animation of registered properties
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lukehoban/browser/log"
+)
+
+// PropertyRule represents a valid @property rule.
+// CSS Properties and Values API Level 1 §3 The @property rule
+type PropertyRule struct {
+	// Name is the custom property registered, such as "--gap".
+	Name string
+
+	// Syntax is the syntax string without quotes, "*" for any value.
+	Syntax string
+
+	// Inherits reports whether the property is inherited.
+	Inherits bool
+
+	// InitialValue is the property's initial value. If HasInitialValue is
+	// false, which only a "*" syntax allows, the initial value is the
+	// guaranteed-invalid value.
+	InitialValue    string
+	HasInitialValue bool
+
+	// Media holds the media query lists of enclosing @media rules, as for
+	// Rule.Media.
+	Media []*MediaQueryList
+
+	components []syntaxComponent
+}
+
+// syntaxComponent is one alternative of a syntax string: a data type name
+// such as "length" or a keyword, with an optional multiplier.
+type syntaxComponent struct {
+	name       string
+	keyword    bool
+	multiplier byte // '+' for space-separated lists, '#' for comma-separated lists, or 0
+}
+
+// syntaxTypes are the supported data type names of syntax strings.
+var syntaxTypes = map[string]bool{
+	"length":            true,
+	"percentage":        true,
+	"length-percentage": true,
+	"number":            true,
+	"integer":           true,
+	"color":             true,
+	"custom-ident":      true,
+}
+
+// parsePropertyRule parses an @property rule's descriptor block.
+// CSS Properties and Values API Level 1 §3 The @property rule
+func (p *Parser) parsePropertyRule(media []*MediaQueryList) {
+	// Consume the @property keyword
+	p.tokenizer.Next()
+
+	prelude, terminator := p.readPrelude()
+	if terminator != '{' {
+		return
+	}
+	declarations := p.parseDeclarations()
+	p.skipBlock()
+
+	rule, ok := newPropertyRule(strings.TrimSpace(prelude), declarations)
+	if !ok {
+		log.Debugf("Ignoring invalid @property rule: %s", prelude)
+		return
+	}
+	rule.Media = media
+	p.properties = append(p.properties, rule)
+}
+
+// newPropertyRule builds the @property rule registering name from its
+// descriptors, reporting whether the rule is valid.
+// CSS Properties and Values API Level 1 §3: the syntax and inherits
+// descriptors are required, and initial-value unless the syntax is "*"
+func newPropertyRule(name string, declarations []*Declaration) (*PropertyRule, bool) {
+	if !IsCustomProperty(name) {
+		return nil, false
+	}
+	rule := &PropertyRule{Name: name}
+
+	var syntax, inherits string
+	hasSyntax, hasInherits := false, false
+	for _, decl := range declarations {
+		switch strings.ToLower(decl.Property) {
+		case "syntax":
+			syntax, hasSyntax = strings.TrimSpace(decl.Value), true
+		case "inherits":
+			inherits, hasInherits = strings.ToLower(strings.TrimSpace(decl.Value)), true
+		case "initial-value":
+			rule.InitialValue, rule.HasInitialValue = strings.TrimSpace(decl.Value), true
+		}
+	}
+
+	// The syntax descriptor is a string
+	if !hasSyntax || len(syntax) < 2 || (syntax[0] != '"' && syntax[0] != '\'') {
+		return nil, false
+	}
+	rule.Syntax = strings.TrimSpace(Unquote(syntax))
+	if rule.Syntax != "*" {
+		components, ok := parseSyntax(rule.Syntax)
+		if !ok {
+			return nil, false
+		}
+		rule.components = components
+	}
+
+	if !hasInherits || (inherits != "true" && inherits != "false") {
+		return nil, false
+	}
+	rule.Inherits = inherits == "true"
+
+	// CSS Properties and Values API Level 1 §3.3: the initial value must
+	// parse against the syntax and be computationally independent
+	if rule.Syntax == "*" {
+		return rule, true
+	}
+	if !rule.HasInitialValue || HasVar(rule.InitialValue) || !rule.Matches(rule.InitialValue) {
+		return nil, false
+	}
+	for _, part := range splitComponents(rule.InitialValue) {
+		if length, ok := ParseLength(part); ok && length.IsRelative() {
+			return nil, false
+		}
+	}
+	return rule, true
+}
+
+// parseSyntax parses a syntax string other than "*" into its alternatives.
+// CSS Properties and Values API Level 1 §5.1 Supported names
+func parseSyntax(syntax string) ([]syntaxComponent, bool) {
+	var components []syntaxComponent
+	for _, alternative := range strings.Split(syntax, "|") {
+		alternative = strings.TrimSpace(alternative)
+		var component syntaxComponent
+		if n := len(alternative); n > 0 && (alternative[n-1] == '+' || alternative[n-1] == '#') {
+			component.multiplier = alternative[n-1]
+			alternative = alternative[:n-1]
+		}
+
+		switch {
+		case strings.HasPrefix(alternative, "<") && strings.HasSuffix(alternative, ">"):
+			component.name = alternative[1 : len(alternative)-1]
+			if !syntaxTypes[component.name] {
+				return nil, false
+			}
+		case isIdentifier(alternative) && !IsCSSWideKeyword(alternative):
+			component.name = alternative
+			component.keyword = true
+		default:
+			return nil, false
+		}
+		components = append(components, component)
+	}
+	return components, true
+}
+
+// Matches reports whether value is valid for the rule's syntax.
+// CSS Properties and Values API Level 1 §5.4 Parsing the syntax string
+func (r *PropertyRule) Matches(value string) bool {
+	if r.Syntax == "*" {
+		return true
+	}
+	value = strings.TrimSpace(value)
+	for _, component := range r.components {
+		if component.matches(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchesMedia reports whether every @media rule enclosing r matches env.
+func (r *PropertyRule) MatchesMedia(env MediaEnvironment) bool {
+	for _, media := range r.Media {
+		if !media.Matches(env) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsLength reports whether the rule's syntax holds only lengths and
+// percentages, so that its values compute to absolute lengths.
+func (r *PropertyRule) IsLength() bool {
+	for _, component := range r.components {
+		if component.keyword || (component.name != "length" && component.name != "length-percentage") {
+			return false
+		}
+	}
+	return len(r.components) > 0
+}
+
+// matches reports whether value matches the component, as a list if the
+// component has a multiplier.
+func (c syntaxComponent) matches(value string) bool {
+	var items []string
+	switch c.multiplier {
+	case '+':
+		items = strings.Fields(value)
+	case '#':
+		items = splitCommas(value)
+	default:
+		items = []string{value}
+	}
+	if len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if !c.matchesItem(strings.TrimSpace(item)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesItem reports whether a single value matches the component's type
+// or keyword.
+func (c syntaxComponent) matchesItem(value string) bool {
+	if c.keyword {
+		return value == c.name
+	}
+	switch c.name {
+	case "length", "length-percentage":
+		length, ok := ParseLength(value)
+		if !ok || (c.name == "length" && length.HasPercentage()) {
+			return false
+		}
+		// A unitless number is only a length if it is zero
+		return length.Unit != "" || length.Value == 0 || length.Calc != nil
+	case "percentage":
+		length, ok := ParseLength(value)
+		return ok && length.Unit == "%"
+	case "number":
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	case "integer":
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case "color":
+		return IsColor(value)
+	case "custom-ident":
+		return isIdentifier(value) && !IsCSSWideKeyword(value) && !strings.EqualFold(value, "default")
+	}
+	return false
+}
+
+// isIdentifier reports whether s is a single CSS identifier.
+func isIdentifier(s string) bool {
+	if s == "" || s == "-" || (s[0] >= '0' && s[0] <= '9') || (s[0] == '-' && len(s) > 1 && s[1] >= '0' && s[1] <= '9') {
+		return false
+	}
+	for _, c := range s {
+		if !isNameChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsCSSWideKeyword reports whether s is one of the keywords every property
+// accepts.
+// CSS Values and Units Level 4 §3.1.1 CSS-wide keywords
+func IsCSSWideKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "initial", "inherit", "unset", "revert":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package css
+
+import "testing"
+
+// TestParsePropertyRule tests that valid @property rules are collected and
+// invalid ones dropped.
+// CSS Properties and Values API Level 1 §3 The @property rule
+func TestParsePropertyRule(t *testing.T) {
+	stylesheet := Parse(`
+		@property --gap { syntax: "<length>"; inherits: false; initial-value: 4px }
+		@property --any { syntax: "*"; inherits: true }
+		@media print {
+			@property --print { syntax: '<color>'; inherits: true; initial-value: red }
+		}
+		@property --no-syntax { inherits: false; initial-value: 1px }
+		@property --no-inherits { syntax: "<length>"; initial-value: 1px }
+		@property --no-initial { syntax: "<length>"; inherits: false }
+		@property --mismatch { syntax: "<length>"; inherits: false; initial-value: red }
+		@property --relative { syntax: "<length>"; inherits: false; initial-value: 2em }
+		@property --unknown { syntax: "<angle>"; inherits: false; initial-value: 1deg }
+		@property --unquoted { syntax: <length>; inherits: false; initial-value: 1px }
+		@property not-custom { syntax: "*"; inherits: false }
+		p { color: red }
+	`)
+
+	if len(stylesheet.Rules) != 1 {
+		t.Errorf("Expected 1 style rule, got %d", len(stylesheet.Rules))
+	}
+	if len(stylesheet.Properties) != 3 {
+		t.Fatalf("Expected 3 @property rules, got %d", len(stylesheet.Properties))
+	}
+
+	gap := stylesheet.Properties[0]
+	if gap.Name != "--gap" || gap.Syntax != "<length>" || gap.Inherits || gap.InitialValue != "4px" || !gap.HasInitialValue {
+		t.Errorf("Unexpected --gap rule: %+v", gap)
+	}
+	if !gap.IsLength() {
+		t.Errorf("Expected --gap to have a length syntax")
+	}
+	any := stylesheet.Properties[1]
+	if any.Syntax != "*" || !any.Inherits || any.HasInitialValue {
+		t.Errorf("Unexpected --any rule: %+v", any)
+	}
+	print := stylesheet.Properties[2]
+	if print.Name != "--print" || len(print.Media) != 1 || print.MatchesMedia(DefaultMediaEnvironment()) {
+		t.Errorf("Expected --print to apply to print media only: %+v", print)
+	}
+}
+
+// TestPropertySyntax tests matching values against syntax strings.
+// CSS Properties and Values API Level 1 §5 Syntax strings
+func TestPropertySyntax(t *testing.T) {
+	tests := []struct {
+		syntax  string
+		value   string
+		matches bool
+	}{
+		{"*", "anything { at all }", true},
+		{"<length>", "10px", true},
+		{"<length>", "2em", true},
+		{"<length>", "0", true},
+		{"<length>", "calc(1px + 1em)", true},
+		{"<length>", "10", false},
+		{"<length>", "10%", false},
+		{"<length>", "red", false},
+		{"<length-percentage>", "10%", true},
+		{"<length-percentage>", "calc(50% - 1em)", true},
+		{"<percentage>", "10%", true},
+		{"<percentage>", "10px", false},
+		{"<number>", "1.5", true},
+		{"<number>", "1px", false},
+		{"<integer>", "3", true},
+		{"<integer>", "1.5", false},
+		{"<color>", "#f60", true},
+		{"<color>", "DarkOrange", true},
+		{"<color>", "#ggg", false},
+		{"<custom-ident>", "foo", true},
+		{"<custom-ident>", "inherit", false},
+		{"<custom-ident>", "1a", false},
+		{"auto", "auto", true},
+		{"auto", "Auto", false},
+		{"<length> | auto", "auto", true},
+		{"<length> | auto", "5px", true},
+		{"<length> | auto", "none", false},
+		{"<length>+", "1px 2em 3px", true},
+		{"<length>+", "1px red", false},
+		{"<color>#", "red, #00f", true},
+		{"<color>#", "red #00f", false},
+	}
+
+	for _, tt := range tests {
+		components, ok := parseSyntax(tt.syntax)
+		if tt.syntax != "*" && !ok {
+			t.Errorf("parseSyntax(%q) failed", tt.syntax)
+			continue
+		}
+		rule := &PropertyRule{Syntax: tt.syntax, components: components}
+		if got := rule.Matches(tt.value); got != tt.matches {
+			t.Errorf("%q matches %q = %v, expected %v", tt.syntax, tt.value, got, tt.matches)
+		}
+	}
+
+	for _, invalid := range []string{"", "<angle>", "<length", "initial", "<length> |", "1px"} {
+		if _, ok := parseSyntax(invalid); ok {
+			t.Errorf("parseSyntax(%q) succeeded, expected failure", invalid)
+		}
+	}
+}
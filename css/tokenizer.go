@@ -8,26 +8,29 @@
 //
 // Implemented features:
 // - CSS tokenization (identifiers, strings, numbers, hash, operators)
-// - Rule parsing (selectors and declarations)
-// - Simple selectors: element, class (.class), ID (#id)
-// - Descendant combinators (space-separated selectors)
+// - Rule parsing (selectors and declarations), with source lines and selector text
+// - Simple selectors: element, universal (*), class (.class), ID (#id)
+// - Combinators: descendant, child (>), adjacent (+) and general (~) sibling
 // - Multiple selectors (comma-separated)
-// - Graceful handling of @-rules (skipped, not parsed)
+// - Pseudo-classes, including functional :nth-*(), :not(), :is(), :where(), :has()
+// - An+B microsyntax (CSS Syntax Level 3 §6)
+// - @media rules with Media Queries Level 4 conditions (media.go)
+// - @import rules (CSS 2.1 §6.3), loaded by style.LoadStylesheets
+// - @font-face rules and their descriptors (fontface.go), loaded by font.LoadFontFaces
+// - Custom property values kept as written, and var() substitution (variables.go)
+// - @property rules registering typed custom properties (property.go)
+// - CSS Color 4 colors and color-mix() (color.go), with color space conversion and gamut mapping (colorspace.go)
+// - Graceful handling of other @-rules (skipped, not parsed)
 // - Graceful handling of attribute selectors (skipped)
-// - Partial pseudo-class support (stripped from selector)
+// - !important declarations (CSS 2.1 §6.4.2)
 //
 // Not yet implemented (logged as warnings when encountered):
-// - Child combinator > (CSS 2.1 §5.6)
-// - Sibling combinators +, ~ (CSS 2.1 §5.7, CSS3)
 // - Attribute selector matching (CSS 2.1 §5.8)
-// - Pseudo-classes :hover, :focus (CSS 2.1 §5.11)
-// - Pseudo-elements ::before, ::after (CSS 2.1 §5.12)
-// - @media queries, @import, @font-face (CSS 2.1 §4.1.5)
-// - !important declarations (CSS 2.1 §6.4.2)
 // - Full shorthand property parsing
 package css
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -84,6 +87,10 @@ type Token struct {
 type Tokenizer struct {
 	input string
 	pos   int
+
+	// line is the line of linePos, where Line last counted up to.
+	line    int
+	linePos int
 }
 
 // NewTokenizer creates a new CSS tokenizer.
@@ -91,6 +98,40 @@ func NewTokenizer(input string) *Tokenizer {
 	return &Tokenizer{
 		input: input,
 		pos:   0,
+		line:  1,
+	}
+}
+
+// Line returns the 1-based line of the next token, moving past the
+// whitespace and comments before it.
+func (t *Tokenizer) Line() int {
+	t.skipTrivia()
+	if t.pos < t.linePos {
+		// Peek moved back past the last count
+		t.line, t.linePos = 1, 0
+	}
+	t.line += strings.Count(t.input[t.linePos:t.pos], "\n")
+	t.linePos = t.pos
+	return t.line
+}
+
+// skipTrivia moves past whitespace and comments to the start of the next
+// token.
+func (t *Tokenizer) skipTrivia() {
+	for t.pos < len(t.input) {
+		switch {
+		case unicode.IsSpace(rune(t.input[t.pos])):
+			t.pos++
+		case strings.HasPrefix(t.input[t.pos:], "/*"):
+			end := strings.Index(t.input[t.pos+2:], "*/")
+			if end < 0 {
+				t.pos = len(t.input)
+				return
+			}
+			t.pos += end + 4
+		default:
+			return
+		}
 	}
 }
 
@@ -149,18 +190,16 @@ func (t *Tokenizer) Next() Token {
 		t.pos++
 		return Token{Type: CommaToken, Value: ","}
 	case '>':
-		// CSS 2.1 §5.6: Child combinator - not yet implemented
-		// Treat as an identifier for now to avoid breaking parsing
+		// CSS 2.1 §5.6: Child combinator
+		// Reported as a single-character identifier; the parser maps it to a Combinator
 		t.pos++
 		return Token{Type: IdentToken, Value: ">"}
 	case '+':
-		// CSS 2.1 §5.7: Adjacent sibling combinator - not yet implemented
-		// Treat as an identifier for now to avoid breaking parsing
+		// CSS 2.1 §5.7: Adjacent sibling combinator
 		t.pos++
 		return Token{Type: IdentToken, Value: "+"}
 	case '~':
-		// CSS Selectors Level 3: General sibling combinator - not yet implemented
-		// Treat as an identifier for now to avoid breaking parsing
+		// CSS Selectors Level 3 §8.3.2: General sibling combinator
 		t.pos++
 		return Token{Type: IdentToken, Value: "~"}
 	case '{':
@@ -0,0 +1,172 @@
+package css
+
+// This file contains custom properties and var() substitution.
+//
+// Spec references:
+// - CSS Custom Properties for Cascading Variables Level 1: https://www.w3.org/TR/css-variables-1/
+//
+// Implemented:
+// - Custom property declarations (--*), whose values are kept as written
+// - var() with fallbacks, nested in functions and in other fallbacks
+//
+// Not implemented:
+// - Inserting comments where substitution would join two tokens
+
+import (
+	"strings"
+)
+
+// IsCustomProperty reports whether name is a custom property name such as
+// "--brand-color". Custom property names are case-sensitive.
+// CSS Variables Level 1 §2 Defining Custom Properties
+func IsCustomProperty(name string) bool {
+	return len(name) > 2 && strings.HasPrefix(name, "--")
+}
+
+// HasVar reports whether value contains a var() function.
+func HasVar(value string) bool {
+	return indexOfVar(value) >= 0
+}
+
+// readCustomPropertyValue consumes a custom property's value, up to a ';'
+// or the '}' closing the block, and returns it as written, trimmed of
+// whitespace. Blocks and strings inside
+// the value are kept whole, so it may contain ';' and '}'.
+// CSS Variables Level 1 §2: the value is any sequence of tokens with
+// balanced brackets
+func (p *Parser) readCustomPropertyValue() string {
+	input := p.tokenizer.input
+	start := p.tokenizer.pos
+	var closers []byte
+	i := start
+scan:
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == '"' || c == '\'':
+			i++
+			for i < len(input) && input[i] != c && input[i] != '\n' {
+				if input[i] == '\\' {
+					i++
+				}
+				i++
+			}
+		case c == '\\':
+			i++
+		case c == '/' && i+1 < len(input) && input[i+1] == '*':
+			end := strings.Index(input[i+2:], "*/")
+			if end < 0 {
+				i = len(input)
+				break scan
+			}
+			i += end + 3
+			continue
+		case c == '(':
+			closers = append(closers, ')')
+		case c == '[':
+			closers = append(closers, ']')
+		case c == '{':
+			closers = append(closers, '}')
+		case len(closers) > 0 && c == closers[len(closers)-1]:
+			closers = closers[:len(closers)-1]
+		case len(closers) == 0 && (c == ';' || c == '}'):
+			break scan
+		}
+		i++
+	}
+	p.tokenizer.pos = min(i, len(input))
+
+	return strings.TrimSpace(input[start:p.tokenizer.pos])
+}
+
+// SubstituteVars replaces the var() functions in value by the values
+// lookup returns for the custom properties they name, or by their
+// fallbacks. It returns false if a var() names a property lookup does not
+// find and has no fallback, which makes the declaration invalid at
+// computed-value time.
+// CSS Variables Level 1 §3 Using Cascading Variables: the var() notation
+func SubstituteVars(value string, lookup func(name string) (string, bool)) (string, bool) {
+	var b strings.Builder
+	for {
+		start := indexOfVar(value)
+		if start < 0 {
+			b.WriteString(value)
+			return b.String(), true
+		}
+		end := matchingParen(value, start+3)
+		if end < 0 {
+			return "", false
+		}
+		b.WriteString(value[:start])
+
+		// var( <custom-property-name> [, <declaration-value>? ]? )
+		args := value[start+4 : end]
+		name, fallback, hasFallback := strings.Cut(args, ",")
+		name = strings.TrimSpace(name)
+		if !IsCustomProperty(name) {
+			return "", false
+		}
+		substitution, ok := lookup(name)
+		if !ok {
+			if !hasFallback {
+				return "", false
+			}
+			if substitution, ok = SubstituteVars(strings.TrimSpace(fallback), lookup); !ok {
+				return "", false
+			}
+		}
+		b.WriteString(substitution)
+		value = value[end+1:]
+	}
+}
+
+// indexOfVar returns the index of the first var( in value that is not in a
+// string, or -1.
+func indexOfVar(value string) int {
+	var quote byte
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case i+4 <= len(value) && value[i+3] == '(' && strings.EqualFold(value[i:i+3], "var") &&
+			(i == 0 || !isNameChar(rune(value[i-1]))):
+			return i
+		}
+	}
+	return -1
+}
+
+// matchingParen returns the index of the ')' closing the '(' at open in
+// value, skipping strings, or -1 if it is not closed.
+func matchingParen(value string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,90 @@
+package css
+
+import "testing"
+
+// TestCustomPropertyValues tests that custom property values are kept as
+// written, including characters other properties cannot contain.
+// CSS Variables Level 1 §2 Defining Custom Properties
+func TestCustomPropertyValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`--color: #f60;`, "#f60"},
+		{`--json: {"a": [1, 2]};`, `{"a": [1, 2]}`},
+		{`--semi: "a;b" ;`, `"a;b"`},
+		{`--spaced:   1px    2px  ;`, "1px    2px"},
+		{`--empty:;`, ""},
+		{`--important: red !important;`, "red"},
+		{`--fn: calc(1px + var(--x, 2px));`, "calc(1px + var(--x, 2px))"},
+		{`--Case: x;`, "x"},
+	}
+
+	for _, tt := range tests {
+		stylesheet := Parse("a { " + tt.input + " color: blue; }")
+		if len(stylesheet.Rules) != 1 || len(stylesheet.Rules[0].Declarations) != 2 {
+			t.Errorf("Parse(%q): expected 1 rule with 2 declarations", tt.input)
+			continue
+		}
+		decl := stylesheet.Rules[0].Declarations[0]
+		if decl.Value != tt.expected {
+			t.Errorf("Parse(%q) value = %q, expected %q", tt.input, decl.Value, tt.expected)
+		}
+		if next := stylesheet.Rules[0].Declarations[1]; next.Property != "color" || next.Value != "blue" {
+			t.Errorf("Parse(%q): following declaration %s: %q", tt.input, next.Property, next.Value)
+		}
+	}
+
+	// The last declaration of a block ends at the closing brace
+	decls := ParseInlineStyle("--a: 1px; --b: {x}")
+	if len(decls) != 2 || decls[0].Property != "--a" || decls[1].Value != "{x}" {
+		t.Errorf("ParseInlineStyle: unexpected declarations %v", decls)
+	}
+}
+
+// TestSubstituteVars tests var() substitution and fallbacks.
+// CSS Variables Level 1 §3 Using Cascading Variables
+func TestSubstituteVars(t *testing.T) {
+	vars := map[string]string{
+		"--color": "#f60",
+		"--gap":   "4px",
+		"--empty": "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"var(--color)", "#f60", true},
+		{"1px solid var(--color)", "1px solid #f60", true},
+		{"calc(var(--gap) * 2)", "calc(4px * 2)", true},
+		{"var(--gap) var(--gap)", "4px 4px", true},
+		{"VAR(--gap)", "4px", true},
+		{"var( --gap )", "4px", true},
+		{"var(--missing, red)", "red", true},
+		{"var(--missing, 1px, 2px)", "1px, 2px", true},
+		{"var(--missing, var(--gap))", "4px", true},
+		{"var(--missing, var(--other, calc(1px + 2px)))", "calc(1px + 2px)", true},
+		{"var(--missing,)", "", true},
+		{"a var(--empty) b", "a  b", true},
+		{"var(--gap, ignored)", "4px", true},
+		{`"var(--gap)"`, `"var(--gap)"`, true},
+		{"covar(--gap)", "covar(--gap)", true},
+		{"var(--missing)", "", false},
+		{"var(--missing, var(--other))", "", false},
+		{"var(gap)", "", false},
+		{"var(--gap", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := SubstituteVars(tt.input, lookup)
+		if ok != tt.ok || (ok && got != tt.expected) {
+			t.Errorf("SubstituteVars(%q) = %q, %v, expected %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
@@ -100,6 +100,9 @@ func ResolveURLString(baseURL, relativeURL string) string {
 // and fetches their CSS content.
 // HTML5 §4.2.4: The link element allows authors to link their document to other resources.
 // This should ideally be done during HTML parsing, but for simplicity we do it post-parse.
+//
+// Deprecated: Use style.LoadStylesheets, which keeps <link> and <style>
+// stylesheets in document order and honors @import and media attributes.
 func FetchExternalStylesheets(root *Node) string {
 	loader := NewResourceLoader("")
 	var cssBuilder strings.Builder
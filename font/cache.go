@@ -0,0 +1,206 @@
+package font
+
+// This file caches font faces, glyph metrics and shaped text, so that
+// measuring text does not create a face or shape a word for every call.
+
+import (
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// faceKey identifies a cached face.
+type faceKey struct {
+	font    *opentype.Font
+	size    float64
+	hinting font.Hinting
+}
+
+// cachedGlyph is a glyph looked up by character.
+type cachedGlyph struct {
+	index   sfnt.GlyphIndex
+	advance fixed.Int26_6
+}
+
+// cachedFace is a face shared by all measurements at one font and size,
+// with its glyphs and kerning pairs. opentype faces are not safe for
+// concurrent use, so lookups that miss the cache hold mu.
+type cachedFace struct {
+	mu      sync.Mutex
+	font    *opentype.Font
+	ppem    fixed.Int26_6
+	face    font.Face
+	metrics font.Metrics
+	glyphs  map[rune]cachedGlyph
+	kerns   map[[2]rune]fixed.Int26_6
+	buf     sfnt.Buffer
+}
+
+// faceCache holds the cached faces. Documents use few distinct fonts and
+// sizes, so faces are only evicted by ClearFaceCache and, for web fonts,
+// when a registry reset releases their font (releaseFaces).
+var faceCache = struct {
+	sync.RWMutex
+	faces map[faceKey]*cachedFace
+}{faces: make(map[faceKey]*cachedFace)}
+
+// cachedFaceFor returns the cached face for f at size pixels, creating it
+// on first use.
+func cachedFaceFor(f *Face, size float64) (*cachedFace, error) {
+	parsed, err := f.Load()
+	if err != nil {
+		return nil, err
+	}
+	key := faceKey{font: parsed, size: size, hinting: font.HintingFull}
+
+	faceCache.RLock()
+	cached, ok := faceCache.faces[key]
+	faceCache.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	face, err := f.NewFace(size)
+	if err != nil {
+		return nil, err
+	}
+	faceCache.Lock()
+	defer faceCache.Unlock()
+	if cached, ok := faceCache.faces[key]; ok {
+		// Another goroutine created the face first
+		face.Close()
+		return cached, nil
+	}
+	cached = &cachedFace{
+		font: parsed,
+		// opentype.NewFace scales outlines by the size rounded to 26.6
+		ppem:    fixed.Int26_6(0.5 + size*64),
+		face:    face,
+		metrics: face.Metrics(),
+		glyphs:  make(map[rune]cachedGlyph),
+		kerns:   make(map[[2]rune]fixed.Int26_6),
+	}
+	faceCache.faces[key] = cached
+	return cached, nil
+}
+
+// simpleGlyphs lays out text one glyph per character with the face's advances
+// and kerning pairs, as font.MeasureString measures it. It is used for
+// fonts the shaper cannot read.
+func (c *cachedFace) simpleGlyphs(text string) ([]Glyph, fixed.Int26_6) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	glyphs := make([]Glyph, 0, len(text))
+	var advance fixed.Int26_6
+	prev := rune(-1)
+	for i, r := range text {
+		if prev >= 0 {
+			pair := [2]rune{prev, r}
+			kern, ok := c.kerns[pair]
+			if !ok {
+				kern = c.face.Kern(prev, r)
+				c.kerns[pair] = kern
+			}
+			glyphs[len(glyphs)-1].Advance += kern
+			advance += kern
+		}
+		glyph, ok := c.glyphs[r]
+		if !ok {
+			glyph.index, _ = c.font.GlyphIndex(&c.buf, r)
+			glyph.advance, _ = c.face.GlyphAdvance(r)
+			c.glyphs[r] = glyph
+		}
+		glyphs = append(glyphs, Glyph{ID: glyph.index, Advance: glyph.advance, Cluster: i})
+		advance += glyph.advance
+		prev = r
+	}
+	return glyphs, advance
+}
+
+// hint rounds an advance to whole pixels, as hinted faces do.
+func hint(v fixed.Int26_6) fixed.Int26_6 {
+	return (v + 32) &^ 63
+}
+
+// shapeKey identifies shaped text.
+type shapeKey struct {
+	face     *cachedFace
+	text     string
+	features string
+	rtl      bool
+}
+
+// shapedText is cached shaping output. The glyphs are shared and must not
+// be modified.
+type shapedText struct {
+	glyphs  []Glyph
+	advance fixed.Int26_6
+}
+
+// maxShapedTexts bounds the shaped text cache. Text nodes repeat words and
+// are measured more than once by table layout, so a few thousand entries
+// cover a typical page.
+const maxShapedTexts = 8192
+
+// shapeCache holds shaped text. It is emptied when full.
+var shapeCache = &shapedTextCache{texts: make(map[shapeKey]shapedText)}
+
+// shapedTextCache is a bounded map of shaped text.
+type shapedTextCache struct {
+	mu    sync.Mutex
+	texts map[shapeKey]shapedText
+}
+
+func (s *shapedTextCache) get(key shapeKey) ([]Glyph, fixed.Int26_6, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shaped, ok := s.texts[key]
+	return shaped.glyphs, shaped.advance, ok
+}
+
+func (s *shapedTextCache) put(key shapeKey, glyphs []Glyph, advance fixed.Int26_6) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.texts) >= maxShapedTexts {
+		s.texts = make(map[shapeKey]shapedText)
+	}
+	s.texts[key] = shapedText{glyphs: glyphs, advance: advance}
+}
+
+// releaseFaces evicts the cached faces of parsed and the text shaped with
+// them. Like ClearFaceCache, it does not close the faces.
+func releaseFaces(parsed *opentype.Font) {
+	faceCache.Lock()
+	for key := range faceCache.faces {
+		if key.font == parsed {
+			delete(faceCache.faces, key)
+		}
+	}
+	faceCache.Unlock()
+
+	shapeCache.mu.Lock()
+	defer shapeCache.mu.Unlock()
+	for key := range shapeCache.texts {
+		if key.face.font == parsed {
+			delete(shapeCache.texts, key)
+		}
+	}
+}
+
+// ClearFaceCache forgets all cached faces, glyph metrics and shaped text.
+// Faces are not closed, since measurements running on other goroutines may
+// still hold them; they are reclaimed by the garbage collector once no
+// longer used.
+func ClearFaceCache() {
+	shapeCache.mu.Lock()
+	shapeCache.texts = make(map[shapeKey]shapedText)
+	shapeCache.mu.Unlock()
+
+	faceCache.Lock()
+	defer faceCache.Unlock()
+	faceCache.faces = make(map[faceKey]*cachedFace)
+}
@@ -0,0 +1,179 @@
+package font
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/math/fixed"
+)
+
+// TestSimpleGlyphs tests that per-character layout matches
+// font.MeasureString, including kerning and characters without glyphs.
+func TestSimpleGlyphs(t *testing.T) {
+	ClearFaceCache()
+	defer ClearFaceCache()
+
+	goFace := Resolve("", Style{Family: GoFamily})
+	tests := []string{"", "Hello, World!", "AVAToWa", "λ中λ", "repeated repeated"}
+	for _, size := range []float64{12, 16, 32} {
+		face, err := goFace.NewFace(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cached, err := cachedFaceFor(goFace, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, text := range tests {
+			expected := font.MeasureString(face, text)
+			// Measure twice: once filling the cache and once reading it
+			for i := 0; i < 2; i++ {
+				glyphs, got := cached.simpleGlyphs(text)
+				if got != expected {
+					t.Errorf("Size %v, %q: expected %v, got %v", size, text, expected, got)
+				}
+				var sum fixed.Int26_6
+				for _, glyph := range glyphs {
+					sum += glyph.Advance
+				}
+				if sum != got {
+					t.Errorf("Size %v, %q: glyph advances sum to %v, not %v", size, text, sum, got)
+				}
+			}
+		}
+		face.Close()
+	}
+}
+
+// TestFaceCacheKey tests that faces are shared per font and size.
+func TestFaceCacheKey(t *testing.T) {
+	ClearFaceCache()
+	defer ClearFaceCache()
+
+	regular := Resolve("", Style{Family: GoFamily})
+	bold := Resolve("", Style{Family: GoFamily, Weight: "bold"})
+	a, _ := cachedFaceFor(regular, 16)
+	b, _ := cachedFaceFor(regular, 16)
+	if a != b {
+		t.Error("Expected the same face for the same font and size")
+	}
+	if c, _ := cachedFaceFor(regular, 17); c == a {
+		t.Error("Expected a different face for a different size")
+	}
+	if c, _ := cachedFaceFor(bold, 16); c == a {
+		t.Error("Expected a different face for a different font")
+	}
+
+	ClearFaceCache()
+	if c, _ := cachedFaceFor(regular, 16); c == a {
+		t.Error("Expected a new face after ClearFaceCache")
+	}
+}
+
+// TestFaceCacheReload tests that resetting the registry and loading its
+// web fonts again, as each render of the WebAssembly build does, evicts
+// the faces of the old fonts instead of growing the cache.
+func TestFaceCacheReload(t *testing.T) {
+	ClearFaceCache()
+	defer ClearFaceCache()
+	defer DefaultRegistry.Reset()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mono.ttf"), gomono.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sheet := css.Parse(`@font-face { font-family: Reloaded; src: url(mono.ttf); }`)
+	sheet.FontFaces[0].BaseURL = dir
+
+	style := Style{Family: "Reloaded", Size: 16}
+	faces, texts := 0, 0
+	for i := 0; i < 5; i++ {
+		DefaultRegistry.Reset()
+		DefaultRegistry.LoadFontFaces(sheet.FontFaces, css.DefaultMediaEnvironment())
+		MeasureText("The quick brown fox", style)
+
+		faceCache.RLock()
+		gotFaces := len(faceCache.faces)
+		faceCache.RUnlock()
+		shapeCache.mu.Lock()
+		gotTexts := len(shapeCache.texts)
+		shapeCache.mu.Unlock()
+		if i == 0 {
+			faces, texts = gotFaces, gotTexts
+			continue
+		}
+		if gotFaces != faces || gotTexts != texts {
+			t.Fatalf("Reload %d: expected %d faces and %d shaped texts, got %d and %d", i, faces, texts, gotFaces, gotTexts)
+		}
+	}
+}
+
+// TestMeasureTextConcurrent tests that MeasureText can be called from
+// several goroutines sharing cached faces, while the cache is cleared under
+// them. Run with -race.
+func TestMeasureTextConcurrent(t *testing.T) {
+	ClearFaceCache()
+	defer ClearFaceCache()
+
+	style := Style{Size: 16}
+	expectedWidth, expectedHeight := MeasureText("The quick brown fox", style)
+	ClearFaceCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if i == 0 && j%10 == 0 {
+					ClearFaceCache()
+				}
+				width, height := MeasureText("The quick brown fox", style)
+				if width != expectedWidth || height != expectedHeight {
+					t.Errorf("Expected %vx%v, got %vx%v", expectedWidth, expectedHeight, width, height)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// benchmarkWords are text nodes like those of a news listing page.
+var benchmarkWords = strings.Fields(`Show HN: A web browser written in Go from scratch
+(github.com) 312 points by someone 4 hours ago | hide | 128 comments
+Ask HN: What are you working on this month? The unreasonable
+effectiveness of small programs Why SQLite uses bytecode`)
+
+// BenchmarkMeasureText compares measuring with the face cache against
+// creating a face per call, as MeasureText did before the cache.
+func BenchmarkMeasureText(b *testing.B) {
+	style := Style{Size: 13.33}
+
+	b.Run("cached", func(b *testing.B) {
+		ClearFaceCache()
+		for i := 0; i < b.N; i++ {
+			MeasureText(benchmarkWords[i%len(benchmarkWords)], style)
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			text := benchmarkWords[i%len(benchmarkWords)]
+			for _, run := range SegmentText(text, style) {
+				face, err := run.Face.NewFace(style.Size)
+				if err != nil {
+					b.Fatal(err)
+				}
+				font.MeasureString(face, run.Text)
+				face.Close()
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package font
+
+// This file rasterizes shaped glyphs. Shaping selects glyphs by index, not
+// by character, so runs are drawn from the glyph outlines rather than with
+// font.Drawer.
+
+import (
+	"image"
+	"image/draw"
+	"sync"
+
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// rasterizer holds the reusable state for drawing glyphs.
+type rasterizer struct {
+	buf  sfnt.Buffer
+	rast vector.Rasterizer
+	mask image.Alpha
+}
+
+var rasterizers = sync.Pool{New: func() any { return new(rasterizer) }}
+
+// Draw draws the run onto dst, filled with src, with the pen starting at
+// dot on the baseline. It returns the pen position after the run.
+func (r ShapedRun) Draw(dst draw.Image, src image.Image, dot fixed.Point26_6) fixed.Point26_6 {
+	parsed, err := r.Face.Load()
+	if err != nil {
+		return dot
+	}
+	ras := rasterizers.Get().(*rasterizer)
+	defer rasterizers.Put(ras)
+
+	ppem := fixed.Int26_6(0.5 + r.Size*64)
+	for _, glyph := range r.Glyphs {
+		origin := fixed.Point26_6{X: dot.X + glyph.XOffset, Y: dot.Y - glyph.YOffset}
+		if dr, ok := ras.glyph(parsed, glyph.ID, ppem, origin); ok {
+			draw.DrawMask(dst, dr, src, image.Point{}, &ras.mask, image.Point{}, draw.Over)
+		}
+		dot.X += glyph.Advance
+	}
+	return dot
+}
+
+// glyph rasterizes a glyph with its origin at dot into the mask, returning
+// the destination rectangle the mask covers. It quantizes and biases the
+// outline as opentype.Face.Glyph does, so that shaped and unshaped text
+// render identically.
+func (ras *rasterizer) glyph(f *sfnt.Font, index sfnt.GlyphIndex, ppem fixed.Int26_6, dot fixed.Point26_6) (image.Rectangle, bool) {
+	segments, err := f.LoadGlyph(&ras.buf, index, ppem, nil)
+	if err != nil || len(segments) == 0 {
+		return image.Rectangle{}, false
+	}
+
+	bounds := segments.Bounds().Add(dot)
+	dr := image.Rect(bounds.Min.X.Floor(), bounds.Min.Y.Floor(), bounds.Max.X.Ceil(), bounds.Max.Y.Ceil())
+	width, height := dr.Dx(), dr.Dy()
+	if width <= 0 || height <= 0 {
+		return image.Rectangle{}, false
+	}
+	biasX := dot.X - fixed.I(dr.Min.X)
+	biasY := dot.Y - fixed.I(dr.Min.Y)
+
+	if cap(ras.mask.Pix) < width*height {
+		ras.mask.Pix = make([]uint8, 2*width*height)
+	}
+	ras.mask.Pix = ras.mask.Pix[:width*height]
+	ras.mask.Stride = width
+	ras.mask.Rect = image.Rect(0, 0, width, height)
+
+	point := func(p fixed.Point26_6) (float32, float32) {
+		return float32(p.X+biasX) / 64, float32(p.Y+biasY) / 64
+	}
+	ras.rast.Reset(width, height)
+	ras.rast.DrawOp = draw.Src
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			ras.rast.MoveTo(point(seg.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			ras.rast.LineTo(point(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			x1, y1 := point(seg.Args[0])
+			x2, y2 := point(seg.Args[1])
+			ras.rast.QuadTo(x1, y1, x2, y2)
+		case sfnt.SegmentOpCubeTo:
+			x1, y1 := point(seg.Args[0])
+			x2, y2 := point(seg.Args[1])
+			x3, y3 := point(seg.Args[2])
+			ras.rast.CubeTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	ras.rast.Draw(&ras.mask, ras.mask.Bounds(), image.Opaque, image.Point{})
+	return dr, true
+}
@@ -0,0 +1,161 @@
+package font
+
+// This file implements per-character font fallback: splitting text into
+// runs that are each drawn with the first face that has glyphs for them.
+//
+// Spec references:
+// - CSS Fonts Level 4 §5 Font Matching Algorithm, step 5 (cluster matching
+// and system fallback): https://www.w3.org/TR/css-fonts-4/#cluster-matching
+
+import (
+	"sync"
+	"unicode"
+
+	"github.com/lukehoban/browser/css"
+	"golang.org/x/image/font/sfnt"
+)
+
+// defaultFallbackFamilies are tried, after the font-family list, for
+// characters none of its fonts cover. They name fonts commonly installed
+// for wide Unicode coverage, and only match once indexed by
+// AddSystemFonts.
+var defaultFallbackFamilies = []string{
+	"Noto Sans",
+	"DejaVu Sans",
+	"Noto Sans CJK SC",
+	"Noto Sans CJK JP",
+	"Noto Sans CJK KR",
+	"WenQuanYi Micro Hei",
+	"Droid Sans Fallback",
+	"Noto Color Emoji",
+	"Noto Emoji",
+	"Noto Sans Symbols",
+	"Noto Sans Symbols 2",
+	"Noto Sans Math",
+	"Symbola",
+	"DejaVu Sans Mono",
+}
+
+// SetFallbackFamilies replaces the families tried for characters not
+// covered by any font of the font-family list. Web font families may be
+// named too.
+func (r *Registry) SetFallbackFamilies(families ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = append([]string(nil), families...)
+}
+
+// FallbackFamilies returns the families tried for characters not covered by
+// any font of the font-family list.
+func (r *Registry) FallbackFamilies() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.fallback == nil {
+		return defaultFallbackFamilies
+	}
+	return append([]string(nil), r.fallback...)
+}
+
+// sfntBuffers holds reusable buffers for glyph lookups.
+var sfntBuffers = sync.Pool{New: func() any { return new(sfnt.Buffer) }}
+
+// HasGlyph reports whether the face's font maps r to a glyph.
+func (f *Face) HasGlyph(r rune) bool {
+	parsed, err := f.Load()
+	if err != nil {
+		return false
+	}
+	buf := sfntBuffers.Get().(*sfnt.Buffer)
+	defer sfntBuffers.Put(buf)
+	index, err := parsed.GlyphIndex(buf, r)
+	return err == nil && index != 0
+}
+
+// covers reports whether the face's unicode-range and font both include r.
+func (f *Face) covers(r rune) bool {
+	return css.ContainsRune(f.UnicodeRange, r) && f.HasGlyph(r)
+}
+
+// Run is a segment of text drawn with a single face.
+type Run struct {
+	Text string
+	Face *Face
+}
+
+// SegmentText splits text into runs by glyph coverage. Each character is
+// drawn with the first face that has a glyph for it, trying the families
+// of style.Family in order, then the fallback families; characters no face
+// covers use the first family's face. Spaces, control characters and
+// combining marks stay in the run of the preceding character. It returns
+// nil if not even the built-in fonts can be loaded.
+// CSS Fonts Level 4 §5: If no font in the list has a glyph for a
+// character, the user agent searches its fallback fonts
+func SegmentText(text string, style Style) []Run {
+	primary := Resolve(text, style)
+	if primary == nil {
+		return nil
+	}
+
+	// Fast path: the first family's face covers the whole text
+	covered := true
+	for _, r := range text {
+		if !inheritsFace(r) && !primary.covers(r) {
+			covered = false
+			break
+		}
+	}
+	if covered {
+		return []Run{{Text: text, Face: primary}}
+	}
+
+	families := append(fontFamilies(style.Family), DefaultRegistry.FallbackFamilies()...)
+	query := newQuery(style)
+	faces := make(map[rune]*Face)
+	runs := make([]Run, 0, 2)
+	start := 0
+	var current *Face
+	for i, r := range text {
+		var face *Face
+		if inheritsFace(r) && current != nil {
+			face = current
+		} else if cached, ok := faces[r]; ok {
+			face = cached
+		} else {
+			face = coveringFace(families, query, r)
+			if face == nil {
+				face = primary
+			}
+			faces[r] = face
+		}
+
+		if face != current {
+			if current != nil {
+				runs = append(runs, Run{Text: text[start:i], Face: current})
+			}
+			start, current = i, face
+		}
+	}
+	if current != nil {
+		runs = append(runs, Run{Text: text[start:], Face: current})
+	}
+	return runs
+}
+
+// coveringFace returns the face of the first family that has a glyph for r.
+func coveringFace(families []string, query Query, r rune) *Face {
+	query.Char = r
+	for _, family := range families {
+		for _, candidate := range concreteFamilies(family) {
+			if face := matchFamily(candidate, query); face != nil && face.covers(r) {
+				return face
+			}
+		}
+	}
+	return nil
+}
+
+// inheritsFace reports whether r is drawn with the face of the preceding
+// character rather than selecting its own.
+func inheritsFace(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r) || unicode.Is(unicode.Mn, r) || r == '\u200d' || unicode.Is(unicode.Variation_Selector, r)
+}
@@ -0,0 +1,149 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+)
+
+// asciiOnlyFont returns a copy of a TrueType font whose cmap maps only
+// printable ASCII, so that other characters need a fallback font.
+func asciiOnlyFont(t *testing.T, ttf []byte) *opentype.Font {
+	t.Helper()
+	original, err := sfnt.Parse(ttf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OpenType §cmap: a format 4 subtable with one segment for U+0020-007E,
+	// mapped through glyphIdArray, and the required final 0xFFFF segment
+	var buf sfnt.Buffer
+	const first, last = 0x20, 0x7E
+	var subtable bytes.Buffer
+	segments := []uint16{last, 0xFFFF}
+	binary.Write(&subtable, binary.BigEndian, []uint16{4, 0, 0, 4, 4, 1, 0}) // format, length, language, segCountX2, searchRange, entrySelector, rangeShift
+	binary.Write(&subtable, binary.BigEndian, segments)                      // endCode
+	binary.Write(&subtable, binary.BigEndian, uint16(0))                     // reservedPad
+	binary.Write(&subtable, binary.BigEndian, []uint16{first, 0xFFFF})       // startCode
+	binary.Write(&subtable, binary.BigEndian, []uint16{0, 1})                // idDelta
+	binary.Write(&subtable, binary.BigEndian, []uint16{4, 0})                // idRangeOffset: glyphIdArray follows
+	for r := rune(first); r <= last; r++ {
+		index, err := original.GlyphIndex(&buf, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary.Write(&subtable, binary.BigEndian, uint16(index))
+	}
+	data := subtable.Bytes()
+	binary.BigEndian.PutUint16(data[2:], uint16(len(data)))
+
+	// cmap header with a single Windows Unicode BMP encoding record
+	cmap := []byte{0, 0, 0, 1, 0, 3, 0, 1, 0, 0, 0, 12}
+	cmap = append(cmap, data...)
+
+	tables := make([]sfntTable, 0)
+	numTables := int(binary.BigEndian.Uint16(ttf[4:]))
+	for i := 0; i < numTables; i++ {
+		tag := string(ttf[12+16*i : 16+16*i])
+		if tag == "cmap" {
+			tables = append(tables, sfntTable{tag: tag, data: cmap})
+			continue
+		}
+		tables = append(tables, sfntTable{tag: tag, data: findTable(ttf, tag)})
+	}
+	parsed, err := opentype.Parse(buildSFNT(binary.BigEndian.Uint32(ttf), tables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+// TestSegmentText tests splitting text into runs by glyph coverage across
+// the font-family list and the fallback families.
+// CSS Fonts Level 4 §5 Font Matching Algorithm, step 5
+func TestSegmentText(t *testing.T) {
+	latin := &Face{Family: "Latin Only", Font: asciiOnlyFont(t, gomono.TTF), WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb}
+	DefaultRegistry.Add(latin)
+	defer DefaultRegistry.Reset()
+	goFace := Resolve("", Style{Family: GoFamily})
+
+	if latin.HasGlyph('λ') || !latin.HasGlyph('a') {
+		t.Fatal("Expected the test font to cover ASCII only")
+	}
+
+	type run struct {
+		text string
+		face *Face
+	}
+	tests := []struct {
+		name     string
+		text     string
+		family   string
+		expected []run
+	}{
+		{"covered by first family", "plain text", "Latin Only", []run{{"plain text", latin}}},
+		{"falls back per character", "a λβ b", "Latin Only", []run{{"a ", latin}, {"λβ ", goFace}, {"b", latin}}},
+		{"combining mark stays with its base", "λ́a", "Latin Only", []run{{"λ́", goFace}, {"a", latin}}},
+		{"later family covers first", "λ", "Latin Only, sans-serif", []run{{"λ", goFace}}},
+		{"uncovered uses first family", "中a", "Latin Only", []run{{"中a", latin}}},
+		{"unknown family", "abc", "Missing", []run{{"abc", goFace}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := SegmentText(tt.text, Style{Family: tt.family, Size: 16})
+			if len(runs) != len(tt.expected) {
+				t.Fatalf("Expected %d runs, got %d: %v", len(tt.expected), len(runs), runs)
+			}
+			for i, want := range tt.expected {
+				if runs[i].Text != want.text || runs[i].Face != want.face {
+					t.Errorf("Run %d: expected %q with %v, got %q with %v", i, want.text, want.face, runs[i].Text, runs[i].Face)
+				}
+			}
+		})
+	}
+}
+
+// TestSetFallbackFamilies tests that registered fallback families are tried
+// after the font-family list.
+func TestSetFallbackFamilies(t *testing.T) {
+	latin := &Face{Family: "Latin Only", Font: asciiOnlyFont(t, gomono.TTF), WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb}
+	DefaultRegistry.Add(latin)
+	DefaultRegistry.SetFallbackFamilies(GoMonoFamily)
+	defer func() {
+		DefaultRegistry.Reset()
+		DefaultRegistry.SetFallbackFamilies(defaultFallbackFamilies...)
+	}()
+
+	// The default family covers λ before the fallback families are tried
+	runs := SegmentText("aλ", Style{Family: "Latin Only", Size: 16})
+	if len(runs) != 2 || runs[1].Face.Family != GoFamily {
+		t.Errorf("Expected λ from the default family, got %v", runs)
+	}
+
+	// Characters nothing in the list covers use the fallback families
+	DefaultRegistry.Add(&Face{Family: "Go", Font: latin.Font, WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb})
+	runs = SegmentText("aλ", Style{Family: "Latin Only", Size: 16})
+	if len(runs) != 2 || runs[1].Face.Family != GoMonoFamily {
+		t.Errorf("Expected λ from the Go Mono fallback, got %v", runs)
+	}
+}
+
+// TestMeasureTextFallback tests that each run is measured with its own face.
+func TestMeasureTextFallback(t *testing.T) {
+	latin := &Face{Family: "Latin Only", Font: asciiOnlyFont(t, gomono.TTF), WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb}
+	DefaultRegistry.Add(latin)
+	defer DefaultRegistry.Reset()
+
+	style := Style{Family: "Latin Only", Size: 16}
+	mixed, _ := MeasureText("iiλ", style)
+	latinWidth, _ := MeasureText("ii", style)
+	greekWidth, _ := MeasureText("λ", Style{Size: 16})
+	if mixed != latinWidth+greekWidth {
+		t.Errorf("Expected mixed width %v + %v, got %v", latinWidth, greekWidth, mixed)
+	}
+}
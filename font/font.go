@@ -4,6 +4,13 @@
 //
 // Spec references:
 // - CSS 2.1 §15 Fonts
+// - CSS Fonts Level 4 §4 Font Resources (web fonts, registry.go)
+// - CSS Fonts Level 4 §5 Font Matching Algorithm (matching.go, system.go, fallback.go)
+// - CSS Fonts Level 4 §6.4, §6.5, §6.12 and §7.2 Font feature properties (shaping.go)
+// - WOFF 1.0 and WOFF 2.0 (woff.go)
+//
+// Text is shaped with OpenType features (shaping.go); measurement reuses
+// faces, glyph metrics and shaped text across calls (cache.go).
 package font
 
 import (
@@ -17,6 +24,7 @@ import (
 	"golang.org/x/image/font/gofont/goitalic"
 	"golang.org/x/image/font/gofont/goregular"
 	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
 )
 
 var (
@@ -33,10 +41,18 @@ var (
 // Style represents font styling properties.
 // CSS 2.1 §15 Fonts
 type Style struct {
+	Family     string  // Font family list, as in the 'font-family' property
 	Size       float64 // Font size in pixels
-	Weight     string  // Font weight: "normal" or "bold"
+	Weight     string  // Font weight: "normal", "bold" or a number
+	Stretch    float64 // Font stretch as a percentage; 0 means normal (100%)
 	Style      string  // Font style: "normal" or "italic"
 	Decoration string  // Text decoration: "none" or "underline"
+
+	Kerning         string // The 'font-kerning' property: "auto", "normal" or "none"
+	Ligatures       string // The 'font-variant-ligatures' property
+	FeatureSettings string // The 'font-feature-settings' property
+
+	Direction string // Shaping direction: "rtl" for right-to-left, otherwise left-to-right
 }
 
 // LoadGoFonts loads the built-in Go fonts from the golang.org/x/image/font/gofont packages.
@@ -49,28 +65,28 @@ func LoadGoFonts() error {
 		var err error
 		
 		// Load Go Regular font (default)
-		goRegularFont, err = opentype.Parse(goregular.TTF)
+		goRegularFont, err = ParseFont(goregular.TTF)
 		if err != nil {
 			fontErr = err
 			return
 		}
 		
 		// Load Go Bold font
-		goBoldFont, err = opentype.Parse(gobold.TTF)
+		goBoldFont, err = ParseFont(gobold.TTF)
 		if err != nil {
 			fontErr = err
 			return
 		}
 		
 		// Load Go Italic font
-		goItalicFont, err = opentype.Parse(goitalic.TTF)
+		goItalicFont, err = ParseFont(goitalic.TTF)
 		if err != nil {
 			fontErr = err
 			return
 		}
 		
 		// Load Go Bold Italic font
-		goBoldItalicFont, err = opentype.Parse(gobolditalic.TTF)
+		goBoldItalicFont, err = ParseFont(gobolditalic.TTF)
 		if err != nil {
 			fontErr = err
 			return
@@ -80,22 +96,21 @@ func LoadGoFonts() error {
 	return fontErr
 }
 
-// SelectFont selects the appropriate font based on weight and style.
+// SelectFont selects the appropriate font based on family, weight and style.
 // Returns the selected font, or nil if fonts are not loaded.
 func SelectFont(style Style) *opentype.Font {
-	// Ensure fonts are loaded
-	if err := LoadGoFonts(); err != nil {
+	return SelectFontForText("", style)
+}
+
+// SelectFontForText selects the font for text by matching style against
+// the web, installed and built-in fonts; see Resolve.
+// CSS Fonts Level 4 §5 Font Matching Algorithm
+func SelectFontForText(text string, style Style) *opentype.Font {
+	face := Resolve(text, style)
+	if face == nil {
 		return nil
 	}
-	
-	if style.Weight == "bold" && style.Style == "italic" {
-		return goBoldItalicFont
-	} else if style.Weight == "bold" {
-		return goBoldFont
-	} else if style.Style == "italic" {
-		return goItalicFont
-	}
-	return goRegularFont
+	return face.Font
 }
 
 // MeasureText measures the dimensions of text using TrueType fonts.
@@ -109,43 +124,45 @@ func MeasureText(text string, style Style) (float64, float64) {
 		return 0, 0
 	}
 	
-	// Load and select the appropriate font
-	selectedFont := SelectFont(style)
-	if selectedFont == nil {
-		// Fallback to basicfont dimensions with scaling
-		face := basicfont.Face7x13
-		scale := style.Size / css.BaseFontHeight
-		width := float64(len(text)*face.Advance) * scale
-		height := float64(face.Height) * scale
-		return width, height
+	// Shape the text into runs by glyph coverage; each run is measured
+	// with its own face, as render draws it (shaping.go)
+	runs := Shape(text, style)
+	if runs == nil {
+		return measureBasicFont(text, style)
 	}
-	
-	// Create face with proper DPI and size
-	face, err := opentype.NewFace(selectedFont, &opentype.FaceOptions{
-		Size:    style.Size,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		// Fallback to basicfont dimensions with scaling
-		basicFace := basicfont.Face7x13
-		scale := style.Size / css.BaseFontHeight
-		width := float64(len(text)*basicFace.Advance) * scale
-		height := float64(basicFace.Height) * scale
-		return width, height
-	}
-	defer face.Close()
-	
-	// Measure text using font drawer
-	metrics := face.Metrics()
-	drawer := &font.Drawer{
-		Face: face,
+
+	var width, ascent, descent fixed.Int26_6
+	for _, run := range runs {
+		width += run.Advance
+		ascent = max(ascent, run.Ascent)
+		descent = max(descent, run.Descent)
 	}
-	
-	width := drawer.MeasureString(text).Ceil()
+
 	// Use line-height for height (ascent + descent gives the font's natural line height)
 	// CSS 2.1 §10.8.1: line-height initial value is "normal", typically 1.2
-	height := (metrics.Ascent + metrics.Descent).Ceil()
-	
-	return float64(width), float64(height)
+	return float64(width.Ceil()), float64((ascent + descent).Ceil())
+}
+
+// measureBasicFont measures text with the scaled basicfont bitmap font, used
+// when no TrueType font can be loaded.
+func measureBasicFont(text string, style Style) (float64, float64) {
+	face := basicfont.Face7x13
+	scale := style.Size / css.BaseFontHeight
+	width := float64(len(text)*face.Advance) * scale
+	height := float64(face.Height) * scale
+	return width, height
+}
+
+// NewFace creates a font.Face drawing the face at size pixels, with the
+// options shared by layout and rendering.
+func (f *Face) NewFace(size float64) (font.Face, error) {
+	parsed, err := f.Load()
+	if err != nil {
+		return nil, err
+	}
+	return opentype.NewFace(parsed, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
 }
@@ -0,0 +1,240 @@
+package font
+
+// This file implements font family matching: walking a font-family list,
+// mapping generic families to concrete fonts, and falling back to the
+// built-in Go fonts.
+//
+// Spec references:
+// - CSS Fonts Level 4 §5 Font Matching Algorithm: https://www.w3.org/TR/css-fonts-4/#font-matching-algorithm
+// - CSS Fonts Level 4 §2.1.3 Generic font families: https://www.w3.org/TR/css-fonts-4/#generic-font-families
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lukehoban/browser/css"
+	"golang.org/x/image/font/gofont/gomedium"
+	"golang.org/x/image/font/gofont/gomediumitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+)
+
+// Built-in family names.
+const (
+	GoFamily     = "Go"      // Proportional sans-serif Go fonts
+	GoMonoFamily = "Go Mono" // Monospaced Go fonts
+)
+
+// genericFamilies maps each generic family to the concrete families tried
+// for it, in order. The Go fonts cover sans-serif and monospace; the other
+// generics prefer common installed fonts found by AddSystemFonts and fall
+// back to the Go fonts.
+// CSS Fonts Level 4 §2.1.3 Generic font families
+var genericFamilies = map[string][]string{
+	"serif":         {"DejaVu Serif", "Liberation Serif", "Noto Serif", "Times New Roman", "Times", GoFamily},
+	"sans-serif":    {GoFamily},
+	"monospace":     {GoMonoFamily},
+	"cursive":       {"Comic Neue", "Comic Sans MS", "URW Chancery L", GoFamily},
+	"fantasy":       {"Impact", "Papyrus", GoFamily},
+	"system-ui":     {GoFamily},
+	"ui-serif":      {"DejaVu Serif", "Liberation Serif", "Noto Serif", GoFamily},
+	"ui-sans-serif": {GoFamily},
+	"ui-monospace":  {GoMonoFamily},
+	"ui-rounded":    {GoFamily},
+	"math":          {"STIX Two Math", "DejaVu Math TeX Gyre", GoFamily},
+	"emoji":         {"Noto Color Emoji", "Noto Emoji", GoFamily},
+	"fangsong":      {"FangSong", GoFamily},
+}
+
+// defaultFamily is used when no family in the font-family list matches.
+// CSS Fonts Level 4 §2.1: The initial value of font-family depends on the
+// user agent
+const defaultFamily = "sans-serif"
+
+var (
+	builtinFaces    []*Face
+	builtinOnce     sync.Once
+	builtinFacesErr error
+)
+
+// loadBuiltinFaces returns the faces of the embedded Go fonts.
+func loadBuiltinFaces() ([]*Face, error) {
+	builtinOnce.Do(func() {
+		if builtinFacesErr = LoadGoFonts(); builtinFacesErr != nil {
+			return
+		}
+		face := func(family string, f *opentype.Font, weight int, style string) *Face {
+			return &Face{Family: family, Font: f, WeightMin: weight, WeightMax: weight, Style: style, Source: SourceBuiltin}
+		}
+		builtinFaces = []*Face{
+			face(GoFamily, goRegularFont, 400, "normal"),
+			face(GoFamily, goBoldFont, 700, "normal"),
+			face(GoFamily, goItalicFont, 400, "italic"),
+			face(GoFamily, goBoldItalicFont, 700, "italic"),
+		}
+		for _, extra := range []struct {
+			family string
+			ttf    []byte
+			weight int
+			style  string
+		}{
+			{GoFamily, gomedium.TTF, 500, "normal"},
+			{GoFamily, gomediumitalic.TTF, 500, "italic"},
+			{GoMonoFamily, gomono.TTF, 400, "normal"},
+			{GoMonoFamily, gomonobold.TTF, 700, "normal"},
+			{GoMonoFamily, gomonoitalic.TTF, 400, "italic"},
+			{GoMonoFamily, gomonobolditalic.TTF, 700, "italic"},
+		} {
+			parsed, err := ParseFont(extra.ttf)
+			if err != nil {
+				builtinFacesErr = err
+				return
+			}
+			builtinFaces = append(builtinFaces, face(extra.family, parsed, extra.weight, extra.style))
+		}
+	})
+	return builtinFaces, builtinFacesErr
+}
+
+// Resolve returns the face used to draw text in style, or nil if not even
+// the built-in fonts can be loaded. Each family of style.Family is tried in
+// order, generic families are mapped to concrete ones, and within a family
+// the face closest in stretch, style and weight is chosen. Faces whose
+// unicode-range excludes the first non-space character of text are skipped.
+// CSS Fonts Level 4 §5 Font Matching Algorithm
+func Resolve(text string, style Style) *Face {
+	query := newQuery(style)
+	query.Char = firstChar(text)
+	for _, family := range fontFamilies(style.Family) {
+		for _, candidate := range concreteFamilies(family) {
+			if face := matchFamily(candidate, query); face != nil {
+				return face
+			}
+		}
+	}
+	return nil
+}
+
+// newQuery returns the query matching faces against style.
+func newQuery(style Style) Query {
+	query := Query{
+		Weight:  Weight(style.Weight),
+		Stretch: style.Stretch,
+		Style:   style.Style,
+	}
+	if query.Style != "italic" {
+		query.Style = "normal"
+	}
+	return query
+}
+
+// parsedFamilies memoizes fontFamilies; documents use few distinct
+// font-family values.
+var parsedFamilies sync.Map // string -> []string
+
+// fontFamilies returns the families of a font-family value followed by the
+// default family. The result is shared and must not be modified.
+func fontFamilies(value string) []string {
+	if families, ok := parsedFamilies.Load(value); ok {
+		return families.([]string)
+	}
+	families := append(css.ParseFontFamilies(value), defaultFamily)
+	families = families[:len(families):len(families)]
+	parsedFamilies.Store(value, families)
+	return families
+}
+
+// concreteFamilies maps a generic family to the concrete families tried
+// for it, and returns any other family as is.
+func concreteFamilies(family string) []string {
+	if candidates, generic := genericFamilies[strings.ToLower(family)]; generic {
+		return candidates
+	}
+	return []string{family}
+}
+
+// matchFamily returns the best loadable face of a concrete family: web
+// fonts first, then installed fonts, then the built-in Go fonts.
+func matchFamily(family string, query Query) *Face {
+	if face := DefaultRegistry.Match(family, query); face != nil {
+		if _, err := face.Load(); err == nil {
+			return face
+		}
+	}
+	return matchBuiltin(family, query)
+}
+
+// builtinKey identifies a match among the built-in faces.
+type builtinKey struct {
+	family string
+	query  Query
+}
+
+// builtinMatches memoizes matchBuiltin. The built-in faces never change
+// and have no unicode-range, so matches depend only on the family and the
+// style descriptors.
+var builtinMatches sync.Map // builtinKey -> *Face
+
+// matchBuiltin returns the closest built-in face of family, or nil.
+func matchBuiltin(family string, query Query) *Face {
+	query.Char = 0
+	key := builtinKey{family: strings.ToLower(family), query: query}
+	if face, ok := builtinMatches.Load(key); ok {
+		return face.(*Face)
+	}
+
+	builtin, err := loadBuiltinFaces()
+	if err != nil {
+		return nil
+	}
+	var face *Face
+	if faces := familyFaces(builtin, family); len(faces) > 0 {
+		face = matchFace(faces, query)
+	}
+	builtinMatches.Store(key, face)
+	return face
+}
+
+// firstChar returns the first non-space character of text, or 0.
+func firstChar(text string) rune {
+	for _, r := range text {
+		if r != ' ' {
+			return r
+		}
+	}
+	return 0
+}
+
+// stretchKeywords maps font-stretch keywords to percentages.
+// CSS Fonts Level 4 §2.3 Font width: the font-stretch property
+var stretchKeywords = map[string]float64{
+	"ultra-condensed": 50,
+	"extra-condensed": 62.5,
+	"condensed":       75,
+	"semi-condensed":  87.5,
+	"normal":          100,
+	"semi-expanded":   112.5,
+	"expanded":        125,
+	"extra-expanded":  150,
+	"ultra-expanded":  200,
+}
+
+// Stretch converts a font-stretch value, a keyword or a percentage, to a
+// percentage. Invalid values are normal (100%).
+// CSS Fonts Level 4 §2.3 Font width: the font-stretch property
+func Stretch(value string) float64 {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if percent, ok := stretchKeywords[value]; ok {
+		return percent
+	}
+	if strings.HasSuffix(value, "%") {
+		if percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil && percent > 0 {
+			return percent
+		}
+	}
+	return 100
+}
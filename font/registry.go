@@ -0,0 +1,458 @@
+package font
+
+// This file implements the registry of web fonts declared by @font-face
+// rules, and the font matching algorithm that selects among them.
+//
+// Spec references:
+// - CSS Fonts Level 4 §4 Font Resources: https://www.w3.org/TR/css-fonts-4/#font-resources
+// - CSS Fonts Level 4 §5.2 Matching font styles: https://www.w3.org/TR/css-fonts-4/#font-style-matching
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/log"
+	"golang.org/x/image/font/opentype"
+)
+
+// Face sources, in the order font matching prefers them for a family name.
+const (
+	SourceWeb     = "web"     // Declared by an @font-face rule
+	SourceSystem  = "system"  // Found by scanning a font directory
+	SourceBuiltin = "builtin" // One of the Go fonts embedded in the binary
+)
+
+// Face is a font face: an @font-face rule, an installed font file or a
+// built-in Go font.
+// CSS Fonts Level 4 §4.1 The @font-face rule
+type Face struct {
+	Family       string // Family name, matched case-insensitively
+	Font         *opentype.Font
+	WeightMin    int     // Lower bound of the font-weight descriptor range
+	WeightMax    int     // Upper bound of the font-weight descriptor range
+	StretchMin   float64 // Lower bound of the font-stretch range, as a percentage
+	StretchMax   float64 // Upper bound of the font-stretch range, as a percentage
+	Style        string  // "normal" or "italic" (oblique faces are registered as italic)
+	UnicodeRange []css.UnicodeRange
+	Source       string // SourceWeb, SourceSystem or SourceBuiltin
+	Path         string // Font file of a system face, loaded on first use
+
+	once    sync.Once
+	loadErr error
+}
+
+// Load returns the face's font, reading and parsing the font file of a
+// system face the first time it is needed.
+func (f *Face) Load() (*opentype.Font, error) {
+	f.once.Do(func() {
+		if f.Font != nil || f.Path == "" {
+			return
+		}
+		data, err := os.ReadFile(f.Path)
+		if err == nil {
+			f.Font, err = ParseFont(data)
+		}
+		f.loadErr = err
+	})
+	if f.Font == nil && f.loadErr == nil {
+		return nil, fmt.Errorf("font family '%s' has no font data", f.Family)
+	}
+	return f.Font, f.loadErr
+}
+
+// String describes the face for debugging output, for example
+// "Go Mono" 700 100% italic (builtin).
+func (f *Face) String() string {
+	weight := strconv.Itoa(f.WeightMin)
+	if f.WeightMax != f.WeightMin {
+		weight += "-" + strconv.Itoa(f.WeightMax)
+	}
+	stretch := formatPercent(f.stretchMin())
+	if f.stretchMax() != f.stretchMin() {
+		stretch += "-" + formatPercent(f.stretchMax())
+	}
+	source := f.Source
+	if f.Path != "" {
+		source += " " + f.Path
+	}
+	return fmt.Sprintf("%q %s %s %s (%s)", f.Family, weight, stretch, f.Style, source)
+}
+
+func formatPercent(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64) + "%"
+}
+
+// stretchMin and stretchMax return the face's font-stretch range, with
+// the zero value meaning normal (100%).
+func (f *Face) stretchMin() float64 {
+	if f.StretchMin == 0 {
+		return 100
+	}
+	return f.StretchMin
+}
+
+func (f *Face) stretchMax() float64 {
+	if f.StretchMax == 0 {
+		return f.stretchMin()
+	}
+	return f.StretchMax
+}
+
+// Query is the font style a face is matched against.
+// CSS Fonts Level 4 §5.2 Matching font styles
+type Query struct {
+	Weight  int     // Desired font-weight, 1-1000
+	Stretch float64 // Desired font-stretch as a percentage; 0 means 100%
+	Style   string  // "normal" or "italic"
+	Char    rune    // Character the face must cover, or 0 for any
+}
+
+// Registry holds the web font faces available to a document, and the
+// faces of installed fonts found by AddSystemFonts.
+// It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	faces    []*Face
+	system   []*Face
+	fallback []string
+}
+
+// DefaultRegistry is the registry consulted by SelectFont and MeasureText.
+var DefaultRegistry = &Registry{}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Add registers a face. Faces added later take precedence over earlier
+// faces with the same descriptors.
+// CSS Fonts Level 4 §4.1: The last @font-face rule defined wins
+func (r *Registry) Add(face *Face) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.faces = append(r.faces, face)
+}
+
+// Reset removes all web font faces, releasing the data cached for their
+// fonts. System faces are kept.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	faces := r.faces
+	r.faces = nil
+	r.mu.Unlock()
+
+	for _, face := range faces {
+		if face.Source == SourceWeb && face.Font != nil {
+			releaseFont(face.Font)
+		}
+	}
+}
+
+// Len returns the number of registered web font faces.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.faces)
+}
+
+// Match returns the face of family that best matches query, or nil if the
+// family has no face covering query.Char. Web fonts hide system fonts of
+// the same family name.
+// CSS Fonts Level 4 §4.1: A family defined by @font-face rules is used in
+// place of an installed font of the same name
+func (r *Registry) Match(family string, query Query) *Face {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if faces := familyFaces(r.faces, family); len(faces) > 0 {
+		return matchFace(faces, query)
+	}
+	return matchFace(familyFaces(r.system, family), query)
+}
+
+// familyFaces returns the faces of family, latest first.
+func familyFaces(faces []*Face, family string) []*Face {
+	matched := make([]*Face, 0)
+	for i := len(faces) - 1; i >= 0; i-- {
+		if strings.EqualFold(faces[i].Family, family) {
+			matched = append(matched, faces[i])
+		}
+	}
+	return matched
+}
+
+// matchFace narrows the faces of one family to the best match for query.
+// CSS Fonts Level 4 §5.2 Matching font styles
+func matchFace(faces []*Face, query Query) *Face {
+	candidates := make([]*Face, 0, len(faces))
+	for _, face := range faces {
+		if query.Char == 0 || css.ContainsRune(face.UnicodeRange, query.Char) {
+			candidates = append(candidates, face)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// §5.2 step 4a: font-stretch is matched first
+	stretch := query.Stretch
+	if stretch == 0 {
+		stretch = 100
+	}
+	candidates = closest(candidates, func(face *Face) float64 {
+		return stretchDistance(stretch, face.stretchMin(), face.stretchMax())
+	})
+
+	// §5.2 step 4b: then font-style. Italic falls back to normal faces,
+	// and normal falls back to italic faces.
+	styled := make([]*Face, 0, len(candidates))
+	for _, face := range candidates {
+		if face.Style == query.Style {
+			styled = append(styled, face)
+		}
+	}
+	if len(styled) > 0 {
+		candidates = styled
+	}
+
+	// §5.2 step 4c: then font-weight
+	return closest(candidates, func(face *Face) float64 {
+		return float64(weightDistance(query.Weight, face.WeightMin, face.WeightMax))
+	})[0]
+}
+
+// closest returns the faces with the lowest distance, in order.
+func closest(faces []*Face, distance func(*Face) float64) []*Face {
+	best := make([]*Face, 0, 1)
+	bestDistance := 0.0
+	for _, face := range faces {
+		d := distance(face)
+		switch {
+		case len(best) == 0 || d < bestDistance:
+			best, bestDistance = append(best[:0], face), d
+		case d == bestDistance:
+			best = append(best, face)
+		}
+	}
+	return best
+}
+
+// stretchDistance ranks a face's stretch range for a desired stretch; lower
+// is better. A range containing the stretch ranks 0.
+// CSS Fonts Level 4 §5.2 step 4a: If the desired stretch is 100% or less,
+// narrower widths are checked in descending order, then wider widths in
+// ascending order; otherwise wider widths are checked first
+func stretchDistance(desired, low, high float64) float64 {
+	if desired >= low && desired <= high {
+		return 0
+	}
+	const tier = 10000
+	if desired <= 100 {
+		if high < desired {
+			return desired - high
+		}
+		return tier + low - desired
+	}
+	if low > desired {
+		return low - desired
+	}
+	return tier + desired - high
+}
+
+// weightDistance ranks a face's weight range for a desired weight; lower
+// is better. A range containing the weight ranks 0.
+// CSS Fonts Level 4 §5.2 step 4c:
+// - If the desired weight is between 400 and 500, weights up to 500 are
+// checked first in ascending order, then lighter weights in descending order,
+// then heavier weights in ascending order
+// - If the desired weight is less than 400, lighter weights are checked in
+// descending order, then heavier weights in ascending order
+// - If the desired weight is greater than 500, heavier weights are checked in
+// ascending order, then lighter weights in descending order
+func weightDistance(desired, low, high int) int {
+	if desired >= low && desired <= high {
+		return 0
+	}
+	const tier = 10000
+	switch {
+	case desired >= 400 && desired <= 500:
+		if low > desired && low <= 500 {
+			return low - desired
+		}
+		if high < desired {
+			return tier + desired - high
+		}
+		return 2*tier + low - desired
+	case desired < 400:
+		if high < desired {
+			return desired - high
+		}
+		return tier + low - desired
+	default:
+		if low > desired {
+			return low - desired
+		}
+		return tier + desired - high
+	}
+}
+
+// Weight converts a Style.Weight value to a numeric font weight:
+// "bold" is 700, numeric weights are used as is, and anything else is 400.
+// The style package has already resolved bolder and lighter to numbers.
+// CSS Fonts Level 4 §2.2 Font weight: the font-weight property
+func Weight(weight string) int {
+	if weight == "bold" {
+		return 700
+	}
+	if n, err := strconv.Atoi(weight); err == nil && n >= 1 && n <= 1000 {
+		return n
+	}
+	return 400
+}
+
+// webFontFormats are the format() hints of the src descriptor this package
+// can decode.
+// CSS Fonts Level 4 §4.3.1 Font formats
+var webFontFormats = map[string]bool{
+	"truetype": true,
+	"opentype": true,
+	"woff":     true,
+	"woff2":    true,
+}
+
+// LoadFontFaces fetches, decodes and registers in DefaultRegistry the
+// faces of the @font-face rules whose media matches env. Each face uses
+// the first src entry that loads; faces with no loadable source are
+// skipped with a warning.
+func LoadFontFaces(faces []*css.FontFace, env css.MediaEnvironment) {
+	DefaultRegistry.LoadFontFaces(faces, env)
+}
+
+// LoadFontFaces fetches, decodes and registers the faces of the
+// @font-face rules whose media matches env.
+// CSS Fonts Level 4 §4.3: The src entries are tried in order until one
+// loads successfully
+func (r *Registry) LoadFontFaces(faces []*css.FontFace, env css.MediaEnvironment) {
+	for _, fontFace := range faces {
+		if !fontFace.MatchesMedia(env) {
+			continue
+		}
+		families := css.ParseFontFamilies(fontFace.Descriptor("font-family"))
+		if len(families) != 1 {
+			// CSS Fonts Level 4 §4.2: The descriptor takes a single family
+			log.Warnf("Ignoring @font-face with invalid font-family %q", fontFace.Descriptor("font-family"))
+			continue
+		}
+
+		parsed, err := loadFontSources(fontFace)
+		if err != nil {
+			log.Warnf("Failed to load font family '%s': %v", families[0], err)
+			continue
+		}
+
+		weightMin, weightMax := parseWeightRange(fontFace.Descriptor("font-weight"))
+		stretchMin, stretchMax := parseStretchRange(fontFace.Descriptor("font-stretch"))
+		r.Add(&Face{
+			Family:       families[0],
+			Font:         parsed,
+			WeightMin:    weightMin,
+			WeightMax:    weightMax,
+			StretchMin:   stretchMin,
+			StretchMax:   stretchMax,
+			Style:        parseFaceStyle(fontFace.Descriptor("font-style")),
+			UnicodeRange: css.ParseUnicodeRange(fontFace.Descriptor("unicode-range")),
+			Source:       SourceWeb,
+		})
+	}
+}
+
+// loadFontSources returns the font of the first src entry of a face that
+// can be fetched and decoded.
+func loadFontSources(fontFace *css.FontFace) (*opentype.Font, error) {
+	loader := dom.NewResourceLoader(fontFace.BaseURL)
+	var lastErr error = fmt.Errorf("no usable src")
+	for _, source := range css.ParseFontSources(fontFace.Descriptor("src")) {
+		if source.URL == "" {
+			// local() fonts are not supported
+			continue
+		}
+		// CSS Fonts Level 4 §4.3: Sources with an unsupported format hint
+		// are skipped without being downloaded
+		if source.Format != "" && !webFontFormats[source.Format] {
+			continue
+		}
+		data, err := loader.LoadResource(dom.ResolveURLString(fontFace.BaseURL, source.URL))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		parsed, err := ParseFont(data)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", source.URL, err)
+			continue
+		}
+		return parsed, nil
+	}
+	return nil, lastErr
+}
+
+// parseWeightRange parses a font-weight descriptor: a keyword, a number, or
+// a range of two numbers. The initial value is normal (400).
+// CSS Fonts Level 4 §4.4 Font property descriptors
+func parseWeightRange(value string) (int, int) {
+	fields := strings.Fields(strings.ToLower(value))
+	switch len(fields) {
+	case 1:
+		if fields[0] == "auto" {
+			return 1, 1000
+		}
+		w := Weight(fields[0])
+		return w, w
+	case 2:
+		low, high := Weight(fields[0]), Weight(fields[1])
+		if low > high {
+			// Reversed ranges are swapped
+			low, high = high, low
+		}
+		return low, high
+	}
+	return 400, 400
+}
+
+// parseStretchRange parses a font-stretch descriptor: a keyword, a
+// percentage, or a range of two. The initial value is normal (100%).
+// CSS Fonts Level 4 §4.4 Font property descriptors
+func parseStretchRange(value string) (float64, float64) {
+	fields := strings.Fields(value)
+	switch len(fields) {
+	case 1:
+		if strings.EqualFold(fields[0], "auto") {
+			return 50, 200
+		}
+		s := Stretch(fields[0])
+		return s, s
+	case 2:
+		low, high := Stretch(fields[0]), Stretch(fields[1])
+		if low > high {
+			low, high = high, low
+		}
+		return low, high
+	}
+	return 100, 100
+}
+
+// parseFaceStyle parses a font-style descriptor. Oblique faces are matched
+// as italic.
+func parseFaceStyle(value string) string {
+	fields := strings.Fields(strings.ToLower(value))
+	if len(fields) > 0 && (fields[0] == "italic" || fields[0] == "oblique") {
+		return "italic"
+	}
+	return "normal"
+}
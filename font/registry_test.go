@@ -0,0 +1,316 @@
+package font
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// TestRegistryMatch tests font matching by style, weight and unicode-range.
+// CSS Fonts Level 4 §5.2 Matching font styles
+func TestRegistryMatch(t *testing.T) {
+	registry := NewRegistry()
+	light := &Face{Family: "Test", WeightMin: 300, WeightMax: 300, Style: "normal"}
+	regular := &Face{Family: "Test", WeightMin: 400, WeightMax: 400, Style: "normal"}
+	bold := &Face{Family: "Test", WeightMin: 600, WeightMax: 800, Style: "normal"}
+	italic := &Face{Family: "Test", WeightMin: 400, WeightMax: 400, Style: "italic"}
+	greek := &Face{Family: "Greek", WeightMin: 400, WeightMax: 400, Style: "normal", UnicodeRange: css.ParseUnicodeRange("U+0370-03FF")}
+	for _, face := range []*Face{light, regular, bold, italic, greek} {
+		registry.Add(face)
+	}
+
+	tests := []struct {
+		name     string
+		family   string
+		weight   int
+		style    string
+		ch       rune
+		expected *Face
+	}{
+		{"exact", "Test", 400, "normal", 'a', regular},
+		{"case-insensitive family", "TEST", 300, "normal", 'a', light},
+		{"weight in range", "Test", 700, "normal", 'a', bold},
+		{"heavier than all", "Test", 900, "normal", 'a', bold},
+		{"500 prefers lighter over heavier", "Test", 500, "normal", 'a', regular},
+		{"below 400 prefers lighter", "Test", 350, "normal", 'a', light},
+		{"above 500 prefers heavier", "Test", 550, "normal", 'a', bold},
+		{"italic", "Test", 700, "italic", 'a', italic},
+		{"unicode-range", "Greek", 400, "normal", 'λ', greek},
+		{"outside unicode-range", "Greek", 400, "normal", 'a', nil},
+		{"unknown family", "Other", 400, "normal", 'a', nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := registry.Match(tt.family, Query{Weight: tt.weight, Style: tt.style, Char: tt.ch}); got != tt.expected {
+				t.Errorf("Match(%q, %d, %q) = %+v, want %+v", tt.family, tt.weight, tt.style, got, tt.expected)
+			}
+		})
+	}
+
+	// CSS Fonts Level 4 §4.1: Later faces with the same descriptors win
+	override := &Face{Family: "Test", WeightMin: 400, WeightMax: 400, Style: "normal"}
+	registry.Add(override)
+	if got := registry.Match("Test", Query{Weight: 400, Style: "normal", Char: 'a'}); got != override {
+		t.Error("Expected the last matching face to win")
+	}
+}
+
+// TestLoadFontFaces tests loading @font-face sources from files, skipping
+// unsupported formats, failed sources and non-matching media.
+// CSS Fonts Level 4 §4.3 Font reference: the src descriptor
+func TestLoadFontFaces(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "fonts"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"fonts/regular.woff": encodeWOFF(t, goregular.TTF),
+		"fonts/bold.woff2":   encodeWOFF2(t, gobold.TTF),
+		"fonts/italic.ttf":   goitalic.TTF,
+		"fonts/broken.woff":  []byte("wOFFbroken"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sheet := css.Parse(`
+@font-face { font-family: Web; src: url(missing.woff2), url(fonts/broken.woff), url(fonts/regular.woff) format("woff"); }
+@font-face { font-family: "Web"; src: url(fonts/italic.ttf) format("svg"), url(fonts/bold.woff2) format("woff2"); font-weight: bold; }
+@font-face { font-family: Web; src: url(fonts/italic.ttf); font-style: italic; }
+@font-face { font-family: Missing; src: url(missing.ttf); }
+@media print { @font-face { font-family: Print; src: url(fonts/italic.ttf); } }
+`)
+	for _, face := range sheet.FontFaces {
+		face.BaseURL = dir
+	}
+
+	registry := NewRegistry()
+	registry.LoadFontFaces(sheet.FontFaces, css.DefaultMediaEnvironment())
+	if registry.Len() != 3 {
+		t.Fatalf("Expected 3 faces, got %d", registry.Len())
+	}
+
+	bold := registry.Match("Web", Query{Weight: 700, Style: "normal"})
+	if bold == nil || bold.WeightMin != 700 || bold.WeightMax != 700 {
+		t.Fatalf("Expected the bold face, got %+v", bold)
+	}
+	italic := registry.Match("Web", Query{Weight: 400, Style: "italic"})
+	if italic == nil || italic.Style != "italic" {
+		t.Fatalf("Expected the italic face, got %+v", italic)
+	}
+	if registry.Match("Print", Query{Weight: 400}) != nil {
+		t.Error("Expected the @media print face not to be loaded")
+	}
+}
+
+// TestRegistryResetReleasesFonts tests that web fonts loaded again and
+// again, as each render of the WebAssembly build does, do not pile up in
+// the shaping caches once the registry is reset.
+func TestRegistryResetReleasesFonts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "mono.ttf"), gomono.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sheet := css.Parse(`@font-face { font-family: Reloaded; src: url(mono.ttf); }`)
+	sheet.FontFaces[0].BaseURL = dir
+
+	count := func(m *sync.Map) int {
+		n := 0
+		m.Range(func(any, any) bool {
+			n++
+			return true
+		})
+		return n
+	}
+	registry := NewRegistry()
+	fonts, shaped := count(&fontData), count(&shapers)
+	for i := 0; i < 5; i++ {
+		registry.LoadFontFaces(sheet.FontFaces, css.DefaultMediaEnvironment())
+		face := registry.Match("Reloaded", Query{Weight: 400, Style: "normal"})
+		if face == nil || shaperFor(face.Font) == nil {
+			t.Fatalf("Expected a shapable web font, got %+v", face)
+		}
+		registry.Reset()
+	}
+	if got := count(&fontData); got != fonts {
+		t.Errorf("Expected %d fonts with sfnt data after reloading, got %d", fonts, got)
+	}
+	if got := count(&shapers); got != shaped {
+		t.Errorf("Expected %d shapers after reloading, got %d", shaped, got)
+	}
+}
+
+// TestSelectFontForText tests that registered web fonts are used for the
+// first matching family, and the Go fonts otherwise.
+func TestSelectFontForText(t *testing.T) {
+	mono, err := opentype.Parse(gomono.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	DefaultRegistry.Add(&Face{Family: "Web Font", Font: mono, WeightMin: 400, WeightMax: 400, Style: "normal", UnicodeRange: css.ParseUnicodeRange("U+0-7F")})
+	defer DefaultRegistry.Reset()
+
+	if err := LoadGoFonts(); err != nil {
+		t.Fatal(err)
+	}
+	goMono := Resolve("", Style{Family: "Go Mono"}).Font
+	tests := []struct {
+		text     string
+		family   string
+		expected *opentype.Font
+	}{
+		{"Hello", `Missing, "Web Font", serif`, mono},
+		{"  Hello", "web font", mono},
+		{"Héllo", "Arial", goRegularFont},
+		{"λ", "Web Font", goRegularFont},
+		{"Hello", "", goRegularFont},
+		{"Hello", "Arial, monospace", goMono},
+	}
+
+	for _, tt := range tests {
+		if got := SelectFontForText(tt.text, Style{Family: tt.family, Size: 16}); got != tt.expected {
+			t.Errorf("SelectFontForText(%q, %q) selected the wrong font", tt.text, tt.family)
+		}
+	}
+
+	regularWidth, _ := MeasureText("Hello", Style{Size: 16})
+	webWidth, _ := MeasureText("Hello", Style{Family: "Web Font", Size: 16})
+	if regularWidth == webWidth {
+		t.Errorf("Expected the web font to change the measured width, got %v for both", webWidth)
+	}
+}
+
+// TestRegistryMatchStretch tests that font-stretch is matched before
+// font-style and font-weight.
+// CSS Fonts Level 4 §5.2 step 4a
+func TestRegistryMatchStretch(t *testing.T) {
+	registry := NewRegistry()
+	condensed := &Face{Family: "Test", WeightMin: 700, WeightMax: 700, StretchMin: 75, StretchMax: 75, Style: "normal"}
+	normal := &Face{Family: "Test", WeightMin: 400, WeightMax: 400, Style: "italic"}
+	expanded := &Face{Family: "Test", WeightMin: 400, WeightMax: 400, StretchMin: 112.5, StretchMax: 150, Style: "normal"}
+	for _, face := range []*Face{condensed, normal, expanded} {
+		registry.Add(face)
+	}
+
+	tests := []struct {
+		stretch  float64
+		expected *Face
+	}{
+		{0, normal},
+		{100, normal},
+		{87.5, condensed},
+		{50, condensed},
+		{125, expanded},
+		{200, expanded},
+	}
+
+	for _, tt := range tests {
+		if got := registry.Match("Test", Query{Weight: 400, Stretch: tt.stretch, Style: "normal"}); got != tt.expected {
+			t.Errorf("Match(stretch %v) = %v, want %v", tt.stretch, got, tt.expected)
+		}
+	}
+}
+
+// TestAddSystemFonts tests indexing installed font files by family, weight,
+// width and style, and loading them on first use.
+func TestAddSystemFonts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "truetype/go"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"truetype/go/Go-Mono-Bold.ttf": gomonobold.TTF,
+		"truetype/go/Go-Italic.WOFF":   encodeWOFF(t, goitalic.TTF),
+		"truetype/readme.txt":          []byte("not a font"),
+		"truetype/broken.ttf":          []byte("not a font"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := NewRegistry()
+	if n := registry.AddSystemFonts(dir, filepath.Join(dir, "missing")); n != 2 {
+		t.Fatalf("Expected 2 system faces, got %d", n)
+	}
+	if registry.Len() != 0 {
+		t.Errorf("Expected system faces not to count as web fonts")
+	}
+
+	bold := registry.Match("go mono", Query{Weight: 400, Style: "normal"})
+	if bold == nil || bold.WeightMin != 600 || bold.Source != SourceSystem || bold.Font != nil {
+		t.Fatalf("Expected an unloaded Go Mono system face of weight class 600, got %v", bold)
+	}
+	if f, err := bold.Load(); err != nil || f == nil {
+		t.Fatalf("Load() = %v, %v", f, err)
+	}
+	italic := registry.Match("Go", Query{Weight: 400, Style: "normal"})
+	if italic == nil || italic.Style != "italic" {
+		t.Errorf("Expected the italic Go system face, got %v", italic)
+	}
+
+	// Web fonts hide system fonts of the same family
+	web := &Face{Family: "Go", WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb}
+	registry.Add(web)
+	if got := registry.Match("Go", Query{Weight: 400, Style: "italic"}); got != web {
+		t.Errorf("Expected the web face, got %v", got)
+	}
+}
+
+// TestResolveGenericFamilies tests the mapping of generic families and the
+// fallback through the font-family list.
+// CSS Fonts Level 4 §2.1.3 Generic font families
+func TestResolveGenericFamilies(t *testing.T) {
+	tests := []struct {
+		family   string
+		weight   string
+		style    string
+		expected string
+	}{
+		{"", "normal", "normal", `"Go" 400 100% normal (builtin)`},
+		{"monospace", "bold", "normal", `"Go Mono" 700 100% normal (builtin)`},
+		{"Unknown, MONOSPACE", "normal", "italic", `"Go Mono" 400 100% italic (builtin)`},
+		{"serif", "500", "normal", `"Go" 500 100% normal (builtin)`},
+		{"'Go Mono', sans-serif", "900", "italic", `"Go Mono" 700 100% italic (builtin)`},
+		{"Unknown", "300", "normal", `"Go" 400 100% normal (builtin)`},
+	}
+
+	for _, tt := range tests {
+		face := Resolve("text", Style{Family: tt.family, Weight: tt.weight, Style: tt.style})
+		if face == nil || face.String() != tt.expected {
+			t.Errorf("Resolve(%q, %s, %s) = %v, want %s", tt.family, tt.weight, tt.style, face, tt.expected)
+		}
+	}
+}
+
+// TestStretch tests parsing of font-stretch values.
+// CSS Fonts Level 4 §2.3 Font width: the font-stretch property
+func TestStretch(t *testing.T) {
+	tests := map[string]float64{
+		"condensed":       75,
+		"Ultra-Expanded":  200,
+		"normal":          100,
+		"87.5%":           87.5,
+		"-10%":            100,
+		"wide":            100,
+		"semi-condensed ": 87.5,
+	}
+	for value, expected := range tests {
+		if got := Stretch(value); got != expected {
+			t.Errorf("Stretch(%q) = %v, want %v", value, got, expected)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package font
+
+// This file shapes text into positioned glyphs with OpenType layout
+// features: kerning from GPOS, ligatures and contextual alternates from
+// GSUB. Layout measures shaped runs and render draws them, so both agree
+// on every glyph position.
+//
+// Spec references:
+// - CSS Fonts Level 4 §6.4 Kerning: the font-kerning property: https://www.w3.org/TR/css-fonts-4/#font-kerning-prop
+// - CSS Fonts Level 4 §6.5 Ligatures: the font-variant-ligatures property: https://www.w3.org/TR/css-fonts-4/#font-variant-ligatures-prop
+// - CSS Fonts Level 4 §6.12 Low-level font feature settings control: https://www.w3.org/TR/css-fonts-4/#font-feature-settings-prop
+// - CSS Fonts Level 4 §7.2 Feature precedence: https://www.w3.org/TR/css-fonts-4/#feature-precedence
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-text/typesetting/di"
+	gotext "github.com/go-text/typesetting/font"
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Glyph is a glyph of shaped text, positioned relative to the pen.
+type Glyph struct {
+	ID      sfnt.GlyphIndex
+	Advance fixed.Int26_6 // Pen movement after the glyph
+	XOffset fixed.Int26_6 // Horizontal offset of the glyph from the pen
+	YOffset fixed.Int26_6 // Vertical offset, positive up
+	Cluster int           // Byte offset in the run text of the first character drawn
+}
+
+// ShapedRun is a run of text shaped into glyphs with a single face.
+type ShapedRun struct {
+	Run
+	Size    float64 // Font size in pixels
+	Glyphs  []Glyph
+	Advance fixed.Int26_6 // Sum of the glyph advances
+	Ascent  fixed.Int26_6
+	Descent fixed.Int26_6
+}
+
+// Shape splits text into runs by glyph coverage (see SegmentText) and
+// shapes each run with the OpenType features selected by style. Glyph
+// advances are rounded to whole pixels, as hinted faces round them. It
+// returns nil if not even the built-in fonts can be loaded.
+//
+// Right-to-left text, which must be of a single bidi level (see package
+// bidi), is shaped right to left: runs and glyphs are returned in visual
+// order, left to right, with mirrored glyphs for brackets.
+func Shape(text string, style Style) []ShapedRun {
+	runs := SegmentText(text, style)
+	if runs == nil {
+		return nil
+	}
+	if style.rtl() {
+		for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+			runs[i], runs[j] = runs[j], runs[i]
+		}
+	}
+	features := fontFeatures(style)
+	shaped := make([]ShapedRun, 0, len(runs))
+	for _, run := range runs {
+		cached, err := cachedFaceFor(run.Face, style.Size)
+		if err != nil {
+			return nil
+		}
+		glyphs, advance := cached.shape(run.Text, style, features)
+		shaped = append(shaped, ShapedRun{
+			Run:     run,
+			Size:    style.Size,
+			Glyphs:  glyphs,
+			Advance: advance,
+			Ascent:  cached.metrics.Ascent,
+			Descent: cached.metrics.Descent,
+		})
+	}
+	return shaped
+}
+
+// fontData maps each font parsed by ParseFont to its sfnt data, from which
+// the shaper parses its own copy. Entries are removed by releaseFont.
+var fontData sync.Map // *opentype.Font -> []byte
+
+// shaper is a HarfBuzz shaper for one font. Neither the shaper nor the face
+// is safe for concurrent use, so shaping holds mu.
+type shaper struct {
+	mu   sync.Mutex
+	face *gotext.Face
+	hb   shaping.HarfbuzzShaper
+	upem int64
+}
+
+// shapers caches the shaper of each font; fonts that cannot be shaped map
+// to a nil shaper.
+var shapers sync.Map // *opentype.Font -> *shaper
+
+// shaperFor returns the shaper of parsed, or nil if its sfnt data is not
+// known or cannot be parsed for shaping.
+func shaperFor(parsed *opentype.Font) *shaper {
+	if s, ok := shapers.Load(parsed); ok {
+		return s.(*shaper)
+	}
+	var s *shaper
+	if data, ok := fontData.Load(parsed); ok {
+		if face, err := gotext.ParseTTF(bytes.NewReader(data.([]byte))); err == nil {
+			s = &shaper{face: face, upem: int64(face.Upem())}
+		}
+	}
+	actual, _ := shapers.LoadOrStore(parsed, s)
+	return actual.(*shaper)
+}
+
+// releaseFont forgets the sfnt data, shaper and cached faces of parsed, a
+// web font no registry uses any more, so that reloading web fonts does
+// not grow memory. Text still being measured with the font falls back to
+// per-character advances.
+func releaseFont(parsed *opentype.Font) {
+	fontData.Delete(parsed)
+	shapers.Delete(parsed)
+	releaseFaces(parsed)
+}
+
+// rtl reports whether style shapes text right to left.
+func (style Style) rtl() bool {
+	return strings.EqualFold(style.Direction, "rtl")
+}
+
+// shape shapes text, which one face covers, at the face's size. Text is
+// split into runs of one script each, as OpenType lookups are selected per
+// script. Fonts without shaping data fall back to per-character advances.
+func (c *cachedFace) shape(text string, style Style, features []shaping.FontFeature) ([]Glyph, fixed.Int26_6) {
+	key := shapeKey{face: c, text: text, features: style.Kerning + "|" + style.Ligatures + "|" + style.FeatureSettings, rtl: style.rtl()}
+	if glyphs, advance, ok := shapeCache.get(key); ok {
+		return glyphs, advance
+	}
+
+	var glyphs []Glyph
+	var advance fixed.Int26_6
+	if s := shaperFor(c.font); s != nil {
+		runes := []rune(text)
+		offsets := make([]int, 0, len(runes))
+		for i := range text {
+			offsets = append(offsets, i)
+		}
+		glyphs = make([]Glyph, 0, len(runes))
+		spans := scriptSpans(runes)
+		direction := di.DirectionLTR
+		if key.rtl {
+			direction = di.DirectionRTL
+			for i, j := 0, len(spans)-1; i < j; i, j = i+1, j-1 {
+				spans[i], spans[j] = spans[j], spans[i]
+			}
+		}
+		for _, span := range spans {
+			shaped := s.shape(runes, span, direction, features)
+			for _, g := range shaped {
+				glyph := Glyph{
+					ID:      sfnt.GlyphIndex(g.GlyphID),
+					Advance: hint(s.scale(g.Advance, c.ppem)),
+					XOffset: s.scale(g.XOffset, c.ppem),
+					YOffset: s.scale(g.YOffset, c.ppem),
+					Cluster: offsets[g.ClusterIndex],
+				}
+				advance += glyph.Advance
+				glyphs = append(glyphs, glyph)
+			}
+		}
+	} else {
+		glyphs, advance = c.simpleGlyphs(text)
+		if key.rtl {
+			slices.Reverse(glyphs)
+		}
+	}
+	shapeCache.put(key, glyphs, advance)
+	return glyphs, advance
+}
+
+// shape shapes runes[span.start:span.end] in font units, keeping the rest
+// of runes as context. Right-to-left glyphs come out in visual order.
+func (s *shaper) shape(runes []rune, span scriptSpan, direction di.Direction, features []shaping.FontFeature) []shaping.Glyph {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Shaping at a size of one em gives positions in font units, which are
+	// then scaled exactly as the rasterizer scales outlines
+	output := s.hb.Shape(shaping.Input{
+		Text:         runes,
+		RunStart:     span.start,
+		RunEnd:       span.end,
+		Direction:    direction,
+		Face:         s.face,
+		FontFeatures: features,
+		Size:         fixed.I(int(s.upem)),
+		Script:       span.script,
+		Language:     language.DefaultLanguage(),
+	})
+	return output.Glyphs
+}
+
+// scale converts a position in font units, as a 26.6 value, to pixels at
+// ppem pixels per em, rounding as sfnt does.
+func (s *shaper) scale(v fixed.Int26_6, ppem fixed.Int26_6) fixed.Int26_6 {
+	x := int64(v) * int64(ppem)
+	d := s.upem * 64
+	if x >= 0 {
+		x += d / 2
+	} else {
+		x -= d / 2
+	}
+	return fixed.Int26_6(x / d)
+}
+
+// scriptSpan is a range of runes in one script.
+type scriptSpan struct {
+	start, end int
+	script     language.Script
+}
+
+// scriptSpans splits runes into spans of one script. Characters common to
+// several scripts, such as spaces and punctuation, and combining marks join
+// the surrounding span.
+// Unicode Standard Annex #24 §5.1 Handling Characters with the Common
+// Script Property
+func scriptSpans(runes []rune) []scriptSpan {
+	spans := make([]scriptSpan, 0, 1)
+	current := scriptSpan{script: language.Common}
+	for i, r := range runes {
+		script := language.LookupScript(r)
+		if script == language.Common || script == language.Inherited || script == current.script {
+			continue
+		}
+		if current.script == language.Common {
+			// Leading common characters take the first real script
+			current.script = script
+			continue
+		}
+		current.end = i
+		spans = append(spans, current)
+		current = scriptSpan{start: i, script: script}
+	}
+	if current.script == language.Common {
+		current.script = language.Latin
+	}
+	current.end = len(runes)
+	return append(spans, current)
+}
+
+// Feature tags set by the font-kerning and font-variant-ligatures
+// properties.
+var (
+	tagKern = ot.MustNewTag("kern")
+	tagLiga = ot.MustNewTag("liga")
+	tagClig = ot.MustNewTag("clig")
+	tagDlig = ot.MustNewTag("dlig")
+	tagHlig = ot.MustNewTag("hlig")
+	tagCalt = ot.MustNewTag("calt")
+)
+
+// ligatureKeywords maps font-variant-ligatures keywords to the features
+// they set.
+// CSS Fonts Level 4 §6.5 Ligatures: the font-variant-ligatures property
+var ligatureKeywords = map[string][]shaping.FontFeature{
+	"common-ligatures":           {{Tag: tagLiga, Value: 1}, {Tag: tagClig, Value: 1}},
+	"no-common-ligatures":        {{Tag: tagLiga, Value: 0}, {Tag: tagClig, Value: 0}},
+	"discretionary-ligatures":    {{Tag: tagDlig, Value: 1}},
+	"no-discretionary-ligatures": {{Tag: tagDlig, Value: 0}},
+	"historical-ligatures":       {{Tag: tagHlig, Value: 1}},
+	"no-historical-ligatures":    {{Tag: tagHlig, Value: 0}},
+	"contextual":                 {{Tag: tagCalt, Value: 1}},
+	"no-contextual":              {{Tag: tagCalt, Value: 0}},
+}
+
+// fontFeatures returns the OpenType features style turns on or off, in
+// order of precedence: later settings of a tag override earlier ones. The
+// shaper's defaults, which include kerning and common and contextual
+// ligatures, apply to features style does not set.
+// CSS Fonts Level 4 §7.2 Feature precedence
+func fontFeatures(style Style) []shaping.FontFeature {
+	features := make([]shaping.FontFeature, 0)
+
+	// §7.2 step 4: font-variant-* and font-kerning
+	switch strings.ToLower(strings.TrimSpace(style.Kerning)) {
+	case "none":
+		features = append(features, shaping.FontFeature{Tag: tagKern, Value: 0})
+	case "normal":
+		features = append(features, shaping.FontFeature{Tag: tagKern, Value: 1})
+	}
+	features = append(features, ligatureFeatures(style.Ligatures)...)
+
+	// §7.2 step 6: font-feature-settings
+	return append(features, featureSettings(style.FeatureSettings)...)
+}
+
+// ligatureFeatures returns the features set by a font-variant-ligatures
+// value. Invalid values set none.
+// CSS Fonts Level 4 §6.5 Ligatures: the font-variant-ligatures property
+func ligatureFeatures(value string) []shaping.FontFeature {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", "normal":
+		return nil
+	case "none":
+		return []shaping.FontFeature{
+			{Tag: tagLiga, Value: 0}, {Tag: tagClig, Value: 0}, {Tag: tagDlig, Value: 0},
+			{Tag: tagHlig, Value: 0}, {Tag: tagCalt, Value: 0},
+		}
+	}
+	features := make([]shaping.FontFeature, 0)
+	for _, keyword := range strings.Fields(value) {
+		set, ok := ligatureKeywords[keyword]
+		if !ok {
+			return nil
+		}
+		features = append(features, set...)
+	}
+	return features
+}
+
+// featureSettings parses a font-feature-settings value: normal, or a comma
+// separated list of quoted four-character tags, each optionally followed by
+// an integer, on or off. Invalid values set no features.
+// CSS Fonts Level 4 §6.12 Low-level font feature settings control
+func featureSettings(value string) []shaping.FontFeature {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "normal") {
+		return nil
+	}
+	features := make([]shaping.FontFeature, 0)
+	for _, setting := range strings.Split(value, ",") {
+		fields := strings.Fields(setting)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil
+		}
+		tag, ok := featureTag(fields[0])
+		if !ok {
+			return nil
+		}
+		// A tag without a value turns the feature on
+		feature := shaping.FontFeature{Tag: tag, Value: 1}
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "on":
+			case "off":
+				feature.Value = 0
+			default:
+				n, err := strconv.ParseUint(fields[1], 10, 32)
+				if err != nil {
+					return nil
+				}
+				feature.Value = uint32(n)
+			}
+		}
+		features = append(features, feature)
+	}
+	return features
+}
+
+// featureTag parses a quoted feature tag of four printable ASCII
+// characters.
+func featureTag(quoted string) (ot.Tag, bool) {
+	if len(quoted) != 6 || (quoted[0] != '"' && quoted[0] != '\'') || quoted[5] != quoted[0] {
+		return 0, false
+	}
+	tag := quoted[1:5]
+	for i := 0; i < len(tag); i++ {
+		if tag[i] < 0x20 || tag[i] > 0x7E {
+			return 0, false
+		}
+	}
+	return ot.NewTag(tag[0], tag[1], tag[2], tag[3]), true
+}
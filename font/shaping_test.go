@@ -0,0 +1,300 @@
+package font
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"reflect"
+	"testing"
+
+	ot "github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// layoutTable builds a GSUB or GPOS table with one feature, enabled for all
+// scripts, whose one lookup has the given type and subtable.
+// OpenType §Common Table Formats: script, feature and lookup lists
+func layoutTable(feature string, lookupType uint16, subtable []byte) []byte {
+	var b bytes.Buffer
+	write := func(v ...uint16) { binary.Write(&b, binary.BigEndian, v) }
+	write(1, 0, 10, 30, 44) // version 1.0, ScriptList, FeatureList, LookupList offsets
+
+	// ScriptList: DFLT script with a default LangSys using feature 0
+	write(1)
+	b.WriteString("DFLT")
+	write(8)
+	write(4, 0)            // Script: defaultLangSysOffset, langSysCount
+	write(0, 0xFFFF, 1, 0) // LangSys: lookupOrder, requiredFeatureIndex, featureIndexCount, featureIndices
+
+	// FeatureList: the feature using lookup 0
+	write(1)
+	b.WriteString(feature)
+	write(8)
+	write(0, 1, 0) // Feature: featureParamsOffset, lookupIndexCount, lookupListIndices
+
+	// LookupList
+	write(1, 4)
+	write(lookupType, 0, 1, 8) // Lookup: type, flag, subTableCount, subtableOffsets
+	b.Write(subtable)
+	return b.Bytes()
+}
+
+// featureFont returns Go Regular with a "kern" feature moving V 200 units
+// closer after A, and a "liga" feature replacing "fi" by the glyph of "x".
+// It also returns the glyph of "x".
+func featureFont(t *testing.T) (*Face, sfnt.GlyphIndex) {
+	t.Helper()
+	original, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf sfnt.Buffer
+	gid := func(r rune) uint16 {
+		index, err := original.GlyphIndex(&buf, r)
+		if err != nil || index == 0 {
+			t.Fatalf("No glyph for %q", r)
+		}
+		return uint16(index)
+	}
+
+	// OpenType §GPOS Lookup type 2, format 1: an XAdvance pair adjustment
+	var pairPos bytes.Buffer
+	binary.Write(&pairPos, binary.BigEndian, []uint16{
+		1, 18, 0x0004, 0, 1, 12, // posFormat, coverageOffset, valueFormat1, valueFormat2, pairSetCount, pairSetOffsets
+		1, gid('V'), 0xFFFF - 199, // PairSet: pairValueCount, secondGlyph, xAdvance -200
+		1, 1, gid('A'), // Coverage format 1
+	})
+
+	// OpenType §GSUB Lookup type 4: a ligature of two components
+	var ligatureSubst bytes.Buffer
+	binary.Write(&ligatureSubst, binary.BigEndian, []uint16{
+		1, 18, 1, 8, // substFormat, coverageOffset, ligatureSetCount, ligatureSetOffsets
+		1, 4, // LigatureSet: ligatureCount, ligatureOffsets
+		gid('x'), 2, gid('i'), // Ligature: ligatureGlyph, componentCount, componentGlyphIDs
+		1, 1, gid('f'), // Coverage format 1
+	})
+
+	tables := []sfntTable{
+		{tag: "GPOS", data: layoutTable("kern", 2, pairPos.Bytes())},
+		{tag: "GSUB", data: layoutTable("liga", 4, ligatureSubst.Bytes())},
+	}
+	numTables := int(binary.BigEndian.Uint16(goregular.TTF[4:]))
+	for i := 0; i < numTables; i++ {
+		tag := string(goregular.TTF[12+16*i : 16+16*i])
+		tables = append(tables, sfntTable{tag: tag, data: findTable(goregular.TTF, tag)})
+	}
+	parsed, err := ParseFont(buildSFNT(binary.BigEndian.Uint32(goregular.TTF), tables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Face{Family: "Features", Font: parsed, WeightMin: 400, WeightMax: 400, Style: "normal", Source: SourceWeb}, sfnt.GlyphIndex(gid('x'))
+}
+
+// shapedGlyphs shapes text and returns its glyphs and advance.
+func shapedGlyphs(t *testing.T, text string, style Style) ([]Glyph, fixed.Int26_6) {
+	t.Helper()
+	runs := Shape(text, style)
+	if len(runs) != 1 {
+		t.Fatalf("Expected one run for %q, got %d", text, len(runs))
+	}
+	return runs[0].Glyphs, runs[0].Advance
+}
+
+// TestShapeFeatures tests that kerning and ligatures are applied by default
+// and follow font-kerning, font-variant-ligatures and font-feature-settings.
+// CSS Fonts Level 4 §7.2 Feature precedence
+func TestShapeFeatures(t *testing.T) {
+	face, ligature := featureFont(t)
+	DefaultRegistry.Add(face)
+	defer DefaultRegistry.Reset()
+	defer ClearFaceCache()
+
+	// 200 units at 2048 units per em and 32px is 3.125px, rounded to 3px
+	base := Style{Family: "Features", Size: 32}
+	_, a := shapedGlyphs(t, "A", base)
+	_, v := shapedGlyphs(t, "V", base)
+	unkerned := a + v
+	kerned := unkerned - fixed.I(3)
+
+	kerningTests := []struct {
+		name     string
+		style    Style
+		expected fixed.Int26_6
+	}{
+		{"kerned by default", base, kerned},
+		{"font-kerning normal", Style{Kerning: "normal"}, kerned},
+		{"font-kerning none", Style{Kerning: "none"}, unkerned},
+		{"kern feature off", Style{FeatureSettings: `"kern" off`}, unkerned},
+		{"feature settings override font-kerning", Style{Kerning: "none", FeatureSettings: `"kern" 1`}, kerned},
+	}
+	for _, tt := range kerningTests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := tt.style
+			style.Family, style.Size = base.Family, base.Size
+			if _, advance := shapedGlyphs(t, "AV", style); advance != tt.expected {
+				t.Errorf("Expected advance %v, got %v", tt.expected, advance)
+			}
+		})
+	}
+
+	ligatureTests := []struct {
+		name      string
+		style     Style
+		ligatured bool
+	}{
+		{"ligatures by default", Style{}, true},
+		{"font-variant-ligatures none", Style{Ligatures: "none"}, false},
+		{"no-common-ligatures", Style{Ligatures: "no-common-ligatures discretionary-ligatures"}, false},
+		{"common-ligatures", Style{Ligatures: "common-ligatures"}, true},
+		{"invalid ligatures value", Style{Ligatures: "no-common-ligatures bogus"}, true},
+		{"liga feature off", Style{FeatureSettings: `"liga" 0`}, false},
+		{"feature settings override ligatures", Style{Ligatures: "none", FeatureSettings: `'liga'`}, true},
+	}
+	for _, tt := range ligatureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := tt.style
+			style.Family, style.Size = base.Family, base.Size
+			glyphs, _ := shapedGlyphs(t, "afi", style)
+			if tt.ligatured {
+				if len(glyphs) != 2 || glyphs[1].ID != ligature || glyphs[1].Cluster != 1 {
+					t.Errorf("Expected a and the fi ligature at byte 1, got %+v", glyphs)
+				}
+			} else if len(glyphs) != 3 {
+				t.Errorf("Expected three glyphs, got %+v", glyphs)
+			}
+		})
+	}
+}
+
+// TestShapeHintedAdvances tests that text without OpenType features is
+// shaped to the advances a hinted face measures.
+func TestShapeHintedAdvances(t *testing.T) {
+	defer ClearFaceCache()
+	text := "The quick brown fox jumps over 1,234 lazy dogs. λ"
+	for _, style := range []Style{
+		{Size: 10},
+		{Size: 13.33},
+		{Size: 16, Weight: "bold"},
+		{Size: 24, Style: "italic"},
+		{Size: 15, Family: "monospace"},
+	} {
+		face, err := Resolve(text, style).NewFace(style.Size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := font.MeasureString(face, text)
+		face.Close()
+		if _, advance := shapedGlyphs(t, text, style); advance != expected {
+			t.Errorf("%+v: expected advance %v, got %v", style, expected, advance)
+		}
+	}
+}
+
+// TestShapedRunDraw tests that drawing shaped glyphs matches font.Drawer.
+func TestShapedRunDraw(t *testing.T) {
+	defer ClearFaceCache()
+	text := "Shaped text, 123"
+	style := Style{Size: 17}
+	runs := Shape(text, style)
+	if len(runs) != 1 {
+		t.Fatalf("Expected one run, got %d", len(runs))
+	}
+
+	face, err := runs[0].Face.NewFace(style.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+	bounds := image.Rect(0, 0, 200, 30)
+	dot := fixed.Point26_6{X: fixed.I(3), Y: fixed.I(20)}
+
+	expected := image.NewRGBA(bounds)
+	drawer := &font.Drawer{Dst: expected, Src: image.Black, Face: face, Dot: dot}
+	drawer.DrawString(text)
+
+	got := image.NewRGBA(bounds)
+	end := runs[0].Draw(got, image.Black, dot)
+	if end != drawer.Dot {
+		t.Errorf("Expected the pen to end at %v, got %v", drawer.Dot, end)
+	}
+	if !bytes.Equal(got.Pix, expected.Pix) {
+		t.Error("Expected shaped glyphs to draw as font.Drawer draws them")
+	}
+}
+
+// TestShapeRTL tests that right-to-left text is shaped into glyphs in
+// visual order, with mirrored brackets.
+// UAX #9 §3.4 L3, L4
+func TestShapeRTL(t *testing.T) {
+	defer ClearFaceCache()
+	ltr := Style{Size: 16}
+	rtl := Style{Size: 16, Direction: "rtl"}
+
+	forward, forwardAdvance := shapedGlyphs(t, "ab(c", ltr)
+	reversed, reversedAdvance := shapedGlyphs(t, "ab(c", rtl)
+	if reversedAdvance != forwardAdvance {
+		t.Errorf("Expected the same advance in both directions, got %v and %v", forwardAdvance, reversedAdvance)
+	}
+	var clusters []int
+	for _, glyph := range reversed {
+		clusters = append(clusters, glyph.Cluster)
+	}
+	if !reflect.DeepEqual(clusters, []int{3, 2, 1, 0}) {
+		t.Errorf("Expected clusters in visual order [3 2 1 0], got %v", clusters)
+	}
+	if reversed[3].ID != forward[0].ID {
+		t.Errorf("Expected the glyph of a last, got %v", reversed[3].ID)
+	}
+
+	closing, _ := shapedGlyphs(t, ")", ltr)
+	if reversed[1].ID != closing[0].ID {
+		t.Errorf("Expected ( to be mirrored to the glyph of ), got %v", reversed[1].ID)
+	}
+}
+
+func TestFeatureSettings(t *testing.T) {
+	feature := func(tag string, value uint32) shaping.FontFeature {
+		return shaping.FontFeature{Tag: ot.MustNewTag(tag), Value: value}
+	}
+	tests := []struct {
+		value    string
+		expected []shaping.FontFeature
+	}{
+		{"normal", nil},
+		{"", nil},
+		{`"liga" 0`, []shaping.FontFeature{feature("liga", 0)}},
+		{`"smcp", 'swsh' 2`, []shaping.FontFeature{feature("smcp", 1), feature("swsh", 2)}},
+		{`"kern" off, "dlig" on`, []shaping.FontFeature{feature("kern", 0), feature("dlig", 1)}},
+		{`liga 0`, nil},
+		{`"toolong"`, nil},
+		{`"liga" -1`, nil},
+		{`"liga" 1 2`, nil},
+	}
+	for _, tt := range tests {
+		if got := featureSettings(tt.value); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("featureSettings(%q): expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestScriptSpans(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []scriptSpan
+	}{
+		{"", []scriptSpan{{0, 0, language.Latin}}},
+		{"123 ...", []scriptSpan{{0, 7, language.Latin}}},
+		{"abc αβγ, def", []scriptSpan{{0, 4, language.Latin}, {4, 9, language.Greek}, {9, 12, language.Latin}}},
+		{"(αβ) ok", []scriptSpan{{0, 5, language.Greek}, {5, 7, language.Latin}}},
+	}
+	for _, tt := range tests {
+		if got := scriptSpans([]rune(tt.text)); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("scriptSpans(%q): expected %v, got %v", tt.text, tt.expected, got)
+		}
+	}
+}
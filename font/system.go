@@ -0,0 +1,148 @@
+package font
+
+// This file indexes installed font files so that font-family names can
+// match fonts outside the document.
+//
+// Spec references:
+// - CSS Fonts Level 4 §5 Font Matching Algorithm: https://www.w3.org/TR/css-fonts-4/#font-matching-algorithm
+// - OpenType §OS/2: https://learn.microsoft.com/en-us/typography/opentype/spec/os2
+// - OpenType §name: https://learn.microsoft.com/en-us/typography/opentype/spec/name
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/lukehoban/browser/log"
+	"golang.org/x/image/font/sfnt"
+)
+
+// DefaultFontDirs returns the directories fonts are conventionally
+// installed in on the current platform.
+func DefaultFontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library/Fonts")}
+	case "windows":
+		return []string{filepath.Join(os.Getenv("WINDIR"), "Fonts")}
+	}
+	return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".fonts"), filepath.Join(home, ".local/share/fonts")}
+}
+
+// fontFileExtensions are the font file types indexed by AddSystemFonts.
+var fontFileExtensions = map[string]bool{
+	".ttf":   true,
+	".otf":   true,
+	".woff":  true,
+	".woff2": true,
+}
+
+// AddSystemFonts scans dirs recursively for font files and adds a face for
+// each to the registry, returning the number of faces added. Only the
+// family name and style descriptors are read now; fonts are parsed when
+// first matched. Missing directories and unreadable files are skipped.
+func (r *Registry) AddSystemFonts(dirs ...string) int {
+	faces := make([]*Face, 0)
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !fontFileExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			face, err := indexFontFile(path)
+			if err != nil {
+				log.Debugf("Skipping font file '%s': %v", path, err)
+				return nil
+			}
+			faces = append(faces, face)
+			return nil
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.system = append(r.system, faces...)
+	return len(faces)
+}
+
+// indexFontFile reads the family name and style descriptors of a font file.
+func indexFontFile(path string) (*Face, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = DecodeWebFont(data)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// OpenType §name: The typographic family (ID 16) groups more than the
+	// four faces the legacy family (ID 1) allows
+	var buf sfnt.Buffer
+	family, err := parsed.Name(&buf, sfnt.NameIDTypographicFamily)
+	if err != nil || family == "" {
+		if family, err = parsed.Name(&buf, sfnt.NameIDFamily); err != nil {
+			return nil, err
+		}
+	}
+
+	face := &Face{
+		Family:    family,
+		WeightMin: 400,
+		WeightMax: 400,
+		Style:     "normal",
+		Source:    SourceSystem,
+		Path:      path,
+	}
+
+	// OpenType §OS/2: usWeightClass, usWidthClass and fsSelection
+	if os2 := findTable(data, "OS/2"); len(os2) >= 64 {
+		if weight := int(binary.BigEndian.Uint16(os2[4:])); weight >= 1 && weight <= 1000 {
+			face.WeightMin, face.WeightMax = weight, weight
+		}
+		if width := int(binary.BigEndian.Uint16(os2[6:])); width >= 1 && width <= 9 {
+			face.StretchMin = widthClassStretch[width-1]
+			face.StretchMax = face.StretchMin
+		}
+		// Bit 0 is ITALIC, bit 9 is OBLIQUE
+		if fsSelection := binary.BigEndian.Uint16(os2[62:]); fsSelection&(1|1<<9) != 0 {
+			face.Style = "italic"
+		}
+	}
+	return face, nil
+}
+
+// widthClassStretch maps OS/2 usWidthClass values 1-9 to font-stretch
+// percentages.
+var widthClassStretch = [9]float64{50, 62.5, 75, 87.5, 100, 112.5, 125, 150, 200}
+
+// findTable returns the named table of sfnt data, or nil.
+func findTable(data []byte, tag string) []byte {
+	if len(data) < 12 {
+		return nil
+	}
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		entry := 12 + 16*i
+		if entry+16 > len(data) {
+			return nil
+		}
+		if string(data[entry:entry+4]) != tag {
+			continue
+		}
+		offset := int(binary.BigEndian.Uint32(data[entry+8:]))
+		length := int(binary.BigEndian.Uint32(data[entry+12:]))
+		if offset < 0 || length < 0 || offset+length > len(data) {
+			return nil
+		}
+		return data[offset : offset+length]
+	}
+	return nil
+}
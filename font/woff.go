@@ -0,0 +1,838 @@
+package font
+
+// This file decodes web font formats into plain sfnt (TrueType/OpenType)
+// data that golang.org/x/image/font/opentype can parse.
+//
+// Spec references:
+// - WOFF File Format 1.0: https://www.w3.org/TR/WOFF/
+// - WOFF File Format 2.0: https://www.w3.org/TR/WOFF2/
+// - OpenType: https://learn.microsoft.com/en-us/typography/opentype/spec/otff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/image/font/opentype"
+)
+
+// maxDecodedFontSize bounds the sfnt data a web font may expand to, so that
+// a malicious file cannot exhaust memory.
+const maxDecodedFontSize = 64 << 20
+
+// ParseFont parses TrueType, OpenType, WOFF or WOFF2 font data. The format
+// is detected from the file signature. The sfnt data is kept for shaping.
+// CSS Fonts Level 4 §4.3: The format() hint is advisory; the data decides
+func ParseFont(data []byte) (*opentype.Font, error) {
+	sfnt, err := DecodeWebFont(data)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := opentype.Parse(sfnt)
+	if err != nil {
+		return nil, err
+	}
+	fontData.Store(parsed, sfnt)
+	return parsed, nil
+}
+
+// DecodeWebFont converts WOFF and WOFF2 data to sfnt data. TrueType and
+// OpenType data is returned unchanged.
+func DecodeWebFont(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, errors.New("font data too short")
+	}
+	switch string(data[:4]) {
+	case "wOFF":
+		return decodeWOFF(data)
+	case "wOF2":
+		return decodeWOFF2(data)
+	case "\x00\x01\x00\x00", "OTTO", "true":
+		return data, nil
+	case "ttcf":
+		return nil, errors.New("font collections are not supported")
+	}
+	return nil, fmt.Errorf("unrecognized font signature %q", data[:4])
+}
+
+// sfntTable is a table of an sfnt font being assembled.
+type sfntTable struct {
+	tag  string
+	data []byte
+}
+
+// buildSFNT assembles an sfnt font from its flavor (0x00010000 or 'OTTO')
+// and tables, computing the table directory and checksums.
+// OpenType §Organization of an OpenType Font
+func buildSFNT(flavor uint32, tables []sfntTable) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].tag < tables[j].tag })
+
+	numTables := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= numTables {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	size := 12 + 16*numTables
+	for _, table := range tables {
+		size += (len(table.data) + 3) &^ 3
+	}
+	out := make([]byte, size)
+	binary.BigEndian.PutUint32(out[0:], flavor)
+	binary.BigEndian.PutUint16(out[4:], uint16(numTables))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(numTables*16-searchRange))
+
+	offset := 12 + 16*numTables
+	headOffset := -1
+	for i, table := range tables {
+		copy(out[offset:], table.data)
+		if table.tag == "head" && len(table.data) >= 12 {
+			// checkSumAdjustment is computed over the whole font below
+			binary.BigEndian.PutUint32(out[offset+8:], 0)
+			headOffset = offset
+		}
+		entry := out[12+16*i:]
+		copy(entry[0:4], table.tag)
+		binary.BigEndian.PutUint32(entry[4:], sfntChecksum(out[offset:offset+len(table.data)]))
+		binary.BigEndian.PutUint32(entry[8:], uint32(offset))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(table.data)))
+		offset += (len(table.data) + 3) &^ 3
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-sfntChecksum(out))
+	}
+	return out
+}
+
+// sfntChecksum sums data as big-endian uint32s, zero-padded to 4 bytes.
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// decodeWOFF decodes a WOFF 1.0 font, whose tables are individually
+// zlib-compressed.
+// WOFF 1.0 §3 Overall file structure, §5 Table directory
+func decodeWOFF(data []byte) ([]byte, error) {
+	const headerSize, entrySize = 44, 20
+	if len(data) < headerSize {
+		return nil, errors.New("woff: header truncated")
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	if len(data) < headerSize+numTables*entrySize {
+		return nil, errors.New("woff: table directory truncated")
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	total := 0
+	for i := 0; i < numTables; i++ {
+		entry := data[headerSize+i*entrySize:]
+		tag := string(entry[0:4])
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		compLength := int(binary.BigEndian.Uint32(entry[8:]))
+		origLength := int(binary.BigEndian.Uint32(entry[12:]))
+		if offset < 0 || compLength < 0 || offset+compLength > len(data) || compLength > origLength {
+			return nil, fmt.Errorf("woff: table %q out of bounds", tag)
+		}
+		total += origLength
+		if total > maxDecodedFontSize {
+			return nil, errors.New("woff: font too large")
+		}
+
+		// WOFF 1.0 §5: A table is stored uncompressed if compression
+		// would not make it smaller
+		compressed := data[offset : offset+compLength]
+		if compLength == origLength {
+			tables = append(tables, sfntTable{tag: tag, data: compressed})
+			continue
+		}
+		r, err := zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("woff: table %q: %w", tag, err)
+		}
+		table := make([]byte, origLength)
+		_, err = io.ReadFull(r, table)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("woff: table %q: %w", tag, err)
+		}
+		tables = append(tables, sfntTable{tag: tag, data: table})
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2KnownTags are the table tags encoded by index in a WOFF2 directory.
+// WOFF 2.0 §5.1 Table directory format, Known Table Tags
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+// woff2Entry is a WOFF2 table directory entry.
+type woff2Entry struct {
+	tag             string
+	transformed     bool
+	origLength      int
+	transformLength int
+}
+
+// decodeWOFF2 decodes a WOFF 2.0 font: a Brotli-compressed stream of all
+// tables, with glyf/loca and optionally hmtx stored in transformed form.
+// WOFF 2.0 §3 Overall file structure
+func decodeWOFF2(data []byte) ([]byte, error) {
+	const headerSize = 48
+	if len(data) < headerSize {
+		return nil, errors.New("woff2: header truncated")
+	}
+	flavor := binary.BigEndian.Uint32(data[4:])
+	if flavor == 0x74746366 { // 'ttcf'
+		return nil, errors.New("woff2: font collections are not supported")
+	}
+	numTables := int(binary.BigEndian.Uint16(data[12:]))
+	totalCompressedSize := int(binary.BigEndian.Uint32(data[20:]))
+
+	// WOFF 2.0 §5.1 Table directory format
+	r := &woff2Reader{data: data, pos: headerSize}
+	entries := make([]woff2Entry, numTables)
+	streamSize := 0
+	for i := range entries {
+		flags, err := r.u8()
+		if err != nil {
+			return nil, err
+		}
+		entry := &entries[i]
+		if index := flags & 0x3f; index == 0x3f {
+			tag, err := r.bytes(4)
+			if err != nil {
+				return nil, err
+			}
+			entry.tag = string(tag)
+		} else {
+			entry.tag = woff2KnownTags[index]
+		}
+
+		// WOFF 2.0 §5.1: Transform version 0 means transformed for glyf
+		// and loca and null for every other table; version 3 is the null
+		// transform for glyf and loca
+		version := flags >> 6
+		if entry.tag == "glyf" || entry.tag == "loca" {
+			entry.transformed = version == 0
+		} else {
+			entry.transformed = version != 0
+		}
+
+		if entry.origLength, err = r.uintBase128(); err != nil {
+			return nil, err
+		}
+		entry.transformLength = entry.origLength
+		if entry.transformed {
+			if entry.transformLength, err = r.uintBase128(); err != nil {
+				return nil, err
+			}
+		}
+		streamSize += entry.transformLength
+		if streamSize > maxDecodedFontSize {
+			return nil, errors.New("woff2: font too large")
+		}
+	}
+
+	if r.pos+totalCompressedSize > len(data) {
+		return nil, errors.New("woff2: compressed data truncated")
+	}
+	stream, err := io.ReadAll(io.LimitReader(brotli.NewReader(bytes.NewReader(data[r.pos:r.pos+totalCompressedSize])), int64(streamSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("woff2: %w", err)
+	}
+	if len(stream) != streamSize {
+		return nil, fmt.Errorf("woff2: decompressed %d bytes, expected %d", len(stream), streamSize)
+	}
+
+	// Split the stream into tables, in directory order
+	raw := make(map[string][]byte, numTables)
+	offset := 0
+	for _, entry := range entries {
+		raw[entry.tag] = stream[offset : offset+entry.transformLength]
+		offset += entry.transformLength
+	}
+
+	tables := make([]sfntTable, 0, numTables)
+	var glyphs *woff2Glyphs
+	for _, entry := range entries {
+		if entry.tag != "glyf" || !entry.transformed {
+			continue
+		}
+		glyphs, err = reconstructGlyf(raw["glyf"])
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, sfntTable{tag: "glyf", data: glyphs.glyf}, sfntTable{tag: "loca", data: glyphs.loca})
+	}
+
+	for _, entry := range entries {
+		switch {
+		case (entry.tag == "glyf" || entry.tag == "loca") && entry.transformed:
+			if glyphs == nil {
+				return nil, errors.New("woff2: transformed loca without glyf")
+			}
+		case entry.tag == "hmtx" && entry.transformed:
+			if glyphs == nil {
+				return nil, errors.New("woff2: transformed hmtx without glyf")
+			}
+			hmtx, err := reconstructHmtx(raw["hmtx"], raw["hhea"], glyphs)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, sfntTable{tag: "hmtx", data: hmtx})
+		case entry.transformed:
+			return nil, fmt.Errorf("woff2: unknown transform of table %q", entry.tag)
+		default:
+			tables = append(tables, sfntTable{tag: entry.tag, data: raw[entry.tag]})
+		}
+	}
+	return buildSFNT(flavor, tables), nil
+}
+
+// woff2Reader reads the primitive types of the WOFF2 format from a buffer.
+type woff2Reader struct {
+	data []byte
+	pos  int
+}
+
+var errWOFF2Truncated = errors.New("woff2: data truncated")
+
+func (r *woff2Reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.pos+n > len(r.data) {
+		return nil, errWOFF2Truncated
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *woff2Reader) u8() (uint8, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *woff2Reader) u16() (uint16, error) {
+	b, err := r.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (r *woff2Reader) u32() (uint32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// uintBase128 reads a variable-length UIntBase128 value.
+// WOFF 2.0 §4.1 UIntBase128 Data Type
+func (r *woff2Reader) uintBase128() (int, error) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		b, err := r.u8()
+		if err != nil {
+			return 0, err
+		}
+		// No leading zeros, and no overflow of 32 bits
+		if (i == 0 && b == 0x80) || value&0xFE000000 != 0 {
+			return 0, errors.New("woff2: invalid UIntBase128")
+		}
+		value = value<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return int(value), nil
+		}
+	}
+	return 0, errors.New("woff2: UIntBase128 too long")
+}
+
+// read255UInt16 reads a variable-length 255UInt16 value.
+// WOFF 2.0 §4.2 255UInt16 Data Type
+func (r *woff2Reader) read255UInt16() (int, error) {
+	const (
+		oneMoreByteCode1 = 255
+		oneMoreByteCode2 = 254
+		wordCode         = 253
+		lowestUCode      = 253
+	)
+	code, err := r.u8()
+	if err != nil {
+		return 0, err
+	}
+	switch code {
+	case wordCode:
+		value, err := r.u16()
+		return int(value), err
+	case oneMoreByteCode1:
+		value, err := r.u8()
+		return int(value) + lowestUCode, err
+	case oneMoreByteCode2:
+		value, err := r.u8()
+		return int(value) + lowestUCode*2, err
+	}
+	return int(code), nil
+}
+
+// woff2Glyphs is the result of reconstructing a transformed glyf table.
+type woff2Glyphs struct {
+	glyf []byte
+	loca []byte
+
+	// xMins holds each glyph's xMin, used to rebuild left side bearings.
+	xMins []int16
+}
+
+// glyfPoint is a decoded point of a simple glyph.
+type glyfPoint struct {
+	x, y    int
+	onCurve bool
+}
+
+// Composite glyph flags.
+// OpenType §glyf: Composite Glyph Description
+const (
+	argsAreWords     = 0x0001
+	weHaveAScale     = 0x0008
+	moreComponents   = 0x0020
+	weHaveXYScale    = 0x0040
+	weHaveTwoByTwo   = 0x0080
+	weHaveInstrs     = 0x0100
+	overlapSimpleBit = 0x40 // OVERLAP_SIMPLE flag of a simple glyph's first point
+)
+
+// reconstructGlyf rebuilds the glyf and loca tables from the transformed
+// glyf table.
+// WOFF 2.0 §5.1 Transformed glyf table format, §5.3 Reconstructing the glyf
+// and loca tables
+func reconstructGlyf(data []byte) (*woff2Glyphs, error) {
+	header := &woff2Reader{data: data}
+	if _, err := header.u16(); err != nil { // reserved
+		return nil, err
+	}
+	optionFlags, _ := header.u16()
+	numGlyphs16, _ := header.u16()
+	indexFormat, err := header.u16()
+	if err != nil {
+		return nil, err
+	}
+	numGlyphs := int(numGlyphs16)
+
+	// Seven substreams follow the header, in this order
+	streams := make([]*woff2Reader, 7)
+	offset := 36
+	for i := range streams {
+		size, err := header.u32()
+		if err != nil {
+			return nil, err
+		}
+		if offset+int(size) > len(data) {
+			return nil, errWOFF2Truncated
+		}
+		streams[i] = &woff2Reader{data: data[offset : offset+int(size)]}
+		offset += int(size)
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := streams[0], streams[1], streams[2], streams[3]
+	compositeStream, bboxStream, instructionStream := streams[4], streams[5], streams[6]
+
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		size := (numGlyphs + 7) / 8
+		if offset+size > len(data) {
+			return nil, errWOFF2Truncated
+		}
+		overlapBitmap = data[offset : offset+size]
+	}
+
+	bboxBitmap, err := bboxStream.bytes(4 * ((numGlyphs + 31) / 32))
+	if err != nil {
+		return nil, err
+	}
+	bitSet := func(bitmap []byte, i int) bool {
+		return bitmap[i>>3]&(0x80>>(i&7)) != 0
+	}
+
+	result := &woff2Glyphs{xMins: make([]int16, numGlyphs)}
+	var glyf bytes.Buffer
+	offsets := make([]int, numGlyphs+1)
+
+	for i := 0; i < numGlyphs; i++ {
+		offsets[i] = glyf.Len()
+		nContours16, err := nContourStream.u16()
+		if err != nil {
+			return nil, err
+		}
+		nContours := int16(nContours16)
+
+		var bbox []byte
+		if bitSet(bboxBitmap, i) {
+			if bbox, err = bboxStream.bytes(8); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case nContours == 0:
+			// Empty glyph
+			if bbox != nil {
+				return nil, errors.New("woff2: empty glyph with bounding box")
+			}
+
+		case nContours < 0:
+			// Composite glyph: components are stored verbatim, and the
+			// bounding box is always explicit
+			if bbox == nil {
+				return nil, errors.New("woff2: composite glyph without bounding box")
+			}
+			components, hasInstructions, err := readCompositeGlyph(compositeStream)
+			if err != nil {
+				return nil, err
+			}
+			glyf.Write([]byte{0xFF, 0xFF})
+			glyf.Write(bbox)
+			glyf.Write(components)
+			if hasInstructions {
+				if err := copyInstructions(&glyf, glyphStream, instructionStream); err != nil {
+					return nil, err
+				}
+			}
+			result.xMins[i] = int16(binary.BigEndian.Uint16(bbox))
+
+		default:
+			overlap := overlapBitmap != nil && bitSet(overlapBitmap, i)
+			xMin, err := writeSimpleGlyph(&glyf, int(nContours), bbox, overlap, nPointsStream, flagStream, glyphStream, instructionStream)
+			if err != nil {
+				return nil, err
+			}
+			result.xMins[i] = xMin
+		}
+
+		// Pad each glyph to a 4-byte boundary, valid for either loca format
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+		if glyf.Len() > maxDecodedFontSize {
+			return nil, errors.New("woff2: glyf table too large")
+		}
+	}
+	offsets[numGlyphs] = glyf.Len()
+	result.glyf = glyf.Bytes()
+
+	// OpenType §loca: Short offsets are stored divided by two
+	if indexFormat == 0 {
+		if glyf.Len()/2 > 0xFFFF {
+			return nil, errors.New("woff2: glyf too large for short loca")
+		}
+		result.loca = make([]byte, 2*(numGlyphs+1))
+		for i, o := range offsets {
+			binary.BigEndian.PutUint16(result.loca[2*i:], uint16(o/2))
+		}
+	} else {
+		result.loca = make([]byte, 4*(numGlyphs+1))
+		for i, o := range offsets {
+			binary.BigEndian.PutUint32(result.loca[4*i:], uint32(o))
+		}
+	}
+	return result, nil
+}
+
+// readCompositeGlyph reads one composite glyph's component records.
+// OpenType §glyf: Composite Glyph Description
+func readCompositeGlyph(stream *woff2Reader) ([]byte, bool, error) {
+	start := stream.pos
+	hasInstructions := false
+	for {
+		flags, err := stream.u16()
+		if err != nil {
+			return nil, false, err
+		}
+		size := 2 // glyphIndex
+		if flags&argsAreWords != 0 {
+			size += 4
+		} else {
+			size += 2
+		}
+		switch {
+		case flags&weHaveAScale != 0:
+			size += 2
+		case flags&weHaveXYScale != 0:
+			size += 4
+		case flags&weHaveTwoByTwo != 0:
+			size += 8
+		}
+		if _, err := stream.bytes(size); err != nil {
+			return nil, false, err
+		}
+		if flags&weHaveInstrs != 0 {
+			hasInstructions = true
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return stream.data[start:stream.pos], hasInstructions, nil
+}
+
+// copyInstructions reads an instruction length from the glyph stream and
+// writes it and the instructions to glyf.
+func copyInstructions(glyf *bytes.Buffer, glyphStream, instructionStream *woff2Reader) error {
+	length, err := glyphStream.read255UInt16()
+	if err != nil {
+		return err
+	}
+	instructions, err := instructionStream.bytes(length)
+	if err != nil {
+		return err
+	}
+	binary.Write(glyf, binary.BigEndian, uint16(length))
+	glyf.Write(instructions)
+	return nil
+}
+
+// writeSimpleGlyph decodes a simple glyph from the WOFF2 streams and writes
+// it in glyf format. It returns the glyph's xMin.
+// WOFF 2.0 §5.2 Decoding of variable-length X and Y coordinates
+func writeSimpleGlyph(glyf *bytes.Buffer, nContours int, bbox []byte, overlap bool, nPointsStream, flagStream, glyphStream, instructionStream *woff2Reader) (int16, error) {
+	endPoints := make([]int, nContours)
+	totalPoints := 0
+	for c := 0; c < nContours; c++ {
+		n, err := nPointsStream.read255UInt16()
+		if err != nil {
+			return 0, err
+		}
+		totalPoints += n
+		endPoints[c] = totalPoints - 1
+	}
+	if totalPoints > 0xFFFF {
+		return 0, errors.New("woff2: too many points")
+	}
+
+	flags, err := flagStream.bytes(totalPoints)
+	if err != nil {
+		return 0, err
+	}
+	points := make([]glyfPoint, totalPoints)
+	x, y := 0, 0
+	for i, flag := range flags {
+		onCurve := flag&0x80 == 0
+		flag &= 0x7f
+		dataSize := 4
+		switch {
+		case flag < 84:
+			dataSize = 1
+		case flag < 120:
+			dataSize = 2
+		case flag < 124:
+			dataSize = 3
+		}
+		b, err := glyphStream.bytes(dataSize)
+		if err != nil {
+			return 0, err
+		}
+		dx, dy := decodeTriplet(flag, b)
+		x += dx
+		y += dy
+		points[i] = glyfPoint{x: x, y: y, onCurve: onCurve}
+	}
+
+	// The bounding box is computed from the points unless given explicitly
+	if bbox == nil {
+		bbox = make([]byte, 8)
+		if len(points) > 0 {
+			xMin, yMin, xMax, yMax := points[0].x, points[0].y, points[0].x, points[0].y
+			for _, p := range points[1:] {
+				xMin, xMax = min(xMin, p.x), max(xMax, p.x)
+				yMin, yMax = min(yMin, p.y), max(yMax, p.y)
+			}
+			binary.BigEndian.PutUint16(bbox[0:], uint16(int16(xMin)))
+			binary.BigEndian.PutUint16(bbox[2:], uint16(int16(yMin)))
+			binary.BigEndian.PutUint16(bbox[4:], uint16(int16(xMax)))
+			binary.BigEndian.PutUint16(bbox[6:], uint16(int16(yMax)))
+		}
+	}
+
+	binary.Write(glyf, binary.BigEndian, int16(nContours))
+	glyf.Write(bbox)
+	for _, end := range endPoints {
+		binary.Write(glyf, binary.BigEndian, uint16(end))
+	}
+	if err := copyInstructions(glyf, glyphStream, instructionStream); err != nil {
+		return 0, err
+	}
+	writeGlyfPoints(glyf, points, overlap)
+	return int16(binary.BigEndian.Uint16(bbox)), nil
+}
+
+// decodeTriplet decodes a point delta from its flag and data bytes.
+// WOFF 2.0 §5.2, Table 2: Triplet encodings
+func decodeTriplet(flag byte, b []byte) (dx, dy int) {
+	withSign := func(flag byte, value int) int {
+		if flag&1 != 0 {
+			return value
+		}
+		return -value
+	}
+	f := int(flag)
+	switch {
+	case f < 10:
+		return 0, withSign(flag, (f&14)<<7+int(b[0]))
+	case f < 20:
+		return withSign(flag, ((f-10)&14)<<7+int(b[0])), 0
+	case f < 84:
+		b0, b1 := f-20, int(b[0])
+		return withSign(flag, 1+(b0&0x30)+(b1>>4)), withSign(flag>>1, 1+(b0&0x0c)<<2+(b1&0x0f))
+	case f < 120:
+		b0 := f - 84
+		return withSign(flag, 1+(b0/12)<<8+int(b[0])), withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case f < 124:
+		b2 := int(b[1])
+		return withSign(flag, int(b[0])<<4+b2>>4), withSign(flag>>1, (b2&0x0f)<<8+int(b[2]))
+	}
+	return withSign(flag, int(b[0])<<8+int(b[1])), withSign(flag>>1, int(b[2])<<8+int(b[3]))
+}
+
+// writeGlyfPoints writes the flags and coordinates of a simple glyph,
+// using the short one-byte forms where the deltas allow.
+// OpenType §glyf: Simple Glyph Description
+func writeGlyfPoints(glyf *bytes.Buffer, points []glyfPoint, overlap bool) {
+	const (
+		onCurvePoint = 0x01
+		xShortVector = 0x02
+		yShortVector = 0x04
+		xIsSameOrPos = 0x10
+		yIsSameOrPos = 0x20
+	)
+
+	flags := make([]byte, len(points))
+	var xs, ys bytes.Buffer
+	prevX, prevY := 0, 0
+	for i, p := range points {
+		var flag byte
+		if p.onCurve {
+			flag |= onCurvePoint
+		}
+		if i == 0 && overlap {
+			flag |= overlapSimpleBit
+		}
+
+		dx := p.x - prevX
+		switch {
+		case dx == 0:
+			flag |= xIsSameOrPos
+		case dx > -256 && dx < 256:
+			flag |= xShortVector
+			if dx > 0 {
+				flag |= xIsSameOrPos
+			} else {
+				dx = -dx
+			}
+			xs.WriteByte(byte(dx))
+		default:
+			binary.Write(&xs, binary.BigEndian, int16(dx))
+		}
+
+		dy := p.y - prevY
+		switch {
+		case dy == 0:
+			flag |= yIsSameOrPos
+		case dy > -256 && dy < 256:
+			flag |= yShortVector
+			if dy > 0 {
+				flag |= yIsSameOrPos
+			} else {
+				dy = -dy
+			}
+			ys.WriteByte(byte(dy))
+		default:
+			binary.Write(&ys, binary.BigEndian, int16(dy))
+		}
+
+		flags[i] = flag
+		prevX, prevY = p.x, p.y
+	}
+	glyf.Write(flags)
+	glyf.Write(xs.Bytes())
+	glyf.Write(ys.Bytes())
+}
+
+// reconstructHmtx rebuilds an hmtx table stored with transform version 1,
+// in which left side bearings equal to the glyph's xMin may be omitted.
+// WOFF 2.0 §5.4 Transformed hmtx table format
+func reconstructHmtx(data, hhea []byte, glyphs *woff2Glyphs) ([]byte, error) {
+	if len(hhea) < 36 {
+		return nil, errors.New("woff2: hhea table missing or truncated")
+	}
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	numGlyphs := len(glyphs.xMins)
+	if numHMetrics < 1 || numHMetrics > numGlyphs {
+		return nil, errors.New("woff2: invalid numberOfHMetrics")
+	}
+
+	r := &woff2Reader{data: data}
+	flags, err := r.u8()
+	if err != nil {
+		return nil, err
+	}
+	advances, err := r.bytes(2 * numHMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	lsbs := make([]int16, numGlyphs)
+	copy(lsbs, glyphs.xMins)
+	if flags&1 == 0 {
+		for i := 0; i < numHMetrics; i++ {
+			v, err := r.u16()
+			if err != nil {
+				return nil, err
+			}
+			lsbs[i] = int16(v)
+		}
+	}
+	if flags&2 == 0 {
+		for i := numHMetrics; i < numGlyphs; i++ {
+			v, err := r.u16()
+			if err != nil {
+				return nil, err
+			}
+			lsbs[i] = int16(v)
+		}
+	}
+
+	hmtx := make([]byte, 0, 4*numHMetrics+2*(numGlyphs-numHMetrics))
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics {
+			hmtx = append(hmtx, advances[2*i], advances[2*i+1])
+		}
+		hmtx = binary.BigEndian.AppendUint16(hmtx, uint16(lsbs[i]))
+	}
+	return hmtx, nil
+}
@@ -0,0 +1,509 @@
+package font
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// sfntTables returns the tables of sfnt data by tag, in directory order.
+func sfntTables(t *testing.T, data []byte) ([]string, map[string][]byte) {
+	t.Helper()
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	tags := make([]string, 0, numTables)
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		entry := data[12+16*i:]
+		tag := string(entry[0:4])
+		offset := binary.BigEndian.Uint32(entry[8:])
+		length := binary.BigEndian.Uint32(entry[12:])
+		tags = append(tags, tag)
+		tables[tag] = data[offset : offset+length]
+	}
+	return tags, tables
+}
+
+// encodeWOFF encodes sfnt data as WOFF 1.0, compressing every table that
+// gets smaller.
+func encodeWOFF(t *testing.T, data []byte) []byte {
+	t.Helper()
+	tags, tables := sfntTables(t, data)
+
+	var body bytes.Buffer
+	directory := make([]byte, 20*len(tags))
+	offset := 44 + len(directory)
+	for i, tag := range tags {
+		table := tables[tag]
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(table)
+		w.Close()
+		stored := compressed.Bytes()
+		if len(stored) >= len(table) {
+			stored = table
+		}
+
+		entry := directory[20*i:]
+		copy(entry, tag)
+		binary.BigEndian.PutUint32(entry[4:], uint32(offset+body.Len()))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(stored)))
+		binary.BigEndian.PutUint32(entry[12:], uint32(len(table)))
+		binary.BigEndian.PutUint32(entry[16:], sfntChecksum(table))
+		body.Write(stored)
+		for body.Len()%4 != 0 {
+			body.WriteByte(0)
+		}
+	}
+
+	header := make([]byte, 44)
+	copy(header, "wOFF")
+	copy(header[4:], data[0:4])
+	binary.BigEndian.PutUint32(header[8:], uint32(44+len(directory)+body.Len()))
+	binary.BigEndian.PutUint16(header[12:], uint16(len(tags)))
+	binary.BigEndian.PutUint32(header[16:], uint32(len(data)))
+	return append(append(header, directory...), body.Bytes()...)
+}
+
+// encodeWOFF2 encodes TrueType data as WOFF 2.0 with the glyf/loca and hmtx
+// transforms, following the reference encoder.
+func encodeWOFF2(t *testing.T, data []byte) []byte {
+	t.Helper()
+	tags, tables := sfntTables(t, data)
+
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:]))
+	indexFormat := binary.BigEndian.Uint16(tables["head"][50:])
+	glyf, xMins := transformGlyf(t, tables["glyf"], tables["loca"], numGlyphs, indexFormat)
+	hmtx := transformHmtx(tables["hmtx"], tables["hhea"], xMins)
+
+	// glyf must be immediately followed by loca
+	ordered := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "loca" {
+			continue
+		}
+		ordered = append(ordered, tag)
+		if tag == "glyf" {
+			ordered = append(ordered, "loca")
+		}
+	}
+
+	var directory, stream bytes.Buffer
+	for _, tag := range ordered {
+		index := 0x3f
+		for i, known := range woff2KnownTags {
+			if known == tag {
+				index = i
+			}
+		}
+		// Transform version 0 transforms glyf and loca; version 1
+		// transforms hmtx
+		var transformed []byte
+		flags := byte(index)
+		switch tag {
+		case "glyf":
+			transformed = glyf
+		case "loca":
+			transformed = []byte{}
+		case "hmtx":
+			transformed = hmtx
+			flags |= 1 << 6
+		}
+		directory.WriteByte(flags)
+		if index == 0x3f {
+			directory.WriteString(tag)
+		}
+		writeUIntBase128(&directory, len(tables[tag]))
+		if transformed != nil {
+			writeUIntBase128(&directory, len(transformed))
+			stream.Write(transformed)
+		} else {
+			stream.Write(tables[tag])
+		}
+	}
+
+	var compressed bytes.Buffer
+	w := brotli.NewWriterLevel(&compressed, brotli.BestCompression)
+	w.Write(stream.Bytes())
+	w.Close()
+
+	header := make([]byte, 48)
+	copy(header, "wOF2")
+	copy(header[4:], data[0:4])
+	binary.BigEndian.PutUint32(header[8:], uint32(48+directory.Len()+compressed.Len()))
+	binary.BigEndian.PutUint16(header[12:], uint16(len(tags)))
+	binary.BigEndian.PutUint32(header[16:], uint32(len(data)))
+	binary.BigEndian.PutUint32(header[20:], uint32(compressed.Len()))
+	return append(append(header, directory.Bytes()...), compressed.Bytes()...)
+}
+
+func writeUIntBase128(w *bytes.Buffer, value int) {
+	groups := []byte{byte(value & 0x7f)}
+	for value >>= 7; value > 0; value >>= 7 {
+		groups = append([]byte{byte(value&0x7f) | 0x80}, groups...)
+	}
+	w.Write(groups)
+}
+
+func write255UInt16(w *bytes.Buffer, value int) {
+	switch {
+	case value < 253:
+		w.WriteByte(byte(value))
+	case value < 506:
+		w.Write([]byte{255, byte(value - 253)})
+	case value < 762:
+		w.Write([]byte{254, byte(value - 506)})
+	default:
+		w.WriteByte(253)
+		binary.Write(w, binary.BigEndian, uint16(value))
+	}
+}
+
+// writeTriplet encodes a point delta.
+// WOFF 2.0 §5.2, Table 2: Triplet encodings
+func writeTriplet(flags, glyphs *bytes.Buffer, onCurve bool, dx, dy int) {
+	abs := func(v int) int {
+		if v < 0 {
+			return -v
+		}
+		return v
+	}
+	ax, ay := abs(dx), abs(dy)
+	flag := 0
+	if !onCurve {
+		flag = 128
+	}
+	xSign, ySign := 0, 0
+	if dx >= 0 {
+		xSign = 1
+	}
+	if dy >= 0 {
+		ySign = 2
+	}
+	switch {
+	case dx == 0 && ay < 1280:
+		flags.WriteByte(byte(flag + (ay&0xf00)>>7 + ySign>>1))
+		glyphs.WriteByte(byte(ay))
+	case dy == 0 && ax < 1280:
+		flags.WriteByte(byte(flag + 10 + (ax&0xf00)>>7 + xSign))
+		glyphs.WriteByte(byte(ax))
+	case ax < 65 && ay < 65:
+		flags.WriteByte(byte(flag + 20 + (ax-1)&0x30 + ((ay-1)&0x30)>>2 + xSign + ySign))
+		glyphs.WriteByte(byte((ax-1)&0xf<<4 | (ay-1)&0xf))
+	case ax < 769 && ay < 769:
+		flags.WriteByte(byte(flag + 84 + 12*((ax-1)>>8) + ((ay-1)>>8)<<2 + xSign + ySign))
+		glyphs.Write([]byte{byte(ax - 1), byte(ay - 1)})
+	case ax < 4096 && ay < 4096:
+		flags.WriteByte(byte(flag + 120 + xSign + ySign))
+		glyphs.Write([]byte{byte(ax >> 4), byte(ax&0xf<<4 | ay>>8), byte(ay)})
+	default:
+		flags.WriteByte(byte(flag + 124 + xSign + ySign))
+		glyphs.Write([]byte{byte(ax >> 8), byte(ax), byte(ay >> 8), byte(ay)})
+	}
+}
+
+// transformGlyf produces a transformed glyf table and each glyph's xMin.
+// WOFF 2.0 §5.1 Transformed glyf table format
+func transformGlyf(t *testing.T, glyf, loca []byte, numGlyphs int, indexFormat uint16) ([]byte, []int16) {
+	t.Helper()
+	offset := func(i int) int {
+		if indexFormat == 0 {
+			return 2 * int(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+		return int(binary.BigEndian.Uint32(loca[4*i:]))
+	}
+
+	var nContours, nPoints, flagStream, glyphStream, composite, bboxData, instructions bytes.Buffer
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)/32))
+	xMins := make([]int16, numGlyphs)
+	for i := 0; i < numGlyphs; i++ {
+		g := glyf[offset(i):offset(i+1)]
+		if len(g) == 0 {
+			nContours.Write([]byte{0, 0})
+			continue
+		}
+		n := int(int16(binary.BigEndian.Uint16(g)))
+		nContours.Write(g[0:2])
+		xMins[i] = int16(binary.BigEndian.Uint16(g[2:]))
+		bbox := g[2:10]
+
+		if n < 0 {
+			bboxBitmap[i>>3] |= 0x80 >> (i & 7)
+			bboxData.Write(bbox)
+			r := &woff2Reader{data: g, pos: 10}
+			components, hasInstructions, err := readCompositeGlyph(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			composite.Write(components)
+			if hasInstructions {
+				length, _ := r.u16()
+				write255UInt16(&glyphStream, int(length))
+				b, _ := r.bytes(int(length))
+				instructions.Write(b)
+			}
+			continue
+		}
+
+		r := &woff2Reader{data: g, pos: 10}
+		last := -1
+		for c := 0; c < n; c++ {
+			end, _ := r.u16()
+			write255UInt16(&nPoints, int(end)-last)
+			last = int(end)
+		}
+		total := last + 1
+		length, _ := r.u16()
+		instr, _ := r.bytes(int(length))
+
+		// Expand the repeated flags, then read the coordinates
+		pointFlags := make([]byte, 0, total)
+		for len(pointFlags) < total {
+			f, _ := r.u8()
+			pointFlags = append(pointFlags, f)
+			if f&0x08 != 0 {
+				repeat, _ := r.u8()
+				for k := 0; k < int(repeat); k++ {
+					pointFlags = append(pointFlags, f)
+				}
+			}
+		}
+		readCoords := func(short, same byte) []int {
+			deltas := make([]int, total)
+			for k, f := range pointFlags {
+				switch {
+				case f&short != 0:
+					v, _ := r.u8()
+					deltas[k] = int(v)
+					if f&same == 0 {
+						deltas[k] = -deltas[k]
+					}
+				case f&same == 0:
+					v, _ := r.u16()
+					deltas[k] = int(int16(v))
+				}
+			}
+			return deltas
+		}
+		dxs := readCoords(0x02, 0x10)
+		dys := readCoords(0x04, 0x20)
+
+		xMin, yMin, xMax, yMax := 0, 0, 0, 0
+		x, y := 0, 0
+		for k := range pointFlags {
+			writeTriplet(&flagStream, &glyphStream, pointFlags[k]&1 != 0, dxs[k], dys[k])
+			x += dxs[k]
+			y += dys[k]
+			if k == 0 {
+				xMin, yMin, xMax, yMax = x, y, x, y
+			}
+			xMin, xMax = min(xMin, x), max(xMax, x)
+			yMin, yMax = min(yMin, y), max(yMax, y)
+		}
+		write255UInt16(&glyphStream, int(length))
+		instructions.Write(instr)
+
+		// The bounding box is stored only when it differs from the points
+		computed := make([]byte, 8)
+		binary.BigEndian.PutUint16(computed[0:], uint16(int16(xMin)))
+		binary.BigEndian.PutUint16(computed[2:], uint16(int16(yMin)))
+		binary.BigEndian.PutUint16(computed[4:], uint16(int16(xMax)))
+		binary.BigEndian.PutUint16(computed[6:], uint16(int16(yMax)))
+		if !bytes.Equal(computed, bbox) {
+			bboxBitmap[i>>3] |= 0x80 >> (i & 7)
+			bboxData.Write(bbox)
+		}
+	}
+
+	bboxStream := append(bboxBitmap, bboxData.Bytes()...)
+	streams := [][]byte{nContours.Bytes(), nPoints.Bytes(), flagStream.Bytes(), glyphStream.Bytes(), composite.Bytes(), bboxStream, instructions.Bytes()}
+	var out bytes.Buffer
+	binary.Write(&out, binary.BigEndian, []uint16{0, 0, uint16(numGlyphs), indexFormat})
+	for _, s := range streams {
+		binary.Write(&out, binary.BigEndian, uint32(len(s)))
+	}
+	for _, s := range streams {
+		out.Write(s)
+	}
+	return out.Bytes(), xMins
+}
+
+// transformHmtx produces a transformed hmtx table, omitting the left side
+// bearings when they all equal the glyphs' xMin.
+// WOFF 2.0 §5.4 Transformed hmtx table format
+func transformHmtx(hmtx, hhea []byte, xMins []int16) []byte {
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	lsb := func(i int) int16 {
+		if i < numHMetrics {
+			return int16(binary.BigEndian.Uint16(hmtx[4*i+2:]))
+		}
+		return int16(binary.BigEndian.Uint16(hmtx[4*numHMetrics+2*(i-numHMetrics):]))
+	}
+	flags := byte(3)
+	for i := range xMins {
+		if lsb(i) != xMins[i] {
+			flags = 0
+		}
+	}
+
+	out := []byte{flags}
+	for i := 0; i < numHMetrics; i++ {
+		out = append(out, hmtx[4*i], hmtx[4*i+1])
+	}
+	if flags == 0 {
+		for i := range xMins {
+			out = binary.BigEndian.AppendUint16(out, uint16(lsb(i)))
+		}
+	}
+	return out
+}
+
+// assertSameGlyphs checks that two fonts have identical outlines and
+// advances for every glyph.
+func assertSameGlyphs(t *testing.T, want, got *opentype.Font) {
+	t.Helper()
+	if want.NumGlyphs() != got.NumGlyphs() {
+		t.Fatalf("Expected %d glyphs, got %d", want.NumGlyphs(), got.NumGlyphs())
+	}
+	var wantBuf, gotBuf sfnt.Buffer
+	ppem := fixed.I(1000)
+	for i := 0; i < want.NumGlyphs(); i++ {
+		gi := sfnt.GlyphIndex(i)
+		wantSegments, err := want.LoadGlyph(&wantBuf, gi, ppem, nil)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		gotSegments, err := got.LoadGlyph(&gotBuf, gi, ppem, nil)
+		if err != nil {
+			t.Fatalf("glyph %d: %v", i, err)
+		}
+		if len(wantSegments) != len(gotSegments) {
+			t.Fatalf("glyph %d: expected %d segments, got %d", i, len(wantSegments), len(gotSegments))
+		}
+		for j := range wantSegments {
+			if wantSegments[j] != gotSegments[j] {
+				t.Fatalf("glyph %d segment %d: expected %v, got %v", i, j, wantSegments[j], gotSegments[j])
+			}
+		}
+		wantAdvance, _ := want.GlyphAdvance(&wantBuf, gi, ppem, 0)
+		gotAdvance, _ := got.GlyphAdvance(&gotBuf, gi, ppem, 0)
+		if wantAdvance != gotAdvance {
+			t.Fatalf("glyph %d: expected advance %v, got %v", i, wantAdvance, gotAdvance)
+		}
+	}
+}
+
+// TestParseFontWOFF tests that WOFF 1.0 tables decompress to the original
+// tables.
+// WOFF 1.0 §5 Table directory
+func TestParseFontWOFF(t *testing.T) {
+	woff := encodeWOFF(t, goregular.TTF)
+	if len(woff) >= len(goregular.TTF) {
+		t.Errorf("Expected compressed WOFF, got %d bytes from %d", len(woff), len(goregular.TTF))
+	}
+
+	decoded, err := DecodeWebFont(woff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want := sfntTables(t, goregular.TTF)
+	_, got := sfntTables(t, decoded)
+	for tag, table := range want {
+		if tag == "head" {
+			// checkSumAdjustment is recomputed
+			continue
+		}
+		if !bytes.Equal(table, got[tag]) {
+			t.Errorf("Table %q differs after decoding", tag)
+		}
+	}
+
+	original, _ := opentype.Parse(goregular.TTF)
+	parsed, err := ParseFont(woff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameGlyphs(t, original, parsed)
+}
+
+// TestParseFontWOFF2 tests that WOFF 2.0 fonts with transformed glyf, loca
+// and hmtx tables decode to the original outlines and metrics.
+// WOFF 2.0 §5 Compressed data format
+func TestParseFontWOFF2(t *testing.T) {
+	woff2 := encodeWOFF2(t, goregular.TTF)
+	if len(woff2) >= len(goregular.TTF)/2 {
+		t.Errorf("Expected compressed WOFF2, got %d bytes from %d", len(woff2), len(goregular.TTF))
+	}
+
+	parsed, err := ParseFont(woff2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _ := opentype.Parse(goregular.TTF)
+	assertSameGlyphs(t, original, parsed)
+
+	decoded, _ := DecodeWebFont(woff2)
+	_, want := sfntTables(t, goregular.TTF)
+	_, got := sfntTables(t, decoded)
+	for _, tag := range []string{"cmap", "hhea", "hmtx", "maxp", "name", "post"} {
+		if !bytes.Equal(want[tag], got[tag]) {
+			t.Errorf("Table %q differs after decoding", tag)
+		}
+	}
+}
+
+// TestParseFontErrors tests that unsupported and corrupt data is rejected.
+func TestParseFontErrors(t *testing.T) {
+	woff2 := encodeWOFF2(t, goregular.TTF)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"unknown signature", []byte("GIF89a")},
+		{"collection", []byte("ttcf\x00\x01\x00\x00")},
+		{"truncated woff", encodeWOFF(t, goregular.TTF)[:30]},
+		{"truncated woff2", woff2[:len(woff2)/2]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseFont(tt.data); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestUIntBase128 tests the variable-length integer encodings of WOFF2.
+// WOFF 2.0 §4.1 UIntBase128, §4.2 255UInt16
+func TestUIntBase128(t *testing.T) {
+	for _, value := range []int{0, 1, 127, 128, 16383, 16384, 1 << 28} {
+		var buf bytes.Buffer
+		writeUIntBase128(&buf, value)
+		r := &woff2Reader{data: buf.Bytes()}
+		if got, err := r.uintBase128(); err != nil || got != value {
+			t.Errorf("uintBase128(%d) = %d, %v", value, got, err)
+		}
+	}
+	for _, value := range []int{0, 252, 253, 505, 506, 761, 762, 65535} {
+		var buf bytes.Buffer
+		write255UInt16(&buf, value)
+		r := &woff2Reader{data: buf.Bytes()}
+		if got, err := r.read255UInt16(); err != nil || got != value {
+			t.Errorf("read255UInt16(%d) = %d, %v", value, got, err)
+		}
+	}
+
+	// Leading zeros are invalid
+	r := &woff2Reader{data: []byte{0x80, 0x01}}
+	if _, err := r.uintBase128(); err == nil {
+		t.Error("Expected an error for a leading zero")
+	}
+}
@@ -2,6 +2,9 @@ module github.com/lukehoban/browser
 
 go 1.24.11
 
-require golang.org/x/image v0.34.0
-
-require golang.org/x/text v0.32.0 // indirect
+require (
+	github.com/andybalholm/brotli v1.2.0
+	github.com/go-text/typesetting v0.3.4
+	golang.org/x/image v0.34.0
+	golang.org/x/text v0.32.0
+)
@@ -0,0 +1,350 @@
+package layout
+
+// This file applies the Unicode Bidirectional Algorithm to inline content.
+// Each run of inline-level children of a block container is one paragraph,
+// and, as lines are not broken, one line. Text boxes holding text of
+// several embedding levels are split into fragments of one level each;
+// layout places the boxes of a line in visual order and the renderer
+// shapes right-to-left fragments right to left.
+//
+// Spec references:
+// - CSS Writing Modes Level 3 §2 Inline Direction and Bidirectionality: https://www.w3.org/TR/css-writing-modes-3/#text-direction
+// - CSS Text Level 3 §6.1 Text Alignment: https://www.w3.org/TR/css-text-3/#text-align-property
+// - UAX #9 Unicode Bidirectional Algorithm (package bidi)
+//
+// Limitations:
+// - Inline boxes are not split: when an inline box's content spans several
+//   levels, its fragments are reordered within the box, which stays whole
+// - Padding, borders and margins of inline boxes are not swapped in
+//   right-to-left text, and block boxes are not placed from the right
+
+import (
+	"github.com/lukehoban/browser/bidi"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/style"
+)
+
+// objectReplacement stands in the paragraph text for boxes that are not
+// text, such as inline blocks and markers. It is a neutral character.
+// UAX #9 §3.1.1 Unicode Bidirectional Character Types
+const objectReplacement = '\uFFFC'
+
+// resolveBidi resolves the embedding levels of the inline content of box
+// and its descendants, splitting text boxes where the level changes.
+func (box *LayoutBox) resolveBidi() {
+	box.resolveBidiWith(&paragraph{})
+}
+
+// resolveBidiWith resolves levels as resolveBidi does, reusing p for each
+// paragraph.
+func (box *LayoutBox) resolveBidiWith(p *paragraph) {
+	if !box.isInlineLevel() {
+		// The runs of inline-level children that layoutBlockChildren lays
+		// out as lines
+		var split map[*LayoutBox][]*LayoutBox
+		for i := 0; i < len(box.Children); {
+			start := i
+			for i < len(box.Children) && box.Children[i].isInlineLevel() && !box.Children[i].isOutsideMarker() {
+				i++
+			}
+			if i == start {
+				i++
+				continue
+			}
+			p.reset()
+			split = box.resolveParagraph(p, box.Children[start:i], split)
+		}
+		box.Children = expandFragments(box.Children, split)
+	}
+	for _, child := range box.Children {
+		child.resolveBidiWith(p)
+	}
+}
+
+// paragraph is the text of a run of inline boxes, with the range each box
+// covers.
+type paragraph struct {
+	text    []rune
+	items   []paragraphItem
+	control bool // whether any inline box adds formatting characters
+}
+
+// paragraphItem is the range of the paragraph text one box covers, not
+// counting the formatting characters around an inline box's content.
+type paragraphItem struct {
+	box        *LayoutBox
+	start, end int
+}
+
+// resolveParagraph resolves the levels of one run of inline boxes. Text
+// boxes to split are added to split, keyed by the original box, which is
+// allocated if needed and returned.
+// CSS Writing Modes Level 3 §2.4 Box model for bidirectional content
+func (box *LayoutBox) resolveParagraph(p *paragraph, run []*LayoutBox, split map[*LayoutBox][]*LayoutBox) map[*LayoutBox][]*LayoutBox {
+	cs := box.StyledNode.Style()
+
+	// §2.2: unicode-bidi on a block container applies to its inline
+	// content; plaintext takes the paragraph level from the text (P2, P3)
+	level := directionLevel(cs)
+	unicodeBidi := cs.UnicodeBidi
+	if unicodeBidi == "bidi-override" || unicodeBidi == "isolate-override" {
+		p.text = append(p.text, overrideControl(cs))
+		p.control = true
+	}
+	p.addAll(run)
+	if unicodeBidi == "plaintext" {
+		if detected, ok := bidi.ParagraphLevel(p.text); ok {
+			level = detected
+		}
+	}
+
+	// Text of only left-to-right characters at level 0 needs no resolving;
+	// right-to-left and Arabic number characters begin at U+0590
+	if level == 0 && !p.control && !hasRTLCharacters(p.text) {
+		for _, item := range p.items {
+			item.box.BidiLevel = 0
+		}
+		return split
+	}
+
+	levels := bidi.Levels(p.text, level)
+	for _, item := range p.items {
+		item.box.BidiLevel = lowestLevel(levels, item.start, item.end, level)
+		if item.box.isText() {
+			if fragments := item.fragments(p.text, levels); fragments != nil {
+				if split == nil {
+					split = make(map[*LayoutBox][]*LayoutBox)
+				}
+				split[item.box] = fragments
+			}
+		}
+	}
+	// Inline boxes take the fragments of their children; the top level
+	// ones are expanded by resolveBidi
+	for _, item := range p.items {
+		if item.box.BoxType == InlineBox {
+			item.box.Children = expandFragments(item.box.Children, split)
+		}
+	}
+	return split
+}
+
+// reset empties the paragraph for reuse.
+func (p *paragraph) reset() {
+	p.text = p.text[:0]
+	p.items = p.items[:0]
+	p.control = false
+}
+
+// addAll adds boxes to the paragraph, separated by the spaces that
+// collapsed between them (CSS 2.1 §16.4).
+func (p *paragraph) addAll(boxes []*LayoutBox) {
+	for i, child := range boxes {
+		if i > 0 {
+			p.text = append(p.text, ' ')
+		}
+		p.add(child)
+	}
+}
+
+// add adds a box, wrapping an inline box's content in the formatting
+// characters its unicode-bidi and direction call for.
+func (p *paragraph) add(box *LayoutBox) {
+	switch {
+	case box.isText():
+		box.Text = collapseWhitespace(box.StyledNode.Node.Data)
+		start := len(p.text)
+		for _, r := range box.Text {
+			p.text = append(p.text, r)
+		}
+		p.items = append(p.items, paragraphItem{box, start, len(p.text)})
+	case box.BoxType == InlineBox:
+		open, close := bidiControls(box.StyledNode.Style())
+		p.control = p.control || len(open) > 0
+		p.text = append(p.text, open...)
+		start := len(p.text)
+		p.addAll(box.Children)
+		p.items = append(p.items, paragraphItem{box, start, len(p.text)})
+		p.text = append(p.text, close...)
+	default:
+		start := len(p.text)
+		p.text = append(p.text, objectReplacement)
+		p.items = append(p.items, paragraphItem{box, start, len(p.text)})
+	}
+}
+
+// fragments splits a text box where the level of its text changes. It
+// returns nil if the text has a single level.
+func (item paragraphItem) fragments(text []rune, levels []bidi.Level) []*LayoutBox {
+	var fragments []*LayoutBox
+	start := item.start
+	for i := item.start + 1; i <= item.end; i++ {
+		if i < item.end && levels[i] == levels[start] {
+			continue
+		}
+		if start == item.start && i == item.end {
+			return nil
+		}
+		fragments = append(fragments, &LayoutBox{
+			BoxType:    item.box.BoxType,
+			StyledNode: item.box.StyledNode,
+			Text:       string(text[start:i]),
+			BidiLevel:  levels[start],
+		})
+		start = i
+	}
+	return fragments
+}
+
+// expandFragments replaces split text boxes in boxes by their fragments.
+func expandFragments(boxes []*LayoutBox, split map[*LayoutBox][]*LayoutBox) []*LayoutBox {
+	if len(split) == 0 {
+		return boxes
+	}
+	expanded := make([]*LayoutBox, 0, len(boxes))
+	for _, child := range boxes {
+		if fragments, ok := split[child]; ok {
+			expanded = append(expanded, fragments...)
+		} else {
+			expanded = append(expanded, child)
+		}
+	}
+	return expanded
+}
+
+// isText reports whether box is a text box.
+func (box *LayoutBox) isText() bool {
+	return box.StyledNode != nil && box.StyledNode.Node != nil && box.StyledNode.Node.Type == dom.TextNode
+}
+
+// hasRTLCharacters reports whether text has characters at or after the
+// Hebrew block, where right-to-left letters, Arabic numbers and
+// formatting characters are.
+func hasRTLCharacters(text []rune) bool {
+	for _, r := range text {
+		if r >= '\u0590' {
+			return true
+		}
+	}
+	return false
+}
+
+// lowestLevel returns the lowest level in levels[start:end], or level if
+// the range is empty.
+func lowestLevel(levels []bidi.Level, start, end int, level bidi.Level) bidi.Level {
+	if start == end {
+		return level
+	}
+	lowest := levels[start]
+	for _, l := range levels[start+1 : end] {
+		lowest = min(lowest, l)
+	}
+	return lowest
+}
+
+// directionLevel returns the paragraph level of the 'direction' property.
+// CSS Writing Modes Level 3 §2.1 Specifying Directionality: the direction property
+func directionLevel(cs *style.ComputedStyle) bidi.Level {
+	if cs.Direction == "rtl" {
+		return 1
+	}
+	return 0
+}
+
+// overrideControl returns the override character for the direction of
+// cs.
+func overrideControl(cs *style.ComputedStyle) rune {
+	if directionLevel(cs).RTL() {
+		return bidi.RLO
+	}
+	return bidi.LRO
+}
+
+// bidiControls returns the formatting characters that open and close an
+// inline box's content for its 'unicode-bidi' and 'direction'.
+// CSS Writing Modes Level 3 §2.4.2 CSS–Unicode Bidi Control Translation
+func bidiControls(cs *style.ComputedStyle) (open, close []rune) {
+	rtl := directionLevel(cs).RTL()
+	embedding, isolate := bidi.LRE, bidi.LRI
+	if rtl {
+		embedding, isolate = bidi.RLE, bidi.RLI
+	}
+	switch cs.UnicodeBidi {
+	case "embed":
+		return []rune{embedding}, []rune{bidi.PDF}
+	case "isolate":
+		return []rune{isolate}, []rune{bidi.PDI}
+	case "bidi-override":
+		return []rune{overrideControl(cs)}, []rune{bidi.PDF}
+	case "isolate-override":
+		return []rune{isolate, overrideControl(cs)}, []rune{bidi.PDF, bidi.PDI}
+	case "plaintext":
+		return []rune{bidi.FSI}, []rune{bidi.PDI}
+	}
+	return nil, nil
+}
+
+// visualOrder returns boxes, children of one line or inline box, in the
+// order they are displayed, left to right.
+// UAX #9 §3.4 L2
+func visualOrder(boxes []*LayoutBox) []*LayoutBox {
+	levels := make([]bidi.Level, len(boxes))
+	reordered := false
+	for i, child := range boxes {
+		levels[i] = child.BidiLevel
+		reordered = reordered || levels[i] != levels[0] || levels[i].RTL()
+	}
+	if !reordered {
+		return boxes
+	}
+	ordered := make([]*LayoutBox, len(boxes))
+	for i, index := range bidi.Reorder(levels) {
+		ordered[i] = boxes[index]
+	}
+	return ordered
+}
+
+// continuesText reports whether next is the fragment of a text that
+// follows box with no collapsed space between them.
+func continuesText(box, next *LayoutBox) bool {
+	return box.isText() && next.StyledNode == box.StyledNode
+}
+
+// textAlignOffset returns how far the 'text-align' of a block moves a line
+// with the given free space. start and end follow the 'direction'; justify
+// aligns to the start, as the last line of a paragraph does.
+// CSS Text Level 3 §6.1 Text Alignment: the text-align shorthand
+func textAlignOffset(cs *style.ComputedStyle, free float64) float64 {
+	if free <= 0 {
+		return 0
+	}
+	rtl := directionLevel(cs).RTL()
+	switch cs.TextAlign {
+	case "left":
+		return 0
+	case "right":
+		return free
+	case "center":
+		return free / 2
+	case "end":
+		if !rtl {
+			return free
+		}
+	default: // start, justify, match-parent
+		if rtl {
+			return free
+		}
+	}
+	return 0
+}
+
+// hasOnlyInlineChildren reports whether all children of box are
+// inline-level.
+func (box *LayoutBox) hasOnlyInlineChildren() bool {
+	for _, child := range box.Children {
+		if !child.isInlineLevel() {
+			return false
+		}
+	}
+	return len(box.Children) > 0
+}
@@ -11,11 +11,14 @@
 // - Box model (content, padding, border, margin) per CSS 2.1 §8
 // - Block-level layout in normal flow (CSS 2.1 §9.4.1)
 // - Inline formatting context with baseline alignment (CSS 2.1 §9.4.2, §10.8)
-// - Table layout with auto width algorithm (CSS 2.1 §17.5)
+// - Table layout with auto width algorithm (CSS 2.1 §17.5) and border-spacing between rows and columns (§17.6.1)
 // - Width calculation per CSS 2.1 §10.3.3
 // - Height calculation per CSS 2.1 §10.6.3
-// - Text alignment (left, center, right) via CSS text-align and HTML align attribute
-// - Vertical alignment in table cells via HTML valign attribute
+// - Text alignment via CSS text-align (CSS Text Level 3 §6.1) and the HTML align attribute
+// - Bidirectional inline content (UAX #9, CSS Writing Modes Level 3 §2, bidi.go)
+// - Vertical alignment in table cells via vertical-align and the HTML valign attribute
+// - Boxes for ::before/::after generated content (CSS 2.1 §12.1)
+// - List item markers, inside and outside (CSS Lists Level 3 §3)
 //
 // Not yet implemented (would log warnings if encountered):
 // - Floats (CSS 2.1 §9.5)
@@ -29,10 +32,16 @@
 package layout
 
 import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"math"
 	"strconv"
 	"strings"
 
+	"github.com/lukehoban/browser/bidi"
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
 	"github.com/lukehoban/browser/font"
@@ -59,6 +68,10 @@ const (
 	// For most Latin fonts, the baseline is approximately 80% from the top of the em-box,
 	// accounting for ascenders (the baseline sits below the cap height).
 	baselinePositionEm = 0.8
+
+	// CSS Lists Level 3 §3.1: Width of a disc, circle or square marker,
+	// including the space after the bullet, as a fraction of font size.
+	bulletMarkerWidthEm = 1.0
 )
 
 // LayoutBox represents a box in the layout tree.
@@ -68,6 +81,13 @@ type LayoutBox struct {
 	StyledNode *style.StyledNode
 	Dimensions Dimensions
 	Children   []*LayoutBox
+
+	// Text is the collapsed text of a text box, or the part of it in one
+	// fragment when bidi resolution splits a text node (bidi.go).
+	Text string
+	// BidiLevel is the embedding level of a text box, or the lowest level
+	// of an inline box's content. UAX #9
+	BidiLevel bidi.Level
 }
 
 // BoxType represents the type of a layout box.
@@ -88,6 +108,9 @@ const (
 	TableRowBox
 	// TableCellBox represents a table cell box
 	TableCellBox
+	// MarkerBox represents the ::marker box of a list item
+	// CSS Lists Level 3 §3 Markers
+	MarkerBox
 )
 
 // Dimensions represents the dimensions of a box.
@@ -125,10 +148,14 @@ type EdgeSizes struct {
 // LayoutTree builds a layout tree from a styled tree.
 // CSS 2.1 §9.2 Controlling box generation
 func LayoutTree(styledNode *style.StyledNode, containingBlock Dimensions) *LayoutBox {
-	// Set initial containing block dimensions
-	containingBlock.Content.Width = 800.0 // Default viewport width
+	// CSS 2.1 §10.1: The initial containing block has the dimensions of
+	// the viewport; default to an 800px wide viewport
+	if containingBlock.Content.Width <= 0 {
+		containingBlock.Content.Width = 800.0
+	}
 
 	root := buildLayoutTree(styledNode)
+	root.resolveBidi()
 	root.Layout(containingBlock)
 	return root
 }
@@ -157,15 +184,16 @@ func buildLayoutTree(styledNode *style.StyledNode) *LayoutBox {
 	// CSS 2.1 §17.2.1: The table element generates a principal table box
 	// CSS 2.1 §9.2.2: Inline-level elements
 	boxType := BlockBox
-	display := styledNode.Styles["display"]
+	cs := styledNode.Style()
+	display := cs.Display
 	
 	// CSS 2.1 §9.3: Positioning schemes (absolute, relative, fixed) - not yet implemented
-	if position := styledNode.Styles["position"]; position != "" && position != "static" {
+	if position := cs.Position; position != "static" {
 		log.Warnf("CSS 2.1 §9.3: position:%s not yet implemented (only 'static' positioning supported)", position)
 	}
 	
 	// CSS 2.1 §9.5: Floats - not yet implemented
-	if float := styledNode.Styles["float"]; float != "" && float != "none" {
+	if float := cs.Float; float != "none" {
 		log.Warnf("CSS 2.1 §9.5: float:%s not yet implemented", float)
 	}
 	
@@ -193,7 +221,8 @@ func buildLayoutTree(styledNode *style.StyledNode) *LayoutBox {
 		// CSS 2.1 §9.2.2: Inline-level elements and inline boxes
 		// These elements generate inline boxes by default
 		case "a", "span", "b", "strong", "i", "em", "font", "code", "small", "big",
-			"abbr", "cite", "kbd", "samp", "var", "sub", "sup", "mark", "u", "s", "del", "ins":
+			"abbr", "cite", "kbd", "samp", "var", "sub", "sup", "mark", "u", "s", "del", "ins",
+			"bdi", "bdo":
 			display = "inline"
 		// HTML5 §10.3.1: Elements that should not be rendered
 		// These elements have display:none in the default UA stylesheet
@@ -218,6 +247,11 @@ func buildLayoutTree(styledNode *style.StyledNode) *LayoutBox {
 		boxType = TableCellBox
 	}
 
+	// CSS Lists Level 3 §3: Markers are positioned by their list item
+	if styledNode.PseudoElement == "marker" {
+		boxType = MarkerBox
+	}
+
 	box := &LayoutBox{
 		BoxType:    boxType,
 		StyledNode: styledNode,
@@ -226,6 +260,8 @@ func buildLayoutTree(styledNode *style.StyledNode) *LayoutBox {
 	}
 
 	// Build children
+	// CSS 2.1 §12.1: ::before and ::after arrive as the first and last styled
+	// children and generate boxes like any other element (inline by default)
 	for _, child := range styledNode.Children {
 		if childBox := buildLayoutTree(child); childBox != nil {
 			box.Children = append(box.Children, childBox)
@@ -250,6 +286,8 @@ func (box *LayoutBox) Layout(containingBlock Dimensions) {
 		box.layoutTableRow(containingBlock)
 	case TableCellBox:
 		box.layoutTableCell(containingBlock)
+	case MarkerBox:
+		box.layoutMarker(containingBlock)
 	}
 }
 
@@ -275,34 +313,34 @@ func (box *LayoutBox) layoutBlock(containingBlock Dimensions) {
 	// Calculate height
 	box.calculateBlockHeight()
 
-	// Handle <center> element - center children horizontally
-	// HTML 4.01 §15.1.2: The CENTER element centers content
-	if box.StyledNode != nil && box.StyledNode.Node != nil &&
-		box.StyledNode.Node.Type == dom.ElementNode &&
-		box.StyledNode.Node.Data == "center" {
-		box.applyHorizontalAlignment("center")
+	// Handle <center> and <div align> - align children horizontally
+	// HTML 4.01 §15.1.2: The CENTER element centers content; inline
+	// content alone is already aligned by its text-align (useragent.go,
+	// style/hints.go)
+	if align := box.descendantAlignment(); align != "" && !box.hasOnlyInlineChildren() {
+		box.applyHorizontalAlignment(align)
 	}
 }
 
 // calculateBlockWidth calculates the width of a block box.
 // CSS 2.1 §10.3.3 Block-level, non-replaced elements in normal flow
 func (box *LayoutBox) calculateBlockWidth(containingBlock Dimensions) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Default to auto
-	width := parseLength(styles["width"], containingBlock.Content.Width)
+	width := resolveLength(cs.Width, containingBlock.Content.Width)
 
 	// Margins (default to 0 if not specified)
-	marginLeft := parseLengthOr0(styles["margin-left"], containingBlock.Content.Width)
-	marginRight := parseLengthOr0(styles["margin-right"], containingBlock.Content.Width)
+	marginLeft := resolveLengthOr0(cs.Margin.Left, containingBlock.Content.Width)
+	marginRight := resolveLengthOr0(cs.Margin.Right, containingBlock.Content.Width)
 
 	// Padding (default to 0)
-	paddingLeft := parseLengthOr0(styles["padding-left"], containingBlock.Content.Width)
-	paddingRight := parseLengthOr0(styles["padding-right"], containingBlock.Content.Width)
+	paddingLeft := resolveLengthOr0(cs.Padding.Left, containingBlock.Content.Width)
+	paddingRight := resolveLengthOr0(cs.Padding.Right, containingBlock.Content.Width)
 
 	// Border (default to 0)
-	borderLeft := parseLengthOr0(styles["border-left-width"], containingBlock.Content.Width)
-	borderRight := parseLengthOr0(styles["border-right-width"], containingBlock.Content.Width)
+	borderLeft := resolveLengthOr0(cs.BorderWidth.Left, containingBlock.Content.Width)
+	borderRight := resolveLengthOr0(cs.BorderWidth.Right, containingBlock.Content.Width)
 
 	// Calculate total width
 	total := marginLeft + marginRight + borderLeft + borderRight +
@@ -336,19 +374,19 @@ func (box *LayoutBox) calculateBlockWidth(containingBlock Dimensions) {
 // calculateBlockPosition calculates the position of a block box.
 // CSS 2.1 §10.6.3 Block-level non-replaced elements in normal flow
 func (box *LayoutBox) calculateBlockPosition(containingBlock Dimensions) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Margin (default to 0)
-	box.Dimensions.Margin.Top = parseLengthOr0(styles["margin-top"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Bottom = parseLengthOr0(styles["margin-bottom"], containingBlock.Content.Width)
+	box.Dimensions.Margin.Top = resolveLengthOr0(cs.Margin.Top, containingBlock.Content.Width)
+	box.Dimensions.Margin.Bottom = resolveLengthOr0(cs.Margin.Bottom, containingBlock.Content.Width)
 
 	// Padding (default to 0)
-	box.Dimensions.Padding.Top = parseLengthOr0(styles["padding-top"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Bottom = parseLengthOr0(styles["padding-bottom"], containingBlock.Content.Width)
+	box.Dimensions.Padding.Top = resolveLengthOr0(cs.Padding.Top, containingBlock.Content.Width)
+	box.Dimensions.Padding.Bottom = resolveLengthOr0(cs.Padding.Bottom, containingBlock.Content.Width)
 
 	// Border (default to 0)
-	box.Dimensions.Border.Top = parseLengthOr0(styles["border-top-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Bottom = parseLengthOr0(styles["border-bottom-width"], containingBlock.Content.Width)
+	box.Dimensions.Border.Top = resolveLengthOr0(cs.BorderWidth.Top, containingBlock.Content.Width)
+	box.Dimensions.Border.Bottom = resolveLengthOr0(cs.BorderWidth.Bottom, containingBlock.Content.Width)
 
 	// Position box below previous sibling or at top of container
 	box.Dimensions.Content.X = containingBlock.Content.X +
@@ -368,6 +406,20 @@ func (box *LayoutBox) layoutBlockChildren() {
 	for i := 0; i < len(box.Children); {
 		child := box.Children[i]
 
+		// CSS Lists Level 3 §3.2: An outside marker sits in the margin to
+		// the left of the first line and takes no space in the flow
+		if child.isOutsideMarker() {
+			child.Layout(box.Dimensions)
+			offset := child.marginBox().Width
+			if len(child.Children) > 0 {
+				// Collapsed trailing space of "1. " (CSS 2.1 §16.4)
+				offset += calculateWordSpacing(child)
+			}
+			child.shiftX(-offset)
+			i++
+			continue
+		}
+
 		// CSS 2.1 §9.4.2: Inline formatting context
 		if child.isInlineLevel() {
 			inlineRun := make([]*LayoutBox, 0)
@@ -402,6 +454,8 @@ func (box *LayoutBox) layoutInlineChildren(children []*LayoutBox) {
 	maxBaseline := 0.0
 	maxHeight := 0.0
 
+	// UAX #9 §3.4 L2: children are placed in visual order (bidi.go)
+	children = visualOrder(children)
 	for i, child := range children {
 		inlineCB := Dimensions{
 			Content: Rect{
@@ -421,7 +475,7 @@ func (box *LayoutBox) layoutInlineChildren(children []*LayoutBox) {
 		currentX += child.marginBox().Width
 
 		// CSS 2.1 §16.4: Add word-spacing between adjacent inline elements
-		if i < len(children)-1 {
+		if i < len(children)-1 && !continuesText(child, children[i+1]) {
 			currentX += calculateWordSpacing(child)
 		}
 
@@ -447,6 +501,13 @@ func (box *LayoutBox) layoutInlineChildren(children []*LayoutBox) {
 		}
 	}
 
+	// CSS Text Level 3 §6.1: Align the line within the block
+	if offset := textAlignOffset(box.StyledNode.Style(), box.Dimensions.Content.Width-(currentX-box.Dimensions.Content.X)); offset > 0 {
+		for _, child := range children {
+			child.shiftX(offset)
+		}
+	}
+
 	// Increase parent height by the tallest inline box on this line
 	box.Dimensions.Content.Height += maxHeight
 }
@@ -458,7 +519,7 @@ func (box *LayoutBox) layoutInlineChildren(children []*LayoutBox) {
 func getBaseline(box *LayoutBox) float64 {
 	// For text nodes and elements with font styling, use font-based baseline
 	if box.StyledNode != nil {
-		fontSize := extractFontSize(box.StyledNode.Styles)
+		fontSize := box.StyledNode.Style().Font.Size
 		// CSS 2.1 §10.8.1: Baseline is at baselinePositionEm of font size from top
 		return fontSize * baselinePositionEm
 	}
@@ -471,23 +532,23 @@ func getBaseline(box *LayoutBox) float64 {
 // CSS 2.1 §9.4.2 Inline formatting contexts
 // CSS 2.1 §10.8: Line height and baseline alignment
 func (box *LayoutBox) layoutInlineBox(containingBlock Dimensions) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Apply inline box model properties
-	box.Dimensions.Margin.Left = parseLengthOr0(styles["margin-left"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Right = parseLengthOr0(styles["margin-right"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Top = parseLengthOr0(styles["margin-top"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Bottom = parseLengthOr0(styles["margin-bottom"], containingBlock.Content.Width)
+	box.Dimensions.Margin.Left = resolveLengthOr0(cs.Margin.Left, containingBlock.Content.Width)
+	box.Dimensions.Margin.Right = resolveLengthOr0(cs.Margin.Right, containingBlock.Content.Width)
+	box.Dimensions.Margin.Top = resolveLengthOr0(cs.Margin.Top, containingBlock.Content.Width)
+	box.Dimensions.Margin.Bottom = resolveLengthOr0(cs.Margin.Bottom, containingBlock.Content.Width)
 
-	box.Dimensions.Padding.Left = parseLengthOr0(styles["padding-left"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Right = parseLengthOr0(styles["padding-right"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Top = parseLengthOr0(styles["padding-top"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Bottom = parseLengthOr0(styles["padding-bottom"], containingBlock.Content.Width)
+	box.Dimensions.Padding.Left = resolveLengthOr0(cs.Padding.Left, containingBlock.Content.Width)
+	box.Dimensions.Padding.Right = resolveLengthOr0(cs.Padding.Right, containingBlock.Content.Width)
+	box.Dimensions.Padding.Top = resolveLengthOr0(cs.Padding.Top, containingBlock.Content.Width)
+	box.Dimensions.Padding.Bottom = resolveLengthOr0(cs.Padding.Bottom, containingBlock.Content.Width)
 
-	box.Dimensions.Border.Left = parseLengthOr0(styles["border-left-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Right = parseLengthOr0(styles["border-right-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Top = parseLengthOr0(styles["border-top-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Bottom = parseLengthOr0(styles["border-bottom-width"], containingBlock.Content.Width)
+	box.Dimensions.Border.Left = resolveLengthOr0(cs.BorderWidth.Left, containingBlock.Content.Width)
+	box.Dimensions.Border.Right = resolveLengthOr0(cs.BorderWidth.Right, containingBlock.Content.Width)
+	box.Dimensions.Border.Top = resolveLengthOr0(cs.BorderWidth.Top, containingBlock.Content.Width)
+	box.Dimensions.Border.Bottom = resolveLengthOr0(cs.BorderWidth.Bottom, containingBlock.Content.Width)
 
 	// Position content relative to containing block and the box model edges
 	box.Dimensions.Content.X = containingBlock.Content.X +
@@ -504,8 +565,10 @@ func (box *LayoutBox) layoutInlineBox(containingBlock Dimensions) {
 	maxBaseline := 0.0
 	maxHeight := 0.0
 
-	// First pass: layout all children to calculate their dimensions
-	for i, child := range box.Children {
+	// First pass: layout all children to calculate their dimensions,
+	// in visual order (bidi.go)
+	children := visualOrder(box.Children)
+	for i, child := range children {
 		inlineCB := Dimensions{
 			Content: Rect{
 				X:      currentX,
@@ -524,7 +587,7 @@ func (box *LayoutBox) layoutInlineBox(containingBlock Dimensions) {
 		currentX += child.marginBox().Width
 
 		// CSS 2.1 §16.4: Add word-spacing between adjacent inline elements
-		if i < len(box.Children)-1 {
+		if i < len(children)-1 && !continuesText(child, children[i+1]) {
 			currentX += calculateWordSpacing(child)
 		}
 
@@ -559,15 +622,75 @@ func (box *LayoutBox) layoutInlineBox(containingBlock Dimensions) {
 func calculateWordSpacing(child *LayoutBox) float64 {
 	fontSize := css.BaseFontHeight
 	if child.StyledNode != nil {
-		fontSize = extractFontSize(child.StyledNode.Styles)
+		fontSize = child.StyledNode.Style().Font.Size
 	}
 	return fontSize * defaultWordSpacingEm
 }
 
+// layoutMarker lays out a list item's ::marker box. Text markers are laid
+// out like inline boxes, image markers take the image's intrinsic size, and
+// disc, circle and square markers only reserve room for the bullet, which
+// the renderer paints.
+// CSS Lists Level 3 §3 Markers
+func (box *LayoutBox) layoutMarker(containingBlock Dimensions) {
+	x := containingBlock.Content.X
+	y := containingBlock.Content.Y + containingBlock.Content.Height
+	fontSize := box.StyledNode.Style().Font.Size
+
+	for i, child := range box.Children {
+		if child.StyledNode.Node.Data != "img" {
+			continue
+		}
+		width, height, ok := imageSize(child.StyledNode.Node.GetAttribute("src"))
+		if !ok {
+			// CSS 2.1 §12.6.2: If the image cannot be loaded the
+			// list-style-type is used instead
+			box.Children = append(box.Children[:i], box.Children[i+1:]...)
+			break
+		}
+		child.Dimensions.Content = Rect{X: x, Y: y, Width: width, Height: height}
+		box.Dimensions.Content = child.Dimensions.Content
+		return
+	}
+
+	if len(box.Children) > 0 {
+		box.layoutInlineBox(containingBlock)
+		return
+	}
+
+	box.Dimensions.Content = Rect{
+		X:      x,
+		Y:      y,
+		Width:  fontSize * bulletMarkerWidthEm,
+		Height: fontSize,
+	}
+}
+
+// imageSize returns the intrinsic size of the image at src, reporting
+// whether it could be loaded and decoded.
+func imageSize(src string) (float64, float64, bool) {
+	data, err := dom.NewResourceLoader("").LoadResource(src)
+	if err != nil {
+		return 0, 0, false
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return float64(config.Width), float64(config.Height), true
+}
+
+// isOutsideMarker reports whether box is a ::marker with
+// 'list-style-position: outside', the initial value.
+// CSS 2.1 §12.6.2 Lists: the 'list-style-position' property
+func (box *LayoutBox) isOutsideMarker() bool {
+	return box.BoxType == MarkerBox && box.StyledNode.Style().ListStylePosition != "inside"
+}
+
 // isInlineLevel returns true for inline boxes and text nodes.
 // Note: Anonymous inline boxes (CSS 2.1 §9.2.2.1) are not generated yet; only explicit inline elements and text nodes are treated as inline.
 func (box *LayoutBox) isInlineLevel() bool {
-	if box.BoxType == InlineBox {
+	if box.BoxType == InlineBox || box.BoxType == MarkerBox {
 		return true
 	}
 	if box.StyledNode != nil && box.StyledNode.Node != nil && box.StyledNode.Node.Type == dom.TextNode {
@@ -580,51 +703,27 @@ func (box *LayoutBox) isInlineLevel() bool {
 // CSS 2.1 §10.6.3
 func (box *LayoutBox) calculateBlockHeight() {
 	// If height is explicitly set, use that
-	if height := box.StyledNode.Styles["height"]; height != "" {
-		if h := parseLength(height, 0); h >= 0 {
-			box.Dimensions.Content.Height = h
-		}
+	if h := resolveLength(box.StyledNode.Style().Height, 0); h >= 0 {
+		box.Dimensions.Content.Height = h
 	}
 	// Otherwise, height is already calculated from children
 }
 
-// parseLength parses a CSS length value.
-// Returns -1 if the value is "auto" or invalid.
+// resolveLength returns a computed length in pixels, resolving percentages
+// against referenceLength. Returns -1 if the value is "auto".
 // CSS 2.1 §4.3.2 Lengths
-func parseLength(value string, referenceLength float64) float64 {
-	value = strings.TrimSpace(value)
-
-	if value == "" || value == "auto" {
-		return -1
-	}
-
-	// Parse percentage
-	if strings.HasSuffix(value, "%") {
-		if pct, err := strconv.ParseFloat(value[:len(value)-1], 64); err == nil {
-			return referenceLength * pct / 100.0
-		}
+func resolveLength(length style.Length, referenceLength float64) float64 {
+	px, ok := length.Resolve(referenceLength)
+	if !ok {
 		return -1
 	}
-
-	// Parse pixels
-	if strings.HasSuffix(value, "px") {
-		if px, err := strconv.ParseFloat(value[:len(value)-2], 64); err == nil {
-			return px
-		}
-		return -1
-	}
-
-	// Try parsing as a number (assume px)
-	if num, err := strconv.ParseFloat(value, 64); err == nil {
-		return num
-	}
-
-	return -1
+	return px
 }
 
-// parseLengthOr0 parses a CSS length value, returning 0 if invalid or auto.
-func parseLengthOr0(value string, referenceLength float64) float64 {
-	result := parseLength(value, referenceLength)
+// resolveLengthOr0 returns a computed length in pixels, or 0 if it is auto
+// or negative.
+func resolveLengthOr0(length style.Length, referenceLength float64) float64 {
+	result := resolveLength(length, referenceLength)
 	if result < 0 {
 		return 0
 	}
@@ -659,11 +758,9 @@ func expandRect(rect Rect, edges EdgeSizes) Rect {
 // applyExplicitRowHeight applies an explicit height style to an empty table row.
 // CSS 2.1 §17.5.3: Table row height can be explicitly set.
 // Returns true if height was applied (indicating the caller should return early).
-func applyExplicitRowHeight(box *LayoutBox, styles map[string]string) bool {
-	if height := styles["height"]; height != "" {
-		if h := parseLength(height, 0); h >= 0 {
-			box.Dimensions.Content.Height = h
-		}
+func applyExplicitRowHeight(box *LayoutBox, cs *style.ComputedStyle) bool {
+	if h := resolveLength(cs.Height, 0); h >= 0 {
+		box.Dimensions.Content.Height = h
 	}
 	return true
 }
@@ -671,17 +768,13 @@ func applyExplicitRowHeight(box *LayoutBox, styles map[string]string) bool {
 // layoutText lays out a text node.
 // CSS 2.1 §16 Text
 func (box *LayoutBox) layoutText(containingBlock Dimensions) {
-	// Get the text content
-	text := box.StyledNode.Node.Data
-	if text == "" {
-		box.Dimensions.Content.Width = 0
-		box.Dimensions.Content.Height = 0
-		return
-	}
-
+	// Get the text content, collapsed by bidi resolution or here
 	// CSS 2.1 §16.6.1: Collapse whitespace for layout calculations
 	// This ensures dimensions match what will actually be rendered
-	text = collapseWhitespace(text)
+	text := box.Text
+	if text == "" {
+		text = collapseWhitespace(box.StyledNode.Node.Data)
+	}
 
 	if text == "" {
 		box.Dimensions.Content.Width = 0
@@ -689,17 +782,12 @@ func (box *LayoutBox) layoutText(containingBlock Dimensions) {
 		return
 	}
 
-	// Get font size and style from CSS styles (CSS 2.1 §15 Fonts)
-	fontSize := extractFontSize(box.StyledNode.Styles)
-	fontWeight := extractFontWeight(box.StyledNode.Styles)
-	fontStyleStr := extractFontStyle(box.StyledNode.Styles)
-	
-	// Measure text using shared font.MeasureText
-	// This ensures layout and rendering use the same measurements
-	fontStyle := font.Style{
-		Size:   fontSize,
-		Weight: fontWeight,
-		Style:  fontStyleStr,
+	// Measure text using shared font.MeasureText with the computed font
+	// (CSS 2.1 §15 Fonts). This ensures layout and rendering use the same
+	// measurements
+	fontStyle := box.StyledNode.Style().Font
+	if box.BidiLevel.RTL() {
+		fontStyle.Direction = "rtl"
 	}
 	width, height := font.MeasureText(text, fontStyle)
 
@@ -710,21 +798,6 @@ func (box *LayoutBox) layoutText(containingBlock Dimensions) {
 	box.Dimensions.Content.Height = height
 }
 
-// extractFontSize extracts the font-size from CSS styles and returns it in pixels.
-// CSS 2.1 §15.7 Font size: the 'font-size' property
-func extractFontSize(styles map[string]string) float64 {
-	fontSize := styles["font-size"]
-	if fontSize == "" {
-		return css.BaseFontHeight // Default font size
-	}
-
-	if size := css.ParseFontSize(fontSize); size > 0 {
-		return size
-	}
-
-	return css.BaseFontHeight // Default font size
-}
-
 // collapseWhitespace collapses consecutive whitespace characters into a single space.
 // CSS 2.1 §16.6.1: The white-space property
 // For normal text (white-space: normal, which is the default):
@@ -769,7 +842,7 @@ func collapseWhitespace(text string) string {
 // CSS 2.1 §17.6.1: Border-spacing property adds space between cells
 func (box *LayoutBox) layoutTable(containingBlock Dimensions) {
 	// CSS 2.1 §17.6.2: Border-collapse model - not yet implemented
-	if borderCollapse := box.StyledNode.Styles["border-collapse"]; borderCollapse == "collapse" {
+	if box.StyledNode.Style().BorderCollapse == "collapse" {
 		log.Warnf("CSS 2.1 §17.6.2: border-collapse:collapse not yet implemented, using separate borders")
 	}
 	
@@ -780,12 +853,7 @@ func (box *LayoutBox) layoutTable(containingBlock Dimensions) {
 	// Get border-spacing value (CSS 2.1 §17.6.1)
 	// For simplicity, we use the same spacing for horizontal and vertical
 	// (full spec supports "horizontal vertical" syntax)
-	borderSpacing := 2.0 // Default from user-agent stylesheet
-	if spacing := box.StyledNode.Styles["border-spacing"]; spacing != "" {
-		if parsed := parseLength(spacing, 0); parsed >= 0 {
-			borderSpacing = parsed
-		}
-	}
+	borderSpacing := resolveLengthOr0(box.StyledNode.Style().BorderSpacing, 0)
 
 	// Calculate the number of columns in the table
 	// CSS 2.1 §17.2.1: The number of columns is determined by examining all rows
@@ -793,15 +861,25 @@ func (box *LayoutBox) layoutTable(containingBlock Dimensions) {
 
 	// Calculate column widths based on content
 	// CSS 2.1 §17.5.2.2: Auto table layout
-	columnWidths := box.calculateColumnWidths(numColumns, box.Dimensions.Content.Width)
-
-	// Layout table rows with column widths and border spacing
+	// CSS 2.1 §17.6.1: The spacing before, between and after the columns
+	// is not available to them
+	columnsWidth := math.Max(0, box.Dimensions.Content.Width-float64(numColumns+1)*borderSpacing)
+	columnWidths := box.calculateColumnWidths(numColumns, columnsWidth)
+
+	// Layout table rows with column widths and border spacing, which
+	// also separates the rows from each other and from the table's edges
+	rows := 0
 	for _, row := range box.Children {
 		if row.BoxType == TableRowBox {
+			box.Dimensions.Content.Height += borderSpacing
 			row.layoutWithColumnWidths(box.Dimensions, columnWidths, borderSpacing)
 			box.Dimensions.Content.Height += row.marginBox().Height
+			rows++
 		}
 	}
+	if rows > 0 {
+		box.Dimensions.Content.Height += borderSpacing
+	}
 
 	// If height is explicitly set, use that
 	box.calculateBlockHeight()
@@ -925,10 +1003,8 @@ func (box *LayoutBox) estimateCellMinWidth(cell *LayoutBox) float64 {
 
 	// Check for explicit width style
 	if cell.StyledNode != nil {
-		if widthStr := cell.StyledNode.Styles["width"]; widthStr != "" {
-			if w := parseLength(widthStr, 0); w > 0 {
-				return w + 20 // Add some padding
-			}
+		if w := resolveLength(cell.StyledNode.Style().Width, 0); w > 0 {
+			return w + 20 // Add some padding
 		}
 	}
 
@@ -956,13 +1032,10 @@ func (box *LayoutBox) estimateContentWidth(layoutBox *LayoutBox) float64 {
 
 	// Check for explicit width on the element itself
 	if layoutBox.StyledNode != nil {
-		if widthStr := layoutBox.StyledNode.Styles["width"]; widthStr != "" {
-			if w := parseLength(widthStr, 0); w > 0 {
-				// Add padding if specified
-				paddingLeft := parseLengthOr0(layoutBox.StyledNode.Styles["padding-left"], 0)
-				paddingRight := parseLengthOr0(layoutBox.StyledNode.Styles["padding-right"], 0)
-				return w + paddingLeft + paddingRight
-			}
+		cs := layoutBox.StyledNode.Style()
+		if w := resolveLength(cs.Width, 0); w > 0 {
+			// Add padding if specified
+			return w + resolveLengthOr0(cs.Padding.Left, 0) + resolveLengthOr0(cs.Padding.Right, 0)
 		}
 	}
 
@@ -973,19 +1046,16 @@ func (box *LayoutBox) estimateContentWidth(layoutBox *LayoutBox) float64 {
 				// Estimate text width accounting for font size and whitespace collapsing
 				// CSS 2.1 §16.6.1: Collapse whitespace for width calculations
 				text := collapseWhitespace(child.StyledNode.Node.Data)
-				fontSize := extractFontSize(child.StyledNode.Styles)
+				fontSize := child.StyledNode.Style().Font.Size
 				scale := fontSize / css.BaseFontHeight
 				textWidth := float64(len(text)) * charWidth * scale
 				width += textWidth
 			} else {
 				// Check for explicit width on child element
-				if widthStr := child.StyledNode.Styles["width"]; widthStr != "" {
-					if w := parseLength(widthStr, 0); w > 0 {
-						paddingLeft := parseLengthOr0(child.StyledNode.Styles["padding-left"], 0)
-						paddingRight := parseLengthOr0(child.StyledNode.Styles["padding-right"], 0)
-						width += w + paddingLeft + paddingRight
-						continue
-					}
+				cs := child.StyledNode.Style()
+				if w := resolveLength(cs.Width, 0); w > 0 {
+					width += w + resolveLengthOr0(cs.Padding.Left, 0) + resolveLengthOr0(cs.Padding.Right, 0)
+					continue
 				}
 				// Recursively estimate child width
 				childWidth := box.estimateContentWidth(child)
@@ -996,8 +1066,8 @@ func (box *LayoutBox) estimateContentWidth(layoutBox *LayoutBox) float64 {
 
 	// Add padding if specified
 	if layoutBox.StyledNode != nil {
-		paddingLeft := parseLengthOr0(layoutBox.StyledNode.Styles["padding-left"], 0)
-		paddingRight := parseLengthOr0(layoutBox.StyledNode.Styles["padding-right"], 0)
+		paddingLeft := resolveLengthOr0(layoutBox.StyledNode.Style().Padding.Left, 0)
+		paddingRight := resolveLengthOr0(layoutBox.StyledNode.Style().Padding.Right, 0)
 		width += paddingLeft + paddingRight
 	}
 
@@ -1025,15 +1095,15 @@ func (box *LayoutBox) layoutTableRow(containingBlock Dimensions) {
 // layoutWithColumnWidths lays out a table row with pre-calculated column widths.
 // CSS 2.1 §17.5.2.2: Auto table layout
 func (box *LayoutBox) layoutWithColumnWidths(containingBlock Dimensions, columnWidths []float64, borderSpacing float64) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Calculate position
-	box.Dimensions.Margin.Top = parseLengthOr0(styles["margin-top"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Bottom = parseLengthOr0(styles["margin-bottom"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Top = parseLengthOr0(styles["padding-top"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Bottom = parseLengthOr0(styles["padding-bottom"], containingBlock.Content.Width)
-	box.Dimensions.Border.Top = parseLengthOr0(styles["border-top-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Bottom = parseLengthOr0(styles["border-bottom-width"], containingBlock.Content.Width)
+	box.Dimensions.Margin.Top = resolveLengthOr0(cs.Margin.Top, containingBlock.Content.Width)
+	box.Dimensions.Margin.Bottom = resolveLengthOr0(cs.Margin.Bottom, containingBlock.Content.Width)
+	box.Dimensions.Padding.Top = resolveLengthOr0(cs.Padding.Top, containingBlock.Content.Width)
+	box.Dimensions.Padding.Bottom = resolveLengthOr0(cs.Padding.Bottom, containingBlock.Content.Width)
+	box.Dimensions.Border.Top = resolveLengthOr0(cs.BorderWidth.Top, containingBlock.Content.Width)
+	box.Dimensions.Border.Bottom = resolveLengthOr0(cs.BorderWidth.Bottom, containingBlock.Content.Width)
 
 	// Position row
 	box.Dimensions.Content.X = containingBlock.Content.X
@@ -1043,7 +1113,7 @@ func (box *LayoutBox) layoutWithColumnWidths(containingBlock Dimensions, columnW
 
 	// Handle empty rows (e.g., spacer rows) - apply explicit height and return
 	if len(box.Children) == 0 {
-		applyExplicitRowHeight(box, styles)
+		applyExplicitRowHeight(box, cs)
 		return
 	}
 
@@ -1057,9 +1127,13 @@ func (box *LayoutBox) layoutWithColumnWidths(containingBlock Dimensions, columnW
 		if cell.BoxType == TableCellBox {
 			colspan := getColspan(cell)
 
-			// Calculate cell width by summing column widths
+			// Calculate cell width by summing column widths, and the
+			// spacing between the columns it spans
 			cellWidth := 0.0
 			for i := 0; i < colspan && currentCol+i < len(columnWidths); i++ {
+				if i > 0 {
+					cellWidth += borderSpacing
+				}
 				cellWidth += columnWidths[currentCol+i]
 			}
 
@@ -1090,25 +1164,23 @@ func (box *LayoutBox) layoutWithColumnWidths(containingBlock Dimensions, columnW
 	box.Dimensions.Content.Height = maxHeight
 
 	// If row has explicit height, use that instead
-	if height := styles["height"]; height != "" {
-		if h := parseLength(height, 0); h >= 0 {
-			box.Dimensions.Content.Height = h
-		}
+	if h := resolveLength(cs.Height, 0); h >= 0 {
+		box.Dimensions.Content.Height = h
 	}
 }
 
 // layoutWithColumns lays out a table row with a specified column count.
 // CSS 2.1 §17.5.2: Table width algorithms
 func (box *LayoutBox) layoutWithColumns(containingBlock Dimensions, numColumns int) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Calculate position
-	box.Dimensions.Margin.Top = parseLengthOr0(styles["margin-top"], containingBlock.Content.Width)
-	box.Dimensions.Margin.Bottom = parseLengthOr0(styles["margin-bottom"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Top = parseLengthOr0(styles["padding-top"], containingBlock.Content.Width)
-	box.Dimensions.Padding.Bottom = parseLengthOr0(styles["padding-bottom"], containingBlock.Content.Width)
-	box.Dimensions.Border.Top = parseLengthOr0(styles["border-top-width"], containingBlock.Content.Width)
-	box.Dimensions.Border.Bottom = parseLengthOr0(styles["border-bottom-width"], containingBlock.Content.Width)
+	box.Dimensions.Margin.Top = resolveLengthOr0(cs.Margin.Top, containingBlock.Content.Width)
+	box.Dimensions.Margin.Bottom = resolveLengthOr0(cs.Margin.Bottom, containingBlock.Content.Width)
+	box.Dimensions.Padding.Top = resolveLengthOr0(cs.Padding.Top, containingBlock.Content.Width)
+	box.Dimensions.Padding.Bottom = resolveLengthOr0(cs.Padding.Bottom, containingBlock.Content.Width)
+	box.Dimensions.Border.Top = resolveLengthOr0(cs.BorderWidth.Top, containingBlock.Content.Width)
+	box.Dimensions.Border.Bottom = resolveLengthOr0(cs.BorderWidth.Bottom, containingBlock.Content.Width)
 
 	// Position row
 	box.Dimensions.Content.X = containingBlock.Content.X
@@ -1118,7 +1190,7 @@ func (box *LayoutBox) layoutWithColumns(containingBlock Dimensions, numColumns i
 
 	// Handle empty rows (e.g., spacer rows) - apply explicit height and return
 	if len(box.Children) == 0 || numColumns == 0 {
-		applyExplicitRowHeight(box, styles)
+		applyExplicitRowHeight(box, cs)
 		return
 	}
 
@@ -1164,41 +1236,39 @@ func (box *LayoutBox) layoutWithColumns(containingBlock Dimensions, numColumns i
 	box.Dimensions.Content.Height = maxHeight
 
 	// If row has explicit height, use that instead
-	if height := styles["height"]; height != "" {
-		if h := parseLength(height, 0); h >= 0 {
-			box.Dimensions.Content.Height = h
-		}
+	if h := resolveLength(cs.Height, 0); h >= 0 {
+		box.Dimensions.Content.Height = h
 	}
 }
 
 // layoutTableCell lays out a table cell.
 // CSS 2.1 §17.5.3 Table height algorithms
 func (box *LayoutBox) layoutTableCell(containingBlock Dimensions) {
-	styles := box.StyledNode.Styles
+	cs := box.StyledNode.Style()
 
 	// Parse width - if specified, use it; otherwise use the width from containing block
-	width := parseLength(styles["width"], containingBlock.Content.Width)
+	width := resolveLength(cs.Width, containingBlock.Content.Width)
 	if width < 0 {
 		width = containingBlock.Content.Width
 	}
 
 	// Padding
-	paddingLeft := parseLengthOr0(styles["padding-left"], containingBlock.Content.Width)
-	paddingRight := parseLengthOr0(styles["padding-right"], containingBlock.Content.Width)
-	paddingTop := parseLengthOr0(styles["padding-top"], containingBlock.Content.Width)
-	paddingBottom := parseLengthOr0(styles["padding-bottom"], containingBlock.Content.Width)
+	paddingLeft := resolveLengthOr0(cs.Padding.Left, containingBlock.Content.Width)
+	paddingRight := resolveLengthOr0(cs.Padding.Right, containingBlock.Content.Width)
+	paddingTop := resolveLengthOr0(cs.Padding.Top, containingBlock.Content.Width)
+	paddingBottom := resolveLengthOr0(cs.Padding.Bottom, containingBlock.Content.Width)
 
 	// Border
-	borderLeft := parseLengthOr0(styles["border-left-width"], containingBlock.Content.Width)
-	borderRight := parseLengthOr0(styles["border-right-width"], containingBlock.Content.Width)
-	borderTop := parseLengthOr0(styles["border-top-width"], containingBlock.Content.Width)
-	borderBottom := parseLengthOr0(styles["border-bottom-width"], containingBlock.Content.Width)
+	borderLeft := resolveLengthOr0(cs.BorderWidth.Left, containingBlock.Content.Width)
+	borderRight := resolveLengthOr0(cs.BorderWidth.Right, containingBlock.Content.Width)
+	borderTop := resolveLengthOr0(cs.BorderWidth.Top, containingBlock.Content.Width)
+	borderBottom := resolveLengthOr0(cs.BorderWidth.Bottom, containingBlock.Content.Width)
 
 	// Margin (typically 0 for table cells)
-	marginLeft := parseLengthOr0(styles["margin-left"], containingBlock.Content.Width)
-	marginRight := parseLengthOr0(styles["margin-right"], containingBlock.Content.Width)
-	marginTop := parseLengthOr0(styles["margin-top"], containingBlock.Content.Width)
-	marginBottom := parseLengthOr0(styles["margin-bottom"], containingBlock.Content.Width)
+	marginLeft := resolveLengthOr0(cs.Margin.Left, containingBlock.Content.Width)
+	marginRight := resolveLengthOr0(cs.Margin.Right, containingBlock.Content.Width)
+	marginTop := resolveLengthOr0(cs.Margin.Top, containingBlock.Content.Width)
+	marginBottom := resolveLengthOr0(cs.Margin.Bottom, containingBlock.Content.Width)
 
 	// Calculate content width
 	contentWidth := width - paddingLeft - paddingRight - borderLeft - borderRight - marginLeft - marginRight
@@ -1233,28 +1303,53 @@ func (box *LayoutBox) layoutTableCell(containingBlock Dimensions) {
 	}
 
 	// If height is explicitly set, use that
-	if height := styles["height"]; height != "" {
-		if h := parseLength(height, 0); h >= 0 {
-			box.Dimensions.Content.Height = h
-		}
+	if h := resolveLength(cs.Height, 0); h >= 0 {
+		box.Dimensions.Content.Height = h
 	}
 
 	// Apply HTML align attribute for horizontal alignment
 	// HTML 4.01 §11.3.2: The align attribute specifies horizontal alignment
 	// Supported values: left, center, right
-	// Note: CSS text-align property (§16.2) is NOT yet implemented. It would
-	// affect inline content rendering within block containers, not child box
-	// positioning like the HTML align attribute does here.
-	if align := box.StyledNode.Node.GetAttribute("align"); align != "" {
+	// Note: CSS text-align (textAlignOffset) aligns the lines of block
+	// containers; other cell content is positioned by the align attribute.
+	if align := box.descendantAlignment(); align != "" {
 		box.applyHorizontalAlignment(align)
 	}
 
-	// Apply HTML valign attribute for vertical alignment
-	// HTML 4.01 §11.3.2: The valign attribute specifies vertical alignment
-	// Supported values: top, middle, bottom
-	if valign := box.StyledNode.Node.GetAttribute("valign"); valign != "" {
-		box.applyVerticalAlignment(valign)
+	// Apply vertical-align, which the valign attribute of the cell or its
+	// row sets (style/hints.go)
+	// CSS 2.1 §17.5.3: top, middle and bottom; baseline is treated as top
+	box.applyVerticalAlignment(cs.VerticalAlign)
+}
+
+// descendantAlignment returns how the <center> element or the align
+// attribute of a div or cell aligns the box's children: left, center or
+// right, or "" if it does not. The attribute's text-align hint aligns
+// inline content, and author CSS overriding the hint stops the alignment
+// of children too.
+// HTML §15.3.3: align "is expected to ... align descendants"
+func (box *LayoutBox) descendantAlignment() string {
+	if box.StyledNode == nil || box.StyledNode.Node == nil || box.StyledNode.Node.Type != dom.ElementNode {
+		return ""
+	}
+	node := box.StyledNode.Node
+	var align string
+	switch node.Data {
+	case "center":
+		align = "center"
+	case "div", "td", "th":
+		align = strings.ToLower(strings.TrimSpace(node.GetAttribute("align")))
+		if align == "middle" {
+			align = "center"
+		}
+	}
+	switch align {
+	case "left", "center", "right":
+		if box.StyledNode.Style().TextAlign == align {
+			return align
+		}
 	}
+	return ""
 }
 
 // applyHorizontalAlignment adjusts child positions based on HTML align attribute.
@@ -1308,7 +1403,7 @@ func (box *LayoutBox) shiftX(offset float64) {
 	}
 }
 
-// applyVerticalAlignment adjusts child positions based on HTML valign attribute.
+// applyVerticalAlignment adjusts child positions based on the cell's vertical-align.
 // HTML 4.01 §11.3.2: The valign attribute specifies vertical alignment in table cells.
 func (box *LayoutBox) applyVerticalAlignment(valign string) {
 	valign = strings.ToLower(strings.TrimSpace(valign))
@@ -1358,39 +1453,3 @@ func (box *LayoutBox) shiftY(offset float64) {
 		child.shiftY(offset)
 	}
 }
-
-// extractFontWeight extracts font-weight from CSS styles.
-// CSS 2.1 §15.6: Parse font-weight
-func extractFontWeight(styles map[string]string) string {
-	fontWeight := styles["font-weight"]
-	if fontWeight == "" {
-		return "normal"
-	}
-	
-	fontWeight = strings.TrimSpace(strings.ToLower(fontWeight))
-	if fontWeight == "bold" || fontWeight == "bolder" {
-		return "bold"
-	}
-	
-	if weight, err := strconv.Atoi(fontWeight); err == nil && weight >= 600 {
-		return "bold"
-	}
-	
-	return "normal"
-}
-
-// extractFontStyle extracts font-style from CSS styles.
-// CSS 2.1 §15.7: Parse font-style
-func extractFontStyle(styles map[string]string) string {
-	fontStyle := styles["font-style"]
-	if fontStyle == "" {
-		return "normal"
-	}
-	
-	fontStyle = strings.TrimSpace(strings.ToLower(fontStyle))
-	if fontStyle == "italic" || fontStyle == "oblique" {
-		return "italic"
-	}
-	
-	return "normal"
-}
@@ -8,15 +8,20 @@
 package layout
 
 import (
+	"os"
+	"reflect"
 	"regexp"
 	"testing"
 
+	"github.com/lukehoban/browser/bidi"
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/font"
+	"github.com/lukehoban/browser/html"
 	"github.com/lukehoban/browser/style"
 )
 
-func TestParseLength(t *testing.T) {
+func TestResolveLength(t *testing.T) {
 	tests := []struct {
 		name      string
 		value     string
@@ -29,11 +34,19 @@ func TestParseLength(t *testing.T) {
 		{"empty", "", 0, -1.0},
 		{"number", "10", 0, 10.0},
 		{"percentage calculation", "25%", 200, 50.0},
+		{"points", "12pt", 0, 16.0},
+		{"inches", "0.5in", 0, 48.0},
+		{"uncomputed em", "2em", 0, 26.0},
+		{"negative", "-4px", 0, -4.0},
+		{"unknown unit", "4furlongs", 0, -1.0},
+		{"calc", "calc(50% - 10px)", 200, 90.0},
+		{"min", "min(50%, 80px)", 200, 80.0},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := parseLength(tt.value, tt.reference)
+			width := style.ComputeStyle(map[string]string{"width": tt.value}).Width
+			result := resolveLength(width, tt.reference)
 			if result != tt.expected {
 				t.Errorf("Expected %v, got %v", tt.expected, result)
 			}
@@ -742,6 +755,57 @@ cell1.Dimensions.Content.Y, cell2.Dimensions.Content.Y)
 }
 }
 
+// TestTableSpacingAndAlignment tests that cellspacing separates every
+// cell from the others and from the table's edges, and that cells are
+// aligned vertically by vertical-align, which valign sets unless CSS
+// overrides it.
+// CSS 2.1 §17.6.1 Separated borders, §17.5.3; HTML §15.3.10 Tables
+func TestTableSpacingAndAlignment(t *testing.T) {
+	root := layoutHTML(t, `<html><body style="margin: 0">`+
+		`<table style="width: 310px" cellspacing="10" cellpadding="0">`+
+		`<tr><td style="height: 60px">a</td><td colspan="2" style="height: 60px" valign="bottom">b</td></tr>`+
+		`<tr><td>c</td><td style="vertical-align: top; height: 60px" valign="bottom">d</td><td>e</td></tr>`+
+		`</table></body></html>`)
+	table := findBox(root, "table")
+	if table == nil || len(table.Children) != 2 {
+		t.Fatal("Expected a table of two rows")
+	}
+	first, second := table.Children[0], table.Children[1]
+
+	// Rows are separated by the spacing, and the table fits it below the
+	// last row
+	if gap := second.Dimensions.Content.Y - (first.Dimensions.Content.Y + first.Dimensions.Content.Height); gap != 10 {
+		t.Errorf("Expected 10px between the rows, got %v", gap)
+	}
+	if first.Dimensions.Content.Y-table.Dimensions.Content.Y != 10 {
+		t.Errorf("Expected 10px above the first row, got %v", first.Dimensions.Content.Y-table.Dimensions.Content.Y)
+	}
+
+	// Three columns and four spacings fill the table, a spanning cell
+	// covering the spacing between its columns
+	c, e := second.Children[0], second.Children[2]
+	if right := e.Dimensions.Content.X + e.Dimensions.Content.Width; right > table.Dimensions.Content.X+table.Dimensions.Content.Width-10+0.01 {
+		t.Errorf("Expected the last cell to end 10px inside the table, ends at %v", right)
+	}
+	b := first.Children[1]
+	if spanned := e.Dimensions.Content.X + e.Dimensions.Content.Width - b.Dimensions.Content.X; b.Dimensions.Content.Width < spanned-0.01 {
+		t.Errorf("Expected the spanning cell to be %v wide, got %v", spanned, b.Dimensions.Content.Width)
+	}
+	if c.Dimensions.Content.X != table.Dimensions.Content.X+10 {
+		t.Errorf("Expected the first cell 10px inside the table, got x=%v", c.Dimensions.Content.X)
+	}
+
+	// Content is middle-aligned by default, bottom-aligned by valign, and
+	// top-aligned by CSS overriding valign
+	offset := func(cell *LayoutBox) float64 {
+		return cell.Children[0].Dimensions.Content.Y - cell.Dimensions.Content.Y
+	}
+	a, d := first.Children[0], second.Children[1]
+	if !(offset(d) == 0 && offset(a) > 0 && offset(b) > offset(a)) {
+		t.Errorf("Expected top, middle and bottom content offsets, got %v, %v and %v", offset(d), offset(a), offset(b))
+	}
+}
+
 // SKIPPED TESTS FOR KNOWN BROKEN/UNIMPLEMENTED FEATURES
 // These tests document known limitations that need to be implemented.
 // See MILESTONES.md for more details.
@@ -815,6 +879,222 @@ func TestInlineLayout(t *testing.T) {
 	}
 }
 
+// TestGeneratedContentLayout tests that ::before and ::after generate inline
+// boxes on either side of the element's content.
+// CSS 2.1 §12.1 The :before and :after pseudo-elements
+func TestGeneratedContentLayout(t *testing.T) {
+	doc := dom.NewDocument()
+	p := dom.NewElement("p")
+	p.AppendChild(dom.NewText("middle"))
+	doc.AppendChild(p)
+
+	stylesheet := css.Parse(`p::before { content: "[" } p::after { content: "]" }`)
+	styled := style.StyleTree(doc, stylesheet)
+
+	containingBlock := Dimensions{
+		Content: Rect{X: 0, Y: 0, Width: 800, Height: 0},
+	}
+	root := LayoutTree(styled, containingBlock)
+
+	pBox := root.Children[0]
+	if len(pBox.Children) != 3 {
+		t.Fatalf("Expected ::before, text and ::after boxes, got %d", len(pBox.Children))
+	}
+
+	before, text, after := pBox.Children[0], pBox.Children[1], pBox.Children[2]
+	if before.BoxType != InlineBox || after.BoxType != InlineBox {
+		t.Errorf("Expected inline boxes for generated content, got %v and %v", before.BoxType, after.BoxType)
+	}
+	if before.Dimensions.Content.Width <= 0 {
+		t.Errorf("Expected ::before box to have the width of its text, got %v", before.Dimensions.Content.Width)
+	}
+	if !(before.Dimensions.Content.X < text.Dimensions.Content.X && text.Dimensions.Content.X < after.Dimensions.Content.X) {
+		t.Errorf("Expected ::before, text, ::after left to right, got x=%v, %v, %v",
+			before.Dimensions.Content.X, text.Dimensions.Content.X, after.Dimensions.Content.X)
+	}
+}
+
+// TestListMarkerLayout tests outside and inside ::marker boxes.
+// CSS Lists Level 3 §3 Markers, CSS 2.1 §12.6.2 'list-style-position'
+func TestListMarkerLayout(t *testing.T) {
+	for _, position := range []string{"outside", "inside"} {
+		t.Run(position, func(t *testing.T) {
+			doc := dom.NewDocument()
+			ol := dom.NewElement("ol")
+			li := dom.NewElement("li")
+			li.AppendChild(dom.NewText("item"))
+			ol.AppendChild(li)
+			doc.AppendChild(ol)
+
+			stylesheet := css.Parse("ol { margin: 0; } li { list-style-position: " + position + "; }")
+			styled := style.StyleTree(doc, stylesheet)
+			root := LayoutTree(styled, Dimensions{})
+
+			liBox := root.Children[0].Children[0]
+			if len(liBox.Children) != 2 || liBox.Children[0].BoxType != MarkerBox {
+				t.Fatalf("Expected marker and text boxes, got %d children", len(liBox.Children))
+			}
+			marker, text := liBox.Children[0], liBox.Children[1]
+
+			if marker.Dimensions.Content.Width <= 0 {
+				t.Errorf("Expected marker box to have a width, got %v", marker.Dimensions.Content.Width)
+			}
+			if marker.Dimensions.Content.Y != liBox.Dimensions.Content.Y {
+				t.Errorf("Expected marker on the first line at y=%v, got %v", liBox.Dimensions.Content.Y, marker.Dimensions.Content.Y)
+			}
+
+			if position == "outside" {
+				// The marker hangs in the padding and the text starts at the content edge
+				if right := marker.Dimensions.Content.X + marker.Dimensions.Content.Width; right > liBox.Dimensions.Content.X {
+					t.Errorf("Expected outside marker to end before x=%v, ends at %v", liBox.Dimensions.Content.X, right)
+				}
+				if text.Dimensions.Content.X != liBox.Dimensions.Content.X {
+					t.Errorf("Expected text at content edge x=%v, got %v", liBox.Dimensions.Content.X, text.Dimensions.Content.X)
+				}
+			} else {
+				if marker.Dimensions.Content.X != liBox.Dimensions.Content.X {
+					t.Errorf("Expected inside marker at content edge x=%v, got %v", liBox.Dimensions.Content.X, marker.Dimensions.Content.X)
+				}
+				if text.Dimensions.Content.X <= marker.Dimensions.Content.X+marker.Dimensions.Content.Width-1 {
+					t.Errorf("Expected text after the inside marker, got x=%v", text.Dimensions.Content.X)
+				}
+			}
+		})
+	}
+}
+
+// layoutHTML parses, styles and lays out an HTML document.
+func layoutHTML(t *testing.T, source string) *LayoutBox {
+	t.Helper()
+	doc := html.Parse(source)
+	styled := style.StyleTree(doc, style.LoadStylesheets(doc, ""))
+	return LayoutTree(styled, Dimensions{Content: Rect{Width: 800}})
+}
+
+// findBox returns the first box laid out for an element.
+func findBox(box *LayoutBox, tag string) *LayoutBox {
+	if box.StyledNode != nil && box.StyledNode.Node != nil &&
+		box.StyledNode.Node.Type == dom.ElementNode && box.StyledNode.Node.Data == tag {
+		return box
+	}
+	for _, child := range box.Children {
+		if found := findBox(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// TestBidiLayout tests that inline content is split into fragments of one
+// embedding level and placed in visual order.
+// UAX #9, CSS Writing Modes Level 3 §2.4
+func TestBidiLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		texts   []string // Fragments of the paragraph, in logical order
+		levels  []bidi.Level
+		visual  []int // Indices of the fragments, left to right
+		aligned string
+	}{
+		{"left-to-right", "<p>plain text</p>", []string{"plain text"}, []bidi.Level{0}, []int{0}, "left"},
+		{"right-to-left words", "<p>ab אבג דה cd</p>", []string{"ab ", "אבג דה", " cd"}, []bidi.Level{0, 1, 0}, []int{0, 1, 2}, "left"},
+		{"dir attribute", `<p dir="rtl">אבג de 12</p>`, []string{"אבג ", "de 12"}, []bidi.Level{1, 2}, []int{1, 0}, "right"},
+		{"numbers in right-to-left text", `<p dir="rtl">אבג 12 דה</p>`, []string{"אבג ", "12", " דה"}, []bidi.Level{1, 2, 1}, []int{2, 1, 0}, "right"},
+		{"bdo", `<p><bdo dir="rtl">abc</bdo></p>`, []string{"abc"}, []bidi.Level{3}, []int{0}, "left"},
+		{"direction property", `<p style="direction: rtl">abc</p>`, []string{"abc"}, []bidi.Level{2}, []int{0}, "right"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := findBox(layoutHTML(t, tt.html), "p")
+			var fragments []*LayoutBox
+			var collect func(box *LayoutBox)
+			collect = func(box *LayoutBox) {
+				for _, child := range box.Children {
+					if child.isText() {
+						fragments = append(fragments, child)
+					}
+					collect(child)
+				}
+			}
+			collect(p)
+
+			var texts []string
+			var levels []bidi.Level
+			for _, fragment := range fragments {
+				texts = append(texts, fragment.Text)
+				levels = append(levels, fragment.BidiLevel)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) || !reflect.DeepEqual(levels, tt.levels) {
+				t.Fatalf("Expected fragments %q at levels %v, got %q at %v", tt.texts, tt.levels, texts, levels)
+			}
+
+			// Fragments of one text touch, with no collapsed space between them
+			x := fragments[tt.visual[0]].Dimensions.Content.X
+			for _, i := range tt.visual {
+				if got := fragments[i].Dimensions.Content.X; got != x {
+					t.Errorf("Expected fragment %q at x=%v, got %v", fragments[i].Text, x, got)
+				}
+				x += fragments[i].Dimensions.Content.Width
+			}
+
+			content := p.Dimensions.Content
+			switch tt.aligned {
+			case "left":
+				if start := fragments[tt.visual[0]].Dimensions.Content.X; start != content.X {
+					t.Errorf("Expected the line to start at x=%v, got %v", content.X, start)
+				}
+			case "right":
+				if x != content.X+content.Width {
+					t.Errorf("Expected the line to end at x=%v, got %v", content.X+content.Width, x)
+				}
+			}
+		})
+	}
+}
+
+// TestBidiInlineOrder tests that inline boxes are reordered as units.
+// UAX #9 §3.4 L2
+func TestBidiInlineOrder(t *testing.T) {
+	p := findBox(layoutHTML(t, `<p dir="rtl"><b>אב</b> <i>cd</i> <u>גד</u></p>`), "p")
+	b, i, u := p.Children[0], p.Children[1], p.Children[2]
+	if !(u.Dimensions.Content.X < i.Dimensions.Content.X && i.Dimensions.Content.X < b.Dimensions.Content.X) {
+		t.Errorf("Expected <u>, <i>, <b> left to right, got x=%v, %v, %v",
+			u.Dimensions.Content.X, i.Dimensions.Content.X, b.Dimensions.Content.X)
+	}
+	if b.BidiLevel != 1 || i.BidiLevel != 2 {
+		t.Errorf("Expected levels 1 and 2, got %v and %v", b.BidiLevel, i.BidiLevel)
+	}
+}
+
+func TestTextAlignOffset(t *testing.T) {
+	tests := []struct {
+		align     string
+		direction string
+		expected  float64
+	}{
+		{"", "", 0},
+		{"", "rtl", 100},
+		{"left", "rtl", 0},
+		{"right", "", 100},
+		{"center", "", 50},
+		{"start", "ltr", 0},
+		{"start", "rtl", 100},
+		{"end", "ltr", 100},
+		{"end", "rtl", 0},
+		{"justify", "rtl", 100},
+	}
+	for _, tt := range tests {
+		cs := style.ComputeStyle(map[string]string{"text-align": tt.align, "direction": tt.direction})
+		if got := textAlignOffset(cs, 100); got != tt.expected {
+			t.Errorf("text-align %q, direction %q: expected %v, got %v", tt.align, tt.direction, tt.expected, got)
+		}
+	}
+	if got := textAlignOffset(style.ComputeStyle(map[string]string{"text-align": "right"}), -10); got != 0 {
+		t.Errorf("Expected overflowing lines not to move, got %v", got)
+	}
+}
+
 func TestAbsolutePositioning_Skipped(t *testing.T) {
 	t.Skip("Absolute positioning not implemented - CSS 2.1 §9.6")
 	// CSS 2.1 §9.6 Absolute positioning
@@ -1149,3 +1429,32 @@ func TestGridLayout_Skipped(t *testing.T) {
 		t.Errorf("Expected gap of %v between items 0 and 1, got %v", expectedGap, gap1)
 	}
 }
+
+// BenchmarkLayoutHackerNews lays out test/hackernews.html, a 30-story news
+// listing. "cold" clears the font face cache before each layout, so faces
+// are only shared within the document; "warm" keeps it across layouts.
+func BenchmarkLayoutHackerNews(b *testing.B) {
+	source, err := os.ReadFile("../test/hackernews.html")
+	if err != nil {
+		b.Fatal(err)
+	}
+	doc := html.Parse(string(source))
+	styledTree := style.StyleTree(doc, style.LoadStylesheets(doc, ""))
+	containingBlock := Dimensions{
+		Content: Rect{X: 0, Y: 0, Width: 1024, Height: 0},
+	}
+
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			font.ClearFaceCache()
+			LayoutTree(styledTree, containingBlock)
+		}
+	})
+
+	b.Run("warm", func(b *testing.B) {
+		font.ClearFaceCache()
+		for i := 0; i < b.N; i++ {
+			LayoutTree(styledTree, containingBlock)
+		}
+	})
+}
@@ -20,6 +20,7 @@
 // - SVG rendering via custom parser (SVG 1.1 subset)
 // - Data URL support for inline resources (RFC 2397)
 // - Background images (CSS 2.1 §14.2.1)
+// - List markers: disc, circle and square bullets (CSS Lists Level 3 §3)
 // - PNG output via image/png
 //
 // Not yet implemented (would require additional work):
@@ -41,8 +42,8 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	"image/png"
+	"math"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/lukehoban/browser/css"
@@ -52,7 +53,6 @@ import (
 	"github.com/lukehoban/browser/svg"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/basicfont"
-	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/math/fixed"
 )
 
@@ -63,6 +63,10 @@ const (
 	
 	// CSS 2.1 §16.3.1: Distance below baseline for underlines
 	underlineOffset = 2.0
+
+	// CSS Lists Level 3 §3: Radius of disc and circle markers as a fraction
+	// of font size
+	bulletRadiusEm = 0.18
 )
 
 // FontStyle represents text rendering options.
@@ -104,13 +108,29 @@ func (c *Canvas) Clear(bg color.RGBA) {
 	}
 }
 
-// SetPixel sets a pixel at the given coordinates.
+// SetPixel paints a pixel at the given coordinates. col has premultiplied
+// alpha, as parsed by css.ParseColor; translucent colors are composited
+// over the pixel.
+// CSS Color Level 4 §4.2 Representing Transparency in Colors
 func (c *Canvas) SetPixel(x, y int, col color.RGBA) {
 	if x >= 0 && x < c.Width && y >= 0 && y < c.Height {
+		if col.A != 255 {
+			col = over(col, c.Pixels[y*c.Width+x])
+		}
 		c.Pixels[y*c.Width+x] = col
 	}
 }
 
+// over composites the premultiplied color src over dst (Porter-Duff
+// source-over).
+func over(src, dst color.RGBA) color.RGBA {
+	inverse := 255 - uint32(src.A)
+	blend := func(s, d uint8) uint8 {
+		return uint8(uint32(s) + (uint32(d)*inverse+127)/255)
+	}
+	return color.RGBA{blend(src.R, dst.R), blend(src.G, dst.G), blend(src.B, dst.B), blend(src.A, dst.A)}
+}
+
 // FillRect fills a rectangle with the given color.
 // CSS 2.1 §14.2 The background
 func (c *Canvas) FillRect(x, y, width, height int, col color.RGBA) {
@@ -134,6 +154,27 @@ func (c *Canvas) DrawRect(x, y, width, height int, col color.RGBA, thickness int
 	c.FillRect(x+width-thickness, y, thickness, height, col)
 }
 
+// FillCircle fills a circle centered at (cx, cy) with the given color.
+func (c *Canvas) FillCircle(cx, cy, radius float64, col color.RGBA) {
+	c.DrawRing(cx, cy, radius, radius, col)
+}
+
+// DrawRing fills the ring between radius-thickness and radius around
+// (cx, cy). A pixel is painted when its center lies within the ring.
+func (c *Canvas) DrawRing(cx, cy, radius, thickness float64, col color.RGBA) {
+	inner := radius - thickness
+	for y := int(math.Floor(cy - radius)); y <= int(math.Ceil(cy+radius)); y++ {
+		for x := int(math.Floor(cx - radius)); x <= int(math.Ceil(cx+radius)); x++ {
+			dx := float64(x) + 0.5 - cx
+			dy := float64(y) + 0.5 - cy
+			distance := math.Sqrt(dx*dx + dy*dy)
+			if distance <= radius && distance >= inner {
+				c.SetPixel(x, y, col)
+			}
+		}
+	}
+}
+
 // DrawSVG renders an SVG image onto the canvas at the specified position.
 // Uses the svg package for parsing and rasterization per SVG 1.1 spec.
 func (c *Canvas) DrawSVG(svgData []byte, x, y, width, height int) error {
@@ -160,59 +201,32 @@ func (c *Canvas) DrawText(text string, x, y int, col color.RGBA) {
 //
 // Text is rendered directly at 1x resolution using TrueType fonts with built-in antialiasing.
 func (c *Canvas) DrawStyledText(text string, x, y int, col color.RGBA, style FontStyle) {
-	// Select the appropriate Go font using shared font package
-	selectedFont := browserfont.SelectFont(style)
-	
-	var face font.Face
-	var metrics font.Metrics
-	
-	if selectedFont != nil {
-		// Create face with proper DPI and size
-		var err error
-		face, err = opentype.NewFace(selectedFont, &opentype.FaceOptions{
-			Size:    style.Size,
-			DPI:     72,
-			Hinting: font.HintingFull,
-		})
-		if err != nil {
-			// Fall back to basicfont if face creation fails
-			face = basicfont.Face7x13
-			metrics = face.Metrics()
-			scale := style.Size / css.BaseFontHeight
-			if scale <= 0 {
-				scale = 1.0
-			}
-			c.drawScaledBasicFont(text, x, y, col, style, face, scale)
-			return
-		}
-		defer face.Close()
-		metrics = face.Metrics()
-	} else {
-		// Fallback to bitmap font if Go font loading fails
-		face = basicfont.Face7x13
-		metrics = face.Metrics()
-		
-		// For basicfont, we need to scale
+	// Shape the text into runs by glyph coverage, each drawn with its own
+	// face, using the shared font package so that glyphs match layout
+	runs := browserfont.Shape(text, style)
+	if len(runs) == 0 {
+		// Fall back to the scaled bitmap font if no TrueType face loads
 		scale := style.Size / css.BaseFontHeight
 		if scale <= 0 {
 			scale = 1.0
 		}
-		
-		// Use scaled rendering with basicfont
-		c.drawScaledBasicFont(text, x, y, col, style, face, scale)
+		c.drawScaledBasicFont(text, x, y, col, style, basicfont.Face7x13, scale)
 		return
 	}
-	
-	// Measure the text to determine width
-	drawer := &font.Drawer{
-		Dst:  nil, // We'll set this later
-		Src:  image.NewUniform(col),
-		Face: face,
+
+	// The runs share the baseline; the line box fits the tallest face
+	var advance, ascent, descent fixed.Int26_6
+	for _, run := range runs {
+		advance += run.Advance
+		if run.Ascent > ascent {
+			ascent = run.Ascent
+		}
+		if run.Descent > descent {
+			descent = run.Descent
+		}
 	}
-	
-	// Measure text bounds
-	textWidth := drawer.MeasureString(text).Ceil()
-	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	textWidth := advance.Ceil()
+	textHeight := (ascent + descent).Ceil()
 	
 	if textWidth <= 0 || textHeight <= 0 {
 		return
@@ -221,12 +235,14 @@ func (c *Canvas) DrawStyledText(text string, x, y int, col color.RGBA, style Fon
 	// Create temporary image for the text
 	textImg := image.NewRGBA(image.Rect(0, 0, textWidth, textHeight))
 	
-	drawer.Dst = textImg
-	drawer.Dot = fixed.Point26_6{X: 0, Y: metrics.Ascent}
-	drawer.DrawString(text)
+	src := image.NewUniform(col)
+	dot := fixed.Point26_6{X: 0, Y: ascent}
+	for _, run := range runs {
+		dot = run.Draw(textImg, src, dot)
+	}
 	
 	// Calculate baseline offset
-	baselineOffset := metrics.Ascent.Ceil()
+	baselineOffset := ascent.Ceil()
 	
 	// Copy text pixels to canvas with proper alpha blending
 	for dy := 0; dy < textHeight; dy++ {
@@ -235,18 +251,10 @@ func (c *Canvas) DrawStyledText(text string, x, y int, col color.RGBA, style Fon
 			py := y - baselineOffset + dy
 			
 			if px >= 0 && px < c.Width && py >= 0 && py < c.Height {
-				r, g, b, a := textImg.At(dx, dy).RGBA()
-				if a > 0 {
-					// Use alpha blending for smooth antialiasing
-					alpha := float64(a) / 65535.0
-					existing := c.Pixels[py*c.Width+px]
-					
-					c.Pixels[py*c.Width+px] = color.RGBA{
-						R: uint8(float64(r>>8)*alpha + float64(existing.R)*(1-alpha)),
-						G: uint8(float64(g>>8)*alpha + float64(existing.G)*(1-alpha)),
-						B: uint8(float64(b>>8)*alpha + float64(existing.B)*(1-alpha)),
-						A: 255, // Canvas is opaque
-					}
+				// Glyph coverage and the color's alpha are premultiplied
+				// into the text image, which is composited over the canvas
+				if textPixel := textImg.RGBAAt(dx, dy); textPixel.A > 0 {
+					c.SetPixel(px, py, textPixel)
 				}
 			}
 		}
@@ -284,7 +292,7 @@ func (c *Canvas) drawScaledBasicFont(text string, x, y int, col color.RGBA, styl
 	drawer.DrawString(text)
 	
 	// CSS 2.1 §15.6: Apply bold effect by drawing with offset
-	if style.Weight == "bold" {
+	if browserfont.Weight(style.Weight) >= 600 {
 		drawer.Dot = fixed.Point26_6{X: fixed.I(1), Y: fixed.I(baseFace.Ascent)}
 		drawer.DrawString(text)
 	}
@@ -495,7 +503,13 @@ func Render(root *layout.LayoutBox, width, height int) *Canvas {
 	// CSS 2.1 §14.2: The background of the root element becomes the canvas background.
 	// First try to find the body's background, then fall back to root's background.
 	canvasBg := findCanvasBackground(root)
-	canvas.Clear(canvasBg)
+	if canvasBg.A == 255 {
+		canvas.Clear(canvasBg)
+	} else {
+		// A translucent background is composited over a white canvas
+		canvas.Clear(color.RGBA{255, 255, 255, 255})
+		canvas.FillRect(0, 0, width, height, canvasBg)
+	}
 
 	renderLayoutBox(canvas, root)
 
@@ -513,7 +527,7 @@ func findCanvasBackground(root *layout.LayoutBox) color.RGBA {
 	}
 
 	// Check root element's background
-	if bg := getBackgroundColor(root.StyledNode.Styles); bg.A != 0 {
+	if bg := root.StyledNode.Style().BackgroundColor; bg.A != 0 {
 		return bg
 	}
 
@@ -521,7 +535,7 @@ func findCanvasBackground(root *layout.LayoutBox) color.RGBA {
 	for _, child := range root.Children {
 		if child.StyledNode != nil && child.StyledNode.Node != nil &&
 			child.StyledNode.Node.Data == "body" {
-			if bg := getBackgroundColor(child.StyledNode.Styles); bg.A != 0 {
+			if bg := child.StyledNode.Style().BackgroundColor; bg.A != 0 {
 				return bg
 			}
 		}
@@ -530,27 +544,13 @@ func findCanvasBackground(root *layout.LayoutBox) color.RGBA {
 	return white
 }
 
-// getBackgroundColor extracts a solid background color from styles.
-// Returns transparent (A=0) if no valid color is found.
-func getBackgroundColor(styles map[string]string) color.RGBA {
-	bg := styles["background-color"]
-	if bg == "" {
-		bg = styles["background"]
-	}
-
-	if bg == "" || bg == "transparent" || bg == "none" || strings.Contains(bg, "url(") {
-		return color.RGBA{} // transparent
-	}
-
-	return css.ParseColor(bg)
-}
-
 // renderLayoutBox renders a single layout box and its children.
 func renderLayoutBox(canvas *Canvas, box *layout.LayoutBox) {
 	renderBackground(canvas, box)
 	renderBorders(canvas, box)
 	renderText(canvas, box)
 	renderImage(canvas, box)
+	renderMarker(canvas, box)
 
 	for _, child := range box.Children {
 		renderLayoutBox(canvas, child)
@@ -564,67 +564,51 @@ func renderBackground(canvas *Canvas, box *layout.LayoutBox) {
 		return
 	}
 
-	bg := box.StyledNode.Styles["background"]
-	bgImage := box.StyledNode.Styles["background-image"]
-	
-	// Check for background-image in the background shorthand or as a separate property
+	cs := box.StyledNode.Style()
+
 	// CSS 2.1 §14.2.1 Background properties: 'background-image'
-	if (bg != "" && strings.Contains(bg, "url(")) || (bgImage != "" && strings.Contains(bgImage, "url(")) {
-		// Extract the URL from url(...)
-		urlValue := bg
-		if bgImage != "" {
-			urlValue = bgImage
-		}
-		
-		// Parse the URL from url(...)
-		url := extractURLFromCSS(urlValue)
-		if url != "" {
-			// Load the image/SVG data
-			// Note: URLs in attributes are already resolved by dom.ResolveURLs
-			// For CSS background-image, we need to resolve them here
-			loader := dom.NewResourceLoader("")
-			data, err := loader.LoadResource(url)
-			if err == nil {
-				contentBox := box.Dimensions.Content
-				width := int(contentBox.Width)
-				height := int(contentBox.Height)
-				
-				// Check if it's an SVG by looking for SVG XML structure
-				// Look for <svg tag with word boundaries to avoid false positives
-				isSVG := false
-				dataStr := string(data)
-				if strings.Contains(dataStr, "<svg ") || 
-				   strings.Contains(dataStr, "<svg>") || 
-				   strings.HasPrefix(strings.TrimSpace(dataStr), "<svg") ||
-				   strings.Contains(dataStr, "<?xml") && strings.Contains(dataStr, "<svg") {
-					isSVG = true
+	if url := cs.BackgroundImage; url != "" {
+		// Load the image/SVG data
+		// Note: URLs in attributes are already resolved by dom.ResolveURLs
+		// For CSS background-image, we need to resolve them here
+		loader := dom.NewResourceLoader("")
+		data, err := loader.LoadResource(url)
+		if err == nil {
+			contentBox := box.Dimensions.Content
+			width := int(contentBox.Width)
+			height := int(contentBox.Height)
+			
+			// Check if it's an SVG by looking for SVG XML structure
+			// Look for <svg tag with word boundaries to avoid false positives
+			isSVG := false
+			dataStr := string(data)
+			if strings.Contains(dataStr, "<svg ") || 
+			   strings.Contains(dataStr, "<svg>") || 
+			   strings.HasPrefix(strings.TrimSpace(dataStr), "<svg") ||
+			   strings.Contains(dataStr, "<?xml") && strings.Contains(dataStr, "<svg") {
+				isSVG = true
+			}
+			
+			if isSVG {
+				// Render as SVG
+				err := canvas.DrawSVG(data, int(contentBox.X), int(contentBox.Y), width, height)
+				if err == nil {
+					return
 				}
-				
-				if isSVG {
-					// Render as SVG
-					err := canvas.DrawSVG(data, int(contentBox.X), int(contentBox.Y), width, height)
-					if err == nil {
-						return
-					}
-					// If SVG rendering fails, fall through to regular background handling
-				} else {
-					// Try to render as regular image (PNG, JPEG, GIF)
-					img, _, err := image.Decode(bytes.NewReader(data))
-					if err == nil {
-						canvas.DrawImage(img, int(contentBox.X), int(contentBox.Y), width, height)
-						return
-					}
+				// If SVG rendering fails, fall through to regular background handling
+			} else {
+				// Try to render as regular image (PNG, JPEG, GIF)
+				img, _, err := image.Decode(bytes.NewReader(data))
+				if err == nil {
+					canvas.DrawImage(img, int(contentBox.X), int(contentBox.Y), width, height)
+					return
 				}
 			}
 		}
 	}
-	
-	if bg == "" {
-		bg = box.StyledNode.Styles["background-color"]
-	}
 
-	if bg != "" && bg != "transparent" && bg != "none" {
-		bgColor := css.ParseColor(bg)
+	// CSS 2.1 §14.2.1 Background properties: 'background-color'
+	if bgColor := cs.BackgroundColor; bgColor.A != 0 {
 		borderBox := box.Dimensions.Content
 		borderBox.X -= box.Dimensions.Padding.Left
 		borderBox.Y -= box.Dimensions.Padding.Top
@@ -641,46 +625,16 @@ func renderBackground(canvas *Canvas, box *layout.LayoutBox) {
 	}
 }
 
-// extractURLFromCSS extracts the URL from a CSS url() function.
-// Returns empty string if no valid URL is found.
-func extractURLFromCSS(value string) string {
-	// Find url( and )
-	start := strings.Index(value, "url(")
-	if start == -1 {
-		return ""
-	}
-	start += 4 // Skip "url("
-	
-	end := strings.Index(value[start:], ")")
-	if end == -1 {
-		return ""
-	}
-	
-	url := strings.TrimSpace(value[start : start+end])
-	
-	// Remove quotes if present
-	url = strings.Trim(url, "\"'")
-	
-	return url
-}
-
 // renderBorders renders the borders of a layout box.
 // CSS 2.1 §8.5 Border properties
-// CSS 2.1 §8.5.3: Borders only render if border-style is not 'none' or absent
+// CSS 2.1 §8.5.3: Borders only render on sides whose border-style is not
+// 'none' or 'hidden'; style computation gives those sides no width
 func renderBorders(canvas *Canvas, box *layout.LayoutBox) {
 	if box.StyledNode == nil {
 		return
 	}
 
-	styles := box.StyledNode.Styles
-
-	// CSS 2.1 §8.5.3: Check if border-style is set and not 'none'
-	borderStyle := styles["border-style"]
-	if borderStyle == "" || borderStyle == "none" {
-		return
-	}
-
-	borderColor := css.ParseColor(styles["border-color"])
+	cs := box.StyledNode.Style()
 
 	// Get the padding box coordinates (borders are drawn around it)
 	paddingBox := box.Dimensions.Content
@@ -690,50 +644,57 @@ func renderBorders(canvas *Canvas, box *layout.LayoutBox) {
 	paddingBox.Height += box.Dimensions.Padding.Top + box.Dimensions.Padding.Bottom
 
 	// Draw top border
-	if box.Dimensions.Border.Top > 0 {
+	if box.Dimensions.Border.Top > 0 && visibleBorder(cs.BorderStyle.Top) {
 		canvas.FillRect(
 			int(paddingBox.X-box.Dimensions.Border.Left),
 			int(paddingBox.Y-box.Dimensions.Border.Top),
 			int(paddingBox.Width+box.Dimensions.Border.Left+box.Dimensions.Border.Right),
 			int(box.Dimensions.Border.Top),
-			borderColor,
+			cs.BorderColor.Top,
 		)
 	}
 
 	// Draw bottom border
-	if box.Dimensions.Border.Bottom > 0 {
+	if box.Dimensions.Border.Bottom > 0 && visibleBorder(cs.BorderStyle.Bottom) {
 		canvas.FillRect(
 			int(paddingBox.X-box.Dimensions.Border.Left),
 			int(paddingBox.Y+paddingBox.Height),
 			int(paddingBox.Width+box.Dimensions.Border.Left+box.Dimensions.Border.Right),
 			int(box.Dimensions.Border.Bottom),
-			borderColor,
+			cs.BorderColor.Bottom,
 		)
 	}
 
 	// Draw left border
-	if box.Dimensions.Border.Left > 0 {
+	if box.Dimensions.Border.Left > 0 && visibleBorder(cs.BorderStyle.Left) {
 		canvas.FillRect(
 			int(paddingBox.X-box.Dimensions.Border.Left),
 			int(paddingBox.Y-box.Dimensions.Border.Top),
 			int(box.Dimensions.Border.Left),
 			int(paddingBox.Height+box.Dimensions.Border.Top+box.Dimensions.Border.Bottom),
-			borderColor,
+			cs.BorderColor.Left,
 		)
 	}
 
 	// Draw right border
-	if box.Dimensions.Border.Right > 0 {
+	if box.Dimensions.Border.Right > 0 && visibleBorder(cs.BorderStyle.Right) {
 		canvas.FillRect(
 			int(paddingBox.X+paddingBox.Width),
 			int(paddingBox.Y-box.Dimensions.Border.Top),
 			int(box.Dimensions.Border.Right),
 			int(paddingBox.Height+box.Dimensions.Border.Top+box.Dimensions.Border.Bottom),
-			borderColor,
+			cs.BorderColor.Right,
 		)
 	}
 }
 
+// visibleBorder reports whether a border side with the given style is
+// drawn.
+// CSS 2.1 §8.5.3: 'none' and 'hidden' draw no border
+func visibleBorder(style string) bool {
+	return style != "none" && style != "hidden"
+}
+
 // renderText renders the text content of a layout box.
 // CSS 2.1 §16 Text
 func renderText(canvas *Canvas, box *layout.LayoutBox) {
@@ -746,30 +707,29 @@ func renderText(canvas *Canvas, box *layout.LayoutBox) {
 		return
 	}
 
-	// Get the text content
-	text := box.StyledNode.Node.Data
+	// Get the text content: the text or fragment of text layout measured
+	text := box.Text
 	if text == "" {
-		return
+		// CSS 2.1 §16.6.1: Whitespace processing
+		// Collapse sequences of whitespace (spaces, tabs, newlines) into a single space
+		// This is the default behavior for normal text (not pre-formatted)
+		text = collapseWhitespace(box.StyledNode.Node.Data)
 	}
 
-	// CSS 2.1 §16.6.1: Whitespace processing
-	// Collapse sequences of whitespace (spaces, tabs, newlines) into a single space
-	// This is the default behavior for normal text (not pre-formatted)
-	text = collapseWhitespace(text)
-	
 	if text == "" {
 		return
 	}
 
-	// Get text color from styles (default to black)
-	textColor := css.ParseColor(box.StyledNode.Styles["color"])
-	if textColor == (color.RGBA{0, 0, 0, 0}) {
-		textColor = color.RGBA{0, 0, 0, 255} // Default to black
+	// CSS 2.1 §14.1 Foreground color and §15 Fonts
+	cs := box.StyledNode.Style()
+	textColor := cs.Color
+	fontStyle := cs.Font
+
+	// UAX #9 §3.4 L3, L4: right-to-left fragments are shaped right to left
+	if box.BidiLevel.RTL() {
+		fontStyle.Direction = "rtl"
 	}
 
-	// Extract font properties from styles
-	fontStyle := extractFontStyle(box.StyledNode.Styles)
-	
 	// Render the text at the box's position
 	// Add a vertical offset to position text at baseline
 	x := int(box.Dimensions.Content.X)
@@ -778,52 +738,6 @@ func renderText(canvas *Canvas, box *layout.LayoutBox) {
 	canvas.DrawStyledText(text, x, y, textColor, fontStyle)
 }
 
-// extractFontStyle extracts font styling properties from CSS styles.
-// CSS 2.1 §15 Fonts and §16 Text
-func extractFontStyle(styles map[string]string) FontStyle {
-	fontStyle := FontStyle{
-		Size:       13.0, // Default font size
-		Weight:     "normal",
-		Style:      "normal",
-		Decoration: "none",
-	}
-	
-	// Parse font-size (CSS 2.1 §15.7)
-	if fontSize := styles["font-size"]; fontSize != "" {
-		if size := css.ParseFontSize(fontSize); size > 0 {
-			fontStyle.Size = size
-		}
-	}
-	
-	// CSS 2.1 §15.6: Parse font-weight
-	if fontWeight := styles["font-weight"]; fontWeight != "" {
-		fontWeight = strings.TrimSpace(strings.ToLower(fontWeight))
-		if fontWeight == "bold" || fontWeight == "bolder" {
-			fontStyle.Weight = "bold"
-		} else if weight, err := strconv.Atoi(fontWeight); err == nil && weight >= 600 {
-			fontStyle.Weight = "bold"
-		}
-	}
-	
-	// CSS 2.1 §15.7: Parse font-style
-	if fontStyleVal := styles["font-style"]; fontStyleVal != "" {
-		fontStyleVal = strings.TrimSpace(strings.ToLower(fontStyleVal))
-		if fontStyleVal == "italic" || fontStyleVal == "oblique" {
-			fontStyle.Style = "italic"
-		}
-	}
-	
-	// CSS 2.1 §16.3.1: Parse text-decoration
-	if textDecoration := styles["text-decoration"]; textDecoration != "" {
-		textDecoration = strings.TrimSpace(strings.ToLower(textDecoration))
-		if strings.Contains(textDecoration, "underline") {
-			fontStyle.Decoration = "underline"
-		}
-	}
-	
-	return fontStyle
-}
-
 // collapseWhitespace collapses consecutive whitespace characters into a single space.
 // CSS 2.1 §16.6.1: The white-space property
 // For normal text (white-space: normal, which is the default):
@@ -863,6 +777,40 @@ func collapseWhitespace(text string) string {
 	return output
 }
 
+// renderMarker paints disc, circle and square list markers, which layout
+// gives an empty marker box.
+// CSS Lists Level 3 §3 Markers, CSS Counter Styles Level 3 §6.2 Symbolic
+func renderMarker(canvas *Canvas, box *layout.LayoutBox) {
+	if box.BoxType != layout.MarkerBox || len(box.Children) > 0 {
+		return
+	}
+
+	cs := box.StyledNode.Style()
+	listStyleType := cs.ListStyleType
+	if !css.IsBulletStyle(listStyleType) {
+		return
+	}
+
+	markerColor := cs.Color
+
+	// The bullet is about a third of an em across, centered on the
+	// x-height of the first line
+	fontSize := cs.Font.Size
+	radius := fontSize * bulletRadiusEm
+	cx := box.Dimensions.Content.X + fontSize*0.3 + radius
+	cy := box.Dimensions.Content.Y + fontSize*0.65
+
+	switch listStyleType {
+	case "disc":
+		canvas.FillCircle(cx, cy, radius, markerColor)
+	case "circle":
+		canvas.DrawRing(cx, cy, radius, math.Max(1, radius/3), markerColor)
+	case "square":
+		side := int(math.Round(radius * 2))
+		canvas.FillRect(int(math.Round(cx-radius)), int(math.Round(cy-radius)), side, side, markerColor)
+	}
+}
+
 // renderImage renders an image element if present.
 // HTML5 §4.8.2 The img element
 func renderImage(canvas *Canvas, box *layout.LayoutBox) {
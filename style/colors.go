@@ -0,0 +1,50 @@
+package style
+
+// This file computes the currentcolor keyword, which stands for the
+// element's 'color', to the color it refers to.
+//
+// Spec references:
+// - CSS Color Level 4 §6.4 The currentcolor keyword: https://www.w3.org/TR/css-color-4/#currentcolor-color
+
+import "github.com/lukehoban/browser/css"
+
+// colorProps are the properties whose values hold colors, other than
+// 'color' itself.
+var colorProps = []string{
+	"background-color",
+	"border-top-color", "border-right-color", "border-bottom-color", "border-left-color",
+	"outline-color",
+	"text-decoration-color",
+	"column-rule-color",
+	"caret-color",
+	"fill",
+	"stroke",
+}
+
+// initialColor is the initial value of 'color'.
+// CSS Color Level 4 §3.1: the initial value is CanvasText
+const initialColor = "canvastext"
+
+// computeColors replaces currentcolor in the color properties of styles
+// by the element's color. In 'color' itself, currentcolor refers to the
+// parent's color, as 'inherit' would.
+// CSS Color Level 4 §6.4 The currentcolor keyword
+func computeColors(styles, parentStyles map[string]string) {
+	if value, ok := styles["color"]; ok {
+		styles["color"] = css.ResolveCurrentColor(value, colorOf(parentStyles))
+	}
+	current := colorOf(styles)
+	for _, prop := range colorProps {
+		if value, ok := styles[prop]; ok {
+			styles[prop] = css.ResolveCurrentColor(value, current)
+		}
+	}
+}
+
+// colorOf returns the computed 'color' of styles.
+func colorOf(styles map[string]string) string {
+	if value, ok := styles["color"]; ok && value != "" {
+		return value
+	}
+	return initialColor
+}
@@ -0,0 +1,46 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestCurrentColor tests that currentcolor computes to the element's color,
+// and in 'color' itself to the parent's color.
+// CSS Color Level 4 §6.4 The currentcolor keyword
+func TestCurrentColor(t *testing.T) {
+	stylesheet := css.Parse(`
+		div { color: red; border: 1px solid currentColor; }
+		p { color: currentcolor; background-color: color-mix(in srgb, currentcolor, white); }
+		span { color: blue; border-color: CurrentColor; }
+		em { border-color: currentcolor; }
+	`)
+	doc := html.Parse(`<html><body><div><p><span>a</span></p></div><em>b</em></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"div", "border-top-color", "red"},
+		{"p", "color", "red"},
+		{"p", "background-color", "color-mix(in srgb, red, white)"},
+		{"span", "border-left-color", "blue"},
+		{"em", "border-bottom-color", initialColor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
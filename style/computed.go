@@ -0,0 +1,334 @@
+package style
+
+// This file defines ComputedStyle, the typed computed values layout and
+// rendering read, which the property registry (properties.go) builds from
+// the cascaded values in StyledNode.Styles. Each element's style is computed
+// once, at the end of the cascade, so that its lengths, colors and
+// keywords are not parsed again on every access.
+//
+// Spec references:
+// - CSS 2.1 §6.1 Specified, computed, and actual values: https://www.w3.org/TR/CSS21/cascade.html#value-stages
+// - CSS 2.1 §6.2 Inheritance: https://www.w3.org/TR/CSS21/cascade.html#inheritance
+// - CSS 2.1 Appendix F Full property table: https://www.w3.org/TR/CSS21/propidx.html
+//
+// Implemented:
+// - Typed computed values of the box, color, font, text and list properties layout and rendering use
+// - Invalid values computing to the property's initial value
+// - Border widths computing to 0 on sides whose style is none or hidden
+//
+// Not implemented:
+// - Typed values for other properties, which are only kept in Styles
+
+import (
+	"image/color"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/font"
+)
+
+// ComputedStyle holds the computed values of an element's properties that
+// layout and rendering use.
+// CSS 2.1 §6.1.2 Computed values
+type ComputedStyle struct {
+	// Display is the 'display' keyword, or empty if no rule set it, in
+	// which case layout chooses from the element.
+	Display  string
+	Position string
+	Float    string
+
+	// Box dimensions. CSS 2.1 §8 Box model, §10.2 Content width, §10.5
+	// Content height
+	Width       Length
+	Height      Length
+	Margin      Edges
+	Padding     Edges
+	BorderWidth Edges
+
+	BorderStyle Sides[string]
+	BorderColor Sides[color.RGBA]
+
+	// Tables. CSS 2.1 §17.6 Borders
+	BorderCollapse string
+	BorderSpacing  Length
+
+	// Colors and backgrounds. CSS 2.1 §14
+	Color           color.RGBA
+	BackgroundColor color.RGBA
+	BackgroundImage string // The URL of the background image, or empty
+
+	// Font holds the font descriptors text is matched, measured and drawn
+	// with. Its Direction is left for layout, which sets it per text run.
+	Font font.Style
+
+	// Text and lists. CSS 2.1 §12.5, §16
+	TextAlign         string
+	VerticalAlign     string // A keyword, or baseline for lengths and percentages
+	Direction         string
+	UnicodeBidi       string
+	ListStyleType     string
+	ListStylePosition string
+}
+
+// Length is a computed length: absolute, a percentage or a calc() of
+// both, which layout resolves against the containing block, or 'auto'.
+type Length struct {
+	css.Length
+	Auto bool
+}
+
+// Resolve returns the length in pixels, with percentages of percentBase,
+// or false if it is 'auto'.
+func (l Length) Resolve(percentBase float64) (float64, bool) {
+	if l.Auto {
+		return 0, false
+	}
+	ctx := css.DefaultLengthContext()
+	ctx.PercentBase = percentBase
+	return l.Length.Resolve(ctx), true
+}
+
+// Sides holds a value for each side of a box.
+type Sides[T any] struct {
+	Top, Right, Bottom, Left T
+}
+
+// Edges holds a length for each side of a box, as for the margin,
+// padding and border-width properties.
+type Edges = Sides[Length]
+
+// ComputeStyle builds the computed style of an element from its cascaded
+// values, as in StyledNode.Styles. Properties missing from styles, or
+// whose values are invalid, take their initial values.
+// CSS 2.1 §6.1.2 Computed values
+func ComputeStyle(styles map[string]string) *ComputedStyle {
+	// The cascade expands shorthands, but in styles built otherwise a
+	// shorthand stands in for the longhands it would set
+	var expanded map[string]string
+	for prop, value := range styles {
+		if !IsShorthand(prop) {
+			continue
+		}
+		if expanded == nil {
+			expanded = make(map[string]string)
+		}
+		for longhand, v := range expandShorthand(prop, value) {
+			expanded[longhand] = v
+		}
+	}
+
+	cs := &ComputedStyle{}
+	for _, property := range propertyTable {
+		if property.compute == nil {
+			continue
+		}
+		value, ok := styles[property.Name]
+		if !ok {
+			value, ok = expanded[property.Name]
+		}
+		if !ok || !property.compute(cs, strings.TrimSpace(value)) {
+			property.compute(cs, property.Initial)
+		}
+	}
+
+	// CSS 2.1 §8.5.1: the computed border width is 0 if the border style
+	// is 'none' or 'hidden'
+	noBorder := func(style string) bool { return style == "none" || style == "hidden" }
+	if noBorder(cs.BorderStyle.Top) {
+		cs.BorderWidth.Top = Length{}
+	}
+	if noBorder(cs.BorderStyle.Right) {
+		cs.BorderWidth.Right = Length{}
+	}
+	if noBorder(cs.BorderStyle.Bottom) {
+		cs.BorderWidth.Bottom = Length{}
+	}
+	if noBorder(cs.BorderStyle.Left) {
+		cs.BorderWidth.Left = Length{}
+	}
+	return cs
+}
+
+// keyword returns a compute function storing a lowercase keyword in the
+// field field returns. If valid keywords are given, others are invalid.
+func keyword(field func(*ComputedStyle) *string, valid ...string) func(*ComputedStyle, string) bool {
+	return func(cs *ComputedStyle, value string) bool {
+		value = strings.ToLower(value)
+		if len(valid) > 0 && !slices.Contains(valid, value) {
+			return false
+		}
+		*field(cs) = value
+		return true
+	}
+}
+
+// lengthValue returns a compute function storing a length in the field
+// field returns, which may be 'auto' if auto is set.
+// CSS 2.1 §4.3.2 Lengths
+func lengthValue(field func(*ComputedStyle) *Length, auto bool) func(*ComputedStyle, string) bool {
+	return func(cs *ComputedStyle, value string) bool {
+		if auto && strings.EqualFold(value, "auto") {
+			*field(cs) = Length{Auto: true}
+			return true
+		}
+		length, ok := css.ParseLength(value)
+		if !ok {
+			return false
+		}
+		*field(cs) = Length{Length: length}
+		return true
+	}
+}
+
+// borderWidths are the widths of the border width keywords.
+// CSS 2.1 §8.5.1: thin <= medium <= thick
+var borderWidths = map[string]float64{"thin": 1, "medium": 3, "thick": 5}
+
+// borderWidth returns a compute function storing a border width in the
+// field field returns.
+// CSS 2.1 §8.5.1 Border width
+func borderWidth(field func(*ComputedStyle) *Length) func(*ComputedStyle, string) bool {
+	length := lengthValue(field, false)
+	return func(cs *ComputedStyle, value string) bool {
+		if width, ok := borderWidths[strings.ToLower(value)]; ok {
+			*field(cs) = Length{Length: css.Length{Value: width, Unit: "px"}}
+			return true
+		}
+		return length(cs, value)
+	}
+}
+
+// colorValue returns a compute function storing a color in the field
+// field returns. currentcolor is the element's 'color', which is computed
+// first.
+// CSS Color Level 4 §4 Representing Colors
+func colorValue(field func(*ComputedStyle) *color.RGBA) func(*ComputedStyle, string) bool {
+	return func(cs *ComputedStyle, value string) bool {
+		c, ok := css.ParseColorValue(value)
+		if !ok {
+			return false
+		}
+		if c.CurrentColor {
+			*field(cs) = cs.Color
+		} else {
+			*field(cs) = c.ToRGBA()
+		}
+		return true
+	}
+}
+
+// computeFontSize stores the font size in pixels. Style computation has
+// already made it absolute.
+// CSS 2.1 §15.7 Font size
+func computeFontSize(cs *ComputedStyle, value string) bool {
+	size := css.ParseFontSize(value)
+	if size <= 0 {
+		return false
+	}
+	cs.Font.Size = size
+	return true
+}
+
+// computeFontWeight stores "normal", "bold" or a numeric weight, which
+// font matching uses. The cascade has already resolved bolder and lighter
+// against the parent's weight (computeRelativeWeight); left here, they are
+// relative to the initial weight, 400.
+// CSS 2.1 §15.6 Font boldness
+func computeFontWeight(cs *ComputedStyle, value string) bool {
+	switch value = strings.ToLower(value); value {
+	case "normal", "bold":
+		cs.Font.Weight = value
+	case "bolder", "lighter":
+		cs.Font.Weight = strconv.Itoa(relativeWeight(value, 400))
+	default:
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 1 || weight > 1000 {
+			return false
+		}
+		cs.Font.Weight = strconv.Itoa(weight)
+	}
+	return true
+}
+
+// computeRelativeWeight replaces bolder or lighter in the 'font-weight' of
+// styles by the numeric weight it gives relative to the parent's weight,
+// which descendants inherit.
+// CSS Fonts Level 4 §2.2.1 Relative weights
+func computeRelativeWeight(styles, parentStyles map[string]string) {
+	switch keyword := strings.ToLower(strings.TrimSpace(styles["font-weight"])); keyword {
+	case "bolder", "lighter":
+		parent := font.Weight(strings.ToLower(strings.TrimSpace(parentStyles["font-weight"])))
+		styles["font-weight"] = strconv.Itoa(relativeWeight(keyword, parent))
+	}
+}
+
+// relativeWeight returns the weight bolder or lighter gives an element
+// whose parent has the given weight.
+// CSS Fonts Level 4 §2.2.1: table of bolder and lighter weights
+func relativeWeight(keyword string, parent int) int {
+	if keyword == "bolder" {
+		switch {
+		case parent < 350:
+			return 400
+		case parent < 550:
+			return 700
+		case parent < 900:
+			return 900
+		}
+		return parent
+	}
+	switch {
+	case parent < 100:
+		return parent
+	case parent < 550:
+		return 100
+	case parent < 750:
+		return 400
+	}
+	return 700
+}
+
+// computeFontStyle stores "normal" or "italic", which oblique fonts are
+// matched as.
+// CSS 2.1 §15.7 Font styling
+func computeFontStyle(cs *ComputedStyle, value string) bool {
+	switch strings.ToLower(value) {
+	case "normal":
+		cs.Font.Style = "normal"
+	case "italic", "oblique":
+		cs.Font.Style = "italic"
+	default:
+		return false
+	}
+	return true
+}
+
+// computeTextDecoration stores "underline" or "none", the decorations
+// text is drawn with, from 'text-decoration-line'.
+// CSS 2.1 §16.3.1 Underlining, overlining, striking, and blinking
+// CSS Text Decoration Level 4 §2.1 'text-decoration-line'
+func computeTextDecoration(cs *ComputedStyle, value string) bool {
+	cs.Font.Decoration = "none"
+	if strings.Contains(strings.ToLower(value), "underline") {
+		cs.Font.Decoration = "underline"
+	}
+	return true
+}
+
+// computeBackgroundImage stores the URL of a url() image, or none.
+// CSS 2.1 §14.2.1 Background properties: 'background-image'
+func computeBackgroundImage(cs *ComputedStyle, value string) bool {
+	start := strings.Index(value, "url(")
+	if start < 0 {
+		cs.BackgroundImage = ""
+		return strings.EqualFold(value, "none")
+	}
+	end := strings.IndexByte(value[start:], ')')
+	if end < 0 {
+		return false
+	}
+	cs.BackgroundImage = strings.Trim(strings.TrimSpace(value[start+4:start+end]), "\"'")
+	return true
+}
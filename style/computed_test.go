@@ -0,0 +1,252 @@
+package style
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/font"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestComputeStyleFont tests the font descriptors computed from the font
+// properties.
+// CSS 2.1 §15 Fonts
+func TestComputeStyleFont(t *testing.T) {
+	initial := font.Style{
+		Size:            13.0,
+		Weight:          "normal",
+		Stretch:         100,
+		Style:           "normal",
+		Decoration:      "none",
+		Kerning:         "auto",
+		Ligatures:       "normal",
+		FeatureSettings: "normal",
+	}
+	with := func(change func(*font.Style)) font.Style {
+		s := initial
+		change(&s)
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		styles   map[string]string
+		expected font.Style
+	}{
+		{"initial", map[string]string{}, initial},
+		{"font-size", map[string]string{"font-size": "20px"}, with(func(s *font.Style) { s.Size = 20 })},
+		{"invalid font-size", map[string]string{"font-size": "big"}, initial},
+		{"bold", map[string]string{"font-weight": "bold"}, with(func(s *font.Style) { s.Weight = "bold" })},
+		{"bolder", map[string]string{"font-weight": "Bolder"}, with(func(s *font.Style) { s.Weight = "700" })},
+		{"lighter", map[string]string{"font-weight": "lighter"}, with(func(s *font.Style) { s.Weight = "100" })},
+		{"numeric weight", map[string]string{"font-weight": "300"}, with(func(s *font.Style) { s.Weight = "300" })},
+		{"invalid weight", map[string]string{"font-weight": "2000"}, initial},
+		{"italic", map[string]string{"font-style": "italic"}, with(func(s *font.Style) { s.Style = "italic" })},
+		{"oblique", map[string]string{"font-style": "oblique"}, with(func(s *font.Style) { s.Style = "italic" })},
+		{"underline", map[string]string{"text-decoration": "underline"}, with(func(s *font.Style) { s.Decoration = "underline" })},
+		{"family and stretch", map[string]string{"font-family": "Arial, monospace", "font-stretch": "condensed"}, with(func(s *font.Style) {
+			s.Family = "Arial, monospace"
+			s.Stretch = 75
+		})},
+		{"features", map[string]string{
+			"font-kerning":           "none",
+			"font-variant-ligatures": "no-common-ligatures",
+			"font-feature-settings":  `"smcp"`,
+		}, with(func(s *font.Style) {
+			s.Kerning = "none"
+			s.Ligatures = "no-common-ligatures"
+			s.FeatureSettings = `"smcp"`
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeStyle(tt.styles).Font; got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestRelativeFontWeight tests that bolder and lighter compute from the
+// parent's weight, so that nested <b> elements get bolder.
+// CSS Fonts Level 4 §2.2.1 Relative weights
+func TestRelativeFontWeight(t *testing.T) {
+	stylesheet := css.Parse(`
+		span { font-weight: lighter; }
+		div { font-weight: 900; }
+		em { font-weight: lighter; }
+	`)
+	doc := html.Parse(`<html><body>
+		<p><b>a<b>b</b></b></p>
+		<h1>c<span>d</span></h1>
+		<div>e<em>f</em></div>
+	</body></html>`)
+	styled := StyleTree(doc, stylesheet)
+	outer := findStyledNode(styled, "b")
+
+	tests := []struct {
+		name     string
+		node     *StyledNode
+		expected string
+	}{
+		{"b", outer, "700"},
+		{"b inside b", findStyledNode(outer.Children[1], "b"), "900"},
+		{"lighter inside h1", findStyledNode(styled, "span"), "400"},
+		{"lighter inside 900", findStyledNode(styled, "em"), "700"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.Styles["font-weight"]; got != tt.expected {
+				t.Errorf("Expected font-weight %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestComputeStyleLengths tests computed lengths and their resolution
+// against a percentage basis.
+// CSS 2.1 §4.3.2 Lengths, §8.5.1 Border width
+func TestComputeStyleLengths(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		base     float64
+		expected float64
+		auto     bool
+	}{
+		{"width", "10px", 0, 10, false},
+		{"width", "25%", 200, 50, false},
+		{"width", "auto", 0, 0, true},
+		{"width", "", 0, 0, true},
+		{"width", "4furlongs", 0, 0, true},
+		{"width", "calc(50% - 10px)", 200, 90, false},
+		{"height", "12pt", 0, 16, false},
+		{"margin-left", "auto", 0, 0, true},
+		{"margin-left", "-4px", 0, -4, false},
+		{"padding-top", "auto", 0, 0, false},
+		{"border-top-width", "thick", 0, 5, false},
+		{"border-top-width", "1px", 0, 1, false},
+		{"border-bottom-width", "2px", 0, 0, false}, // border-bottom-style: none
+		{"border-spacing", "2px", 0, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property+" "+tt.value, func(t *testing.T) {
+			cs := ComputeStyle(map[string]string{tt.property: tt.value, "border-top-style": "solid"})
+			length := map[string]Length{
+				"width":               cs.Width,
+				"height":              cs.Height,
+				"margin-left":         cs.Margin.Left,
+				"padding-top":         cs.Padding.Top,
+				"border-top-width":    cs.BorderWidth.Top,
+				"border-bottom-width": cs.BorderWidth.Bottom,
+				"border-spacing":      cs.BorderSpacing,
+			}[tt.property]
+			px, ok := length.Resolve(tt.base)
+			if ok == tt.auto || px != tt.expected {
+				t.Errorf("Expected %v (auto %v), got %v (auto %v)", tt.expected, tt.auto, px, !ok)
+			}
+		})
+	}
+}
+
+// TestComputeStyleColors tests computed colors, currentcolor and the
+// 'background' shorthand's color and image.
+// CSS 2.1 §14, CSS Color Level 4 §6.4
+func TestComputeStyleColors(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	tests := []struct {
+		name       string
+		styles     map[string]string
+		color      color.RGBA
+		border     color.RGBA
+		background color.RGBA
+		image      string
+	}{
+		{"initial", map[string]string{}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{}, ""},
+		{"border currentcolor", map[string]string{"color": "red"}, red, red, color.RGBA{}, ""},
+		{"background-color", map[string]string{"background-color": "white"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, white, ""},
+		{"invalid background-color", map[string]string{"background-color": "none"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{}, ""},
+		{"background color", map[string]string{"background": "#fff"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, white, ""},
+		{"background image", map[string]string{"background": "url('a.png') no-repeat"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{}, "a.png"},
+		{"background-image", map[string]string{"background-image": "url( \"b.svg\" )"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{}, "b.svg"},
+		{"empty url", map[string]string{"background-image": "url()"}, color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}, color.RGBA{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := ComputeStyle(tt.styles)
+			if cs.Color != tt.color || cs.BorderColor.Left != tt.border || cs.BackgroundColor != tt.background || cs.BackgroundImage != tt.image {
+				t.Errorf("Expected color %v, border %v, background %v %q, got %v, %v, %v %q",
+					tt.color, tt.border, tt.background, tt.image, cs.Color, cs.BorderColor.Left, cs.BackgroundColor, cs.BackgroundImage)
+			}
+		})
+	}
+}
+
+// TestStyleTreeComputedStyle tests that StyleTree computes the style of
+// elements, inheriting typed values and keeping keywords initial where
+// they are invalid.
+// CSS 2.1 §6.1.2 Computed values, §6.2 Inheritance
+func TestStyleTreeComputedStyle(t *testing.T) {
+	stylesheet := css.Parse(`
+		div { font-size: 20px; color: blue; text-align: center; float: sideways; }
+		p { width: 50%; padding: 1em; }
+	`)
+	doc := html.Parse(`<html><body><div><p>text</p></div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	p := findStyledNode(styled, "p")
+	if p == nil {
+		t.Fatal("No styled node for <p>")
+	}
+	cs := p.Style()
+	if cs.Font.Size != 20 || cs.Color != (color.RGBA{0, 0, 255, 255}) || cs.TextAlign != "center" {
+		t.Errorf("Expected inherited font size, color and text-align, got %v, %v, %q", cs.Font.Size, cs.Color, cs.TextAlign)
+	}
+	if px, _ := cs.Width.Resolve(300); px != 150 {
+		t.Errorf("Expected width of 150px, got %v", px)
+	}
+	if px, _ := cs.Padding.Left.Resolve(0); px != 20 {
+		t.Errorf("Expected padding of 20px, got %v", px)
+	}
+	if cs.Display != "block" || cs.Float != "none" {
+		t.Errorf("Expected display block and float none, got %q, %q", cs.Display, cs.Float)
+	}
+	if div := findStyledNode(styled, "div"); div.Style().Float != "none" {
+		t.Errorf("Expected an invalid float to compute to none, got %q", div.Style().Float)
+	}
+	if text := p.Children[0]; text.Style().Font.Size != 20 {
+		t.Errorf("Expected text to inherit the font size, got %v", text.Style().Font.Size)
+	}
+}
+
+// TestResolveCSSURLsComputedStyle tests that resolving URLs updates the
+// computed style, including the one elements sharing styles share.
+// HTML5 §2.5.1 Resolving URLs
+func TestResolveCSSURLsComputedStyle(t *testing.T) {
+	stylesheet := css.Parse(`
+		li { background: url(img/a.png) no-repeat; }
+		p { background-image: url("b.png"); }
+	`)
+	doc := html.Parse(`<html><body><ul><li>one</li><li>two</li></ul><p>text</p></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+	ResolveCSSURLs(styled, "http://example.com/dir/page.html")
+
+	ul := findStyledNode(styled, "ul")
+	for i, li := range ul.Children {
+		if li.PseudoElement != "" {
+			continue
+		}
+		if got := li.Style().BackgroundImage; got != "http://example.com/dir/img/a.png" {
+			t.Errorf("Item %d: expected a resolved background image, got %q", i, got)
+		}
+	}
+	if got := findStyledNode(styled, "p").Style().BackgroundImage; got != "http://example.com/dir/b.png" {
+		t.Errorf("Expected a resolved background image, got %q", got)
+	}
+}
@@ -0,0 +1,315 @@
+package style
+
+import (
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// contentGenerator fills in the children of ::marker, ::before and ::after
+// nodes. Counter values and quote nesting depend on everything that precedes
+// a pseudo-element in document order, so the styled tree is walked once,
+// in order, after the cascade.
+// CSS 2.1 §12.2 The 'content' property, §12.3 Quotation marks,
+// §12.4 Automatic counters and numbering, CSS Lists Level 3 §4
+type contentGenerator struct {
+	// counters holds the nested instances of each counter, innermost last.
+	counters map[string][]*counter
+
+	// quoteDepth is the current nesting level of open-quote/close-quote.
+	quoteDepth int
+}
+
+// counter is a single instance of a named counter.
+type counter struct {
+	value int
+
+	// reversed counters are implicitly decremented by list items.
+	// CSS Lists Level 3 §4.4 Creating counters: the counter-reset property
+	reversed bool
+}
+
+// listItemCounter is the counter implicitly incremented by list items and
+// shown in their markers.
+// CSS Lists Level 3 §4.6 The implicit list-item counter
+const listItemCounter = "list-item"
+
+// generateContent resolves 'content' for every pseudo-element in the tree.
+func generateContent(root *StyledNode) {
+	g := &contentGenerator{counters: make(map[string][]*counter)}
+	g.walk(root, make(map[string]bool))
+}
+
+// walk visits styled and its subtree in document order. scope records the
+// counters instantiated by styled and its siblings; they stay visible to
+// later siblings and are discarded when the parent's subtree is finished.
+// CSS 2.1 §12.4.1 Nested counters and scope
+func (g *contentGenerator) walk(styled *StyledNode, scope map[string]bool) {
+	if styled.Node != nil && styled.Node.Type == dom.ElementNode {
+		// CSS 2.1 §12.4.3: Elements that are not displayed do not
+		// increment or reset counters
+		if styled.Style().Display == "none" {
+			return
+		}
+		g.updateCounters(styled, scope)
+	}
+
+	if styled.PseudoElement != "" {
+		g.generate(styled, scope)
+	}
+
+	childScope := make(map[string]bool)
+	for _, child := range styled.Children {
+		g.walk(child, childScope)
+	}
+	for name := range childScope {
+		stack := g.counters[name]
+		g.counters[name] = stack[:len(stack)-1]
+	}
+}
+
+// updateCounters applies 'counter-reset', 'counter-increment' and
+// 'counter-set', in that order.
+// CSS 2.1 §12.4 Automatic counters and numbering,
+// CSS Lists Level 3 §4.5 Nested counters and scope
+func (g *contentGenerator) updateCounters(styled *StyledNode, scope map[string]bool) {
+	styles := styled.Styles
+
+	for _, reset := range css.ParseCounterChanges(styles["counter-reset"], 0) {
+		value := reset.Value
+		if reset.Auto {
+			// CSS Lists Level 3 §4.4.2: A reversed counter without a
+			// value starts so that the last item in its scope is 1
+			value = countIncrementers(styled, reset.Name) + 1
+		}
+		g.instantiate(reset.Name, value, reset.Reversed, scope)
+	}
+
+	increments := css.ParseCounterChanges(styles["counter-increment"], 1)
+	implicitListItem := styled.Style().Display == "list-item"
+	for _, increment := range increments {
+		if increment.Name == listItemCounter {
+			implicitListItem = false
+		}
+		g.increment(increment.Name, increment.Value, scope)
+	}
+
+	// CSS Lists Level 3 §4.6: List items increment list-item by one, or
+	// by minus one in a reversed counter, unless 'counter-increment'
+	// already mentions it
+	if implicitListItem {
+		step := 1
+		if stack := g.counters[listItemCounter]; len(stack) > 0 && stack[len(stack)-1].reversed {
+			step = -1
+		}
+		g.increment(listItemCounter, step, scope)
+	}
+
+	for _, set := range css.ParseCounterChanges(styles["counter-set"], 0) {
+		if len(g.counters[set.Name]) == 0 {
+			g.instantiate(set.Name, 0, false, scope)
+		}
+		g.current(set.Name).value = set.Value
+	}
+}
+
+// increment adds delta to the innermost instance of a counter.
+// CSS 2.1 §12.4: Incrementing a counter that is not in scope behaves as if
+// the element had reset it to 0 first
+func (g *contentGenerator) increment(name string, delta int, scope map[string]bool) {
+	if len(g.counters[name]) == 0 {
+		g.instantiate(name, 0, false, scope)
+	}
+	g.current(name).value += delta
+}
+
+// current returns the innermost instance of a counter. The caller ensures
+// the counter is in scope.
+func (g *contentGenerator) current(name string) *counter {
+	stack := g.counters[name]
+	return stack[len(stack)-1]
+}
+
+// instantiate creates a new counter instance scoped to the current element
+// and its following siblings. A sibling that already reset the counter in
+// this scope has its instance reused rather than nested.
+func (g *contentGenerator) instantiate(name string, value int, reversed bool, scope map[string]bool) {
+	if scope[name] {
+		c := g.current(name)
+		c.value = value
+		c.reversed = reversed
+		return
+	}
+	g.counters[name] = append(g.counters[name], &counter{value: value, reversed: reversed})
+	scope[name] = true
+}
+
+// valueOf returns the innermost value of a counter for counter() and
+// markers, instantiating it at 0 on the current element if none is in scope.
+func (g *contentGenerator) valueOf(name string, scope map[string]bool) int {
+	if len(g.counters[name]) == 0 {
+		g.instantiate(name, 0, false, scope)
+	}
+	return g.current(name).value
+}
+
+// countIncrementers counts the children of styled that increment the named
+// counter, explicitly or as list items.
+func countIncrementers(styled *StyledNode, name string) int {
+	count := 0
+	for _, child := range styled.Children {
+		if child.Node == nil || child.Node.Type != dom.ElementNode || child.Style().Display == "none" {
+			continue
+		}
+		explicit := false
+		for _, increment := range css.ParseCounterChanges(child.Styles["counter-increment"], 1) {
+			if increment.Name == name {
+				explicit = true
+			}
+		}
+		if explicit || (name == listItemCounter && child.Style().Display == "list-item") {
+			count++
+		}
+	}
+	return count
+}
+
+// generate builds the children of a ::marker, ::before or ::after node from
+// its 'content' value. Adjacent textual items are merged into one text node;
+// url() items become img elements. Markers with 'content: normal' fall back
+// to the list style.
+// CSS 2.1 §12.2 The 'content' property
+func (g *contentGenerator) generate(pseudo *StyledNode, scope map[string]bool) {
+	items, ok := css.ParseContent(pseudo.Styles["content"])
+	if !ok {
+		if pseudo.PseudoElement == "marker" {
+			g.generateMarker(pseudo, scope)
+		}
+		return
+	}
+	element := pseudo.Node.Parent
+	quotes := css.ParseQuotes(pseudo.Styles["quotes"])
+
+	var text strings.Builder
+	flush := func() {
+		if text.Len() == 0 {
+			return
+		}
+		textNode := dom.NewText(text.String())
+		pseudo.Node.AppendChild(textNode)
+		styles := inheritStyles(pseudo.Styles)
+		pseudo.Children = append(pseudo.Children, &StyledNode{
+			Node:     textNode,
+			Styles:   styles,
+			Children: make([]*StyledNode, 0),
+			computed: ComputeStyle(styles),
+		})
+		text.Reset()
+	}
+
+	for _, item := range items {
+		switch item.Kind {
+		case css.ContentString:
+			text.WriteString(item.Value)
+		case css.ContentAttr:
+			// CSS 2.1 §12.2: attr(X) is the empty string if the
+			// element has no attribute X
+			if element != nil {
+				text.WriteString(element.GetAttribute(item.Value))
+			}
+		case css.ContentCounter:
+			text.WriteString(css.FormatCounter(g.valueOf(item.Value, scope), item.Style))
+		case css.ContentCounters:
+			g.valueOf(item.Value, scope)
+			for i, c := range g.counters[item.Value] {
+				if i > 0 {
+					text.WriteString(item.Separator)
+				}
+				text.WriteString(css.FormatCounter(c.value, item.Style))
+			}
+		case css.ContentOpenQuote:
+			// CSS 2.1 §12.3.2: Levels deeper than the 'quotes' list
+			// use the last pair
+			if len(quotes) > 0 {
+				text.WriteString(quotes[min(g.quoteDepth, len(quotes)-1)][0])
+			}
+			g.quoteDepth++
+		case css.ContentCloseQuote:
+			if g.quoteDepth > 0 {
+				g.quoteDepth--
+				if len(quotes) > 0 {
+					text.WriteString(quotes[min(g.quoteDepth, len(quotes)-1)][1])
+				}
+			}
+		case css.ContentNoOpenQuote:
+			g.quoteDepth++
+		case css.ContentNoCloseQuote:
+			if g.quoteDepth > 0 {
+				g.quoteDepth--
+			}
+		case css.ContentURL:
+			flush()
+			appendGeneratedImage(pseudo, item.Value)
+		}
+	}
+	flush()
+}
+
+// generateMarker builds the default contents of a ::marker: the
+// 'list-style-image' if there is one, otherwise the list-item counter in the
+// 'list-style-type'. Bullet styles get no text; the renderer paints them.
+// CSS Lists Level 3 §3.1 The ::marker pseudo-element
+func (g *contentGenerator) generateMarker(marker *StyledNode, scope map[string]bool) {
+	if image := marker.Styles["list-style-image"]; strings.HasPrefix(image, "url(") {
+		items, ok := css.ParseContent(image)
+		if ok && items[0].Kind == css.ContentURL {
+			appendGeneratedImage(marker, items[0].Value)
+			return
+		}
+	}
+
+	listStyleType := listStyleTypeOf(marker.Styles)
+	if css.IsBulletStyle(listStyleType) {
+		return
+	}
+	text := css.ListMarkerText(g.valueOf(listItemCounter, scope), listStyleType)
+	if text == "" {
+		return
+	}
+
+	textNode := dom.NewText(text)
+	marker.Node.AppendChild(textNode)
+	styles := inheritStyles(marker.Styles)
+	marker.Children = append(marker.Children, &StyledNode{
+		Node:     textNode,
+		Styles:   styles,
+		Children: make([]*StyledNode, 0),
+		computed: ComputeStyle(styles),
+	})
+}
+
+// appendGeneratedImage adds an img child for url() content to a generated node.
+func appendGeneratedImage(pseudo *StyledNode, src string) {
+	img := dom.NewElement("img")
+	img.SetAttribute("src", src)
+	pseudo.Node.AppendChild(img)
+	styles := inheritStyles(pseudo.Styles)
+	styles["display"] = "inline"
+	pseudo.Children = append(pseudo.Children, &StyledNode{
+		Node:     img,
+		Styles:   styles,
+		Children: make([]*StyledNode, 0),
+		computed: ComputeStyle(styles),
+	})
+}
+
+// listStyleTypeOf returns the 'list-style-type' of styles, defaulting to its
+// initial value 'disc'.
+// CSS 2.1 §12.6.2 Lists: the 'list-style-type' property
+func listStyleTypeOf(styles map[string]string) string {
+	if listStyleType := strings.ToLower(strings.TrimSpace(styles["list-style-type"])); listStyleType != "" {
+		return listStyleType
+	}
+	return "disc"
+}
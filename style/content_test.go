@@ -0,0 +1,407 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// generatedText returns the text generated for the ::before or ::after child
+// of styled, and whether that pseudo-element exists.
+func generatedText(styled *StyledNode, pseudo string) (string, bool) {
+	for _, child := range styled.Children {
+		if child.PseudoElement != pseudo {
+			continue
+		}
+		text := ""
+		for _, grandchild := range child.Children {
+			if grandchild.Node.Type == dom.TextNode {
+				text += grandchild.Node.Data
+			}
+		}
+		return text, true
+	}
+	return "", false
+}
+
+// TestBeforeAfterContent tests generation of ::before and ::after nodes.
+// CSS 2.1 §12.1 The :before and :after pseudo-elements
+func TestBeforeAfterContent(t *testing.T) {
+	doc := dom.NewDocument()
+	p := dom.NewElement("p")
+	p.SetAttribute("title", "Note")
+	p.AppendChild(dom.NewText("body"))
+	doc.AppendChild(p)
+
+	stylesheet := css.Parse(`
+		p { color: red; }
+		p::before { content: attr(title) ": "; font-weight: bold; }
+		p::after { content: "!"; display: block; }
+	`)
+	styled := StyleTree(doc, stylesheet).Children[0]
+
+	if len(styled.Children) != 3 {
+		t.Fatalf("Expected ::before, text and ::after children, got %d", len(styled.Children))
+	}
+	before, after := styled.Children[0], styled.Children[2]
+
+	if before.PseudoElement != "before" || before.Node.Data != "::before" || before.Node.Parent != p {
+		t.Errorf("First child is not the ::before of <p>: %+v", before)
+	}
+	if text, _ := generatedText(styled, "before"); text != "Note: " {
+		t.Errorf("Expected ::before text %q, got %q", "Note: ", text)
+	}
+	if before.Styles["display"] != "inline" {
+		t.Errorf("Expected ::before to default to display inline, got %q", before.Styles["display"])
+	}
+	if before.Styles["color"] != "red" {
+		t.Errorf("Expected ::before to inherit color from <p>, got %q", before.Styles["color"])
+	}
+	if before.Children[0].Styles["font-weight"] != "bold" {
+		t.Errorf("Expected generated text to inherit font-weight, got %q", before.Children[0].Styles["font-weight"])
+	}
+
+	if after.PseudoElement != "after" || after.Styles["display"] != "block" {
+		t.Errorf("Expected block ::after as last child, got %+v", after)
+	}
+
+	// Pseudo-element declarations must not leak onto the element itself
+	if _, ok := styled.Styles["content"]; ok {
+		t.Errorf("Expected <p> to have no content property, got %q", styled.Styles["content"])
+	}
+	if styled.Styles["font-weight"] != "" {
+		t.Errorf("Expected <p> font-weight unset, got %q", styled.Styles["font-weight"])
+	}
+}
+
+// TestNoGeneratedContent tests that 'none', 'normal' and missing content
+// generate no pseudo-element.
+func TestNoGeneratedContent(t *testing.T) {
+	for _, rule := range []string{
+		"p::before { color: red; }",
+		"p::before { content: none; }",
+		"p::before { content: normal; }",
+		"div p::before, p::before span { content: 'x'; }",
+	} {
+		t.Run(rule, func(t *testing.T) {
+			doc := dom.NewDocument()
+			doc.AppendChild(dom.NewElement("p"))
+
+			styled := StyleTree(doc, css.Parse(rule)).Children[0]
+			if len(styled.Children) != 0 {
+				t.Errorf("Expected no generated children, got %d", len(styled.Children))
+			}
+		})
+	}
+}
+
+// TestCounterContent tests counter-reset, counter-increment, counter() and
+// counters() with nested scopes.
+// CSS 2.1 §12.4 Automatic counters and numbering
+func TestCounterContent(t *testing.T) {
+	// ol > (li, li > ol > (li, li), li)
+	doc := dom.NewDocument()
+	outer := dom.NewElement("ol")
+	doc.AppendChild(outer)
+	items := make([]*dom.Node, 0)
+	for i := 0; i < 3; i++ {
+		li := dom.NewElement("li")
+		outer.AppendChild(li)
+		items = append(items, li)
+	}
+	inner := dom.NewElement("ol")
+	items[1].AppendChild(inner)
+	for i := 0; i < 2; i++ {
+		inner.AppendChild(dom.NewElement("li"))
+	}
+
+	stylesheet := css.Parse(`
+		ol { counter-reset: item; }
+		li { counter-increment: item; list-style: none; }
+		li::before { content: counters(item, ".") " "; }
+		li::after { content: counter(item, lower-roman); }
+	`)
+	styled := StyleTree(doc, stylesheet)
+
+	outerStyled := styled.Children[0]
+	expected := []string{"1 ", "2 ", "3 "}
+	for i, li := range outerStyled.Children {
+		if text, _ := generatedText(li, "before"); text != expected[i] {
+			t.Errorf("Outer item %d: expected %q, got %q", i, expected[i], text)
+		}
+	}
+
+	innerStyled := outerStyled.Children[1].Children[1]
+	expected = []string{"2.1 ", "2.2 "}
+	for i, li := range innerStyled.Children {
+		if text, _ := generatedText(li, "before"); text != expected[i] {
+			t.Errorf("Inner item %d: expected %q, got %q", i, expected[i], text)
+		}
+	}
+
+	if text, _ := generatedText(outerStyled.Children[2], "after"); text != "iii" {
+		t.Errorf("Expected lower-roman counter %q, got %q", "iii", text)
+	}
+}
+
+// TestQuoteContent tests open-quote and close-quote nesting.
+// CSS 2.1 §12.3 Quotation marks
+func TestQuoteContent(t *testing.T) {
+	doc := dom.NewDocument()
+	outer := dom.NewElement("q")
+	inner := dom.NewElement("q")
+	outer.AppendChild(inner)
+	doc.AppendChild(outer)
+
+	stylesheet := css.Parse(`
+		q { quotes: "«" "»" "‹" "›"; }
+		q::before { content: open-quote; }
+		q::after { content: close-quote; }
+	`)
+	styled := StyleTree(doc, stylesheet)
+
+	outerStyled := styled.Children[0]
+	innerStyled := outerStyled.Children[1]
+
+	checks := []struct {
+		node     *StyledNode
+		pseudo   string
+		expected string
+	}{
+		{outerStyled, "before", "«"},
+		{innerStyled, "before", "‹"},
+		{innerStyled, "after", "›"},
+		{outerStyled, "after", "»"},
+	}
+	for _, check := range checks {
+		if text, _ := generatedText(check.node, check.pseudo); text != check.expected {
+			t.Errorf("Expected %s quote %q, got %q", check.pseudo, check.expected, text)
+		}
+	}
+}
+
+// TestURLContent tests that url() generates an img child and is resolved
+// against the document base URL.
+func TestURLContent(t *testing.T) {
+	doc := dom.NewDocument()
+	doc.AppendChild(dom.NewElement("p"))
+
+	styled := StyleTree(doc, css.Parse(`p::before { content: url("icon.png") "x"; }`))
+	ResolveCSSURLs(styled, "http://example.com/dir/page.html")
+
+	before := styled.Children[0].Children[0]
+	if len(before.Children) != 2 {
+		t.Fatalf("Expected img and text children, got %d", len(before.Children))
+	}
+	img := before.Children[0].Node
+	if img.Data != "img" || img.GetAttribute("src") != "http://example.com/dir/icon.png" {
+		t.Errorf("Expected img with resolved src, got <%s src=%q>", img.Data, img.GetAttribute("src"))
+	}
+}
+
+// markerText returns the text of a list item's ::marker.
+func markerText(styled *StyledNode) string {
+	text, _ := generatedText(styled, "marker")
+	return text
+}
+
+// TestListMarkers tests ::marker generation and HTML list numbering.
+// CSS Lists Level 3 §3-§4, HTML5 §4.4.5 The ol element, §4.4.8 The li element
+func TestListMarkers(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     func() *dom.Node
+		css      string
+		expected []string
+	}{
+		{
+			name:     "decimal",
+			list:     func() *dom.Node { return newList("ol", 3) },
+			expected: []string{"1. ", "2. ", "3. "},
+		},
+		{
+			name: "start",
+			list: func() *dom.Node {
+				ol := newList("ol", 2)
+				ol.SetAttribute("start", "5")
+				return ol
+			},
+			expected: []string{"5. ", "6. "},
+		},
+		{
+			name: "li value",
+			list: func() *dom.Node {
+				ol := newList("ol", 3)
+				ol.Children[1].SetAttribute("value", "10")
+				return ol
+			},
+			expected: []string{"1. ", "10. ", "11. "},
+		},
+		{
+			name: "reversed",
+			list: func() *dom.Node {
+				ol := newList("ol", 3)
+				ol.SetAttribute("reversed", "")
+				return ol
+			},
+			expected: []string{"3. ", "2. ", "1. "},
+		},
+		{
+			name: "reversed with start",
+			list: func() *dom.Node {
+				ol := newList("ol", 2)
+				ol.SetAttribute("reversed", "")
+				ol.SetAttribute("start", "10")
+				return ol
+			},
+			expected: []string{"10. ", "9. "},
+		},
+		{
+			name: "type attribute",
+			list: func() *dom.Node {
+				ol := newList("ol", 2)
+				ol.SetAttribute("type", "A")
+				return ol
+			},
+			expected: []string{"A. ", "B. "},
+		},
+		{
+			// HTML §15.3.8: type is a presentational hint, which author
+			// rules override
+			name: "author rule over type attribute",
+			list: func() *dom.Node {
+				ol := newList("ol", 2)
+				ol.SetAttribute("type", "a")
+				return ol
+			},
+			css:      "ol { list-style-type: decimal; }",
+			expected: []string{"1. ", "2. "},
+		},
+		{
+			name: "author counter-reset over start",
+			list: func() *dom.Node {
+				ol := newList("ol", 2)
+				ol.SetAttribute("start", "5")
+				return ol
+			},
+			css:      "ol { counter-reset: list-item 2; }",
+			expected: []string{"3. ", "4. "},
+		},
+		{
+			name:     "list-style-type",
+			list:     func() *dom.Node { return newList("ol", 4) },
+			css:      "ol { list-style-type: lower-roman; }",
+			expected: []string{"i. ", "ii. ", "iii. ", "iv. "},
+		},
+		{
+			name:     "counter-set",
+			list:     func() *dom.Node { return newList("ol", 2) },
+			css:      "li { counter-set: list-item 7; }",
+			expected: []string{"7. ", "7. "},
+		},
+		{
+			name:     "marker content",
+			list:     func() *dom.Node { return newList("ol", 2) },
+			css:      `li::marker { content: "(" counter(list-item) ") "; }`,
+			expected: []string{"(1) ", "(2) "},
+		},
+		{
+			// The last declaration of a block may omit its ';'
+			name: "display list-item without semicolon",
+			list: func() *dom.Node {
+				ol := dom.NewElement("ol")
+				ol.AppendChild(dom.NewElement("p"))
+				ol.AppendChild(dom.NewElement("p"))
+				return ol
+			},
+			css:      "p { display: list-item }",
+			expected: []string{"1. ", "2. "},
+		},
+		{
+			name:     "display none without semicolon",
+			list:     func() *dom.Node { return newList("ol", 3) },
+			css:      "li:nth-child(2) { counter-increment: list-item; display: none }",
+			expected: []string{"1. ", "", "2. "},
+		},
+		{
+			name:     "bullets have no text",
+			list:     func() *dom.Node { return newList("ul", 1) },
+			expected: []string{""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument()
+			doc.AppendChild(tt.list())
+
+			styled := StyleTree(doc, css.Parse(tt.css))
+			for i, li := range styled.Children[0].Children {
+				if li.PseudoElement != "" {
+					continue
+				}
+				if got := markerText(li); got != tt.expected[i] {
+					t.Errorf("Item %d: expected marker %q, got %q", i, tt.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+// TestNoListMarker tests that list-style-type none and content none suppress
+// the marker, and that non-list-items get none.
+func TestNoListMarker(t *testing.T) {
+	for _, rule := range []string{
+		"li { list-style-type: none; }",
+		"ul { list-style: none; }",
+		"li::marker { content: none; }",
+		"li { display: block; }",
+	} {
+		t.Run(rule, func(t *testing.T) {
+			doc := dom.NewDocument()
+			doc.AppendChild(newList("ul", 1))
+
+			styled := StyleTree(doc, css.Parse(rule))
+			if _, ok := generatedText(styled.Children[0].Children[0], "marker"); ok {
+				t.Errorf("Expected no ::marker")
+			}
+		})
+	}
+}
+
+// TestNestedListStyleTypes tests the user-agent bullet styles of nested lists.
+// HTML5 §15.3.8 Lists
+func TestNestedListStyleTypes(t *testing.T) {
+	doc := dom.NewDocument()
+	outer := newList("ul", 1)
+	middle := newList("ul", 1)
+	inner := newList("ul", 1)
+	outer.Children[0].AppendChild(middle)
+	middle.Children[0].AppendChild(inner)
+	doc.AppendChild(outer)
+
+	styled := StyleTree(doc, css.Parse(""))
+
+	expected := []string{"disc", "circle", "square"}
+	list := styled.Children[0]
+	for depth := 0; depth < 3; depth++ {
+		li := list.Children[0]
+		marker := li.Children[0]
+		if marker.PseudoElement != "marker" || marker.Styles["list-style-type"] != expected[depth] {
+			t.Errorf("Depth %d: expected %s marker, got %q %q", depth, expected[depth], marker.PseudoElement, marker.Styles["list-style-type"])
+		}
+		if depth < 2 {
+			list = li.Children[1]
+		}
+	}
+}
+
+// newList creates a list element with n empty li children.
+func newList(tag string, n int) *dom.Node {
+	list := dom.NewElement(tag)
+	for i := 0; i < n; i++ {
+		list.AppendChild(dom.NewElement("li"))
+	}
+	return list
+}
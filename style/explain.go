@@ -0,0 +1,328 @@
+package style
+
+// This file explains where the styles of an element come from, as the
+// Styles pane of browser developer tools does: the rules matching the
+// element in cascade order, and for every property its computed value and
+// the declaration, attribute or parent it was taken from. The cascades of
+// the explained elements are traced while the document is styled once as
+// usual, so the explanations cannot drift from what styling does.
+//
+// Spec references:
+// - CSS 2.1 §6.4.1 Cascading order: https://www.w3.org/TR/CSS21/cascade.html#cascading-order
+// - CSS 2.1 §6.4.4 Precedence of non-CSS presentational hints: https://www.w3.org/TR/CSS21/cascade.html#preshint
+// - CSS Cascading Level 4 §4.2 Cascaded values: https://www.w3.org/TR/css-cascade-4/#cascaded
+//
+// Implemented:
+// - Matched rules with their selector, origin, specificity and location
+// - Explaining many elements with a single styling of the document
+// - The winning declaration of every property, including the longhands of
+//   shorthands and properties set by CSS-wide keywords
+// - Values taken from presentational attributes, inherited from the
+//   parent, or left at their initial value
+//
+// Not implemented:
+// - Explaining pseudo-elements
+// - Which attribute a presentational hint comes from
+
+import (
+	"maps"
+	"sort"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// Explanation describes how the styles of an element were computed.
+type Explanation struct {
+	Node *dom.Node
+
+	// Rules are the rules matching the element sorted by origin and
+	// specificity: the normal declarations of a rule win over those of
+	// the rules before it, and important declarations over normal ones
+	// in the reverse order of origins.
+	Rules []MatchedRule
+
+	// InlineStyle holds the declarations of the element's style
+	// attribute, which win over every rule.
+	InlineStyle []*css.Declaration
+
+	// Properties holds every property of the registry and every custom
+	// property the element has, sorted by name.
+	Properties []PropertyValue
+}
+
+// PropertyValue is the computed value of a property and where it comes
+// from.
+type PropertyValue struct {
+	Name string
+
+	// Value is the computed value as StyledNode.Styles holds it, or the
+	// initial value, which is empty where it depends on the user agent.
+	Value string
+
+	Source ValueSource
+
+	// Declaration is the declaration giving the value, if Source is
+	// SourceRule or SourceInlineStyle. Its value is the specified one.
+	Declaration *css.Declaration
+
+	// Rule is the rule holding Declaration, if Source is SourceRule.
+	Rule *MatchedRule
+}
+
+// ValueSource is where the cascade took a property's value from.
+type ValueSource int
+
+const (
+	// SourceInitial is the property's initial value.
+	// CSS 2.1 §6.1.1 Specified values
+	SourceInitial ValueSource = iota
+	// SourceInherited is the parent's computed value.
+	// CSS 2.1 §6.2 Inheritance
+	SourceInherited
+	// SourceRule is a declaration of a matching rule.
+	SourceRule
+	// SourceInlineStyle is a declaration of the style attribute.
+	SourceInlineStyle
+	// SourceAttribute is a presentational attribute such as width or
+	// cellpadding.
+	// CSS 2.1 §6.4.4 Precedence of non-CSS presentational hints
+	SourceAttribute
+)
+
+// String returns the source as DevTools-like text.
+func (s ValueSource) String() string {
+	switch s {
+	case SourceInherited:
+		return "inherited"
+	case SourceRule:
+		return "rule"
+	case SourceInlineStyle:
+		return "style attribute"
+	case SourceAttribute:
+		return "presentational attribute"
+	default:
+		return "initial"
+	}
+}
+
+// Applied reports whether decl gives at least one property its value, as
+// opposed to being overridden.
+func (e *Explanation) Applied(decl *css.Declaration) bool {
+	for _, property := range e.Properties {
+		if property.Declaration == decl {
+			return true
+		}
+	}
+	return false
+}
+
+// Property returns the value of the named property, or nil if the element
+// has no such property.
+func (e *Explanation) Property(name string) *PropertyValue {
+	i := sort.Search(len(e.Properties), func(i int) bool {
+		return e.Properties[i].Name >= name
+	})
+	if i < len(e.Properties) && e.Properties[i].Name == name {
+		return &e.Properties[i]
+	}
+	return nil
+}
+
+// ExplainStyle styles the document root like StyleTreeWithOptions and
+// explains the styles of node, one of its elements. It returns nil if node
+// is not an element of root.
+func ExplainStyle(root *dom.Node, authorStylesheet *css.Stylesheet, opts Options, node *dom.Node) *Explanation {
+	return ExplainStyles(root, authorStylesheet, opts, []*dom.Node{node})[0]
+}
+
+// ExplainStyles styles the document root once and explains the styles of
+// each of nodes, as ExplainStyle does. The explanation of a node that is
+// not an element of root is nil.
+func ExplainStyles(root *dom.Node, authorStylesheet *css.Stylesheet, opts Options, nodes []*dom.Node) []*Explanation {
+	traces := make(map[*dom.Node]*cascadeTrace)
+	for _, node := range nodes {
+		if node != nil && node.Type == dom.ElementNode {
+			traces[node] = &cascadeTrace{
+				node:         node,
+				declarations: make(map[string]*css.Declaration),
+				attributes:   make(map[string]bool),
+			}
+		}
+	}
+
+	explanations := make([]*Explanation, len(nodes))
+	if len(traces) == 0 {
+		return explanations
+	}
+	// An element sharing the styles of another is not cascaded
+	opts.DisableStyleSharing = true
+	styled := styleTree(root, authorStylesheet, opts, traces)
+	for i, node := range nodes {
+		if trace := traces[node]; trace != nil {
+			explanations[i] = explain(trace, styledNodeOf(styled, node))
+		}
+	}
+	return explanations
+}
+
+// explain builds the explanation of the element whose cascade trace
+// recorded and whose styled node is styled. It returns nil if the element
+// was not styled.
+func explain(trace *cascadeTrace, styled *StyledNode) *Explanation {
+	if styled == nil || trace.parent == nil {
+		return nil
+	}
+
+	e := &Explanation{Node: trace.node, Rules: trace.matched, InlineStyle: trace.inline}
+	rules := make(map[*css.Declaration]*MatchedRule)
+	for i := range e.Rules {
+		for _, decl := range e.Rules[i].Rule.Declarations {
+			rules[decl] = &e.Rules[i]
+		}
+	}
+
+	names := make([]string, 0, len(propertyTable)+len(styled.Styles))
+	for _, property := range propertyTable {
+		names = append(names, property.Name)
+	}
+	for name := range styled.Styles {
+		if css.IsCustomProperty(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property := PropertyValue{Name: name}
+		value, ok := styled.Styles[name]
+		if !ok {
+			// A declaration may also leave a property at its initial
+			// value, e.g. 'inherit' when the parent has none
+			if p := LookupProperty(name); p != nil {
+				value = p.Initial
+			}
+		}
+		switch {
+		case trace.declarations[name] != nil:
+			property.Declaration = trace.declarations[name]
+			property.Rule = rules[property.Declaration]
+			property.Source = SourceInlineStyle
+			if property.Rule != nil {
+				property.Source = SourceRule
+			}
+		case trace.attributes[name]:
+			property.Source = SourceAttribute
+		case ok && (css.IsCustomProperty(name) || isInheritedProperty(name)) && trace.parent[name] == value:
+			property.Source = SourceInherited
+		}
+		property.Value = value
+		e.Properties = append(e.Properties, property)
+	}
+	return e
+}
+
+// styledNodeOf returns the styled node of the element node, or nil.
+func styledNodeOf(styled *StyledNode, node *dom.Node) *StyledNode {
+	if styled.Node == node && styled.PseudoElement == "" {
+		return styled
+	}
+	for _, child := range styled.Children {
+		if found := styledNodeOf(child, node); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// cascadeTrace records the cascade of one element: what it matched, and
+// which declaration or attribute last set each property. All methods do
+// nothing on a nil trace, which is what every other element gets.
+type cascadeTrace struct {
+	node *dom.Node
+
+	parent  map[string]string
+	matched []MatchedRule
+	inline  []*css.Declaration
+
+	// declarations holds the declaration that last set each property.
+	declarations map[string]*css.Declaration
+
+	// attributes holds the properties last set by an attribute.
+	attributes map[string]bool
+
+	// before holds the styles at the last snapshot.
+	before map[string]string
+}
+
+// traceOf returns the trace of node's cascade, or nil if node is not
+// being explained.
+func (ctx *styleContext) traceOf(node *dom.Node) *cascadeTrace {
+	return ctx.traces[node]
+}
+
+// cascaded records the parent styles, matched rules and inline style of
+// the element, and the winning declarations of its custom properties,
+// which cascadeCustomProperties takes in the same order.
+func (t *cascadeTrace) cascaded(ctx *styleContext, parent map[string]string, matched []MatchedRule, inline []*css.Declaration) {
+	if t == nil {
+		return
+	}
+	t.parent = parent
+	t.matched = matched
+	t.inline = inline
+	for _, d := range cascadeOrder(matched, inline) {
+		if ctx.declaresCustomProperty(d.decl) {
+			t.declared(d.decl.Property, d.decl)
+		}
+	}
+}
+
+// declared records that decl set property.
+func (t *cascadeTrace) declared(property string, decl *css.Declaration) {
+	if t == nil {
+		return
+	}
+	t.declarations[property] = decl
+	delete(t.attributes, property)
+}
+
+// declaredLonghands records that decl, a CSS-wide keyword or an invalid
+// var() substitution, set every longhand of its property.
+func (t *cascadeTrace) declaredLonghands(decl *css.Declaration) {
+	if t == nil {
+		return
+	}
+	for _, longhand := range shorthandLonghands(decl.Property) {
+		t.declared(longhand, decl)
+	}
+}
+
+// snapshot remembers styles before attributes are applied to them.
+func (t *cascadeTrace) snapshot(styles map[string]string) {
+	if t == nil {
+		return
+	}
+	t.before = maps.Clone(styles)
+}
+
+// setFromAttributes records the properties whose values changed since the
+// snapshot as set by attributes. An attribute giving a property the value
+// it already had is not noticed.
+func (t *cascadeTrace) setFromAttributes(styles map[string]string) {
+	if t == nil {
+		return
+	}
+	for name, value := range styles {
+		if before, ok := t.before[name]; !ok || before != value {
+			t.attributes[name] = true
+			delete(t.declarations, name)
+		}
+	}
+	for name := range t.before {
+		if _, ok := styles[name]; !ok {
+			t.attributes[name] = true
+			delete(t.declarations, name)
+		}
+	}
+}
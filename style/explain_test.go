@@ -0,0 +1,159 @@
+package style
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestExplainStyle tests where explanations say values come from.
+// CSS 2.1 §6.4.1 Cascading order, §6.4.4 Presentational hints, §6.2 Inheritance
+func TestExplainStyle(t *testing.T) {
+	stylesheet := css.Parse(`
+		p { color: red; margin: 1px; }
+		.a { color: green; }
+		#x { margin-left: 5px; }
+		.box { font-size: 20px; --accent: blue; }
+		p { border-top-color: inherit; }
+	`)
+	doc := html.Parse(`<html><body><div class="box"><p id="x" class="a" style="font-style: italic">text</p>` +
+		`<table cellpadding="3"><tr><td width="50">cell</td></tr></table></div></body></html>`)
+
+	tests := []struct {
+		tag      string
+		property string
+		source   ValueSource
+		selector string // the selector of the winning rule
+		origin   Origin
+		value    string // the value of the winning declaration
+	}{
+		{"p", "color", SourceRule, ".a", AuthorOrigin, "green"},
+		{"p", "margin-top", SourceRule, "p", AuthorOrigin, "1px"},
+		{"p", "margin-left", SourceRule, "#x", AuthorOrigin, "5px"},
+		{"p", "border-top-color", SourceRule, "p", AuthorOrigin, "inherit"},
+		{"p", "font-style", SourceInlineStyle, "", AuthorOrigin, "italic"},
+		{"p", "font-size", SourceInherited, "", AuthorOrigin, ""},
+		{"p", "--accent", SourceInherited, "", AuthorOrigin, ""},
+		{"p", "float", SourceInitial, "", AuthorOrigin, ""},
+		{"div", "--accent", SourceRule, ".box", AuthorOrigin, "blue"},
+		{"div", "display", SourceRule, "", UserAgentOrigin, "block"},
+		{"td", "width", SourceAttribute, "", AuthorOrigin, ""},
+		{"td", "padding-top", SourceAttribute, "", AuthorOrigin, ""},
+	}
+
+	styled := StyleTree(doc, stylesheet)
+	explanations := make(map[string]*Explanation)
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			e := explanations[tt.tag]
+			if e == nil {
+				e = ExplainStyle(doc, stylesheet, DefaultOptions(), findNode(doc, tt.tag))
+				explanations[tt.tag] = e
+			}
+			property := e.Property(tt.property)
+			if property == nil {
+				t.Fatalf("Expected %s to be explained", tt.property)
+			}
+			if property.Source != tt.source {
+				t.Errorf("Expected source %v, got %v", tt.source, property.Source)
+			}
+			if expected, ok := findStyledNode(styled, tt.tag).Styles[tt.property]; ok && property.Value != expected {
+				t.Errorf("Expected value %q, got %q", expected, property.Value)
+			}
+			if tt.value != "" && (property.Declaration == nil || strings.TrimSpace(property.Declaration.Value) != tt.value) {
+				t.Errorf("Expected the declaration of %q, got %+v", tt.value, property.Declaration)
+			}
+			if tt.source != SourceRule {
+				return
+			}
+			if property.Rule == nil || property.Rule.Origin != tt.origin {
+				t.Fatalf("Expected a rule of the %v origin, got %+v", tt.origin, property.Rule)
+			}
+			if tt.selector != "" && property.Rule.Selector.Text != tt.selector {
+				t.Errorf("Expected the rule %q, got %q", tt.selector, property.Rule.Selector.Text)
+			}
+		})
+	}
+
+	// The matched rules of <p>, in cascade order, and which of their
+	// declarations are overridden
+	p := explanations["p"]
+	var selectors []string
+	for _, rule := range p.Rules {
+		if rule.Origin == AuthorOrigin {
+			selectors = append(selectors, rule.Selector.Text)
+		}
+	}
+	if strings.Join(selectors, " ") != "p p .a #x" {
+		t.Errorf("Expected author rules p p .a #x, got %v", selectors)
+	}
+	if p.Applied(stylesheet.Rules[0].Declarations[0]) || !p.Applied(stylesheet.Rules[1].Declarations[0]) {
+		t.Error("Expected the color of .a to override the color of p")
+	}
+	if len(p.InlineStyle) != 1 || !p.Applied(p.InlineStyle[0]) {
+		t.Errorf("Expected the inline style to apply, got %v", p.InlineStyle)
+	}
+}
+
+// TestExplainStyleValues tests that explanations of all the elements of a
+// generated page, styled once, give every element the values styling
+// gives it.
+func TestExplainStyleValues(t *testing.T) {
+	doc, stylesheet := largeDocument(1)
+	opts := DefaultOptions()
+	styled := StyleTreeWithOptions(doc, stylesheet, opts)
+
+	outside := dom.NewElement("p")
+	elements := append(appendDescendantElements(nil, doc), outside)
+	explanations := ExplainStyles(doc, stylesheet, opts, elements)
+	if len(explanations) != len(elements) || explanations[len(elements)-1] != nil {
+		t.Fatalf("Expected an explanation per element, nil for one outside the document")
+	}
+	for i, element := range elements[:len(elements)-1] {
+		e := explanations[i]
+		if e == nil || e.Node != element {
+			t.Fatalf("<%s class=%q>: expected an explanation, got %+v", element.Data, element.GetAttribute("class"), e)
+		}
+		node := styledNodeOf(styled, element)
+		for _, property := range e.Properties {
+			if value, ok := node.Styles[property.Name]; ok && value != property.Value {
+				t.Errorf("<%s class=%q> %s: expected %q, got %q", element.Data, element.GetAttribute("class"), property.Name, value, property.Value)
+			}
+			if property.Source == SourceRule && property.Rule.Rule.Location.Line == 0 {
+				t.Errorf("Expected %s to come from a located rule", property.Name)
+			}
+		}
+	}
+
+	if ExplainStyle(doc, stylesheet, opts, outside) != nil {
+		t.Error("Expected no explanation of an element outside the document")
+	}
+}
+
+// TestQuerySelectorAll tests finding elements by selector list.
+func TestQuerySelectorAll(t *testing.T) {
+	doc := html.Parse(`<div><p class="a">1</p><p>2</p><span class="a">3</span></div>`)
+	tests := []struct {
+		selectors string
+		expected  string // the text of the matched elements
+	}{
+		{"p", "12"},
+		{".a", "13"},
+		{"span, p:first-child", "13"},
+		{"div > *", "123"},
+		{"p::before", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		var got strings.Builder
+		for _, element := range QuerySelectorAll(doc, tt.selectors) {
+			got.WriteString(element.Children[0].Data)
+		}
+		if got.String() != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.selectors, tt.expected, got.String())
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package style
+
+// This file maps the presentational attributes of HTML elements, such as
+// bgcolor, align, border and <font size>, to the CSS properties the HTML
+// Rendering section gives them. Hints are applied as if they were author
+// rules at the start of the author stylesheet with a specificity of zero:
+// they override the user-agent and user stylesheets and are overridden by
+// every author rule and style attribute.
+//
+// Spec references:
+// - CSS 2.1 §6.4.4 Precedence of non-CSS presentational hints: https://www.w3.org/TR/CSS21/cascade.html#preshint
+// - HTML §15.2 The CSS user agent style sheet and presentational hints: https://html.spec.whatwg.org/multipage/rendering.html#the-css-user-agent-style-sheet-and-presentational-hints
+// - HTML §15.3 Non-replaced elements: https://html.spec.whatwg.org/multipage/rendering.html#non-replaced-elements
+// - HTML §15.4.3 Attributes for embedded content and images: https://html.spec.whatwg.org/multipage/rendering.html#attributes-for-embedded-content-and-images
+// - HTML §2.3.2.2 Non-negative integers, §2.3.2.4 Dimension values, §2.3.6 Colors (legacy colour values)
+//
+// Implemented:
+// - bgcolor and background on body, tables, row groups, rows and cells
+// - body text, link, and the marginheight, marginwidth, topmargin,
+//   bottommargin, leftmargin and rightmargin attributes
+// - <font color face size>, with legacy font sizes 1 to 7 and +n/-n
+// - align on div, p, h1-h6, caption, tables, row groups, rows, cells, hr
+//   and images; valign on row groups, rows and cells
+// - width and height on tables, columns, rows, cells, hr and embedded
+//   content, as dimension values
+// - table border, cellspacing and cellpadding, the border drawing the
+//   cells of the table too
+// - nowrap on cells, <pre wrap>, and <hr size noshade color>
+// - border, hspace and vspace on images and embedded content
+// - type on ol, ul and li
+//
+// Not implemented:
+// - The frame and rules attributes of tables, and bordercolor
+// - vlink and alink, since no link is visited or active
+// - Hints of form controls (size, cols, rows), frames and <marquee>
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// applyPresentationalHints converts HTML presentational attributes to CSS styles.
+// HTML §15.2: Presentational hints
+// These attributes have lower specificity than author CSS rules.
+func applyPresentationalHints(node *dom.Node, styles map[string]string) {
+	switch node.Data {
+	case "body":
+		applyBackgroundHints(node, styles)
+		if color, ok := parseLegacyColor(node.GetAttribute("text")); ok {
+			styles["color"] = color
+		}
+		applyBodyMargins(node, styles)
+
+	case "a", "area":
+		// HTML §15.3.4: the body's link attribute colors :link elements
+		if node.GetAttribute("href") == "" {
+			break
+		}
+		if body := ancestorElement(node, "body"); body != nil {
+			if color, ok := parseLegacyColor(body.GetAttribute("link")); ok {
+				styles["color"] = color
+			}
+		}
+
+	case "font":
+		// HTML §15.3.4 Phrasing content
+		if color, ok := parseLegacyColor(node.GetAttribute("color")); ok {
+			styles["color"] = color
+		}
+		if face := strings.TrimSpace(node.GetAttribute("face")); face != "" {
+			styles["font-family"] = face
+		}
+		if size, ok := legacyFontSize(node.GetAttribute("size")); ok {
+			styles["font-size"] = size
+		}
+
+	case "div":
+		// HTML §15.3.3 Flow content
+		if align, ok := alignHint(node, true); ok {
+			styles["text-align"] = align
+		}
+
+	case "p", "h1", "h2", "h3", "h4", "h5", "h6":
+		// HTML §15.3.3 Flow content, §15.3.7 Sections and headings
+		if align, ok := alignHint(node, false); ok {
+			styles["text-align"] = align
+		}
+
+	case "pre":
+		// HTML §15.3.3: pre[wrap] { white-space: pre-wrap; }
+		if _, ok := node.Attributes["wrap"]; ok {
+			styles["white-space"] = "pre-wrap"
+		}
+
+	case "caption":
+		// HTML §15.3.10 Tables
+		if strings.EqualFold(strings.TrimSpace(node.GetAttribute("align")), "bottom") {
+			styles["caption-side"] = "bottom"
+		} else if align, ok := alignHint(node, false); ok {
+			styles["text-align"] = align
+		}
+
+	case "table":
+		applyTableHints(node, styles)
+
+	case "thead", "tbody", "tfoot", "tr":
+		applyBackgroundHints(node, styles)
+		applyCellAlignHints(node, styles)
+		if node.Data == "tr" {
+			applyDimensionHint(node, "height", styles, true)
+		}
+
+	case "td", "th":
+		applyBackgroundHints(node, styles)
+		applyCellAlignHints(node, styles)
+		applyDimensionHint(node, "width", styles, true)
+		applyDimensionHint(node, "height", styles, true)
+		if _, ok := node.Attributes["nowrap"]; ok {
+			styles["white-space"] = "nowrap"
+		}
+		applyTableCellHints(node, styles)
+
+	case "col", "colgroup":
+		applyDimensionHint(node, "width", styles, false)
+
+	case "hr":
+		applyHorizontalRuleHints(node, styles)
+
+	case "img", "object", "embed", "iframe", "video":
+		applyEmbeddedContentHints(node, styles)
+
+	case "ol", "ul", "li":
+		// HTML §15.3.8 Lists
+		if listType, ok := listTypeHint(node.GetAttribute("type")); ok {
+			styles["list-style-type"] = listType
+		}
+	}
+}
+
+// listTypeHint returns the list-style-type of the type attribute of
+// lists and list items: 1, a, A, i and I, which are case-sensitive, or
+// the bullet keywords in any case.
+// HTML §15.3.8 Lists
+func listTypeHint(value string) (string, bool) {
+	switch value {
+	case "1":
+		return "decimal", true
+	case "a":
+		return "lower-alpha", true
+	case "A":
+		return "upper-alpha", true
+	case "i":
+		return "lower-roman", true
+	case "I":
+		return "upper-roman", true
+	}
+	switch lower := strings.ToLower(value); lower {
+	case "disc", "circle", "square", "none":
+		return lower, true
+	}
+	return "", false
+}
+
+// applyBackgroundHints maps bgcolor and background, which body, tables,
+// row groups, rows and cells have.
+// HTML §15.3.3, §15.3.10
+func applyBackgroundHints(node *dom.Node, styles map[string]string) {
+	if color, ok := parseLegacyColor(node.GetAttribute("bgcolor")); ok {
+		styles["background-color"] = color
+	}
+	if background := strings.TrimSpace(node.GetAttribute("background")); background != "" {
+		styles["background-image"] = "url(" + strconv.Quote(background) + ")"
+	}
+}
+
+// applyBodyMargins maps the margin attributes of body, marginheight and
+// marginwidth being overridden by the more specific ones.
+// HTML §15.3.3: body margins
+func applyBodyMargins(node *dom.Node, styles map[string]string) {
+	margins := []struct {
+		property   string
+		attributes []string // in increasing precedence
+	}{
+		{"margin-top", []string{"marginheight", "topmargin"}},
+		{"margin-bottom", []string{"marginheight", "bottommargin"}},
+		{"margin-left", []string{"marginwidth", "leftmargin"}},
+		{"margin-right", []string{"marginwidth", "rightmargin"}},
+	}
+	for _, margin := range margins {
+		for _, attribute := range margin.attributes {
+			if n, ok := parseNonNegativeInteger(node.GetAttribute(attribute)); ok {
+				styles[margin.property] = pixels(n)
+			}
+		}
+	}
+}
+
+// applyTableHints maps the attributes of a table element.
+// HTML §15.3.10 Tables
+func applyTableHints(node *dom.Node, styles map[string]string) {
+	applyBackgroundHints(node, styles)
+	applyDimensionHint(node, "width", styles, true)
+	applyDimensionHint(node, "height", styles, true)
+
+	switch strings.ToLower(strings.TrimSpace(node.GetAttribute("align"))) {
+	case "left":
+		styles["float"] = "left"
+	case "right":
+		styles["float"] = "right"
+	case "center":
+		styles["margin-left"] = "auto"
+		styles["margin-right"] = "auto"
+	}
+
+	// cellspacing maps to border-spacing, between all the cells of the
+	// table
+	if spacing, ok := parseNonNegativeInteger(node.GetAttribute("cellspacing")); ok {
+		styles["border-spacing"] = pixels(spacing)
+	}
+
+	// table[border] draws an outset border around the table
+	if width, ok := tableBorder(node); ok {
+		for _, side := range []string{"top", "right", "bottom", "left"} {
+			styles["border-"+side+"-width"] = pixels(width)
+			styles["border-"+side+"-style"] = "outset"
+		}
+	}
+}
+
+// applyTableCellHints maps the attributes of the cell's table that style
+// its cells: cellpadding pads every cell, and a border draws a 1px inset
+// border around every cell.
+// HTML §15.3.10 Tables
+func applyTableCellHints(node *dom.Node, styles map[string]string) {
+	table := ancestorElement(node, "table")
+	if table == nil {
+		return
+	}
+	padding, hasPadding := parseNonNegativeInteger(table.GetAttribute("cellpadding"))
+	width, hasBorder := tableBorder(table)
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		if hasPadding {
+			styles["padding-"+side] = pixels(padding)
+		}
+		if hasBorder && width > 0 {
+			styles["border-"+side+"-width"] = "1px"
+			styles["border-"+side+"-style"] = "inset"
+		}
+	}
+}
+
+// tableBorder returns the width in pixels of a table's border attribute,
+// which is 1 if the attribute is present but not a number.
+func tableBorder(table *dom.Node) (int, bool) {
+	value, ok := table.Attributes["border"]
+	if !ok {
+		return 0, false
+	}
+	if width, ok := parseNonNegativeInteger(value); ok {
+		return width, true
+	}
+	return 1, true
+}
+
+// applyCellAlignHints maps align and valign on row groups, rows and cells.
+// Cells take the valign of their row through the user-agent stylesheet's
+// 'vertical-align: inherit'.
+// HTML §15.3.10 Tables
+func applyCellAlignHints(node *dom.Node, styles map[string]string) {
+	if align, ok := alignHint(node, true); ok {
+		styles["text-align"] = align
+	}
+	switch valign := strings.ToLower(strings.TrimSpace(node.GetAttribute("valign"))); valign {
+	case "top", "middle", "bottom", "baseline":
+		styles["vertical-align"] = valign
+	}
+}
+
+// alignHint returns the 'text-align' an align attribute of left, right,
+// center or justify gives, and for middle too if middle is set.
+func alignHint(node *dom.Node, middle bool) (string, bool) {
+	switch align := strings.ToLower(strings.TrimSpace(node.GetAttribute("align"))); align {
+	case "left", "right", "center", "justify":
+		return align, true
+	case "middle":
+		return "center", middle
+	}
+	return "", false
+}
+
+// applyHorizontalRuleHints maps the attributes of hr.
+// HTML §15.3.11 The hr element
+func applyHorizontalRuleHints(node *dom.Node, styles map[string]string) {
+	switch strings.ToLower(strings.TrimSpace(node.GetAttribute("align"))) {
+	case "left":
+		styles["margin-left"] = "0"
+		styles["margin-right"] = "auto"
+	case "right":
+		styles["margin-left"] = "auto"
+		styles["margin-right"] = "0"
+	case "center":
+		styles["margin-left"] = "auto"
+		styles["margin-right"] = "auto"
+	}
+	applyDimensionHint(node, "width", styles, false)
+
+	color, hasColor := parseLegacyColor(node.GetAttribute("color"))
+	_, noshade := node.Attributes["noshade"]
+	if hasColor {
+		styles["color"] = color
+		styles["background-color"] = color
+	}
+	solid := hasColor || noshade
+	size, hasSize := parseNonNegativeInteger(node.GetAttribute("size"))
+	for _, side := range []string{"top", "right", "bottom", "left"} {
+		if hasColor {
+			styles["border-"+side+"-color"] = color
+		}
+		if solid {
+			styles["border-"+side+"-style"] = "solid"
+		}
+		if solid && hasSize {
+			// A solid rule is drawn by its borders alone
+			styles["border-"+side+"-width"] = strconv.FormatFloat(float64(size)/2, 'f', -1, 64) + "px"
+		}
+	}
+	switch {
+	case solid || !hasSize:
+	case size == 1:
+		styles["border-bottom-width"] = "0"
+	case size > 1:
+		styles["height"] = pixels(size - 2)
+	}
+}
+
+// applyEmbeddedContentHints maps the attributes of images and other
+// embedded content.
+// HTML §15.4.3 Attributes for embedded content and images
+func applyEmbeddedContentHints(node *dom.Node, styles map[string]string) {
+	applyDimensionHint(node, "width", styles, false)
+	applyDimensionHint(node, "height", styles, false)
+
+	switch strings.ToLower(strings.TrimSpace(node.GetAttribute("align"))) {
+	case "left":
+		styles["float"] = "left"
+	case "right":
+		styles["float"] = "right"
+	case "top":
+		styles["vertical-align"] = "top"
+	case "baseline":
+		styles["vertical-align"] = "baseline"
+	case "texttop":
+		styles["vertical-align"] = "text-top"
+	case "absmiddle", "abscenter", "middle", "center":
+		styles["vertical-align"] = "middle"
+	case "bottom":
+		styles["vertical-align"] = "bottom"
+	}
+
+	if hspace, ok := parseDimension(node.GetAttribute("hspace"), false); ok {
+		styles["margin-left"] = hspace
+		styles["margin-right"] = hspace
+	}
+	if vspace, ok := parseDimension(node.GetAttribute("vspace"), false); ok {
+		styles["margin-top"] = vspace
+		styles["margin-bottom"] = vspace
+	}
+
+	if node.Data == "img" || node.Data == "object" {
+		if border, ok := parseNonNegativeInteger(node.GetAttribute("border")); ok && border > 0 {
+			for _, side := range []string{"top", "right", "bottom", "left"} {
+				styles["border-"+side+"-width"] = pixels(border)
+				styles["border-"+side+"-style"] = "solid"
+			}
+		}
+	}
+}
+
+// applyDimensionHint maps the attribute named property, a dimension value,
+// to the property, ignoring zero if ignoreZero is set.
+// HTML §15.2: maps to the dimension property (ignoring zero)
+func applyDimensionHint(node *dom.Node, property string, styles map[string]string, ignoreZero bool) {
+	if value, ok := parseDimension(node.GetAttribute(property), ignoreZero); ok {
+		styles[property] = value
+	}
+}
+
+// ancestorElement returns the nearest ancestor of node named tag, or nil.
+func ancestorElement(node *dom.Node, tag string) *dom.Node {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == dom.ElementNode && parent.Data == tag {
+			return parent
+		}
+	}
+	return nil
+}
+
+// pixels returns n as a CSS pixel length.
+func pixels(n int) string {
+	return strconv.Itoa(n) + "px"
+}
+
+// parseNonNegativeInteger parses the leading integer of value, after
+// whitespace and an optional '+', ignoring what follows it.
+// HTML §2.3.2.2 Non-negative integers
+func parseNonNegativeInteger(value string) (int, bool) {
+	value = strings.TrimLeft(value, " \t\n\f\r")
+	value = strings.TrimPrefix(value, "+")
+	digits := leadingDigits(value)
+	if digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		// Too many digits
+		return 0, false
+	}
+	return n, true
+}
+
+// parseDimension parses a dimension value, a number of pixels or a
+// percentage, into a CSS length. Text after the number is ignored, and so
+// is zero if ignoreZero is set.
+// HTML §2.3.2.4 Dimension values
+func parseDimension(value string, ignoreZero bool) (string, bool) {
+	value = strings.TrimLeft(value, " \t\n\f\r")
+	digits := leadingDigits(value)
+	if digits == "" {
+		return "", false
+	}
+	number := digits
+	rest := value[len(digits):]
+	if strings.HasPrefix(rest, ".") {
+		if fraction := leadingDigits(rest[1:]); fraction != "" {
+			number += "." + fraction
+			rest = rest[1+len(fraction):]
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || (ignoreZero && n == 0) {
+		return "", false
+	}
+	if strings.HasPrefix(rest, "%") {
+		return number + "%", true
+	}
+	return number + "px", true
+}
+
+// leadingDigits returns the ASCII digits value starts with.
+func leadingDigits(value string) string {
+	i := 0
+	for i < len(value) && value[i] >= '0' && value[i] <= '9' {
+		i++
+	}
+	return value[:i]
+}
+
+// legacyFontSizes are the font sizes of <font size=1> to <font size=7>.
+var legacyFontSizes = [...]string{"x-small", "small", "medium", "large", "x-large", "xx-large", "xxx-large"}
+
+// legacyFontSize returns the font size keyword of a <font size> value: a
+// size from 1 to 7, or one relative to 3 if it starts with '+' or '-'.
+// HTML §15.3.4: rules for parsing a legacy font size
+func legacyFontSize(value string) (string, bool) {
+	value = strings.TrimLeft(value, " \t\n\f\r")
+	mode := byte(0)
+	if value != "" && (value[0] == '+' || value[0] == '-') {
+		mode = value[0]
+		value = value[1:]
+	}
+	n, ok := parseNonNegativeInteger(leadingDigits(value))
+	if !ok {
+		return "", false
+	}
+	switch mode {
+	case '+':
+		n = 3 + n
+	case '-':
+		n = 3 - n
+	}
+	n = max(1, min(n, 7))
+	return legacyFontSizes[n-1], true
+}
+
+// parseLegacyColor parses a legacy color value as body, font and table
+// attributes take: a named color, or anything else read as hex digits the
+// way browsers always have, so that "ff6600" and even "chucknorris" are
+// colors. It returns the color as CSS.
+// HTML §2.3.6: rules for parsing a legacy colour value
+func parseLegacyColor(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	lower := strings.ToLower(value)
+	if value == "" || lower == "transparent" {
+		return "", false
+	}
+	if lower != "currentcolor" && !strings.ContainsAny(lower, "#(") && css.IsColor(lower) {
+		return value, true
+	}
+	if len(value) == 4 && value[0] == '#' && isHex(value[1:]) {
+		return value, true
+	}
+
+	if len(value) > 128 {
+		value = value[:128]
+	}
+	value = strings.TrimPrefix(value, "#")
+	digits := []byte(value)
+	for i, c := range digits {
+		if !isHex(string(c)) {
+			digits[i] = '0'
+		}
+	}
+	for len(digits) == 0 || len(digits)%3 != 0 {
+		digits = append(digits, '0')
+	}
+
+	// Three components, keeping at most the last 8 digits of each, with
+	// leading zeros shared by all of them removed, truncated to 2 digits
+	length := len(digits) / 3
+	components := [3][]byte{digits[:length], digits[length : 2*length], digits[2*length:]}
+	if length > 8 {
+		for i := range components {
+			components[i] = components[i][length-8:]
+		}
+		length = 8
+	}
+	for length > 2 && components[0][0] == '0' && components[1][0] == '0' && components[2][0] == '0' {
+		for i := range components {
+			components[i] = components[i][1:]
+		}
+		length--
+	}
+	var color strings.Builder
+	color.WriteByte('#')
+	for _, component := range components {
+		if len(component) == 1 {
+			color.WriteByte('0')
+		}
+		color.Write(component[:min(len(component), 2)])
+	}
+	return color.String(), true
+}
+
+// isHex reports whether s consists of hex digits.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestPresentationalHintsMapping tests the properties the presentational
+// attributes of elements give them.
+// HTML §15.3 Non-replaced elements, §15.4.3 Attributes for embedded content
+func TestPresentationalHintsMapping(t *testing.T) {
+	tests := []struct {
+		html     string
+		tag      string
+		property string
+		expected string
+	}{
+		{`<body bgcolor="ff6600">x</body>`, "body", "background-color", "#ff6600"},
+		{`<body text="navy">x</body>`, "body", "color", "navy"},
+		{`<body background="bg.png">x</body>`, "body", "background-image", `url("bg.png")`},
+		{`<body marginwidth="4" leftmargin="6">x</body>`, "body", "margin-left", "6px"},
+		{`<body marginwidth="4" leftmargin="6">x</body>`, "body", "margin-right", "4px"},
+		{`<body topmargin="0">x</body>`, "body", "margin-top", "0px"},
+		{`<body link="#00f"><p><a href="x">a</a></p></body>`, "a", "color", "#00f"},
+		{`<font color="red" face="Georgia, serif" size="+2">x</font>`, "font", "color", "red"},
+		{`<font color="red" face="Georgia, serif" size="+2">x</font>`, "font", "font-family", "Georgia, serif"},
+		{`<font size="+2">x</font>`, "font", "font-size", "20px"},
+		{`<font size="1">x</font>`, "font", "font-size", "10px"},
+		{`<div align="middle">x</div>`, "div", "text-align", "center"},
+		{`<p align="right">x</p>`, "p", "text-align", "right"},
+		{`<h2 align="CENTER">x</h2>`, "h2", "text-align", "center"},
+		{`<pre wrap>x</pre>`, "pre", "white-space", "pre-wrap"},
+		{`<table align="right"><tr><td>x</td></tr></table>`, "table", "float", "right"},
+		{`<table align="center"><tr><td>x</td></tr></table>`, "table", "margin-left", "auto"},
+		{`<table width="80%" cellspacing="4"><tr><td>x</td></tr></table>`, "table", "width", "80%"},
+		{`<table width="80%" cellspacing="4"><tr><td>x</td></tr></table>`, "table", "border-spacing", "4px"},
+		{`<table border="2"><tr><td>x</td></tr></table>`, "table", "border-left-width", "2px"},
+		{`<table border="2"><tr><td>x</td></tr></table>`, "table", "border-left-style", "outset"},
+		{`<table border><tr><td>x</td></tr></table>`, "table", "border-top-width", "1px"},
+		{`<table border="2"><tr><td>x</td></tr></table>`, "td", "border-top-width", "1px"},
+		{`<table border="2"><tr><td>x</td></tr></table>`, "td", "border-top-style", "inset"},
+		{`<table border="0"><tr><td>x</td></tr></table>`, "td", "border-top-style", ""},
+		{`<table cellpadding="7"><tr><td>x</td></tr></table>`, "td", "padding-bottom", "7px"},
+		{`<table><tr valign="top"><td>x</td></tr></table>`, "td", "vertical-align", "top"},
+		{`<table><tr><td>x</td></tr></table>`, "td", "vertical-align", "middle"},
+		{`<table><tr align="right"><td>x</td></tr></table>`, "td", "text-align", "right"},
+		{`<table><tr><td width="0" height="20" nowrap>x</td></tr></table>`, "td", "width", ""},
+		{`<table><tr><td width="0" height="20" nowrap>x</td></tr></table>`, "td", "height", "20px"},
+		{`<table><tr><td width="0" height="20" nowrap>x</td></tr></table>`, "td", "white-space", "nowrap"},
+		{`<table><caption align="bottom">c</caption></table>`, "caption", "caption-side", "bottom"},
+		{`<hr align="left" width="50%">`, "hr", "margin-right", "auto"},
+		{`<hr align="left" width="50%">`, "hr", "width", "50%"},
+		{`<hr size="6">`, "hr", "height", "4px"},
+		{`<hr size="1">`, "hr", "border-bottom-width", "0"},
+		{`<hr noshade size="4">`, "hr", "border-top-width", "2px"},
+		{`<hr noshade size="4">`, "hr", "border-top-style", "solid"},
+		{`<hr color="red">`, "hr", "background-color", "red"},
+		{`<img src="x.png" align="left">`, "img", "float", "left"},
+		{`<img src="x.png" align="absmiddle">`, "img", "vertical-align", "middle"},
+		{`<img src="x.png" hspace="5" vspace="3">`, "img", "margin-right", "5px"},
+		{`<img src="x.png" hspace="5" vspace="3">`, "img", "margin-top", "3px"},
+		{`<img src="x.png" border="2">`, "img", "border-bottom-width", "2px"},
+		{`<img src="x.png" border="2">`, "img", "border-bottom-style", "solid"},
+		{`<img src="x.png" width="120px" height="40.5">`, "img", "width", "120px"},
+		{`<img src="x.png" width="120px" height="40.5">`, "img", "height", "40.5px"},
+		{`<div width="100" bgcolor="red">x</div>`, "div", "width", ""},
+		{`<div width="100" bgcolor="red">x</div>`, "div", "background-color", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.html+" "+tt.property, func(t *testing.T) {
+			doc := html.Parse("<html>" + tt.html + "</html>")
+			node := findStyledNode(StyleTree(doc, nil), tt.tag)
+			if node == nil {
+				t.Fatalf("Expected a <%s> element", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestPresentationalHintPrecedence tests that hints override the
+// user-agent and user stylesheets and are overridden by author rules.
+// CSS 2.1 §6.4.4 Precedence of non-CSS presentational hints
+func TestPresentationalHintPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		css      string
+		html     string
+		tag      string
+		property string
+		expected string
+	}{
+		{"hint over user agent", "", `<table><tr><td>x</td></tr></table><table cellpadding="5"><tr><td>x</td></tr></table>`, "td", "padding-top", "5px"},
+		{"author rule over hint", "td { padding: 2px; }", `<table cellpadding="5"><tr><td>x</td></tr></table>`, "td", "padding-top", "2px"},
+		{"author rule of zero specificity over hint", "* { text-align: left; }", `<p align="right">x</p>`, "p", "text-align", "left"},
+		{"author rule over cellspacing", "table { border-spacing: 1px; }", `<table cellspacing="8"><tr><td>x</td></tr></table>`, "table", "border-spacing", "1px"},
+		{"style attribute over hint", "", `<font color="red" style="color: blue">x</font>`, "font", "color", "blue"},
+		{"hint over user", "", `<p align="right">x</p>`, "p", "text-align", "right"},
+		{"hint over inherited value", "", `<div align="center"><table><tr><td align="left">x</td></tr></table></div>`, "td", "text-align", "left"},
+	}
+	user := css.Parse(`p { text-align: center; }`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := html.Parse("<html><body>" + tt.html + "</body></html>")
+			opts := DefaultOptions()
+			opts.UserStylesheet = user
+			styled := StyleTreeWithOptions(doc, css.Parse(tt.css), opts)
+
+			// The last element named tag
+			var node *StyledNode
+			var walk func(n *StyledNode)
+			walk = func(n *StyledNode) {
+				if n.Node.Data == tt.tag && n.PseudoElement == "" {
+					node = n
+				}
+				for _, child := range n.Children {
+					walk(child)
+				}
+			}
+			walk(styled)
+			if node == nil {
+				t.Fatalf("Expected a <%s> element", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestParseLegacyColor tests the colors of bgcolor and similar attributes.
+// HTML §2.3.6: rules for parsing a legacy colour value
+func TestParseLegacyColor(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // empty for failure
+	}{
+		{"red", "red"},
+		{" Navy ", "Navy"},
+		{"#f60", "#f60"},
+		{"#FF6600", "#FF6600"},
+		{"ff6600", "#ff6600"},
+		{"f60", "#0f0600"},
+		{"chucknorris", "#c00000"},
+		{"#12345", "#123450"},
+		{"0000001000000200000003", "#012030"},
+		{"transparent", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseLegacyColor(tt.input)
+		if ok != (tt.expected != "") || got != tt.expected {
+			t.Errorf("parseLegacyColor(%q) = %q, %v, expected %q", tt.input, got, ok, tt.expected)
+		}
+	}
+}
+
+// TestParseDimension tests dimension and integer attribute values.
+// HTML §2.3.2.2 Non-negative integers, §2.3.2.4 Dimension values
+func TestParseDimension(t *testing.T) {
+	tests := []struct {
+		input      string
+		ignoreZero bool
+		expected   string // empty for failure
+	}{
+		{"100", false, "100px"},
+		{" 50% ", false, "50%"},
+		{"12.5px", false, "12.5px"},
+		{"7.", false, "7px"},
+		{"0", false, "0px"},
+		{"0", true, ""},
+		{"-5", false, ""},
+		{"auto", false, ""},
+	}
+	for _, tt := range tests {
+		got, ok := parseDimension(tt.input, tt.ignoreZero)
+		if ok != (tt.expected != "") || got != tt.expected {
+			t.Errorf("parseDimension(%q, %v) = %q, %v, expected %q", tt.input, tt.ignoreZero, got, ok, tt.expected)
+		}
+	}
+
+	if n, ok := parseNonNegativeInteger(" +12abc"); !ok || n != 12 {
+		t.Errorf("parseNonNegativeInteger(\" +12abc\") = %d, %v, expected 12", n, ok)
+	}
+	if _, ok := parseNonNegativeInteger("-1"); ok {
+		t.Error("Expected -1 not to be a non-negative integer")
+	}
+}
+
+// TestLegacyFontSize tests the font sizes of <font size>.
+// HTML §15.3.4: rules for parsing a legacy font size
+func TestLegacyFontSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // empty for failure
+	}{
+		{"1", "x-small"},
+		{"3", "medium"},
+		{"7", "xxx-large"},
+		{"9", "xxx-large"},
+		{"0", "x-small"},
+		{"+1", "large"},
+		{"-1", "small"},
+		{"-5", "x-small"},
+		{" 4pt", "large"},
+		{"big", ""},
+		{"+", ""},
+	}
+	for _, tt := range tests {
+		got, ok := legacyFontSize(tt.input)
+		if ok != (tt.expected != "") || got != tt.expected {
+			t.Errorf("legacyFontSize(%q) = %q, %v, expected %q", tt.input, got, ok, tt.expected)
+		}
+	}
+}
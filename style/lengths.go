@@ -0,0 +1,177 @@
+package style
+
+// This file computes relative lengths. The computed value of a length is
+// absolute: font-relative and viewport-relative lengths, and math functions
+// of them, are converted to pixels here, where the font sizes and viewport
+// are known, while percentages are left for layout, which knows the
+// containing block.
+//
+// Spec references:
+// - CSS 2.1 §6.1.2 Computed values: https://www.w3.org/TR/CSS21/cascade.html#computed-value
+// - CSS Values and Units Level 4 §6.1 Relative Lengths: https://www.w3.org/TR/css-values-4/#relative-lengths
+// - CSS Values and Units Level 4 §10.10 Computed Value of math functions: https://www.w3.org/TR/css-values-4/#calc-computed-value
+
+import (
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// lengthProps are the properties whose values hold lengths, computed to
+// absolute lengths. font-size and line-height are computed separately.
+var lengthProps = []string{
+	"width", "height",
+	"min-width", "max-width", "min-height", "max-height",
+	"margin-top", "margin-right", "margin-bottom", "margin-left",
+	"padding-top", "padding-right", "padding-bottom", "padding-left",
+	"border-top-width", "border-right-width", "border-bottom-width", "border-left-width",
+	"top", "right", "bottom", "left",
+	"border-spacing",
+	"letter-spacing",
+	"word-spacing",
+	"text-indent",
+	"vertical-align",
+	"outline-width",
+}
+
+// styleContext holds what style computation needs beyond a node and its
+// parent's styles.
+type styleContext struct {
+	// rules indexes the rules of the stylesheet for selector matching.
+	rules *ruleIndex
+
+	// ancestors holds the ancestors of the element being styled, to reject
+	// selectors needing an ancestor it does not have.
+	ancestors *ancestorFilter
+
+	// sharing is the style sharing cache, or nil if styles are not shared.
+	sharing *styleSharingCache
+
+	// stats counts the nodes styled with this context.
+	stats Stats
+
+	// workers styles subtrees in parallel, or is nil (parallel.go).
+	workers *workerPool
+
+	// traces record the cascades of the elements ExplainStyles explains,
+	// or are nil (explain.go).
+	traces map[*dom.Node]*cascadeTrace
+
+	// lengths holds the viewport and, once the root element is styled, the
+	// root font size. Its FontSize is unused.
+	lengths css.LengthContext
+
+	// properties holds the custom properties registered by @property
+	// rules, the last valid rule for each name winning.
+	// CSS Properties and Values API Level 1 §3
+	properties map[string]*css.PropertyRule
+}
+
+// newStyleContext returns the context for styling a document with
+// stylesheet in the environment env. The first userAgentRules rules of
+// stylesheet come from the user-agent stylesheet and the next userRules
+// from the user's; the others are the author's.
+func newStyleContext(stylesheet *css.Stylesheet, userAgentRules, userRules int, env css.MediaEnvironment) *styleContext {
+	lengths := css.DefaultLengthContext()
+	lengths.ViewportWidth = env.Width
+	lengths.ViewportHeight = env.Height
+	properties := make(map[string]*css.PropertyRule)
+	for _, rule := range stylesheet.Properties {
+		if rule.MatchesMedia(env) {
+			properties[rule.Name] = rule
+		}
+	}
+	return &styleContext{
+		rules:      newRuleIndex(stylesheet.Rules, userAgentRules, userRules),
+		ancestors:  &ancestorFilter{},
+		lengths:    lengths,
+		properties: properties,
+	}
+}
+
+// computeLengths replaces the font size and the relative lengths of styles
+// by their computed values in pixels. The font size is resolved against
+// the parent's (already computed) font size; other lengths against the
+// element's own. root is set for the root element, whose font size rem
+// units of the document refer to.
+// CSS Fonts Level 4 §2.5: the computed font-size is an absolute length
+// CSS Values and Units Level 4 §6.1 Relative Lengths
+func (ctx *styleContext) computeLengths(styles, parentStyles map[string]string, root bool) {
+	parentFontSize := fontSizeOf(parentStyles)
+	fontSize := parentFontSize
+	if value, ok := styles["font-size"]; ok {
+		if size := css.ResolveFontSize(value, parentFontSize, ctx.lengths); size > 0 {
+			fontSize = size
+			styles["font-size"] = css.FormatPixels(size)
+		}
+	}
+
+	// CSS Values and Units Level 4 §6.1.1: rem units refer to the root
+	// element's font size, and to the initial font size on the root itself
+	if root {
+		ctx.lengths.RootFontSize = fontSize
+	}
+
+	lengths := ctx.lengths
+	lengths.FontSize = fontSize
+	for _, prop := range lengthProps {
+		if value, ok := styles[prop]; ok {
+			if computed, changed := computeRelativeLengths(value, lengths); changed {
+				styles[prop] = computed
+			}
+		}
+	}
+
+	// CSS Properties and Values API Level 1 §2.2: registered custom
+	// properties of length types compute like lengths of other properties
+	for name, rule := range ctx.properties {
+		if value, ok := styles[name]; ok && rule.IsLength() {
+			styles[name], _ = computeRelativeLengths(value, lengths)
+		}
+	}
+
+	// CSS 2.1 §10.8.1: a line-height length or percentage computes to an
+	// absolute length, while a number is inherited as a number
+	if value, ok := styles["line-height"]; ok {
+		if length, ok := css.ParseLength(value); ok && (length.IsRelative() || length.HasPercentage() || length.Calc != nil) {
+			lengths.PercentBase = fontSize
+			styles["line-height"] = css.FormatPixels(length.Resolve(lengths))
+		}
+	}
+}
+
+// computeRelativeLengths converts the font- and viewport-relative lengths
+// and math functions among the space-separated components of value to
+// their computed values. It reports whether any were converted.
+func computeRelativeLengths(value string, lengths css.LengthContext) (string, bool) {
+	parts := splitWhitespace(value)
+	changed := false
+	for i, part := range parts {
+		if length, ok := css.ParseLength(part); ok && (length.IsRelative() || length.Calc != nil) {
+			parts[i] = length.Compute(lengths).String()
+			changed = true
+		}
+	}
+	if !changed {
+		return value, false
+	}
+	return strings.Join(parts, " "), true
+}
+
+// fontSizeOf returns the computed font size of styles in pixels, or the
+// initial font size if it has none.
+func fontSizeOf(styles map[string]string) float64 {
+	if value, ok := styles["font-size"]; ok {
+		if size := css.ParseFontSize(value); size > 0 {
+			return size
+		}
+	}
+	return css.BaseFontHeight
+}
+
+// isRootElement reports whether node is the root element of its document,
+// or an element with no parent.
+func isRootElement(node *dom.Node) bool {
+	return node.Type == dom.ElementNode && (node.Parent == nil || node.Parent.Type == dom.DocumentNode)
+}
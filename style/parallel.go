@@ -0,0 +1,113 @@
+package style
+
+// This file styles independent subtrees in parallel. Styles flow top-down:
+// an element's styles depend only on its ancestors' (and, through
+// selectors, on the document, which styling does not change), so once an
+// element is styled its children's subtrees can be styled at the same time.
+// A bounded pool of workers takes subtrees when one is free; otherwise the
+// subtree is styled on the current goroutine, so styling never waits for a
+// worker.
+//
+// Results do not depend on the number of workers: children are stored at
+// their index, and generated content is resolved after the whole tree is
+// styled. Only which of two equivalent elements shares the other's styles,
+// and so the sharing counts of Stats, can vary between runs.
+//
+// Spec references:
+// - CSS 2.1 §6.2 Inheritance: https://www.w3.org/TR/CSS21/cascade.html#inheritance
+//
+// Implemented:
+// - A worker pool bounded by Options.Parallelism
+// - Per-worker ancestor filters and counts, with the rule index, @property
+//   registrations and style sharing cache shared between workers
+//
+// Not implemented:
+// - Splitting the children of one element between workers by subtree size
+
+import (
+	"sync"
+
+	"github.com/lukehoban/browser/dom"
+)
+
+// workerPool bounds the number of goroutines styling subtrees besides the
+// one that called StyleTree. A nil pool styles everything sequentially.
+type workerPool struct {
+	slots chan struct{}
+}
+
+// newWorkerPool returns a pool for styling with parallelism goroutines in
+// all, or nil if parallelism is at most 1.
+func newWorkerPool(parallelism int) *workerPool {
+	if parallelism <= 1 {
+		return nil
+	}
+	return &workerPool{slots: make(chan struct{}, parallelism-1)}
+}
+
+// tryAcquire takes a worker if one is free.
+func (p *workerPool) tryAcquire() bool {
+	if p == nil {
+		return false
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// release returns a worker taken by tryAcquire.
+func (p *workerPool) release() {
+	<-p.slots
+}
+
+// fork returns a context for styling a subtree on another goroutine. It has
+// its own copy of the ancestor filter and its own counts, which the caller
+// adds to its own once the subtree is styled.
+func (ctx *styleContext) fork() *styleContext {
+	forked := *ctx
+	forked.ancestors = ctx.ancestors.clone()
+	forked.stats = Stats{}
+	return &forked
+}
+
+// styleChildren styles the children of styled's node, whose styles are
+// complete, handing the subtrees of element children to free workers.
+func (ctx *styleContext) styleChildren(styled *StyledNode) []*StyledNode {
+	children := make([]*StyledNode, len(styled.Node.Children))
+	var wg sync.WaitGroup
+	var forks []*styleContext
+	for i, child := range styled.Node.Children {
+		if hasElementChildren(child) && ctx.workers.tryAcquire() {
+			forked := ctx.fork()
+			forks = append(forks, forked)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer ctx.workers.release()
+				children[i] = styleNode(child, forked, styled)
+			}()
+			continue
+		}
+		children[i] = styleNode(child, ctx, styled)
+	}
+	wg.Wait()
+
+	for _, forked := range forks {
+		ctx.stats.add(forked.stats)
+	}
+	return children
+}
+
+// hasElementChildren reports whether node has element children, so that
+// styling its subtree on a worker is worth the cost of starting it.
+func hasElementChildren(node *dom.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == dom.ElementNode {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package style
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lukehoban/browser/html"
+)
+
+// TestParallelStyleTree tests that styling subtrees in parallel gives the
+// test pages, the WPT tests and a large generated page the styles and
+// counts they get when styled sequentially.
+func TestParallelStyleTree(t *testing.T) {
+	compare := func(name string, parallel, sequential Stats) {
+		if parallel.Elements != sequential.Elements || parallel.Texts != sequential.Texts {
+			t.Errorf("%s: expected %+v nodes counted, got %+v", name, sequential, parallel)
+		}
+	}
+	style := func(name string, source string, path string) {
+		doc := html.Parse(source)
+		stylesheet := LoadStylesheets(doc, path)
+
+		var parallelStats, sequentialStats Stats
+		parallel := DefaultOptions()
+		parallel.Parallelism = 8
+		parallel.Stats = &parallelStats
+		sequential := DefaultOptions()
+		sequential.Parallelism = 1
+		sequential.Stats = &sequentialStats
+
+		styled := StyleTreeWithOptions(doc, stylesheet, parallel)
+		compareStyledTrees(t, name, styled, StyleTreeWithOptions(doc, stylesheet, sequential))
+		compare(name, parallelStats, sequentialStats)
+	}
+
+	err := filepath.WalkDir("../test", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".html") {
+			return err
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		style(path, string(source), path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, stylesheet := largeDocument(10)
+	var parallelStats, sequentialStats Stats
+	parallel := Options{Media: DefaultOptions().Media, Parallelism: 8, Stats: &parallelStats}
+	sequential := Options{Media: DefaultOptions().Media, Stats: &sequentialStats}
+	styled := StyleTreeWithOptions(doc, stylesheet, parallel)
+	compareStyledTrees(t, "generated", styled, StyleTreeWithOptions(doc, stylesheet, sequential))
+	compare("generated", parallelStats, sequentialStats)
+	if sequentialStats.Elements < 800 {
+		t.Errorf("Expected a large generated page, got %d elements", sequentialStats.Elements)
+	}
+}
+
+// TestWorkerPool tests that a pool hands out one worker fewer than its
+// parallelism, the calling goroutine being the other.
+func TestWorkerPool(t *testing.T) {
+	if newWorkerPool(1).tryAcquire() || newWorkerPool(0).tryAcquire() {
+		t.Error("Expected a sequential pool to have no workers")
+	}
+
+	pool := newWorkerPool(3)
+	if !pool.tryAcquire() || !pool.tryAcquire() {
+		t.Fatal("Expected two workers")
+	}
+	if pool.tryAcquire() {
+		t.Error("Expected no third worker")
+	}
+	pool.release()
+	if !pool.tryAcquire() {
+		t.Error("Expected a released worker to be available again")
+	}
+}
+
+// BenchmarkParallelStyleTree styles a generated page of about 8000 elements
+// with increasing parallelism. Parallelism beyond GOMAXPROCS only adds
+// the cost of starting workers.
+func BenchmarkParallelStyleTree(b *testing.B) {
+	doc, stylesheet := largeDocument(100)
+	for _, parallelism := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallelism=%d", parallelism), func(b *testing.B) {
+			opts := DefaultOptions()
+			opts.Parallelism = parallelism
+			for i := 0; i < b.N; i++ {
+				StyleTreeWithOptions(doc, stylesheet, opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package style
+
+// This file holds the property registry: every CSS 2.1 property and the
+// CSS3 properties the browser supports, with the initial value, inherited
+// flag, applicability and percentage basis of Appendix F. Inheritance and
+// the CSS-wide keywords are driven from it, and ComputeStyle uses it to
+// build typed computed values.
+//
+// Spec references:
+// - CSS 2.1 Appendix F Full property table: https://www.w3.org/TR/CSS21/propidx.html
+// - CSS 2.1 §6.2 Inheritance: https://www.w3.org/TR/CSS21/cascade.html#inheritance
+// - CSS Cascading Level 4 §7.3 Explicit Defaulting: https://www.w3.org/TR/css-cascade-4/#defaulting-keywords
+// - CSS Cascading Level 4 §6.1 Cascade Sorting Order: https://www.w3.org/TR/css-cascade-4/#cascade-sort
+//
+// Implemented:
+// - All CSS 2.1 properties, and the CSS3 longhands in use or set by the
+//   shorthands of shorthands.go (fonts, lists, backgrounds, border radii,
+//   flexbox, grid, box alignment, text decoration, multi-column layout,
+//   transitions and animations)
+// - 'inherit', 'initial' and 'unset' for every property in the registry
+// - 'revert' rolling author declarations back to the user origin, and user
+//   declarations back to the user-agent origin, including the default
+//   styles of elements and of the dir, start, reversed and value attributes
+// - The cascade order of the user-agent, user and author origins and of
+//   !important declarations
+//
+// Not implemented:
+// - 'revert-layer' (no cascade layers)
+// - 'revert' in the user-agent origin acts as 'unset'
+
+import (
+	"image/color"
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/font"
+)
+
+// Property describes a property style computation knows about.
+// CSS 2.1 Appendix F Full property table
+type Property struct {
+	Name string
+
+	// Initial is the property's initial value. It is empty where the
+	// initial value depends on the user agent.
+	// CSS 2.1 §6.1.1 Specified values
+	Initial string
+
+	// Inherited reports whether the property is inherited by default.
+	// CSS 2.1 §6.2 Inheritance
+	Inherited bool
+
+	// AppliesTo describes the elements the property applies to, in the
+	// words of the property table.
+	AppliesTo string
+
+	// Percentages describes what percentage values refer to, or is empty
+	// if the property takes none.
+	Percentages string
+
+	// compute stores a computed value in the property's ComputedStyle
+	// field, reporting whether it is valid. It is nil for properties only
+	// kept in Styles.
+	compute func(cs *ComputedStyle, value string) bool
+}
+
+// The applicability and percentage bases shared by many properties.
+const (
+	allElements        = "all elements"
+	blockContainers    = "block containers"
+	blockLevel         = "block-level elements"
+	positioned         = "positioned elements"
+	listItems          = "elements with 'display: list-item'"
+	tableElements      = "'table' and 'inline-table' elements"
+	tableCells         = "'table-cell' elements"
+	flexContainers     = "flex containers"
+	flexItems          = "flex items"
+	gridContainers     = "grid containers"
+	gridItems          = "grid items and absolutely-positioned boxes whose containing block is a grid container"
+	borderBox          = "refer to corresponding dimension of the border box"
+	containingWidth    = "refer to width of containing block"
+	containingHeight   = "refer to height of containing block"
+	marginsApplyTo     = "all elements except elements with table display types other than table-caption, table and inline-table"
+	paddingAppliesTo   = "all elements except table-row-group, table-header-group, table-footer-group, table-row, table-column-group and table-column"
+	widthAppliesTo     = "all elements but non-replaced inline elements, table rows, and row groups"
+	heightAppliesTo    = "all elements but non-replaced inline elements, table columns, and column groups"
+	minMaxWidthApplies = "all elements but non-replaced inline elements and table rows"
+	minMaxHeightApply  = "all elements but non-replaced inline elements and table columns"
+)
+
+// propertyTable lists the properties in the order their computed values
+// are stored: 'color' precedes the properties currentcolor refers to it
+// from, and 'font-size' the ones in em.
+var propertyTable = []*Property{
+	// CSS 2.1 §14.1 Foreground color, §15 Fonts, CSS Fonts Level 4
+	{Name: "color", Initial: initialColor, Inherited: true, AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.Color })},
+	{Name: "font-size", Initial: "medium", Inherited: true, AppliesTo: allElements, Percentages: "refer to inherited font size", compute: computeFontSize},
+	{Name: "font-family", Inherited: true, AppliesTo: allElements, compute: func(cs *ComputedStyle, value string) bool {
+		cs.Font.Family = value
+		return true
+	}},
+	{Name: "font-weight", Initial: "normal", Inherited: true, AppliesTo: allElements, compute: computeFontWeight},
+	{Name: "font-style", Initial: "normal", Inherited: true, AppliesTo: allElements, compute: computeFontStyle},
+	{Name: "font-variant", Initial: "normal", Inherited: true, AppliesTo: allElements},
+	{Name: "font-stretch", Initial: "normal", Inherited: true, AppliesTo: allElements, compute: func(cs *ComputedStyle, value string) bool {
+		cs.Font.Stretch = font.Stretch(value)
+		return true
+	}},
+	{Name: "font-kerning", Initial: "auto", Inherited: true, AppliesTo: allElements, compute: func(cs *ComputedStyle, value string) bool {
+		cs.Font.Kerning = value
+		return true
+	}},
+	{Name: "font-variant-ligatures", Initial: "normal", Inherited: true, AppliesTo: allElements, compute: func(cs *ComputedStyle, value string) bool {
+		cs.Font.Ligatures = value
+		return true
+	}},
+	{Name: "font-feature-settings", Initial: "normal", Inherited: true, AppliesTo: allElements, compute: func(cs *ComputedStyle, value string) bool {
+		cs.Font.FeatureSettings = value
+		return true
+	}},
+	{Name: "line-height", Initial: "normal", Inherited: true, AppliesTo: allElements, Percentages: "refer to the font size of the element itself"},
+
+	// CSS 2.1 §16 Text
+	{Name: "text-indent", Initial: "0", Inherited: true, AppliesTo: blockContainers, Percentages: containingWidth},
+	{Name: "text-align", Initial: "start", Inherited: true, AppliesTo: blockContainers,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.TextAlign }, "start", "end", "left", "right", "center", "justify", "match-parent")},
+	{Name: "letter-spacing", Initial: "normal", Inherited: true, AppliesTo: allElements},
+	{Name: "word-spacing", Initial: "normal", Inherited: true, AppliesTo: allElements},
+	{Name: "text-transform", Initial: "none", Inherited: true, AppliesTo: allElements},
+	{Name: "white-space", Initial: "normal", Inherited: true, AppliesTo: allElements},
+	{Name: "direction", Initial: "ltr", Inherited: true, AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.Direction }, "ltr", "rtl")},
+	{Name: "unicode-bidi", Initial: "normal", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.UnicodeBidi }, "normal", "embed", "isolate", "bidi-override", "isolate-override", "plaintext")},
+
+	// CSS Text Decoration Level 4 §2
+	{Name: "text-decoration-line", Initial: "none", AppliesTo: allElements, compute: computeTextDecoration},
+	{Name: "text-decoration-style", Initial: "solid", AppliesTo: allElements},
+	{Name: "text-decoration-color", Initial: "currentcolor", AppliesTo: allElements},
+	{Name: "text-decoration-thickness", Initial: "auto", AppliesTo: allElements},
+
+	// CSS 2.1 §12 Generated content, automatic numbering, and lists;
+	// CSS Lists Level 3 §4
+	{Name: "content", Initial: "normal", AppliesTo: "::before and ::after pseudo-elements"},
+	{Name: "quotes", Initial: "auto", Inherited: true, AppliesTo: allElements},
+	{Name: "counter-reset", Initial: "none", AppliesTo: allElements},
+	{Name: "counter-increment", Initial: "none", AppliesTo: allElements},
+	{Name: "counter-set", Initial: "none", AppliesTo: allElements},
+	{Name: "list-style-type", Initial: "disc", Inherited: true, AppliesTo: listItems,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.ListStyleType })},
+	{Name: "list-style-image", Initial: "none", Inherited: true, AppliesTo: listItems},
+	{Name: "list-style-position", Initial: "outside", Inherited: true, AppliesTo: listItems,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.ListStylePosition }, "inside", "outside")},
+
+	// CSS 2.1 §9 Visual formatting model. §9.2.4 gives 'display' the
+	// initial value 'inline'; it is left empty so that layout chooses the
+	// display of elements the user-agent stylesheet does not cover
+	{Name: "display", AppliesTo: allElements, compute: keyword(func(cs *ComputedStyle) *string { return &cs.Display })},
+	{Name: "position", Initial: "static", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.Position }, "static", "relative", "absolute", "fixed", "sticky")},
+	{Name: "top", Initial: "auto", AppliesTo: positioned, Percentages: containingHeight},
+	{Name: "right", Initial: "auto", AppliesTo: positioned, Percentages: containingWidth},
+	{Name: "bottom", Initial: "auto", AppliesTo: positioned, Percentages: containingHeight},
+	{Name: "left", Initial: "auto", AppliesTo: positioned, Percentages: containingWidth},
+	{Name: "float", Initial: "none", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.Float }, "none", "left", "right")},
+	{Name: "clear", Initial: "none", AppliesTo: blockLevel},
+	{Name: "z-index", Initial: "auto", AppliesTo: positioned},
+
+	// CSS 2.1 §10 Visual formatting model details
+	{Name: "width", Initial: "auto", AppliesTo: widthAppliesTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Width }, true)},
+	{Name: "min-width", Initial: "0", AppliesTo: minMaxWidthApplies, Percentages: containingWidth},
+	{Name: "max-width", Initial: "none", AppliesTo: minMaxWidthApplies, Percentages: containingWidth},
+	{Name: "height", Initial: "auto", AppliesTo: heightAppliesTo, Percentages: "see prose",
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Height }, true)},
+	{Name: "min-height", Initial: "0", AppliesTo: minMaxHeightApply, Percentages: "see prose"},
+	{Name: "max-height", Initial: "none", AppliesTo: minMaxHeightApply, Percentages: "see prose"},
+	{Name: "vertical-align", Initial: "baseline", AppliesTo: "inline-level and 'table-cell' elements", Percentages: "refer to the 'line-height' of the element itself",
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.VerticalAlign }, "baseline", "sub", "super", "text-top", "text-bottom", "middle", "top", "bottom")},
+
+	// CSS 2.1 §8 Box model
+	{Name: "margin-top", Initial: "0", AppliesTo: marginsApplyTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Margin.Top }, true)},
+	{Name: "margin-right", Initial: "0", AppliesTo: marginsApplyTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Margin.Right }, true)},
+	{Name: "margin-bottom", Initial: "0", AppliesTo: marginsApplyTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Margin.Bottom }, true)},
+	{Name: "margin-left", Initial: "0", AppliesTo: marginsApplyTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Margin.Left }, true)},
+	{Name: "padding-top", Initial: "0", AppliesTo: paddingAppliesTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Padding.Top }, false)},
+	{Name: "padding-right", Initial: "0", AppliesTo: paddingAppliesTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Padding.Right }, false)},
+	{Name: "padding-bottom", Initial: "0", AppliesTo: paddingAppliesTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Padding.Bottom }, false)},
+	{Name: "padding-left", Initial: "0", AppliesTo: paddingAppliesTo, Percentages: containingWidth,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.Padding.Left }, false)},
+
+	// CSS 2.1 §8.5 Border properties
+	{Name: "border-top-width", Initial: "medium", AppliesTo: allElements,
+		compute: borderWidth(func(cs *ComputedStyle) *Length { return &cs.BorderWidth.Top })},
+	{Name: "border-right-width", Initial: "medium", AppliesTo: allElements,
+		compute: borderWidth(func(cs *ComputedStyle) *Length { return &cs.BorderWidth.Right })},
+	{Name: "border-bottom-width", Initial: "medium", AppliesTo: allElements,
+		compute: borderWidth(func(cs *ComputedStyle) *Length { return &cs.BorderWidth.Bottom })},
+	{Name: "border-left-width", Initial: "medium", AppliesTo: allElements,
+		compute: borderWidth(func(cs *ComputedStyle) *Length { return &cs.BorderWidth.Left })},
+	{Name: "border-top-style", Initial: "none", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.BorderStyle.Top }, lineStyles...)},
+	{Name: "border-right-style", Initial: "none", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.BorderStyle.Right }, lineStyles...)},
+	{Name: "border-bottom-style", Initial: "none", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.BorderStyle.Bottom }, lineStyles...)},
+	{Name: "border-left-style", Initial: "none", AppliesTo: allElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.BorderStyle.Left }, lineStyles...)},
+	{Name: "border-top-color", Initial: "currentcolor", AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.BorderColor.Top })},
+	{Name: "border-right-color", Initial: "currentcolor", AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.BorderColor.Right })},
+	{Name: "border-bottom-color", Initial: "currentcolor", AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.BorderColor.Bottom })},
+	{Name: "border-left-color", Initial: "currentcolor", AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.BorderColor.Left })},
+
+	// CSS Backgrounds Level 3 §5 Rounded Corners
+	{Name: "border-top-left-radius", Initial: "0", AppliesTo: allElements, Percentages: borderBox},
+	{Name: "border-top-right-radius", Initial: "0", AppliesTo: allElements, Percentages: borderBox},
+	{Name: "border-bottom-right-radius", Initial: "0", AppliesTo: allElements, Percentages: borderBox},
+	{Name: "border-bottom-left-radius", Initial: "0", AppliesTo: allElements, Percentages: borderBox},
+
+	// CSS 2.1 §11 Visual effects
+	{Name: "overflow", Initial: "visible", AppliesTo: blockContainers},
+	{Name: "clip", Initial: "auto", AppliesTo: "absolutely positioned elements"},
+	{Name: "visibility", Initial: "visible", Inherited: true, AppliesTo: allElements},
+
+	// CSS 2.1 §14.2 The background
+	{Name: "background-color", Initial: "transparent", AppliesTo: allElements,
+		compute: colorValue(func(cs *ComputedStyle) *color.RGBA { return &cs.BackgroundColor })},
+	{Name: "background-image", Initial: "none", AppliesTo: allElements, compute: computeBackgroundImage},
+	{Name: "background-repeat", Initial: "repeat", AppliesTo: allElements},
+	{Name: "background-attachment", Initial: "scroll", AppliesTo: allElements},
+	{Name: "background-position", Initial: "0% 0%", AppliesTo: allElements, Percentages: "refer to the size of the box itself"},
+
+	// CSS Backgrounds Level 3 §3.7 to §3.9
+	{Name: "background-size", Initial: "auto", AppliesTo: allElements, Percentages: "see prose"},
+	{Name: "background-origin", Initial: "padding-box", AppliesTo: allElements},
+	{Name: "background-clip", Initial: "border-box", AppliesTo: allElements},
+
+	// CSS 2.1 §17 Tables
+	{Name: "caption-side", Initial: "top", Inherited: true, AppliesTo: "'table-caption' elements"},
+	{Name: "table-layout", Initial: "auto", AppliesTo: tableElements},
+	{Name: "border-collapse", Initial: "separate", Inherited: true, AppliesTo: tableElements,
+		compute: keyword(func(cs *ComputedStyle) *string { return &cs.BorderCollapse }, "separate", "collapse")},
+	{Name: "border-spacing", Initial: "0", Inherited: true, AppliesTo: tableElements,
+		compute: lengthValue(func(cs *ComputedStyle) *Length { return &cs.BorderSpacing }, false)},
+	{Name: "empty-cells", Initial: "show", Inherited: true, AppliesTo: tableCells},
+
+	// CSS 2.1 §18 User interface
+	{Name: "cursor", Initial: "auto", Inherited: true, AppliesTo: allElements},
+	{Name: "outline-width", Initial: "medium", AppliesTo: allElements},
+	{Name: "outline-style", Initial: "none", AppliesTo: allElements},
+	{Name: "outline-color", Initial: "invert", AppliesTo: allElements},
+
+	// CSS Flexbox Level 1 §5, §7
+	{Name: "flex-direction", Initial: "row", AppliesTo: flexContainers},
+	{Name: "flex-wrap", Initial: "nowrap", AppliesTo: flexContainers},
+	{Name: "flex-grow", Initial: "0", AppliesTo: flexItems},
+	{Name: "flex-shrink", Initial: "1", AppliesTo: flexItems},
+	{Name: "flex-basis", Initial: "auto", AppliesTo: flexItems, Percentages: "relative to the flex container's inner main size"},
+	{Name: "order", Initial: "0", AppliesTo: "flex items and grid items"},
+
+	// CSS Box Alignment Level 3 §5, §6, §8
+	{Name: "align-content", Initial: "normal", AppliesTo: "block containers, multicol containers, flex containers, and grid containers"},
+	{Name: "justify-content", Initial: "normal", AppliesTo: "multicol containers, flex containers, and grid containers"},
+	{Name: "align-items", Initial: "normal", AppliesTo: allElements},
+	{Name: "justify-items", Initial: "legacy", AppliesTo: allElements},
+	{Name: "align-self", Initial: "auto", AppliesTo: "flex items, grid items, and absolutely-positioned boxes"},
+	{Name: "justify-self", Initial: "auto", AppliesTo: "block-level boxes, absolutely-positioned boxes, and grid items"},
+	{Name: "row-gap", Initial: "normal", AppliesTo: "multi-column containers, flex containers, grid containers", Percentages: "refer to corresponding dimension of the content area"},
+	{Name: "column-gap", Initial: "normal", AppliesTo: "multi-column containers, flex containers, grid containers", Percentages: "refer to corresponding dimension of the content area"},
+
+	// CSS Multi-column Layout Level 1 §3
+	{Name: "column-width", Initial: "auto", AppliesTo: "block containers except table wrapper boxes"},
+	{Name: "column-count", Initial: "auto", AppliesTo: "block containers except table wrapper boxes"},
+
+	// CSS Transitions Level 1 §2
+	{Name: "transition-property", Initial: "all", AppliesTo: allElements},
+	{Name: "transition-duration", Initial: "0s", AppliesTo: allElements},
+	{Name: "transition-timing-function", Initial: "ease", AppliesTo: allElements},
+	{Name: "transition-delay", Initial: "0s", AppliesTo: allElements},
+
+	// CSS Animations Level 1 §3
+	{Name: "animation-name", Initial: "none", AppliesTo: allElements},
+	{Name: "animation-duration", Initial: "0s", AppliesTo: allElements},
+	{Name: "animation-timing-function", Initial: "ease", AppliesTo: allElements},
+	{Name: "animation-iteration-count", Initial: "1", AppliesTo: allElements},
+	{Name: "animation-direction", Initial: "normal", AppliesTo: allElements},
+	{Name: "animation-play-state", Initial: "running", AppliesTo: allElements},
+	{Name: "animation-delay", Initial: "0s", AppliesTo: allElements},
+	{Name: "animation-fill-mode", Initial: "none", AppliesTo: allElements},
+
+	// CSS Grid Level 2 §7, §8
+	{Name: "grid-template-rows", Initial: "none", AppliesTo: gridContainers, Percentages: "refer to corresponding dimension of the content area"},
+	{Name: "grid-template-columns", Initial: "none", AppliesTo: gridContainers, Percentages: "refer to corresponding dimension of the content area"},
+	{Name: "grid-template-areas", Initial: "none", AppliesTo: gridContainers},
+	{Name: "grid-auto-rows", Initial: "auto", AppliesTo: gridContainers, Percentages: "see prose"},
+	{Name: "grid-auto-columns", Initial: "auto", AppliesTo: gridContainers, Percentages: "see prose"},
+	{Name: "grid-auto-flow", Initial: "row", AppliesTo: gridContainers},
+	{Name: "grid-row-start", Initial: "auto", AppliesTo: gridItems},
+	{Name: "grid-row-end", Initial: "auto", AppliesTo: gridItems},
+	{Name: "grid-column-start", Initial: "auto", AppliesTo: gridItems},
+	{Name: "grid-column-end", Initial: "auto", AppliesTo: gridItems},
+
+	// CSS 2.1 §13 Paged media
+	{Name: "page-break-before", Initial: "auto", AppliesTo: blockLevel},
+	{Name: "page-break-after", Initial: "auto", AppliesTo: blockLevel},
+	{Name: "page-break-inside", Initial: "auto", Inherited: true, AppliesTo: blockLevel},
+	{Name: "orphans", Initial: "2", Inherited: true, AppliesTo: blockContainers},
+	{Name: "widows", Initial: "2", Inherited: true, AppliesTo: blockContainers},
+
+	// CSS 2.1 Appendix A Aural style sheets
+	{Name: "volume", Initial: "medium", Inherited: true, AppliesTo: allElements, Percentages: "refer to inherited value"},
+	{Name: "speak", Initial: "normal", Inherited: true, AppliesTo: allElements},
+	{Name: "pause-before", Initial: "0", AppliesTo: allElements, Percentages: "see prose"},
+	{Name: "pause-after", Initial: "0", AppliesTo: allElements, Percentages: "see prose"},
+	{Name: "cue-before", Initial: "none", AppliesTo: allElements},
+	{Name: "cue-after", Initial: "none", AppliesTo: allElements},
+	{Name: "play-during", Initial: "auto", AppliesTo: allElements},
+	{Name: "azimuth", Initial: "center", Inherited: true, AppliesTo: allElements},
+	{Name: "elevation", Initial: "level", Inherited: true, AppliesTo: allElements},
+	{Name: "speech-rate", Initial: "medium", Inherited: true, AppliesTo: allElements},
+	{Name: "voice-family", Inherited: true, AppliesTo: allElements},
+	{Name: "pitch", Initial: "medium", Inherited: true, AppliesTo: allElements},
+	{Name: "pitch-range", Initial: "50", Inherited: true, AppliesTo: allElements},
+	{Name: "stress", Initial: "50", Inherited: true, AppliesTo: allElements},
+	{Name: "richness", Initial: "50", Inherited: true, AppliesTo: allElements},
+	{Name: "speak-punctuation", Initial: "none", Inherited: true, AppliesTo: allElements},
+	{Name: "speak-numeral", Initial: "continuous", Inherited: true, AppliesTo: allElements},
+	{Name: "speak-header", Initial: "once", Inherited: true, AppliesTo: "elements that have table header information"},
+}
+
+// propertyIndex maps property names to their entries in propertyTable.
+var propertyIndex = func() map[string]*Property {
+	index := make(map[string]*Property, len(propertyTable))
+	for _, property := range propertyTable {
+		index[property.Name] = property
+	}
+	return index
+}()
+
+// LookupProperty returns the registry entry of the property name, or nil
+// if it is not in the registry.
+func LookupProperty(name string) *Property {
+	return propertyIndex[name]
+}
+
+// isInheritedProperty reports whether property is inherited by default.
+func isInheritedProperty(property string) bool {
+	p := LookupProperty(property)
+	return p != nil && p.Inherited
+}
+
+// cascade applies the declarations of an element or pseudo-element to its
+// styles, which start out holding the properties inherited from parent.
+type cascade struct {
+	styles  map[string]string
+	parent  map[string]string
+	matched []MatchedRule
+
+	// node is the element whose styles are cascaded, or nil for
+	// pseudo-elements. Its element defaults and list attributes belong to
+	// the user-agent origin 'revert' rolls back to.
+	node *dom.Node
+
+	// reverted holds, for the user and author origins, the styles the
+	// origins before them give the element, which 'revert' rolls their
+	// declarations back to. They are computed on first use.
+	reverted map[Origin]map[string]string
+
+	// trace records the declarations giving properties their values, or
+	// is nil (explain.go).
+	trace *cascadeTrace
+}
+
+// newCascade returns the cascade of declarations into styles, whose
+// inherited values come from parent. matched are the rules matching the
+// element, sorted by origin and specificity, which 'revert' looks through
+// for the declarations of earlier origins.
+func newCascade(styles, parent map[string]string, matched []MatchedRule) *cascade {
+	return &cascade{styles: styles, parent: parent, matched: matched}
+}
+
+// originDeclaration is a declaration with the origin it cascades in.
+type originDeclaration struct {
+	decl   *css.Declaration
+	origin Origin
+	inline bool // from the style attribute
+}
+
+// cascadeOrder returns the declarations of the matched rules, sorted by
+// origin and specificity, and of the style attribute in the order the
+// cascade applies them, each overriding those before it: normal
+// declarations by origin, user agent first, then important declarations
+// by origin in reverse. The style attribute follows the author rules of
+// the same importance.
+// CSS Cascading Level 4 §6.1 Cascade Sorting Order, CSS 2.1 §6.4.2
+func cascadeOrder(matched []MatchedRule, inline []*css.Declaration) []originDeclaration {
+	var order []originDeclaration
+	rules := func(origin Origin, important bool) {
+		for _, m := range matched {
+			if m.Origin != origin {
+				continue
+			}
+			for _, decl := range m.Rule.Declarations {
+				if decl.Important == important {
+					order = append(order, originDeclaration{decl: decl, origin: origin})
+				}
+			}
+		}
+	}
+	style := func(important bool) {
+		for _, decl := range inline {
+			if decl.Important == important {
+				order = append(order, originDeclaration{decl: decl, origin: AuthorOrigin, inline: true})
+			}
+		}
+	}
+
+	rules(UserAgentOrigin, false)
+	rules(UserOrigin, false)
+	rules(AuthorOrigin, false)
+	style(false)
+	rules(AuthorOrigin, true)
+	style(true)
+	rules(UserOrigin, true)
+	rules(UserAgentOrigin, true)
+	return order
+}
+
+// applyAll applies the declarations of the matched rules and of the style
+// attribute in cascade order.
+func (c *cascade) applyAll(inline []*css.Declaration) {
+	for _, d := range cascadeOrder(c.matched, inline) {
+		c.apply(d.decl, d.origin)
+	}
+}
+
+// apply applies a declaration from origin, expanding shorthand properties.
+// CSS 2.1 §8.3, §8.4: Shorthand properties are expanded to their longhand equivalents.
+// Custom properties are skipped, having been applied by cascadeCustomProperties,
+// and var() functions are substituted before expansion.
+func (c *cascade) apply(decl *css.Declaration, origin Origin) {
+	if css.IsCustomProperty(decl.Property) {
+		return
+	}
+	value, ok := substituteVars(decl, c.styles)
+	if !ok {
+		// CSS Variables Level 1 §3.1: a declaration invalid at
+		// computed-value time behaves as 'unset'
+		c.applyKeyword(decl.Property, "unset", origin)
+		c.trace.declaredLonghands(decl)
+		return
+	}
+	if keyword := strings.TrimSpace(value); css.IsCSSWideKeyword(keyword) {
+		c.applyKeyword(decl.Property, strings.ToLower(keyword), origin)
+		c.trace.declaredLonghands(decl)
+		return
+	}
+	for prop, val := range expandShorthand(decl.Property, value) {
+		c.styles[prop] = val
+		c.trace.declared(prop, decl)
+	}
+}
+
+// applyKeyword sets the longhands of property to the values the CSS-wide
+// keyword gives them: 'inherit' takes the parent's value, 'initial' the
+// property's initial value, and 'unset' either, depending on whether the
+// property is inherited. 'revert' rolls an author or user declaration back
+// to the origins before its own, and otherwise acts as 'unset'.
+// CSS Cascading Level 4 §7.3 Explicit Defaulting
+func (c *cascade) applyKeyword(property, keyword string, origin Origin) {
+	for _, longhand := range shorthandLonghands(property) {
+		switch {
+		case keyword == "revert" && origin != UserAgentOrigin:
+			setOrDelete(c.styles, longhand, c.revertedStyles(origin)[longhand])
+		case keyword == "inherit" || (keyword != "initial" && isInheritedProperty(longhand)):
+			setOrDelete(c.styles, longhand, c.parent[longhand])
+		default:
+			// Properties whose initial value depends on the user agent
+			// are left absent from styles
+			initial := ""
+			if p := LookupProperty(longhand); p != nil {
+				initial = p.Initial
+			}
+			setOrDelete(c.styles, longhand, initial)
+		}
+	}
+}
+
+// revertedStyles returns the styles of the element's cascade restricted
+// to the origins before origin, the user-agent origin including the
+// element's default styles.
+// CSS Cascading Level 4 §7.3.4: 'revert' rolls back the cascade to the
+// previous origin
+func (c *cascade) revertedStyles(origin Origin) map[string]string {
+	if styles, ok := c.reverted[origin]; ok {
+		return styles
+	}
+	var matched []MatchedRule
+	for _, m := range c.matched {
+		if m.Origin < origin {
+			matched = append(matched, m)
+		}
+	}
+	rolledBack := newCascade(inheritStyles(c.parent), c.parent, matched)
+	// var() in the declarations of earlier origins refers to the element's
+	// custom properties
+	for prop, val := range c.styles {
+		if css.IsCustomProperty(prop) {
+			rolledBack.styles[prop] = val
+		}
+	}
+	order := cascadeOrder(matched, nil)
+	next := 0
+	if c.node != nil {
+		// The element defaults and list attributes apply around the
+		// user-agent normal declarations, as in cascadeElement
+		applyElementDefaults(c.node, rolledBack.styles)
+		for ; next < len(order) && order[next].origin == UserAgentOrigin && !order[next].decl.Important; next++ {
+			rolledBack.apply(order[next].decl, order[next].origin)
+		}
+		applyListCounters(c.node, rolledBack.styles)
+	}
+	for _, d := range order[next:] {
+		rolledBack.apply(d.decl, d.origin)
+	}
+
+	if c.reverted == nil {
+		c.reverted = make(map[Origin]map[string]string)
+	}
+	c.reverted[origin] = rolledBack.styles
+	return rolledBack.styles
+}
+
+// setOrDelete sets property to value in styles, or removes it if value is
+// empty.
+func setOrDelete(styles map[string]string, property, value string) {
+	if value == "" {
+		delete(styles, property)
+	} else {
+		styles[property] = value
+	}
+}
@@ -0,0 +1,182 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestPropertyRegistry tests registry entries against the CSS 2.1 property
+// table.
+// CSS 2.1 Appendix F Full property table
+func TestPropertyRegistry(t *testing.T) {
+	tests := []struct {
+		name        string
+		initial     string
+		inherited   bool
+		percentages string
+	}{
+		{"color", initialColor, true, ""},
+		{"font-size", "medium", true, "refer to inherited font size"},
+		{"width", "auto", false, "refer to width of containing block"},
+		{"top", "auto", false, "refer to height of containing block"},
+		{"padding-left", "0", false, "refer to width of containing block"},
+		{"border-collapse", "separate", true, ""},
+		{"border-spacing", "0", true, ""},
+		{"visibility", "visible", true, ""},
+		{"text-indent", "0", true, "refer to width of containing block"},
+		{"vertical-align", "baseline", false, "refer to the 'line-height' of the element itself"},
+		{"text-decoration-line", "none", false, ""},
+		{"counter-set", "none", false, ""},
+		{"voice-family", "", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := LookupProperty(tt.name)
+			if p == nil {
+				t.Fatalf("No registry entry for %s", tt.name)
+			}
+			if p.Initial != tt.initial || p.Inherited != tt.inherited || p.Percentages != tt.percentages {
+				t.Errorf("Expected initial %q, inherited %v, percentages %q, got %q, %v, %q",
+					tt.initial, tt.inherited, tt.percentages, p.Initial, p.Inherited, p.Percentages)
+			}
+			if p.AppliesTo == "" {
+				t.Errorf("Expected %s to say what it applies to", tt.name)
+			}
+		})
+	}
+
+	if LookupProperty("--custom") != nil || LookupProperty("margin") != nil {
+		t.Error("Expected custom properties and shorthands to be missing from the registry")
+	}
+}
+
+// TestCSSWideKeywords tests 'inherit', 'initial', 'unset' and 'revert' on
+// longhands and shorthands.
+// CSS Cascading Level 4 §7.3 Explicit Defaulting
+func TestCSSWideKeywords(t *testing.T) {
+	stylesheet := css.Parse(`
+		body { color: red; margin: 4px; visibility: hidden; border-collapse: collapse; }
+		div { color: initial; margin: inherit; visibility: unset; width: 10px; }
+		div { width: unset; border-collapse: INITIAL; }
+		p { color: unset; font-size: initial; padding: 2px; text-decoration: inherit; }
+		h1 { font-weight: normal; margin: 0; display: inline; }
+		h1 { font-weight: revert; margin: revert; display: revert; }
+		td { padding: 5px; }
+		td { padding: revert; }
+		em { display: block; }
+		em { display: revert; }
+	`)
+	doc := html.Parse(`<html><body><div><p style="padding-left: unset">text</p></div>` +
+		`<h1>title</h1><table><tr><td>cell</td></tr></table><em>em</em></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"div", "color", initialColor},
+		{"div", "margin-top", "4px"},
+		{"div", "margin-left", "4px"},
+		{"div", "visibility", "hidden"},
+		{"div", "width", "auto"},
+		{"div", "border-collapse", "separate"},
+		{"p", "color", initialColor},
+		{"p", "font-size", "13px"},
+		{"p", "padding-top", "2px"},
+		{"p", "padding-left", "0"},
+		{"p", "text-decoration-line", ""},
+		{"h1", "font-weight", "bold"},
+		{"h1", "margin-top", "17.42px"},
+		{"h1", "display", "block"},
+		{"td", "padding-top", "1px"},
+		{"em", "display", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestRevertElementDefaults tests that 'revert' rolls back to the default
+// styles of elements and attributes, which belong to the user-agent origin
+// even when its stylesheet does not set them.
+// CSS Cascading Level 4 §7.3.4 Rolling back cascade origins
+func TestRevertElementDefaults(t *testing.T) {
+	author := css.Parse(`
+		b { font-weight: normal; }
+		b { font-weight: revert; }
+		u { text-decoration: none; }
+		u { text-decoration: revert; }
+		p { direction: ltr; }
+		p { direction: revert; }
+		ol { counter-reset: none; }
+		ol { counter-reset: revert; }
+	`)
+	doc := html.Parse(`<html><body><p dir="rtl"><b>bold</b> <u>underlined</u></p>` +
+		`<ol start="3"><li>item</li></ol></body></html>`)
+	styled := StyleTreeWithOptions(doc, author, Options{
+		Media:               DefaultOptions().Media,
+		UserAgentStylesheet: css.Parse(""),
+	})
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"b", "font-weight", "700"},
+		{"u", "text-decoration-line", "underline"},
+		{"p", "direction", "rtl"},
+		{"ol", "counter-reset", "list-item 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCascadeOrigin tests that author rules win over user-agent rules
+// whatever their specificity, and that rules of equal specificity apply
+// in source order.
+// CSS 2.1 §6.4.1 Cascading order
+func TestCascadeOrigin(t *testing.T) {
+	stylesheet := css.Parse(`
+		* { display: inline; }
+		.a { color: red; }
+		.b { color: green; }
+		.c { color: blue; }
+	`)
+	doc := html.Parse(`<html><body><div class="a b c">text</div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	div := findStyledNode(styled, "div")
+	if div == nil {
+		t.Fatal("No styled node for <div>")
+	}
+	if div.Styles["display"] != "inline" {
+		t.Errorf("Expected the author's display to win, got %q", div.Styles["display"])
+	}
+	if div.Styles["color"] != "blue" {
+		t.Errorf("Expected the last rule's color, got %q", div.Styles["color"])
+	}
+}
@@ -0,0 +1,375 @@
+package style
+
+// This file speeds up selector matching. Rules are indexed by the rightmost
+// compound selector of each of their selectors, so an element is only
+// tested against the rules that could match it, and a bloom filter of the
+// element's ancestors rejects selectors whose ancestors it cannot have
+// without walking up the tree.
+//
+// Spec references:
+// - CSS 2.1 §5 Selectors: https://www.w3.org/TR/CSS21/selector.html
+// - Selectors Level 4 §3.1 Structure and Terminology (the subject of a selector): https://www.w3.org/TR/selectors-4/#structure
+//
+// Implemented:
+// - Selectors bucketed by the ID, first class or tag of their rightmost
+//   compound selector, with a universal bucket for the others
+// - Origin and specificity computed once per selector
+// - A counting bloom filter of the tags, IDs and classes of the ancestors
+//   of the element being styled, kept up to date by the style tree walk
+// - Which buckets hold position-dependent selectors, and which IDs and
+//   classes selectors name, for style sharing
+//
+// Not implemented:
+// - Buckets for attribute selectors and pseudo-classes
+// - Ancestor filtering of the arguments of :is(), :where() and :has()
+
+import (
+	"slices"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// indexedSelector is one selector of a rule, with what matching needs to
+// know about it computed in advance.
+type indexedSelector struct {
+	rule        *css.Rule
+	selector    *css.Selector
+	origin      Origin
+	specificity Specificity
+
+	// pseudo is the pseudo-element the selector targets, or "" for
+	// elements.
+	pseudo string
+
+	// order is the position of the selector in the stylesheet, counting
+	// every selector of every rule, so that candidates from different
+	// buckets can be put back in source order.
+	order int
+
+	// ancestorHashes are the hashes of the tags, IDs and classes an
+	// element's ancestors must have for the selector to match it.
+	ancestorHashes []uint32
+}
+
+// ruleIndex holds the selectors of a stylesheet bucketed by their rightmost
+// compound selector. A selector is only in one bucket: the one for its ID
+// if it has one, else for its first class, else for its tag, else the
+// universal bucket.
+type ruleIndex struct {
+	byID      map[string][]*indexedSelector
+	byClass   map[string][]*indexedSelector
+	byTag     map[string][]*indexedSelector
+	universal []*indexedSelector
+
+	// The buckets holding positional selectors of elements (not of
+	// pseudo-elements), see positionalSelector.
+	positionalIDs       map[string]bool
+	positionalClasses   map[string]bool
+	positionalTags      map[string]bool
+	positionalUniversal bool
+
+	// ids and classes are the IDs and classes named anywhere in a
+	// selector, including in the arguments of pseudo-classes.
+	ids     map[string]bool
+	classes map[string]bool
+}
+
+// newRuleIndex indexes rules, the first userAgentRules of which come from
+// the user-agent stylesheet and the next userRules from the user's.
+func newRuleIndex(rules []*css.Rule, userAgentRules, userRules int) *ruleIndex {
+	idx := &ruleIndex{
+		byID:    make(map[string][]*indexedSelector),
+		byClass: make(map[string][]*indexedSelector),
+		byTag:   make(map[string][]*indexedSelector),
+
+		positionalIDs:     make(map[string]bool),
+		positionalClasses: make(map[string]bool),
+		positionalTags:    make(map[string]bool),
+
+		ids:     make(map[string]bool),
+		classes: make(map[string]bool),
+	}
+
+	order := 0
+	for i, rule := range rules {
+		origin := AuthorOrigin
+		switch {
+		case i < userAgentRules:
+			origin = UserAgentOrigin
+		case i < userAgentRules+userRules:
+			origin = UserOrigin
+		}
+		for _, selector := range rule.Selectors {
+			order++
+			idx.addNames(selector)
+			pseudo, ok := selectorPseudoElement(selector)
+			if !ok || len(selector.Simple) == 0 {
+				// The selector never matches
+				continue
+			}
+			entry := &indexedSelector{
+				rule:           rule,
+				selector:       selector,
+				origin:         origin,
+				specificity:    calculateSpecificity(selector),
+				pseudo:         pseudo,
+				order:          order,
+				ancestorHashes: ancestorHashes(selector),
+			}
+
+			positional := pseudo == "" && positionalSelector(selector)
+			subject := selector.Simple[len(selector.Simple)-1]
+			switch {
+			case subject.ID != "":
+				idx.byID[subject.ID] = append(idx.byID[subject.ID], entry)
+				idx.positionalIDs[subject.ID] = idx.positionalIDs[subject.ID] || positional
+			case len(subject.Classes) > 0:
+				class := subject.Classes[0]
+				idx.byClass[class] = append(idx.byClass[class], entry)
+				idx.positionalClasses[class] = idx.positionalClasses[class] || positional
+			case subject.TagName != "" && subject.TagName != "*":
+				idx.byTag[subject.TagName] = append(idx.byTag[subject.TagName], entry)
+				idx.positionalTags[subject.TagName] = idx.positionalTags[subject.TagName] || positional
+			default:
+				idx.universal = append(idx.universal, entry)
+				idx.positionalUniversal = idx.positionalUniversal || positional
+			}
+		}
+	}
+	return idx
+}
+
+// candidates returns the selectors that may match node, in source order.
+// Every selector that matches node is among them.
+func (idx *ruleIndex) candidates(node *dom.Node) []*indexedSelector {
+	candidates := slices.Clone(idx.universal)
+	candidates = append(candidates, idx.byTag[node.Data]...)
+	if id := node.ID(); id != "" {
+		candidates = append(candidates, idx.byID[id]...)
+	}
+	classes := node.Classes()
+	for i, class := range classes {
+		// A class listed twice must not add its selectors twice
+		if !slices.Contains(classes[:i], class) {
+			candidates = append(candidates, idx.byClass[class]...)
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b *indexedSelector) int {
+		return a.order - b.order
+	})
+	return candidates
+}
+
+// addNames records the IDs and classes named in selector.
+func (idx *ruleIndex) addNames(selector *css.Selector) {
+	for _, simple := range selector.Simple {
+		if simple.ID != "" {
+			idx.ids[simple.ID] = true
+		}
+		for _, class := range simple.Classes {
+			idx.classes[class] = true
+		}
+		for _, fn := range simple.PseudoFunctions {
+			for _, argument := range fn.Selectors {
+				idx.addNames(argument)
+			}
+		}
+	}
+}
+
+// positional reports whether a positional selector may match node, so that
+// its styles depend on more than its tag, attributes and ancestors.
+func (idx *ruleIndex) positional(node *dom.Node) bool {
+	if idx.positionalUniversal || idx.positionalTags[node.Data] {
+		return true
+	}
+	if id := node.ID(); id != "" && idx.positionalIDs[id] {
+		return true
+	}
+	for _, class := range node.Classes() {
+		if idx.positionalClasses[class] {
+			return true
+		}
+	}
+	return false
+}
+
+// positionalSelector reports whether matching selector may depend on the
+// siblings or children of the element or its ancestors: whether it has a
+// sibling combinator, a tree-structural pseudo-class or :has(), directly
+// or inside :is(), :where() or :not().
+// Selectors Level 4 §14 Tree-Structural pseudo-classes, §4.5 :has()
+func positionalSelector(selector *css.Selector) bool {
+	for i, simple := range selector.Simple {
+		if i < len(selector.Simple)-1 {
+			switch selector.CombinatorAt(i) {
+			case css.AdjacentSiblingCombinator, css.GeneralSiblingCombinator:
+				return true
+			}
+		}
+		for _, pseudoClass := range simple.PseudoClasses {
+			switch pseudoClass {
+			case "root", "empty", "first-child", "last-child", "only-child",
+				"first-of-type", "last-of-type", "only-of-type":
+				return true
+			}
+		}
+		for _, fn := range simple.PseudoFunctions {
+			switch fn.Name {
+			case "is", "where", "not":
+				if slices.ContainsFunc(fn.Selectors, positionalSelector) {
+					return true
+				}
+			default:
+				// :nth-*() and :has()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ancestorHashes returns the hashes of the tags, IDs and classes that the
+// ancestors of an element matching selector must have. These are the
+// compound selectors followed by a descendant or child combinator: those
+// followed by a sibling combinator match a sibling of an ancestor or of
+// the element, which the filter does not track.
+func ancestorHashes(selector *css.Selector) []uint32 {
+	var hashes []uint32
+	for i := len(selector.Simple) - 2; i >= 0; i-- {
+		switch selector.CombinatorAt(i) {
+		case css.DescendantCombinator, css.ChildCombinator:
+		default:
+			continue
+		}
+		simple := selector.Simple[i]
+		if simple.TagName != "" && simple.TagName != "*" {
+			hashes = append(hashes, filterHash(tagHash, simple.TagName))
+		}
+		if simple.ID != "" {
+			hashes = append(hashes, filterHash(idHash, simple.ID))
+		}
+		for _, class := range simple.Classes {
+			hashes = append(hashes, filterHash(classHash, class))
+		}
+	}
+	return hashes
+}
+
+// The kinds of names kept in an ancestorFilter, hashed apart so that e.g.
+// a class and a tag of the same name do not collide.
+const (
+	tagHash byte = iota
+	idHash
+	classHash
+)
+
+// filterHash hashes a name of the given kind with 32-bit FNV-1a.
+func filterHash(kind byte, name string) uint32 {
+	const offset, prime = 2166136261, 16777619
+	hash := uint32(offset)
+	hash = (hash ^ uint32(kind)) * prime
+	for i := 0; i < len(name); i++ {
+		hash = (hash ^ uint32(name[i])) * prime
+	}
+	return hash
+}
+
+// ancestorFilterBits is the number of bits of a hash that index an
+// ancestorFilter's counters; each hash sets two counters.
+const ancestorFilterBits = 12
+
+// ancestorFilter is a counting bloom filter of the tags, IDs and classes of
+// a stack of elements: the ancestors of the element being styled. It can
+// tell that no ancestor has a name, but not that one has; counters are
+// counts so that leaving an element removes its names again.
+type ancestorFilter struct {
+	counters [1 << ancestorFilterBits]uint8
+
+	// elements are the elements whose names are in the filter, outermost
+	// first.
+	elements []*dom.Node
+
+	// hashes is scratch space for the hashes of an element's names.
+	hashes []uint32
+}
+
+// push adds the names of element to the filter.
+func (f *ancestorFilter) push(element *dom.Node) {
+	f.elements = append(f.elements, element)
+	f.hashes = elementHashes(f.hashes[:0], element)
+	for _, hash := range f.hashes {
+		for _, i := range filterIndexes(hash) {
+			// A saturated counter stays saturated: it no longer knows how
+			// many names set it
+			if f.counters[i] < 255 {
+				f.counters[i]++
+			}
+		}
+	}
+}
+
+// pop removes the names of the innermost element from the filter.
+func (f *ancestorFilter) pop() {
+	element := f.elements[len(f.elements)-1]
+	f.elements = f.elements[:len(f.elements)-1]
+	f.hashes = elementHashes(f.hashes[:0], element)
+	for _, hash := range f.hashes {
+		for _, i := range filterIndexes(hash) {
+			if f.counters[i] < 255 {
+				f.counters[i]--
+			}
+		}
+	}
+}
+
+// clone returns a copy of the filter, for styling a subtree on another
+// goroutine.
+func (f *ancestorFilter) clone() *ancestorFilter {
+	return &ancestorFilter{counters: f.counters, elements: slices.Clone(f.elements)}
+}
+
+// covers reports whether the filter holds exactly the ancestors of node,
+// so that it can answer for node's selectors.
+func (f *ancestorFilter) covers(node *dom.Node) bool {
+	var innermost *dom.Node
+	if len(f.elements) > 0 {
+		innermost = f.elements[len(f.elements)-1]
+	}
+	return innermost == parentElement(node)
+}
+
+// mightContainAll reports whether every hash may be the name of an element
+// in the filter. False means that at least one of them is not.
+func (f *ancestorFilter) mightContainAll(hashes []uint32) bool {
+	for _, hash := range hashes {
+		for _, i := range filterIndexes(hash) {
+			if f.counters[i] == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// filterIndexes returns the two counters a hash sets, taken from its low
+// and high bits.
+func filterIndexes(hash uint32) [2]uint32 {
+	const mask = 1<<ancestorFilterBits - 1
+	return [2]uint32{hash & mask, (hash >> ancestorFilterBits) & mask}
+}
+
+// elementHashes appends the hashes of element's tag, ID and classes to
+// hashes.
+func elementHashes(hashes []uint32, element *dom.Node) []uint32 {
+	hashes = append(hashes, filterHash(tagHash, element.Data))
+	if id := element.ID(); id != "" {
+		hashes = append(hashes, filterHash(idHash, id))
+	}
+	for _, class := range element.Classes() {
+		hashes = append(hashes, filterHash(classHash, class))
+	}
+	return hashes
+}
@@ -0,0 +1,318 @@
+package style
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/html"
+)
+
+// matchAllRules matches node against every rule of stylesheet, as
+// matchRules did before rules were indexed, each rule with its most
+// specific matching selector. The first userAgentRules rules
+// are the user agent's.
+func matchAllRules(stylesheet *css.Stylesheet, userAgentRules int, node *dom.Node, pseudo string) []MatchedRule {
+	matched := make([]MatchedRule, 0)
+	for i, rule := range stylesheet.Rules {
+		var best *MatchedRule
+		for _, selector := range rule.Selectors {
+			if target, ok := selectorPseudoElement(selector); !ok || target != pseudo {
+				continue
+			}
+			if !matchesSelector(node, selector) {
+				continue
+			}
+			specificity := calculateSpecificity(selector)
+			if best == nil {
+				origin := AuthorOrigin
+				if i < userAgentRules {
+					origin = UserAgentOrigin
+				}
+				best = &MatchedRule{Rule: rule, Origin: origin}
+			} else if specificity.Compare(best.Specificity) <= 0 {
+				continue
+			}
+			best.Selector, best.Specificity = selector, specificity
+		}
+		if best != nil {
+			matched = append(matched, *best)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Origin != matched[j].Origin {
+			return matched[i].Origin < matched[j].Origin
+		}
+		return matched[i].Specificity.Compare(matched[j].Specificity) < 0
+	})
+	return matched
+}
+
+// TestRuleIndex tests that indexed matching with the ancestor filter finds
+// the same rules, in the same order, as testing every rule.
+// CSS 2.1 §5 Selectors, §6.4.1 Cascading order
+func TestRuleIndex(t *testing.T) {
+	stylesheet := css.Parse(`
+		p { color: red; }
+		* { margin: 0; }
+		.a { color: green; }
+		#main .a { color: blue; }
+		div > p.a.b { color: gray; }
+		.b, p, .a { color: black; }
+		p, #main .a { color: fuchsia; }
+		section p { color: olive; }
+		article p { color: navy; }
+		h1 + p { color: teal; }
+		h1 ~ .b { color: lime; }
+		.x section > * { color: maroon; }
+		p:first-child { color: purple; }
+		:is(p, span).a { color: silver; }
+		div:has(> span) { color: aqua; }
+		p::before { content: "x"; }
+		.a::after { content: "y"; }
+		li::marker { color: red; }
+		#main { color: yellow; }
+	`)
+	doc := html.Parse(`<html><body class="x"><div id="main"><h1>t</h1><p class="a b a">one</p>` +
+		`<section><p class="b">two</p><span class="a">three</span></section></div>` +
+		`<ul><li class="a">item</li></ul><article><p>four</p></article></body></html>`)
+
+	ctx := newStyleContext(stylesheet, 2, 0, css.DefaultMediaEnvironment())
+	elements := 0
+	var walk func(node *dom.Node)
+	walk = func(node *dom.Node) {
+		if node.Type == dom.ElementNode {
+			elements++
+			for _, pseudo := range []string{"", "before", "after", "marker"} {
+				got := ctx.matchRules(node, pseudo)
+				expected := matchAllRules(stylesheet, 2, node, pseudo)
+				if fmt.Sprint(got) != fmt.Sprint(expected) {
+					t.Errorf("<%s class=%q> %q: expected %v, got %v", node.Data, node.GetAttribute("class"), pseudo, expected, got)
+				}
+			}
+			ctx.ancestors.push(node)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+		if node.Type == dom.ElementNode {
+			ctx.ancestors.pop()
+		}
+	}
+	walk(doc)
+
+	if elements < 12 {
+		t.Fatalf("Expected to test every element, tested %d", elements)
+	}
+	if len(ctx.ancestors.elements) != 0 {
+		t.Errorf("Expected the ancestor filter to be empty after the walk, got %d elements", len(ctx.ancestors.elements))
+	}
+}
+
+// TestRuleIndexBuckets tests which bucket a selector is indexed under.
+func TestRuleIndexBuckets(t *testing.T) {
+	idx := newRuleIndex(css.Parse(`
+		div#main.a { color: red; }
+		div.a.b { color: red; }
+		span .c > div { color: red; }
+		:first-child, *.d { color: red; }
+		p:nth-child(2) { color: red; }
+		a::before::after { color: red; }
+	`).Rules, 0, 0)
+
+	if len(idx.byID["main"]) != 1 || len(idx.byClass["a"]) != 1 || len(idx.byClass["d"]) != 1 {
+		t.Errorf("Expected ID and first-class buckets, got %v and %v", idx.byID, idx.byClass)
+	}
+	if len(idx.byClass["b"]) != 0 {
+		t.Error("Expected a selector to be indexed under its first class only")
+	}
+	if len(idx.byTag["div"]) != 1 || len(idx.byTag["p"]) != 1 || len(idx.byTag["span"]) != 0 {
+		t.Errorf("Expected tag buckets for the rightmost compound selectors, got %v", idx.byTag)
+	}
+	if len(idx.universal) != 1 {
+		t.Errorf("Expected one universal selector, got %d", len(idx.universal))
+	}
+	if len(idx.byTag["a"]) != 0 {
+		t.Error("Expected a selector with two pseudo-elements not to be indexed")
+	}
+
+	// span .c > div needs a span and a .c ancestor
+	descendant := idx.byTag["div"][0]
+	if len(descendant.ancestorHashes) != 2 {
+		t.Errorf("Expected 2 ancestor hashes, got %d", len(descendant.ancestorHashes))
+	}
+}
+
+// TestAncestorFilter tests that the filter never rejects the names of the
+// elements in it, and forgets an element's names when it is popped.
+func TestAncestorFilter(t *testing.T) {
+	doc := html.Parse(`<html><body><div id="main" class="a b"><p class="c">text</p></div></body></html>`)
+	div := findNode(doc, "div")
+	p := findNode(doc, "p")
+
+	f := &ancestorFilter{}
+	f.push(div)
+	if !f.covers(p) || f.covers(div) {
+		t.Error("Expected the filter holding <div> to cover its child only")
+	}
+	if !f.mightContainAll([]uint32{filterHash(tagHash, "div"), filterHash(idHash, "main"), filterHash(classHash, "b")}) {
+		t.Error("Expected the filter to contain the names of <div>")
+	}
+	if f.mightContainAll([]uint32{filterHash(classHash, "div")}) {
+		t.Error("Expected a class named like a tag not to be in the filter")
+	}
+
+	f.push(p)
+	f.pop()
+	if f.mightContainAll([]uint32{filterHash(classHash, "c")}) {
+		t.Error("Expected the names of a popped element to be removed")
+	}
+	f.pop()
+	for i, counter := range f.counters {
+		if counter != 0 {
+			t.Fatalf("Expected an empty filter, counter %d is %d", i, counter)
+		}
+	}
+
+	// A saturated counter must not forget the names still in the filter
+	for range 300 {
+		f.push(div)
+	}
+	for range 299 {
+		f.pop()
+	}
+	if !f.mightContainAll([]uint32{filterHash(idHash, "main")}) {
+		t.Error("Expected a saturated counter to stay set")
+	}
+}
+
+// findNode returns the first element named tag in document order.
+func findNode(node *dom.Node, tag string) *dom.Node {
+	if node.Type == dom.ElementNode && node.Data == tag {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findNode(child, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// largeDocument generates a page of sections of nested articles, the kind
+// of tree where descendant selectors walk far up, and a stylesheet with
+// rules for every class it uses.
+func largeDocument(sections int) (*dom.Node, *css.Stylesheet) {
+	var page strings.Builder
+	page.WriteString(`<html><body><div id="page" class="layout">`)
+	for i := 0; i < sections; i++ {
+		fmt.Fprintf(&page, `<section class="section s%d"><h2 class="title">Section</h2>`, i%20)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&page, `<article class="card c%d"><div class="body"><p class="text">Some <em>text</em> and <a href="#">a link</a></p>`, j)
+			page.WriteString(`<ul class="list"><li class="item">one</li><li class="item">two</li></ul></div></article>`)
+		}
+		page.WriteString(`</section>`)
+	}
+	page.WriteString(`</div></body></html>`)
+
+	var rules strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&rules, ".s%d .title { color: red; }\n", i)
+		fmt.Fprintf(&rules, ".s%d .card .text em { font-weight: bold; }\n", i)
+		fmt.Fprintf(&rules, "#sidebar .s%d a { color: blue; }\n", i)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&rules, ".c%d > .body { padding: %dpx; }\n", i, i)
+		fmt.Fprintf(&rules, "nav .c%d li { margin: 0; }\n", i)
+	}
+	rules.WriteString(`
+		.layout section { margin: 10px; }
+		footer p, aside p, header p { color: gray; }
+		.list .item:first-child { color: green; }
+		.card:nth-child(2n) { background: #eee; }
+		article ul li a em { color: black; }
+	`)
+	return html.Parse(page.String()), css.Parse(rules.String())
+}
+
+// BenchmarkStyleTree styles a generated page of 100 sections with about
+// 8000 elements and 100 rules, and test/hackernews.html, with and without
+// style sharing, on one goroutine.
+func BenchmarkStyleTree(b *testing.B) {
+	generated, generatedStylesheet := largeDocument(100)
+	source, err := os.ReadFile("../test/hackernews.html")
+	if err != nil {
+		b.Fatal(err)
+	}
+	hackerNews := html.Parse(string(source))
+	hackerNewsStylesheet := LoadStylesheets(hackerNews, "../test/hackernews.html")
+
+	pages := []struct {
+		name       string
+		doc        *dom.Node
+		stylesheet *css.Stylesheet
+	}{
+		{"generated", generated, generatedStylesheet},
+		{"hackernews", hackerNews, hackerNewsStylesheet},
+	}
+	for _, page := range pages {
+		for _, sharing := range []bool{true, false} {
+			name := page.name + "/shared"
+			if !sharing {
+				name = page.name + "/unshared"
+			}
+			b.Run(name, func(b *testing.B) {
+				opts := DefaultOptions()
+				opts.DisableStyleSharing = !sharing
+				opts.Parallelism = 1
+				for i := 0; i < b.N; i++ {
+					StyleTreeWithOptions(page.doc, page.stylesheet, opts)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkMatchRules matches every element of the generated page against
+// its stylesheet: "indexed" as styling does, "all rules" by testing every
+// rule as matching did before rules were indexed.
+func BenchmarkMatchRules(b *testing.B) {
+	doc, stylesheet := largeDocument(100)
+	merged := &css.Stylesheet{Rules: append(DefaultUserAgentStylesheet().Rules, stylesheet.Rules...)}
+	userAgentRules := len(DefaultUserAgentStylesheet().Rules)
+	var elements []*dom.Node
+	elements = appendDescendantElements(elements, doc)
+
+	b.Run("indexed", func(b *testing.B) {
+		ctx := newStyleContext(merged, userAgentRules, 0, css.DefaultMediaEnvironment())
+		var walk func(node *dom.Node)
+		walk = func(node *dom.Node) {
+			if node.Type != dom.ElementNode {
+				return
+			}
+			ctx.matchRules(node, "")
+			ctx.ancestors.push(node)
+			for _, child := range node.Children {
+				walk(child)
+			}
+			ctx.ancestors.pop()
+		}
+		root := findNode(doc, "html")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			walk(root)
+		}
+	})
+
+	b.Run("all rules", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, element := range elements {
+				matchAllRules(merged, userAgentRules, element, "")
+			}
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package style
+
+// This file implements the style sharing cache. Pages often have many
+// structurally identical elements, such as the rows of a listing, which
+// the cascade gives identical styles. An element whose styles can only
+// depend on its tag, its attributes and its parent's styles reuses the
+// styles of an earlier element with the same tag, parent styles and
+// attributes, as far as styling can see them, instead of matching and
+// cascading again.
+//
+// Sharing is sound because shared styles are the same map and ComputedStyle,
+// so two elements whose parents have the same ComputedStyle have ancestors
+// that were found equivalent all the way up: the same tags, and the same
+// attributes as far as selectors and presentational hints can see them,
+// which is all that non-positional selectors depend on.
+//
+// Spec references:
+// - CSS 2.1 §6 Assigning property values, Cascading, and Inheritance: https://www.w3.org/TR/CSS21/cascade.html
+// - Selectors Level 4 §14 Tree-Structural pseudo-classes: https://www.w3.org/TR/selectors-4/#structural-pseudos
+//
+// Implemented:
+// - Sharing between siblings, cousins and any other elements with equal
+//   parent styles, tags and attributes, ignoring attributes, IDs and
+//   classes that no selector or presentational hint reads
+// - Text nodes sharing the styles inherited from equal parent styles
+// - Correctness guards: no sharing for the root element, for elements whose
+//   direction depends on their text, or when a positional selector may
+//   match the element
+// - Counts of styled and shared nodes (Options.Stats)
+//
+// Not implemented:
+// - Sharing the styles of ::before, ::after and ::marker
+// - A bound on the cache size: it keeps one node per distinct key for the
+//   whole document
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lukehoban/browser/dom"
+)
+
+// Stats counts the nodes style computation styled and how many of them
+// reused the styles of an earlier node.
+type Stats struct {
+	Elements       int // Elements styled
+	SharedElements int // Elements that reused an earlier element's styles
+	Texts          int // Text nodes styled
+	SharedTexts    int // Text nodes that reused an earlier text node's styles
+}
+
+// HitRate returns the fraction of elements that reused the styles of an
+// earlier element.
+func (s Stats) HitRate() float64 {
+	if s.Elements == 0 {
+		return 0
+	}
+	return float64(s.SharedElements) / float64(s.Elements)
+}
+
+// add adds the counts of other to s.
+func (s *Stats) add(other Stats) {
+	s.Elements += other.Elements
+	s.SharedElements += other.SharedElements
+	s.Texts += other.Texts
+	s.SharedTexts += other.SharedTexts
+}
+
+// count records that node was styled, reusing earlier styles if shared.
+func (s *Stats) count(node *dom.Node, shared bool) {
+	switch node.Type {
+	case dom.ElementNode:
+		s.Elements++
+		if shared {
+			s.SharedElements++
+		}
+	case dom.TextNode:
+		s.Texts++
+		if shared {
+			s.SharedTexts++
+		}
+	}
+}
+
+// sharingKey identifies the styles of the nodes that share them.
+type sharingKey struct {
+	// parent is the computed style of the node's parent. Nodes only have
+	// the same one if their parents shared their styles.
+	parent *ComputedStyle
+
+	nodeType dom.NodeType
+	tag      string
+
+	// attributes is what styling can see of the node's attributes.
+	attributes string
+}
+
+// styleSharingCache maps the keys of styled nodes to the first node styled
+// with each key. It is safe for use by the workers styling subtrees in
+// parallel.
+type styleSharingCache struct {
+	mu      sync.Mutex
+	entries map[sharingKey]*StyledNode
+}
+
+// newStyleSharingCache returns an empty cache.
+func newStyleSharingCache() *styleSharingCache {
+	return &styleSharingCache{entries: make(map[sharingKey]*StyledNode)}
+}
+
+// sharingKey returns the key under which node's styles are shared, or false
+// if node must be styled on its own. A nil cache shares nothing.
+func (ctx *styleContext) sharingKey(node *dom.Node, parent *StyledNode) (sharingKey, bool) {
+	if ctx.sharing == nil || parent == nil || parent.computed == nil {
+		return sharingKey{}, false
+	}
+	switch node.Type {
+	case dom.TextNode:
+		// Text nodes only inherit
+		return sharingKey{parent: parent.computed, nodeType: dom.TextNode}, true
+	case dom.ElementNode:
+	default:
+		return sharingKey{}, false
+	}
+
+	// The root element sets the root font size, and the direction of
+	// dir=auto and <bdi> elements depends on their text
+	// HTML §3.2.6.4 The dir attribute
+	if isRootElement(node) || node.Data == "bdi" ||
+		strings.EqualFold(strings.TrimSpace(node.GetAttribute("dir")), "auto") {
+		return sharingKey{}, false
+	}
+	// Selectors Level 4 §14: Tree-structural pseudo-classes, sibling
+	// combinators and :has() depend on where the element is
+	if ctx.rules.positional(node) {
+		return sharingKey{}, false
+	}
+
+	return sharingKey{
+		parent:     parent.computed,
+		nodeType:   dom.ElementNode,
+		tag:        node.Data,
+		attributes: ctx.attributeKey(node),
+	}, true
+}
+
+// sharingAttributes are the attributes that presentational hints and the
+// cascade read from an element; elements only share styles if they agree
+// on them.
+var sharingAttributes = []string{
+	"style", "dir", "type", "start", "reversed", "value",
+
+	// Presentational hints (hints.go)
+	"color", "bgcolor", "background", "width", "height", "align", "valign",
+	"border", "cellspacing", "cellpadding", "nowrap", "face", "size",
+	"noshade", "wrap", "hspace", "vspace", "text", "link",
+	"marginheight", "marginwidth", "topmargin", "bottommargin", "leftmargin", "rightmargin",
+}
+
+// attributeKey serializes what styling can see of the attributes of node:
+// the values of sharingAttributes, the ID and classes that selectors name,
+// and whether it has an href for :link.
+func (ctx *styleContext) attributeKey(node *dom.Node) string {
+	var key strings.Builder
+	for _, name := range sharingAttributes {
+		if value, ok := node.Attributes[name]; ok {
+			writeAttribute(&key, name, value)
+		}
+	}
+
+	if id := node.ID(); ctx.rules.ids[id] {
+		writeAttribute(&key, "#", id)
+	}
+	var classes []string
+	for _, class := range node.Classes() {
+		if ctx.rules.classes[class] {
+			classes = append(classes, class)
+		}
+	}
+	slices.Sort(classes)
+	for _, class := range slices.Compact(classes) {
+		writeAttribute(&key, ".", class)
+	}
+
+	// CSS 2.1 §5.11.2: :link only depends on there being an href
+	if node.GetAttribute("href") != "" {
+		writeAttribute(&key, "href", "")
+	}
+	return key.String()
+}
+
+// writeAttribute appends an attribute to a key. Names end at '=', and
+// values are prefixed with their length.
+func writeAttribute(key *strings.Builder, name, value string) {
+	key.WriteString(name)
+	key.WriteByte('=')
+	key.WriteString(strconv.Itoa(len(value)))
+	key.WriteByte(':')
+	key.WriteString(value)
+}
+
+// lookup returns the node styled earlier with key, or nil if there is none
+// or the node is not sharable.
+func (c *styleSharingCache) lookup(key sharingKey, sharable bool) *StyledNode {
+	if !sharable {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key]
+}
+
+// insert records styled as the node to share the styles of under key.
+func (c *styleSharingCache) insert(key sharingKey, styled *StyledNode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = styled
+	}
+}
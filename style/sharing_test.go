@@ -0,0 +1,169 @@
+package style
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/html"
+)
+
+// compareStyledTrees reports the first node whose styles differ between two
+// style trees of the same document.
+func compareStyledTrees(t *testing.T, name string, shared, unshared *StyledNode) {
+	t.Helper()
+	if !maps.Equal(shared.Styles, unshared.Styles) || !reflect.DeepEqual(shared.Style(), unshared.Style()) {
+		t.Errorf("%s: <%s> has styles %v with sharing, %v without", name, shared.Node.Data, shared.Styles, unshared.Styles)
+		return
+	}
+	if len(shared.Children) != len(unshared.Children) {
+		t.Errorf("%s: <%s> has %d children with sharing, %d without", name, shared.Node.Data, len(shared.Children), len(unshared.Children))
+		return
+	}
+	for i := range shared.Children {
+		compareStyledTrees(t, name, shared.Children[i], unshared.Children[i])
+	}
+}
+
+// TestStyleSharingPages tests that sharing styles gives every node of the
+// test pages and WPT tests the styles it has when styled on its own.
+func TestStyleSharingPages(t *testing.T) {
+	pages := 0
+	err := filepath.WalkDir("../test", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !strings.HasSuffix(path, ".html") {
+			return err
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		doc := html.Parse(string(source))
+		stylesheet := LoadStylesheets(doc, path)
+
+		unsharedOptions := DefaultOptions()
+		unsharedOptions.DisableStyleSharing = true
+		compareStyledTrees(t, path,
+			StyleTreeWithOptions(doc, stylesheet, DefaultOptions()),
+			StyleTreeWithOptions(doc, stylesheet, unsharedOptions))
+		pages++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages < 50 {
+		t.Errorf("Expected to compare the test pages, compared %d", pages)
+	}
+}
+
+// TestStyleSharing tests which elements share their styles.
+func TestStyleSharing(t *testing.T) {
+	tests := []struct {
+		name   string
+		css    string
+		html   string
+		tag    string
+		shared bool   // whether the last two tag elements share styles
+		color  string // the color of the last tag element, if set
+	}{
+		{"siblings", ".item { color: red; }",
+			`<ul><li class="item">a</li><li class="item">b</li></ul>`, "li", true, "red"},
+		{"cousins", ".row span { color: red; }",
+			`<div class="row"><span>a</span></div><div class="row"><span>b</span></div>`, "span", true, "red"},
+		{"unnamed attributes", "",
+			`<a id="a1" href="x" title="one">a</a><a id="a2" href="y" title="two">b</a>`, "a", true, ""},
+		{"classes in another order", ".a.b { color: red; }",
+			`<p class="a b">a</p><p class="b a a">b</p>`, "p", true, "red"},
+		{"different classes", ".a { color: red; }",
+			`<p class="a">a</p><p class="b">b</p>`, "p", false, ""},
+		{"named IDs", "#two { color: red; }",
+			`<p id="one">a</p><p id="two">b</p>`, "p", false, "red"},
+		{"links", "",
+			`<a href="x">a</a><a name="y">b</a>`, "a", false, ""},
+		{"inline styles", "",
+			`<p style="color: red">a</p><p style="color: blue">b</p>`, "p", false, "blue"},
+		{"presentational hints", "",
+			`<td width="10">a</td><td width="20">b</td>`, "td", false, ""},
+		{"alignment hints", "",
+			`<p align="left">a</p><p align="right">b</p>`, "p", false, ""},
+		{"cells of tables with different cellpadding", "",
+			`<table cellpadding="1"><tr><td>a</td></tr></table><table cellpadding="5"><tr><td>b</td></tr></table>`, "td", false, ""},
+		{"cousins of different parents", ".x span { color: red; }",
+			`<div class="x"><span>a</span></div><div><span>b</span></div>`, "span", false, ""},
+		{"structural pseudo-classes", "li:last-child { color: red; }",
+			`<ul><li>a</li><li>b</li></ul>`, "li", false, "red"},
+		{"structural pseudo-classes of ancestors", "div:first-child span { color: red; }",
+			`<div><span>a</span></div><div><span>b</span></div>`, "span", false, ""},
+		{"sibling combinators", "h1 + p { color: red; }",
+			`<h1>t</h1><p>a</p><p>b</p>`, "p", false, ""},
+		{":nth-child() in :is()", "p:is(:nth-child(odd)) { color: red; }",
+			`<p>a</p><p>b</p><p>c</p>`, "p", false, "red"},
+		{":has()", "p:has(em) { color: red; }",
+			`<p>a</p><p><em>b</em></p>`, "p", false, "red"},
+		{"dir=auto", "",
+			`<p dir="auto">abc</p><p dir="auto">` + "א" + `</p>`, "p", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := html.Parse("<html><body>" + tt.html + "</body></html>")
+			styled := StyleTree(doc, css.Parse(tt.css))
+
+			var nodes []*StyledNode
+			var collect func(node *StyledNode)
+			collect = func(node *StyledNode) {
+				if node.Node.Type == dom.ElementNode && node.Node.Data == tt.tag && node.PseudoElement == "" {
+					nodes = append(nodes, node)
+				}
+				for _, child := range node.Children {
+					collect(child)
+				}
+			}
+			collect(styled)
+			if len(nodes) < 2 {
+				t.Fatalf("Expected two <%s> elements, got %d", tt.tag, len(nodes))
+			}
+			a, b := nodes[len(nodes)-2], nodes[len(nodes)-1]
+			if shared := a.Style() == b.Style(); shared != tt.shared {
+				t.Errorf("Expected shared %v, got %v", tt.shared, shared)
+			}
+			if tt.color != "" && b.Styles["color"] != tt.color {
+				t.Errorf("Expected color %q, got %q", tt.color, b.Styles["color"])
+			}
+		})
+	}
+}
+
+// TestStyleSharingStats tests the counts of styled and shared nodes of
+// test/hackernews.html, whose story rows are alike.
+func TestStyleSharingStats(t *testing.T) {
+	source, err := os.ReadFile("../test/hackernews.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := html.Parse(string(source))
+	stylesheet := LoadStylesheets(doc, "../test/hackernews.html")
+
+	var stats Stats
+	opts := DefaultOptions()
+	opts.Stats = &stats
+	StyleTreeWithOptions(doc, stylesheet, opts)
+	if stats.Elements == 0 || stats.Texts == 0 {
+		t.Fatalf("Expected elements and text nodes to be counted, got %+v", stats)
+	}
+	if stats.HitRate() < 0.9 {
+		t.Errorf("Expected most elements to share styles, got %+v (%.2f)", stats, stats.HitRate())
+	}
+
+	opts.DisableStyleSharing = true
+	StyleTreeWithOptions(doc, stylesheet, opts)
+	if stats.SharedElements != 0 || stats.SharedTexts != 0 || stats.HitRate() != 0 {
+		t.Errorf("Expected no sharing when disabled, got %+v", stats)
+	}
+}
@@ -0,0 +1,1796 @@
+package style
+
+// This file expands shorthand properties into their longhands and
+// serializes longhands back into shorthands. Each shorthand's value is
+// parsed by its grammar; longhands it omits are reset to their initial
+// values, and a value that does not match the grammar makes the whole
+// declaration invalid, so it is ignored.
+//
+// Spec references:
+// - CSS 2.1 §1.4.3 Shorthand properties: https://www.w3.org/TR/CSS21/about.html#shorthand
+// - CSS 2.1 §8.3, §8.4, §8.5 Margin, padding and border shorthands: https://www.w3.org/TR/CSS21/box.html
+// - CSS 2.1 §12.6.2 'list-style': https://www.w3.org/TR/CSS21/generate.html#propdef-list-style
+// - CSS Fonts Level 4 §2.8 'font': https://www.w3.org/TR/css-fonts-4/#font-prop
+// - CSS Backgrounds Level 3 §3.10 'background', §5.1 'border-radius': https://www.w3.org/TR/css-backgrounds-3/
+// - CSS Basic User Interface Level 4 §5.1 'outline': https://www.w3.org/TR/css-ui-4/#outline
+// - CSS Flexbox Level 1 §5.3 'flex-flow', §7.1 'flex': https://www.w3.org/TR/css-flexbox-1/#flex-property
+// - CSS Grid Level 2 §7.4 'grid-template', §7.8 'grid', §8.4 placement shorthands: https://www.w3.org/TR/css-grid-2/
+// - CSS Box Alignment Level 3 §5.1, §6.1, §8.1 'place-*' and 'gap': https://www.w3.org/TR/css-align-3/
+// - CSS Logical Properties Level 1 §4.3 'inset': https://www.w3.org/TR/css-logical-1/#propdef-inset
+// - CSS Text Decoration Level 4 §2.6 'text-decoration': https://www.w3.org/TR/css-text-decor-4/#text-decoration-property
+// - CSS Multi-column Layout Level 1 §3.3 'columns': https://www.w3.org/TR/css-multicol-1/#columns
+// - CSS Transitions Level 1 §2.5 'transition': https://www.w3.org/TR/css-transitions-1/#transition-shorthand-property
+// - CSS Animations Level 1 §3.10 'animation': https://www.w3.org/TR/css-animations-1/#animation
+// - CSSOM §6.7.2 Serializing CSS Values: https://www.w3.org/TR/cssom-1/#serializing-css-values
+//
+// Implemented:
+// - margin, padding, inset, border-width, border-style, border-color (1 to 4 values)
+// - border, border-top, border-right, border-bottom, border-left, outline
+// - font, including line heights and the system font keywords
+// - background with multiple layers, positions, sizes and boxes
+// - list-style, border-radius, flex, flex-flow, gap (and grid-gap)
+// - grid, grid-template, grid-area, grid-row, grid-column
+// - place-content, place-items, place-self
+// - text-decoration, columns, and transition and animation with multiple
+//   transitions and animations
+// - SerializeShorthand, the shortest value that expands to the given longhands
+//
+// Not implemented:
+// - Shorthands of features the browser does not have: border-image,
+//   text-emphasis, mask
+// - Logical shorthands (inset-block, inset-inline, margin-block, ...)
+// - Checking track lists in grid values beyond their slash structure
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+)
+
+// shorthand describes a shorthand property.
+type shorthand struct {
+	// longhands are the properties the shorthand sets, including those
+	// it only resets.
+	longhands []string
+
+	// expand parses the shorthand's value, split into component values,
+	// into a value for each of its longhands. It reports false if the value
+	// does not match the shorthand's grammar.
+	expand func(tokens []string) (map[string]string, bool)
+
+	// serialize returns the shorthand value that sets the longhands to
+	// values, or false if no value of the shorthand does.
+	serialize func(values map[string]string) (string, bool)
+}
+
+// The longhands of each side of a box, in the order box shorthands list
+// their values.
+var (
+	marginLonghands      = sideLonghands("margin-%s")
+	paddingLonghands     = sideLonghands("padding-%s")
+	insetLonghands       = []string{"top", "right", "bottom", "left"}
+	borderWidthLonghands = sideLonghands("border-%s-width")
+	borderStyleLonghands = sideLonghands("border-%s-style")
+	borderColorLonghands = sideLonghands("border-%s-color")
+	borderRadiusCorners  = []string{"border-top-left-radius", "border-top-right-radius", "border-bottom-right-radius", "border-bottom-left-radius"}
+)
+
+// The longhands of shorthands that reset all of them.
+var (
+	outlineLonghands   = []string{"outline-color", "outline-style", "outline-width"}
+	listStyleLonghands = []string{"list-style-position", "list-style-image", "list-style-type"}
+	flexFlowLonghands  = []string{"flex-direction", "flex-wrap"}
+
+	// fontLonghands end with the longhands 'font' only resets.
+	fontLonghands = []string{
+		"font-style", "font-variant", "font-weight", "font-stretch", "font-size", "line-height", "font-family",
+		"font-kerning", "font-variant-ligatures",
+	}
+)
+
+// backgroundLonghands are the longhands of a background layer, the last
+// layer also setting background-color.
+var backgroundLonghands = []string{
+	"background-image", "background-position", "background-size", "background-repeat",
+	"background-attachment", "background-origin", "background-clip", "background-color",
+}
+
+// gridLonghands are the longhands 'grid' sets; 'grid-template' sets the
+// first three.
+var gridLonghands = []string{
+	"grid-template-rows", "grid-template-columns", "grid-template-areas",
+	"grid-auto-rows", "grid-auto-columns", "grid-auto-flow",
+}
+
+// shorthands maps each shorthand property to its description.
+var shorthands = map[string]*shorthand{
+	"margin":       edgesShorthand(marginLonghands, isMarginWidth),
+	"padding":      edgesShorthand(paddingLonghands, isNonNegativeLength),
+	"inset":        edgesShorthand(insetLonghands, isMarginWidth),
+	"border-width": edgesShorthand(borderWidthLonghands, isLineWidth),
+	"border-style": edgesShorthand(borderStyleLonghands, isLineStyle),
+	"border-color": edgesShorthand(borderColorLonghands, isColor),
+
+	"border":        borderShorthand("top", "right", "bottom", "left"),
+	"border-top":    borderShorthand("top"),
+	"border-right":  borderShorthand("right"),
+	"border-bottom": borderShorthand("bottom"),
+	"border-left":   borderShorthand("left"),
+	"outline":       {longhands: outlineLonghands, expand: expandOutline, serialize: serializeOutline},
+	"border-radius": {longhands: borderRadiusCorners, expand: expandBorderRadius, serialize: serializeBorderRadius},
+
+	"list-style": {longhands: listStyleLonghands, expand: expandListStyle, serialize: serializeListStyle},
+	"font":       {longhands: fontLonghands, expand: expandFont, serialize: serializeFont},
+	"background": {longhands: backgroundLonghands, expand: expandBackground, serialize: serializeBackground},
+
+	"flex":      {longhands: []string{"flex-grow", "flex-shrink", "flex-basis"}, expand: expandFlex, serialize: serializeFlex},
+	"flex-flow": {longhands: flexFlowLonghands, expand: expandFlexFlow, serialize: serializeFlexFlow},
+	"gap":       pairShorthand("row-gap", "column-gap", isGap),
+	"grid-gap":  pairShorthand("row-gap", "column-gap", isGap),
+
+	"place-content": pairShorthand("align-content", "justify-content", isAlignment),
+	"place-items":   pairShorthand("align-items", "justify-items", isAlignment),
+	"place-self":    pairShorthand("align-self", "justify-self", isAlignment),
+
+	"grid":          {longhands: gridLonghands, expand: expandGrid, serialize: serializeGrid},
+	"grid-template": {longhands: gridLonghands[:3], expand: expandGridTemplate, serialize: serializeGridTemplate},
+	"grid-row":      gridLineShorthand("grid-row-start", "grid-row-end"),
+	"grid-column":   gridLineShorthand("grid-column-start", "grid-column-end"),
+	"grid-area": {
+		longhands: []string{"grid-row-start", "grid-column-start", "grid-row-end", "grid-column-end"},
+		expand:    expandGridArea,
+		serialize: serializeGridArea,
+	},
+
+	"text-decoration": {longhands: textDecorationLonghands, expand: expandTextDecoration, serialize: serializeTextDecoration},
+	"columns":         {longhands: columnsLonghands, expand: expandColumns, serialize: serializeColumns},
+	"transition":      {longhands: transitionLonghands, expand: expandTransition, serialize: serializeTransition},
+	"animation":       {longhands: animationLonghands, expand: expandAnimation, serialize: serializeAnimation},
+}
+
+// expandShorthand expands CSS shorthand properties to their longhand equivalents.
+// Other properties are returned as they are. It returns nil if the value of
+// a shorthand is invalid, in which case the declaration is ignored.
+// CSS 2.1 §4.2: Illegal values are ignored
+func expandShorthand(property, value string) map[string]string {
+	sh := shorthands[property]
+	if sh == nil {
+		return map[string]string{property: value}
+	}
+	tokens := shorthandTokens(value)
+	if len(tokens) == 0 {
+		return nil
+	}
+	expanded, ok := sh.expand(tokens)
+	if !ok {
+		return nil
+	}
+	return expanded
+}
+
+// shorthandLonghands returns the properties a declaration of property sets:
+// the longhands expandShorthand expands a shorthand into, or the property
+// itself.
+func shorthandLonghands(property string) []string {
+	if sh := shorthands[property]; sh != nil {
+		return sh.longhands
+	}
+	return []string{property}
+}
+
+// IsShorthand reports whether property is a shorthand property.
+func IsShorthand(property string) bool {
+	return shorthands[property] != nil
+}
+
+// SerializeShorthand returns the value of the shorthand property that sets
+// its longhands to their values in styles, longhands missing from styles
+// taking their initial values. It returns false if property is not a
+// shorthand or if no value of it gives the longhands these values.
+// CSSOM §6.7.2: the shortest value that represents the longhands
+func SerializeShorthand(property string, styles map[string]string) (string, bool) {
+	sh := shorthands[property]
+	if sh == nil {
+		return "", false
+	}
+	values := make(map[string]string, len(sh.longhands))
+	for _, longhand := range sh.longhands {
+		value, ok := styles[longhand]
+		if !ok || value == "" {
+			value = initialValue(longhand)
+		}
+		values[longhand] = strings.TrimSpace(value)
+	}
+	return sh.serialize(values)
+}
+
+// initialValue returns the initial value of a longhand in the registry.
+func initialValue(longhand string) string {
+	if p := LookupProperty(longhand); p != nil {
+		return p.Initial
+	}
+	return ""
+}
+
+// withInitialValues returns values for longhands, each taking its value
+// from set or else its initial value.
+func withInitialValues(longhands []string, set map[string]string) map[string]string {
+	result := make(map[string]string, len(longhands))
+	for _, longhand := range longhands {
+		if value, ok := set[longhand]; ok {
+			result[longhand] = value
+		} else {
+			result[longhand] = initialValue(longhand)
+		}
+	}
+	return result
+}
+
+// shorthandTokens splits a value into its component values. Whitespace
+// separates them outside functions, brackets and strings; '/' and ',' are
+// component values of their own.
+func shorthandTokens(value string) []string {
+	var tokens []string
+	var current strings.Builder
+	depth := 0
+	var quote rune
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+	for _, ch := range value {
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(' || ch == '[':
+			depth++
+		case ch == ')' || ch == ']':
+			depth = max(depth-1, 0)
+		case depth > 0:
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\f':
+			flush()
+			continue
+		case ch == '/' || ch == ',':
+			flush()
+			tokens = append(tokens, string(ch))
+			continue
+		}
+		current.WriteRune(ch)
+	}
+	flush()
+	return tokens
+}
+
+// splitTokens splits tokens at each separator token sep.
+func splitTokens(tokens []string, sep string) [][]string {
+	parts := [][]string{{}}
+	for _, token := range tokens {
+		if token == sep {
+			parts = append(parts, []string{})
+			continue
+		}
+		parts[len(parts)-1] = append(parts[len(parts)-1], token)
+	}
+	return parts
+}
+
+// joinTokens joins component values back into a value, commas attaching
+// to the value before them.
+func joinTokens(tokens []string) string {
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 && token != "," {
+			b.WriteByte(' ')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// sideLonghands returns the longhands of the four sides, in the order
+// top, right, bottom, left, of a pattern such as "margin-%s".
+func sideLonghands(pattern string) []string {
+	sides := make([]string, 4)
+	for i, side := range []string{"top", "right", "bottom", "left"} {
+		sides[i] = strings.Replace(pattern, "%s", side, 1)
+	}
+	return sides
+}
+
+// isMarginWidth reports whether value is a length, a percentage or 'auto'.
+// CSS 2.1 §8.3 <margin-width>
+func isMarginWidth(value string) bool {
+	_, ok := css.ParseLength(value)
+	return ok || strings.EqualFold(value, "auto")
+}
+
+// isNonNegativeLength reports whether value is a length or percentage that
+// is not negative.
+// CSS 2.1 §8.4 <padding-width>
+func isNonNegativeLength(value string) bool {
+	length, ok := css.ParseLength(value)
+	return ok && (length.Calc != nil || length.Value >= 0)
+}
+
+// isLineWidth reports whether value is a border width.
+// CSS 2.1 §8.5.1 <border-width>
+func isLineWidth(value string) bool {
+	_, ok := borderWidths[strings.ToLower(value)]
+	return ok || isNonNegativeLength(value)
+}
+
+// lineStyles are the border style keywords.
+// CSS 2.1 §8.5.3 <border-style>
+var lineStyles = []string{"none", "hidden", "dotted", "dashed", "solid", "double", "groove", "ridge", "inset", "outset"}
+
+// isLineStyle reports whether value is a border style.
+func isLineStyle(value string) bool {
+	return slices.Contains(lineStyles, strings.ToLower(value))
+}
+
+// isColor reports whether value is a color.
+// CSS Color Level 4 §4 Representing Colors
+func isColor(value string) bool {
+	_, ok := css.ParseColorValue(value)
+	return ok
+}
+
+// isNumber reports whether value is a number without a unit.
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
+
+// isGap reports whether value is a gutter size.
+// CSS Box Alignment Level 3 §8.1 'row-gap' and 'column-gap'
+func isGap(value string) bool {
+	return strings.EqualFold(value, "normal") || isNonNegativeLength(value)
+}
+
+// alignmentKeywords are the keywords of the alignment properties.
+// CSS Box Alignment Level 3 §4 Alignment Keywords
+var alignmentKeywords = []string{
+	"auto", "normal", "stretch", "baseline", "start", "end", "center", "left", "right",
+	"flex-start", "flex-end", "self-start", "self-end", "space-between", "space-around",
+	"space-evenly", "legacy",
+}
+
+// isAlignment reports whether value is a single alignment keyword or
+// a keyword with its 'first', 'last', 'safe' or 'unsafe' modifier.
+func isAlignment(value string) bool {
+	words := strings.Fields(strings.ToLower(value))
+	switch len(words) {
+	case 1:
+		return slices.Contains(alignmentKeywords, words[0])
+	case 2:
+		switch words[0] {
+		case "first", "last":
+			return words[1] == "baseline"
+		case "safe", "unsafe":
+			return slices.Contains(alignmentKeywords, words[1]) && words[1] != "baseline"
+		case "legacy":
+			return words[1] == "left" || words[1] == "right" || words[1] == "center"
+		}
+	}
+	return false
+}
+
+// edgesShorthand returns the description of a shorthand giving one to four
+// values for the sides of a box, in the order top, right, bottom, left:
+// a missing left side copies the right, a missing bottom the top, and a
+// missing right the top.
+// CSS 2.1 §8.3 'margin'
+func edgesShorthand(longhands []string, valid func(string) bool) *shorthand {
+	return &shorthand{
+		longhands: longhands,
+		expand: func(tokens []string) (map[string]string, bool) {
+			if len(tokens) > 4 {
+				return nil, false
+			}
+			for _, token := range tokens {
+				if !valid(token) {
+					return nil, false
+				}
+			}
+			top, right, bottom, left := tokens[0], tokens[0], tokens[0], tokens[0]
+			if len(tokens) > 1 {
+				right, left = tokens[1], tokens[1]
+			}
+			if len(tokens) > 2 {
+				bottom = tokens[2]
+			}
+			if len(tokens) > 3 {
+				left = tokens[3]
+			}
+			return map[string]string{longhands[0]: top, longhands[1]: right, longhands[2]: bottom, longhands[3]: left}, true
+		},
+		serialize: func(values map[string]string) (string, bool) {
+			return serializeEdges(values[longhands[0]], values[longhands[1]], values[longhands[2]], values[longhands[3]]), true
+		},
+	}
+}
+
+// serializeEdges returns the shortest list of one to four values for the
+// sides of a box.
+func serializeEdges(top, right, bottom, left string) string {
+	switch {
+	case right != left:
+		return top + " " + right + " " + bottom + " " + left
+	case top != bottom:
+		return top + " " + right + " " + bottom
+	case top != right:
+		return top + " " + right
+	}
+	return top
+}
+
+// parseLine parses a value giving a line's width, style and color in any
+// order, each at most once, as the border and outline shorthands do.
+// validStyle reports whether a keyword is a style of the line.
+// CSS 2.1 §8.5.4 'border'
+func parseLine(tokens []string, validStyle func(string) bool) (width, style, color string, ok bool) {
+	if len(tokens) > 3 {
+		return "", "", "", false
+	}
+	for _, token := range tokens {
+		switch {
+		case style == "" && validStyle(token):
+			style = strings.ToLower(token)
+		case width == "" && isLineWidth(token):
+			width = token
+		case color == "" && isColor(token):
+			color = token
+		default:
+			return "", "", "", false
+		}
+	}
+	return width, style, color, true
+}
+
+// borderShorthand returns the description of the border shorthand of the
+// given sides: 'border' for all four sides, or 'border-top' and the
+// others for one.
+// CSS 2.1 §8.5.4 Border shorthand properties
+func borderShorthand(sides ...string) *shorthand {
+	var longhands []string
+	for _, side := range sides {
+		longhands = append(longhands, "border-"+side+"-width", "border-"+side+"-style", "border-"+side+"-color")
+	}
+	return &shorthand{
+		longhands: longhands,
+		expand: func(tokens []string) (map[string]string, bool) {
+			width, style, color, ok := parseLine(tokens, isLineStyle)
+			if !ok {
+				return nil, false
+			}
+			set := make(map[string]string)
+			for _, side := range sides {
+				setIfGiven(set, "border-"+side+"-width", width)
+				setIfGiven(set, "border-"+side+"-style", style)
+				setIfGiven(set, "border-"+side+"-color", color)
+			}
+			return withInitialValues(longhands, set), true
+		},
+		serialize: func(values map[string]string) (string, bool) {
+			// Every side must be the same for 'border'
+			for _, side := range sides[1:] {
+				for _, part := range []string{"-width", "-style", "-color"} {
+					if values["border-"+side+part] != values["border-"+sides[0]+part] {
+						return "", false
+					}
+				}
+			}
+			first := "border-" + sides[0]
+			return serializeLine(
+				[]string{first + "-width", first + "-style", first + "-color"}, values, first+"-style"), true
+		},
+	}
+}
+
+// setIfGiven sets property to value in set unless value is empty.
+func setIfGiven(set map[string]string, property, value string) {
+	if value != "" {
+		set[property] = value
+	}
+}
+
+// serializeLine joins the values of longhands that differ from their
+// initial values, falling back to the style longhand if all are initial.
+func serializeLine(longhands []string, values map[string]string, style string) string {
+	var parts []string
+	for _, longhand := range longhands {
+		if values[longhand] != initialValue(longhand) {
+			parts = append(parts, values[longhand])
+		}
+	}
+	if len(parts) == 0 {
+		return values[style]
+	}
+	return strings.Join(parts, " ")
+}
+
+// expandOutline expands 'outline', whose style may be 'auto' but not
+// 'hidden'.
+// CSS Basic User Interface Level 4 §5.1 'outline'
+func expandOutline(tokens []string) (map[string]string, bool) {
+	validStyle := func(value string) bool {
+		value = strings.ToLower(value)
+		return value == "auto" || (value != "hidden" && isLineStyle(value))
+	}
+	width, style, color, ok := parseLine(tokens, validStyle)
+	if !ok {
+		return nil, false
+	}
+	set := make(map[string]string)
+	setIfGiven(set, "outline-width", width)
+	setIfGiven(set, "outline-style", style)
+	setIfGiven(set, "outline-color", color)
+	return withInitialValues(outlineLonghands, set), true
+}
+
+// serializeOutline serializes 'outline' as its color, style and width.
+func serializeOutline(values map[string]string) (string, bool) {
+	return serializeLine(outlineLonghands, values, "outline-style"), true
+}
+
+// expandBorderRadius expands 'border-radius': one to four horizontal
+// radii, then optionally '/' and one to four vertical radii, given for the
+// corners clockwise from the top left.
+// CSS Backgrounds Level 3 §5.1 'border-radius'
+func expandBorderRadius(tokens []string) (map[string]string, bool) {
+	parts := splitTokens(tokens, "/")
+	if len(parts) > 2 {
+		return nil, false
+	}
+	var radii [2][4]string
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 4 {
+			return nil, false
+		}
+		for _, token := range part {
+			if !isNonNegativeLength(token) {
+				return nil, false
+			}
+		}
+		// The same copying as the box shorthands: top-left, top-right,
+		// bottom-right, bottom-left
+		r := [4]string{part[0], part[0], part[0], part[0]}
+		if len(part) > 1 {
+			r[1], r[3] = part[1], part[1]
+		}
+		if len(part) > 2 {
+			r[2] = part[2]
+		}
+		if len(part) > 3 {
+			r[3] = part[3]
+		}
+		radii[i] = r
+	}
+	if len(parts) == 1 {
+		radii[1] = radii[0]
+	}
+	result := make(map[string]string, 4)
+	for i, corner := range borderRadiusCorners {
+		result[corner] = radii[0][i]
+		if radii[1][i] != radii[0][i] {
+			result[corner] += " " + radii[1][i]
+		}
+	}
+	return result, true
+}
+
+// serializeBorderRadius serializes 'border-radius' from the horizontal and
+// vertical radius of each corner.
+func serializeBorderRadius(values map[string]string) (string, bool) {
+	var horizontal, vertical [4]string
+	for i, corner := range borderRadiusCorners {
+		radii := strings.Fields(values[corner])
+		if len(radii) == 0 || len(radii) > 2 {
+			return "", false
+		}
+		horizontal[i], vertical[i] = radii[0], radii[len(radii)-1]
+	}
+	h := serializeEdges(horizontal[0], horizontal[1], horizontal[2], horizontal[3])
+	if v := serializeEdges(vertical[0], vertical[1], vertical[2], vertical[3]); v != h {
+		return h + " / " + v, true
+	}
+	return h, true
+}
+
+// expandListStyle expands the list-style shorthand property.
+// CSS 2.1 §12.6.2: list-style sets type, position and image in any order;
+// omitted values are reset to their initial values. A 'none' that is not
+// needed for an explicit type or image sets whichever of them is missing.
+func expandListStyle(tokens []string) (map[string]string, bool) {
+	listStyleType, position, image := "", "", ""
+	noneCount := 0
+
+	for _, part := range tokens {
+		lower := strings.ToLower(part)
+		switch {
+		case lower == "none":
+			noneCount++
+		case position == "" && (lower == "inside" || lower == "outside"):
+			position = lower
+		case image == "" && (strings.HasPrefix(lower, "url(") || strings.Contains(lower, "gradient(")):
+			image = part
+		case listStyleType == "" && (isIdentifier(lower) || strings.HasPrefix(part, "\"") || strings.HasPrefix(part, "'")):
+			listStyleType = lower
+			if !isIdentifier(lower) {
+				listStyleType = part
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	// Each 'none' fills in the type or image, type first if both are unset
+	if noneCount > 0 && listStyleType == "" {
+		listStyleType = "none"
+		noneCount--
+	}
+	if noneCount > 0 && image == "" {
+		image = "none"
+		noneCount--
+	}
+	if noneCount > 0 {
+		return nil, false
+	}
+
+	set := make(map[string]string)
+	setIfGiven(set, "list-style-type", listStyleType)
+	setIfGiven(set, "list-style-position", position)
+	setIfGiven(set, "list-style-image", image)
+	return withInitialValues(listStyleLonghands, set), true
+}
+
+// isIdentifier reports whether value is a CSS identifier, such as a
+// keyword or counter style name.
+func isIdentifier(value string) bool {
+	digit := func(i int) bool { return i < len(value) && value[i] >= '0' && value[i] <= '9' }
+	if value == "" || digit(0) || (value[0] == '-' && digit(1)) {
+		return false
+	}
+	for _, ch := range value {
+		if !(ch == '-' || ch == '_' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch >= 0x80) {
+			return false
+		}
+	}
+	return true
+}
+
+// serializeListStyle serializes 'list-style' as its position, image and
+// type, leaving out initial values.
+func serializeListStyle(values map[string]string) (string, bool) {
+	listStyleType, image := values["list-style-type"], values["list-style-image"]
+	var parts []string
+	if position := values["list-style-position"]; position != initialValue("list-style-position") {
+		parts = append(parts, position)
+	}
+	if image != "none" {
+		parts = append(parts, image)
+	}
+	// A 'none' type must be given, as a lone 'none' means no image
+	if listStyleType != initialValue("list-style-type") || len(parts) == 0 {
+		parts = append(parts, listStyleType)
+	}
+	return strings.Join(parts, " "), true
+}
+
+// Keywords of the font longhands 'font' may set before the font size.
+// CSS Fonts Level 4 §2.8: font-variant and font-stretch only take the
+// values of CSS 2.1 and their keywords here
+var (
+	fontStyleKeywords   = []string{"italic", "oblique"}
+	fontVariantKeywords = []string{"small-caps"}
+	fontWeightKeywords  = []string{"bold", "bolder", "lighter"}
+	fontStretchKeywords = []string{
+		"ultra-condensed", "extra-condensed", "condensed", "semi-condensed",
+		"semi-expanded", "expanded", "extra-expanded", "ultra-expanded",
+	}
+	fontSizeKeywords = []string{"xx-small", "x-small", "small", "medium", "large", "x-large", "xx-large", "xxx-large", "larger", "smaller"}
+)
+
+// systemFonts are the system font keywords 'font' accepts in place of its
+// longhands. They are mapped to the default sans-serif font.
+// CSS Fonts Level 4 §2.8: caption | icon | menu | message-box |
+// small-caption | status-bar
+var systemFonts = []string{"caption", "icon", "menu", "message-box", "small-caption", "status-bar"}
+
+// expandFont expands 'font': optionally a style, variant, weight and
+// stretch in any order, then a font size, optionally '/' and a line
+// height, and the font families. font-kerning and font-variant-ligatures
+// are reset.
+// CSS Fonts Level 4 §2.8 Shorthand font property
+func expandFont(tokens []string) (map[string]string, bool) {
+	set := make(map[string]string)
+
+	if len(tokens) == 1 && slices.Contains(systemFonts, strings.ToLower(tokens[0])) {
+		set["font-family"] = "sans-serif"
+		if strings.EqualFold(tokens[0], "small-caption") {
+			set["font-variant"] = "small-caps"
+		}
+		return withInitialValues(fontLonghands, set), true
+	}
+
+	i := 0
+	normals := 0
+prefix:
+	for ; i < len(tokens); i++ {
+		token := strings.ToLower(tokens[i])
+		switch {
+		case token == "normal":
+			normals++
+		case set["font-style"] == "" && slices.Contains(fontStyleKeywords, token):
+			set["font-style"] = token
+		case set["font-variant"] == "" && slices.Contains(fontVariantKeywords, token):
+			set["font-variant"] = token
+		case set["font-weight"] == "" && (slices.Contains(fontWeightKeywords, token) || isFontWeightNumber(token)):
+			set["font-weight"] = token
+		case set["font-stretch"] == "" && slices.Contains(fontStretchKeywords, token):
+			set["font-stretch"] = token
+		default:
+			break prefix
+		}
+	}
+	// Each 'normal' stands for one of the four longhands
+	if normals+len(set) > 4 || i >= len(tokens) || !isFontSize(tokens[i]) {
+		return nil, false
+	}
+	set["font-size"] = tokens[i]
+	i++
+	if i < len(tokens) && tokens[i] == "/" {
+		if i+1 >= len(tokens) || !isLineHeight(tokens[i+1]) {
+			return nil, false
+		}
+		set["line-height"] = tokens[i+1]
+		i += 2
+	}
+
+	family := tokens[i:]
+	if len(family) == 0 || family[0] == "," || family[len(family)-1] == "," || slices.Contains(family, "/") {
+		return nil, false
+	}
+	set["font-family"] = joinTokens(family)
+	return withInitialValues(fontLonghands, set), true
+}
+
+// isFontWeightNumber reports whether value is a numeric font weight.
+// CSS Fonts Level 4 §2.2: a number between 1 and 1000
+func isFontWeightNumber(value string) bool {
+	weight, err := strconv.ParseFloat(value, 64)
+	return err == nil && weight >= 1 && weight <= 1000
+}
+
+// isFontSize reports whether value is a font size keyword, length or
+// percentage.
+// CSS Fonts Level 4 §2.5 'font-size'
+func isFontSize(value string) bool {
+	return slices.Contains(fontSizeKeywords, strings.ToLower(value)) || isNonNegativeLength(value)
+}
+
+// isLineHeight reports whether value is a line height.
+// CSS 2.1 §10.8.1 'line-height'
+func isLineHeight(value string) bool {
+	return strings.EqualFold(value, "normal") || isNonNegativeLength(value)
+}
+
+// serializeFont serializes 'font', leaving out 'normal' values before the
+// size and a 'normal' line height. The reset-only longhands must have
+// their initial values, and the variant and stretch values 'font' takes.
+func serializeFont(values map[string]string) (string, bool) {
+	if values["font-kerning"] != initialValue("font-kerning") ||
+		values["font-variant-ligatures"] != initialValue("font-variant-ligatures") ||
+		values["font-family"] == "" {
+		return "", false
+	}
+	if variant := strings.ToLower(values["font-variant"]); variant != "normal" && !slices.Contains(fontVariantKeywords, variant) {
+		return "", false
+	}
+	if stretch := strings.ToLower(values["font-stretch"]); stretch != "normal" && !slices.Contains(fontStretchKeywords, stretch) {
+		return "", false
+	}
+
+	var parts []string
+	for _, longhand := range []string{"font-style", "font-variant", "font-weight", "font-stretch"} {
+		if value := values[longhand]; !strings.EqualFold(value, "normal") {
+			parts = append(parts, value)
+		}
+	}
+	size := values["font-size"]
+	if lineHeight := values["line-height"]; !strings.EqualFold(lineHeight, "normal") {
+		size += "/" + lineHeight
+	}
+	parts = append(parts, size, values["font-family"])
+	return strings.Join(parts, " "), true
+}
+
+// Keywords of the background layer longhands.
+// CSS Backgrounds Level 3 §3
+var (
+	repeatKeywords     = []string{"repeat", "space", "round", "no-repeat"}
+	attachmentKeywords = []string{"scroll", "fixed", "local"}
+	boxKeywords        = []string{"border-box", "padding-box", "content-box"}
+	positionKeywords   = []string{"left", "right", "top", "bottom", "center"}
+)
+
+// expandBackground expands 'background': comma-separated layers, each
+// setting an image, a position optionally followed by '/' and a size, a
+// repeat style, an attachment and one or two boxes in any order, the
+// final layer also a color. Each layer longhand gets a comma-separated
+// list of the layers' values.
+// CSS Backgrounds Level 3 §3.10 Backgrounds Shorthand
+func expandBackground(tokens []string) (map[string]string, bool) {
+	layers := splitTokens(tokens, ",")
+	lists := make(map[string][]string)
+	color := ""
+	for i, layer := range layers {
+		values, layerColor, ok := parseBackgroundLayer(layer, i == len(layers)-1)
+		if !ok {
+			return nil, false
+		}
+		for _, longhand := range backgroundLonghands[:7] {
+			lists[longhand] = append(lists[longhand], values[longhand])
+		}
+		color = layerColor
+	}
+
+	set := make(map[string]string)
+	for longhand, list := range lists {
+		set[longhand] = strings.Join(list, ", ")
+	}
+	setIfGiven(set, "background-color", color)
+	return withInitialValues(backgroundLonghands, set), true
+}
+
+// parseBackgroundLayer parses one layer of 'background', returning the
+// value of each layer longhand, omitted ones initial, and the color,
+// which only the final layer may give.
+func parseBackgroundLayer(tokens []string, final bool) (values map[string]string, color string, ok bool) {
+	if len(tokens) == 0 {
+		return nil, "", false
+	}
+	set := make(map[string]string)
+	var boxes []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		lower := strings.ToLower(token)
+		switch {
+		case set["background-image"] == "" && (lower == "none" || isImage(lower)):
+			set["background-image"] = token
+		case set["background-position"] == "" && isPosition(token):
+			n := 1
+			for n < 4 && i+n < len(tokens) && isPosition(tokens[i+n]) {
+				n++
+			}
+			set["background-position"] = strings.Join(tokens[i:i+n], " ")
+			i += n - 1
+			// CSS Backgrounds Level 3 §3.10: a size may only follow the
+			// position, after '/'
+			if i+1 < len(tokens) && tokens[i+1] == "/" {
+				n := 0
+				for n < 2 && i+2+n < len(tokens) && isBackgroundSize(tokens[i+2+n]) {
+					n++
+				}
+				if n == 0 {
+					return nil, "", false
+				}
+				size := tokens[i+2 : i+2+n]
+				if n == 2 && (isCoverOrContain(size[0]) || isCoverOrContain(size[1])) {
+					return nil, "", false
+				}
+				set["background-size"] = strings.Join(size, " ")
+				i += 1 + n
+			}
+		case set["background-repeat"] == "" && (lower == "repeat-x" || lower == "repeat-y"):
+			set["background-repeat"] = lower
+		case set["background-repeat"] == "" && slices.Contains(repeatKeywords, lower):
+			set["background-repeat"] = lower
+			if i+1 < len(tokens) && slices.Contains(repeatKeywords, strings.ToLower(tokens[i+1])) {
+				set["background-repeat"] += " " + strings.ToLower(tokens[i+1])
+				i++
+			}
+		case set["background-attachment"] == "" && slices.Contains(attachmentKeywords, lower):
+			set["background-attachment"] = lower
+		case len(boxes) < 2 && slices.Contains(boxKeywords, lower):
+			boxes = append(boxes, lower)
+		case final && color == "" && isColor(token):
+			color = token
+		default:
+			return nil, "", false
+		}
+	}
+	// CSS Backgrounds Level 3 §3.10: one box sets both the origin and the
+	// clip; two set the origin and then the clip
+	if len(boxes) > 0 {
+		set["background-origin"] = boxes[0]
+		set["background-clip"] = boxes[len(boxes)-1]
+	}
+	return withInitialValues(backgroundLonghands[:7], set), color, true
+}
+
+// isImage reports whether value is an image: a url() or a gradient.
+// CSS Images Level 3 §4 Image Values
+func isImage(value string) bool {
+	return strings.HasPrefix(value, "url(") || strings.Contains(value, "gradient(") ||
+		strings.HasPrefix(value, "image(") || strings.HasPrefix(value, "image-set(")
+}
+
+// isPosition reports whether value is one component of a background
+// position: a position keyword or a length or percentage.
+// CSS Backgrounds Level 3 §3.6 <bg-position>
+func isPosition(value string) bool {
+	if slices.Contains(positionKeywords, strings.ToLower(value)) {
+		return true
+	}
+	_, ok := css.ParseLength(value)
+	return ok
+}
+
+// isBackgroundSize reports whether value is one component of a background
+// size.
+// CSS Backgrounds Level 3 §3.9 'background-size'
+func isBackgroundSize(value string) bool {
+	return strings.EqualFold(value, "auto") || isCoverOrContain(value) || isNonNegativeLength(value)
+}
+
+// isCoverOrContain reports whether value is a background size keyword that
+// stands alone.
+func isCoverOrContain(value string) bool {
+	return strings.EqualFold(value, "cover") || strings.EqualFold(value, "contain")
+}
+
+// serializeBackground serializes 'background' layer by layer, leaving out
+// initial values, with the color in the final layer.
+func serializeBackground(values map[string]string) (string, bool) {
+	lists := make(map[string][]string)
+	layers := 0
+	for _, longhand := range backgroundLonghands[:7] {
+		var list []string
+		for _, part := range splitTokens(shorthandTokens(values[longhand]), ",") {
+			list = append(list, joinTokens(part))
+		}
+		lists[longhand] = list
+		if longhand == "background-image" {
+			layers = len(list)
+		}
+	}
+
+	serialized := make([]string, layers)
+	for i := range layers {
+		// Lists shorter than the image list repeat
+		// CSS Backgrounds Level 3 §3.1 Layering Multiple Background Images
+		value := func(longhand string) string {
+			list := lists[longhand]
+			return list[i%len(list)]
+		}
+		var parts []string
+		if image := value("background-image"); image != "none" {
+			parts = append(parts, image)
+		}
+		position, size := value("background-position"), value("background-size")
+		if size != "auto" {
+			parts = append(parts, position+" / "+size)
+		} else if position != initialValue("background-position") {
+			parts = append(parts, position)
+		}
+		for _, longhand := range []string{"background-repeat", "background-attachment"} {
+			if v := value(longhand); v != initialValue(longhand) {
+				parts = append(parts, v)
+			}
+		}
+		origin, clip := value("background-origin"), value("background-clip")
+		switch {
+		case origin == clip:
+			parts = append(parts, origin)
+		case origin != initialValue("background-origin") || clip != initialValue("background-clip"):
+			parts = append(parts, origin, clip)
+		}
+		if i == layers-1 {
+			if color := values["background-color"]; color != initialValue("background-color") || len(parts) == 0 {
+				parts = append(parts, color)
+			}
+		}
+		if len(parts) == 0 {
+			parts = append(parts, "none")
+		}
+		serialized[i] = strings.Join(parts, " ")
+	}
+	return strings.Join(serialized, ", "), true
+}
+
+// expandFlex expands 'flex': 'none', 'auto', or a grow factor optionally
+// followed by a shrink factor, and a basis, in either order. Omitted
+// factors are 1 and an omitted basis is 0.
+// CSS Flexbox Level 1 §7.1 The flex Shorthand
+func expandFlex(tokens []string) (map[string]string, bool) {
+	if len(tokens) == 1 {
+		switch strings.ToLower(tokens[0]) {
+		case "none":
+			return map[string]string{"flex-grow": "0", "flex-shrink": "0", "flex-basis": "auto"}, true
+		case "auto":
+			return map[string]string{"flex-grow": "1", "flex-shrink": "1", "flex-basis": "auto"}, true
+		}
+	}
+	if len(tokens) > 3 {
+		return nil, false
+	}
+
+	grow, shrink, basis := "", "", ""
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		// A unitless zero not preceded by two factors is a factor
+		case grow == "" && isNonNegativeNumber(token):
+			grow = token
+			if i+1 < len(tokens) && isNonNegativeNumber(tokens[i+1]) {
+				shrink = tokens[i+1]
+				i++
+			}
+		// After both factors it is the basis
+		case basis == "" && (isFlexBasis(token) || (token == "0" && shrink != "")):
+			basis = token
+		default:
+			return nil, false
+		}
+	}
+	if grow == "" {
+		grow = "1"
+	}
+	if shrink == "" {
+		shrink = "1"
+	}
+	if basis == "" {
+		basis = "0%"
+	}
+	return map[string]string{"flex-grow": grow, "flex-shrink": shrink, "flex-basis": basis}, true
+}
+
+// isNonNegativeNumber reports whether value is a number without a unit
+// that is not negative.
+func isNonNegativeNumber(value string) bool {
+	number, err := strconv.ParseFloat(value, 64)
+	return err == nil && number >= 0
+}
+
+// isFlexBasis reports whether value is a flex basis.
+// CSS Flexbox Level 1 §7.3.3 'flex-basis'
+func isFlexBasis(value string) bool {
+	lower := strings.ToLower(value)
+	return lower == "auto" || lower == "content" || lower == "min-content" || lower == "max-content" ||
+		(!isNumber(value) && isNonNegativeLength(value))
+}
+
+// serializeFlex serializes 'flex' as its grow and shrink factors and its
+// basis.
+func serializeFlex(values map[string]string) (string, bool) {
+	return values["flex-grow"] + " " + values["flex-shrink"] + " " + values["flex-basis"], true
+}
+
+// flexDirections and flexWraps are the keywords of 'flex-flow'.
+// CSS Flexbox Level 1 §5.1, §5.2
+var (
+	flexDirections = []string{"row", "row-reverse", "column", "column-reverse"}
+	flexWraps      = []string{"nowrap", "wrap", "wrap-reverse"}
+)
+
+// expandFlexFlow expands 'flex-flow': a direction and a wrap, in either
+// order.
+// CSS Flexbox Level 1 §5.3 'flex-flow'
+func expandFlexFlow(tokens []string) (map[string]string, bool) {
+	if len(tokens) > 2 {
+		return nil, false
+	}
+	set := make(map[string]string)
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		switch {
+		case set["flex-direction"] == "" && slices.Contains(flexDirections, lower):
+			set["flex-direction"] = lower
+		case set["flex-wrap"] == "" && slices.Contains(flexWraps, lower):
+			set["flex-wrap"] = lower
+		default:
+			return nil, false
+		}
+	}
+	return withInitialValues(flexFlowLonghands, set), true
+}
+
+// serializeFlexFlow serializes 'flex-flow', leaving out an initial wrap.
+func serializeFlexFlow(values map[string]string) (string, bool) {
+	if wrap := values["flex-wrap"]; wrap != initialValue("flex-wrap") {
+		return values["flex-direction"] + " " + wrap, true
+	}
+	return values["flex-direction"], true
+}
+
+// pairShorthand returns the description of a shorthand giving a value for
+// first and optionally one for second, which otherwise copies first, as
+// 'gap' and the 'place-*' shorthands do. valid reports whether a value is
+// valid for either; values may be several component values, such as
+// "safe center".
+// CSS Box Alignment Level 3 §5.1 'place-content', §8.1 'gap'
+func pairShorthand(first, second string, valid func(string) bool) *shorthand {
+	return &shorthand{
+		longhands: []string{first, second},
+		expand: func(tokens []string) (map[string]string, bool) {
+			// Try each split of the component values into two values
+			for split := 1; split <= len(tokens); split++ {
+				a, b := strings.Join(tokens[:split], " "), strings.Join(tokens[split:], " ")
+				if !valid(a) || (b != "" && !valid(b)) {
+					continue
+				}
+				if b == "" {
+					b = a
+					// CSS Box Alignment Level 3 §5.1: a baseline alignment
+					// is not copied to the inline axis
+					if strings.HasSuffix(strings.ToLower(a), "baseline") && second == "justify-content" {
+						b = "start"
+					}
+				}
+				return map[string]string{first: strings.ToLower(a), second: strings.ToLower(b)}, true
+			}
+			return nil, false
+		},
+		serialize: func(values map[string]string) (string, bool) {
+			if values[first] == values[second] {
+				return values[first], true
+			}
+			return values[first] + " " + values[second], true
+		},
+	}
+}
+
+// isGridLine reports whether tokens form a grid line: 'auto', a line name,
+// or a line number and name, optionally spanning.
+// CSS Grid Level 2 §8.3 <grid-line>
+func isGridLine(tokens []string) bool {
+	if len(tokens) == 0 || len(tokens) > 3 {
+		return false
+	}
+	if len(tokens) == 1 && strings.EqualFold(tokens[0], "auto") {
+		return true
+	}
+	span, number, name := false, false, false
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		switch {
+		case lower == "span" && !span:
+			span = true
+		case !number && isInteger(token):
+			number = true
+		case !name && isIdentifier(token) && lower != "auto" && lower != "span":
+			name = true
+		default:
+			return false
+		}
+	}
+	return number || name
+}
+
+// isInteger reports whether value is an integer.
+func isInteger(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+// omittedGridLine returns the value of a grid line omitted from a
+// placement shorthand: the line name of the other line if that is a single
+// name, and otherwise 'auto'.
+// CSS Grid Level 2 §8.4 Placement Shorthands
+func omittedGridLine(other string) string {
+	if isIdentifier(other) && !strings.EqualFold(other, "auto") && !strings.EqualFold(other, "span") {
+		return other
+	}
+	return "auto"
+}
+
+// gridLineShorthand returns the description of 'grid-row' or
+// 'grid-column': a start line, then optionally '/' and an end line.
+// CSS Grid Level 2 §8.4 'grid-row' and 'grid-column'
+func gridLineShorthand(start, end string) *shorthand {
+	return &shorthand{
+		longhands: []string{start, end},
+		expand: func(tokens []string) (map[string]string, bool) {
+			lines, ok := parseGridLines(tokens, 2)
+			if !ok {
+				return nil, false
+			}
+			if len(lines) == 1 {
+				lines = append(lines, omittedGridLine(lines[0]))
+			}
+			return map[string]string{start: lines[0], end: lines[1]}, true
+		},
+		serialize: func(values map[string]string) (string, bool) {
+			if values[end] == omittedGridLine(values[start]) {
+				return values[start], true
+			}
+			return values[start] + " / " + values[end], true
+		},
+	}
+}
+
+// parseGridLines parses up to limit grid lines separated by '/'.
+func parseGridLines(tokens []string, limit int) ([]string, bool) {
+	parts := splitTokens(tokens, "/")
+	if len(parts) > limit {
+		return nil, false
+	}
+	lines := make([]string, len(parts))
+	for i, part := range parts {
+		if !isGridLine(part) {
+			return nil, false
+		}
+		lines[i] = strings.Join(part, " ")
+	}
+	return lines, true
+}
+
+// expandGridArea expands 'grid-area': up to four grid lines separated by
+// '/', for the row start, column start, row end and column end.
+// CSS Grid Level 2 §8.4 'grid-area'
+func expandGridArea(tokens []string) (map[string]string, bool) {
+	lines, ok := parseGridLines(tokens, 4)
+	if !ok {
+		return nil, false
+	}
+	if len(lines) < 2 {
+		lines = append(lines, omittedGridLine(lines[0]))
+	}
+	if len(lines) < 3 {
+		lines = append(lines, omittedGridLine(lines[0]))
+	}
+	if len(lines) < 4 {
+		lines = append(lines, omittedGridLine(lines[1]))
+	}
+	return map[string]string{
+		"grid-row-start": lines[0], "grid-column-start": lines[1],
+		"grid-row-end": lines[2], "grid-column-end": lines[3],
+	}, true
+}
+
+// serializeGridArea serializes 'grid-area', leaving out trailing lines
+// that omitting would give.
+func serializeGridArea(values map[string]string) (string, bool) {
+	lines := []string{values["grid-row-start"], values["grid-column-start"], values["grid-row-end"], values["grid-column-end"]}
+	if lines[3] == omittedGridLine(lines[1]) {
+		lines = lines[:3]
+		if lines[2] == omittedGridLine(lines[0]) {
+			lines = lines[:2]
+			if lines[1] == omittedGridLine(lines[0]) {
+				lines = lines[:1]
+			}
+		}
+	}
+	return strings.Join(lines, " / "), true
+}
+
+// expandGridTemplate expands 'grid-template': 'none', row and column track
+// lists separated by '/', or rows of area strings, each optionally
+// followed by its track size, then optionally '/' and column tracks.
+// CSS Grid Level 2 §7.4 'grid-template'
+func expandGridTemplate(tokens []string) (map[string]string, bool) {
+	if len(tokens) == 1 && strings.EqualFold(tokens[0], "none") {
+		return map[string]string{"grid-template-rows": "none", "grid-template-columns": "none", "grid-template-areas": "none"}, true
+	}
+	parts := splitTokens(tokens, "/")
+	if len(parts) > 2 || len(parts[0]) == 0 {
+		return nil, false
+	}
+
+	if !slices.ContainsFunc(parts[0], isString) {
+		if len(parts) != 2 || len(parts[1]) == 0 {
+			return nil, false
+		}
+		return map[string]string{
+			"grid-template-rows":    joinTokens(parts[0]),
+			"grid-template-columns": joinTokens(parts[1]),
+			"grid-template-areas":   "none",
+		}, true
+	}
+
+	// Each area string is a row, sized by the track size after it or auto
+	var areas, rows []string
+	for i, token := range parts[0] {
+		switch {
+		case isString(token):
+			areas = append(areas, token)
+			rows = append(rows, "auto")
+		case strings.HasPrefix(token, "["):
+			rows = append(rows, token)
+		case i > 0 && isString(parts[0][i-1]):
+			rows[len(rows)-1] = token
+		default:
+			return nil, false
+		}
+	}
+	columns := "none"
+	if len(parts) == 2 {
+		if len(parts[1]) == 0 {
+			return nil, false
+		}
+		columns = joinTokens(parts[1])
+	}
+	return map[string]string{
+		"grid-template-rows":    strings.Join(rows, " "),
+		"grid-template-columns": columns,
+		"grid-template-areas":   strings.Join(areas, " "),
+	}, true
+}
+
+// isString reports whether value is a quoted string.
+func isString(value string) bool {
+	return len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0]
+}
+
+// serializeGridTemplate serializes 'grid-template' as its row and column
+// track lists or, with areas, as area strings each followed by its row's
+// size. Rows that cannot be paired with the area strings cannot be
+// serialized.
+func serializeGridTemplate(values map[string]string) (string, bool) {
+	rows, columns, areas := values["grid-template-rows"], values["grid-template-columns"], values["grid-template-areas"]
+	if areas == "none" {
+		if rows == "none" && columns == "none" {
+			return "none", true
+		}
+		return rows + " / " + columns, true
+	}
+
+	strs := shorthandTokens(areas)
+	var parts []string
+	row := 0
+	for _, token := range shorthandTokens(rows) {
+		if strings.HasPrefix(token, "[") {
+			parts = append(parts, token)
+			continue
+		}
+		if row >= len(strs) || strings.Contains(token, "(") {
+			return "", false
+		}
+		parts = append(parts, strs[row])
+		if token != "auto" {
+			parts = append(parts, token)
+		}
+		row++
+	}
+	if row != len(strs) {
+		return "", false
+	}
+	if columns != "none" {
+		parts = append(parts, "/", columns)
+	}
+	return strings.Join(parts, " "), true
+}
+
+// expandGrid expands 'grid': a 'grid-template' value, or rows and columns
+// one of which is 'auto-flow', optionally 'dense', and the implicit track
+// sizes in that direction. The implicit grid longhands not given are reset.
+// CSS Grid Level 2 §7.8 'grid'
+func expandGrid(tokens []string) (map[string]string, bool) {
+	parts := splitTokens(tokens, "/")
+	autoFlow := func(part []string) (dense bool, sizes string, ok bool) {
+		var rest []string
+		flow := false
+		for _, token := range part {
+			switch strings.ToLower(token) {
+			case "auto-flow":
+				if flow {
+					return false, "", false
+				}
+				flow = true
+			case "dense":
+				if dense {
+					return false, "", false
+				}
+				dense = true
+			default:
+				if !flow && !dense {
+					return false, "", false
+				}
+				rest = append(rest, token)
+			}
+		}
+		if !flow {
+			return false, "", false
+		}
+		sizes = "auto"
+		if len(rest) > 0 {
+			sizes = joinTokens(rest)
+		}
+		return dense, sizes, true
+	}
+
+	if len(parts) == 2 && len(parts[0]) > 0 && len(parts[1]) > 0 {
+		set := map[string]string{"grid-template-areas": "none"}
+		if dense, sizes, ok := autoFlow(parts[0]); ok {
+			set["grid-auto-flow"] = "row"
+			set["grid-auto-rows"] = sizes
+			set["grid-template-rows"] = "none"
+			set["grid-template-columns"] = joinTokens(parts[1])
+			if dense {
+				set["grid-auto-flow"] = "row dense"
+			}
+			return withInitialValues(gridLonghands, set), true
+		}
+		if dense, sizes, ok := autoFlow(parts[1]); ok {
+			set["grid-auto-flow"] = "column"
+			set["grid-auto-columns"] = sizes
+			set["grid-template-rows"] = joinTokens(parts[0])
+			set["grid-template-columns"] = "none"
+			if dense {
+				set["grid-auto-flow"] = "column dense"
+			}
+			return withInitialValues(gridLonghands, set), true
+		}
+	}
+
+	template, ok := expandGridTemplate(tokens)
+	if !ok {
+		return nil, false
+	}
+	return withInitialValues(gridLonghands, template), true
+}
+
+// serializeGrid serializes 'grid' as a 'grid-template' value when the
+// implicit grid longhands are initial, and otherwise in its 'auto-flow'
+// forms.
+func serializeGrid(values map[string]string) (string, bool) {
+	autoRows, autoColumns, flow := values["grid-auto-rows"], values["grid-auto-columns"], values["grid-auto-flow"]
+	if autoRows == "auto" && autoColumns == "auto" && flow == "row" {
+		return serializeGridTemplate(values)
+	}
+	if values["grid-template-areas"] != "none" {
+		return "", false
+	}
+	words := strings.Fields(flow)
+	dense := ""
+	if slices.Contains(words, "dense") {
+		dense = " dense"
+	}
+	sizes := func(value string) string {
+		if value == "auto" {
+			return ""
+		}
+		return " " + value
+	}
+	switch {
+	case words[0] != "column" && values["grid-template-rows"] == "none" && autoColumns == "auto":
+		return "auto-flow" + dense + sizes(autoRows) + " / " + values["grid-template-columns"], true
+	case words[0] == "column" && values["grid-template-columns"] == "none" && autoRows == "auto":
+		return values["grid-template-rows"] + " / auto-flow" + dense + sizes(autoColumns), true
+	}
+	return "", false
+}
+
+// The longhands of the text decoration, multi-column, transition and
+// animation shorthands.
+var (
+	textDecorationLonghands = []string{"text-decoration-line", "text-decoration-thickness", "text-decoration-style", "text-decoration-color"}
+	columnsLonghands        = []string{"column-width", "column-count"}
+	transitionLonghands     = []string{"transition-property", "transition-duration", "transition-timing-function", "transition-delay"}
+	animationLonghands      = []string{
+		"animation-duration", "animation-timing-function", "animation-delay", "animation-iteration-count",
+		"animation-direction", "animation-fill-mode", "animation-play-state", "animation-name",
+	}
+)
+
+// Keywords of the text decoration longhands.
+// CSS Text Decoration Level 4 §2
+var (
+	decorationLines  = []string{"underline", "overline", "line-through", "blink"}
+	decorationStyles = []string{"solid", "double", "dotted", "dashed", "wavy"}
+)
+
+// expandTextDecoration expands 'text-decoration': a line, which is 'none'
+// or one or more of the line keywords, a thickness, a style and a color in
+// any order.
+// CSS Text Decoration Level 4 §2.6 'text-decoration'
+func expandTextDecoration(tokens []string) (map[string]string, bool) {
+	set := make(map[string]string)
+	var lines []string
+	none := false
+	for _, token := range tokens {
+		lower := strings.ToLower(token)
+		switch {
+		case lower == "none" && !none && len(lines) == 0:
+			none = true
+		case !none && slices.Contains(decorationLines, lower) && !slices.Contains(lines, lower):
+			lines = append(lines, lower)
+		case set["text-decoration-style"] == "" && slices.Contains(decorationStyles, lower):
+			set["text-decoration-style"] = lower
+		case set["text-decoration-thickness"] == "" && (lower == "auto" || lower == "from-font" || isNonNegativeLength(token)):
+			set["text-decoration-thickness"] = token
+		case set["text-decoration-color"] == "" && isColor(token):
+			set["text-decoration-color"] = token
+		default:
+			return nil, false
+		}
+	}
+	if none {
+		set["text-decoration-line"] = "none"
+	}
+	setIfGiven(set, "text-decoration-line", strings.Join(lines, " "))
+	return withInitialValues(textDecorationLonghands, set), true
+}
+
+// serializeTextDecoration serializes 'text-decoration' as its line,
+// thickness, style and color, leaving out initial values.
+func serializeTextDecoration(values map[string]string) (string, bool) {
+	var parts []string
+	for _, longhand := range textDecorationLonghands {
+		if values[longhand] != initialValue(longhand) {
+			parts = append(parts, values[longhand])
+		}
+	}
+	if len(parts) == 0 {
+		return values["text-decoration-line"], true
+	}
+	return strings.Join(parts, " "), true
+}
+
+// expandColumns expands 'columns': a column width and a column count in
+// either order, where 'auto' sets whichever of them is not given.
+// CSS Multi-column Layout Level 1 §3.3 'columns'
+func expandColumns(tokens []string) (map[string]string, bool) {
+	if len(tokens) > 2 {
+		return nil, false
+	}
+	set := make(map[string]string)
+	autoCount := 0
+	for _, token := range tokens {
+		switch {
+		case strings.EqualFold(token, "auto"):
+			autoCount++
+		case set["column-count"] == "" && isPositiveInteger(token):
+			set["column-count"] = token
+		case set["column-width"] == "" && isNonNegativeLength(token) && !strings.HasSuffix(token, "%"):
+			set["column-width"] = token
+		default:
+			return nil, false
+		}
+	}
+	if autoCount > 0 && len(set) == 2 {
+		return nil, false
+	}
+	return withInitialValues(columnsLonghands, set), true
+}
+
+// isPositiveInteger reports whether value is an integer greater than 0.
+func isPositiveInteger(value string) bool {
+	n, err := strconv.Atoi(value)
+	return err == nil && n > 0
+}
+
+// serializeColumns serializes 'columns' as its width and count, leaving
+// out 'auto'.
+func serializeColumns(values map[string]string) (string, bool) {
+	var parts []string
+	for _, longhand := range columnsLonghands {
+		if values[longhand] != "auto" {
+			parts = append(parts, values[longhand])
+		}
+	}
+	if len(parts) == 0 {
+		return "auto", true
+	}
+	return strings.Join(parts, " "), true
+}
+
+// easingKeywords are the easing functions given by a keyword.
+// CSS Easing Functions Level 1 §2 <easing-function>
+var easingKeywords = []string{"linear", "ease", "ease-in", "ease-out", "ease-in-out", "step-start", "step-end"}
+
+// isEasing reports whether value is an easing function.
+func isEasing(value string) bool {
+	value = strings.ToLower(value)
+	return slices.Contains(easingKeywords, value) || strings.HasPrefix(value, "cubic-bezier(") ||
+		strings.HasPrefix(value, "steps(") || strings.HasPrefix(value, "linear(")
+}
+
+// isTime reports whether value is a time in seconds or milliseconds.
+// CSS Values Level 4 §7.3 Time Units
+func isTime(value string) bool {
+	lower := strings.ToLower(value)
+	number, ok := strings.CutSuffix(lower, "ms")
+	if !ok {
+		number, ok = strings.CutSuffix(lower, "s")
+	}
+	return ok && isNumber(number)
+}
+
+// expandLayers expands a shorthand of comma-separated layers, such as
+// 'transition' and 'animation', into a comma-separated list for each of
+// longhands. parseLayer parses one layer into the longhands it gives,
+// being told whether it is the only layer.
+func expandLayers(tokens []string, longhands []string, parseLayer func(tokens []string, single bool) (map[string]string, bool)) (map[string]string, bool) {
+	layers := splitTokens(tokens, ",")
+	lists := make(map[string][]string)
+	for _, layer := range layers {
+		if len(layer) == 0 {
+			return nil, false
+		}
+		set, ok := parseLayer(layer, len(layers) == 1)
+		if !ok {
+			return nil, false
+		}
+		for longhand, value := range withInitialValues(longhands, set) {
+			lists[longhand] = append(lists[longhand], value)
+		}
+	}
+	result := make(map[string]string, len(longhands))
+	for longhand, list := range lists {
+		result[longhand] = strings.Join(list, ", ")
+	}
+	return result, true
+}
+
+// serializeLayers serializes a shorthand of comma-separated layers from
+// the lists of its longhands, with serializeLayer serializing the values
+// of each layer. It returns false if the lists differ in length, which no
+// value of the shorthand gives.
+func serializeLayers(values map[string]string, longhands []string, serializeLayer func(layer map[string]string) string) (string, bool) {
+	var layers []map[string]string
+	for _, longhand := range longhands {
+		list := splitTokens(shorthandTokens(values[longhand]), ",")
+		if layers == nil {
+			layers = make([]map[string]string, len(list))
+			for i := range layers {
+				layers[i] = make(map[string]string, len(longhands))
+			}
+		}
+		if len(list) != len(layers) {
+			return "", false
+		}
+		for i, part := range list {
+			layers[i][longhand] = joinTokens(part)
+		}
+	}
+	serialized := make([]string, len(layers))
+	for i, layer := range layers {
+		serialized[i] = serializeLayer(layer)
+	}
+	return strings.Join(serialized, ", "), true
+}
+
+// expandTransition expands 'transition': comma-separated transitions,
+// each a property, or 'none' if it is the only one, a duration, an easing
+// function and a delay in any order, the first time being the duration.
+// CSS Transitions Level 1 §2.5 The transition Shorthand Property
+func expandTransition(tokens []string) (map[string]string, bool) {
+	return expandLayers(tokens, transitionLonghands, func(tokens []string, single bool) (map[string]string, bool) {
+		set := make(map[string]string)
+		for _, token := range tokens {
+			lower := strings.ToLower(token)
+			switch {
+			case set["transition-duration"] == "" && isTime(token) && !strings.HasPrefix(token, "-"):
+				set["transition-duration"] = lower
+			case set["transition-duration"] != "" && set["transition-delay"] == "" && isTime(token):
+				set["transition-delay"] = lower
+			case set["transition-timing-function"] == "" && isEasing(token):
+				set["transition-timing-function"] = token
+			case set["transition-property"] == "" && lower == "none":
+				if !single {
+					return nil, false
+				}
+				set["transition-property"] = "none"
+			case set["transition-property"] == "" && isIdentifier(token) && !css.IsCSSWideKeyword(lower):
+				set["transition-property"] = lower
+			default:
+				return nil, false
+			}
+		}
+		return set, true
+	})
+}
+
+// serializeTransition serializes 'transition' transition by transition,
+// leaving out initial values other than a duration a delay follows.
+func serializeTransition(values map[string]string) (string, bool) {
+	return serializeLayers(values, transitionLonghands, func(layer map[string]string) string {
+		var parts []string
+		if property := layer["transition-property"]; property != initialValue("transition-property") {
+			parts = append(parts, property)
+		}
+		duration, delay := layer["transition-duration"], layer["transition-delay"]
+		if duration != initialValue("transition-duration") || delay != initialValue("transition-delay") {
+			parts = append(parts, duration)
+		}
+		if easing := layer["transition-timing-function"]; easing != initialValue("transition-timing-function") {
+			parts = append(parts, easing)
+		}
+		if delay != initialValue("transition-delay") {
+			parts = append(parts, delay)
+		}
+		if len(parts) == 0 {
+			return layer["transition-property"]
+		}
+		return strings.Join(parts, " ")
+	})
+}
+
+// Keywords of the animation longhands.
+// CSS Animations Level 1 §3
+var (
+	animationDirections = []string{"normal", "reverse", "alternate", "alternate-reverse"}
+	animationFillModes  = []string{"none", "forwards", "backwards", "both"}
+	animationPlayStates = []string{"running", "paused"}
+)
+
+// isAnimationKeyword reports whether value is a keyword of an animation
+// longhand other than 'animation-name'.
+func isAnimationKeyword(value string) bool {
+	value = strings.ToLower(value)
+	return value == "infinite" || slices.Contains(animationDirections, value) ||
+		slices.Contains(animationFillModes, value) || slices.Contains(animationPlayStates, value) ||
+		slices.Contains(easingKeywords, value)
+}
+
+// expandAnimation expands 'animation': comma-separated animations, each
+// giving the animation longhands in any order, the first time being the
+// duration. A keyword goes to the first longhand it is valid for that is
+// not yet set, so only a keyword no other longhand takes is a name.
+// CSS Animations Level 1 §3.10 The animation Shorthand Property
+func expandAnimation(tokens []string) (map[string]string, bool) {
+	return expandLayers(tokens, animationLonghands, func(tokens []string, single bool) (map[string]string, bool) {
+		set := make(map[string]string)
+		for _, token := range tokens {
+			lower := strings.ToLower(token)
+			switch {
+			case set["animation-duration"] == "" && isTime(token) && !strings.HasPrefix(token, "-"):
+				set["animation-duration"] = lower
+			case set["animation-duration"] != "" && set["animation-delay"] == "" && isTime(token):
+				set["animation-delay"] = lower
+			case set["animation-timing-function"] == "" && isEasing(token):
+				set["animation-timing-function"] = token
+			case set["animation-iteration-count"] == "" && (lower == "infinite" || isNonNegativeNumber(token)):
+				set["animation-iteration-count"] = lower
+			case set["animation-direction"] == "" && slices.Contains(animationDirections, lower):
+				set["animation-direction"] = lower
+			case set["animation-fill-mode"] == "" && slices.Contains(animationFillModes, lower):
+				set["animation-fill-mode"] = lower
+			case set["animation-play-state"] == "" && slices.Contains(animationPlayStates, lower):
+				set["animation-play-state"] = lower
+			case set["animation-name"] == "" && ((isIdentifier(token) && !css.IsCSSWideKeyword(lower)) || isString(token)):
+				set["animation-name"] = token
+			default:
+				return nil, false
+			}
+		}
+		return set, true
+	})
+}
+
+// serializeAnimation serializes 'animation' animation by animation,
+// leaving out initial values. A name that is also the keyword of another
+// longhand follows the values of all of them, as it only expands to a
+// name when they are set.
+func serializeAnimation(values map[string]string) (string, bool) {
+	return serializeLayers(values, animationLonghands, func(layer map[string]string) string {
+		name := layer["animation-name"]
+		all := isAnimationKeyword(name) && name != "none"
+		var parts []string
+		for _, longhand := range animationLonghands[:7] {
+			value := layer[longhand]
+			switch {
+			case all || value != initialValue(longhand):
+			case longhand == "animation-duration" && layer["animation-delay"] != initialValue("animation-delay"):
+			default:
+				continue
+			}
+			parts = append(parts, value)
+		}
+		if name != "none" || len(parts) == 0 {
+			parts = append(parts, name)
+		}
+		return strings.Join(parts, " ")
+	})
+}
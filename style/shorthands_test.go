@@ -0,0 +1,283 @@
+package style
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestExpandShorthands tests the grammar of each shorthand, omitted
+// longhands taking their initial values and invalid values being ignored.
+// CSS 2.1 §1.4.3 Shorthand properties
+func TestExpandShorthands(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		expected map[string]string // nil if the value is invalid
+	}{
+		{"font", "italic bold 12px/1.5 Georgia, serif", map[string]string{
+			"font-style": "italic", "font-variant": "normal", "font-weight": "bold", "font-stretch": "normal",
+			"font-size": "12px", "line-height": "1.5", "font-family": "Georgia, serif",
+			"font-kerning": "auto", "font-variant-ligatures": "normal",
+		}},
+		{"font", `normal small-caps 700 condensed large / 20px "Times New Roman"`, map[string]string{
+			"font-style": "normal", "font-variant": "small-caps", "font-weight": "700", "font-stretch": "condensed",
+			"font-size": "large", "line-height": "20px", "font-family": `"Times New Roman"`,
+			"font-kerning": "auto", "font-variant-ligatures": "normal",
+		}},
+		{"font", "menu", map[string]string{
+			"font-style": "normal", "font-variant": "normal", "font-weight": "normal", "font-stretch": "normal",
+			"font-size": "medium", "line-height": "normal", "font-family": "sans-serif",
+			"font-kerning": "auto", "font-variant-ligatures": "normal",
+		}},
+		{"font", "bold Arial", nil},
+		{"font", "12px", nil},
+		{"font", "italic italic 12px serif", nil},
+		{"font", "normal normal normal normal normal 12px serif", nil},
+
+		{"background", "url(x) no-repeat center / cover #fff", map[string]string{
+			"background-image": "url(x)", "background-position": "center", "background-size": "cover",
+			"background-repeat": "no-repeat", "background-attachment": "scroll", "background-origin": "padding-box",
+			"background-clip": "border-box", "background-color": "#fff",
+		}},
+		{"background", "url(a.png) left 10px top / 50% auto repeat-x, content-box fixed linear-gradient(red, blue) red", map[string]string{
+			"background-image":      "url(a.png), linear-gradient(red, blue)",
+			"background-position":   "left 10px top, 0% 0%",
+			"background-size":       "50% auto, auto",
+			"background-repeat":     "repeat-x, repeat",
+			"background-attachment": "scroll, fixed",
+			"background-origin":     "padding-box, content-box",
+			"background-clip":       "border-box, content-box",
+			"background-color":      "red",
+		}},
+		{"background", "red, url(x)", nil},
+		{"background", "url(x) / cover", nil},
+
+		{"margin", "1px auto", map[string]string{"margin-top": "1px", "margin-right": "auto", "margin-bottom": "1px", "margin-left": "auto"}},
+		{"margin", "1px 2px 3px 4px 5px", nil},
+		{"padding", "-1px", nil},
+		{"inset", "0 10%", map[string]string{"top": "0", "right": "10%", "bottom": "0", "left": "10%"}},
+		{"border-style", "solid dashed", map[string]string{
+			"border-top-style": "solid", "border-right-style": "dashed", "border-bottom-style": "solid", "border-left-style": "dashed",
+		}},
+		{"border-color", "red green blue", map[string]string{
+			"border-top-color": "red", "border-right-color": "green", "border-bottom-color": "blue", "border-left-color": "green",
+		}},
+		{"border-top", "solid", map[string]string{"border-top-width": "medium", "border-top-style": "solid", "border-top-color": "currentcolor"}},
+		{"border-top", "solid dashed", nil},
+		{"outline", "auto 2px", map[string]string{"outline-color": "invert", "outline-style": "auto", "outline-width": "2px"}},
+		{"outline", "hidden", nil},
+		{"border-radius", "10px 5% / 20px", map[string]string{
+			"border-top-left-radius": "10px 20px", "border-top-right-radius": "5% 20px",
+			"border-bottom-right-radius": "10px 20px", "border-bottom-left-radius": "5% 20px",
+		}},
+		{"list-style", "square inside", map[string]string{"list-style-type": "square", "list-style-position": "inside", "list-style-image": "none"}},
+		{"list-style", "none none none", nil},
+
+		{"flex", "1 1 0", map[string]string{"flex-grow": "1", "flex-shrink": "1", "flex-basis": "0"}},
+		{"flex", "2", map[string]string{"flex-grow": "2", "flex-shrink": "1", "flex-basis": "0%"}},
+		{"flex", "10px 3", map[string]string{"flex-grow": "3", "flex-shrink": "1", "flex-basis": "10px"}},
+		{"flex", "none", map[string]string{"flex-grow": "0", "flex-shrink": "0", "flex-basis": "auto"}},
+		{"flex", "auto", map[string]string{"flex-grow": "1", "flex-shrink": "1", "flex-basis": "auto"}},
+		{"flex", "1 2 3", nil},
+		{"flex-flow", "wrap column", map[string]string{"flex-direction": "column", "flex-wrap": "wrap"}},
+		{"gap", "10px", map[string]string{"row-gap": "10px", "column-gap": "10px"}},
+		{"grid-gap", "10px 5%", map[string]string{"row-gap": "10px", "column-gap": "5%"}},
+
+		{"place-items", "center", map[string]string{"align-items": "center", "justify-items": "center"}},
+		{"place-content", "first baseline space-between", map[string]string{"align-content": "first baseline", "justify-content": "space-between"}},
+		{"place-content", "baseline", map[string]string{"align-content": "baseline", "justify-content": "start"}},
+		{"place-self", "safe end auto", map[string]string{"align-self": "safe end", "justify-self": "auto"}},
+		{"place-self", "middle", nil},
+
+		{"grid-row", "2 / span 3", map[string]string{"grid-row-start": "2", "grid-row-end": "span 3"}},
+		{"grid-column", "main", map[string]string{"grid-column-start": "main", "grid-column-end": "main"}},
+		{"grid-area", "header", map[string]string{
+			"grid-row-start": "header", "grid-column-start": "header", "grid-row-end": "header", "grid-column-end": "header",
+		}},
+		{"grid-area", "1 / 2 / 3", map[string]string{
+			"grid-row-start": "1", "grid-column-start": "2", "grid-row-end": "3", "grid-column-end": "auto",
+		}},
+		{"grid-template", "100px 1fr / repeat(2, 50px)", map[string]string{
+			"grid-template-rows": "100px 1fr", "grid-template-columns": "repeat(2, 50px)", "grid-template-areas": "none",
+		}},
+		{"grid-template", `[top] "a a" 40px "b c" [bottom] / 1fr 2fr`, map[string]string{
+			"grid-template-rows": "[top] 40px auto [bottom]", "grid-template-columns": "1fr 2fr", "grid-template-areas": `"a a" "b c"`,
+		}},
+		{"grid", "auto-flow dense 40px / 1fr 1fr", map[string]string{
+			"grid-template-rows": "none", "grid-template-columns": "1fr 1fr", "grid-template-areas": "none",
+			"grid-auto-rows": "40px", "grid-auto-columns": "auto", "grid-auto-flow": "row dense",
+		}},
+		{"grid", "100px / auto-flow", map[string]string{
+			"grid-template-rows": "100px", "grid-template-columns": "none", "grid-template-areas": "none",
+			"grid-auto-rows": "auto", "grid-auto-columns": "auto", "grid-auto-flow": "column",
+		}},
+		{"grid", "none", map[string]string{
+			"grid-template-rows": "none", "grid-template-columns": "none", "grid-template-areas": "none",
+			"grid-auto-rows": "auto", "grid-auto-columns": "auto", "grid-auto-flow": "row",
+		}},
+		{"grid", "1fr", nil},
+
+		{"text-decoration", "underline dotted red", map[string]string{
+			"text-decoration-line": "underline", "text-decoration-style": "dotted",
+			"text-decoration-color": "red", "text-decoration-thickness": "auto",
+		}},
+		{"text-decoration", "2px overline underline", map[string]string{
+			"text-decoration-line": "overline underline", "text-decoration-style": "solid",
+			"text-decoration-color": "currentcolor", "text-decoration-thickness": "2px",
+		}},
+		{"text-decoration", "none underline", nil},
+		{"columns", "3 10em", map[string]string{"column-width": "10em", "column-count": "3"}},
+		{"columns", "auto 12px", map[string]string{"column-width": "12px", "column-count": "auto"}},
+		{"columns", "-2", nil},
+		{"columns", "3 auto 10em", nil},
+		{"transition", "opacity 1s ease-in 200ms, color 2s", map[string]string{
+			"transition-property": "opacity, color", "transition-duration": "1s, 2s",
+			"transition-timing-function": "ease-in, ease", "transition-delay": "200ms, 0s",
+		}},
+		{"transition", "none", map[string]string{
+			"transition-property": "none", "transition-duration": "0s",
+			"transition-timing-function": "ease", "transition-delay": "0s",
+		}},
+		{"transition", "none, color 1s", nil},
+		{"transition", "-1s", nil},
+		{"animation", "spin 2s linear infinite", map[string]string{
+			"animation-name": "spin", "animation-duration": "2s", "animation-timing-function": "linear",
+			"animation-delay": "0s", "animation-iteration-count": "infinite", "animation-direction": "normal",
+			"animation-fill-mode": "none", "animation-play-state": "running",
+		}},
+		{"animation", "none forwards, paused 1s -1s fade", map[string]string{
+			"animation-name": "forwards, fade", "animation-duration": "0s, 1s", "animation-timing-function": "ease, ease",
+			"animation-delay": "0s, -1s", "animation-iteration-count": "1, 1", "animation-direction": "normal, normal",
+			"animation-fill-mode": "none, none", "animation-play-state": "running, paused",
+		}},
+		{"animation", "a b", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property+" "+tt.value, func(t *testing.T) {
+			got := expandShorthand(tt.property, tt.value)
+			if !maps.Equal(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSerializeShorthand tests that longhands serialize to the shortest
+// shorthand value, which expands back to the same longhands.
+// CSSOM §6.7.2 Serializing CSS Values
+func TestSerializeShorthand(t *testing.T) {
+	tests := []struct {
+		property string
+		value    string
+		expected string
+	}{
+		{"margin", "1px 2px 1px 2px", "1px 2px"},
+		{"padding", "0 0 0 0", "0"},
+		{"border", "2px solid red", "2px solid red"},
+		{"border", "dashed", "dashed"},
+		{"border-left", "medium none currentcolor", "none"},
+		{"outline", "dotted blue", "blue dotted"},
+		{"border-radius", "4px / 8px", "4px / 8px"},
+		{"list-style", "none", "none"},
+		{"list-style", "inside", "inside"},
+		{"font", "italic bold 12px/1.5 Georgia, serif", "italic bold 12px/1.5 Georgia, serif"},
+		{"font", "normal normal 16px monospace", "16px monospace"},
+		{"background", "url(x) no-repeat center / cover #fff", "url(x) center / cover no-repeat #fff"},
+		{"background", "content-box", "content-box"},
+		{"background", "url(a), url(b) red", "url(a), url(b) red"},
+		{"background", "transparent", "transparent"},
+		{"flex", "auto", "1 1 auto"},
+		{"flex-flow", "column", "column"},
+		{"gap", "1px 1px", "1px"},
+		{"place-self", "center start", "center start"},
+		{"grid-row", "a", "a"},
+		{"grid-area", "1 / 2", "1 / 2"},
+		{"grid-template", `"a b" 10px "c d" / 1fr 1fr`, `"a b" 10px "c d" / 1fr 1fr`},
+		{"grid", "auto-flow dense 40px / 1fr", "auto-flow dense 40px / 1fr"},
+		{"grid", "100px / auto-flow", "100px / auto-flow"},
+		{"text-decoration", "red underline", "underline red"},
+		{"text-decoration", "none", "none"},
+		{"columns", "auto 3", "3"},
+		{"columns", "auto", "auto"},
+		{"transition", "opacity 0s 1s, all", "opacity 0s 1s, all"},
+		{"animation", "none", "none"},
+		{"animation", "2s infinite spin", "2s infinite spin"},
+		{"animation", "both", "both"},
+		{"animation", "0s ease 0s 1 normal none running both", "0s ease 0s 1 normal none running both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.property+" "+tt.value, func(t *testing.T) {
+			longhands := expandShorthand(tt.property, tt.value)
+			got, ok := SerializeShorthand(tt.property, longhands)
+			if !ok || got != tt.expected {
+				t.Fatalf("Expected %q, got %q (ok %v)", tt.expected, got, ok)
+			}
+			if again := expandShorthand(tt.property, got); !maps.Equal(again, longhands) {
+				t.Errorf("Expected %q to expand to %v, got %v", got, longhands, again)
+			}
+		})
+	}
+
+	// Longhands no value of the shorthand gives
+	unrepresentable := []struct {
+		property string
+		styles   map[string]string
+	}{
+		{"border", map[string]string{"border-top-width": "1px"}},
+		{"font", map[string]string{"font-size": "12px", "font-family": "serif", "font-kerning": "none"}},
+		{"font", map[string]string{"font-size": "12px"}},
+		{"color", map[string]string{"color": "red"}},
+		{"transition", map[string]string{"transition-property": "opacity, color", "transition-duration": "1s"}},
+	}
+	for _, tt := range unrepresentable {
+		if got, ok := SerializeShorthand(tt.property, tt.styles); ok {
+			t.Errorf("Expected %s not to serialize %v, got %q", tt.property, tt.styles, got)
+		}
+	}
+}
+
+// TestShorthandCascade tests that shorthands reset the longhands they omit
+// and that their longhands reach the computed style.
+// CSS 2.1 §1.4.3 Shorthand properties
+func TestShorthandCascade(t *testing.T) {
+	stylesheet := css.Parse(`
+		div { font-weight: bold; line-height: 3; font: italic 20px/1.5 Georgia, serif; }
+		p { border: 2px solid red; border-bottom: dashed; background: url(x.png) blue; background: green; }
+		span { margin: 4px; margin: 1px 2px 3px 4px 5px; text-decoration: wavy underline; }
+	`)
+	doc := html.Parse(`<html><body><div><p><span>text</span></p></div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	div := findStyledNode(styled, "div").Style()
+	if div.Font.Size != 20 || div.Font.Weight != "normal" || div.Font.Style != "italic" || div.Font.Family != "Georgia, serif" {
+		t.Errorf("Expected the font shorthand's font, got %+v", div.Font)
+	}
+	if lh := findStyledNode(styled, "div").Styles["line-height"]; lh != "1.5" {
+		t.Errorf("Expected line-height 1.5, got %q", lh)
+	}
+
+	p := findStyledNode(styled, "p").Style()
+	if px, _ := p.BorderWidth.Top.Resolve(0); px != 2 || p.BorderStyle.Top != "solid" {
+		t.Errorf("Expected a 2px solid top border, got %v %q", px, p.BorderStyle.Top)
+	}
+	// border-bottom resets the bottom width and color
+	if px, _ := p.BorderWidth.Bottom.Resolve(0); px != 3 || p.BorderStyle.Bottom != "dashed" || p.BorderColor.Bottom != p.Color {
+		t.Errorf("Expected a medium dashed bottom border in currentcolor, got %v %q %v", px, p.BorderStyle.Bottom, p.BorderColor.Bottom)
+	}
+	if p.BackgroundImage != "" || p.BackgroundColor.G == 0 {
+		t.Errorf("Expected the second background to reset the image, got %q %v", p.BackgroundImage, p.BackgroundColor)
+	}
+
+	span := findStyledNode(styled, "span").Style()
+	if px, _ := span.Margin.Left.Resolve(0); px != 4 {
+		t.Errorf("Expected the invalid margin to be ignored, got %v", px)
+	}
+	if span.Font.Decoration != "underline" {
+		t.Errorf("Expected text-decoration to set the underline, got %q", span.Font.Decoration)
+	}
+}
@@ -7,46 +7,117 @@
 // - CSS 2.1 §6.4.4 Precedence of non-CSS presentational hints: https://www.w3.org/TR/CSS21/cascade.html#preshint
 //
 // Implemented features:
-// - Selector matching: element, class, ID, descendant combinators
+// - Selector matching: element, universal, class, ID
+// - Combinators: descendant, child (>), adjacent sibling (+), general sibling (~)
+// - Tree-structural pseudo-classes: :root, :empty, :*-child, :nth-*() (Selectors Level 4 §14)
+// - Logical pseudo-classes: :not(), :is(), :where(), :has() (Selectors Level 4 §4)
 // - Specificity calculation per CSS 2.1 §6.4.3
-// - Cascade by specificity and source order
+// - Rule index and ancestor bloom filter for fast selector matching (ruleindex.go)
+// - Style sharing between elements the cascade must give the same styles (sharing.go)
+// - Independent subtrees styled in parallel by a bounded worker pool (parallel.go)
+// - Explanations of an element's matched rules and winning declarations (explain.go)
+// - Presentational hints of the HTML Rendering section (HTML §15, hints.go)
+// - Cascade by origin, importance, specificity and source order (CSS 2.1 §6.4.1, §6.4.2)
+// - @media rules evaluated against a media environment (Media Queries Level 4)
+// - Author stylesheets from <style>, <link> and @import, in cascade order
 // - Inline style attribute support (highest specificity)
-// - User-agent stylesheet (lowest specificity)
-// - Property inheritance for font properties (CSS 2.1 §6.2)
-// - Shorthand property expansion (margin, padding, border)
+// - User-agent stylesheet (lowest specificity), replaceable through Options
+// - User stylesheet, cascaded between the user-agent and author origins (CSS Cascading Level 4 §6.3)
+// - Property inheritance for the inherited properties of the registry (CSS 2.1 §6.2, properties.go)
+// - The CSS-wide keywords inherit, initial, unset and revert (CSS Cascading Level 4 §7.3, properties.go)
+// - Typed computed styles read by layout and rendering (CSS 2.1 §6.1.2, computed.go)
+// - Shorthand expansion by each shorthand's grammar, and serialization back (CSS 2.1 §1.4.3, shorthands.go)
+// - ::before/::after generated content with counters and quotes (CSS 2.1 §12)
+// - ::marker boxes, list-style-* and HTML list numbering (CSS Lists Level 3)
+// - The dir attribute and <bdi>/<bdo> directionality (HTML §3.2.6.4)
+// - Computed font sizes and font- and viewport-relative lengths (CSS Values and Units Level 4 §6.1)
+// - Custom properties, var() and @property registrations (CSS Variables Level 1)
+// - currentcolor computed to the element's color (CSS Color Level 4 §6.4)
 //
 // Not yet implemented (noted with log warnings where encountered):
-// - !important declarations (CSS 2.1 §6.4.2)
-// - Child combinator > (CSS 2.1 §5.6)
-// - Sibling combinators +, ~ (CSS 2.1 §5.7, CSS3 Selectors)
 // - Attribute selectors [attr=value] (CSS 2.1 §5.8)
-// - Pseudo-classes :hover, :focus, etc. (CSS 2.1 §5.11)
-// - Pseudo-elements ::before, ::after (CSS 2.1 §5.12)
-// - Full computed value calculation (CSS 2.1 §6.1.2)
-// - Inheritance of all inheritable properties (currently subset)
+// - Dynamic pseudo-classes :hover, :focus, etc. (CSS 2.1 §5.11.3) - ignored when matching
+// - Pseudo-elements other than ::marker, ::before and ::after (CSS 2.1 §5.12)
+// - Typed computed values of properties layout and rendering do not use (CSS 2.1 §6.1.2)
 package style
 
 import (
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/lukehoban/browser/bidi"
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
 )
 
 // StyledNode represents a DOM node with computed styles.
 type StyledNode struct {
-	Node     *dom.Node
+	Node *dom.Node
+
+	// Styles holds the cascaded values of the node's properties, including
+	// custom properties, as strings. Lengths and colors in it are
+	// computed; Style returns them typed.
 	Styles   map[string]string
 	Children []*StyledNode
+
+	// PseudoElement is "marker", "before" or "after" for generated content
+	// boxes and empty for nodes of the document. Generated nodes have a synthetic
+	// element Node named "::before"/"::after" whose Parent is the
+	// originating element; it is not part of the DOM.
+	// CSS 2.1 §12.1 The :before and :after pseudo-elements
+	PseudoElement string
+
+	computed *ComputedStyle
 }
 
-// MatchedRule represents a CSS rule that matched a node, with its specificity.
+// Style returns the node's computed style. StyleTree computes it once the
+// node's Styles are final; for nodes built otherwise it is computed from
+// Styles on first use.
+func (n *StyledNode) Style() *ComputedStyle {
+	if n.computed == nil {
+		n.computed = ComputeStyle(n.Styles)
+	}
+	return n.computed
+}
+
+// MatchedRule represents a CSS rule that matched a node, with its origin
+// and the specificity of the selector that matched.
 type MatchedRule struct {
 	Rule        *css.Rule
+	Selector    *css.Selector
+	Origin      Origin
 	Specificity Specificity
 }
 
+// Origin is the origin of a declaration, which the cascade sorts by before
+// specificity.
+// CSS 2.1 §6.4.1 Cascading order
+type Origin int
+
+const (
+	// UserAgentOrigin is the user-agent stylesheet.
+	UserAgentOrigin Origin = iota
+	// UserOrigin is the user's stylesheet, Options.UserStylesheet.
+	// CSS Cascading Level 4 §6.3 Cascade Origins
+	UserOrigin
+	// AuthorOrigin is the document's stylesheets and style attributes.
+	AuthorOrigin
+)
+
+// String returns the name of the origin.
+func (o Origin) String() string {
+	switch o {
+	case UserAgentOrigin:
+		return "user agent"
+	case UserOrigin:
+		return "user"
+	default:
+		return "author"
+	}
+}
+
 // Specificity represents the specificity of a CSS selector.
 // CSS 2.1 §6.4.3 Calculating a selector's specificity
 type Specificity struct {
@@ -71,217 +142,551 @@ func (s Specificity) Compare(other Specificity) int {
 	return s.D - other.D
 }
 
-// StyleTree computes styles for a DOM tree using a stylesheet.
+// Options configures style computation.
+type Options struct {
+	// Media is the environment @media rules are evaluated against.
+	// Media Queries Level 4 §2 Media Queries
+	Media css.MediaEnvironment
+
+	// UserAgentStylesheet replaces DefaultUserAgentStylesheet if not nil.
+	UserAgentStylesheet *css.Stylesheet
+
+	// UserStylesheet holds the user's styles, such as larger fonts or
+	// forced colors, if not nil. Its normal declarations override the
+	// user agent's and are overridden by the author's; its important
+	// declarations override the author's.
+	// CSS Cascading Level 4 §6.3 Cascade Origins
+	UserStylesheet *css.Stylesheet
+
+	// DisableStyleSharing styles every element on its own instead of
+	// reusing the styles of equivalent elements (sharing.go).
+	DisableStyleSharing bool
+
+	// Stats, if not nil, receives the number of nodes styled and how many
+	// of them shared their styles.
+	Stats *Stats
+
+	// Parallelism is the number of goroutines that style subtrees at once
+	// (parallel.go). At most 1 styles the tree sequentially.
+	Parallelism int
+}
+
+// DefaultOptions returns the options used by StyleTree: the default
+// 800x600 light-mode screen, styled with one goroutine per CPU.
+func DefaultOptions() Options {
+	return Options{
+		Media:       css.DefaultMediaEnvironment(),
+		Parallelism: runtime.GOMAXPROCS(0),
+	}
+}
+
+// StyleTree computes styles for a DOM tree using a stylesheet and the
+// default options.
 // CSS 2.1 §6 Assigning property values
 // CSS 2.1 §6.4.4: User agent -> Author stylesheet cascade
 func StyleTree(root *dom.Node, authorStylesheet *css.Stylesheet) *StyledNode {
+	return StyleTreeWithOptions(root, authorStylesheet, DefaultOptions())
+}
+
+// StyleTreeWithOptions computes styles for a DOM tree using a stylesheet.
+// Rules inside @media blocks that do not match opts.Media are ignored.
+// CSS 2.1 §7.2.1 The @media rule
+func StyleTreeWithOptions(root *dom.Node, authorStylesheet *css.Stylesheet, opts Options) *StyledNode {
+	return styleTree(root, authorStylesheet, opts, nil)
+}
+
+// styleTree computes styles for a DOM tree, recording the cascades of the
+// elements of traces (explain.go).
+func styleTree(root *dom.Node, authorStylesheet *css.Stylesheet, opts Options, traces map[*dom.Node]*cascadeTrace) *StyledNode {
 	// CSS 2.1 §6.4.1: Cascading order - User agent styles come first
-	// Merge user-agent stylesheet with author stylesheet
+	// Merge user-agent stylesheet with user and author stylesheets
 	mergedStylesheet := &css.Stylesheet{
 		Rules: make([]*css.Rule, 0),
 	}
-	
+
 	// Add user-agent styles first (lower specificity in cascade)
-	userAgentStylesheet := DefaultUserAgentStylesheet()
-	mergedStylesheet.Rules = append(mergedStylesheet.Rules, userAgentStylesheet.Rules...)
-	
-	// Add author styles second (higher specificity in cascade)
+	userAgentStylesheet := opts.UserAgentStylesheet
+	if userAgentStylesheet == nil {
+		userAgentStylesheet = DefaultUserAgentStylesheet()
+	}
+	mergedStylesheet.Rules = appendMatchingRules(mergedStylesheet.Rules, userAgentStylesheet, opts.Media)
+	userAgentRules := len(mergedStylesheet.Rules)
+
+	// Add user styles second, and author styles last (higher specificity
+	// in cascade). Custom properties registered by the author win over the
+	// user's.
+	if opts.UserStylesheet != nil {
+		mergedStylesheet.Rules = appendMatchingRules(mergedStylesheet.Rules, opts.UserStylesheet, opts.Media)
+		mergedStylesheet.Properties = append(mergedStylesheet.Properties, opts.UserStylesheet.Properties...)
+	}
+	userRules := len(mergedStylesheet.Rules) - userAgentRules
 	if authorStylesheet != nil {
-		mergedStylesheet.Rules = append(mergedStylesheet.Rules, authorStylesheet.Rules...)
+		mergedStylesheet.Rules = appendMatchingRules(mergedStylesheet.Rules, authorStylesheet, opts.Media)
+		mergedStylesheet.Properties = append(mergedStylesheet.Properties, authorStylesheet.Properties...)
 	}
-	
-	return styleNode(root, mergedStylesheet, make(map[string]string))
+
+	ctx := newStyleContext(mergedStylesheet, userAgentRules, userRules, opts.Media)
+	if !opts.DisableStyleSharing {
+		ctx.sharing = newStyleSharingCache()
+	}
+	ctx.workers = newWorkerPool(opts.Parallelism)
+	ctx.traces = traces
+	styled := styleNode(root, ctx, nil)
+	if opts.Stats != nil {
+		*opts.Stats = ctx.stats
+	}
+
+	// Counters and quote nesting depend on document order, so generated
+	// content is resolved in a separate pass once the whole tree is styled.
+	generateContent(styled)
+
+	return styled
+}
+
+// appendMatchingRules appends the rules of stylesheet whose enclosing @media
+// rules match env. Media queries do not depend on the element, so they are
+// evaluated once here rather than during selector matching.
+func appendMatchingRules(rules []*css.Rule, stylesheet *css.Stylesheet, env css.MediaEnvironment) []*css.Rule {
+	for _, rule := range stylesheet.Rules {
+		if rule.MatchesMedia(env) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
 }
 
 // styleNode computes styles for a single node and its children.
 // CSS 2.1 §6.2: Font properties are inherited from parent to child
-func styleNode(node *dom.Node, stylesheet *css.Stylesheet, parentStyles map[string]string) *StyledNode {
+func styleNode(node *dom.Node, ctx *styleContext, parent *StyledNode) *StyledNode {
 	styled := &StyledNode{
 		Node:     node,
-		Styles:   make(map[string]string),
 		Children: make([]*StyledNode, 0),
 	}
-
-	// CSS 2.1 §6.2: Inherited properties are passed from parent to child.
-	// Per CSS 2.1 property definitions, the following are inherited by default:
-	// - color (§14.1), font-* (§15), line-height (§10.8.1)
-	// - text-indent, text-align, text-transform (§16.1-16.5)
-	// - letter-spacing, word-spacing (§16.4)
-	// - white-space (§16.6), list-style-* (§12.5)
-	// Note: text-decoration is NOT inherited per CSS 2.1 §16.3.1
-	// We implement a subset relevant to current rendering capabilities.
-	inheritedProps := []string{
-		"color",
-		"font-size",
-		"font-family",
-		"font-weight",
-		"font-style",
-		"line-height",
-		"text-align",
-		"text-transform",
-		"letter-spacing",
-		"word-spacing",
-		"white-space",
+	parentStyles := make(map[string]string)
+	if parent != nil {
+		parentStyles = parent.Styles
 	}
-	
-	for _, prop := range inheritedProps {
-		if val, ok := parentStyles[prop]; ok {
-			styled.Styles[prop] = val
+
+	// Reuse the styles of an earlier node with the same parent styles, tag
+	// and attributes if nothing else can affect them (sharing.go)
+	key, sharable := ctx.sharingKey(node, parent)
+	shared := ctx.sharing.lookup(key, sharable)
+	if shared != nil {
+		styled.Styles = shared.Styles
+		styled.computed = shared.computed
+	} else {
+		styled.Styles = inheritStyles(parentStyles)
+		// Only compute styles for element nodes
+		if node.Type == dom.ElementNode {
+			ctx.cascadeElement(node, styled.Styles, parentStyles)
+		}
+		styled.computed = ComputeStyle(styled.Styles)
+		if sharable {
+			ctx.sharing.insert(key, styled)
 		}
 	}
+	ctx.stats.count(node, shared != nil)
+
+	// CSS Lists Level 3 §3.1: List items get a ::marker, placed before
+	// any ::before content
+	if marker := styleMarker(node, ctx, styled); marker != nil {
+		styled.Children = append(styled.Children, marker)
+	}
 
-	// Only compute styles for element nodes
+	// CSS 2.1 §12.1: :before content is the first child of the element
+	if before := stylePseudoElement(node, "before", ctx, styled.Styles); before != nil {
+		styled.Children = append(styled.Children, before)
+	}
+
+	// Recursively style children, with the node among their ancestors.
+	// Their subtrees may be styled in parallel (parallel.go).
 	if node.Type == dom.ElementNode {
-		// HTML presentational attributes: Convert to CSS styles before applying CSS rules
-		// These have lower specificity than CSS rules, so apply them first
-		// HTML5 §2.4.4: Presentational hints
-		applyPresentationalHints(node, styled.Styles)
-		
-		// Find all matching rules
-		matchedRules := matchRules(node, stylesheet)
+		ctx.ancestors.push(node)
+	}
+	styled.Children = append(styled.Children, ctx.styleChildren(styled)...)
+	if node.Type == dom.ElementNode {
+		ctx.ancestors.pop()
+	}
 
-		// Apply rules in order of specificity
-		for _, matched := range matchedRules {
-			for _, decl := range matched.Rule.Declarations {
-				applyDeclaration(decl, styled.Styles)
-			}
-		}
-		
-		// cellpadding and cellspacing attribute handling
-		// HTML5 §14.3.9: These attributes override user-agent defaults
-		// Applied after CSS rules but before inline styles (similar to author CSS with higher specificity)
-		
-		// cellspacing attribute (used on <table>)
-		if node.Data == "table" {
-			if cellspacing := node.GetAttribute("cellspacing"); cellspacing != "" {
-				// Convert to CSS border-spacing (applies to horizontal and vertical spacing)
-				styled.Styles["border-spacing"] = cellspacing + "px"
-			}
+	// CSS 2.1 §12.1: :after content is the last child of the element
+	if after := stylePseudoElement(node, "after", ctx, styled.Styles); after != nil {
+		styled.Children = append(styled.Children, after)
+	}
+
+	return styled
+}
+
+// cascadeElement computes the styles of the element node into styles,
+// which hold the values it inherits from parentStyles.
+// CSS 2.1 §6.4.1 Cascading order
+func (ctx *styleContext) cascadeElement(node *dom.Node, styles, parentStyles map[string]string) {
+	// Default styles of elements the user-agent stylesheet cannot express
+	trace := ctx.traceOf(node)
+	trace.snapshot(styles)
+	applyElementDefaults(node, styles)
+	trace.setFromAttributes(styles)
+
+	// Find all matching rules
+	matchedRules := ctx.matchRules(node, "")
+	inlineDecls := css.ParseInlineStyle(node.GetAttribute("style"))
+	trace.cascaded(ctx, parentStyles, matchedRules, inlineDecls)
+
+	// CSS Variables Level 1 §2: custom properties are cascaded first,
+	// so that var() in other properties can refer to them
+	ctx.cascadeCustomProperties(styles, parentStyles, matchedRules, inlineDecls)
+
+	// Apply the normal declarations of the user-agent and user origins
+	// CSS Cascading Level 4 §6.1 Cascade Sorting Order
+	order := cascadeOrder(matchedRules, inlineDecls)
+	cascade := newCascade(styles, parentStyles, matchedRules)
+	cascade.node = node
+	cascade.trace = trace
+	next := 0
+	applyWhile := func(more func(d originDeclaration) bool) {
+		for ; next < len(order) && more(order[next]); next++ {
+			cascade.apply(order[next].decl, order[next].origin)
 		}
-		
-		// cellpadding attribute inheritance from table to cells
-		if (node.Data == "td" || node.Data == "th") && node.Parent != nil {
-			// Walk up to find the containing table
-			parent := node.Parent
-			for parent != nil {
-				if parent.Data == "table" {
-					if cellpadding := parent.GetAttribute("cellpadding"); cellpadding != "" {
-						// Apply as padding to all sides of the cell
-						paddingValue := cellpadding + "px"
-						styled.Styles["padding-top"] = paddingValue
-						styled.Styles["padding-right"] = paddingValue
-						styled.Styles["padding-bottom"] = paddingValue
-						styled.Styles["padding-left"] = paddingValue
-					}
-					break
-				}
-				parent = parent.Parent
-			}
+	}
+	applyWhile(func(d originDeclaration) bool {
+		return d.origin == UserAgentOrigin && !d.decl.Important
+	})
+
+	// HTML5 §4.4.5, §4.4.8: the start, reversed and value attributes
+	// number list items as the user-agent stylesheet does
+	trace.snapshot(styles)
+	applyListCounters(node, styles)
+	trace.setFromAttributes(styles)
+
+	applyWhile(func(d originDeclaration) bool {
+		return d.origin == UserOrigin && !d.decl.Important
+	})
+
+	// HTML presentational attributes: Convert to CSS styles before applying author rules
+	// These have lower specificity than author CSS rules, so apply them first
+	// HTML §15.2: Presentational hints (hints.go)
+	// CSS 2.1 §6.4.4: hints are treated as author rules at the start of the
+	// author stylesheet
+	trace.snapshot(styles)
+	applyPresentationalHints(node, styles)
+	trace.setFromAttributes(styles)
+
+	// Apply author rules in order of specificity
+	applyWhile(func(d originDeclaration) bool {
+		return d.origin == AuthorOrigin && !d.decl.Important && !d.inline
+	})
+
+	// Apply inline styles last - they have highest specificity
+	// CSS 2.1 §6.4.3: Inline styles have specificity A=1, higher than any selector
+	// CSS 2.1 §6.4.2: then the important declarations, which override
+	// normal ones
+	applyWhile(func(originDeclaration) bool { return true })
+
+	// CSS 2.1 §6.1.2: Relative lengths compute to absolute lengths,
+	// which descendants inherit
+	ctx.computeLengths(styles, parentStyles, isRootElement(node))
+	computeColors(styles, parentStyles)
+	computeRelativeWeight(styles, parentStyles)
+}
+
+// inheritStyles returns a new style map holding the inherited properties of
+// parentStyles, including its custom properties.
+func inheritStyles(parentStyles map[string]string) map[string]string {
+	styles := make(map[string]string)
+	for _, property := range propertyTable {
+		if val, ok := parentStyles[property.Name]; ok && property.Inherited {
+			styles[property.Name] = val
 		}
-		
-		// Apply inline styles last - they have highest specificity
-		// CSS 2.1 §6.4.3: Inline styles have specificity A=1, higher than any selector
-		if styleAttr := node.GetAttribute("style"); styleAttr != "" {
-			inlineDecls := css.ParseInlineStyle(styleAttr)
-			for _, decl := range inlineDecls {
-				applyDeclaration(decl, styled.Styles)
-			}
+	}
+	for prop, val := range parentStyles {
+		if css.IsCustomProperty(prop) {
+			styles[prop] = val
 		}
 	}
+	return styles
+}
 
-	// Recursively style children
-	for _, child := range node.Children {
-		styledChild := styleNode(child, stylesheet, styled.Styles)
-		styled.Children = append(styled.Children, styledChild)
+// stylePseudoElement computes the styles of the ::before or ::after
+// pseudo-element of node. It returns nil if no rule targets the
+// pseudo-element or its 'content' generates nothing. The children of the
+// returned node are filled in later by generateContent.
+// CSS 2.1 §12.1 The :before and :after pseudo-elements
+func stylePseudoElement(node *dom.Node, pseudo string, ctx *styleContext, elementStyles map[string]string) *StyledNode {
+	if node.Type != dom.ElementNode {
+		return nil
 	}
 
-	return styled
+	matchedRules := ctx.matchRules(node, pseudo)
+	if len(matchedRules) == 0 {
+		return nil
+	}
+
+	// CSS 2.1 §12.1: Pseudo-elements inherit from their originating element
+	styles := inheritStyles(elementStyles)
+	ctx.cascadeCustomProperties(styles, elementStyles, matchedRules, nil)
+	newCascade(styles, elementStyles, matchedRules).applyAll(nil)
+
+	// CSS 2.1 §12.2: 'normal' and 'none' generate no pseudo-element
+	if _, ok := css.ParseContent(styles["content"]); !ok {
+		return nil
+	}
+	ctx.computeLengths(styles, elementStyles, false)
+	computeColors(styles, elementStyles)
+	computeRelativeWeight(styles, elementStyles)
+
+	// CSS 2.1 §9.2.4: The initial value of 'display' is 'inline'
+	if styles["display"] == "" {
+		styles["display"] = "inline"
+	}
+
+	return newPseudoElement(node, pseudo, styles)
+}
+
+// styleMarker computes the styles of the ::marker pseudo-element of
+// element, a list item. It returns nil for elements that are not list items and for list
+// items whose marker would be empty. The marker's contents are filled in
+// later by generateContent.
+// CSS Lists Level 3 §3.1 The ::marker pseudo-element
+func styleMarker(node *dom.Node, ctx *styleContext, element *StyledNode) *StyledNode {
+	if node.Type != dom.ElementNode || element.Style().Display != "list-item" {
+		return nil
+	}
+	elementStyles := element.Styles
+
+	styles := inheritStyles(elementStyles)
+	matchedRules := ctx.matchRules(node, "marker")
+	ctx.cascadeCustomProperties(styles, elementStyles, matchedRules, nil)
+	newCascade(styles, elementStyles, matchedRules).applyAll(nil)
+
+	// CSS Lists Level 3 §3.1: 'content: none' suppresses the marker, and
+	// 'content: normal' shows the list style unless it is 'none'
+	switch strings.TrimSpace(styles["content"]) {
+	case "none":
+		return nil
+	case "", "normal":
+		hasImage := strings.HasPrefix(styles["list-style-image"], "url(")
+		if listStyleTypeOf(styles) == "none" && !hasImage {
+			return nil
+		}
+	}
+
+	// Markers are laid out by the list item according to
+	// 'list-style-position' rather than by 'display'
+	styles["display"] = "inline"
+	ctx.computeLengths(styles, elementStyles, false)
+	computeColors(styles, elementStyles)
+	computeRelativeWeight(styles, elementStyles)
+
+	return newPseudoElement(node, "marker", styles)
+}
+
+// newPseudoElement creates the styled node for a pseudo-element of node with
+// a synthetic element named after it, e.g. "::before".
+func newPseudoElement(node *dom.Node, pseudo string, styles map[string]string) *StyledNode {
+	generated := dom.NewElement("::" + pseudo)
+	generated.Parent = node
+
+	return &StyledNode{
+		Node:          generated,
+		Styles:        styles,
+		Children:      make([]*StyledNode, 0),
+		PseudoElement: pseudo,
+		computed:      ComputeStyle(styles),
+	}
 }
 
 // matchRules finds all CSS rules that match a node.
-// Returns rules sorted by specificity (lowest to highest).
-// CSS 2.1 §6.4.3
-func matchRules(node *dom.Node, stylesheet *css.Stylesheet) []MatchedRule {
+// Returns rules sorted by origin and then specificity (lowest to highest),
+// rules that tie keeping their source order.
+// CSS 2.1 §6.4.1 Cascading order, §6.4.3
+// pseudo selects rules for the node's ::before or ::after pseudo-element
+// instead of the node itself; it is empty for the node.
+// Only the rules indexed under the node's ID, classes or tag are tested,
+// and selectors needing ancestors the node lacks are rejected by the
+// ancestor filter when it holds the node's ancestors (ruleindex.go).
+func (ctx *styleContext) matchRules(node *dom.Node, pseudo string) []MatchedRule {
 	matched := make([]MatchedRule, 0)
+	if node.Type != dom.ElementNode {
+		return matched
+	}
 
-	for _, rule := range stylesheet.Rules {
-		for _, selector := range rule.Selectors {
-			if matchesSelector(node, selector) {
-				specificity := calculateSpecificity(selector)
-				matched = append(matched, MatchedRule{
-					Rule:        rule,
-					Specificity: specificity,
-				})
-				break // Only count each rule once
-			}
+	filtered := ctx.ancestors.covers(node)
+	var last *css.Rule
+	for _, candidate := range ctx.rules.candidates(node) {
+		if candidate.pseudo != pseudo {
+			continue
+		}
+		// Candidates are in source order, so a rule's selectors are
+		// adjacent; each rule is counted once, with the most specific of
+		// its selectors that match.
+		// Selectors Level 3 §9: a selector list takes the specificity of
+		// its most specific matching selector
+		if candidate.rule == last && candidate.specificity.Compare(matched[len(matched)-1].Specificity) <= 0 {
+			continue
 		}
+		if filtered && !ctx.ancestors.mightContainAll(candidate.ancestorHashes) {
+			continue
+		}
+		if !matchesSelector(node, candidate.selector) {
+			continue
+		}
+		if candidate.rule == last {
+			matched[len(matched)-1].Selector = candidate.selector
+			matched[len(matched)-1].Specificity = candidate.specificity
+			continue
+		}
+		matched = append(matched, MatchedRule{
+			Rule:        candidate.rule,
+			Selector:    candidate.selector,
+			Origin:      candidate.origin,
+			Specificity: candidate.specificity,
+		})
+		last = candidate.rule
 	}
 
-	// Sort by specificity (simple bubble sort for small lists)
-	for i := 0; i < len(matched); i++ {
-		for j := i + 1; j < len(matched); j++ {
-			if matched[i].Specificity.Compare(matched[j].Specificity) > 0 {
-				matched[i], matched[j] = matched[j], matched[i]
-			}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Origin != matched[j].Origin {
+			return matched[i].Origin < matched[j].Origin
+		}
+		return matched[i].Specificity.Compare(matched[j].Specificity) < 0
+	})
+
+	return matched
+}
+
+// selectorPseudoElement returns the pseudo-element a selector targets, or ""
+// if it targets elements. Pseudo-elements may only appear once, in the last
+// compound selector; otherwise the selector matches nothing and ok is false.
+// CSS 2.1 §5.12 Pseudo-elements
+func selectorPseudoElement(selector *css.Selector) (pseudo string, ok bool) {
+	for i, simple := range selector.Simple {
+		if len(simple.PseudoElements) == 0 {
+			continue
 		}
+		if i != len(selector.Simple)-1 || len(simple.PseudoElements) > 1 {
+			return "", false
+		}
+		return simple.PseudoElements[0], true
 	}
+	return "", true
+}
 
+// QuerySelectorAll returns the elements of root matching any selector of
+// the comma-separated list selectors, in document order. Pseudo-elements
+// match nothing.
+// Selectors API Level 1 §6 querySelectorAll()
+func QuerySelectorAll(root *dom.Node, selectors string) []*dom.Node {
+	list := css.ParseSelectors(selectors)
+	var matched []*dom.Node
+	for _, element := range appendDescendantElements(nil, root) {
+		for _, selector := range list {
+			if pseudo, ok := selectorPseudoElement(selector); ok && pseudo == "" && matchesSelector(element, selector) {
+				matched = append(matched, element)
+				break
+			}
+		}
+	}
 	return matched
 }
 
 // matchesSelector checks if a node matches a CSS selector.
-// This handles simple selectors and descendant combinators.
-// CSS 2.1 §5 Selectors
+// Selectors are matched right to left: the rightmost compound selector must
+// match the node itself, and each combinator then constrains where the next
+// compound selector to the left must match.
+// CSS 2.1 §5 Selectors, Selectors Level 3 §8 Combinators
 func matchesSelector(node *dom.Node, selector *css.Selector) bool {
-	// For descendant selectors, we need to match from right to left
 	if len(selector.Simple) == 0 {
 		return false
 	}
+	return matchesComplex(node, selector, len(selector.Simple)-1, nil)
+}
 
-	// Start with the rightmost (most specific) selector
-	if !matchesSimpleSelector(node, selector.Simple[len(selector.Simple)-1]) {
+// matchesComplex checks whether node matches selector.Simple[index] and the
+// compound selectors to its left are satisfied through their combinators.
+// If anchor is non-nil, the selector is relative (Selectors Level 4 §3.3) and
+// the leftmost compound selector must be related to anchor by
+// selector.Leading.
+func matchesComplex(node *dom.Node, selector *css.Selector, index int, anchor *dom.Node) bool {
+	if !matchesSimpleSelector(node, selector.Simple[index]) {
 		return false
 	}
 
-	// If there's only one simple selector, we're done
-	if len(selector.Simple) == 1 {
-		return true
+	if index == 0 {
+		if anchor == nil {
+			return true
+		}
+		return relatedBy(anchor, node, selector.Leading)
 	}
 
-	// Check for descendant combinators
-	return matchesDescendant(node, selector.Simple[:len(selector.Simple)-1])
+	switch selector.CombinatorAt(index - 1) {
+	case css.ChildCombinator:
+		// CSS 2.1 §5.6 Child selectors
+		parent := parentElement(node)
+		return parent != nil && matchesComplex(parent, selector, index-1, anchor)
+	case css.AdjacentSiblingCombinator:
+		// CSS 2.1 §5.7 Adjacent sibling selectors
+		prev := previousElementSibling(node)
+		return prev != nil && matchesComplex(prev, selector, index-1, anchor)
+	case css.GeneralSiblingCombinator:
+		// Selectors Level 3 §8.3.2 General sibling combinator
+		for prev := previousElementSibling(node); prev != nil; prev = previousElementSibling(prev) {
+			if matchesComplex(prev, selector, index-1, anchor) {
+				return true
+			}
+		}
+		return false
+	default:
+		return matchesDescendant(node, selector, index-1, anchor)
+	}
 }
 
-// matchesDescendant checks if a node has ancestors matching the given selectors.
+// matchesDescendant checks if a node has an ancestor matching
+// selector.Simple[index] (and everything to its left).
 // CSS 2.1 §5.5 Descendant selectors
-func matchesDescendant(node *dom.Node, selectors []*css.SimpleSelector) bool {
-	if len(selectors) == 0 {
-		return true
+func matchesDescendant(node *dom.Node, selector *css.Selector, index int, anchor *dom.Node) bool {
+	for current := parentElement(node); current != nil; current = parentElement(current) {
+		if matchesComplex(current, selector, index, anchor) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Walk up the tree looking for ancestors that match
-	current := node.Parent
-	for current != nil {
-		if matchesSimpleSelector(current, selectors[len(selectors)-1]) {
-			// Found a match, check remaining selectors
-			if len(selectors) == 1 {
+// relatedBy reports whether node stands in the given combinator relationship
+// to anchor, e.g. for ChildCombinator whether node is a child of anchor.
+func relatedBy(anchor, node *dom.Node, combinator css.Combinator) bool {
+	switch combinator {
+	case css.ChildCombinator:
+		return node.Parent == anchor
+	case css.AdjacentSiblingCombinator:
+		return previousElementSibling(node) == anchor
+	case css.GeneralSiblingCombinator:
+		for prev := previousElementSibling(node); prev != nil; prev = previousElementSibling(prev) {
+			if prev == anchor {
 				return true
 			}
-			if matchesDescendant(current, selectors[:len(selectors)-1]) {
+		}
+		return false
+	default:
+		for current := node.Parent; current != nil; current = current.Parent {
+			if current == anchor {
 				return true
 			}
 		}
-		current = current.Parent
+		return false
 	}
-
-	return false
 }
 
 // matchesSimpleSelector checks if a node matches a simple selector.
 // CSS 2.1 §5.2 Selector syntax
 func matchesSimpleSelector(node *dom.Node, selector *css.SimpleSelector) bool {
+	// Selectors only ever match elements
+	if node.Type != dom.ElementNode {
+		return false
+	}
+
 	// Check element type
-	if selector.TagName != "" && selector.TagName != node.Data {
+	// CSS 2.1 §5.3: The universal selector matches any element type
+	if selector.TagName != "" && selector.TagName != "*" && selector.TagName != node.Data {
 		return false
 	}
 
@@ -307,223 +712,301 @@ func matchesSimpleSelector(node *dom.Node, selector *css.SimpleSelector) bool {
 		}
 	}
 
-	// Check pseudo-classes for link state
-	// CSS 2.1 §5.11.2: :link and :visited pseudo-classes
-	// Since we don't track visited state, we treat all links as unvisited (:link)
-	// Therefore, selectors with :visited should not match any elements
-	if len(selector.PseudoClasses) > 0 {
-		hasLink := false
-		for _, pseudoClass := range selector.PseudoClasses {
-			if pseudoClass == "visited" {
-				// :visited pseudo-class - don't match (treat all links as unvisited)
-				return false
-			}
-			if pseudoClass == "link" {
-				hasLink = true
-			}
-			// Other pseudo-classes like :hover, :active, :focus are ignored
-			// (they're counted in specificity but don't affect matching)
+	for _, pseudoClass := range selector.PseudoClasses {
+		if !matchesPseudoClass(node, pseudoClass) {
+			return false
 		}
-		
-		// If selector has :link, verify this is an <a> element with href
-		if hasLink {
-			if node.Data != "a" || node.GetAttribute("href") == "" {
+	}
+
+	for _, fn := range selector.PseudoFunctions {
+		if !matchesPseudoFunction(node, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesPseudoClass checks a non-functional pseudo-class against a node.
+// CSS 2.1 §5.11 Pseudo-classes, Selectors Level 4 §14 Tree-Structural pseudo-classes
+func matchesPseudoClass(node *dom.Node, pseudoClass string) bool {
+	switch pseudoClass {
+	case "link", "any-link":
+		// CSS 2.1 §5.11.2: Since we don't track visited state, all links are unvisited
+		return node.Data == "a" && node.GetAttribute("href") != ""
+	case "visited":
+		// :visited never matches (treat all links as unvisited)
+		return false
+	case "root":
+		// Selectors Level 4 §14.1: the root of the document
+		return node.Parent == nil || node.Parent.Type == dom.DocumentNode
+	case "empty":
+		// Selectors Level 3 §6.6.5.10: no element children and no text
+		for _, child := range node.Children {
+			if child.Type == dom.ElementNode || (child.Type == dom.TextNode && child.Data != "") {
 				return false
 			}
 		}
+		return true
+	case "first-child":
+		return previousElementSibling(node) == nil
+	case "last-child":
+		return nextElementSibling(node) == nil
+	case "only-child":
+		return previousElementSibling(node) == nil && nextElementSibling(node) == nil
+	case "first-of-type":
+		return elementIndex(node, false, true, nil) == 1
+	case "last-of-type":
+		return elementIndex(node, true, true, nil) == 1
+	case "only-of-type":
+		return elementIndex(node, false, true, nil) == 1 && elementIndex(node, true, true, nil) == 1
 	}
 
+	// Dynamic pseudo-classes like :hover, :active, :focus are ignored
+	// (they're counted in specificity but don't affect matching)
 	return true
 }
 
-// calculateSpecificity calculates the specificity of a selector.
-// CSS 2.1 §6.4.3 Calculating a selector's specificity
-func calculateSpecificity(selector *css.Selector) Specificity {
-	spec := Specificity{}
-
-	for _, simple := range selector.Simple {
-		if simple.ID != "" {
-			spec.B++
+// matchesPseudoFunction checks a functional pseudo-class against a node.
+// Selectors Level 4 §4 Logical Combinations and §14.4 Child-indexed pseudo-classes
+func matchesPseudoFunction(node *dom.Node, fn *css.PseudoFunction) bool {
+	switch fn.Name {
+	case "nth-child":
+		if len(fn.Selectors) > 0 && !matchesAny(node, fn.Selectors) {
+			return false
 		}
-		// CSS 2.1 §6.4.3: Class selectors and pseudo-classes count in specificity C
-		spec.C += len(simple.Classes)
-		spec.C += len(simple.PseudoClasses)
-		// CSS 2.1 §6.4.3: Element selectors and pseudo-elements count in specificity D
-		if simple.TagName != "" {
-			spec.D++
+		return fn.Nth.Matches(elementIndex(node, false, false, fn.Selectors))
+	case "nth-last-child":
+		if len(fn.Selectors) > 0 && !matchesAny(node, fn.Selectors) {
+			return false
 		}
-		spec.D += len(simple.PseudoElements)
+		return fn.Nth.Matches(elementIndex(node, true, false, fn.Selectors))
+	case "nth-of-type":
+		return fn.Nth.Matches(elementIndex(node, false, true, nil))
+	case "nth-last-of-type":
+		return fn.Nth.Matches(elementIndex(node, true, true, nil))
+	case "is", "where":
+		return matchesAny(node, fn.Selectors)
+	case "not":
+		return !matchesAny(node, fn.Selectors)
+	case "has":
+		return matchesHas(node, fn.Selectors)
 	}
 
-	return spec
+	// Unsupported functional pseudo-classes never match
+	return false
 }
 
-// expandShorthand expands CSS shorthand properties to their longhand equivalents.
-// CSS 2.1 §8.3, §8.4: Margin and padding shorthand expansion
-// CSS 2.1 §8.5: Border shorthand expansion
-// Supports 1-4 value patterns per CSS 2.1 specification
-func expandShorthand(property, value string) map[string]string {
-	result := make(map[string]string)
-
-	// Handle border shorthand properties
-	// CSS 2.1 §8.5.4: The border shorthand property
-	if property == "border" {
-		return expandBorderShorthand(value)
+// matchesAny reports whether node matches any selector in the list.
+func matchesAny(node *dom.Node, selectors []*css.Selector) bool {
+	for _, selector := range selectors {
+		if matchesSelector(node, selector) {
+			return true
+		}
 	}
+	return false
+}
 
-	// Handle border-top, border-right, border-bottom, border-left shorthands
-	// CSS 2.1 §8.5.4: Border side shorthands
-	switch property {
-	case "border-top", "border-right", "border-bottom", "border-left":
-		return expandBorderSideShorthand(property, value)
-	}
+// matchesHas evaluates :has() by searching the elements that a relative
+// selector could reach from the anchor element.
+// Selectors Level 4 §4.5 The Relational Pseudo-class: :has()
+func matchesHas(anchor *dom.Node, selectors []*css.Selector) bool {
+	for _, selector := range selectors {
+		var candidates []*dom.Node
+		switch selector.Leading {
+		case css.AdjacentSiblingCombinator, css.GeneralSiblingCombinator:
+			// Following siblings and (for later combinators) their descendants
+			for sibling := nextElementSibling(anchor); sibling != nil; sibling = nextElementSibling(sibling) {
+				candidates = append(candidates, sibling)
+				candidates = appendDescendantElements(candidates, sibling)
+			}
+		default:
+			candidates = appendDescendantElements(candidates, anchor)
+		}
 
-	var prefix string
-	switch property {
-	case "margin":
-		prefix = "margin"
-	case "padding":
-		prefix = "padding"
-	default:
-		result[property] = value
-		return result
-	}
-
-	values := splitWhitespace(value)
-	var top, right, bottom, left string
-
-	switch len(values) {
-	case 1:
-		top = values[0]
-		right = values[0]
-		bottom = values[0]
-		left = values[0]
-	case 2:
-		top = values[0]
-		right = values[1]
-		bottom = values[0]
-		left = values[1]
-	case 3:
-		// Top | Horizontal | Bottom
-		top = values[0]
-		right = values[1]
-		bottom = values[2]
-		left = values[1]
-	case 4:
-		top = values[0]
-		right = values[1]
-		bottom = values[2]
-		left = values[3]
-	default:
-		result[property] = value
-		return result
+		last := len(selector.Simple) - 1
+		for _, candidate := range candidates {
+			if matchesComplex(candidate, selector, last, anchor) {
+				return true
+			}
+		}
 	}
+	return false
+}
 
-	// Create longhand properties
-	result[prefix+"-top"] = top
-	result[prefix+"-right"] = right
-	result[prefix+"-bottom"] = bottom
-	result[prefix+"-left"] = left
-
-	return result
+// appendDescendantElements appends all element descendants of node in
+// document order.
+func appendDescendantElements(nodes []*dom.Node, node *dom.Node) []*dom.Node {
+	for _, child := range node.Children {
+		if child.Type == dom.ElementNode {
+			nodes = append(nodes, child)
+			nodes = appendDescendantElements(nodes, child)
+		}
+	}
+	return nodes
 }
 
-// expandBorderShorthand expands the border shorthand property.
-// CSS 2.1 §8.5.4: border shorthand sets width, style, and color for all four sides.
-// Format: border: [width] [style] [color]
-func expandBorderShorthand(value string) map[string]string {
-	result := make(map[string]string)
-	width, style, color := parseBorderValue(value)
+// parentElement returns the parent of node if it is an element.
+// The document node is not an element, so it never matches a selector.
+func parentElement(node *dom.Node) *dom.Node {
+	if node.Parent != nil && node.Parent.Type == dom.ElementNode {
+		return node.Parent
+	}
+	return nil
+}
 
-	// Set all four sides
-	sides := []string{"top", "right", "bottom", "left"}
-	for _, side := range sides {
-		if width != "" {
-			result["border-"+side+"-width"] = width
-		}
-		if style != "" {
-			result["border-style"] = style // border-style applies to all sides
+// previousElementSibling returns the closest preceding element sibling.
+func previousElementSibling(node *dom.Node) *dom.Node {
+	if node.Parent == nil {
+		return nil
+	}
+	var prev *dom.Node
+	for _, sibling := range node.Parent.Children {
+		if sibling == node {
+			return prev
 		}
-		if color != "" {
-			result["border-color"] = color // border-color applies to all sides
+		if sibling.Type == dom.ElementNode {
+			prev = sibling
 		}
 	}
-
-	return result
+	return nil
 }
 
-// expandBorderSideShorthand expands a border side shorthand property (e.g., border-top).
-// CSS 2.1 §8.5.4: border-top, border-right, etc. set width, style, and color for one side.
-// Format: border-side: [width] [style] [color]
-func expandBorderSideShorthand(property, value string) map[string]string {
-	result := make(map[string]string)
-	width, style, color := parseBorderValue(value)
-
-	// Extract side from property name (e.g., "top" from "border-top")
-	side := property[7:] // Skip "border-"
-
-	if width != "" {
-		result["border-"+side+"-width"] = width
-	}
-	if style != "" {
-		result["border-style"] = style
+// nextElementSibling returns the closest following element sibling.
+func nextElementSibling(node *dom.Node) *dom.Node {
+	if node.Parent == nil {
+		return nil
 	}
-	if color != "" {
-		result["border-color"] = color
+	found := false
+	for _, sibling := range node.Parent.Children {
+		if sibling == node {
+			found = true
+			continue
+		}
+		if found && sibling.Type == dom.ElementNode {
+			return sibling
+		}
 	}
-
-	return result
+	return nil
 }
 
-// parseBorderValue parses a border shorthand value into width, style, and color.
-// CSS 2.1 §8.5.4: The order of values doesn't matter; they are identified by type.
-// Returns (width, style, color) - any may be empty if not specified.
-func parseBorderValue(value string) (width, style, color string) {
-	parts := splitWhitespace(value)
-
-	// CSS 2.1 §8.5.3: border-style valid keywords
-	styleKeywords := map[string]bool{
-		"none": true, "hidden": true, "dotted": true, "dashed": true,
-		"solid": true, "double": true, "groove": true, "ridge": true,
-		"inset": true, "outset": true,
+// elementIndex returns the 1-based position of node among its element
+// siblings, counting from the end if fromEnd is set. If sameType is set only
+// siblings with the same tag name are counted; if filter is non-empty only
+// siblings matching one of its selectors are counted (":nth-child(An+B of S)").
+// Selectors Level 4 §14.4 Child-indexed pseudo-classes
+func elementIndex(node *dom.Node, fromEnd, sameType bool, filter []*css.Selector) int {
+	if node.Parent == nil {
+		return 1
 	}
-
-	for _, part := range parts {
-		partLower := strings.ToLower(part)
-
-		// Check if it's a style keyword
-		if styleKeywords[partLower] {
-			style = partLower
+	siblings := node.Parent.Children
+	index := 0
+	for i := range siblings {
+		sibling := siblings[i]
+		if fromEnd {
+			sibling = siblings[len(siblings)-1-i]
+		}
+		if sibling.Type != dom.ElementNode {
 			continue
 		}
-
-		// Check if it's a width value (ends with px, em, or is a number, or is a width keyword)
-		if strings.HasSuffix(partLower, "px") || strings.HasSuffix(partLower, "em") ||
-			partLower == "thin" || partLower == "medium" || partLower == "thick" {
-			width = part
+		if sameType && sibling.Data != node.Data {
 			continue
 		}
-
-		// Check if it's a plain number (assume px)
-		if _, err := strconv.ParseFloat(part, 64); err == nil {
-			width = part
+		if len(filter) > 0 && sibling != node && !matchesAny(sibling, filter) {
 			continue
 		}
+		index++
+		if sibling == node {
+			return index
+		}
+	}
+	return index
+}
 
-		// Otherwise, assume it's a color
-		color = part
+// calculateSpecificity calculates the specificity of a selector.
+// CSS 2.1 §6.4.3 Calculating a selector's specificity
+// Selectors Level 4 §17: :is(), :not() and :has() take the specificity of
+// their most specific argument; :where() contributes zero.
+func calculateSpecificity(selector *css.Selector) Specificity {
+	spec := Specificity{}
+
+	for _, simple := range selector.Simple {
+		if simple.ID != "" {
+			spec.B++
+		}
+		// CSS 2.1 §6.4.3: Class selectors and pseudo-classes count in specificity C
+		spec.C += len(simple.Classes)
+		spec.C += len(simple.PseudoClasses)
+		// CSS 2.1 §6.4.3: Element selectors and pseudo-elements count in specificity D
+		// The universal selector is ignored.
+		if simple.TagName != "" && simple.TagName != "*" {
+			spec.D++
+		}
+		spec.D += len(simple.PseudoElements)
+
+		for _, fn := range simple.PseudoFunctions {
+			spec = spec.add(pseudoFunctionSpecificity(fn))
+		}
 	}
 
-	return width, style, color
+	return spec
 }
 
-// splitWhitespace splits a string on whitespace characters.
+// pseudoFunctionSpecificity returns the specificity contributed by a
+// functional pseudo-class.
+// Selectors Level 4 §17 Calculating a selector's specificity
+func pseudoFunctionSpecificity(fn *css.PseudoFunction) Specificity {
+	switch fn.Name {
+	case "where":
+		return Specificity{}
+	case "is", "not", "has":
+		return maxSpecificity(fn.Selectors)
+	case "nth-child", "nth-last-child":
+		// The pseudo-class itself plus the most specific "of S" selector
+		return Specificity{C: 1}.add(maxSpecificity(fn.Selectors))
+	default:
+		return Specificity{C: 1}
+	}
+}
+
+// maxSpecificity returns the specificity of the most specific selector in the list.
+func maxSpecificity(selectors []*css.Selector) Specificity {
+	best := Specificity{}
+	for _, selector := range selectors {
+		if spec := calculateSpecificity(selector); spec.Compare(best) > 0 {
+			best = spec
+		}
+	}
+	return best
+}
+
+// add returns the component-wise sum of two specificities.
+func (s Specificity) add(other Specificity) Specificity {
+	return Specificity{
+		A: s.A + other.A,
+		B: s.B + other.B,
+		C: s.C + other.C,
+		D: s.D + other.D,
+	}
+}
+
+// splitWhitespace splits a string on whitespace characters outside of
+// parentheses.
 func splitWhitespace(s string) []string {
 	var result []string
 	var current string
+	depth := 0
 
 	for _, ch := range s {
-		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+		// Whitespace inside functions such as calc() does not separate
+		// values
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth = max(depth-1, 0)
+		}
+		if depth == 0 && (ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r') {
 			if current != "" {
 				result = append(result, current)
 				current = ""
@@ -540,27 +1023,17 @@ func splitWhitespace(s string) []string {
 	return result
 }
 
-// applyDeclaration applies a CSS declaration to a styles map, expanding shorthand properties.
-// CSS 2.1 §8.3, §8.4: Shorthand properties are expanded to their longhand equivalents.
-func applyDeclaration(decl *css.Declaration, styles map[string]string) {
-	expandedProps := expandShorthand(decl.Property, decl.Value)
-	for prop, val := range expandedProps {
-		styles[prop] = val
-	}
-}
-
-// applyPresentationalHints converts HTML presentational attributes to CSS styles.
-// HTML5 §2.4.4: Presentational hints
-// These attributes have lower specificity than CSS rules.
-// Also applies default User-Agent styles for common HTML elements.
-func applyPresentationalHints(node *dom.Node, styles map[string]string) {
+// applyElementDefaults applies the default User-Agent styles of common HTML
+// elements and of the dir attribute, before the user-agent stylesheet.
+func applyElementDefaults(node *dom.Node, styles map[string]string) {
 	// HTML5 §10.3.1: Default styles for phrasing content elements
 	// Apply default font styling for text-related elements
 	switch node.Data {
 	case "strong", "b":
-		// HTML5 §10.3.1: strong and b elements are bold by default
+		// HTML5 §10.3.1: strong and b elements are bolder than their
+		// parent by default
 		if styles["font-weight"] == "" {
-			styles["font-weight"] = "bold"
+			styles["font-weight"] = "bolder"
 		}
 	case "em", "i":
 		// HTML5 §10.3.1: em and i elements are italic by default
@@ -569,70 +1042,161 @@ func applyPresentationalHints(node *dom.Node, styles map[string]string) {
 		}
 	case "u":
 		// HTML5 §10.3.1: u element is underlined by default
-		if styles["text-decoration"] == "" {
-			styles["text-decoration"] = "underline"
+		if styles["text-decoration-line"] == "" {
+			styles["text-decoration-line"] = "underline"
 		}
 	}
 
-	// <font color="..."> attribute
-	if node.Data == "font" {
-		if color := node.GetAttribute("color"); color != "" {
-			styles["color"] = color
+	applyDirAttribute(node, styles)
+}
+
+// applyDirAttribute maps the dir attribute to 'direction' and
+// 'unicode-bidi', as the [dir] rules of the HTML user agent stylesheet do,
+// since attribute selectors are not supported. dir=auto and <bdi> elements
+// without dir take the direction of their first strong character.
+// HTML §3.2.6.4 The dir attribute
+// HTML §15.3.5 Bidirectional text
+func applyDirAttribute(node *dom.Node, styles map[string]string) {
+	dir := strings.ToLower(strings.TrimSpace(node.GetAttribute("dir")))
+	switch dir {
+	case "ltr", "rtl", "auto":
+		styles["unicode-bidi"] = "isolate"
+	default:
+		if node.Data != "bdi" {
+			return
 		}
+		dir = "auto"
 	}
-	
-	// bgcolor attribute (used on <table>, <tr>, <td>, <th>, <body>)
-	if bgcolor := node.GetAttribute("bgcolor"); bgcolor != "" {
-		styles["background-color"] = bgcolor
+	if dir == "auto" {
+		dir = "ltr"
+		if level, ok := autoDirection(node); ok && level.RTL() {
+			dir = "rtl"
+		}
 	}
-	
-	// width attribute (used on many elements including <table>, <td>, <img>)
-	// HTML5 §14.3.9: Maps to CSS width property
-	if width := node.GetAttribute("width"); width != "" {
-		// Check if it's a percentage or pixel value
-		if strings.Contains(width, "%") {
-			styles["width"] = width
-		} else {
-			// Plain number means pixels
-			styles["width"] = width + "px"
+	styles["direction"] = dir
+}
+
+// autoDirection finds the first strong character of the text of node's
+// descendants, skipping those whose direction is set separately.
+// HTML §3.2.6.4 The dir attribute: auto directionality
+func autoDirection(node *dom.Node) (bidi.Level, bool) {
+	for _, child := range node.Children {
+		switch child.Type {
+		case dom.TextNode:
+			if level, ok := bidi.StrongLevel(child.Data); ok {
+				return level, true
+			}
+		case dom.ElementNode:
+			switch child.Data {
+			case "bdi", "script", "style", "textarea":
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(child.GetAttribute("dir"))) {
+			case "ltr", "rtl", "auto":
+				continue
+			}
+			if level, ok := autoDirection(child); ok {
+				return level, true
+			}
 		}
 	}
-	
-	// height attribute (used on many elements including <table>, <td>, <img>)
-	// HTML5 §14.3.9: Maps to CSS height property
-	if height := node.GetAttribute("height"); height != "" {
-		// Check if it's a percentage or pixel value
-		if strings.Contains(height, "%") {
-			styles["height"] = height
-		} else {
-			// Plain number means pixels
-			styles["height"] = height + "px"
+	return 0, false
+}
+
+// applyListCounters maps the start and reversed attributes of ol elements
+// and the value attribute of li elements onto the list-item counter.
+// HTML5 §4.4.5 The ol element, §4.4.8 The li element, §15.3.8 Lists
+func applyListCounters(node *dom.Node, styles map[string]string) {
+	switch node.Data {
+	case "ol":
+		// HTML5 §4.4.5: The first item is numbered start, counting up, or
+		// counting down for reversed lists
+		_, reversed := node.Attributes["reversed"]
+		start, err := strconv.Atoi(strings.TrimSpace(node.GetAttribute("start")))
+		hasStart := err == nil
+		switch {
+		case reversed && hasStart:
+			styles["counter-reset"] = replaceCounter(styles["counter-reset"], "reversed(list-item) "+strconv.Itoa(start+1))
+		case reversed:
+			styles["counter-reset"] = replaceCounter(styles["counter-reset"], "reversed(list-item)")
+		case hasStart:
+			styles["counter-reset"] = replaceCounter(styles["counter-reset"], "list-item "+strconv.Itoa(start-1))
+		}
+	case "li":
+		// HTML5 §4.4.8: The value attribute sets the item's ordinal value
+		if value, err := strconv.Atoi(strings.TrimSpace(node.GetAttribute("value"))); err == nil {
+			styles["counter-set"] = replaceCounter(styles["counter-set"], "list-item "+strconv.Itoa(value))
 		}
 	}
-	
-	// Note: cellspacing and cellpadding are handled after CSS rules are applied
-	// to ensure they override user-agent stylesheet defaults
-	// align and valign are also handled in the layout phase
+}
+
+// replaceCounter replaces the list-item entry of a counter-reset or
+// counter-set value with entry, keeping entries for other counters.
+func replaceCounter(value, entry string) string {
+	parts := []string{entry}
+	for _, change := range css.ParseCounterChanges(value, 0) {
+		if change.Name == "list-item" {
+			continue
+		}
+		part := change.Name + " " + strconv.Itoa(change.Value)
+		if change.Reversed {
+			part = "reversed(" + change.Name + ")"
+			if !change.Auto {
+				part += " " + strconv.Itoa(change.Value)
+			}
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
 }
 
 // ResolveCSSURLs resolves relative URLs in CSS properties against a base URL.
 // This handles background-image and other CSS properties that contain URLs.
 // Per HTML5 §2.5.1, URLs should be resolved against the document's base URL.
 func ResolveCSSURLs(root *StyledNode, baseURL string) {
+	resolveCSSURLs(root, baseURL, make(map[*ComputedStyle]bool))
+}
+
+// resolveCSSURLs resolves the URLs of root and its descendants. Nodes that
+// share their styles share their ComputedStyle, and resolved records the
+// ones whose styles are already resolved, so that relative base URLs are
+// not applied twice.
+func resolveCSSURLs(root *StyledNode, baseURL string, resolved map[*ComputedStyle]bool) {
 	if root == nil {
 		return
 	}
 	
 	// Resolve URLs in background and background-image properties
-	for _, prop := range []string{"background", "background-image"} {
-		if value, ok := root.Styles[prop]; ok && strings.Contains(value, "url(") {
-			root.Styles[prop] = resolveURLsInValue(value, baseURL)
+	if root.computed == nil || !resolved[root.computed] {
+		resolved[root.computed] = root.computed != nil
+		changed := false
+		for _, prop := range []string{"background", "background-image"} {
+			if value, ok := root.Styles[prop]; ok && strings.Contains(value, "url(") {
+				root.Styles[prop] = resolveURLsInValue(value, baseURL)
+				changed = true
+			}
+		}
+		// The computed style was computed before URLs were resolved.
+		// It is updated in place, as the nodes sharing it share the
+		// Styles just resolved.
+		if changed && root.computed != nil {
+			*root.computed = *ComputeStyle(root.Styles)
+		}
+	}
+
+	// CSS 2.1 §12.2: url() in 'content' generates an img child of the
+	// pseudo-element, which dom.ResolveURLs never saw
+	if root.PseudoElement != "" {
+		for _, child := range root.Children {
+			if src := child.Node.GetAttribute("src"); src != "" {
+				child.Node.SetAttribute("src", dom.ResolveURLString(baseURL, src))
+			}
 		}
 	}
 	
 	// Recursively process children
 	for _, child := range root.Children {
-		ResolveCSSURLs(child, baseURL)
+		resolveCSSURLs(child, baseURL, resolved)
 	}
 }
 
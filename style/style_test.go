@@ -5,6 +5,7 @@ import (
 
 	"github.com/lukehoban/browser/css"
 	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/html"
 )
 
 func TestMatchesSimpleSelector(t *testing.T) {
@@ -297,8 +298,8 @@ func TestStyleTree(t *testing.T) {
 	if divStyled.Styles["color"] != "red" {
 		t.Errorf("Expected color 'red', got %v", divStyled.Styles["color"])
 	}
-	if divStyled.Styles["background"] != "blue" {
-		t.Errorf("Expected background 'blue', got %v", divStyled.Styles["background"])
+	if divStyled.Styles["background-color"] != "blue" {
+		t.Errorf("Expected background-color 'blue', got %v", divStyled.Styles["background-color"])
 	}
 	// Check that margin shorthand was expanded to longhand properties
 	if divStyled.Styles["margin-top"] != "10px" {
@@ -451,8 +452,14 @@ func TestExpandShorthand(t *testing.T) {
 				"border-right-width":  "2px",
 				"border-bottom-width": "2px",
 				"border-left-width":   "2px",
-				"border-style":        "solid",
-				"border-color":        "#2196F3",
+				"border-top-style":    "solid",
+				"border-right-style":  "solid",
+				"border-bottom-style": "solid",
+				"border-left-style":   "solid",
+				"border-top-color":    "#2196F3",
+				"border-right-color":  "#2196F3",
+				"border-bottom-color": "#2196F3",
+				"border-left-color":   "#2196F3",
 			},
 		},
 		{
@@ -461,8 +468,8 @@ func TestExpandShorthand(t *testing.T) {
 			value:    "3px solid #4CAF50",
 			expected: map[string]string{
 				"border-bottom-width": "3px",
-				"border-style":        "solid",
-				"border-color":        "#4CAF50",
+				"border-bottom-style": "solid",
+				"border-bottom-color": "#4CAF50",
 			},
 		},
 		{
@@ -474,8 +481,44 @@ func TestExpandShorthand(t *testing.T) {
 				"border-right-width":  "1px",
 				"border-bottom-width": "1px",
 				"border-left-width":   "1px",
-				"border-style":        "dashed",
-				"border-color":        "red",
+				"border-top-style":    "dashed",
+				"border-right-style":  "dashed",
+				"border-bottom-style": "dashed",
+				"border-left-style":   "dashed",
+				"border-top-color":    "red",
+				"border-right-color":  "red",
+				"border-bottom-color": "red",
+				"border-left-color":   "red",
+			},
+		},
+		{
+			name:     "list-style with type and position",
+			property: "list-style",
+			value:    "square inside",
+			expected: map[string]string{
+				"list-style-type":     "square",
+				"list-style-position": "inside",
+				"list-style-image":    "none",
+			},
+		},
+		{
+			name:     "list-style none",
+			property: "list-style",
+			value:    "none",
+			expected: map[string]string{
+				"list-style-type":     "none",
+				"list-style-position": "outside",
+				"list-style-image":    "none",
+			},
+		},
+		{
+			name:     "list-style image with none type",
+			property: "list-style",
+			value:    `url("dot.png") none`,
+			expected: map[string]string{
+				"list-style-type":     "none",
+				"list-style-position": "outside",
+				"list-style-image":    `url("dot.png")`,
 			},
 		},
 	}
@@ -533,6 +576,11 @@ func TestSplitWhitespace(t *testing.T) {
 			input:    "",
 			expected: []string{},
 		},
+		{
+			name:     "functions",
+			input:    "calc(1em + 2px) 0 rgb(0, 0, 0)",
+			expected: []string{"calc(1em + 2px)", "0", "rgb(0, 0, 0)"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -673,177 +721,429 @@ func TestCSSInheritance_Skipped(t *testing.T) {
 	}
 }
 
-func TestImportantDeclarations_Skipped(t *testing.T) {
-	t.Skip("!important declarations not implemented - CSS 2.1 §6.4.2")
-	// CSS 2.1 §6.4.2 !important rules
-	// !important declarations should override normal declarations regardless of specificity
-	
-	doc := dom.NewDocument()
-	div := dom.NewElement("div")
-	div.SetAttribute("id", "main")
-	doc.AppendChild(div)
-	
-	// When implemented, Declaration would have an Important field
-	stylesheet := &css.Stylesheet{
-		Rules: []*css.Rule{
-			{
-				Selectors: []*css.Selector{
-					{Simple: []*css.SimpleSelector{{TagName: "div"}}},
-				},
-				Declarations: []*css.Declaration{
-					{Property: "color", Value: "red"}, // Would have Important: true
-				},
-			},
-			{
-				Selectors: []*css.Selector{
-					{Simple: []*css.SimpleSelector{{ID: "main"}}},
-				},
-				Declarations: []*css.Declaration{
-					{Property: "color", Value: "blue"},
-				},
-			},
-		},
+// TestImportantDeclarations tests the cascade order of the user-agent,
+// user and author origins, of the style attribute and of !important
+// declarations.
+// CSS 2.1 §6.4.1 Cascading order, §6.4.2 !important rules
+// CSS Cascading Level 4 §6.1 Cascade Sorting Order
+func TestImportantDeclarations(t *testing.T) {
+	userAgent := css.Parse(`
+		p { color: gray; margin-top: 1px; margin-left: 1px !important; }
+	`)
+	user := css.Parse(`
+		p { color: yellow; font-size: 20px; border-top-width: 3px; }
+		.user { color: olive !important; }
+		.revert { font-size: revert; }
+		.background { background-color: black; }
+	`)
+	author := css.Parse(`
+		#main { color: blue; border-top-width: 5px; }
+		p { color: red !important; margin-top: 2px; margin-left: 2px; }
+		.revert { color: revert !important; }
+		.inline { color: green !important; }
+	`)
+
+	tests := []struct {
+		name     string
+		html     string
+		property string
+		expected string
+	}{
+		{"author important beats higher specificity", `<p id="main">x</p>`, "color", "red"},
+		{"author normal beats user normal", `<p id="main">x</p>`, "border-top-width", "5px"},
+		{"user normal beats user agent normal", `<p>x</p>`, "font-size", "20px"},
+		{"author normal beats user agent normal", `<p>x</p>`, "margin-top", "2px"},
+		{"user agent important beats author", `<p>x</p>`, "margin-left", "1px"},
+		{"user important beats author important", `<p class="user">x</p>`, "color", "olive"},
+		{"important style attribute beats important rules", `<p style="color: purple !important">x</p>`, "color", "purple"},
+		{"important rules beat normal style attribute", `<p style="color: purple">x</p>`, "color", "red"},
+		{"author revert rolls back to the user", `<p class="revert">x</p>`, "color", "yellow"},
+		{"user revert rolls back to the user agent", `<p class="revert">x</p>`, "font-size", ""},
+		{"presentational hint beats user normal", `<table><tr><td class="background" bgcolor="white">x</td></tr></table>`, "background-color", "white"},
 	}
-	
-	styledTree := StyleTree(doc, stylesheet)
-	divStyled := styledTree.Children[0]
-	
-	// The !important declaration should win even though ID selector has higher specificity
-	// Currently, ID selector wins due to higher specificity
-	if divStyled.Styles["color"] != "blue" {
-		t.Errorf("Expected color 'blue' (ID has higher specificity), got %v", divStyled.Styles["color"])
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := html.Parse(tt.html)
+			styled := StyleTreeWithOptions(doc, author, Options{
+				Media:               DefaultOptions().Media,
+				UserAgentStylesheet: userAgent,
+				UserStylesheet:      user,
+			})
+			node := findStyledNode(styled, "p")
+			if node == nil {
+				node = findStyledNode(styled, "td")
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
 	}
 }
 
-func TestComputedValues_Skipped(t *testing.T) {
-	t.Skip("Computed value calculation not implemented - CSS 2.1 §6.1.2")
-	// CSS 2.1 §6.1.2 Computed values
-	// Relative values (em, %, etc.) should be converted to absolute values
-	
-	doc := dom.NewDocument()
-	div := dom.NewElement("div")
-	p := dom.NewElement("p")
-	div.AppendChild(p)
-	doc.AppendChild(div)
-	
-	stylesheet := &css.Stylesheet{
-		Rules: []*css.Rule{
-			{
-				Selectors: []*css.Selector{
-					{Simple: []*css.SimpleSelector{{TagName: "div"}}},
-				},
-				Declarations: []*css.Declaration{
-					{Property: "font-size", Value: "16px"},
-					{Property: "width", Value: "100%"},
-				},
-			},
-			{
-				Selectors: []*css.Selector{
-					{Simple: []*css.SimpleSelector{{TagName: "p"}}},
-				},
-				Declarations: []*css.Declaration{
-					{Property: "font-size", Value: "1.5em"}, // Should be 24px (16px * 1.5)
-					{Property: "width", Value: "50%"},        // Should be 50% of parent
-				},
-			},
-		},
+// TestUserAgentStylesheet tests that the default user-agent stylesheet is
+// parsed once and can be replaced.
+func TestUserAgentStylesheet(t *testing.T) {
+	if DefaultUserAgentStylesheet() != DefaultUserAgentStylesheet() {
+		t.Error("Expected the default user-agent stylesheet to be parsed once")
 	}
-	
-	styledTree := StyleTree(doc, stylesheet)
-	divStyled := styledTree.Children[0]
-	pStyled := divStyled.Children[0]
-	
-	// When implemented, would have ComputedStyles field
-	// P's font-size should be computed to 24px (1.5em of parent's 16px)
-	// For now, values are used as-is
-	if pStyled.Styles["font-size"] != "1.5em" {
-		t.Errorf("Expected font-size '1.5em' (not yet computed), got %v", pStyled.Styles["font-size"])
+
+	doc := html.Parse(`<div><p>x</p></div>`)
+	styled := StyleTree(doc, nil)
+	if findStyledNode(styled, "div").Styles["display"] != "block" {
+		t.Fatal("Expected the default user-agent stylesheet to make <div> a block")
+	}
+
+	opts := DefaultOptions()
+	opts.UserAgentStylesheet = css.Parse(`p { display: block; margin-top: 7px; }`)
+	styled = StyleTreeWithOptions(doc, nil, opts)
+	if display := findStyledNode(styled, "div").Styles["display"]; display != "" {
+		t.Errorf("Expected a replaced user-agent stylesheet not to style <div>, got display %q", display)
+	}
+	if margin := findStyledNode(styled, "p").Styles["margin-top"]; margin != "7px" {
+		t.Errorf("Expected margin-top 7px from the replacing stylesheet, got %q", margin)
 	}
 }
 
-func TestPseudoClassMatching_Skipped(t *testing.T) {
-	t.Skip("Pseudo-class matching not implemented - CSS 2.1 §5.11")
-	// CSS 2.1 §5.11 Pseudo-classes
-	// Pseudo-classes should be matched based on element state/position
-	
-	doc := dom.NewDocument()
-	div := dom.NewElement("div")
-	p1 := dom.NewElement("p")
-	p2 := dom.NewElement("p")
-	div.AppendChild(p1)
-	div.AppendChild(p2)
-	doc.AppendChild(div)
-	
-	// Note: Parser would need to support pseudo-classes first
-	// This test assumes SimpleSelector would have a PseudoClass field
-	stylesheet := &css.Stylesheet{
-		Rules: []*css.Rule{
-			{
-				Selectors: []*css.Selector{
-					{Simple: []*css.SimpleSelector{{TagName: "p"}}}, // Would have PseudoClass: "first-child"
-				},
-				Declarations: []*css.Declaration{
-					{Property: "margin-top", Value: "0"},
-				},
-			},
-		},
+// TestComputedValues tests that relative lengths compute to pixels.
+// CSS 2.1 §6.1.2 Computed values
+// CSS Values and Units Level 4 §6.1 Relative Lengths
+func TestComputedValues(t *testing.T) {
+	stylesheet := css.Parse(`
+		html { font-size: 20px; }
+		div { font-size: 16px; width: 100%; }
+		p { font-size: 1.5em; width: 50%; margin: 1em 2rem; padding: 10vw 5vh 2vmin 1vmax; }
+		span { font-size: 50%; line-height: 150%; letter-spacing: 0.5ex; }
+		b { font-size: larger; border-left-width: 1ch; line-height: 1.5; }
+		i { font-size: 2rem; text-indent: 1in; }
+		u { font-size: max(1em, 12px); width: calc(100% - 2em); margin: clamp(1rem, 10vw, 200px) calc(1em / 2); }
+	`)
+
+	doc := html.Parse(`<html><body><div><p><span>a</span><b>b</b><i>c</i><u>d</u></p></div></body></html>`)
+	opts := DefaultOptions()
+	opts.Media.Width = 1000
+	opts.Media.Height = 500
+	styled := StyleTreeWithOptions(doc, stylesheet, opts)
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"div", "font-size", "16px"},
+		{"div", "width", "100%"},
+		{"p", "font-size", "24px"},
+		{"p", "width", "50%"},
+		{"p", "margin-top", "24px"},
+		{"p", "margin-right", "40px"},
+		{"p", "padding-top", "100px"},
+		{"p", "padding-right", "25px"},
+		{"p", "padding-bottom", "10px"},
+		{"p", "padding-left", "10px"},
+		{"span", "font-size", "12px"},
+		{"span", "line-height", "18px"},
+		{"span", "letter-spacing", "3px"},
+		{"b", "font-size", "28.8px"},
+		{"b", "border-left-width", "14.4px"},
+		{"b", "line-height", "1.5"},
+		{"i", "font-size", "40px"},
+		{"i", "text-indent", "1in"},
+		{"u", "font-size", "24px"},
+		{"u", "width", "calc(100% - 48px)"},
+		{"u", "margin-top", "100px"},
+		{"u", "margin-left", "12px"},
 	}
-	
-	styledTree := StyleTree(doc, stylesheet)
-	divStyled := styledTree.Children[0]
-	p1Styled := divStyled.Children[0]
-	p2Styled := divStyled.Children[1]
-	
-	// When implemented, first p should match :first-child and have margin-top: 0
-	// For now, both match the plain 'p' selector
-	if p1Styled.Styles["margin-top"] != "0" {
-		t.Errorf("Expected first p to have margin-top '0', got %v", p1Styled.Styles["margin-top"])
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
 	}
-	
-	// Second p should also match (no pseudo-class filtering yet)
-	if p2Styled.Styles["margin-top"] != "0" {
-		t.Error("Without pseudo-class support, second p also matches 'p' selector")
+}
+
+// findStyledNode returns the first styled element named tag, in document
+// order.
+func findStyledNode(styled *StyledNode, tag string) *StyledNode {
+	if styled.Node.Type == dom.ElementNode && styled.Node.Data == tag {
+		return styled
+	}
+	for _, child := range styled.Children {
+		if found := findStyledNode(child, tag); found != nil {
+			return found
+		}
 	}
+	return nil
 }
 
-func TestChildCombinatorMatching_Skipped(t *testing.T) {
-	t.Skip("Child combinator matching not implemented - CSS 2.1 §5.5")
-	// CSS 2.1 §5.5 Child selectors
-	// Child combinator (>) should only match direct children
-	
-	// Create DOM: div > p > span
-	div := dom.NewElement("div")
-	p := dom.NewElement("p")
+// TestComputedValuesInheritance tests that descendants inherit computed
+// font sizes rather than relative ones.
+// CSS 2.1 §6.2 Inheritance
+func TestComputedValuesInheritance(t *testing.T) {
+	stylesheet := css.Parse(`div { font-size: 2em; } p { margin-top: 1em; }`)
+	doc := html.Parse(`<div><div><p>text</p></div></div>`)
+	p := findStyledNode(StyleTree(doc, stylesheet), "p")
+	if p.Styles["font-size"] != "52px" {
+		t.Errorf("Expected inherited font-size 52px, got %q", p.Styles["font-size"])
+	}
+	if p.Styles["margin-top"] != "52px" {
+		t.Errorf("Expected margin-top 52px, got %q", p.Styles["margin-top"])
+	}
+}
+
+// TestStructuralPseudoClassMatching tests tree-structural pseudo-classes.
+// Selectors Level 4 §14 Tree-Structural pseudo-classes
+func TestStructuralPseudoClassMatching(t *testing.T) {
+	// <ul><li/><li/><li/><li/><li/></ul>, with a text node between items
+	ul := dom.NewElement("ul")
+	items := make([]*dom.Node, 5)
+	for i := range items {
+		items[i] = dom.NewElement("li")
+		ul.AppendChild(dom.NewText(" "))
+		ul.AppendChild(items[i])
+	}
+	empty := dom.NewElement("p")
+
+	tests := []struct {
+		selector string
+		node     *dom.Node
+		expected bool
+	}{
+		{"li:first-child", items[0], true},
+		{"li:first-child", items[1], false},
+		{"li:last-child", items[4], true},
+		{"li:last-child", items[3], false},
+		{"li:only-child", items[0], false},
+		{"li:nth-child(odd)", items[2], true},
+		{"li:nth-child(odd)", items[3], false},
+		{"li:nth-child(2n)", items[1], true},
+		{"li:nth-child(-n+2)", items[1], true},
+		{"li:nth-child(-n+2)", items[2], false},
+		{"li:nth-last-child(1)", items[4], true},
+		{"li:nth-last-child(2)", items[3], true},
+		{"li:first-of-type", items[0], true},
+		{"li:nth-of-type(3)", items[2], true},
+		{"li:last-of-type", items[4], true},
+		{"li:only-of-type", items[0], false},
+		{"ul:root", ul, true},
+		{"li:root", items[0], false},
+		{"ul:empty", ul, false},
+		{"p:empty", empty, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selectors := css.ParseSelectors(tt.selector)
+			if len(selectors) != 1 {
+				t.Fatalf("Failed to parse %q", tt.selector)
+			}
+			if got := matchesSelector(tt.node, selectors[0]); got != tt.expected {
+				t.Errorf("matchesSelector(%q) = %v, want %v", tt.selector, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestNthChildOfSelector tests :nth-child(An+B of S), which only counts
+// siblings matching S.
+// Selectors Level 4 §14.4.1
+func TestNthChildOfSelector(t *testing.T) {
+	table := dom.NewElement("table")
+	rows := make([]*dom.Node, 4)
+	for i := range rows {
+		rows[i] = dom.NewElement("tr")
+		table.AppendChild(rows[i])
+	}
+	rows[1].SetAttribute("class", "hidden")
+	for _, i := range []int{0, 2, 3} {
+		rows[i].SetAttribute("class", "visible")
+	}
+
+	selector := css.ParseSelectors("tr:nth-child(even of .visible)")[0]
+	expected := []bool{false, false, true, false}
+	for i, row := range rows {
+		if got := matchesSelector(row, selector); got != expected[i] {
+			t.Errorf("Row %d: expected %v, got %v", i, expected[i], got)
+		}
+	}
+}
+
+// TestLogicalPseudoClassMatching tests :not(), :is(), :where() and :has().
+// Selectors Level 4 §4 Logical Combinations
+func TestLogicalPseudoClassMatching(t *testing.T) {
+	// <nav><ul><li class="active"><a href="#">x</a></li><li><span/></li></ul></nav>
+	nav := dom.NewElement("nav")
+	ul := dom.NewElement("ul")
+	active := dom.NewElement("li")
+	active.SetAttribute("class", "active")
+	link := dom.NewElement("a")
+	link.SetAttribute("href", "#")
+	plain := dom.NewElement("li")
 	span := dom.NewElement("span")
-	div.AppendChild(p)
-	p.AppendChild(span)
-	
-	// When implemented, Selector would have a Combinator field
-	// Selector: div > span (should NOT match - span is grandchild)
-	selector := &css.Selector{
-		Simple: []*css.SimpleSelector{
-			{TagName: "div"},
-			{TagName: "span"},
-		},
-		// Would have: Combinator: ">"
+	active.AppendChild(link)
+	plain.AppendChild(span)
+	ul.AppendChild(active)
+	ul.AppendChild(plain)
+	nav.AppendChild(ul)
+
+	tests := []struct {
+		selector string
+		node     *dom.Node
+		expected bool
+	}{
+		{"li:not(.active)", plain, true},
+		{"li:not(.active)", active, false},
+		{"li:not(.a, .active)", active, false},
+		{":is(ul, ol) > li", plain, true},
+		{":where(nav) li", active, true},
+		{"li:is(.missing)", plain, false},
+		{"li:has(a)", active, true},
+		{"li:has(a)", plain, false},
+		{"li:has(> span)", plain, true},
+		{"ul:has(> span)", ul, false},
+		{"li:has(+ li)", active, true},
+		{"li:has(+ li)", plain, false},
+		{"nav:has(li.active a)", nav, true},
+		{"li:has(~ li > span)", active, true},
+		{"li:not(:has(a))", plain, true},
 	}
-	
-	// Currently treats all multi-part selectors as descendant
-	if !matchesSelector(span, selector) {
-		t.Error("Currently matches as descendant (space), should NOT match with child combinator (>)")
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selectors := css.ParseSelectors(tt.selector)
+			if len(selectors) != 1 {
+				t.Fatalf("Failed to parse %q", tt.selector)
+			}
+			if got := matchesSelector(tt.node, selectors[0]); got != tt.expected {
+				t.Errorf("matchesSelector(%q) = %v, want %v", tt.selector, got, tt.expected)
+			}
+		})
 	}
-	
-	// Selector: div > p (should match - p is direct child)
-	selector2 := &css.Selector{
-		Simple: []*css.SimpleSelector{
-			{TagName: "div"},
-			{TagName: "p"},
-		},
-		// Would have: Combinator: ">"
+}
+
+// TestPseudoClassSpecificity tests specificity of functional pseudo-classes.
+// Selectors Level 4 §17 Calculating a selector's specificity
+func TestPseudoClassSpecificity(t *testing.T) {
+	tests := []struct {
+		selector string
+		expected Specificity
+	}{
+		{"li:first-child", Specificity{C: 1, D: 1}},
+		{"li:nth-child(2n+1)", Specificity{C: 1, D: 1}},
+		{"li:nth-child(2n+1 of .x)", Specificity{C: 2, D: 1}},
+		{":where(#a, .b) p", Specificity{D: 1}},
+		{":is(#a, .b) p", Specificity{B: 1, D: 1}},
+		{"p:not(.a, .b.c)", Specificity{C: 2, D: 1}},
+		{"div:has(> img)", Specificity{D: 2}},
+		{"*", Specificity{}},
+		{"*::before", Specificity{D: 1}},
 	}
-	
-	if !matchesSelector(p, selector2) {
-		t.Error("Expected p to match 'div > p' (direct child)")
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selectors := css.ParseSelectors(tt.selector)
+			if len(selectors) != 1 {
+				t.Fatalf("Failed to parse %q", tt.selector)
+			}
+			if got := calculateSpecificity(selectors[0]); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSelectorListSpecificity tests that a rule whose selector list
+// matches with several selectors takes the specificity of the most
+// specific of them, whichever comes first.
+// Selectors Level 3 §9 Calculating a selector's specificity
+func TestSelectorListSpecificity(t *testing.T) {
+	stylesheet := css.Parse(`
+		.a, #b { color: red; }
+		p.a { color: blue; }
+		span, #c.d { color: green; }
+		span.d { color: gray; }
+	`)
+	doc := html.Parse(`<html><body><p id="b" class="a">text</p><span id="c" class="d">text</span></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	if got := findStyledNode(styled, "p").Styles["color"]; got != "red" {
+		t.Errorf("Expected #b to outweigh p.a, got color %q", got)
+	}
+	if got := findStyledNode(styled, "span").Styles["color"]; got != "green" {
+		t.Errorf("Expected #c.d to outweigh span.d, got color %q", got)
+	}
+
+	// Explanations name the selector the rule matched with
+	e := ExplainStyle(doc, stylesheet, DefaultOptions(), findNode(doc, "p"))
+	if rule := e.Property("color").Rule; rule == nil || rule.Selector.Text != "#b" || rule.Specificity != (Specificity{B: 1}) {
+		t.Errorf("Expected color to come from #b, got %+v", rule)
+	}
+}
+
+// TestZebraStripedTable tests nth-child styling through the full cascade.
+func TestZebraStripedTable(t *testing.T) {
+	doc := dom.NewDocument()
+	table := dom.NewElement("table")
+	for i := 0; i < 4; i++ {
+		table.AppendChild(dom.NewElement("tr"))
+	}
+	doc.AppendChild(table)
+
+	stylesheet := css.Parse("tr { background-color: white; } tr:nth-child(even) { background-color: gray; }")
+	styled := StyleTree(doc, stylesheet)
+
+	expected := []string{"white", "gray", "white", "gray"}
+	for i, row := range styled.Children[0].Children {
+		if got := row.Styles["background-color"]; got != expected[i] {
+			t.Errorf("Row %d: expected background-color %q, got %q", i, expected[i], got)
+		}
+	}
+}
+
+// TestCombinatorMatching tests child and sibling combinators.
+// CSS 2.1 §5.6, §5.7, Selectors Level 3 §8.3.2
+func TestCombinatorMatching(t *testing.T) {
+	// Create DOM: div > (h1, p > span, p)
+	div := dom.NewElement("div")
+	h1 := dom.NewElement("h1")
+	p1 := dom.NewElement("p")
+	span := dom.NewElement("span")
+	p2 := dom.NewElement("p")
+	div.AppendChild(h1)
+	div.AppendChild(p1)
+	div.AppendChild(p2)
+	p1.AppendChild(span)
+
+	tests := []struct {
+		selector string
+		node     *dom.Node
+		expected bool
+	}{
+		{"div > span", span, false},
+		{"div span", span, true},
+		{"div > p", p1, true},
+		{"div > p > span", span, true},
+		{"h1 + p", p1, true},
+		{"h1 + p", p2, false},
+		{"h1 ~ p", p2, true},
+		{"p ~ h1", h1, false},
+		{"div > h1 + p span", span, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			selectors := css.ParseSelectors(tt.selector)
+			if len(selectors) != 1 {
+				t.Fatalf("Failed to parse %q", tt.selector)
+			}
+			if got := matchesSelector(tt.node, selectors[0]); got != tt.expected {
+				t.Errorf("matchesSelector(%q) = %v, want %v", tt.selector, got, tt.expected)
+			}
+		})
 	}
 }
 
@@ -917,6 +1217,77 @@ t.Errorf("Got %d styles, expected %d", len(styles), len(tt.expected))
 }
 }
 
+// TestDirAttribute tests the direction and unicode-bidi of elements with a
+// dir attribute, <bdi> and <bdo>.
+// HTML §3.2.6.4 The dir attribute, §15.3.5 Bidirectional text
+func TestDirAttribute(t *testing.T) {
+	element := func(tag, dir, text string) *dom.Node {
+		n := dom.NewElement(tag)
+		if dir != "" {
+			n.SetAttribute("dir", dir)
+		}
+		n.AppendChild(dom.NewText(text))
+		return n
+	}
+	tests := []struct {
+		name        string
+		node        *dom.Node
+		css         string
+		direction   string
+		unicodeBidi string
+	}{
+		{"no dir", element("p", "", "שלום"), "", "", ""},
+		{"dir rtl", element("p", "rtl", "abc"), "", "rtl", "isolate"},
+		{"dir ltr", element("span", "LTR", "שלום"), "", "ltr", "isolate"},
+		{"dir auto", element("p", "auto", "123 שלום abc"), "", "rtl", "isolate"},
+		{"dir auto without strong text", element("p", "auto", "123"), "", "ltr", "isolate"},
+		{"invalid dir", element("p", "up", "abc"), "", "", ""},
+		{"bdi", element("bdi", "", "إيان"), "", "rtl", "isolate"},
+		{"bdi with dir", element("bdi", "ltr", "إيان"), "", "ltr", "isolate"},
+		{"bdo", element("bdo", "rtl", "abc"), "", "rtl", "isolate-override"},
+		{"author styles override dir", element("p", "rtl", "abc"), "p { direction: ltr; unicode-bidi: normal; }", "ltr", "normal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument()
+			doc.AppendChild(tt.node)
+			styled := StyleTree(doc, css.Parse(tt.css)).Children[0]
+			if got := styled.Styles["direction"]; got != tt.direction {
+				t.Errorf("Expected direction %q, got %q", tt.direction, got)
+			}
+			if got := styled.Styles["unicode-bidi"]; got != tt.unicodeBidi {
+				t.Errorf("Expected unicode-bidi %q, got %q", tt.unicodeBidi, got)
+			}
+		})
+	}
+}
+
+// TestDirAuto tests that dir=auto skips text whose direction is set
+// separately, and that direction is inherited.
+func TestDirAuto(t *testing.T) {
+	doc := dom.NewDocument()
+	div := dom.NewElement("div")
+	div.SetAttribute("dir", "auto")
+	bdi := dom.NewElement("bdi")
+	bdi.AppendChild(dom.NewText("abc"))
+	span := dom.NewElement("span")
+	span.AppendChild(dom.NewText("שלום"))
+	div.AppendChild(bdi)
+	div.AppendChild(span)
+	doc.AppendChild(div)
+
+	styled := StyleTree(doc, css.Parse("")).Children[0]
+	if got := styled.Styles["direction"]; got != "rtl" {
+		t.Errorf("Expected direction rtl from the text after <bdi>, got %q", got)
+	}
+	if got := styled.Children[1].Styles["direction"]; got != "rtl" {
+		t.Errorf("Expected the span to inherit direction rtl, got %q", got)
+	}
+	if got := styled.Children[1].Styles["unicode-bidi"]; got != "" {
+		t.Errorf("Expected unicode-bidi not to be inherited, got %q", got)
+	}
+}
+
 // TestInlineStyles tests that inline style attributes are applied correctly.
 // CSS 2.1 §6.4.3: Inline styles have the highest specificity.
 func TestInlineStyles(t *testing.T) {
@@ -1123,3 +1494,82 @@ func TestInlineStyleSpecificity(t *testing.T) {
 		t.Errorf("Expected inline style 'red' to win, got %v", divStyled.Styles["color"])
 	}
 }
+
+// TestMediaRules tests that @media rules apply only when they match the
+// media environment in the options.
+// CSS 2.1 §7.2.1 The @media rule
+func TestMediaRules(t *testing.T) {
+	stylesheet := css.Parse(`
+		p { color: black; width: 100px; }
+		@media (max-width: 600px) { p { width: 50px; } }
+		@media print { p { color: gray; } }
+		@media (prefers-color-scheme: dark) { p { color: white; } }
+	`)
+
+	tests := []struct {
+		name          string
+		media         css.MediaEnvironment
+		expectedColor string
+		expectedWidth string
+	}{
+		{"default screen", css.DefaultMediaEnvironment(), "black", "100px"},
+		{"narrow screen", css.MediaEnvironment{Type: "screen", Width: 400, Height: 600, ColorScheme: "light", Resolution: 1}, "black", "50px"},
+		{"print", css.MediaEnvironment{Type: "print", Width: 800, Height: 1100, ColorScheme: "light", Resolution: 1}, "gray", "100px"},
+		{"dark", css.MediaEnvironment{Type: "screen", Width: 800, Height: 600, ColorScheme: "dark", Resolution: 1}, "white", "100px"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := dom.NewDocument()
+			doc.AppendChild(dom.NewElement("p"))
+
+			styled := StyleTreeWithOptions(doc, stylesheet, Options{Media: tt.media}).Children[0]
+			if styled.Styles["color"] != tt.expectedColor {
+				t.Errorf("Expected color %q, got %q", tt.expectedColor, styled.Styles["color"])
+			}
+			if styled.Styles["width"] != tt.expectedWidth {
+				t.Errorf("Expected width %q, got %q", tt.expectedWidth, styled.Styles["width"])
+			}
+		})
+	}
+}
+
+// TestNestedRules tests the cascade of nested rules: '&' has the
+// specificity of :is() of the parent selectors, and declarations after a
+// nested rule win over it.
+// CSS Nesting Level 1 §3.2 Nested declarations rules, §4.1 Nesting selector specificity
+func TestNestedRules(t *testing.T) {
+	stylesheet := css.Parse(`
+		.card, #main {
+			& .title { color: red; }
+			> p { color: green; }
+		}
+		.card .title.title.title { color: blue; }
+		p {
+			& { width: 10px; }
+			width: 20px;
+			@media (max-width: 600px) { width: 30px; }
+			@media print { width: 40px; }
+		}
+	`)
+	doc := html.Parse(`<html><body><div class="card"><h2 class="title">t</h2><p>p</p></div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	// :is(.card, #main) .title has specificity (1,1,0), beating (0,4,0)
+	if got := styledNodeOf(styled, findNode(doc, "h2")).Styles["color"]; got != "red" {
+		t.Errorf("Expected the nested rule to win by the specificity of #main, got %q", got)
+	}
+	p := styledNodeOf(styled, findNode(doc, "p"))
+	if got := p.Styles["color"]; got != "green" {
+		t.Errorf("Expected the relative selector > p to match, got %q", got)
+	}
+	if got := p.Styles["width"]; got != "20px" {
+		t.Errorf("Expected the declarations after & {} to win, got %q", got)
+	}
+
+	narrow := css.MediaEnvironment{Type: "screen", Width: 400, Height: 600, ColorScheme: "light", Resolution: 1}
+	styled = StyleTreeWithOptions(doc, stylesheet, Options{Media: narrow})
+	if got := styledNodeOf(styled, findNode(doc, "p")).Styles["width"]; got != "30px" {
+		t.Errorf("Expected the nested @media rule to apply, got %q", got)
+	}
+}
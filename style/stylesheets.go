@@ -0,0 +1,209 @@
+// Package style collects the author stylesheets of a document.
+// HTML5 §4.2.4 The link element, §4.2.6 The style element,
+// CSS 2.1 §6.3 The @import rule
+package style
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+	"github.com/lukehoban/browser/log"
+)
+
+// LoadStylesheets returns the author stylesheets of a document as a single
+// stylesheet. <style> elements and <link rel="stylesheet"> resources are
+// taken in tree order, and each @import is replaced by the rules of the
+// stylesheet it imports, so that rules cascade in the order they appear.
+// The media attribute of a <style> or <link>, and the media list of an
+// @import, are added to the media of every rule they contain.
+//
+// Link hrefs must already be resolved by dom.ResolveURLs. @import URLs are
+// resolved against the URL of the stylesheet containing them, or against
+// baseURL for <style> elements. Stylesheets that fail to load are skipped,
+// as are imports that would form a cycle. @font-face rules are collected
+// with their BaseURL set to the URL of the stylesheet that declares them,
+// and @property rules in the order they appear. Each rule's Location gets
+// the URL of its stylesheet, or baseURL and the position of its <style>
+// element.
+func LoadStylesheets(doc *dom.Node, baseURL string) *css.Stylesheet {
+	loader := &stylesheetLoader{
+		resources: dom.NewResourceLoader(baseURL),
+		rules:     make([]*css.Rule, 0),
+	}
+	loader.collect(doc, baseURL)
+	return &css.Stylesheet{Rules: loader.rules, FontFaces: loader.fontFaces, Properties: loader.properties}
+}
+
+// LoadStylesheet loads the stylesheet at url, a URL or file path, with its
+// @import rules replaced by the rules they import, for use as
+// Options.UserStylesheet or Options.UserAgentStylesheet. Unlike the
+// stylesheets of a document, failing to load it is an error.
+func LoadStylesheet(url string) (*css.Stylesheet, error) {
+	loader := &stylesheetLoader{
+		resources: dom.NewResourceLoader(""),
+		rules:     make([]*css.Rule, 0),
+	}
+	text, err := loader.resources.LoadResourceAsString(url)
+	if err != nil {
+		return nil, err
+	}
+	loader.add(text, stylesheetBaseURL(url), css.Location{URL: url}, nil, map[string]bool{url: true})
+	return &css.Stylesheet{Rules: loader.rules, FontFaces: loader.fontFaces, Properties: loader.properties}, nil
+}
+
+// stylesheetLoader accumulates the rules of a document's stylesheets.
+type stylesheetLoader struct {
+	resources  *dom.ResourceLoader
+	rules      []*css.Rule
+	fontFaces  []*css.FontFace
+	properties []*css.PropertyRule
+
+	// styleElements counts the <style> elements added so far.
+	styleElements int
+}
+
+// collect walks the DOM in tree order, adding the rules of each <style> and
+// stylesheet <link>.
+func (l *stylesheetLoader) collect(node *dom.Node, baseURL string) {
+	if node.Type == dom.ElementNode {
+		switch {
+		case node.Data == "style":
+			var text strings.Builder
+			for _, child := range node.Children {
+				if child.Type == dom.TextNode {
+					text.WriteString(child.Data)
+				}
+			}
+			l.styleElements++
+			source := css.Location{URL: baseURL, StyleElement: l.styleElements}
+			l.add(text.String(), baseURL, source, elementMedia(node), make(map[string]bool))
+
+		case node.Data == "link" && isStylesheetLink(node):
+			href := node.GetAttribute("href")
+			l.load(href, elementMedia(node), make(map[string]bool))
+		}
+	}
+
+	for _, child := range node.Children {
+		l.collect(child, baseURL)
+	}
+}
+
+// load fetches and adds the stylesheet at url. ancestors holds the URLs of
+// the stylesheets importing it, for cycle detection.
+func (l *stylesheetLoader) load(url string, media []*css.MediaQueryList, ancestors map[string]bool) {
+	// CSS Cascading Level 4 §2.1: A stylesheet that imports itself,
+	// directly or indirectly, is ignored
+	if ancestors[url] {
+		log.Warnf("Ignoring recursive @import of '%s'", url)
+		return
+	}
+
+	text, err := l.resources.LoadResourceAsString(url)
+	if err != nil {
+		// Skip failed stylesheets (non-blocking per HTML5 spec)
+		log.Warnf("Failed to load stylesheet '%s': %v", url, err)
+		return
+	}
+
+	nested := make(map[string]bool, len(ancestors)+1)
+	for ancestor := range ancestors {
+		nested[ancestor] = true
+	}
+	nested[url] = true
+	l.add(text, stylesheetBaseURL(url), css.Location{URL: url}, media, nested)
+}
+
+// add parses a stylesheet and adds its imports, then its own rules, with
+// the media lists of the importing element and rules prepended, and the
+// URL and <style> element of source given to the rules' locations.
+// CSS 2.1 §6.4.1: Imported rules are treated as if they were written in
+// place of the @import
+func (l *stylesheetLoader) add(text, baseURL string, source css.Location, media []*css.MediaQueryList, ancestors map[string]bool) {
+	sheet := css.Parse(text)
+
+	for _, imp := range sheet.Imports {
+		importMedia := media
+		if len(imp.Media.Queries) > 0 {
+			importMedia = appendMedia(media, imp.Media)
+		}
+		l.load(dom.ResolveURLString(baseURL, imp.URL), importMedia, ancestors)
+	}
+
+	for _, rule := range sheet.Rules {
+		if len(media) > 0 {
+			rule.Media = appendMedia(media, rule.Media...)
+		}
+		rule.Location.URL = source.URL
+		rule.Location.StyleElement = source.StyleElement
+		l.rules = append(l.rules, rule)
+	}
+
+	// CSS Fonts Level 4 §4.3: Relative src URLs are resolved against the
+	// stylesheet containing the @font-face rule
+	for _, face := range sheet.FontFaces {
+		if len(media) > 0 {
+			face.Media = appendMedia(media, face.Media...)
+		}
+		face.BaseURL = baseURL
+		l.fontFaces = append(l.fontFaces, face)
+	}
+
+	for _, property := range sheet.Properties {
+		if len(media) > 0 {
+			property.Media = appendMedia(media, property.Media...)
+		}
+		l.properties = append(l.properties, property)
+	}
+}
+
+// appendMedia returns a new slice of outer followed by inner, so that
+// sibling rules never share a backing array.
+func appendMedia(outer []*css.MediaQueryList, inner ...*css.MediaQueryList) []*css.MediaQueryList {
+	media := make([]*css.MediaQueryList, 0, len(outer)+len(inner))
+	media = append(media, outer...)
+	return append(media, inner...)
+}
+
+// elementMedia returns the media attribute of a <style> or <link> as a media
+// list, or nil if it has none.
+// HTML5 §4.2.4: The default, if the media attribute is omitted, is "all"
+func elementMedia(node *dom.Node) []*css.MediaQueryList {
+	media := strings.TrimSpace(node.GetAttribute("media"))
+	if media == "" {
+		return nil
+	}
+	return []*css.MediaQueryList{css.ParseMediaQueryList(media)}
+}
+
+// isStylesheetLink reports whether a <link> is a persistent or preferred
+// stylesheet. Alternate stylesheets are not applied by default.
+// HTML5 §4.6.6.11 Link type "stylesheet": rel is a set of space-separated,
+// ASCII case-insensitive keywords
+func isStylesheetLink(node *dom.Node) bool {
+	if node.GetAttribute("href") == "" {
+		return false
+	}
+	stylesheet := false
+	for _, keyword := range strings.Fields(strings.ToLower(node.GetAttribute("rel"))) {
+		switch keyword {
+		case "stylesheet":
+			stylesheet = true
+		case "alternate":
+			return false
+		}
+	}
+	return stylesheet
+}
+
+// stylesheetBaseURL returns the base against which the URLs inside the
+// stylesheet at url are resolved: the URL itself for network resources,
+// or its directory for file paths.
+func stylesheetBaseURL(url string) string {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") || strings.HasPrefix(url, "data:") {
+		return url
+	}
+	return filepath.Dir(url)
+}
@@ -0,0 +1,266 @@
+package style
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/dom"
+)
+
+// writeFiles creates files under dir from a map of relative paths to contents.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newStylesheetDocument creates a document whose head holds the given
+// <link> and <style> elements, in order.
+func newStylesheetDocument(elements ...*dom.Node) *dom.Node {
+	doc := dom.NewDocument()
+	head := dom.NewElement("head")
+	doc.AppendChild(head)
+	for _, element := range elements {
+		head.AppendChild(element)
+	}
+	return doc
+}
+
+func newLink(rel, href, media string) *dom.Node {
+	link := dom.NewElement("link")
+	link.SetAttribute("rel", rel)
+	link.SetAttribute("href", href)
+	if media != "" {
+		link.SetAttribute("media", media)
+	}
+	return link
+}
+
+func newStyle(text, media string) *dom.Node {
+	style := dom.NewElement("style")
+	style.AppendChild(dom.NewText(text))
+	if media != "" {
+		style.SetAttribute("media", media)
+	}
+	return style
+}
+
+// ruleColors returns the color declared by each rule, in order.
+func ruleColors(sheet *css.Stylesheet) []string {
+	colors := make([]string, 0)
+	for _, rule := range sheet.Rules {
+		for _, decl := range rule.Declarations {
+			if decl.Property == "color" {
+				colors = append(colors, decl.Value)
+			}
+		}
+	}
+	return colors
+}
+
+// TestLoadStylesheetsOrder tests that <link>, <style> and @import rules are
+// collected in cascade order, with imports resolved relative to the
+// importing stylesheet.
+// CSS 2.1 §6.3 The @import rule, §6.4.1 Cascading order
+func TestLoadStylesheetsOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"css/main.css":        `@import "parts/reset.css"; p { color: blue; }`,
+		"css/parts/reset.css": `@import url(../../base.css); p { color: gray; }`,
+		"base.css":            `p { color: black; }`,
+	})
+
+	doc := newStylesheetDocument(
+		newStyle(`p { color: red; }`, ""),
+		newLink("stylesheet", filepath.Join(dir, "css/main.css"), ""),
+		newStyle(`@import "base.css"; p { color: green; }`, ""),
+	)
+
+	sheet := LoadStylesheets(doc, dir)
+	expected := []string{"red", "black", "gray", "blue", "black", "green"}
+	got := ruleColors(sheet)
+	if len(got) != len(expected) {
+		t.Fatalf("Expected rules %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected rules %v, got %v", expected, got)
+			break
+		}
+	}
+}
+
+// TestLoadStylesheetsImportCycle tests that recursive imports are ignored
+// while each stylesheet in the cycle is still applied once.
+func TestLoadStylesheetsImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.css": `@import "b.css"; p { color: red; }`,
+		"b.css": `@import "a.css"; @import "b.css"; p { color: blue; }`,
+	})
+
+	doc := newStylesheetDocument(newLink("stylesheet", filepath.Join(dir, "a.css"), ""))
+
+	got := ruleColors(LoadStylesheets(doc, dir))
+	if len(got) != 2 || got[0] != "blue" || got[1] != "red" {
+		t.Errorf("Expected [blue red], got %v", got)
+	}
+}
+
+// TestLoadStylesheetsLocations tests that rules are located in the
+// stylesheet that holds them, imports included, and rules of <style>
+// elements by the element's position.
+func TestLoadStylesheetsLocations(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.css":  "@import \"reset.css\";\n\np { color: blue; }",
+		"reset.css": `p { color: gray; }`,
+	})
+	main := filepath.Join(dir, "main.css")
+
+	doc := newStylesheetDocument(
+		newStyle("\np { color: red; }", ""),
+		newLink("stylesheet", main, ""),
+		newStyle(`p { color: green; }`, ""),
+	)
+	sheet := LoadStylesheets(doc, dir)
+
+	expected := []css.Location{
+		{URL: dir, Line: 2, StyleElement: 1},
+		{URL: filepath.Join(dir, "reset.css"), Line: 1},
+		{URL: main, Line: 3},
+		{URL: dir, Line: 1, StyleElement: 2},
+	}
+	if len(sheet.Rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %d", len(expected), len(sheet.Rules))
+	}
+	for i, rule := range sheet.Rules {
+		if rule.Location != expected[i] {
+			t.Errorf("Rule %d: expected location %+v, got %+v", i, expected[i], rule.Location)
+		}
+	}
+}
+
+// TestLoadStylesheet tests loading a user or user-agent stylesheet with
+// its imports, and that failing to load it is an error.
+func TestLoadStylesheet(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"user.css":  "@import \"fonts.css\";\np { color: white !important; }",
+		"fonts.css": `p { color: black; }`,
+	})
+	path := filepath.Join(dir, "user.css")
+
+	sheet, err := LoadStylesheet(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ruleColors(sheet)
+	if len(got) != 2 || got[0] != "black" || got[1] != "white" {
+		t.Errorf("Expected [black white], got %v", got)
+	}
+	if location := sheet.Rules[1].Location; location != (css.Location{URL: path, Line: 2}) {
+		t.Errorf("Expected the rule at %s:2, got %+v", path, location)
+	}
+
+	if _, err := LoadStylesheet(filepath.Join(dir, "missing.css")); err == nil {
+		t.Error("Expected an error loading a missing stylesheet")
+	}
+}
+
+// TestLoadStylesheetsMedia tests that media attributes and @import media
+// lists restrict the rules they contain.
+// HTML5 §4.2.4 The link element: the media attribute
+func TestLoadStylesheetsMedia(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"print.css":  `p { width: 10px; }`,
+		"narrow.css": `@media (orientation: landscape) { p { height: 20px; } }`,
+		"wide.css":   `@import "narrow.css" (max-width: 500px); p { color: blue; }`,
+	})
+
+	doc := newStylesheetDocument(
+		newLink("stylesheet", filepath.Join(dir, "print.css"), "print"),
+		newLink("stylesheet", filepath.Join(dir, "wide.css"), "screen"),
+		newStyle(`p { background-color: yellow; }`, "(prefers-color-scheme: dark)"),
+	)
+	body := dom.NewElement("body")
+	p := dom.NewElement("p")
+	body.AppendChild(p)
+	doc.AppendChild(body)
+
+	sheet := LoadStylesheets(doc, dir)
+	if len(sheet.Rules) != 4 {
+		t.Fatalf("Expected 4 rules, got %d", len(sheet.Rules))
+	}
+	if media := sheet.Rules[1].Media; len(media) != 3 {
+		t.Errorf("Expected link, @import and @media lists on the imported rule, got %d", len(media))
+	}
+
+	tests := []struct {
+		name     string
+		media    css.MediaEnvironment
+		expected map[string]string
+	}{
+		{
+			name:     "wide screen",
+			media:    css.DefaultMediaEnvironment(),
+			expected: map[string]string{"width": "", "height": "", "color": "blue", "background-color": ""},
+		},
+		{
+			name:     "narrow dark screen",
+			media:    css.MediaEnvironment{Type: "screen", Width: 480, Height: 320, ColorScheme: "dark", Resolution: 1},
+			expected: map[string]string{"width": "", "height": "20px", "color": "blue", "background-color": "yellow"},
+		},
+		{
+			name:     "print",
+			media:    css.MediaEnvironment{Type: "print", Width: 480, Height: 320, ColorScheme: "light", Resolution: 1},
+			expected: map[string]string{"width": "10px", "height": "", "color": "", "background-color": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			styled := StyleTreeWithOptions(doc, sheet, Options{Media: tt.media})
+			pStyled := styled.Children[1].Children[0]
+			for property, expected := range tt.expected {
+				if got := pStyled.Styles[property]; got != expected {
+					t.Errorf("Expected %s %q, got %q", property, expected, got)
+				}
+			}
+		})
+	}
+}
+
+// TestIsStylesheetLink tests which <link> elements are applied.
+// HTML5 §4.6.6.11 Link type "stylesheet"
+func TestIsStylesheetLink(t *testing.T) {
+	tests := []struct {
+		rel      string
+		href     string
+		expected bool
+	}{
+		{"stylesheet", "a.css", true},
+		{"StyleSheet", "a.css", true},
+		{"preload stylesheet", "a.css", true},
+		{"alternate stylesheet", "a.css", false},
+		{"stylesheet alternate", "a.css", false},
+		{"icon", "a.ico", false},
+		{"stylesheet", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := isStylesheetLink(newLink(tt.rel, tt.href, "")); got != tt.expected {
+			t.Errorf("isStylesheetLink(rel=%q href=%q) = %v, want %v", tt.rel, tt.href, got, tt.expected)
+		}
+	}
+}
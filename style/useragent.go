@@ -3,21 +3,40 @@
 package style
 
 import (
+	"sync"
+
 	"github.com/lukehoban/browser/css"
 )
 
 // DefaultUserAgentStylesheet returns a comprehensive user-agent stylesheet
 // with default styles for common HTML elements.
 // Based on CSS 2.1 Appendix D and modern browser defaults.
+// The stylesheet is parsed once and shared by every caller, so it must not
+// be modified; Options.UserAgentStylesheet replaces it.
 func DefaultUserAgentStylesheet() *css.Stylesheet {
-	// Parse the default CSS rules
-	// These provide sensible defaults matching common browser behavior
-	defaultCSS := `
+	return defaultUserAgentStylesheet()
+}
+
+// defaultUserAgentStylesheet parses defaultUserAgentCSS on first use.
+var defaultUserAgentStylesheet = sync.OnceValue(func() *css.Stylesheet {
+	return css.Parse(defaultUserAgentCSS)
+})
+
+// defaultUserAgentCSS holds the default CSS rules.
+// These provide sensible defaults matching common browser behavior
+const defaultUserAgentCSS = `
 /* CSS 2.1 §17.2: Table default styles */
 table { display: table; border-spacing: 2px; }
 tr { display: table-row; }
 td, th { display: table-cell; padding: 1px; }
 
+/* HTML §15.3.10: Cells are vertically centered and take the valign of
+   their row; borders are gray */
+thead, tbody, tfoot, table > tr { vertical-align: middle; }
+tr, td, th { vertical-align: inherit; }
+table, td, th { border-color: gray; }
+thead, tbody, tfoot, tr { border-color: inherit; }
+
 /* CSS 2.1 §9.2.1: Block-level elements */
 div, p, h1, h2, h3, h4, h5, h6, ul, ol, li, dl, dt, dd, 
 blockquote, pre, form, fieldset, hr, address, center {
@@ -39,6 +58,13 @@ p { margin: 1em 0; }
 ul, ol { margin: 1em 0; padding-left: 40px; }
 li { display: list-item; }
 
+/* HTML5 §15.3.8 Lists, CSS Lists Level 3 §4.6: Markers and numbering */
+ol, ul, menu { counter-reset: list-item; }
+ul, menu { list-style-type: disc; }
+ol { list-style-type: decimal; }
+:is(ul, ol, menu) ul, :is(ul, ol, menu) menu { list-style-type: circle; }
+:is(ul, ol, menu) :is(ul, ol, menu) ul, :is(ul, ol, menu) :is(ul, ol, menu) menu { list-style-type: square; }
+
 /* Links - CSS 2.1 §16.3.1 */
 /* Note: Modern browsers do not apply text-decoration in UA stylesheet.
    Text decoration for links is applied via a different mechanism that
@@ -47,7 +73,7 @@ a { color: #0000EE; }
 a:visited { color: #551A8B; }
 
 /* Text formatting elements - HTML5 §10.3.1 */
-b, strong { font-weight: bold; }
+b, strong { font-weight: bolder; }
 i, em { font-style: italic; }
 u { text-decoration: underline; }
 code, kbd, samp, tt { font-family: monospace; }
@@ -71,8 +97,8 @@ blockquote { margin: 1em 40px; }
 
 /* Center element - deprecated but still used */
 center { text-align: center; }
-`
 
-	stylesheet := css.Parse(defaultCSS)
-	return stylesheet
-}
+/* HTML §15.3.5 Bidirectional text; the dir attribute is mapped in style.go */
+bdi, output { unicode-bidi: isolate; }
+bdo { unicode-bidi: isolate-override; }
+`
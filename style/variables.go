@@ -0,0 +1,184 @@
+package style
+
+// This file cascades custom properties and substitutes var() functions.
+// Custom properties are cascaded first, since the values of other
+// properties may refer to them; var() references among custom properties
+// are resolved, with cycles making every property in them invalid.
+//
+// Spec references:
+// - CSS Variables Level 1 §2.3 Resolving Dependency Cycles: https://www.w3.org/TR/css-variables-1/#cycles
+// - CSS Variables Level 1 §3.1 Invalid Variables: https://www.w3.org/TR/css-variables-1/#invalid-variables
+// - CSS Properties and Values API Level 1 §2 Registered custom properties: https://www.w3.org/TR/css-properties-values-api-1/#behavior-of-custom-props
+
+import (
+	"strings"
+
+	"github.com/lukehoban/browser/css"
+)
+
+// cascadeCustomProperties applies the custom property declarations of the
+// matched rules and then of inline, in cascade order, to styles, which
+// holds the inherited custom properties. var() references in their values
+// are substituted.
+// CSS Variables Level 1 §2: custom properties are always inherited,
+// unless registered with inherits: false
+func (ctx *styleContext) cascadeCustomProperties(styles, parentStyles map[string]string, matched []MatchedRule, inline []*css.Declaration) {
+	// CSS Properties and Values API Level 1 §2: registered properties
+	// start from their initial value where they are not inherited
+	for name, rule := range ctx.properties {
+		if _, ok := styles[name]; ok && rule.Inherits {
+			continue
+		}
+		ctx.resetCustomProperty(name, styles)
+	}
+
+	declared := make(map[string]string)
+	for _, d := range cascadeOrder(matched, inline) {
+		if ctx.declaresCustomProperty(d.decl) {
+			declared[d.decl.Property] = d.decl.Value
+		}
+	}
+	if len(declared) == 0 {
+		return
+	}
+
+	r := &customPropertyResolver{
+		ctx:      ctx,
+		styles:   styles,
+		parent:   parentStyles,
+		declared: declared,
+		state:    make(map[string]resolveState),
+		cyclic:   make(map[string]bool),
+	}
+	for name := range declared {
+		r.resolve(name)
+	}
+}
+
+// declaresCustomProperty reports whether decl is a declaration of a custom
+// property that takes part in the cascade.
+func (ctx *styleContext) declaresCustomProperty(decl *css.Declaration) bool {
+	if !css.IsCustomProperty(decl.Property) {
+		return false
+	}
+	// A value that does not match a registered syntax is invalid at
+	// parse time, so the declaration is ignored
+	rule := ctx.properties[decl.Property]
+	return rule == nil || css.HasVar(decl.Value) || css.IsCSSWideKeyword(decl.Value) || rule.Matches(decl.Value)
+}
+
+// resolveState tracks a custom property through dependency resolution.
+type resolveState int
+
+const (
+	unresolved resolveState = iota
+	resolving
+	resolved
+)
+
+// customPropertyResolver resolves the var() references of an element's
+// declared custom properties by depth-first search, detecting cycles.
+type customPropertyResolver struct {
+	ctx      *styleContext
+	styles   map[string]string
+	parent   map[string]string
+	declared map[string]string
+	state    map[string]resolveState
+	stack    []string
+	cyclic   map[string]bool
+}
+
+// resolve computes the value of the custom property name into styles and
+// returns it, or false if it is the guaranteed-invalid value.
+// CSS Variables Level 1 §2.3: if there is a cycle in the dependency graph,
+// all the custom properties in the cycle are invalid at computed-value time
+func (r *customPropertyResolver) resolve(name string) (string, bool) {
+	value, ok := r.declared[name]
+	switch {
+	case !ok || r.state[name] == resolved:
+		value, ok := r.styles[name]
+		return value, ok
+	case r.state[name] == resolving:
+		for i := len(r.stack) - 1; i >= 0 && r.stack[i] != name; i-- {
+			r.cyclic[r.stack[i]] = true
+		}
+		r.cyclic[name] = true
+		return "", false
+	}
+
+	r.state[name] = resolving
+	r.stack = append(r.stack, name)
+	computed, ok := css.SubstituteVars(value, r.resolve)
+	r.stack = r.stack[:len(r.stack)-1]
+	r.state[name] = resolved
+
+	rule := r.ctx.properties[name]
+	switch {
+	case r.cyclic[name]:
+		ok = false
+	case css.IsCSSWideKeyword(value):
+		r.applyCSSWideKeyword(name, strings.ToLower(strings.TrimSpace(value)))
+		value, ok := r.styles[name]
+		return value, ok
+	case ok && rule != nil && !rule.Matches(computed):
+		// CSS Properties and Values API Level 1 §2.4: a substituted value
+		// that does not match the syntax is invalid at computed-value time
+		ok = false
+	}
+
+	if !ok {
+		// CSS Variables Level 1 §3.1: an invalid custom property computes
+		// to its initial value, the guaranteed-invalid value if unregistered
+		r.ctx.resetCustomProperty(name, r.styles)
+		value, ok := r.styles[name]
+		return value, ok
+	}
+	r.styles[name] = strings.TrimSpace(computed)
+	return r.styles[name], true
+}
+
+// applyCSSWideKeyword sets the custom property name to the value a
+// CSS-wide keyword gives it. 'revert' acts as 'unset', since the
+// user-agent stylesheet declares no custom properties to revert to.
+// CSS Cascading Level 4 §7.3 Explicit Defaulting
+func (r *customPropertyResolver) applyCSSWideKeyword(name, keyword string) {
+	inherits := true
+	if rule := r.ctx.properties[name]; rule != nil {
+		inherits = rule.Inherits
+	}
+	if keyword == "inherit" || (keyword != "initial" && inherits) {
+		if value, ok := r.parent[name]; ok {
+			r.styles[name] = value
+		} else {
+			delete(r.styles, name)
+		}
+		return
+	}
+	r.ctx.resetCustomProperty(name, r.styles)
+}
+
+// resetCustomProperty sets the custom property name to its initial value:
+// a registered property's initial value, or otherwise the
+// guaranteed-invalid value, represented by its absence from styles.
+func (ctx *styleContext) resetCustomProperty(name string, styles map[string]string) {
+	if rule := ctx.properties[name]; rule != nil && rule.HasInitialValue {
+		styles[name] = rule.InitialValue
+	} else {
+		delete(styles, name)
+	}
+}
+
+// substituteVars returns the value of decl with its var() functions
+// substituted from the custom properties of styles, or false if the
+// declaration is invalid at computed-value time.
+// CSS Variables Level 1 §3 Using Cascading Variables
+func substituteVars(decl *css.Declaration, styles map[string]string) (string, bool) {
+	if !css.HasVar(decl.Value) {
+		return decl.Value, true
+	}
+	value, ok := css.SubstituteVars(decl.Value, func(name string) (string, bool) {
+		value, ok := styles[name]
+		return value, ok
+	})
+	return strings.TrimSpace(value), ok
+}
@@ -0,0 +1,137 @@
+package style
+
+import (
+	"testing"
+
+	"github.com/lukehoban/browser/css"
+	"github.com/lukehoban/browser/html"
+)
+
+// TestCustomProperties tests the cascade and inheritance of custom
+// properties and var() substitution in other properties.
+// CSS Variables Level 1 §2, §3
+func TestCustomProperties(t *testing.T) {
+	stylesheet := css.Parse(`
+		html { --brand-color: #f60; --gap: 4px; --Case: upper; --case: lower; }
+		div { color: var(--brand-color); margin: var(--gap) calc(var(--gap) * 2); --gap: 8px; }
+		p { border: 1px solid var(--brand-color); padding: var(--missing, 3px); }
+		span { color: var(--missing); width: var(--missing); font-family: var(--Case); }
+		em { --gap: ; width: var(--gap) 10px; }
+		b { --gap: 2em; font-size: 10px; margin-left: var(--gap); }
+	`)
+	doc := html.Parse(`<html><body style="--inline: 7px"><div><p><span>a</span><em>b</em><b style="padding-top: var(--inline)">c</b></p></div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"div", "color", "#f60"},
+		{"div", "margin-top", "8px"},
+		{"div", "margin-right", "16px"},
+		{"div", "--gap", "8px"},
+		{"p", "--gap", "8px"},
+		{"p", "--brand-color", "#f60"},
+		{"p", "border-top-color", "#f60"},
+		{"p", "border-top-width", "1px"},
+		{"p", "padding-left", "3px"},
+		{"span", "color", "#f60"}, // unset: inherited from <p>
+		{"span", "width", "auto"}, // unset: initial
+		{"span", "font-family", "upper"},
+		{"em", "width", "10px"},
+		{"b", "--gap", "2em"},
+		{"b", "margin-left", "20px"},
+		{"b", "padding-top", "7px"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestCustomPropertyCycles tests that custom properties in a dependency
+// cycle are invalid, while those only referring to the cycle use their
+// fallbacks.
+// CSS Variables Level 1 §2.3 Resolving Dependency Cycles
+func TestCustomPropertyCycles(t *testing.T) {
+	stylesheet := css.Parse(`
+		body { --inherited: green; }
+		div {
+			--a: var(--b);
+			--b: var(--c, 1px);
+			--c: var(--a);
+			--self: var(--self, red);
+			--outside: var(--a, fallback);
+			--uses-c: var(--c);
+			--uses-inherited: var(--inherited);
+			--inherited: var(--inherited) blue;
+		}
+	`)
+	doc := html.Parse(`<html><body><div>a</div></body></html>`)
+	div := findStyledNode(StyleTree(doc, stylesheet), "div")
+
+	for _, name := range []string{"--a", "--b", "--c", "--self", "--uses-c", "--inherited", "--uses-inherited"} {
+		if value, ok := div.Styles[name]; ok {
+			t.Errorf("Expected %s to be invalid, got %q", name, value)
+		}
+	}
+	if got := div.Styles["--outside"]; got != "fallback" {
+		t.Errorf("Expected --outside %q, got %q", "fallback", got)
+	}
+}
+
+// TestRegisteredCustomProperties tests @property registrations: initial
+// values, non-inherited properties, syntax checks and computed lengths.
+// CSS Properties and Values API Level 1 §2, §3
+func TestRegisteredCustomProperties(t *testing.T) {
+	stylesheet := css.Parse(`
+		@property --size { syntax: "<length>"; inherits: true; initial-value: 3px }
+		@property --local { syntax: "<color>"; inherits: false; initial-value: black }
+		@property --count { syntax: "<integer>"; inherits: true; initial-value: 1 }
+		div { --size: 2em; font-size: 10px; --local: red; --count: 5; --count: oops; }
+		p { font-size: 20px; width: var(--size); color: var(--local); --count: var(--size); }
+		span { --size: initial; --local: inherit; }
+	`)
+	doc := html.Parse(`<html><body><div><p><span>a</span></p></div></body></html>`)
+	styled := StyleTree(doc, stylesheet)
+
+	tests := []struct {
+		tag      string
+		property string
+		expected string
+	}{
+		{"body", "--size", "3px"},
+		{"body", "--local", "black"},
+		{"div", "--size", "20px"}, // computed against the div's font size
+		{"div", "--local", "red"},
+		{"div", "--count", "5"}, // "oops" is not an <integer>, so ignored
+		{"p", "--size", "20px"},
+		{"p", "width", "20px"},
+		{"p", "--local", "black"}, // not inherited
+		{"p", "color", "black"},
+		{"p", "--count", "1"}, // invalid at computed-value time
+		{"span", "--size", "3px"},
+		{"span", "--local", "black"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tag+" "+tt.property, func(t *testing.T) {
+			node := findStyledNode(styled, tt.tag)
+			if node == nil {
+				t.Fatalf("No styled node for <%s>", tt.tag)
+			}
+			if got := node.Styles[tt.property]; got != tt.expected {
+				t.Errorf("Expected %s %q, got %q", tt.property, tt.expected, got)
+			}
+		})
+	}
+}